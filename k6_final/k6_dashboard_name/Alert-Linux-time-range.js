@@ -2,6 +2,9 @@ import http from 'k6/http';
 import { check } from 'k6';
 import { Trend, Rate, Counter } from 'k6/metrics';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.214.184';
+
 // Dynamic configuration via environment variables
 const CONFIG = {
   timeRange: {
@@ -40,7 +43,7 @@ if (!validateConfig(CONFIG)) {
 }
 
 // Read all users from file
-const allUsers = open('/home/vunet/user_creation_k6/user_cookies_module.txt')
+const allUsers = open(__ENV.K6_USERS_FILE || '/home/vunet/user_creation_k6/user_cookies_module.txt')
   .split('\n')
   .map(line => {
     const [username, password, accessToken, vunetSession, xVuNetHTTPInfo, grafanaSessionExpiry] = line.split(',');
@@ -96,7 +99,7 @@ export default function () {
     userIndex: userIndex.toString()
   };
 
-  const url = `https://164.52.214.184/vuSmartMaps/api/1/bu/1/alertrule/${user.dashboardName}/?execute_now=true&from=${encodeURIComponent(CONFIG.timeRange.from)}&to=${encodeURIComponent(CONFIG.timeRange.to)}`;
+  const url = `${BASE_URL}/vuSmartMaps/api/1/bu/1/alertrule/${user.dashboardName}/?execute_now=true&from=${encodeURIComponent(CONFIG.timeRange.from)}&to=${encodeURIComponent(CONFIG.timeRange.to)}`;
   
   const params = {
     headers: {
@@ -2,6 +2,9 @@ import http from 'k6/http';
 import { check } from 'k6';
 import { Trend, Rate } from 'k6/metrics';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.214.184';
+
 // Define test options
 export let options = {
     vus: 1, // Ensures only one iteration
@@ -9,7 +12,7 @@ export let options = {
 };
 
 // Read user details from file
-const usersRaw = open('/home/vunet/k6_final/user_cookies_module.txt').split('\n');
+const usersRaw = open(__ENV.K6_USERS_FILE || '/home/vunet/k6_final/user_cookies_module.txt').split('\n');
 const users = usersRaw.map(line => {
     const [username, password, accessToken, vunetSession, xVuNetHTTPInfo, grafanaSessionExpiry] = line.split(',');
     return {
@@ -34,7 +37,7 @@ const alertExecutionSuccessRate = new Rate('alert_execution_success_rate');
 
 export default function () {
     users.forEach(user => {
-        let url = `https://164.52.214.184/vuSmartMaps/api/1/bu/1/alertrule/${user.dashboardName}/?execute_now=true`;
+        let url = `${BASE_URL}/vuSmartMaps/api/1/bu/1/alertrule/${user.dashboardName}/?execute_now=true`;
         
         let params = {
             headers: {
@@ -43,7 +43,7 @@ for ALERT_SCRIPT in "$SCRIPT_DIR"/*.js; do
   START_TIME_MS=$(date +%s%3N)
 
   # Run k6 test
-  K6_INSECURE_SKIP_TLS_VERIFY=true k6 run \
+  K6_INSECURE_SKIP_TLS_VERIFY="${K6_INSECURE_SKIP_TLS_VERIFY:-true}" k6 run \
     --vus "$VUS" \
     --iterations "$ITERATIONS" \
     "$ALERT_SCRIPT" | tee "$OUTPUT_FILE"
@@ -2,6 +2,9 @@ import http from 'k6/http';
 import { check } from 'k6';
 import { Trend, Rate, Counter } from 'k6/metrics';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.213.158';
+
 // Dashboard configuration
 const DASHBOARD_CONFIG = {
   id: 'b1ec2dfd-6a8e-456b-869e-1f8df644e614',
@@ -35,7 +38,7 @@ if (!validateTimeRange(TIME_RANGE.from, TIME_RANGE.to)) {
     throw new Error('Invalid time range parameters');
 }
 
-const usersRaw = open('/home/vunet/k6_final/user_creation/user_cookies.txt').split('\n');
+const usersRaw = open(__ENV.K6_USERS_FILE || '/home/vunet/k6_final/user_creation/user_cookies.txt').split('\n');
 const users = usersRaw.map(line => {
     const [username, password, vunetSession, xVuNetHTTPInfo, grafanaSessionExpiry] = line.split(',');
     return {
@@ -130,7 +133,7 @@ export default function () {
     };
 
     // 1. Get dashboard JSON
-    const dashboardUrl = `https://164.52.213.158/vui/api/dashboards/uid/${DASHBOARD_CONFIG.id}`;
+    const dashboardUrl = `${BASE_URL}/vui/api/dashboards/uid/${DASHBOARD_CONFIG.id}`;
     
     const dashboardRes = http.get(dashboardUrl, {
         headers: {
@@ -191,7 +194,7 @@ export default function () {
         }
 
         // Add time range parameters to the URL
-        const panelUrl = `https://164.52.213.158/vui/d/${DASHBOARD_CONFIG.id}/mssql-overview-dashboard?orgId=1&viewPanel=${panelId}&from=${encodeURIComponent(TIME_RANGE.from)}&to=${encodeURIComponent(TIME_RANGE.to)}`;
+        const panelUrl = `${BASE_URL}/vui/d/${DASHBOARD_CONFIG.id}/mssql-overview-dashboard?orgId=1&viewPanel=${panelId}&from=${encodeURIComponent(TIME_RANGE.from)}&to=${encodeURIComponent(TIME_RANGE.to)}`;
         
         const panelRes = http.get(panelUrl, {
             headers: {
@@ -98,7 +98,7 @@ echo "   - Linux Server Insights: $LINUX_VUS VUs"
 echo "   - MSSQL Overview Dashboard: $MSSQL_VUS VUs"
 echo "   - Time Range: $TIME_RANGE"
 
-K6_INSECURE_SKIP_TLS_VERIFY=true k6 run \
+K6_INSECURE_SKIP_TLS_VERIFY="${K6_INSECURE_SKIP_TLS_VERIFY:-true}" k6 run \
   --out json="$RESULT_DIR/k6_results.json" \
   --out csv="$RESULT_DIR/k6_metrics.csv" \
   multi-dashboard-test.js 2>&1 | tee "$RESULT_DIR/multi_dashboard_execution.log"
@@ -2,6 +2,9 @@ import http from 'k6/http';
 import { check, sleep } from 'k6';
 import { Trend, Rate, Counter } from 'k6/metrics';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.213.158';
+
 // ===== DASHBOARD CONFIGURATIONS =====
 const DASHBOARD_CONFIGS = [
   {
@@ -27,7 +30,7 @@ const TIME_RANGE = {
 };
 
 // ===== USER MANAGEMENT =====
-const usersRaw = open('/home/vunet/k6_final/user_creation/user_cookies.txt').split('\n');
+const usersRaw = open(__ENV.K6_USERS_FILE || '/home/vunet/k6_final/user_creation/user_cookies.txt').split('\n');
 const users = usersRaw.map(line => {
   const [username, password, vunetSession, xVuNetHTTPInfo, grafanaSessionExpiry] = line.split(',');
   return {
@@ -73,7 +76,7 @@ export let options = {
       }
     }
   },
-  insecureSkipTLSVerify: true
+  insecureSkipTLSVerify: __ENV.K6_INSECURE_SKIP_TLS_VERIFY !== 'false'
 };
 
 // ===== METRICS SETUP =====
@@ -188,7 +191,7 @@ export default function () {
   console.log(`[${new Date().toISOString()}] 🔹 Starting test for ${dashboardConfig.name} with user ${user.username}`);
 
   // 1. Get dashboard JSON
-  const dashboardUrl = `https://164.52.213.158/vui/api/dashboards/uid/${dashboardConfig.id}`;
+  const dashboardUrl = `${BASE_URL}/vui/api/dashboards/uid/${dashboardConfig.id}`;
 
   const dashboardRes = http.get(dashboardUrl, {
     headers: {
@@ -256,7 +259,7 @@ export default function () {
     }
 
     // Add time range parameters to the URL
-    const panelUrl = `https://164.52.213.158/vui/d/${dashboardConfig.id}/${dashboardConfig.slug}?orgId=1&viewPanel=${panelId}&from=${encodeURIComponent(TIME_RANGE.from)}&to=${encodeURIComponent(TIME_RANGE.to)}`;
+    const panelUrl = `${BASE_URL}/vui/d/${dashboardConfig.id}/${dashboardConfig.slug}?orgId=1&viewPanel=${panelId}&from=${encodeURIComponent(TIME_RANGE.from)}&to=${encodeURIComponent(TIME_RANGE.to)}`;
 
     const panelRes = http.get(panelUrl, {
       headers: {
@@ -42,7 +42,7 @@ for DASHBOARD_SCRIPT in "$SCRIPT_DIR"/*.js; do
   OUTPUT_FILE="${RESULT_DIR}/${DASHBOARD_NAME}_${TIME_RANGE}_result.txt"
 
   # Run k6 test
-  K6_INSECURE_SKIP_TLS_VERIFY=true k6 run \
+  K6_INSECURE_SKIP_TLS_VERIFY="${K6_INSECURE_SKIP_TLS_VERIFY:-true}" k6 run \
     -e TIME_FROM="now-${TIME_RANGE}" \
     -e TIME_TO="now" \
     --vus "$VUS" \
@@ -2,9 +2,12 @@ import http from 'k6/http';
 import { check, sleep } from 'k6';
 import { SharedArray } from 'k6/data';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.213.158';
+
 // Load users from CSV
 const users = new SharedArray('user data', function () {
-  return open('/home/vunet/user_creation_k6/user_cookies_module.txt')
+  return open(__ENV.K6_USERS_FILE || '/home/vunet/user_creation_k6/user_cookies_module.txt')
     .split('\n')
     .filter(line => line.trim() !== '')
     .map(line => {
@@ -20,7 +23,7 @@ export let options = {
 
 export default function () {
   const user = users[__VU - 1]; // each VU gets a different user
-  const url = 'https://164.52.213.158/api/vuaccel/datamodel/log_query/';
+  const url = `${BASE_URL}/api/vuaccel/datamodel/log_query/`;
 
   const vql = {
     table: [
@@ -2,19 +2,20 @@ import http from "k6/http";
 import { check } from "k6";
 import { Trend, Rate } from "k6/metrics";
 
-// Load all users from a file
-const usersRaw = open("/home/vunet/k6_final/user_creation/user_cookies.txt").split("\n");
-const users = usersRaw.map((line) => {
-  const [username, password] = line.split(",");
-  return { username, password };
-});
+// Log in as the environment's user if the manager set one, otherwise as all users from a file
+const users = __ENV.K6_USERNAME
+  ? [{ username: __ENV.K6_USERNAME, password: __ENV.K6_PASSWORD }]
+  : open(__ENV.K6_USERS_FILE || "/home/vunet/k6_final/user_creation/user_cookies.txt").split("\n").map((line) => {
+      const [username, password] = line.split(",");
+      return { username, password };
+    });
 
 if (users.length === 0) {
   console.error("🚨 No valid users found in user_passwords_fixed.txt!");
   __ENV.K6_ABORT_ON_FAIL = "true";
 }
 
-console.log(users);
+console.log(users.map((user) => user.username));
 
 // Test Configuration: each VU runs one iteration
 export let options = {
@@ -25,11 +26,11 @@ export let options = {
       iterations: 1,      // Run one iteration per VU
     },
   },
-  insecureSkipTLSVerify: true,
+  insecureSkipTLSVerify: __ENV.K6_INSECURE_SKIP_TLS_VERIFY !== "false",
 };
 
 // Base URL and login endpoint
-const BASE_URL = "https://164.52.214.184";
+const BASE_URL = __ENV.K6_BASE_URL || "https://164.52.214.184";
 const LOGIN_ENDPOINT = `${BASE_URL}/vui/a/vusmartmaps-app?redirect=dashboard&lte=now&gte=now-15m`;
 
 // Metrics
@@ -42,7 +42,7 @@ echo "   Script: $(basename $LOGIN_SCRIPT)"
 echo "   VUs: $VUS | Iterations: $ITERATIONS"
 
 # Run k6 test
-K6_INSECURE_SKIP_TLS_VERIFY=true k6 run \
+K6_INSECURE_SKIP_TLS_VERIFY="${K6_INSECURE_SKIP_TLS_VERIFY:-true}" k6 run \
   --vus "$VUS" \
   --iterations "$ITERATIONS" \
   "$LOGIN_SCRIPT" | tee "$OUTPUT_FILE"
@@ -2,13 +2,16 @@ import http from 'k6/http';
 import { check } from 'k6';
 import { Trend, Rate, Counter } from 'k6/metrics';
 
+// Target of the run, set per environment by the manager
+const BASE_URL = __ENV.K6_BASE_URL || 'https://164.52.213.158';
+
 // Dashboard configuration
 const DASHBOARD_CONFIG = {
   id: 'b1ec2dfd-6a8e-456b-869e-1f8df644e614',
   name: 'MSSQL Overview Dashboard'
 };
 
-const usersRaw = open('/home/vunet/user_creation_k6/user_cookies.txt').split('\n');
+const usersRaw = open(__ENV.K6_USERS_FILE || '/home/vunet/user_creation_k6/user_cookies.txt').split('\n');
 const users = usersRaw.map(line => {
     const [username, password, vunetSession, xVuNetHTTPInfo, grafanaSessionExpiry] = line.split(',');
     return {
@@ -98,7 +101,7 @@ export default function () {
     };
 
     // 1. Get dashboard JSON
-    const dashboardUrl = `https://164.52.213.158/vui/api/dashboards/uid/${DASHBOARD_CONFIG.id}`;
+    const dashboardUrl = `${BASE_URL}/vui/api/dashboards/uid/${DASHBOARD_CONFIG.id}`;
     
     // Make request with full params to ensure built-in metrics are captured
     const dashboardRes = http.get(dashboardUrl, {
@@ -159,7 +162,7 @@ export default function () {
             return;
         }
 
-        const panelUrl = `https://164.52.213.158/vui/d/${DASHBOARD_CONFIG.id}/mssql-overview-dashboard?orgId=1&viewPanel=${panelId}`;
+        const panelUrl = `${BASE_URL}/vui/d/${DASHBOARD_CONFIG.id}/mssql-overview-dashboard?orgId=1&viewPanel=${panelId}`;
         
         // Make panel request with complete params
         const panelRes = http.get(panelUrl, {
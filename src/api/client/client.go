@@ -0,0 +1,395 @@
+// Package client is a Go client for the vuDataSim manager API, shared by the CLI and by
+// automation written in Go. Calls unwrap the {success, message, data} envelope of the
+// manager into typed results, authenticate with an API key and retry transient failures.
+// Mutating calls carry an Idempotency-Key, so a retry is never applied twice.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Config
+const (
+	DefaultTimeout    = 60 * time.Second
+	DefaultMaxRetries = 3
+	DefaultRetryWait  = 500 * time.Millisecond
+	maxRetryWait      = 30 * time.Second
+)
+
+// APIPrefix is the versioned prefix every path is sent under
+const APIPrefix = "/api/v1"
+
+// Headers the manager reads or sets
+const (
+	RequestIDHeader        = "X-Request-ID"
+	IdempotencyKeyHeader   = "Idempotency-Key"
+	IdempotentReplayHeader = "Idempotent-Replayed"
+	HALeaderHeader         = "X-HA-Leader"
+)
+
+// Config configures a Client
+type Config struct {
+	// BaseURL of the manager, e.g. http://manager:8086
+	BaseURL string
+	// APIKey is sent as a bearer token; a minted dashboard key only reads
+	APIKey string
+	// Timeout bounds one attempt of a request, 0 uses DefaultTimeout. Downloads are
+	// only bounded by their context.
+	Timeout time.Duration
+	// MaxRetries is how often a failed attempt is repeated, 0 uses DefaultMaxRetries and
+	// a negative value never retries
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled for each one after it; a
+	// Retry-After from the manager takes precedence
+	RetryWait time.Duration
+	// FollowLeader sends requests to the leader named by an HA follower that refused one
+	FollowLeader bool
+	// UserAgent identifies the caller in the manager's logs
+	UserAgent string
+	// HTTPClient replaces the default client, e.g. for custom TLS
+	HTTPClient *http.Client
+}
+
+// Client calls the manager API. It is safe for concurrent use.
+type Client struct {
+	mutex   sync.Mutex
+	baseURL string
+	config  Config
+	http    *http.Client
+}
+
+// New creates a client for the manager at config.BaseURL
+func New(config Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(config.BaseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid manager URL %q", config.BaseURL)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryWait <= 0 {
+		config.RetryWait = DefaultRetryWait
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = "vudatasim-client"
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &Client{baseURL: base.String(), config: config, http: httpClient}, nil
+}
+
+// BaseURL returns the manager the client talks to, the leader after it was followed
+func (c *Client) BaseURL() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.baseURL
+}
+
+// Response is the envelope of every JSON answer of the manager
+type Response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	StatusCode int         `json:"-"`
+	Header     http.Header `json:"-"`
+}
+
+// Replayed reports whether the manager answered a retried request with the stored
+// response of its first attempt
+func (r *Response) Replayed() bool {
+	return r.Header.Get(IdempotentReplayHeader) == "true"
+}
+
+// APIError is an answer of the manager with an error status or success false
+type APIError struct {
+	StatusCode int
+	Message    string
+	Data       json.RawMessage // details some endpoints attach, e.g. the impact of a refused change
+	RequestID  string          // correlation ID to look up in the manager's log
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("manager returned %d: %s (request %s)", e.StatusCode, message, e.RequestID)
+	}
+	return fmt.Sprintf("manager returned %d: %s", e.StatusCode, message)
+}
+
+// StatusCode returns the HTTP status of an APIError, 0 for other errors
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether the manager answered 404
+func IsNotFound(err error) bool { return StatusCode(err) == http.StatusNotFound }
+
+// IsConflict reports whether the manager refused the request with 409, e.g. a change
+// that would break the active run
+func IsConflict(err error) bool { return StatusCode(err) == http.StatusConflict }
+
+// request is one call, sent once per attempt
+type request struct {
+	method         string
+	path           string
+	query          url.Values
+	body           []byte
+	accept         string
+	idempotencyKey string
+	download       bool // stream the body instead of decoding the envelope
+}
+
+// Do sends a request to path under /api/v1 and decodes the data of the answer into out,
+// unless out is nil. Use it for endpoints without a typed method. body is sent as JSON.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*Response, error) {
+	req, err := c.newRequest(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response, err := decodeResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(response.Data) > 0 && string(response.Data) != "null" {
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			return response, fmt.Errorf("failed to decode %s %s data: %v", method, path, err)
+		}
+	}
+	return response, nil
+}
+
+// Get is Do for a GET request
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out interface{}) (*Response, error) {
+	return c.Do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// Download writes the body of a GET request, e.g. an artifacts zip or a CSV export, to w
+// and returns its content type
+func (c *Client) Download(ctx context.Context, path string, query url.Values, w io.Writer) (string, error) {
+	req, err := c.newRequest(http.MethodGet, path, query, nil)
+	if err != nil {
+		return "", err
+	}
+	req.accept, req.download = "*/*", true
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		_, err := decodeResponse(resp)
+		return "", err
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to download %s: %v", path, err)
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
+
+func (c *Client) newRequest(method, path string, query url.Values, body interface{}) (*request, error) {
+	req := &request{method: method, path: path, query: query, accept: "application/json"}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s body: %v", method, path, err)
+		}
+		req.body = data
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		key, err := newIdempotencyKey()
+		if err != nil {
+			return nil, err
+		}
+		req.idempotencyKey = key
+	}
+	return req, nil
+}
+
+// send makes the attempts of a request and returns the first answer that is not retried.
+// The caller closes its body.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	wait := c.config.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, cancel, err := c.attempt(ctx, req)
+		if err == nil && !c.retryable(resp) || attempt >= c.config.MaxRetries {
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		delay := wait
+		if err == nil {
+			if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds >= 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			if leader := resp.Header.Get(HALeaderHeader); leader != "" && c.config.FollowLeader && c.followLeader(leader) {
+				delay = 0
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		if wait *= 2; wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+	}
+}
+
+// attempt sends a request once. The returned cancel releases the attempt's timeout once
+// the body is read.
+func (c *Client) attempt(ctx context.Context, req *request) (*http.Response, context.CancelFunc, error) {
+	cancel := func() {}
+	if !req.download {
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+	}
+	target := c.BaseURL() + APIPrefix + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, body)
+	if err != nil {
+		cancel()
+		return nil, func() {}, err
+	}
+	httpReq.Header.Set("Accept", req.accept)
+	httpReq.Header.Set("User-Agent", c.config.UserAgent)
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set(IdempotencyKeyHeader, req.idempotencyKey)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		cancel()
+		return nil, func() {}, fmt.Errorf("%s %s: %w", req.method, req.path, err)
+	}
+	return resp, cancel, nil
+}
+
+// retryable reports whether an answer is transient: the manager is restarting, a follower
+// refused the request, it is rate limited, or the first attempt of the same idempotency
+// key is still running
+func (c *Client) retryable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusConflict:
+		return resp.Header.Get("Retry-After") != ""
+	}
+	return false
+}
+
+// followLeader points the client at the leader URL a follower named, reporting whether
+// it changed
+func (c *Client) followLeader(leader string) bool {
+	parsed, err := url.Parse(strings.TrimRight(leader, "/"))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.baseURL == parsed.String() {
+		return false
+	}
+	c.baseURL = parsed.String()
+	return true
+}
+
+// decodeResponse reads the envelope of an answer; an error status or success false
+// becomes an APIError
+func decodeResponse(resp *http.Response) (*Response, error) {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	response := &Response{StatusCode: resp.StatusCode, Header: resp.Header}
+	if jsonErr := json.Unmarshal(data, response); jsonErr != nil {
+		// Some errors are plain text, e.g. an invalid JSON payload
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data)), RequestID: resp.Header.Get(RequestIDHeader)}
+		}
+		return nil, fmt.Errorf("invalid response from manager: %v", jsonErr)
+	}
+	if resp.StatusCode >= http.StatusBadRequest || !response.Success {
+		return response, &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    response.Message,
+			Data:       response.Data,
+			RequestID:  resp.Header.Get(RequestIDHeader),
+		}
+	}
+	return response, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %v", err)
+	}
+	return "client-" + hex.EncodeToString(buf), nil
+}
+
+// cancelBody releases the attempt's timeout once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
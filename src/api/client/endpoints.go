@@ -0,0 +1,284 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/runs"
+)
+
+// Typed methods for the endpoints automation uses most; every other endpoint is reached
+// with Do, Get or Download and the paths listed in the README.
+
+// Health checks that the manager is up; it is answered by HA followers too
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	if _, err := c.Get(ctx, "/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Version returns the manager's build and the agent build it deploys
+func (c *Client) Version(ctx context.Context) (*VersionInfo, error) {
+	var info VersionInfo
+	if _, err := c.Get(ctx, "/version", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Dashboard returns the simulation state, the node metrics and the fleet summary
+func (c *Client) Dashboard(ctx context.Context) (*Dashboard, error) {
+	var dashboard Dashboard
+	if _, err := c.Get(ctx, "/dashboard", nil, &dashboard); err != nil {
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// StartSimulation starts a run; Dashboard.RunID is the ID of the new run
+func (c *Client) StartSimulation(ctx context.Context, config SimulationConfig) (*Dashboard, error) {
+	var dashboard Dashboard
+	if _, err := c.Do(ctx, http.MethodPost, "/simulation/start", nil, config, &dashboard); err != nil {
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// StopSimulation stops the active run as completed
+func (c *Client) StopSimulation(ctx context.Context) (*Dashboard, error) {
+	var dashboard Dashboard
+	if _, err := c.Do(ctx, http.MethodPost, "/simulation/stop", nil, nil, &dashboard); err != nil {
+		return nil, err
+	}
+	return &dashboard, nil
+}
+
+// AdjustEPS changes the EPS of the active run. reload false only pushes the configs
+// without restarting the binaries.
+func (c *Client) AdjustEPS(ctx context.Context, request EPSAdjustRequest, reload bool) (*EPSAdjustment, error) {
+	query := url.Values{}
+	if !reload {
+		query.Set("reload", "false")
+	}
+	var adjustment EPSAdjustment
+	if _, err := c.Do(ctx, http.MethodPatch, "/simulation/eps", query, request, &adjustment); err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
+
+// Nodes lists the configured nodes
+func (c *Client) Nodes(ctx context.Context) ([]Node, error) {
+	var nodes []Node
+	if _, err := c.Get(ctx, "/nodes", nil, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// CreateNode adds a node to nodes.yaml
+func (c *Client) CreateNode(ctx context.Context, name string, node NodeCreate) error {
+	_, err := c.Do(ctx, http.MethodPost, "/nodes/"+url.PathEscape(name), nil, node, nil)
+	return err
+}
+
+// UpdateNode enables or disables a node or changes its reservation. Disabling a node
+// during a run fails with a conflict unless update.Force is set.
+func (c *Client) UpdateNode(ctx context.Context, name string, update NodeUpdate) error {
+	_, err := c.Do(ctx, http.MethodPut, "/nodes/"+url.PathEscape(name), nil, update, nil)
+	return err
+}
+
+// DeleteNode removes a node from nodes.yaml
+func (c *Client) DeleteNode(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/nodes/"+url.PathEscape(name), nil, nil, nil)
+	return err
+}
+
+// BinaryStatuses returns the state of finalvudatasim on every node
+func (c *Client) BinaryStatuses(ctx context.Context) ([]BinaryStatus, error) {
+	var statuses []BinaryStatus
+	if _, err := c.Get(ctx, "/binary/status", nil, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// StartBinary starts finalvudatasim on a node, stopping it after timeoutMinutes when
+// positive. The data holds the start verification checks.
+func (c *Client) StartBinary(ctx context.Context, node string, timeoutMinutes int) (*Response, error) {
+	query := url.Values{}
+	if timeoutMinutes > 0 {
+		query.Set("timeout", strconv.Itoa(timeoutMinutes))
+	}
+	return c.Do(ctx, http.MethodPost, "/binary/start/"+url.PathEscape(node), query, nil, nil)
+}
+
+// StopBinary stops finalvudatasim on a node
+func (c *Client) StopBinary(ctx context.Context, node string) (*Response, error) {
+	return c.Do(ctx, http.MethodPost, "/binary/stop/"+url.PathEscape(node), nil, nil, nil)
+}
+
+// EnableSource enables an o11y source in conf.yml
+func (c *Client) EnableSource(ctx context.Context, source string) error {
+	_, err := c.Do(ctx, http.MethodPost, "/o11y/sources/"+url.PathEscape(source)+"/enable", nil, nil, nil)
+	return err
+}
+
+// DisableSource disables an o11y source in conf.yml
+func (c *Client) DisableSource(ctx context.Context, source string) error {
+	_, err := c.Do(ctx, http.MethodPost, "/o11y/sources/"+url.PathEscape(source)+"/disable", nil, nil, nil)
+	return err
+}
+
+// CurrentEPS returns the EPS the enabled sources are configured for
+func (c *Client) CurrentEPS(ctx context.Context) (*CurrentEPS, error) {
+	var eps CurrentEPS
+	if _, err := c.Get(ctx, "/o11y/eps/current", nil, &eps); err != nil {
+		return nil, err
+	}
+	return &eps, nil
+}
+
+// RunReport returns the report of a run with timestamps in timeZone, the manager's own
+// zone when empty
+func (c *Client) RunReport(ctx context.Context, runID, timeZone string) (*RunReport, error) {
+	query := url.Values{}
+	if timeZone != "" {
+		query.Set("tz", timeZone)
+	}
+	var report RunReport
+	if _, err := c.Get(ctx, "/runs/"+url.PathEscape(runID)+"/report", query, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// RunJUnit returns the pass/fail checks of a finished run as a JUnit report
+func (c *Client) RunJUnit(ctx context.Context, runID string) (*runs.JUnitTestSuites, error) {
+	var buf bytes.Buffer
+	if _, err := c.Download(ctx, "/runs/"+url.PathEscape(runID)+"/junit.xml", nil, &buf); err != nil {
+		return nil, err
+	}
+	var suites runs.JUnitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		return nil, err
+	}
+	return &suites, nil
+}
+
+// RunComparison compares a run with its scenario baseline, or with baselineRunID when set
+func (c *Client) RunComparison(ctx context.Context, runID, baselineRunID string) (*runs.Comparison, error) {
+	query := url.Values{}
+	if baselineRunID != "" {
+		query.Set("baseline", baselineRunID)
+	}
+	var comparison runs.Comparison
+	if _, err := c.Get(ctx, "/runs/"+url.PathEscape(runID)+"/comparison", query, &comparison); err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// RunArtifacts lists the artifacts collected for a run
+func (c *Client) RunArtifacts(ctx context.Context, runID string) (*RunArtifacts, error) {
+	var artifacts RunArtifacts
+	if _, err := c.Get(ctx, "/runs/"+url.PathEscape(runID)+"/artifacts", nil, &artifacts); err != nil {
+		return nil, err
+	}
+	return &artifacts, nil
+}
+
+// DownloadRunArtifacts writes the zip of a run's artifacts to w
+func (c *Client) DownloadRunArtifacts(ctx context.Context, runID string, w io.Writer) error {
+	_, err := c.Download(ctx, "/runs/"+url.PathEscape(runID)+"/artifacts.zip", nil, w)
+	return err
+}
+
+// PinBaseline pins a finished run as the baseline of its scenario; tolerances override
+// the configured regression tolerances in percent
+func (c *Client) PinBaseline(ctx context.Context, runID string, tolerances map[string]float64) (*runs.Baseline, error) {
+	var body interface{}
+	if len(tolerances) > 0 {
+		body = map[string]interface{}{"tolerances": tolerances}
+	}
+	var baseline runs.Baseline
+	if _, err := c.Do(ctx, http.MethodPost, "/runs/"+url.PathEscape(runID)+"/baseline", nil, body, &baseline); err != nil {
+		return nil, err
+	}
+	return &baseline, nil
+}
+
+// Baselines lists the pinned baselines and the configured tolerances
+func (c *Client) Baselines(ctx context.Context) (*Baselines, error) {
+	var baselines Baselines
+	if _, err := c.Get(ctx, "/baselines", nil, &baselines); err != nil {
+		return nil, err
+	}
+	return &baselines, nil
+}
+
+// UnpinBaseline removes the baseline of a scenario
+func (c *Client) UnpinBaseline(ctx context.Context, scenario string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/baselines/"+url.PathEscape(scenario), nil, nil, nil)
+	return err
+}
+
+// Capacity lists the capacities discovered by the adaptive EPS controller, newest first
+func (c *Client) Capacity(ctx context.Context) ([]CapacityRecord, error) {
+	var records []CapacityRecord
+	if _, err := c.Get(ctx, "/capacity", nil, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Jobs lists the transfer and fleet jobs with the transfer budget
+func (c *Client) Jobs(ctx context.Context) (*Jobs, error) {
+	var list Jobs
+	if _, err := c.Get(ctx, "/jobs", nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Job returns the progress of a job
+func (c *Client) Job(ctx context.Context, id string) (*jobs.JobStatus, error) {
+	var status jobs.JobStatus
+	if _, err := c.Get(ctx, "/jobs/"+url.PathEscape(id), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Maintenance returns the active, upcoming and recently ended maintenance windows
+func (c *Client) Maintenance(ctx context.Context) (*MaintenanceStatus, error) {
+	var status MaintenanceStatus
+	if _, err := c.Get(ctx, "/maintenance", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// CreateMaintenanceWindow schedules a maintenance window from window's Start, End, Scope
+// and Reason
+func (c *Client) CreateMaintenanceWindow(ctx context.Context, window MaintenanceWindow) (*MaintenanceWindow, error) {
+	var created MaintenanceWindow
+	if _, err := c.Do(ctx, http.MethodPost, "/maintenance/windows", nil, window, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// EndMaintenanceWindow ends an active window early or cancels an upcoming one
+func (c *Client) EndMaintenanceWindow(ctx context.Context, id string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/maintenance/windows/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
@@ -0,0 +1,304 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+	"vuDataSim/src/buildinfo"
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/runs"
+)
+
+// The request and response bodies mirror the manager's handlers. Types of the runs and
+// jobs packages are used as they are; the client does not import the server packages,
+// which load configuration and open connections.
+
+// Health is the data of GET /api/health
+type Health struct {
+	Status         string    `json:"status"`
+	Version        string    `json:"version"`
+	Timestamp      time.Time `json:"timestamp"`
+	Uptime         string    `json:"uptime"`
+	ServerTimeZone string    `json:"serverTimeZone"`
+}
+
+// AgentBuild identifies a node agent binary
+type AgentBuild struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+}
+
+// VersionInfo is the data of GET /api/version
+type VersionInfo struct {
+	Manager    buildinfo.Info `json:"manager"`
+	Agent      *AgentBuild    `json:"agent,omitempty"`
+	AgentError string         `json:"agentError,omitempty"`
+}
+
+// SimulationConfig is the body of POST /api/simulation/start
+type SimulationConfig struct {
+	Profile          string `json:"profile"`
+	Scenario         string `json:"scenario,omitempty"`
+	TargetEPS        int    `json:"targetEps"`
+	TargetKafka      int    `json:"targetKafka"`
+	TargetClickHouse int    `json:"targetClickHouse"`
+	DurationMinutes  int    `json:"durationMinutes,omitempty"`
+	SkipTableCheck   bool   `json:"skipTableCheck,omitempty"`
+	Workspace        string `json:"workspace,omitempty"`
+	TemporaryTopics  bool   `json:"temporaryTopics,omitempty"`
+}
+
+// SimulationState is the simulation part of the dashboard
+type SimulationState struct {
+	Running          bool      `json:"isSimulationRunning"`
+	Profile          string    `json:"currentProfile"`
+	TargetEPS        int       `json:"targetEps"`
+	TargetKafka      int       `json:"targetKafka"`
+	TargetClickHouse int       `json:"targetClickHouse"`
+	StartTime        time.Time `json:"startTime"`
+	DurationMinutes  int       `json:"durationMinutes,omitempty"`
+	RunID            string    `json:"currentRunId,omitempty"`
+}
+
+// NodeMetrics is what the dashboard shows of a node
+type NodeMetrics struct {
+	NodeID            string         `json:"nodeId"`
+	Status            string         `json:"status"`
+	EPS               int            `json:"eps"`
+	KafkaLoad         int            `json:"kafkaLoad"`
+	CHLoad            int            `json:"chLoad"`
+	CPU               float64        `json:"cpu"`
+	Memory            float64        `json:"memory"`
+	TotalCPU          float64        `json:"totalCpu"`
+	TotalMemory       float64        `json:"totalMemory"`
+	LastUpdate        time.Time      `json:"lastUpdate"`
+	AgeSeconds        *float64       `json:"ageSeconds,omitempty"`
+	Stale             bool           `json:"stale"`
+	Source            string         `json:"source,omitempty"`
+	GeneratorEPS      map[string]int `json:"generatorEps,omitempty"`
+	AllocatableCPU    float64        `json:"allocatableCpu,omitempty"`
+	AllocatableMemory float64        `json:"allocatableMemory,omitempty"`
+}
+
+// FleetSummary aggregates the fresh nodes of the dashboard
+type FleetSummary struct {
+	Nodes             int      `json:"nodes"`
+	FreshNodes        int      `json:"freshNodes"`
+	StaleNodes        []string `json:"staleNodes"`
+	TotalEPS          int      `json:"totalEps"`
+	GeneratorEPS      int      `json:"generatorEps"`
+	AvgCPU            *float64 `json:"avgCpu,omitempty"`
+	AvgMemory         *float64 `json:"avgMemory,omitempty"`
+	StaleAfterSeconds int      `json:"staleAfterSeconds"`
+}
+
+// Dashboard is the data of GET /api/dashboard and of simulation starts and stops
+type Dashboard struct {
+	SimulationState
+	NodeData    map[string]*NodeMetrics `json:"nodeData"`
+	Fleet       *FleetSummary           `json:"fleet,omitempty"`
+	Maintenance []MaintenanceWindow     `json:"maintenance,omitempty"`
+}
+
+// EPSAdjustRequest is the body of PATCH /api/simulation/eps; per-source values are
+// cluster-wide EPS
+type EPSAdjustRequest struct {
+	TotalEPS int            `json:"totalEps,omitempty"`
+	Sources  map[string]int `json:"sources,omitempty"`
+}
+
+// SourceEPSDelta is how a source's EPS changed in a live adjustment
+type SourceEPSDelta struct {
+	PreviousEPS      int `json:"previousEps"`
+	NewEPS           int `json:"newEps"`
+	PreviousMainKeys int `json:"previousMainKeys"`
+	NewMainKeys      int `json:"newMainKeys"`
+}
+
+// NodeResult is the outcome of a change pushed to one node
+type NodeResult struct {
+	NodeName   string `json:"nodeName"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	ConflictID string `json:"conflictId,omitempty"`
+}
+
+// EPSAdjustment is the data of PATCH /api/simulation/eps
+type EPSAdjustment struct {
+	RunID             string                    `json:"runId"`
+	PreviousTargetEPS int                       `json:"previousTargetEps,omitempty"`
+	TargetEPS         int                       `json:"targetEps"`
+	Deltas            map[string]SourceEPSDelta `json:"deltas,omitempty"`
+	PushedFiles       []string                  `json:"pushedFiles,omitempty"`
+	Distribution      map[string]NodeResult     `json:"distribution,omitempty"`
+	Reload            map[string]string         `json:"reload,omitempty"`
+}
+
+// Reservation is the CPU and memory of a node kept for a colocated workload
+type Reservation struct {
+	CPUCores float64 `json:"cpuCores,omitempty"`
+	MemoryGB float64 `json:"memoryGb,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+// Node is a configured node as listed by GET /api/nodes
+type Node struct {
+	Name         string       `json:"name"`
+	Host         string       `json:"host"`
+	User         string       `json:"user"`
+	Status       string       `json:"status"`
+	Description  string       `json:"description"`
+	BinaryDir    string       `json:"binary_dir"`
+	ConfDir      string       `json:"conf_dir"`
+	Enabled      bool         `json:"enabled"`
+	ExporterURL  string       `json:"exporter_url,omitempty"`
+	ExporterMode string       `json:"exporter_mode,omitempty"`
+	Generators   []string     `json:"generators,omitempty"`
+	Reserved     *Reservation `json:"reserved,omitempty"`
+}
+
+// NodeCreate is the body of POST /api/nodes/{name}
+type NodeCreate struct {
+	Host        string `json:"host"`
+	User        string `json:"user"`
+	KeyPath     string `json:"key_path"`
+	ConfDir     string `json:"conf_dir"`
+	BinaryDir   string `json:"binary_dir"`
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// NodeUpdate is the body of PUT /api/nodes/{name}. An empty Reserved removes the
+// reservation; Force disables a node although a run is active.
+type NodeUpdate struct {
+	Enabled  *bool        `json:"enabled,omitempty"`
+	Force    bool         `json:"force,omitempty"`
+	Reserved *Reservation `json:"reserved,omitempty"`
+}
+
+// BinaryStatus is the state of finalvudatasim or another generator on a node
+type BinaryStatus struct {
+	NodeName     string `json:"nodeName"`
+	Generator    string `json:"generator,omitempty"`
+	Status       string `json:"status"`
+	PID          int    `json:"pid,omitempty"`
+	StartTime    string `json:"startTime,omitempty"`
+	ProcessInfo  string `json:"processInfo,omitempty"`
+	Healthy      *bool  `json:"healthy,omitempty"`
+	HealthDetail string `json:"healthDetail,omitempty"`
+	LastChecked  string `json:"lastChecked"`
+}
+
+// CurrentEPS is the data of GET /api/o11y/eps/current
+type CurrentEPS struct {
+	TotalEPS  int             `json:"totalEPS"`
+	Breakdown json.RawMessage `json:"breakdown"`
+}
+
+// RunReportEvent is a run timeline entry in a report
+type RunReportEvent struct {
+	Time    string                 `json:"time"`
+	Type    string                 `json:"type"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// RunTarget compares a target rate of a run with the rate observed at its end
+type RunTarget struct {
+	Name          string   `json:"name"`
+	Unit          string   `json:"unit"`
+	Target        int      `json:"target"`
+	Observed      *float64 `json:"observed,omitempty"`
+	AttainmentPct *float64 `json:"attainmentPct,omitempty"`
+}
+
+// RunReport is the data of GET /api/runs/{id}/report
+type RunReport struct {
+	RunID            string             `json:"runId"`
+	Status           string             `json:"status"`
+	Profile          string             `json:"profile"`
+	Scenario         string             `json:"scenario"`
+	TargetEPS        int                `json:"targetEps"`
+	TargetKafka      int                `json:"targetKafka"`
+	TargetClickHouse int                `json:"targetClickHouse"`
+	TimeZone         string             `json:"timeZone"`
+	StartedAt        string             `json:"startedAt"`
+	EndedAt          string             `json:"endedAt,omitempty"`
+	Duration         string             `json:"duration"`
+	Timeline         []RunReportEvent   `json:"timeline"`
+	Targets          []RunTarget        `json:"targets"`
+	Summary          map[string]float64 `json:"summary,omitempty"`
+	Comparison       *runs.Comparison   `json:"comparison,omitempty"`
+	GenerationErrors json.RawMessage    `json:"generationErrors,omitempty"`
+	GeneratedAt      string             `json:"generatedAt"`
+}
+
+// RunArtifacts is the data of GET /api/runs/{id}/artifacts
+type RunArtifacts struct {
+	RunID       string          `json:"runId"`
+	Artifacts   []runs.Artifact `json:"artifacts"`
+	DownloadURL string          `json:"downloadUrl"`
+}
+
+// Baselines is the data of GET /api/baselines
+type Baselines struct {
+	Baselines  []runs.Baseline    `json:"baselines"`
+	Tolerances map[string]float64 `json:"tolerances"`
+}
+
+// Jobs is the data of GET /api/jobs
+type Jobs struct {
+	Jobs   []jobs.JobStatus `json:"jobs"`
+	Budget struct {
+		MaxConcurrentTransfers int `json:"maxConcurrentTransfers"`
+		TransferBandwidthKbps  int `json:"transferBandwidthKbps"`
+	} `json:"budget"`
+}
+
+// CapacityRecord is a capacity discovered by the adaptive EPS controller
+type CapacityRecord struct {
+	RunID                 string    `json:"runId"`
+	Scenario              string    `json:"scenario,omitempty"`
+	Signal                string    `json:"signal"`
+	Target                float64   `json:"target"`
+	Value                 float64   `json:"value"`
+	CapacityEPS           int       `json:"capacityEps"`
+	LimitedByMax          bool      `json:"limitedByMax"`
+	Nodes                 int       `json:"nodes"`
+	Sources               []string  `json:"sources"`
+	DiscoveredAt          time.Time `json:"discoveredAt"`
+	AllocatableCores      float64   `json:"allocatableCores,omitempty"`
+	EPSPerAllocatableCore *float64  `json:"epsPerAllocatableCore,omitempty"`
+}
+
+// MaintenanceRecord is an alert or scheduled run a maintenance window suppressed
+type MaintenanceRecord struct {
+	Time     time.Time `json:"time"`
+	Scope    string    `json:"scope"`
+	Severity string    `json:"severity,omitempty"`
+	Subject  string    `json:"subject"`
+	Text     string    `json:"text,omitempty"`
+}
+
+// MaintenanceWindow is a period in which alerts and scheduled runs are suppressed; only
+// Start, End, Scope and Reason are read when one is created
+type MaintenanceWindow struct {
+	ID              string              `json:"id,omitempty"`
+	Start           time.Time           `json:"start"`
+	End             time.Time           `json:"end"`
+	Scope           []string            `json:"scope,omitempty"`
+	Reason          string              `json:"reason,omitempty"`
+	Status          string              `json:"status,omitempty"`
+	CreatedBy       string              `json:"createdBy,omitempty"`
+	CreatedAt       time.Time           `json:"createdAt"`
+	EndedBy         string              `json:"endedBy,omitempty"`
+	SuppressedCount int                 `json:"suppressedCount,omitempty"`
+	Suppressed      []MaintenanceRecord `json:"suppressed,omitempty"`
+}
+
+// MaintenanceStatus is the data of GET /api/maintenance
+type MaintenanceStatus struct {
+	Active  []MaintenanceWindow `json:"active"`
+	Windows []MaintenanceWindow `json:"windows"`
+	Scopes  []string            `json:"scopes"`
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Roles, from least to most privileged
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// APIKeyHeader may carry the key instead of an Authorization: Bearer header
+const APIKeyHeader = "X-API-Key"
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAllows reports whether a caller with role have may use an endpoint requiring need
+func RoleAllows(have, need string) bool {
+	return roleRank[have] > 0 && roleRank[have] >= roleRank[need]
+}
+
+// Key is an API key configured in the auth section of config.yaml.
+// Either the plain key or its hex SHA-256 may be given.
+type Key struct {
+	Name      string `yaml:"name"`
+	Key       string `yaml:"key"`
+	KeySHA256 string `yaml:"key_sha256"`
+	Role      string `yaml:"role"`
+	User      string `yaml:"user"`
+	Team      string `yaml:"team"`
+}
+
+// Config holds the auth section of config.yaml
+type Config struct {
+	Enabled bool  `yaml:"enabled"`
+	Keys    []Key `yaml:"keys"`
+	// Keys minted through /api/auth/keys are stored hashed in MintedKeysFile
+	MintedKeysFile string `yaml:"minted_keys_file"`
+	MaxKeyDays     int    `yaml:"max_key_days"`
+}
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	User      string `json:"user,omitempty"`
+	Team      string `json:"team,omitempty"`
+	Scope     string `json:"scope,omitempty"` // restricts the key beyond its role, e.g. ScopeDashboard
+	Anonymous bool   `json:"anonymous,omitempty"`
+}
+
+// anonymousAdmin is used for every request while auth is disabled
+var anonymousAdmin = Identity{Name: "anonymous", Role: RoleAdmin, Anonymous: true}
+
+// Manager authenticates API keys
+type Manager struct {
+	mutex  sync.RWMutex
+	config Config
+	hashes map[string]Key // hex SHA-256 of the key -> key
+
+	mintedFile string
+	minted     map[string]*MintedKey // id -> key
+}
+
+// NewManager creates a manager with auth disabled
+func NewManager() *Manager {
+	return &Manager{
+		config: Config{MaxKeyDays: 90},
+		hashes: make(map[string]Key),
+		minted: make(map[string]*MintedKey),
+	}
+}
+
+// LoadConfig reads the auth section from the application config file
+func (m *Manager) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	fileConfig := struct {
+		Auth Config `yaml:"auth"`
+	}{Auth: Config{MintedKeysFile: "data/api_keys.json", MaxKeyDays: 90}}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if fileConfig.Auth.MaxKeyDays <= 0 {
+		return fmt.Errorf("auth.max_key_days must be positive")
+	}
+
+	hashes := make(map[string]Key)
+	for _, key := range fileConfig.Auth.Keys {
+		if !ValidRole(key.Role) {
+			return fmt.Errorf("api key %q has unknown role %q", key.Name, key.Role)
+		}
+		hash := strings.ToLower(key.KeySHA256)
+		if key.Key != "" {
+			hash = HashKey(key.Key)
+		}
+		if hash == "" {
+			return fmt.Errorf("api key %q has neither key nor key_sha256", key.Name)
+		}
+		key.Key = ""
+		hashes[hash] = key
+	}
+
+	m.mutex.Lock()
+	m.config = fileConfig.Auth
+	m.hashes = hashes
+	m.mutex.Unlock()
+	return m.LoadMintedKeys(fileConfig.Auth.MintedKeysFile)
+}
+
+// MaxKeyTTL is the longest lifetime a minted key may have
+func (m *Manager) MaxKeyTTL() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return time.Duration(m.config.MaxKeyDays) * 24 * time.Hour
+}
+
+// Enabled reports whether requests must carry an API key
+func (m *Manager) Enabled() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.config.Enabled
+}
+
+// Authenticate resolves the identity of a request. With auth disabled every request
+// is treated as an anonymous admin, preserving the behaviour of an open lab manager.
+func (m *Manager) Authenticate(r *http.Request) (*Identity, error) {
+	if !m.Enabled() {
+		identity := anonymousAdmin
+		return &identity, nil
+	}
+
+	token := TokenFromRequest(r)
+	if token == "" {
+		return nil, fmt.Errorf("missing API key")
+	}
+	hash := HashKey(token)
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for candidate, key := range m.hashes {
+		if hashesEqual(candidate, hash) {
+			return &Identity{Name: key.Name, Role: key.Role, User: key.User, Team: key.Team}, nil
+		}
+	}
+	if identity, err := m.authenticateMintedLocked(hash); identity != nil || err != nil {
+		return identity, err
+	}
+	return nil, fmt.Errorf("invalid API key")
+}
+
+func hashesEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// TokenFromRequest extracts the API key from Authorization: Bearer or X-API-Key
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return strings.TrimSpace(r.Header.Get(APIKeyHeader))
+}
+
+// HashKey returns the hex SHA-256 of a key, as stored in key_sha256
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// WithIdentity attaches the caller's identity to a request context
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the caller's identity, or nil if the request was not authenticated
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(contextKey{}).(*Identity)
+	return identity
+}
+
+// Describe returns a short "name (role)" label of the caller for logs and timelines
+func Describe(ctx context.Context) string {
+	identity := FromContext(ctx)
+	if identity == nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s)", identity.Name, identity.Role)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ScopeDashboard limits a key to viewing dashboards: metrics, runs and reports.
+// Mutations and endpoints that reach nodes over SSH are refused.
+const ScopeDashboard = "dashboard"
+
+// MintedKeyPrefix starts every minted key so leaked keys are easy to recognise
+const MintedKeyPrefix = "vds_"
+
+// ErrKeyNotFound is returned for an unknown minted key id
+var ErrKeyNotFound = errors.New("API key not found")
+
+// MintedKey is an API key minted through the API. Only the hash of the key is kept.
+type MintedKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	Scope     string     `json:"scope"`
+	KeySHA256 string     `json:"keySha256"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy string     `json:"revokedBy,omitempty"`
+}
+
+// Status is active, expired or revoked
+func (k *MintedKey) Status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return "revoked"
+	case !now.Before(k.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// LoadMintedKeys reads the minted keys from file
+func (m *Manager) LoadMintedKeys(file string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.mintedFile = file
+	m.minted = make(map[string]*MintedKey)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read minted API keys: %v", err)
+	}
+	var keys []*MintedKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("failed to parse minted API keys: %v", err)
+	}
+	for _, key := range keys {
+		m.minted[key.ID] = key
+	}
+	return nil
+}
+
+// saveMintedLocked writes the minted keys; callers must hold the lock
+func (m *Manager) saveMintedLocked() error {
+	if m.mintedFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(m.mintedFile), 0755); err != nil {
+		return fmt.Errorf("failed to create API key directory: %v", err)
+	}
+	data, err := json.MarshalIndent(m.mintedKeysLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal minted API keys: %v", err)
+	}
+	tmp := m.mintedFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write minted API keys: %v", err)
+	}
+	return os.Rename(tmp, m.mintedFile)
+}
+
+// MintKey creates a dashboard key valid for ttl and returns the plain key, which is
+// not stored and cannot be shown again
+func (m *Manager) MintKey(name string, ttl time.Duration, createdBy string) (string, MintedKey, error) {
+	if name == "" {
+		return "", MintedKey{}, fmt.Errorf("name is required")
+	}
+	if ttl <= 0 {
+		return "", MintedKey{}, fmt.Errorf("expiry must be in the future")
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", MintedKey{}, fmt.Errorf("failed to generate key: %v", err)
+	}
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", MintedKey{}, fmt.Errorf("failed to generate key id: %v", err)
+	}
+	plain := MintedKeyPrefix + hex.EncodeToString(raw)
+	now := time.Now().UTC()
+	key := &MintedKey{
+		ID:        "key-" + hex.EncodeToString(id),
+		Name:      name,
+		Role:      RoleViewer,
+		Scope:     ScopeDashboard,
+		KeySHA256: HashKey(plain),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.minted == nil {
+		m.minted = make(map[string]*MintedKey)
+	}
+	m.minted[key.ID] = key
+	if err := m.saveMintedLocked(); err != nil {
+		delete(m.minted, key.ID)
+		return "", MintedKey{}, err
+	}
+	return plain, *key, nil
+}
+
+// MintedKeys returns the minted keys, newest first
+func (m *Manager) MintedKeys() []MintedKey {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.mintedKeysLocked()
+}
+
+func (m *Manager) mintedKeysLocked() []MintedKey {
+	list := make([]MintedKey, 0, len(m.minted))
+	for _, key := range m.minted {
+		list = append(list, *key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// RevokeKey revokes a minted key; requests with it fail from then on
+func (m *Manager) RevokeKey(id, revokedBy string) (MintedKey, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.minted[id]
+	if !ok {
+		return MintedKey{}, fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+	if key.RevokedAt != nil {
+		return *key, fmt.Errorf("API key %s is already revoked", id)
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	key.RevokedBy = revokedBy
+	if err := m.saveMintedLocked(); err != nil {
+		key.RevokedAt, key.RevokedBy = nil, ""
+		return MintedKey{}, err
+	}
+	return *key, nil
+}
+
+// authenticateMintedLocked resolves a minted key by hash; callers must hold the read lock.
+// It returns nil without error if no minted key has the hash.
+func (m *Manager) authenticateMintedLocked(hash string) (*Identity, error) {
+	for _, key := range m.minted {
+		if !hashesEqual(key.KeySHA256, hash) {
+			continue
+		}
+		switch key.Status(time.Now()) {
+		case "revoked":
+			return nil, fmt.Errorf("API key %s was revoked", key.Name)
+		case "expired":
+			return nil, fmt.Errorf("API key %s expired at %s", key.Name, key.ExpiresAt.Format(time.RFC3339))
+		}
+		return &Identity{Name: key.Name, Role: key.Role, Scope: key.Scope}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,317 @@
+package availability
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the availability section of config.yaml
+type Config struct {
+	DataFile      string `yaml:"data_file" json:"dataFile"`
+	RetentionDays int    `yaml:"retention_days" json:"retentionDays"`
+}
+
+// Segment is a period in which a node kept sending heartbeats, each at most the
+// staleness threshold after the previous one
+type Segment struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"` // last heartbeat of the segment
+}
+
+// Incident is a period in which a node sent no heartbeats
+type Incident struct {
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end,omitempty"` // nil while the node is still down
+	DurationSeconds float64    `json:"durationSeconds"`
+	Ongoing         bool       `json:"ongoing"`
+}
+
+// Report is the availability of one node over a window
+type Report struct {
+	Node            string     `json:"node"`
+	Window          string     `json:"window"`
+	From            time.Time  `json:"from"`
+	To              time.Time  `json:"to"`
+	FirstSeen       *time.Time `json:"firstSeen,omitempty"`
+	LastHeartbeat   *time.Time `json:"lastHeartbeat,omitempty"`
+	ObservedSeconds float64    `json:"observedSeconds"` // part of the window after the node was first seen
+	UpSeconds       float64    `json:"upSeconds"`
+	DownSeconds     float64    `json:"downSeconds"`
+	AvailabilityPct *float64   `json:"availabilityPct"` // nil if the node was never seen in the window
+	Incidents       []Incident `json:"incidents"`
+}
+
+// Tracker records node heartbeats as up segments and derives availability from them
+type Tracker struct {
+	mutex    sync.Mutex
+	config   Config
+	segments map[string][]Segment
+	dirty    bool
+}
+
+// NewTracker creates a tracker with default settings
+func NewTracker() *Tracker {
+	return &Tracker{
+		config: Config{
+			DataFile:      "data/availability.json",
+			RetentionDays: 30,
+		},
+		segments: make(map[string][]Segment),
+	}
+}
+
+// LoadConfig reads the availability section from the application config file and
+// loads the recorded heartbeat history
+func (t *Tracker) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		Availability Config `yaml:"availability"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if wrapper.Availability.DataFile != "" {
+		t.config.DataFile = wrapper.Availability.DataFile
+	}
+	if wrapper.Availability.RetentionDays > 0 {
+		t.config.RetentionDays = wrapper.Availability.RetentionDays
+	}
+
+	data, err = os.ReadFile(t.config.DataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read availability history: %v", err)
+	}
+	segments := make(map[string][]Segment)
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return fmt.Errorf("failed to parse availability history: %v", err)
+	}
+	t.segments = segments
+	return nil
+}
+
+// Heartbeat records that a node reported at the given time. A heartbeat more than gap
+// after the previous one starts a new segment; the time in between counts as downtime.
+func (t *Tracker) Heartbeat(node string, at time.Time, gap time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	segments := t.segments[node]
+	if n := len(segments); n > 0 {
+		last := &segments[n-1]
+		if !at.After(last.End) {
+			return
+		}
+		if at.Sub(last.End) <= gap {
+			last.End = at
+			t.dirty = true
+			return
+		}
+	}
+	t.segments[node] = append(segments, Segment{Start: at, End: at})
+	t.dirty = true
+}
+
+// Forget drops the history of a removed node
+func (t *Tracker) Forget(node string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.segments[node]; ok {
+		delete(t.segments, node)
+		t.dirty = true
+	}
+}
+
+// StartFlushLoop persists the history and applies retention every interval
+func (t *Tracker) StartFlushLoop(interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := t.Save(); err != nil {
+				onError(err)
+			}
+		}
+	}()
+}
+
+// Save prunes segments older than the retention and writes the history if it changed
+func (t *Tracker) Save() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -t.config.RetentionDays)
+	for node, segments := range t.segments {
+		keep := 0
+		for keep < len(segments) && segments[keep].End.Before(cutoff) {
+			keep++
+		}
+		if keep > 0 {
+			t.segments[node] = append([]Segment(nil), segments[keep:]...)
+			t.dirty = true
+		}
+	}
+	if !t.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.config.DataFile), 0755); err != nil {
+		return fmt.Errorf("failed to create availability directory: %v", err)
+	}
+	data, err := json.Marshal(t.segments)
+	if err != nil {
+		return fmt.Errorf("failed to marshal availability history: %v", err)
+	}
+	tmp := t.config.DataFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write availability history: %v", err)
+	}
+	if err := os.Rename(tmp, t.config.DataFile); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// ParseWindow accepts windows such as 24h, 7d or 30d
+func (t *Tracker) ParseWindow(window string) (time.Duration, error) {
+	t.mutex.Lock()
+	retention := time.Duration(t.config.RetentionDays) * 24 * time.Hour
+	t.mutex.Unlock()
+
+	if len(window) < 2 {
+		return 0, fmt.Errorf("invalid window %q, use e.g. 24h, 7d or 30d", window)
+	}
+	value, err := strconv.Atoi(window[:len(window)-1])
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid window %q, use e.g. 24h, 7d or 30d", window)
+	}
+	var duration time.Duration
+	switch strings.ToLower(window[len(window)-1:]) {
+	case "h":
+		duration = time.Duration(value) * time.Hour
+	case "d":
+		duration = time.Duration(value) * 24 * time.Hour
+	default:
+		return 0, fmt.Errorf("invalid window %q, use e.g. 24h, 7d or 30d", window)
+	}
+	if duration > retention {
+		return 0, fmt.Errorf("window %s exceeds the %d day retention", window, int(retention.Hours()/24))
+	}
+	return duration, nil
+}
+
+// Report computes the availability of a node over the window ending at now. After its
+// last heartbeat a node counts as up for gap, the staleness threshold, and as down after.
+func (t *Tracker) Report(node, window string, duration time.Duration, now time.Time, gap time.Duration) Report {
+	t.mutex.Lock()
+	segments := append([]Segment(nil), t.segments[node]...)
+	t.mutex.Unlock()
+
+	from := now.Add(-duration)
+	report := Report{
+		Node:      node,
+		Window:    window,
+		From:      from,
+		To:        now,
+		Incidents: []Incident{},
+	}
+	if len(segments) == 0 {
+		return report
+	}
+	first := segments[0].Start
+	last := segments[len(segments)-1].End
+	report.FirstSeen = &first
+	report.LastHeartbeat = &last
+
+	observedFrom := from
+	if first.After(observedFrom) {
+		observedFrom = first
+	}
+	if !observedFrom.Before(now) {
+		return report
+	}
+	report.ObservedSeconds = now.Sub(observedFrom).Seconds()
+
+	for i, segment := range segments {
+		upUntil := segment.End.Add(gap)
+		downUntil := now
+		if i+1 < len(segments) {
+			downUntil = segments[i+1].Start
+		}
+		if upUntil.After(downUntil) {
+			upUntil = downUntil
+		}
+		report.UpSeconds += overlap(segment.Start, upUntil, observedFrom, now).Seconds()
+
+		if !upUntil.Before(downUntil) {
+			continue
+		}
+		down := overlap(upUntil, downUntil, observedFrom, now)
+		if down <= 0 {
+			continue
+		}
+		incident := Incident{
+			Start:           maxTime(upUntil, observedFrom),
+			DurationSeconds: down.Seconds(),
+			Ongoing:         i+1 == len(segments),
+		}
+		if !incident.Ongoing {
+			end := downUntil
+			incident.End = &end
+		}
+		report.Incidents = append(report.Incidents, incident)
+	}
+
+	report.DownSeconds = report.ObservedSeconds - report.UpSeconds
+	if report.DownSeconds < 0 {
+		report.DownSeconds = 0
+	}
+	pct := report.UpSeconds / report.ObservedSeconds * 100
+	if pct > 100 {
+		pct = 100
+	}
+	report.AvailabilityPct = &pct
+	// Newest incidents first
+	sort.Slice(report.Incidents, func(i, j int) bool {
+		return report.Incidents[i].Start.After(report.Incidents[j].Start)
+	})
+	return report
+}
+
+// overlap returns how much of [start, end) falls inside [from, to)
+func overlap(start, end, from, to time.Time) time.Duration {
+	start = maxTime(start, from)
+	if end.After(to) {
+		end = to
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -1,14 +1,22 @@
 package bin_control
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,6 +30,8 @@ type NodeConfig struct {
 	MetricsPort int    `yaml:"metrics_port"`
 	Description string `yaml:"description"`
 	Enabled     bool   `yaml:"enabled"`
+	// Generators lists the load generators from config.yaml besides finalvudatasim
+	Generators []string `yaml:"generators,omitempty"`
 }
 
 type NodesConfig struct {
@@ -35,20 +45,36 @@ type ClusterSettings struct {
 	ConnectionTimeout   int    `yaml:"connection_timeout"`
 	MaxRetries          int    `yaml:"max_retries"`
 	SyncTimeout         int    `yaml:"sync_timeout"`
+	// Global budget for SSH/SCP distribution, shared by all concurrent jobs
+	MaxConcurrentTransfers int `yaml:"max_concurrent_transfers"`
+	TransferBandwidthKbps  int `yaml:"transfer_bandwidth_kbps"` // 0 = unlimited
+	// How StopBinary stops a simulator: "graceful" sends SIGTERM and waits up to
+	// GracefulShutdownTimeout seconds before SIGKILL, "force" sends SIGKILL right away
+	StopMode                string `yaml:"stop_mode,omitempty"`
+	GracefulShutdownTimeout int    `yaml:"graceful_shutdown_timeout,omitempty"`
 }
 
 type BinaryControl struct {
 	nodesConfigPath string
+	nodesMutex      sync.RWMutex // guards nodesConfig, reloaded by concurrent starts and stops
 	nodesConfig     NodesConfig
+	verify          VerifyConfig
+	generators      GeneratorsConfig
+	keepOutput      atomic.Bool // see SetKeepOutput
+	statuses        *statusCache
 }
 
 type BinaryStatus struct {
 	NodeName    string `json:"nodeName"`
-	Status      string `json:"status"` // running, stopped, disabled, error
+	Generator   string `json:"generator,omitempty"` // empty for finalvudatasim
+	Status      string `json:"status"`              // running, stopped, disabled, error
 	PID         int    `json:"pid,omitempty"`
 	StartTime   string `json:"startTime,omitempty"`
 	ProcessInfo string `json:"processInfo,omitempty"`
-	LastChecked string `json:"lastChecked"`
+	// Healthy is the outcome of a generator's health command, nil without one
+	Healthy      *bool  `json:"healthy,omitempty"`
+	HealthDetail string `json:"healthDetail,omitempty"`
+	LastChecked  string `json:"lastChecked"`
 }
 
 type BinaryControlResponse struct {
@@ -61,6 +87,9 @@ func NewBinaryControl() *BinaryControl {
 	return &BinaryControl{
 		nodesConfigPath: "src/configs/nodes.yaml",
 		nodesConfig:     NodesConfig{Nodes: make(map[string]NodeConfig)},
+		verify:          defaultVerifyConfig(),
+		generators:      defaultGeneratorsConfig(),
+		statuses:        newStatusCache(),
 	}
 }
 
@@ -74,16 +103,43 @@ func (bc *BinaryControl) LoadNodesConfig() error {
 		return fmt.Errorf("failed to read nodes config file: %v", err)
 	}
 
-	if err := yaml.Unmarshal(data, &bc.nodesConfig); err != nil {
+	// Decode into a new config, so callers still reading the previous one are unaffected
+	var config NodesConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
 		return fmt.Errorf("failed to parse nodes config file: %v", err)
 	}
 
+	bc.nodesMutex.Lock()
+	bc.nodesConfig = config
+	bc.nodesMutex.Unlock()
 	return nil
 }
 
+// nodeConfig returns the configuration of a node as last loaded
+func (bc *BinaryControl) nodeConfig(nodeName string) (NodeConfig, bool) {
+	bc.nodesMutex.RLock()
+	defer bc.nodesMutex.RUnlock()
+	node, ok := bc.nodesConfig.Nodes[nodeName]
+	return node, ok
+}
+
+// nodes returns all configured nodes as last loaded; the map is never modified
+func (bc *BinaryControl) nodes() map[string]NodeConfig {
+	bc.nodesMutex.RLock()
+	defer bc.nodesMutex.RUnlock()
+	return bc.nodesConfig.Nodes
+}
+
+// clusterSettings returns the cluster settings as last loaded
+func (bc *BinaryControl) clusterSettings() ClusterSettings {
+	bc.nodesMutex.RLock()
+	defer bc.nodesMutex.RUnlock()
+	return bc.nodesConfig.ClusterSettings
+}
+
 func (bc *BinaryControl) GetEnabledNodes() map[string]NodeConfig {
 	enabled := make(map[string]NodeConfig)
-	for name, node := range bc.nodesConfig.Nodes {
+	for name, node := range bc.nodes() {
 		if node.Enabled {
 			enabled[name] = node
 		}
@@ -97,7 +153,7 @@ func (bc *BinaryControl) StartBinary(nodeName string, timeout int) (*BinaryContr
 		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return response(false, fmt.Sprintf("Node %s not found", nodeName)), fmt.Errorf("node %s missing", nodeName)
 	}
@@ -110,45 +166,57 @@ func (bc *BinaryControl) StartBinary(nodeName string, timeout int) (*BinaryContr
 		return response(false, fmt.Sprintf("Binary already running on node %s (PID %d)", nodeName, status.PID)), fmt.Errorf("binary already running")
 	}
 
-	binaryPath := fmt.Sprintf("%s/finalvudatasim", node.BinaryDir)
+	binaryPath := remotecmd.Join(node.BinaryDir, remotecmd.SimulatorBinary)
 	log.Printf("Starting binary on node %s: %s", nodeName, binaryPath)
 
 	// Run binary in background using nohup, redirect output
-	startCmd := fmt.Sprintf("cd %s && nohup ./finalvudatasim > /dev/null 2>&1 &", node.BinaryDir)
+	startCmd := bc.startCommand(node)
 	if err := bc.sshExec(node, startCmd); err != nil {
 		return response(false, fmt.Sprintf("Failed to start binary on node %s: %v", nodeName, err)), err
 	}
 
-	time.Sleep(2 * time.Second)
-
-	newStatus, err := bc.GetBinaryStatus(nodeName)
-	if err != nil {
+	verification := bc.verifyStart(node)
+	if !verification.Passed {
+		log.Printf("Binary start verification failed on node %s: %s", nodeName, verification.Failure)
 		return &BinaryControlResponse{
-			Success: true,
-			Message: fmt.Sprintf("Start command sent to node %s, status check failed: %v", nodeName, err),
-			Data:    map[string]string{"warning": "Binary may be starting, status check failed"},
-		}, nil
+			Success: false,
+			Message: fmt.Sprintf("Binary failed to start on node %s: %s", nodeName, verification.Failure),
+			Data: map[string]interface{}{
+				"nodeName":     nodeName,
+				"action":       "start",
+				"binaryPath":   binaryPath,
+				"verification": verification,
+			},
+		}, fmt.Errorf("binary startup failed: %s", verification.Failure)
 	}
 
-	if newStatus.Status != "running" {
-		return response(false, fmt.Sprintf("Binary failed to start on node %s, status: %s", nodeName, newStatus.Status)), fmt.Errorf("binary startup failed")
+	newStatus, err := bc.GetBinaryStatus(nodeName)
+	if err != nil || newStatus.Status != "running" {
+		newStatus = &BinaryStatus{
+			NodeName:    nodeName,
+			Status:      "running",
+			PID:         verification.PID,
+			LastChecked: time.Now().UTC().Format(time.RFC3339),
+		}
+		bc.statuses.record(*newStatus)
 	}
 
 	// Schedule kill after timeout (in seconds) using the correct PID
 	if timeout > 0 {
-		killCmd := fmt.Sprintf("(sleep %d; kill %d) >/dev/null 2>&1 &", timeout*60, newStatus.PID) // timeout in minutes
+		killCmd := remotecmd.ScheduleTerm(newStatus.PID, timeout*60) // timeout in minutes
 		if err := bc.sshExec(node, killCmd); err != nil {
 			log.Printf("Warning: failed to schedule kill for binary on node %s: %v", nodeName, err)
 		}
 	}
 
 	data := map[string]interface{}{
-		"nodeName":   nodeName,
-		"action":     "start",
-		"timeout":    timeout,
-		"binaryPath": binaryPath,
-		"status":     newStatus,
-		"pid":        newStatus.PID,
+		"nodeName":     nodeName,
+		"action":       "start",
+		"timeout":      timeout,
+		"binaryPath":   binaryPath,
+		"status":       newStatus,
+		"pid":          newStatus.PID,
+		"verification": verification,
 	}
 
 	return &BinaryControlResponse{
@@ -159,12 +227,19 @@ func (bc *BinaryControl) StartBinary(nodeName string, timeout int) (*BinaryContr
 }
 
 func (bc *BinaryControl) StopBinary(nodeName string, timeout int) (*BinaryControlResponse, error) {
+	return bc.StopBinaryWith(nodeName, timeout, StopOptions{})
+}
+
+// StopBinaryWith stops the binary with the given stop semantics, falling back to the
+// stop_mode and graceful_shutdown_timeout cluster settings. The response records the
+// signals sent under "escalation".
+func (bc *BinaryControl) StopBinaryWith(nodeName string, timeout int, options StopOptions) (*BinaryControlResponse, error) {
 	// Reload configuration to ensure we have the latest nodes
 	if err := bc.LoadNodesConfig(); err != nil {
 		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return response(false, fmt.Sprintf("Node %s not found", nodeName)), fmt.Errorf("node %s missing", nodeName)
 	}
@@ -177,26 +252,27 @@ func (bc *BinaryControl) StopBinary(nodeName string, timeout int) (*BinaryContro
 		return response(false, fmt.Sprintf("Binary not running on node %s", nodeName)), fmt.Errorf("binary not running")
 	}
 
-	log.Printf("Stopping binary on node %s (PID: %d)", nodeName, status.PID)
+	options = bc.resolveStopOptions(options)
+	log.Printf("Stopping binary on node %s (PID: %d, mode: %s)", nodeName, status.PID, options.Mode)
 
-	// Attempt graceful kill; if fails, force kill
-	killCmd := fmt.Sprintf("kill %d", status.PID)
-	if err := bc.sshExec(node, killCmd); err != nil {
-		log.Printf("Graceful kill failed, force killing on node %s", nodeName)
-		killCmd = fmt.Sprintf("kill -9 %d", status.PID)
-		if err := bc.sshExec(node, killCmd); err != nil {
-			return response(false, fmt.Sprintf("Failed to stop binary on node %s: %v", nodeName, err)), err
-		}
+	escalation, err := bc.escalateStop(node, status.PID, options)
+	if err != nil {
+		return &BinaryControlResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to stop binary on node %s: %v", nodeName, err),
+			Data:    map[string]interface{}{"nodeName": nodeName, "action": "stop", "escalation": escalation},
+		}, err
 	}
 
-	time.Sleep(2 * time.Second)
-
 	newStatus, err := bc.GetBinaryStatus(nodeName)
 	if err != nil {
 		return &BinaryControlResponse{
 			Success: true,
 			Message: fmt.Sprintf("Stop command sent to node %s, status check failed: %v", nodeName, err),
-			Data:    map[string]string{"warning": "Binary may be stopped, status check failed"},
+			Data: map[string]interface{}{
+				"warning":    "Binary may be stopped, status check failed",
+				"escalation": escalation,
+			},
 		}, nil
 	}
 
@@ -206,22 +282,48 @@ func (bc *BinaryControl) StopBinary(nodeName string, timeout int) (*BinaryContro
 		"timeout":     timeout,
 		"previousPID": status.PID,
 		"status":      newStatus,
+		"escalation":  escalation,
 	}
 
+	message := fmt.Sprintf("Binary stopped successfully on node %s", nodeName)
+	if escalation.Outcome == StopKilled && options.Mode == StopModeGraceful {
+		message = fmt.Sprintf("Binary on node %s ignored SIGTERM for %ds and was killed with SIGKILL", nodeName, options.GracefulTimeoutSeconds)
+	}
 	return &BinaryControlResponse{
 		Success: true,
-		Message: fmt.Sprintf("Binary stopped successfully on node %s", nodeName),
+		Message: message,
 		Data:    data,
 	}, nil
 }
 
+// RestartBinary restarts the binary on a node so it picks up new configuration.
+// Nodes where the binary is not running are left alone.
+func (bc *BinaryControl) RestartBinary(nodeName string, timeout int) (*BinaryControlResponse, error) {
+	status, err := bc.GetBinaryStatus(nodeName)
+	if err != nil {
+		return response(false, fmt.Sprintf("Failed to get binary status on node %s: %v", nodeName, err)), err
+	}
+	if status.Status != "running" {
+		return &BinaryControlResponse{
+			Success: true,
+			Message: fmt.Sprintf("Binary not running on node %s, restart skipped", nodeName),
+			Data:    map[string]interface{}{"nodeName": nodeName, "action": "restart", "skipped": true},
+		}, nil
+	}
+
+	if resp, err := bc.StopBinary(nodeName, timeout); err != nil {
+		return resp, err
+	}
+	return bc.StartBinary(nodeName, timeout)
+}
+
 func (bc *BinaryControl) StartMetricsBinary(nodeName string, timeout int) (*BinaryControlResponse, error) {
 	// Reload configuration to ensure we have the latest nodes
 	if err := bc.LoadNodesConfig(); err != nil {
 		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return response(false, fmt.Sprintf("Node %s not found", nodeName)), fmt.Errorf("node %s missing", nodeName)
 	}
@@ -229,17 +331,17 @@ func (bc *BinaryControl) StartMetricsBinary(nodeName string, timeout int) (*Bina
 		return response(false, fmt.Sprintf("Node %s is disabled", nodeName)), fmt.Errorf("node %s disabled", nodeName)
 	}
 
-	binaryPath := fmt.Sprintf("%s/node_metrics_api", node.BinaryDir)
+	binaryPath := remotecmd.Join(node.BinaryDir, remotecmd.MetricsBinary)
 	log.Printf("Starting node_metrics_api on node %s: %s", nodeName, binaryPath)
 
 	// Check if already running
-	output, err := bc.sshExecWithOutput(node, "pgrep -f node_metrics_api")
+	output, err := bc.sshExecWithOutput(node, remotecmd.FindMetricsAgent())
 	if err == nil && output != "" {
 		return response(false, fmt.Sprintf("node_metrics_api already running on node %s", nodeName)), fmt.Errorf("metrics binary already running")
 	}
 
 	// First ensure binary exists and is executable
-	checkCmd := fmt.Sprintf("test -x %s && echo 'Binary exists and is executable'", binaryPath)
+	checkCmd := remotecmd.TestExecutable(binaryPath, "Binary exists and is executable")
 	if output, err := bc.sshExecWithOutput(node, checkCmd); err != nil {
 		return response(false, fmt.Sprintf("node_metrics_api binary not found or not executable on node %s: %v", nodeName, err)), err
 	} else {
@@ -247,11 +349,16 @@ func (bc *BinaryControl) StartMetricsBinary(nodeName string, timeout int) (*Bina
 	}
 
 	// Start metrics binary with proper logging
-	log.Printf("Starting binary with command: cd %s && ./node_metrics_api --port 8086", node.BinaryDir)
-	startCmd := fmt.Sprintf("cd %s && ./node_metrics_api --port 8086 > metrics_api.log 2>&1", node.BinaryDir)
+	// The agent only probes the addresses it was started with, so hand it the manager's ClickHouse
+	clickhouseAddr := ""
+	if cfg := clickhouse.GetClickHouseConfig(); cfg.Host != "" {
+		clickhouseAddr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	}
+	startCmd := remotecmd.StartMetricsAgent(node.BinaryDir, node.ConfDir, 8086, clickhouseAddr)
+	log.Printf("Starting binary with command: %s", startCmd)
 	if err := bc.sshExec(node, startCmd); err != nil {
 		// Get error logs if startup failed
-		logOutput, _ := bc.sshExecWithOutput(node, fmt.Sprintf("cd %s && cat metrics_api.log 2>/dev/null || echo 'No log file found'", node.BinaryDir))
+		logOutput, _ := bc.sshExecWithOutput(node, remotecmd.ReadMetricsLog(node.BinaryDir, "No log file found"))
 		return response(false, fmt.Sprintf("Failed to start node_metrics_api on node %s: %v. Startup log: %s", nodeName, err, logOutput)), err
 	}
 
@@ -259,10 +366,10 @@ func (bc *BinaryControl) StartMetricsBinary(nodeName string, timeout int) (*Bina
 	time.Sleep(3 * time.Second)
 
 	// Check if binary is actually running
-	output, err = bc.sshExecWithOutput(node, "pgrep -f node_metrics_api")
+	output, err = bc.sshExecWithOutput(node, remotecmd.FindMetricsAgent())
 	if err != nil || output == "" {
 		// Get startup error logs
-		logOutput, _ := bc.sshExecWithOutput(node, fmt.Sprintf("cd %s && cat metrics_api.log 2>/dev/null || echo 'No error log available'", node.BinaryDir))
+		logOutput, _ := bc.sshExecWithOutput(node, remotecmd.ReadMetricsLog(node.BinaryDir, "No error log available"))
 		return response(false, fmt.Sprintf("node_metrics_api failed to start on node %s. Process check failed: %v, Startup log: %s", nodeName, err, logOutput)), fmt.Errorf("binary startup failed")
 	}
 
@@ -274,13 +381,13 @@ func (bc *BinaryControl) StartMetricsBinary(nodeName string, timeout int) (*Bina
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Get(healthURL)
 	if err != nil {
-		logOutput, _ := bc.sshExecWithOutput(node, fmt.Sprintf("cd %s && cat metrics_api.log", node.BinaryDir))
+		logOutput, _ := bc.sshExecWithOutput(node, remotecmd.ReadMetricsLog(node.BinaryDir, ""))
 		return response(false, fmt.Sprintf("node_metrics_api not responding on node %s. Health check failed: %v, Log: %s", nodeName, err, logOutput)), err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		logOutput, _ := bc.sshExecWithOutput(node, fmt.Sprintf("cd %s && cat metrics_api.log", node.BinaryDir))
+		logOutput, _ := bc.sshExecWithOutput(node, remotecmd.ReadMetricsLog(node.BinaryDir, ""))
 		return response(false, fmt.Sprintf("node_metrics_api health check failed on node %s. Status: %d, Log: %s", nodeName, resp.StatusCode, logOutput)), fmt.Errorf("health check failed")
 	}
 
@@ -310,7 +417,7 @@ func (bc *BinaryControl) StopMetricsBinary(nodeName string, timeout int) (*Binar
 		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return response(false, fmt.Sprintf("Node %s not found", nodeName)), fmt.Errorf("node %s missing", nodeName)
 	}
@@ -321,7 +428,7 @@ func (bc *BinaryControl) StopMetricsBinary(nodeName string, timeout int) (*Binar
 	log.Printf("Stopping node_metrics_api on node %s", nodeName)
 
 	// Check if binary is actually running
-	output, err := bc.sshExecWithOutput(node, "pgrep -f node_metrics_api")
+	output, err := bc.sshExecWithOutput(node, remotecmd.FindMetricsAgent())
 	if err != nil || output == "" {
 		return response(false, fmt.Sprintf("node_metrics_api not running on node %s", nodeName)), fmt.Errorf("metrics binary not running")
 	}
@@ -344,11 +451,11 @@ func (bc *BinaryControl) StopMetricsBinary(nodeName string, timeout int) (*Binar
 		}
 
 		// Try graceful kill first
-		killCmd := fmt.Sprintf("kill %d", pid)
+		killCmd := remotecmd.Signal("TERM", pid)
 		if err := bc.sshExec(node, killCmd); err != nil {
 			log.Printf("Graceful kill failed for PID %d, trying force kill", pid)
 			// Force kill if graceful fails
-			killCmd = fmt.Sprintf("kill -9 %d", pid)
+			killCmd = remotecmd.Signal("KILL", pid)
 			if err := bc.sshExec(node, killCmd); err != nil {
 				log.Printf("Warning: Failed to kill process %d: %v", pid, err)
 			}
@@ -362,7 +469,7 @@ func (bc *BinaryControl) StopMetricsBinary(nodeName string, timeout int) (*Binar
 	time.Sleep(3 * time.Second)
 
 	// Verify all processes are stopped
-	output, err = bc.sshExecWithOutput(node, "pgrep -f node_metrics_api")
+	output, err = bc.sshExecWithOutput(node, remotecmd.FindMetricsAgent())
 	status := "running"
 	if err != nil || output == "" {
 		status = "stopped"
@@ -394,19 +501,19 @@ func (bc *BinaryControl) DebugMetricsBinary(nodeName string) (*BinaryControlResp
 		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return response(false, fmt.Sprintf("Node %s not found", nodeName)), fmt.Errorf("node %s missing", nodeName)
 	}
 
-	binaryPath := fmt.Sprintf("%s/node_metrics_api", node.BinaryDir)
+	binaryPath := remotecmd.Join(node.BinaryDir, remotecmd.MetricsBinary)
 	debugInfo := make(map[string]interface{})
 
 	// 1. Check if binary file exists and is executable
-	log.Printf("=== DEBUG INFO FOR NODE %s ===", nodeName)
+	logger.Debugf(logger.ModuleBinControl, "Collecting debug info for node %s", nodeName)
 
 	// Check binary file
-	fileCheck, err := bc.sshExecWithOutput(node, fmt.Sprintf("ls -la %s", binaryPath))
+	fileCheck, err := bc.sshExecWithOutput(node, remotecmd.ListFile(binaryPath))
 	debugInfo["binary_file_info"] = fileCheck
 	if err != nil {
 		debugInfo["binary_exists"] = false
@@ -416,11 +523,11 @@ func (bc *BinaryControl) DebugMetricsBinary(nodeName string) (*BinaryControlResp
 	}
 
 	// Check if executable
-	execCheck, err := bc.sshExecWithOutput(node, fmt.Sprintf("test -x %s && echo 'executable' || echo 'not executable'", binaryPath))
+	execCheck, err := bc.sshExecWithOutput(node, remotecmd.CheckExecutable(binaryPath))
 	debugInfo["is_executable"] = strings.TrimSpace(execCheck) == "executable"
 
 	// 2. Check running processes
-	processes, err := bc.sshExecWithOutput(node, "pgrep -f node_metrics_api")
+	processes, err := bc.sshExecWithOutput(node, remotecmd.FindMetricsAgent())
 	if err != nil {
 		debugInfo["processes_running"] = false
 		debugInfo["process_error"] = err.Error()
@@ -437,15 +544,15 @@ func (bc *BinaryControl) DebugMetricsBinary(nodeName string) (*BinaryControlResp
 	}
 
 	// 4. Check for error logs
-	logContent, err := bc.sshExecWithOutput(node, fmt.Sprintf("cd %s && cat metrics_api.log 2>/dev/null || echo 'No log file found'", node.BinaryDir))
+	logContent, err := bc.sshExecWithOutput(node, remotecmd.ReadMetricsLog(node.BinaryDir, "No log file found"))
 	debugInfo["startup_log"] = logContent
 	if err != nil {
 		debugInfo["log_read_error"] = err.Error()
 	}
 
 	// 5. Try to start binary manually and capture immediate output
-	log.Printf("Attempting manual start for debugging...")
-	manualStartCmd := fmt.Sprintf("cd %s && timeout 10s ./node_metrics_api --port 8086 2>&1 || echo 'Manual start failed or timed out'", node.BinaryDir)
+	logger.Debugf(logger.ModuleBinControl, "Attempting manual start of node_metrics_api on %s for debugging", nodeName)
+	manualStartCmd := remotecmd.TryMetricsAgent(node.BinaryDir, 8086)
 	manualOutput, err := bc.sshExecWithOutput(node, manualStartCmd)
 	debugInfo["manual_start_output"] = manualOutput
 	if err != nil {
@@ -458,7 +565,7 @@ func (bc *BinaryControl) DebugMetricsBinary(nodeName string) (*BinaryControlResp
 	debugInfo["disk_space"] = diskSpace
 	debugInfo["memory_info"] = memory
 
-	log.Printf("=== DEBUG INFO COLLECTION COMPLETE ===")
+	logger.Debugf(logger.ModuleBinControl, "Debug info collection for node %s complete", nodeName)
 
 	return &BinaryControlResponse{
 		Success: true,
@@ -473,7 +580,7 @@ func (bc *BinaryControl) GetBinaryStatus(nodeName string) (*BinaryStatus, error)
 		return nil, fmt.Errorf("failed to reload config: %v", err)
 	}
 
-	node, ok := bc.nodesConfig.Nodes[nodeName]
+	node, ok := bc.nodeConfig(nodeName)
 	if !ok {
 		return nil, fmt.Errorf("node %s not found", nodeName)
 	}
@@ -481,16 +588,35 @@ func (bc *BinaryControl) GetBinaryStatus(nodeName string) (*BinaryStatus, error)
 		return &BinaryStatus{
 			NodeName:    nodeName,
 			Status:      "disabled",
-			LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+			LastChecked: time.Now().UTC().Format(time.RFC3339),
 		}, nil
 	}
 
-	output, err := bc.sshExecWithOutput(node, "pgrep -f './finalvudatasim'")
+	status, err := bc.nodeBinaryStatus(nodeName, node)
+	if status != nil {
+		bc.statuses.record(*status)
+	}
+	return status, err
+}
+
+// nodeBinaryStatus checks the simulator on an enabled node. A node that cannot be
+// reached is in error rather than stopped.
+func (bc *BinaryControl) nodeBinaryStatus(nodeName string, node NodeConfig) (*BinaryStatus, error) {
+	output, err := bc.sshExecWithOutput(node, remotecmd.FindSimulator())
+	var sshErr *node_control.SSHError
+	if err != nil && (!errors.As(err, &sshErr) || sshErr.ExitStatus < 0) {
+		return &BinaryStatus{
+			NodeName:    nodeName,
+			Status:      "error",
+			ProcessInfo: fmt.Sprintf("Status check failed: %v", err),
+			LastChecked: time.Now().UTC().Format(time.RFC3339),
+		}, nil
+	}
 	if err != nil || output == "" {
 		return &BinaryStatus{
 			NodeName:    nodeName,
 			Status:      "stopped",
-			LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+			LastChecked: time.Now().UTC().Format(time.RFC3339),
 		}, nil
 	}
 
@@ -501,7 +627,7 @@ func (bc *BinaryControl) GetBinaryStatus(nodeName string) (*BinaryStatus, error)
 			NodeName:    nodeName,
 			Status:      "error",
 			ProcessInfo: fmt.Sprintf("Failed to parse PID: %v", err),
-			LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+			LastChecked: time.Now().UTC().Format(time.RFC3339),
 		}, err
 	}
 
@@ -521,7 +647,7 @@ func (bc *BinaryControl) GetBinaryStatus(nodeName string) (*BinaryStatus, error)
 		PID:         pid,
 		StartTime:   strings.TrimSpace(startTime),
 		ProcessInfo: strings.TrimSpace(processInfo),
-		LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+		LastChecked: time.Now().UTC().Format(time.RFC3339),
 	}, nil
 }
 
@@ -536,6 +662,7 @@ func (bc *BinaryControl) GetAllBinaryStatuses() (*BinaryControlResponse, error)
 
 	enabledNodes := bc.GetEnabledNodes()
 	if len(enabledNodes) == 0 {
+		bc.statuses.replace(nil)
 		return &BinaryControlResponse{
 			Success: true,
 			Message: "No enabled nodes found",
@@ -543,21 +670,30 @@ func (bc *BinaryControl) GetAllBinaryStatuses() (*BinaryControlResponse, error)
 		}, nil
 	}
 
-	var statuses []BinaryStatus
+	// Query the nodes in parallel over the SSH connection pool
+	nodeNames := make([]string, 0, len(enabledNodes))
 	for nodeName := range enabledNodes {
-		status, err := bc.GetBinaryStatus(nodeName)
+		nodeNames = append(nodeNames, nodeName)
+	}
+	var mutex sync.Mutex
+	statuses := make([]BinaryStatus, 0, len(nodeNames))
+	node_control.FanOut(nodeNames, func(nodeName string) {
+		status, err := bc.nodeBinaryStatus(nodeName, enabledNodes[nodeName])
 		if err != nil {
 			log.Printf("Failed to get status for node %s: %v", nodeName, err)
-			statuses = append(statuses, BinaryStatus{
+			status = &BinaryStatus{
 				NodeName:    nodeName,
 				Status:      "error",
 				ProcessInfo: fmt.Sprintf("Status check failed: %v", err),
-				LastChecked: time.Now().Format("2006-01-02 15:04:05"),
-			})
-		} else {
-			statuses = append(statuses, *status)
+				LastChecked: time.Now().UTC().Format(time.RFC3339),
+			}
 		}
-	}
+		mutex.Lock()
+		statuses = append(statuses, *status)
+		mutex.Unlock()
+	})
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].NodeName < statuses[j].NodeName })
+	bc.statuses.replace(statuses)
 
 	return &BinaryControlResponse{
 		Success: true,
@@ -566,35 +702,30 @@ func (bc *BinaryControl) GetAllBinaryStatuses() (*BinaryControlResponse, error)
 	}, nil
 }
 
+// RunCommand runs a shell command on an enabled node and returns its trimmed output
+func (bc *BinaryControl) RunCommand(nodeName, command string) (string, error) {
+	node, ok := bc.nodeConfig(nodeName)
+	if !ok {
+		return "", fmt.Errorf("node %s not found", nodeName)
+	}
+	if !node.Enabled {
+		return "", fmt.Errorf("node %s is disabled", nodeName)
+	}
+	return bc.sshExecWithOutput(node, command)
+}
+
+// sshTarget is where SSH operations on the node connect to
+func (node NodeConfig) sshTarget() node_control.SSHTarget {
+	return node_control.SSHTarget{Host: node.Host, User: node.User, KeyPath: node.KeyPath}
+}
+
 func (bc *BinaryControl) sshExec(node NodeConfig, command string) error {
-	args := []string{
-		"-i", node.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		"-o", "LogLevel=ERROR",
-		fmt.Sprintf("%s@%s", node.User, node.Host),
-		command,
-	}
-	cmd := exec.Command("ssh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return node_control.SSH.Run(node.sshTarget(), command)
 }
 
 func (bc *BinaryControl) sshExecWithOutput(node NodeConfig, command string) (string, error) {
-	args := []string{
-		"-i", node.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		"-o", "LogLevel=ERROR",
-		fmt.Sprintf("%s@%s", node.User, node.Host),
-		command,
-	}
-	cmd := exec.Command("ssh", args...)
-	output, err := cmd.Output()
-	return strings.TrimSpace(string(output)), err
+	output, err := node_control.SSH.Output(node.sshTarget(), command)
+	return strings.TrimSpace(output), err
 }
 
 func response(success bool, message string) *BinaryControlResponse {
@@ -0,0 +1,436 @@
+package bin_control
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/remotecmd"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratorConfig describes a load generator other than finalvudatasim, e.g. a log replay
+// tool or a custom producer. Its commands run on the node over SSH; the placeholders
+// {node}, {host}, {binary_dir} and {conf_dir} expand to the node's single-quoted values.
+type GeneratorConfig struct {
+	Description string `yaml:"description" json:"description,omitempty"`
+	Start       string `yaml:"start" json:"start,omitempty"`   // launches the generator in the background
+	Stop        string `yaml:"stop" json:"stop,omitempty"`     // asks every instance to exit
+	Status      string `yaml:"status" json:"status,omitempty"` // prints one PID per running instance
+	// HealthCommand exits 0 while the generator works, e.g. a curl of its health endpoint
+	HealthCommand       string `yaml:"health_command" json:"healthCommand,omitempty"`
+	StartTimeoutSeconds int    `yaml:"start_timeout_seconds" json:"startTimeoutSeconds,omitempty"`
+	StopTimeoutSeconds  int    `yaml:"stop_timeout_seconds" json:"stopTimeoutSeconds,omitempty"`
+	// EPSURL is polled by the manager for the events per second the generator produces,
+	// which then count towards the fleet EPS. {host} expands unquoted here.
+	EPSURL string `yaml:"eps_url" json:"epsUrl,omitempty"`
+}
+
+// GeneratorsConfig holds the generators section of config.yaml
+type GeneratorsConfig struct {
+	EPSPollSeconds int                        `yaml:"eps_poll_seconds" json:"epsPollSeconds"`
+	Definitions    map[string]GeneratorConfig `yaml:"definitions" json:"definitions"`
+}
+
+// GeneratorInfo is a generator with the nodes it is assigned to
+type GeneratorInfo struct {
+	Name    string   `json:"name"`
+	BuiltIn bool     `json:"builtIn"`
+	Nodes   []string `json:"nodes"`
+	GeneratorConfig
+}
+
+// GeneratorEPSTarget is an assigned generator whose EPS the manager polls
+type GeneratorEPSTarget struct {
+	NodeName  string
+	Generator string
+	URL       string
+}
+
+// generatorNamePattern keeps generator names usable in URLs and log messages
+var generatorNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// IsSimulator reports whether a generator name means the built-in finalvudatasim, which
+// an empty name also does
+func IsSimulator(generator string) bool {
+	return generator == "" || generator == remotecmd.SimulatorBinary
+}
+
+func defaultGeneratorsConfig() GeneratorsConfig {
+	return GeneratorsConfig{EPSPollSeconds: 15, Definitions: map[string]GeneratorConfig{}}
+}
+
+// LoadGeneratorsConfig reads the generators section from the application config file
+func (bc *BinaryControl) LoadGeneratorsConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultGeneratorsConfig()
+	wrapper := struct {
+		Generators *GeneratorsConfig `yaml:"generators"`
+	}{Generators: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if config.EPSPollSeconds <= 0 {
+		config.EPSPollSeconds = 15
+	}
+	definitions := make(map[string]GeneratorConfig, len(config.Definitions))
+	for name, generator := range config.Definitions {
+		switch {
+		case IsSimulator(name):
+			return fmt.Errorf("generator %s is built in and cannot be redefined", remotecmd.SimulatorBinary)
+		case !generatorNamePattern.MatchString(name):
+			return fmt.Errorf("invalid generator name %q: use lowercase letters, digits, - and _", name)
+		case generator.Start == "" || generator.Stop == "" || generator.Status == "":
+			return fmt.Errorf("generator %s needs start, stop and status commands", name)
+		}
+		if generator.StartTimeoutSeconds <= 0 {
+			generator.StartTimeoutSeconds = 15
+		}
+		if generator.StopTimeoutSeconds <= 0 {
+			generator.StopTimeoutSeconds = 15
+		}
+		definitions[name] = generator
+	}
+	config.Definitions = definitions
+	bc.generators = config
+	return nil
+}
+
+// GeneratorsConfig returns the generator settings
+func (bc *BinaryControl) GeneratorsConfig() GeneratorsConfig {
+	return bc.generators
+}
+
+// ListGenerators returns finalvudatasim and the configured generators, each with the
+// nodes it runs on. finalvudatasim runs on every node.
+func (bc *BinaryControl) ListGenerators() ([]GeneratorInfo, error) {
+	if err := bc.LoadNodesConfig(); err != nil {
+		return nil, fmt.Errorf("failed to reload config: %v", err)
+	}
+	simulator := GeneratorInfo{Name: remotecmd.SimulatorBinary, BuiltIn: true, Nodes: []string{}}
+	assigned := make(map[string][]string)
+	for nodeName, node := range bc.nodes() {
+		simulator.Nodes = append(simulator.Nodes, nodeName)
+		for _, generator := range node.Generators {
+			assigned[generator] = append(assigned[generator], nodeName)
+		}
+	}
+	sort.Strings(simulator.Nodes)
+
+	generators := []GeneratorInfo{simulator}
+	for name, config := range bc.generators.Definitions {
+		nodes := append([]string{}, assigned[name]...)
+		sort.Strings(nodes)
+		generators = append(generators, GeneratorInfo{Name: name, Nodes: nodes, GeneratorConfig: config})
+	}
+	sort.SliceStable(generators[1:], func(i, j int) bool { return generators[i+1].Name < generators[j+1].Name })
+	return generators, nil
+}
+
+// GeneratorEPSTargets lists the generators with an eps_url on the enabled nodes they are
+// assigned to, from the last loaded nodes config
+func (bc *BinaryControl) GeneratorEPSTargets() []GeneratorEPSTarget {
+	var targets []GeneratorEPSTarget
+	for nodeName, node := range bc.GetEnabledNodes() {
+		for _, name := range node.Generators {
+			generator, ok := bc.generators.Definitions[name]
+			if !ok || generator.EPSURL == "" {
+				continue
+			}
+			targets = append(targets, GeneratorEPSTarget{
+				NodeName:  nodeName,
+				Generator: name,
+				URL:       expandGenerator(generator.EPSURL, nodeName, node, false),
+			})
+		}
+	}
+	return targets
+}
+
+// nodeGenerator looks up an enabled node and a generator assigned to it
+func (bc *BinaryControl) nodeGenerator(nodeName, name string) (NodeConfig, GeneratorConfig, error) {
+	if err := bc.LoadNodesConfig(); err != nil {
+		return NodeConfig{}, GeneratorConfig{}, fmt.Errorf("failed to reload config: %v", err)
+	}
+	node, ok := bc.nodeConfig(nodeName)
+	if !ok {
+		return node, GeneratorConfig{}, fmt.Errorf("node %s not found", nodeName)
+	}
+	generator, ok := bc.generators.Definitions[name]
+	if !ok {
+		return node, generator, fmt.Errorf("generator %s is not defined", name)
+	}
+	for _, assigned := range node.Generators {
+		if assigned == name {
+			return node, generator, nil
+		}
+	}
+	return node, generator, fmt.Errorf("generator %s is not assigned to node %s", name, nodeName)
+}
+
+// expandGenerator fills in the node placeholders of a command or, unquoted, a URL
+func expandGenerator(template, nodeName string, node NodeConfig, quote bool) string {
+	value := func(s string) string {
+		if quote {
+			return remotecmd.Quote(s)
+		}
+		return s
+	}
+	return strings.NewReplacer(
+		"{node}", value(nodeName),
+		"{host}", value(node.Host),
+		"{binary_dir}", value(node.BinaryDir),
+		"{conf_dir}", value(node.ConfDir),
+	).Replace(template)
+}
+
+// generatorPIDs runs the status command; a command that fails without printing a PID,
+// like pgrep finding nothing, means the generator is stopped
+func (bc *BinaryControl) generatorPIDs(node NodeConfig, nodeName string, generator GeneratorConfig) ([]int, error) {
+	output, err := bc.sshExecWithOutput(node, expandGenerator(generator.Status, nodeName, node, true))
+	var pids []int
+	for _, line := range strings.Split(output, "\n") {
+		if pid, parseErr := strconv.Atoi(strings.TrimSpace(line)); parseErr == nil && pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+	if len(pids) == 0 && err != nil && output != "" {
+		return nil, fmt.Errorf("status command failed: %v: %s", err, output)
+	}
+	return pids, nil
+}
+
+// probeGenerator runs the health command and returns whether it passed with its output
+func (bc *BinaryControl) probeGenerator(node NodeConfig, nodeName string, generator GeneratorConfig) (bool, string) {
+	output, err := bc.sshExecWithOutput(node, expandGenerator(generator.HealthCommand, nodeName, node, true))
+	if len(output) > 200 {
+		output = output[:200] + "..."
+	}
+	if err != nil {
+		if output == "" {
+			return false, err.Error()
+		}
+		return false, fmt.Sprintf("%v: %s", err, output)
+	}
+	return true, output
+}
+
+// GetGeneratorStatus reports whether a generator runs on a node and, if it has a health
+// command, whether it is healthy
+func (bc *BinaryControl) GetGeneratorStatus(nodeName, name string) (*BinaryStatus, error) {
+	node, generator, err := bc.nodeGenerator(nodeName, name)
+	if err != nil {
+		return nil, err
+	}
+	status := &BinaryStatus{
+		NodeName:    nodeName,
+		Generator:   name,
+		Status:      "disabled",
+		LastChecked: time.Now().UTC().Format(time.RFC3339),
+	}
+	if !node.Enabled {
+		return status, nil
+	}
+
+	pids, err := bc.generatorPIDs(node, nodeName, generator)
+	if err != nil {
+		status.Status, status.ProcessInfo = "error", err.Error()
+		return status, err
+	}
+	if len(pids) == 0 {
+		status.Status = "stopped"
+		return status, nil
+	}
+	status.Status, status.PID = "running", pids[0]
+
+	if startTime, err := bc.sshExecWithOutput(node, fmt.Sprintf("ps -p %d -o lstart=", status.PID)); err == nil {
+		status.StartTime = startTime
+	}
+	if processInfo, err := bc.sshExecWithOutput(node, fmt.Sprintf("ps -p %d -o pid,ppid,pcpu,pmem,etime,cmd", status.PID)); err == nil {
+		status.ProcessInfo = processInfo
+	}
+	if generator.HealthCommand != "" {
+		healthy, detail := bc.probeGenerator(node, nodeName, generator)
+		status.Healthy, status.HealthDetail = &healthy, detail
+	}
+	return status, nil
+}
+
+// GetAllGeneratorStatuses returns the status of a generator on every enabled node it is
+// assigned to
+func (bc *BinaryControl) GetAllGeneratorStatuses(name string) (*BinaryControlResponse, error) {
+	if err := bc.LoadNodesConfig(); err != nil {
+		return response(false, fmt.Sprintf("Failed to reload config: %v", err)), err
+	}
+	if _, ok := bc.generators.Definitions[name]; !ok {
+		return response(false, fmt.Sprintf("Generator %s is not defined", name)), fmt.Errorf("generator %s is not defined", name)
+	}
+
+	statuses := []BinaryStatus{}
+	for nodeName, node := range bc.GetEnabledNodes() {
+		assigned := false
+		for _, generator := range node.Generators {
+			assigned = assigned || generator == name
+		}
+		if !assigned {
+			continue
+		}
+		status, err := bc.GetGeneratorStatus(nodeName, name)
+		if err != nil {
+			log.Printf("Failed to get %s status for node %s: %v", name, nodeName, err)
+			statuses = append(statuses, BinaryStatus{
+				NodeName:    nodeName,
+				Generator:   name,
+				Status:      "error",
+				ProcessInfo: fmt.Sprintf("Status check failed: %v", err),
+				LastChecked: time.Now().UTC().Format(time.RFC3339),
+			})
+			continue
+		}
+		statuses = append(statuses, *status)
+	}
+	return &BinaryControlResponse{
+		Success: true,
+		Message: fmt.Sprintf("Retrieved %s status for %d nodes", name, len(statuses)),
+		Data:    statuses,
+	}, nil
+}
+
+// StartGenerator starts a generator on a node and waits up to start_timeout_seconds for
+// it to report a PID and pass its health command. A timeout in minutes runs its stop
+// command again once it expires.
+func (bc *BinaryControl) StartGenerator(nodeName, name string, timeout int) (*BinaryControlResponse, error) {
+	node, generator, err := bc.nodeGenerator(nodeName, name)
+	if err != nil {
+		return response(false, err.Error()), err
+	}
+	if !node.Enabled {
+		return response(false, fmt.Sprintf("Node %s is disabled", nodeName)), fmt.Errorf("node %s disabled", nodeName)
+	}
+
+	status, err := bc.GetGeneratorStatus(nodeName, name)
+	if err == nil && status.Status == "running" {
+		return response(false, fmt.Sprintf("%s already running on node %s (PID %d)", name, nodeName, status.PID)), fmt.Errorf("%s already running", name)
+	}
+
+	log.Printf("Starting generator %s on node %s", name, nodeName)
+	if err := bc.sshExec(node, expandGenerator(generator.Start, nodeName, node, true)); err != nil {
+		return response(false, fmt.Sprintf("Failed to start %s on node %s: %v", name, nodeName, err)), err
+	}
+
+	deadline := time.Now().Add(time.Duration(generator.StartTimeoutSeconds) * time.Second)
+	failure := "no PID reported"
+	for {
+		status, err = bc.GetGeneratorStatus(nodeName, name)
+		switch {
+		case err != nil:
+			failure = err.Error()
+		case status.Status != "running":
+			failure = "no PID reported"
+		case status.Healthy != nil && !*status.Healthy:
+			failure = fmt.Sprintf("health command failed: %s", status.HealthDetail)
+		default:
+			failure = ""
+		}
+		if failure == "" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	data := map[string]interface{}{
+		"nodeName":  nodeName,
+		"generator": name,
+		"action":    "start",
+		"timeout":   timeout,
+		"status":    status,
+	}
+	if failure != "" {
+		log.Printf("Generator %s failed to start on node %s: %s", name, nodeName, failure)
+		return &BinaryControlResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s failed to start on node %s within %ds: %s", name, nodeName, generator.StartTimeoutSeconds, failure),
+			Data:    data,
+		}, fmt.Errorf("%s startup failed: %s", name, failure)
+	}
+
+	if timeout > 0 {
+		stopCmd := remotecmd.ScheduleCommand(expandGenerator(generator.Stop, nodeName, node, true), timeout*60) // timeout in minutes
+		if err := bc.sshExec(node, stopCmd); err != nil {
+			log.Printf("Warning: failed to schedule stop of %s on node %s: %v", name, nodeName, err)
+		}
+	}
+	data["pid"] = status.PID
+	return &BinaryControlResponse{
+		Success: true,
+		Message: fmt.Sprintf("%s started successfully on node %s (PID %d) with timeout %d min", name, nodeName, status.PID, timeout),
+		Data:    data,
+	}, nil
+}
+
+// StopGenerator runs a generator's stop command and waits up to stop_timeout_seconds for
+// its status command to report no PID
+func (bc *BinaryControl) StopGenerator(nodeName, name string) (*BinaryControlResponse, error) {
+	node, generator, err := bc.nodeGenerator(nodeName, name)
+	if err != nil {
+		return response(false, err.Error()), err
+	}
+	if !node.Enabled {
+		return response(false, fmt.Sprintf("Node %s is disabled", nodeName)), fmt.Errorf("node %s disabled", nodeName)
+	}
+
+	status, err := bc.GetGeneratorStatus(nodeName, name)
+	if err != nil || status.Status != "running" {
+		return response(false, fmt.Sprintf("%s not running on node %s", name, nodeName)), fmt.Errorf("%s not running", name)
+	}
+
+	log.Printf("Stopping generator %s on node %s (PID: %d)", name, nodeName, status.PID)
+	if err := bc.sshExec(node, expandGenerator(generator.Stop, nodeName, node, true)); err != nil {
+		return response(false, fmt.Sprintf("Failed to stop %s on node %s: %v", name, nodeName, err)), err
+	}
+
+	deadline := time.Now().Add(time.Duration(generator.StopTimeoutSeconds) * time.Second)
+	var pids []int
+	for {
+		pids, err = bc.generatorPIDs(node, nodeName, generator)
+		if (err == nil && len(pids) == 0) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	data := map[string]interface{}{
+		"nodeName":    nodeName,
+		"generator":   name,
+		"action":      "stop",
+		"previousPID": status.PID,
+	}
+	switch {
+	case err != nil:
+		data["warning"] = fmt.Sprintf("%s may be stopped, status check failed: %v", name, err)
+		return &BinaryControlResponse{
+			Success: true,
+			Message: fmt.Sprintf("Stop command sent to %s on node %s, status check failed: %v", name, nodeName, err),
+			Data:    data,
+		}, nil
+	case len(pids) > 0:
+		data["warning"] = fmt.Sprintf("Still running after %ds: PIDs %v", generator.StopTimeoutSeconds, pids)
+		return &BinaryControlResponse{
+			Success: true,
+			Message: fmt.Sprintf("Stop command sent to %s on node %s, but it is still running", name, nodeName),
+			Data:    data,
+		}, nil
+	}
+	return &BinaryControlResponse{
+		Success: true,
+		Message: fmt.Sprintf("%s stopped successfully on node %s", name, nodeName),
+		Data:    data,
+	}, nil
+}
@@ -0,0 +1,260 @@
+package bin_control
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/remotecmd"
+)
+
+// Orphan kinds
+const (
+	// A kill timer whose target PID is no longer the simulator; when it fires it kills
+	// nothing or, once the PID is reused, an unrelated process
+	OrphanKillTimer = "kill_timer"
+	// A node_metrics_api process running a binary other than the node's current one
+	OrphanMetricsAgent = "stale_metrics_agent"
+	// A conf.d archive or kept-files directory an interrupted distribution left in /tmp
+	OrphanTempFile = "temp_file"
+)
+
+// orphanTempPattern matches what conf.d distribution writes to a node's /tmp
+var orphanTempPattern = regexp.MustCompile(`^/tmp/[^/]+_confd_(backup_[^/]+\.tar\.gz|keep)$`)
+
+// Orphan is a leftover process or file on a node
+type Orphan struct {
+	Kind       string `json:"kind"`
+	PID        int    `json:"pid,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Command    string `json:"command,omitempty"`
+	AgeSeconds int    `json:"ageSeconds"`
+	SizeBytes  int64  `json:"sizeBytes,omitempty"`
+	Reason     string `json:"reason"`
+
+	sleepPID int // the sleeping child of a kill timer
+}
+
+// NodeOrphans is the result of scanning one node
+type NodeOrphans struct {
+	NodeName string   `json:"nodeName"`
+	Orphans  []Orphan `json:"orphans"`
+	// MetricsAgents counts the node_metrics_api processes that are not stale
+	MetricsAgents int       `json:"metricsAgents"`
+	ScannedAt     time.Time `json:"scannedAt"`
+}
+
+// OrphanCleanupItem is the outcome of removing one orphan
+type OrphanCleanupItem struct {
+	Orphan
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// OrphanCleanup is the outcome of cleaning up one node
+type OrphanCleanup struct {
+	NodeName         string              `json:"nodeName"`
+	Items            []OrphanCleanupItem `json:"items"`
+	Removed          int                 `json:"removed"`
+	Failed           int                 `json:"failed"`
+	MetricsRestarted bool                `json:"metricsRestarted,omitempty"`
+	Notes            []string            `json:"notes,omitempty"`
+}
+
+// orphanScanCommand prints the process list, the executable of every node_metrics_api
+// process, the modification time of the node's agent binary, the distribution leftovers
+// in /tmp older than minAge and the node's clock, in sections
+func orphanScanCommand(node NodeConfig, minAge time.Duration) string {
+	return strings.Join([]string{
+		"ps -eo pid=,ppid=,etimes=,args=",
+		"echo @@agents",
+		fmt.Sprintf(`for p in /proc/[0-9]*; do e=$(readlink "$p/exe" 2>/dev/null); case "$e" in */%s*) echo "${p#/proc/} $e";; esac; done`, remotecmd.MetricsBinary),
+		"echo @@binary",
+		fmt.Sprintf("stat -c %%Y %s 2>/dev/null", remotecmd.Quote(remotecmd.Join(node.BinaryDir, remotecmd.MetricsBinary))),
+		"echo @@tmp",
+		fmt.Sprintf(`find /tmp -maxdepth 1 \( -name '*_confd_backup_*.tar.gz' -o -name '*_confd_keep' \) -mmin +%d -printf '%%p\t%%s\t%%T@\n' 2>/dev/null`, int(minAge.Minutes())),
+		"echo @@now",
+		"date +%s",
+	}, "; ")
+}
+
+// ScanOrphans lists the orphaned kill timers, stale node_metrics_api processes and
+// distribution leftovers in /tmp older than tempMinAge on a node, in one SSH call
+func (bc *BinaryControl) ScanOrphans(nodeName string, tempMinAge time.Duration) (*NodeOrphans, error) {
+	if err := bc.LoadNodesConfig(); err != nil {
+		return nil, fmt.Errorf("failed to reload config: %v", err)
+	}
+	node, ok := bc.nodeConfig(nodeName)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", nodeName)
+	}
+	if !node.Enabled {
+		return nil, fmt.Errorf("node %s is disabled", nodeName)
+	}
+	output, err := bc.sshExecWithOutput(node, orphanScanCommand(node, tempMinAge))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan node %s: %v", nodeName, err)
+	}
+	result := parseOrphanScan(output, node.BinaryDir)
+	result.NodeName = nodeName
+	return result, nil
+}
+
+// parseOrphanScan reads the sections printed by orphanScanCommand
+func parseOrphanScan(output, binaryDir string) *NodeOrphans {
+	sections := make(map[string][]string)
+	current := "ps"
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "@@") {
+			current = strings.TrimPrefix(strings.TrimSpace(line), "@@")
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	result := &NodeOrphans{Orphans: []Orphan{}, ScannedAt: time.Now().UTC()}
+	now := time.Now().Unix()
+	if len(sections["now"]) > 0 {
+		if parsed, err := strconv.ParseInt(strings.TrimSpace(sections["now"][0]), 10, 64); err == nil {
+			now = parsed
+		}
+	}
+
+	processes := parseProcessList(strings.Join(sections["ps"], "\n"))
+	byPID := make(map[int]StopProcess, len(processes))
+	children := make(map[int][]StopProcess)
+	for _, process := range processes {
+		byPID[process.PID] = process
+		children[process.PPID] = append(children[process.PPID], process)
+	}
+
+	for _, process := range processes {
+		match := killTimerPattern.FindStringSubmatch(process.Command)
+		if match == nil {
+			continue
+		}
+		sleeping := findSleep(children[process.PID], match[1])
+		if sleeping == nil {
+			continue // the parent shell of a timer, or one that is already firing
+		}
+		target, _ := strconv.Atoi(match[2])
+		targetProcess, alive := byPID[target]
+		if alive && strings.Contains(targetProcess.Command, "./"+remotecmd.SimulatorBinary) {
+			continue
+		}
+		reason := fmt.Sprintf("PID %d is gone", target)
+		if alive {
+			reason = fmt.Sprintf("PID %d is now %q and would be killed", target, targetProcess.Command)
+		}
+		seconds, _ := strconv.Atoi(match[1])
+		result.Orphans = append(result.Orphans, Orphan{
+			Kind:       OrphanKillTimer,
+			PID:        process.PID,
+			Command:    process.Command,
+			AgeSeconds: sleeping.ElapsedSeconds,
+			Reason:     fmt.Sprintf("Kill timer firing in %ds, but %s", max(seconds-sleeping.ElapsedSeconds, 0), reason),
+			sleepPID:   sleeping.PID,
+		})
+	}
+
+	var binaryModified int64
+	if len(sections["binary"]) > 0 {
+		binaryModified, _ = strconv.ParseInt(strings.TrimSpace(sections["binary"][0]), 10, 64)
+	}
+	expectedDir := path.Clean(binaryDir)
+	for _, line := range sections["agents"] {
+		pidText, exe, _ := strings.Cut(line, " ")
+		pid, err := strconv.Atoi(pidText)
+		process, ok := byPID[pid]
+		if err != nil || !ok {
+			continue
+		}
+		orphan := Orphan{Kind: OrphanMetricsAgent, PID: pid, Path: exe, Command: process.Command, AgeSeconds: process.ElapsedSeconds}
+		switch {
+		case strings.HasSuffix(exe, " (deleted)"):
+			orphan.Reason = "Its binary was replaced since it started"
+		case path.Dir(exe) != expectedDir:
+			orphan.Reason = fmt.Sprintf("Runs from %s instead of binary_dir %s", path.Dir(exe), expectedDir)
+		case binaryModified > 0 && now-int64(process.ElapsedSeconds) < binaryModified:
+			orphan.Reason = "Started before the current binary was installed"
+		default:
+			result.MetricsAgents++
+			continue
+		}
+		result.Orphans = append(result.Orphans, orphan)
+	}
+
+	for _, line := range sections["tmp"] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || !orphanTempPattern.MatchString(fields[0]) {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		modified, _ := strconv.ParseFloat(fields[2], 64)
+		result.Orphans = append(result.Orphans, Orphan{
+			Kind:       OrphanTempFile,
+			Path:       fields[0],
+			SizeBytes:  size,
+			AgeSeconds: int(now - int64(modified)),
+			Reason:     "Left behind by an interrupted conf.d distribution",
+		})
+	}
+
+	sort.SliceStable(result.Orphans, func(i, j int) bool { return result.Orphans[i].Kind < result.Orphans[j].Kind })
+	return result
+}
+
+// CleanupOrphans scans a node again and removes every orphan found: kill timers are
+// killed before their sleep ends, stale agents are stopped and leftovers in /tmp are
+// deleted. When that leaves the node without a node_metrics_api, it is started again.
+func (bc *BinaryControl) CleanupOrphans(nodeName string, tempMinAge time.Duration) (*OrphanCleanup, error) {
+	scan, err := bc.ScanOrphans(nodeName, tempMinAge)
+	if err != nil {
+		return nil, err
+	}
+	node, _ := bc.nodeConfig(nodeName)
+	cleanup := &OrphanCleanup{NodeName: nodeName, Items: []OrphanCleanupItem{}}
+
+	stoppedAgents := 0
+	for _, orphan := range scan.Orphans {
+		var command string
+		switch orphan.Kind {
+		case OrphanKillTimer:
+			// The shell goes first: killing its sleep alone would let it run the kill now
+			command = fmt.Sprintf("%s; %s 2>/dev/null; true", remotecmd.Signal("KILL", orphan.PID), remotecmd.Signal("TERM", orphan.sleepPID))
+		case OrphanMetricsAgent:
+			command = remotecmd.Signal("TERM", orphan.PID)
+		case OrphanTempFile:
+			command = remotecmd.RemoveAll(orphan.Path)
+		}
+		item := OrphanCleanupItem{Orphan: orphan}
+		if err := bc.sshExec(node, command); err != nil {
+			item.Error = err.Error()
+			cleanup.Failed++
+		} else {
+			item.Removed = true
+			cleanup.Removed++
+			if orphan.Kind == OrphanMetricsAgent {
+				stoppedAgents++
+			}
+		}
+		cleanup.Items = append(cleanup.Items, item)
+	}
+
+	if stoppedAgents > 0 && scan.MetricsAgents == 0 {
+		log.Printf("Restarting node_metrics_api on node %s after stopping %d stale instances", nodeName, stoppedAgents)
+		// Give the stopped agents time to release the port
+		time.Sleep(2 * time.Second)
+		if resp, err := bc.StartMetricsBinary(nodeName, 0); err != nil {
+			cleanup.Notes = append(cleanup.Notes, fmt.Sprintf("Failed to start node_metrics_api again: %s", resp.Message))
+		} else {
+			cleanup.MetricsRestarted = true
+		}
+	}
+	return cleanup, nil
+}
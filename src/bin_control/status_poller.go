@@ -0,0 +1,221 @@
+package bin_control
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BinaryStatusConfig holds the binary_status section of config.yaml
+type BinaryStatusConfig struct {
+	// PollIntervalSeconds is how often every enabled node is checked in the background;
+	// 0 turns the poller off and every status request checks the nodes live
+	PollIntervalSeconds int `yaml:"poll_interval_seconds" json:"pollIntervalSeconds"`
+	// MaxAgeSeconds is the oldest poll served from the cache, e.g. after the poller
+	// stalled on unreachable nodes; older requests check live
+	MaxAgeSeconds int `yaml:"max_age_seconds" json:"maxAgeSeconds"`
+}
+
+func defaultBinaryStatusConfig() BinaryStatusConfig {
+	return BinaryStatusConfig{
+		PollIntervalSeconds: 15,
+		MaxAgeSeconds:       60,
+	}
+}
+
+// BinaryStatusChange is the simulator on a node going from one of running, stopped and
+// error to another
+type BinaryStatusChange struct {
+	NodeName string    `json:"nodeName"`
+	Previous string    `json:"previous"`
+	Status   string    `json:"status"`
+	PID      int       `json:"pid,omitempty"`
+	Detail   string    `json:"detail,omitempty"` // why the check failed, for error
+	At       time.Time `json:"at"`
+}
+
+// statusCache keeps the last known simulator status of every enabled node, from the
+// poller and from every live check, and reports when one changes
+type statusCache struct {
+	mutex     sync.Mutex
+	config    BinaryStatusConfig
+	statuses  map[string]BinaryStatus
+	polledAt  time.Time // last check of all enabled nodes
+	listeners []func(BinaryStatusChange)
+}
+
+func newStatusCache() *statusCache {
+	return &statusCache{config: defaultBinaryStatusConfig(), statuses: make(map[string]BinaryStatus)}
+}
+
+// updateLocked stores a status and returns the change it makes, if any; callers must
+// hold the lock. The first status of a node is no change.
+func (c *statusCache) updateLocked(status BinaryStatus, now time.Time) *BinaryStatusChange {
+	previous, known := c.statuses[status.NodeName]
+	c.statuses[status.NodeName] = status
+	if !known || previous.Status == status.Status {
+		return nil
+	}
+	change := &BinaryStatusChange{
+		NodeName: status.NodeName,
+		Previous: previous.Status,
+		Status:   status.Status,
+		PID:      status.PID,
+		At:       now.UTC(),
+	}
+	if status.Status == "error" {
+		change.Detail = status.ProcessInfo
+	}
+	return change
+}
+
+// record stores the status of one node
+func (c *statusCache) record(status BinaryStatus) {
+	c.mutex.Lock()
+	change := c.updateLocked(status, time.Now())
+	listeners := c.listeners
+	c.mutex.Unlock()
+	if change != nil {
+		notifyStatusChanges(listeners, []BinaryStatusChange{*change})
+	}
+}
+
+// replace stores the statuses of all enabled nodes, forgetting nodes no longer enabled
+func (c *statusCache) replace(statuses []BinaryStatus) {
+	now := time.Now()
+	c.mutex.Lock()
+	var changes []BinaryStatusChange
+	enabled := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		enabled[status.NodeName] = true
+		if change := c.updateLocked(status, now); change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	for nodeName := range c.statuses {
+		if !enabled[nodeName] {
+			delete(c.statuses, nodeName)
+		}
+	}
+	c.polledAt = now
+	listeners := c.listeners
+	c.mutex.Unlock()
+	notifyStatusChanges(listeners, changes)
+}
+
+// snapshot returns the cached statuses by node name and when all nodes were last checked
+func (c *statusCache) snapshot() ([]BinaryStatus, time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	statuses := make([]BinaryStatus, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].NodeName < statuses[j].NodeName })
+	return statuses, c.polledAt
+}
+
+func notifyStatusChanges(listeners []func(BinaryStatusChange), changes []BinaryStatusChange) {
+	for _, change := range changes {
+		log.Printf("Binary on node %s went from %s to %s", change.NodeName, change.Previous, change.Status)
+		for _, listener := range listeners {
+			listener(change)
+		}
+	}
+}
+
+// LoadStatusConfig reads the binary_status section from the application config file
+func (bc *BinaryControl) LoadStatusConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultBinaryStatusConfig()
+	wrapper := struct {
+		Status *BinaryStatusConfig `yaml:"binary_status"`
+	}{Status: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if config.PollIntervalSeconds < 0 {
+		return fmt.Errorf("binary_status.poll_interval_seconds must not be negative")
+	}
+	if config.MaxAgeSeconds <= 0 {
+		return fmt.Errorf("binary_status.max_age_seconds must be positive")
+	}
+
+	bc.statuses.mutex.Lock()
+	bc.statuses.config = config
+	bc.statuses.mutex.Unlock()
+	return nil
+}
+
+// StatusConfig returns the binary status polling settings
+func (bc *BinaryControl) StatusConfig() BinaryStatusConfig {
+	bc.statuses.mutex.Lock()
+	defer bc.statuses.mutex.Unlock()
+	return bc.statuses.config
+}
+
+// OnStatusChange registers a function called whenever a node's simulator goes between
+// running, stopped and error, as seen by the poller or any live status check
+func (bc *BinaryControl) OnStatusChange(listener func(BinaryStatusChange)) {
+	bc.statuses.mutex.Lock()
+	defer bc.statuses.mutex.Unlock()
+	bc.statuses.listeners = append(bc.statuses.listeners, listener)
+}
+
+// StartStatusPoller checks the simulator on every enabled node in the background, every
+// poll_interval_seconds as currently configured
+func (bc *BinaryControl) StartStatusPoller() {
+	if bc.StatusConfig().PollIntervalSeconds == 0 {
+		log.Println("Binary status polling disabled")
+		return
+	}
+
+	go func() {
+		for {
+			start := time.Now()
+			if _, err := bc.GetAllBinaryStatuses(); err != nil {
+				log.Printf("Binary status poll failed: %v", err)
+			}
+			logger.Debugf(logger.ModuleBinControl, "Polled binary status in %s", time.Since(start).Round(time.Millisecond))
+
+			interval := bc.StatusConfig().PollIntervalSeconds
+			if interval == 0 {
+				log.Println("Binary status polling disabled")
+				return
+			}
+			time.Sleep(time.Duration(interval) * time.Second)
+		}
+	}()
+}
+
+// CachedBinaryStatuses returns the simulator status of every enabled node from the last
+// poll, with any live checks since. Without a poll in the last max_age_seconds it checks
+// the nodes live like GetAllBinaryStatuses.
+func (bc *BinaryControl) CachedBinaryStatuses() (*BinaryControlResponse, error) {
+	config := bc.StatusConfig()
+	statuses, polledAt := bc.statuses.snapshot()
+	age := time.Since(polledAt)
+	if config.PollIntervalSeconds == 0 || polledAt.IsZero() || age > time.Duration(config.MaxAgeSeconds)*time.Second {
+		return bc.GetAllBinaryStatuses()
+	}
+
+	message := fmt.Sprintf("Status of %d nodes, polled %s ago", len(statuses), age.Round(time.Second))
+	if len(statuses) == 0 {
+		message = "No enabled nodes found"
+	}
+	return &BinaryControlResponse{
+		Success: true,
+		Message: message,
+		Data:    statuses,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package bin_control
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+)
+
+// Stop modes of cluster_settings.stop_mode
+const (
+	StopModeGraceful = "graceful" // SIGTERM, then SIGKILL after graceful_shutdown_timeout
+	StopModeForce    = "force"    // SIGKILL right away
+)
+
+// DefaultGracefulShutdownTimeout is used when cluster_settings.graceful_shutdown_timeout is unset
+const DefaultGracefulShutdownTimeout = 10
+
+// Outcomes of a stop escalation
+const (
+	StopExitedOnTerm  = "exited_on_term" // the binary shut down on SIGTERM
+	StopKilled        = "killed"         // SIGKILL was needed
+	StopStillRunning  = "still_running"  // even SIGKILL did not stop it
+	StopAlreadyExited = "already_exited" // the PID was gone before a signal reached it
+)
+
+// Remote exit codes of the graceful stop script
+const (
+	gracefulExitCodeTermFailed = 2
+	gracefulExitCodeTimedOut   = 3
+)
+
+// StopOptions overrides the cluster settings for one stop; zero values use them
+type StopOptions struct {
+	Mode                   string
+	GracefulTimeoutSeconds int
+}
+
+// StopSignal is one signal StopBinary sent
+type StopSignal struct {
+	Signal string    `json:"signal"` // TERM or KILL
+	SentAt time.Time `json:"sentAt"`
+	Reason string    `json:"reason"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// StopEscalation records how StopBinary actually stopped a binary
+type StopEscalation struct {
+	Mode                   string       `json:"mode"`
+	GracefulTimeoutSeconds int          `json:"gracefulTimeoutSeconds,omitempty"`
+	Signals                []StopSignal `json:"signals"`
+	Outcome                string       `json:"outcome"`
+	WaitedMs               int64        `json:"waitedMs"` // from the first signal until the PID was gone
+}
+
+// ValidStopMode reports whether mode is a known stop mode; empty means the default
+func ValidStopMode(mode string) bool {
+	return mode == "" || mode == StopModeGraceful || mode == StopModeForce
+}
+
+// resolveStopOptions fills unset options from the cluster settings
+func (bc *BinaryControl) resolveStopOptions(options StopOptions) StopOptions {
+	settings := bc.clusterSettings()
+	if options.Mode == "" {
+		options.Mode = settings.StopMode
+	}
+	if options.Mode == "" {
+		options.Mode = StopModeGraceful
+	}
+	if options.GracefulTimeoutSeconds <= 0 {
+		options.GracefulTimeoutSeconds = settings.GracefulShutdownTimeout
+	}
+	if options.GracefulTimeoutSeconds <= 0 {
+		options.GracefulTimeoutSeconds = DefaultGracefulShutdownTimeout
+	}
+	return options
+}
+
+// escalateStop stops pid on the node: in graceful mode SIGTERM is sent and the node
+// polls the PID once a second until it is gone or the timeout passes, then SIGKILL
+// follows. The escalation is returned whether or not the binary stopped.
+func (bc *BinaryControl) escalateStop(node NodeConfig, pid int, options StopOptions) (*StopEscalation, error) {
+	escalation := &StopEscalation{Mode: options.Mode, Signals: []StopSignal{}}
+	start := time.Now()
+
+	killReason := "stop_mode is force"
+	if options.Mode == StopModeGraceful {
+		escalation.GracefulTimeoutSeconds = options.GracefulTimeoutSeconds
+		term := StopSignal{Signal: "TERM", SentAt: time.Now().UTC(), Reason: "graceful shutdown, lets the simulator flush its producer buffers"}
+		script := remotecmd.GracefulStop(pid, options.GracefulTimeoutSeconds, gracefulExitCodeTermFailed, gracefulExitCodeTimedOut)
+		err := bc.sshExec(node, script)
+		var exitErr *node_control.SSHError
+		switch {
+		case err == nil:
+			escalation.Signals = append(escalation.Signals, term)
+			escalation.Outcome = StopExitedOnTerm
+			escalation.WaitedMs = time.Since(start).Milliseconds()
+			return escalation, nil
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == gracefulExitCodeTimedOut:
+			killReason = fmt.Sprintf("still running %ds after SIGTERM", options.GracefulTimeoutSeconds)
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == gracefulExitCodeTermFailed:
+			if bc.sshExec(node, remotecmd.Alive(pid)) != nil {
+				// The binary exited between the status check and the signal
+				escalation.Outcome = StopAlreadyExited
+				return escalation, nil
+			}
+			term.Error = "kill -TERM failed"
+			killReason = "SIGTERM could not be delivered"
+		default:
+			term.Error = err.Error()
+			killReason = "SIGTERM could not be delivered"
+		}
+		escalation.Signals = append(escalation.Signals, term)
+		log.Printf("Escalating stop of PID %d on %s to SIGKILL: %s", pid, node.Host, killReason)
+	}
+
+	kill := StopSignal{Signal: "KILL", SentAt: time.Now().UTC(), Reason: killReason}
+	if err := bc.sshExec(node, remotecmd.Signal("KILL", pid)); err != nil {
+		kill.Error = err.Error()
+		escalation.Signals = append(escalation.Signals, kill)
+		escalation.Outcome = StopStillRunning
+		return escalation, fmt.Errorf("kill -KILL %d failed: %v", pid, err)
+	}
+	escalation.Signals = append(escalation.Signals, kill)
+	escalation.Outcome = StopKilled
+
+	// SIGKILL is not handled by the process, so the PID is gone almost at once
+	if err := bc.sshExec(node, remotecmd.WaitExit(pid, 5)); err != nil {
+		escalation.Outcome = StopStillRunning
+		return escalation, fmt.Errorf("PID %d is still running after SIGKILL", pid)
+	}
+	escalation.WaitedMs = time.Since(start).Milliseconds()
+	return escalation, nil
+}
@@ -0,0 +1,195 @@
+package bin_control
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/remotecmd"
+)
+
+// StopProcess is a process on a node as seen by a stop plan
+type StopProcess struct {
+	PID            int    `json:"pid"`
+	PPID           int    `json:"ppid"`
+	ElapsedSeconds int    `json:"elapsedSeconds"`
+	Command        string `json:"command"`
+}
+
+// KillTimer is an auto-stop scheduled by StartBinary: a shell that sleeps for the start
+// timeout and then kills the binary
+type KillTimer struct {
+	StopProcess
+	TargetPID        int        `json:"targetPid"`
+	RemainingSeconds int        `json:"remainingSeconds"`
+	FiresAt          *time.Time `json:"firesAt,omitempty"`
+}
+
+// StopAction is one command a stop would run on a node
+type StopAction struct {
+	Command string `json:"command"`
+	Reason  string `json:"reason"`
+}
+
+// StopPlan is what StopBinary would do on a node, without doing it
+type StopPlan struct {
+	NodeName string        `json:"nodeName"`
+	Status   string        `json:"status"` // running, stopped, disabled
+	PID      int           `json:"pid,omitempty"`
+	Binaries []StopProcess `json:"binaries"` // every finalvudatasim process; only PID is killed
+	Children []StopProcess `json:"children"` // descendants of PID, which lose their parent
+	Timers   []KillTimer   `json:"killTimers"`
+	Actions  []StopAction  `json:"actions"`
+	Notes    []string      `json:"notes,omitempty"`
+}
+
+// killTimerPattern matches the shell StartBinary leaves behind to kill a PID later
+var killTimerPattern = regexp.MustCompile(`\(sleep (\d+); kill (\d+)\)`)
+
+// PlanStop lists the processes and kill timers StopBinary would affect on a node, with
+// the commands it would run under the given stop options, using a single ps call over SSH
+func (bc *BinaryControl) PlanStop(nodeName string, options StopOptions) (*StopPlan, error) {
+	if err := bc.LoadNodesConfig(); err != nil {
+		return nil, fmt.Errorf("failed to reload config: %v", err)
+	}
+	node, ok := bc.nodeConfig(nodeName)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", nodeName)
+	}
+	plan := &StopPlan{
+		NodeName: nodeName,
+		Binaries: []StopProcess{},
+		Children: []StopProcess{},
+		Timers:   []KillTimer{},
+		Actions:  []StopAction{},
+	}
+	if !node.Enabled {
+		plan.Status = "disabled"
+		plan.Notes = append(plan.Notes, "The node is disabled, stop would refuse it")
+		return plan, nil
+	}
+
+	output, err := bc.sshExecWithOutput(node, "ps -eo pid=,ppid=,etimes=,args=")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes on node %s: %v", nodeName, err)
+	}
+	processes := parseProcessList(output)
+	planStop(plan, processes, bc.resolveStopOptions(options), time.Now().UTC())
+	return plan, nil
+}
+
+// parseProcessList reads "pid ppid etimes args" lines
+func parseProcessList(output string) []StopProcess {
+	var processes []StopProcess
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		elapsed, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		processes = append(processes, StopProcess{
+			PID:            pid,
+			PPID:           ppid,
+			ElapsedSeconds: elapsed,
+			Command:        strings.Join(fields[3:], " "),
+		})
+	}
+	return processes
+}
+
+// planStop fills the plan from a process list the way StopBinary picks its target: the
+// first finalvudatasim process by PID, as pgrep reports them
+func planStop(plan *StopPlan, processes []StopProcess, options StopOptions, now time.Time) {
+	children := make(map[int][]StopProcess)
+	for _, process := range processes {
+		children[process.PPID] = append(children[process.PPID], process)
+		if strings.Contains(process.Command, "./finalvudatasim") && !strings.Contains(process.Command, "ps -eo") {
+			plan.Binaries = append(plan.Binaries, process)
+		}
+	}
+	sort.Slice(plan.Binaries, func(i, j int) bool { return plan.Binaries[i].PID < plan.Binaries[j].PID })
+
+	binaryPIDs := make(map[int]bool, len(plan.Binaries))
+	for _, binary := range plan.Binaries {
+		binaryPIDs[binary.PID] = true
+	}
+	for _, process := range processes {
+		match := killTimerPattern.FindStringSubmatch(process.Command)
+		if match == nil {
+			continue
+		}
+		// The subshell's sleep child tells how long it has been waiting
+		if sleeping := findSleep(children[process.PID], match[1]); sleeping != nil {
+			process = *sleeping
+		}
+		seconds, _ := strconv.Atoi(match[1])
+		target, _ := strconv.Atoi(match[2])
+		if !binaryPIDs[target] {
+			continue
+		}
+		timer := KillTimer{StopProcess: process, TargetPID: target, RemainingSeconds: seconds - process.ElapsedSeconds}
+		if timer.RemainingSeconds < 0 {
+			timer.RemainingSeconds = 0
+		}
+		firesAt := now.Add(time.Duration(timer.RemainingSeconds) * time.Second)
+		timer.FiresAt = &firesAt
+		plan.Timers = append(plan.Timers, timer)
+	}
+
+	if len(plan.Binaries) == 0 {
+		plan.Status = "stopped"
+		plan.Notes = append(plan.Notes, "The binary is not running, stop would do nothing")
+		return
+	}
+	plan.Status = "running"
+	plan.PID = plan.Binaries[0].PID
+
+	var walk func(pid int)
+	walk = func(pid int) {
+		for _, child := range children[pid] {
+			plan.Children = append(plan.Children, child)
+			walk(child.PID)
+		}
+	}
+	walk(plan.PID)
+
+	if options.Mode == StopModeGraceful {
+		plan.Actions = append(plan.Actions,
+			StopAction{Command: remotecmd.Signal("TERM", plan.PID), Reason: fmt.Sprintf("graceful stop, waiting up to %ds for the binary to exit", options.GracefulTimeoutSeconds)},
+			StopAction{Command: remotecmd.Signal("KILL", plan.PID), Reason: fmt.Sprintf("only if the binary is still running after %ds", options.GracefulTimeoutSeconds)},
+		)
+	} else {
+		plan.Actions = append(plan.Actions,
+			StopAction{Command: remotecmd.Signal("KILL", plan.PID), Reason: "stop_mode is force"},
+		)
+	}
+	if len(plan.Children) > 0 {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%d child processes are not signalled and are reparented if they outlive the binary", len(plan.Children)))
+	}
+	if len(plan.Binaries) > 1 {
+		plan.Notes = append(plan.Notes, fmt.Sprintf("%d more finalvudatasim processes are running and would be left alone", len(plan.Binaries)-1))
+	}
+	for _, timer := range plan.Timers {
+		if timer.TargetPID == plan.PID {
+			plan.Notes = append(plan.Notes, fmt.Sprintf("Kill timer %d for PID %d is not cancelled; it fires in %ds and finds the PID gone", timer.PID, timer.TargetPID, timer.RemainingSeconds))
+		}
+	}
+}
+
+// findSleep returns the "sleep <seconds>" process among children
+func findSleep(children []StopProcess, seconds string) *StopProcess {
+	for _, child := range children {
+		if child.Command == "sleep "+seconds {
+			child := child
+			return &child
+		}
+	}
+	return nil
+}
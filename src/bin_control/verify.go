@@ -0,0 +1,292 @@
+package bin_control
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/remotecmd"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VerifyConfig holds the binary_verification section of config.yaml. A start only
+// succeeds once every enabled check has passed within timeout_seconds.
+type VerifyConfig struct {
+	TimeoutSeconds int `yaml:"timeout_seconds" json:"timeoutSeconds"`
+	PollIntervalMs int `yaml:"poll_interval_ms" json:"pollIntervalMs"`
+	// StableChecks is the number of consecutive polls that must see the same PID
+	StableChecks          int   `yaml:"stable_checks" json:"stableChecks"`
+	CheckKafkaConnections bool  `yaml:"check_kafka_connections" json:"checkKafkaConnections"`
+	KafkaPorts            []int `yaml:"kafka_ports" json:"kafkaPorts"`
+	// ReadyPattern is an extended regex the binary logs once it is ready; when set the
+	// binary's output goes to ReadyLogFile (relative to binary_dir) instead of /dev/null
+	ReadyPattern string `yaml:"ready_pattern" json:"readyPattern,omitempty"`
+	ReadyLogFile string `yaml:"ready_log_file" json:"readyLogFile,omitempty"`
+}
+
+// VerificationCheck is the outcome of one start check
+type VerificationCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// StartVerification reports how a binary start was verified
+type StartVerification struct {
+	Passed      bool                `json:"passed"`
+	PID         int                 `json:"pid,omitempty"`
+	DurationMs  int64               `json:"durationMs"`
+	Polls       int                 `json:"polls"`
+	Checks      []VerificationCheck `json:"checks"`
+	Failure     string              `json:"failure,omitempty"`
+	Diagnostics map[string]string   `json:"diagnostics,omitempty"` // collected on failure
+}
+
+// Start checks
+const (
+	CheckPIDStable        = "pid_stable"
+	CheckKafkaConnections = "kafka_connections"
+	CheckReadyLog         = "ready_log"
+)
+
+func defaultVerifyConfig() VerifyConfig {
+	return VerifyConfig{
+		TimeoutSeconds:        30,
+		PollIntervalMs:        1000,
+		StableChecks:          3,
+		CheckKafkaConnections: true,
+		KafkaPorts:            []int{9092},
+		ReadyLogFile:          "finalvudatasim.out",
+	}
+}
+
+// LoadVerifyConfig reads the binary_verification section from the application config file
+func (bc *BinaryControl) LoadVerifyConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultVerifyConfig()
+	wrapper := struct {
+		Verification *VerifyConfig `yaml:"binary_verification"`
+	}{Verification: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 30
+	}
+	if config.PollIntervalMs <= 0 {
+		config.PollIntervalMs = 1000
+	}
+	if config.StableChecks <= 0 {
+		config.StableChecks = 1
+	}
+	if config.ReadyLogFile == "" {
+		config.ReadyLogFile = "finalvudatasim.out"
+	}
+	bc.verify = config
+	return nil
+}
+
+// VerifyConfig returns the start verification settings
+func (bc *BinaryControl) VerifyConfig() VerifyConfig {
+	return bc.verify
+}
+
+// SetKeepOutput sends the binary's output to ReadyLogFile even without a ReadyPattern,
+// for readers of the log such as the generation error tracker
+func (bc *BinaryControl) SetKeepOutput(keep bool) {
+	bc.keepOutput.Store(keep)
+}
+
+// keepsOutput reports whether started binaries write their output to ReadyLogFile
+func (bc *BinaryControl) keepsOutput() bool {
+	return bc.verify.ReadyPattern != "" || bc.keepOutput.Load()
+}
+
+// startCommand builds the command that launches the binary in the background
+func (bc *BinaryControl) startCommand(node NodeConfig) string {
+	logFile := ""
+	if bc.keepsOutput() {
+		logFile = bc.verify.ReadyLogFile
+	}
+	return remotecmd.StartSimulator(node.BinaryDir, logFile)
+}
+
+// verifyStart polls the node until the started binary passes every enabled check or the
+// timeout expires. It fails early if the process exits after it was seen running.
+func (bc *BinaryControl) verifyStart(node NodeConfig) *StartVerification {
+	config := bc.verify
+	start := time.Now()
+	deadline := start.Add(time.Duration(config.TimeoutSeconds) * time.Second)
+	interval := time.Duration(config.PollIntervalMs) * time.Millisecond
+
+	result := &StartVerification{}
+	pidCheck := VerificationCheck{Name: CheckPIDStable}
+	kafkaCheck := VerificationCheck{Name: CheckKafkaConnections}
+	readyCheck := VerificationCheck{Name: CheckReadyLog}
+
+	lastPID, stable := 0, 0
+	exited := false
+	for {
+		result.Polls++
+		pid, err := bc.findPID(node)
+		switch {
+		case err != nil:
+			pidCheck.Detail = fmt.Sprintf("status check failed: %v", err)
+		case pid == 0 && lastPID != 0:
+			pidCheck.Passed = false
+			pidCheck.Detail = fmt.Sprintf("process %d exited during startup", lastPID)
+			exited = true
+		case pid == 0:
+			pidCheck.Detail = "process not found"
+		case pid == lastPID:
+			stable++
+		default:
+			if lastPID != 0 {
+				pidCheck.Detail = fmt.Sprintf("PID changed from %d to %d, process may be restarting", lastPID, pid)
+			}
+			lastPID, stable = pid, 1
+		}
+		if exited {
+			break
+		}
+
+		if pid != 0 && stable >= config.StableChecks {
+			pidCheck.Passed = true
+			pidCheck.Detail = fmt.Sprintf("PID %d stable for %d checks", pid, stable)
+			result.PID = pid
+		}
+		if pidCheck.Passed && config.CheckKafkaConnections && !kafkaCheck.Passed {
+			kafkaCheck.Passed, kafkaCheck.Detail = bc.checkKafkaConnections(node, pid, config.KafkaPorts)
+		}
+		if pidCheck.Passed && config.ReadyPattern != "" && !readyCheck.Passed {
+			readyCheck.Passed, readyCheck.Detail = bc.checkReadyLog(node, config)
+		}
+
+		if pidCheck.Passed &&
+			(!config.CheckKafkaConnections || kafkaCheck.Passed) &&
+			(config.ReadyPattern == "" || readyCheck.Passed) {
+			result.Passed = true
+			break
+		}
+		if time.Now().Add(interval).After(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	result.Checks = append(result.Checks, pidCheck)
+	if config.CheckKafkaConnections {
+		result.Checks = append(result.Checks, kafkaCheck)
+	}
+	if config.ReadyPattern != "" {
+		result.Checks = append(result.Checks, readyCheck)
+	}
+	if !result.Passed {
+		result.Failure = fmt.Sprintf("timed out after %ds", config.TimeoutSeconds)
+		if exited {
+			result.Failure = "process exited"
+		}
+		for _, check := range result.Checks {
+			if !check.Passed {
+				result.Failure = fmt.Sprintf("%s, %s check failed", result.Failure, check.Name)
+				if check.Detail != "" {
+					result.Failure += ": " + check.Detail
+				}
+				break
+			}
+		}
+		result.Diagnostics = bc.startDiagnostics(node, lastPID, config)
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result
+}
+
+// findPID returns the PID of the running binary, 0 if none
+func (bc *BinaryControl) findPID(node NodeConfig) (int, error) {
+	output, err := bc.sshExecWithOutput(node, remotecmd.FindSimulator()+" || true")
+	if err != nil {
+		return 0, err
+	}
+	if output == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.Split(output, "\n")[0])
+}
+
+// checkKafkaConnections looks for established connections of the process to a Kafka port
+func (bc *BinaryControl) checkKafkaConnections(node NodeConfig, pid int, ports []int) (bool, string) {
+	// ss is preferred; netstat covers older images
+	command := fmt.Sprintf("if command -v ss >/dev/null 2>&1; then "+
+		"ss -tnpH state established 2>/dev/null | grep 'pid=%d,' | awk '{print $4}'; else "+
+		"netstat -tnp 2>/dev/null | grep ESTABLISHED | grep ' %d/' | awk '{print $5}'; fi", pid, pid)
+	output, err := bc.sshExecWithOutput(node, command)
+	if err != nil && output == "" {
+		return false, fmt.Sprintf("failed to list connections: %v", err)
+	}
+
+	var peers []string
+	for _, line := range strings.Split(output, "\n") {
+		peer := strings.TrimSpace(line)
+		index := strings.LastIndex(peer, ":")
+		if index < 0 {
+			continue
+		}
+		port, err := strconv.Atoi(peer[index+1:])
+		if err != nil {
+			continue
+		}
+		for _, kafkaPort := range ports {
+			if port == kafkaPort {
+				peers = append(peers, peer)
+			}
+		}
+	}
+	if len(peers) == 0 {
+		return false, fmt.Sprintf("no established connection to Kafka ports %v", ports)
+	}
+	return true, fmt.Sprintf("%d connections (%s)", len(peers), strings.Join(peers, ", "))
+}
+
+// checkReadyLog greps the binary's output for the ready pattern
+func (bc *BinaryControl) checkReadyLog(node NodeConfig, config VerifyConfig) (bool, string) {
+	command := remotecmd.CountLogMatches(node.BinaryDir, config.ReadyPattern, config.ReadyLogFile)
+	output, err := bc.sshExecWithOutput(node, command)
+	if err != nil {
+		return false, fmt.Sprintf("failed to read %s: %v", config.ReadyLogFile, err)
+	}
+	if count, _ := strconv.Atoi(output); count > 0 {
+		return true, fmt.Sprintf("%q found in %s", config.ReadyPattern, config.ReadyLogFile)
+	}
+	return false, fmt.Sprintf("%q not yet in %s", config.ReadyPattern, config.ReadyLogFile)
+}
+
+// startDiagnostics collects what an operator needs to see why a start failed
+func (bc *BinaryControl) startDiagnostics(node NodeConfig, pid int, config VerifyConfig) map[string]string {
+	commands := map[string]string{
+		"processes": remotecmd.ListSimulatorProcesses(),
+		"binary":    remotecmd.DescribeFile(remotecmd.Join(node.BinaryDir, remotecmd.SimulatorBinary)),
+	}
+	if pid != 0 {
+		commands["process_info"] = fmt.Sprintf("ps -p %d -o pid,ppid,pcpu,pmem,etime,stat,cmd 2>&1 || echo 'process %d has exited'", pid, pid)
+		commands["connections"] = fmt.Sprintf("ss -tnp 2>/dev/null | grep 'pid=%d,' || echo 'no TCP connections'", pid)
+	}
+	if bc.keepsOutput() {
+		commands["log_tail"] = remotecmd.TailFile(remotecmd.Join(node.BinaryDir, config.ReadyLogFile), 20)
+	}
+
+	diagnostics := make(map[string]string, len(commands))
+	for name, command := range commands {
+		output, err := bc.sshExecWithOutput(node, command)
+		if err != nil && output == "" {
+			output = fmt.Sprintf("failed: %v", err)
+		}
+		diagnostics[name] = output
+	}
+	return diagnostics
+}
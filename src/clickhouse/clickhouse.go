@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"go.yaml.in/yaml/v3"
@@ -38,6 +40,7 @@ type ClickHouseClient struct {
 // NewClickHouseClient initializes and checks the ClickHouse connection
 func NewClickHouseClient(config ClickHouseConfig) (*ClickHouseClient, error) {
 	logger.LogWithNode("System", "ClickHouse", "Initializing ClickHouse client connection", "info")
+	logger.Debugf(logger.ModuleClickHouse, "Connecting to ClickHouse at %s:%d, database %s, user %s", config.Host, config.Port, config.Database, config.Username)
 
 	conn, err := clickhouse.Open(&clickhouse.Options{
 		Addr: []string{fmt.Sprintf("%s:%d", config.Host, config.Port)},
@@ -150,6 +153,7 @@ func GetClickHouseHealth() (map[string]interface{}, error) {
 		}, fmt.Errorf("ClickHouse client not initialized")
 	}
 	err := clickHouseClient.HealthCheck()
+	selfstats.Record(selfstats.CategoryClickHouse, err)
 	if err != nil {
 		return map[string]interface{}{
 			"status": "error",
@@ -161,10 +165,15 @@ func GetClickHouseHealth() (map[string]interface{}, error) {
 		"host":         clickHouseConfig.Host,
 		"port":         clickHouseConfig.Port,
 		"database":     clickHouseConfig.Database,
-		"last_checked": time.Now(),
+		"last_checked": time.Now().UTC(),
 	}, nil
 }
 
+// GetClickHouseConfig returns the loaded ClickHouse connection config
+func GetClickHouseConfig() ClickHouseConfig {
+	return clickHouseConfig
+}
+
 // GetMonitoredPods returns the list of monitored pods
 func GetMonitoredPods() []string {
 	return monitoredPods
@@ -174,3 +183,190 @@ func GetMonitoredPods() []string {
 func GetMonitoredNodes() []string {
 	return monitoredNodes
 }
+
+// MissingTables returns the tables that do not exist. Names without a database prefix
+// are looked up in the configured database.
+func MissingTables(ctx context.Context, tables []string) ([]string, error) {
+	if clickHouseClient == nil {
+		return nil, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	var missing []string
+	for _, table := range tables {
+		database, name := clickHouseConfig.Database, table
+		if db, tbl, ok := strings.Cut(table, "."); ok {
+			database, name = db, tbl
+		}
+
+		var count uint64
+		err := clickHouseClient.Client.QueryRow(ctx,
+			"SELECT count() FROM system.tables WHERE database = ? AND name = ?", database, name).Scan(&count)
+		selfstats.Record(selfstats.CategoryClickHouse, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up table %s: %v", table, err)
+		}
+		if count == 0 {
+			missing = append(missing, table)
+		}
+	}
+	return missing, nil
+}
+
+// TableRowCounts returns the number of rows of every table. Names without a database
+// prefix are counted in the configured database.
+func TableRowCounts(ctx context.Context, tables []string) (map[string]uint64, error) {
+	if clickHouseClient == nil {
+		return nil, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	counts := make(map[string]uint64, len(tables))
+	for _, table := range tables {
+		database, name := clickHouseConfig.Database, table
+		if db, tbl, ok := strings.Cut(table, "."); ok {
+			database, name = db, tbl
+		}
+
+		var count uint64
+		query := fmt.Sprintf("SELECT count() FROM %s.%s", quoteIdentifier(database), quoteIdentifier(name))
+		err := clickHouseClient.Client.QueryRow(ctx, query).Scan(&count)
+		selfstats.Record(selfstats.CategoryClickHouse, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %v", table, err)
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// TotalRows sums the row counts ClickHouse keeps for the tables in system.tables, which is
+// cheap enough to poll. Tables that do not exist or report no count add nothing.
+func TotalRows(ctx context.Context, tables []string) (uint64, error) {
+	if clickHouseClient == nil {
+		return 0, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	byDatabase := make(map[string][]string)
+	for _, table := range tables {
+		database, name := clickHouseConfig.Database, table
+		if db, tbl, ok := strings.Cut(table, "."); ok {
+			database, name = db, tbl
+		}
+		byDatabase[database] = append(byDatabase[database], name)
+	}
+
+	var total uint64
+	for database, names := range byDatabase {
+		var rows uint64
+		err := clickHouseClient.Client.QueryRow(ctx,
+			"SELECT toUInt64(sum(ifNull(total_rows, 0))) FROM system.tables WHERE database = ? AND has(?, name)", database, names).Scan(&rows)
+		selfstats.Record(selfstats.CategoryClickHouse, err)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count rows in %s: %v", database, err)
+		}
+		total += rows
+	}
+	return total, nil
+}
+
+// IngestLatency returns how many seconds the newest row of the tables lags behind now,
+// the largest lag over the tables. column is the event time column of the tables; only
+// rows of the last hour are considered, and tables without such rows are skipped.
+func IngestLatency(ctx context.Context, tables []string, column string) (float64, error) {
+	if clickHouseClient == nil {
+		return 0, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	latency, measured := 0.0, false
+	for _, table := range tables {
+		database, name := clickHouseConfig.Database, table
+		if db, tbl, ok := strings.Cut(table, "."); ok {
+			database, name = db, tbl
+		}
+
+		var rows uint64
+		var seconds float64
+		query := fmt.Sprintf("SELECT count(), toFloat64(dateDiff('millisecond', max(%[1]s), now64(3))) / 1000 FROM %[2]s.%[3]s WHERE %[1]s >= now() - INTERVAL 1 HOUR",
+			quoteIdentifier(column), quoteIdentifier(database), quoteIdentifier(name))
+		err := clickHouseClient.Client.QueryRow(ctx, query).Scan(&rows, &seconds)
+		selfstats.Record(selfstats.CategoryClickHouse, err)
+		if err != nil {
+			return 0, fmt.Errorf("failed to measure ingest latency of %s: %v", table, err)
+		}
+		if rows == 0 {
+			continue
+		}
+		if !measured || seconds > latency {
+			latency, measured = seconds, true
+		}
+	}
+	if !measured {
+		return 0, fmt.Errorf("no rows ingested in the last hour")
+	}
+	return latency, nil
+}
+
+// LatestTimestamps returns the newest value of column in every table, looking at the
+// last hour only. Tables without rows in that hour are left out of the map.
+func LatestTimestamps(ctx context.Context, tables []string, column string) (map[string]time.Time, error) {
+	if clickHouseClient == nil {
+		return nil, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	latest := make(map[string]time.Time, len(tables))
+	for _, table := range tables {
+		database, name := clickHouseConfig.Database, table
+		if db, tbl, ok := strings.Cut(table, "."); ok {
+			database, name = db, tbl
+		}
+
+		var rows uint64
+		var millis int64
+		query := fmt.Sprintf("SELECT count(), toUnixTimestamp64Milli(toDateTime64(max(%[1]s), 3)) FROM %[2]s.%[3]s WHERE %[1]s >= now() - INTERVAL 1 HOUR",
+			quoteIdentifier(column), quoteIdentifier(database), quoteIdentifier(name))
+		err := clickHouseClient.Client.QueryRow(ctx, query).Scan(&rows, &millis)
+		selfstats.Record(selfstats.CategoryClickHouse, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the latest %s of %s: %v", column, table, err)
+		}
+		if rows > 0 {
+			latest[table] = time.UnixMilli(millis).UTC()
+		}
+	}
+	return latest, nil
+}
+
+// DiskSpace is the capacity of one ClickHouse disk as reported by system.disks
+type DiskSpace struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"freeBytes"`
+	TotalBytes uint64 `json:"totalBytes"`
+}
+
+// DiskSpaces returns the free and total space of every disk of the ClickHouse server
+func DiskSpaces(ctx context.Context) ([]DiskSpace, error) {
+	if clickHouseClient == nil {
+		return nil, fmt.Errorf("ClickHouse client not initialized")
+	}
+
+	rows, err := clickHouseClient.Client.Query(ctx, "SELECT name, path, free_space, total_space FROM system.disks ORDER BY name")
+	selfstats.Record(selfstats.CategoryClickHouse, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system.disks: %v", err)
+	}
+	defer rows.Close()
+
+	var disks []DiskSpace
+	for rows.Next() {
+		var disk DiskSpace
+		if err := rows.Scan(&disk.Name, &disk.Path, &disk.FreeBytes, &disk.TotalBytes); err != nil {
+			return nil, fmt.Errorf("failed to read system.disks: %v", err)
+		}
+		disks = append(disks, disk)
+	}
+	return disks, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
 )
 
 // ClusterNodeMetrics represents metrics for a single cluster node
@@ -15,6 +16,10 @@ type ClusterNodeMetrics struct {
 	TotalMemoryGB float64 `json:"total_memory_gb"`
 	UsedMemoryGB  float64 `json:"used_memory_gb"`
 	Target        string  `json:"target"` // Add this field
+	// LastSampleAt is the newest kubelet sample; the age fields are filled in per response
+	LastSampleAt time.Time `json:"last_sample_at"`
+	AgeSeconds   *float64  `json:"age_seconds,omitempty"`
+	Stale        bool      `json:"stale"`
 }
 
 // ClusterMetricsCache handles caching of cluster metrics
@@ -71,7 +76,8 @@ func GetClusterNodeMetrics() (map[string]ClusterNodeMetrics, error) {
 			COALESCE(
 				avg(kubernetes_node_memory_workingset_bytes), 
 				0
-			) / (1024 * 1024 * 1024) AS avg_used_memory_gb
+			) / (1024 * 1024 * 1024) AS avg_used_memory_gb,
+			max(timestamp) AS last_sample_at
 		FROM vusmart.vmetrics_kubernetes_kubelet_metrics_view
 		WHERE timestamp >= now() - INTERVAL 5 MINUTE
 			AND type = 'node'
@@ -83,6 +89,7 @@ func GetClusterNodeMetrics() (map[string]ClusterNodeMetrics, error) {
 	`
 
 	rows, err := clickHouseClient.Client.Query(ctx, query)
+	selfstats.Record(selfstats.CategoryClickHouse, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query ClickHouse: %v", err)
 	}
@@ -93,8 +100,9 @@ func GetClusterNodeMetrics() (map[string]ClusterNodeMetrics, error) {
 	for rows.Next() {
 		var nodeName, target string
 		var avgCpuCores, totalMemoryGB, avgUsedMemoryGB float64
+		var lastSampleAt time.Time
 
-		err := rows.Scan(&nodeName, &target, &avgCpuCores, &totalMemoryGB, &avgUsedMemoryGB)
+		err := rows.Scan(&nodeName, &target, &avgCpuCores, &totalMemoryGB, &avgUsedMemoryGB, &lastSampleAt)
 		if err != nil {
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan cluster metrics row: %v", err))
 			continue
@@ -130,6 +138,7 @@ func GetClusterNodeMetrics() (map[string]ClusterNodeMetrics, error) {
 			TotalMemoryGB: totalMemoryGB,
 			UsedMemoryGB:  avgUsedMemoryGB,
 			Target:        target,
+			LastSampleAt:  lastSampleAt.UTC(),
 		}
 	}
 
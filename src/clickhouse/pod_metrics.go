@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
 )
 
 // TimeRange represents a time window for metrics queries
@@ -79,6 +80,8 @@ type PodResourceMetric struct {
 	CPUPercentage    float64   `json:"cpuPercentage"`
 	MemoryPercentage float64   `json:"memoryPercentage"`
 	LastTimestamp    time.Time `json:"lastTimestamp"`
+	AgeSeconds       *float64  `json:"ageSeconds,omitempty"` // relative to the end of the queried range
+	Stale            bool      `json:"stale"`
 }
 
 // PodStatusMetric represents pod status metrics
@@ -107,6 +110,8 @@ type KafkaTopicMetric struct {
 	Timestamp     time.Time `json:"timestamp"`
 	Topic         string    `json:"topic"`
 	OneMinuteRate float64   `json:"oneMinuteRate"`
+	AgeSeconds    *float64  `json:"ageSeconds,omitempty"`
+	Stale         bool      `json:"stale"`
 }
 
 // getKafkaProducerMetrics retrieves latest Kafka producer metrics
@@ -154,6 +159,7 @@ func (ch *ClickHouseClient) getKafkaProducerMetrics(ctx context.Context, limit i
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan Kafka metric row: %v", err))
 			continue
 		}
+		metric.Timestamp = metric.Timestamp.UTC()
 		metrics = append(metrics, metric)
 	}
 
@@ -199,6 +205,7 @@ func (ch *ClickHouseClient) getSystemMetrics(ctx context.Context, limit int) ([]
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan system metric row: %v", err))
 			continue
 		}
+		metric.Timestamp = metric.Timestamp.UTC()
 		metrics = append(metrics, metric)
 	}
 
@@ -243,6 +250,7 @@ func (ch *ClickHouseClient) getDatabaseMetrics(ctx context.Context, limit int) (
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan database metric row: %v", err))
 			continue
 		}
+		metric.Timestamp = metric.Timestamp.UTC()
 		metrics = append(metrics, metric)
 	}
 
@@ -288,6 +296,7 @@ func (ch *ClickHouseClient) getContainerMetrics(ctx context.Context, limit int)
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan container metric row: %v", err))
 			continue
 		}
+		metric.Timestamp = metric.Timestamp.UTC()
 		metrics = append(metrics, metric)
 	}
 
@@ -336,6 +345,7 @@ func GetKafkaTopicMetrics(ctx context.Context, topics []string) ([]KafkaTopicMet
 	`
 
 	rows, err := monitoringDBClient.Client.Query(ctx, query, brokers, brokers, topics)
+	selfstats.Record(selfstats.CategoryClickHouse, err)
 	if err != nil {
 		return nil, fmt.Errorf("error querying Kafka topic metrics: %v", err)
 	}
@@ -348,6 +358,7 @@ func GetKafkaTopicMetrics(ctx context.Context, topics []string) ([]KafkaTopicMet
 			logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Failed to scan Kafka topic metric row: %v", err))
 			continue
 		}
+		m.Timestamp = m.Timestamp.UTC()
 		metrics = append(metrics, m)
 	}
 
@@ -360,7 +371,7 @@ func GetKafkaTopicMetrics(ctx context.Context, topics []string) ([]KafkaTopicMet
 func (c *ClickHouseClient) CollectMetrics(timeRange TimeRange) (*ClickHouseMetrics, error) {
 	ctx := context.Background()
 	metrics := &ClickHouseMetrics{
-		LastUpdated: time.Now(),
+		LastUpdated: time.Now().UTC(),
 	}
 
 	// List of pods to monitor (loaded from config)
@@ -494,6 +505,7 @@ func (c *ClickHouseClient) GetPodResourceMetrics(ctx context.Context, pods []str
 		if err := rows.Scan(&m.ClusterID, &m.PodName, &m.CPUPercentage, &m.MemoryPercentage, &m.LastTimestamp); err != nil {
 			return nil, fmt.Errorf("error scanning pod resource metrics: %v", err)
 		}
+		m.LastTimestamp = m.LastTimestamp.UTC()
 		metrics = append(metrics, m)
 	}
 
@@ -672,6 +684,7 @@ func (c *ClickHouseClient) GetPodStatusMetrics(ctx context.Context, pods []strin
 			return nil, fmt.Errorf("error scanning top pod memory metrics: %v", err)
 		}
 		m.MemoryPct = float64(memoryPct32)
+		m.Timestamp = m.Timestamp.UTC()
 		metrics = append(metrics, m)
 	}
 
@@ -744,6 +757,7 @@ func (c *ClickHouseClient) GetTopPodsByMemoryUtilization(ctx context.Context, no
 			return nil, fmt.Errorf("error scanning top pod memory metrics: %v", err)
 		}
 		m.MemoryPct = float64(memoryPct)
+		m.Timestamp = m.Timestamp.UTC()
 		metrics = append(metrics, m)
 	}
 
@@ -757,6 +771,7 @@ func CollectClickHouseMetrics(timeRange TimeRange) (*ClickHouseMetrics, error) {
 	}
 
 	metrics, err := clickHouseClient.CollectMetrics(timeRange)
+	selfstats.Record(selfstats.CategoryClickHouse, err)
 	if err != nil {
 		logger.LogError("System", "ClickHouse", fmt.Sprintf("Error collecting metrics: %v", err))
 		return nil, err
@@ -0,0 +1,493 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Saved query parameter types
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamFloat    = "float"
+	ParamDateTime = "datetime"
+)
+
+// Saved query targets
+const (
+	TargetMain       = "main"
+	TargetMonitoring = "monitoring"
+)
+
+// SavedQueriesConfig holds the saved_queries section of config.yaml
+type SavedQueriesConfig struct {
+	File           string `yaml:"file"`
+	MaxRows        int    `yaml:"max_rows"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+}
+
+// QueryParam is a named parameter referenced as @name in the SQL
+type QueryParam struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SavedQuery is a named, parameterized read-only SQL snippet
+type SavedQuery struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	SQL         string       `json:"sql"`
+	Target      string       `json:"target"`
+	Params      []QueryParam `json:"params,omitempty"`
+	CreatedBy   string       `json:"createdBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedBy   string       `json:"updatedBy,omitempty"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// QueryColumn describes one column of a query result
+type QueryColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// QueryResult is the outcome of running a saved query
+type QueryResult struct {
+	Query     string          `json:"query"`
+	Columns   []QueryColumn   `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	RowCount  int             `json:"rowCount"`
+	Truncated bool            `json:"truncated"`
+	ElapsedMs int64           `json:"elapsedMs"`
+}
+
+// SavedQueryStore keeps the saved query library on disk
+type SavedQueryStore struct {
+	mutex   sync.RWMutex
+	config  SavedQueriesConfig
+	queries map[string]*SavedQuery
+}
+
+var (
+	savedQueryNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	paramNamePattern      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// Same pattern the driver uses to bind named parameters
+	placeholderPattern = regexp.MustCompile(`@[a-zA-Z0-9_]+`)
+	wordPattern        = regexp.MustCompile(`[A-Za-z_]+`)
+	stringLiteral      = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	lineComment        = regexp.MustCompile(`--[^\n]*`)
+	blockComment       = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	functionCall       = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+)
+
+// forbiddenKeywords may not appear anywhere in a saved query outside string literals.
+// SYSTEM is allowed since it is also the name of the system database.
+var forbiddenKeywords = map[string]bool{
+	"INSERT": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "CREATE": true,
+	"DELETE": true, "UPDATE": true, "RENAME": true, "ATTACH": true, "DETACH": true,
+	"OPTIMIZE": true, "GRANT": true, "REVOKE": true, "KILL": true,
+	"SET": true, "EXCHANGE": true, "UNDROP": true, "OUTFILE": true,
+}
+
+// forbiddenTableFunctions read from or write to places outside the database: files,
+// URLs, object storage, other servers and external databases or programs
+var forbiddenTableFunctions = map[string]bool{
+	"FILE": true, "URL": true, "URLCLUSTER": true, "REMOTE": true, "REMOTESECURE": true,
+	"CLUSTER": true, "CLUSTERALLREPLICAS": true, "S3": true, "S3CLUSTER": true, "GCS": true,
+	"HDFS": true, "HDFSCLUSTER": true, "AZUREBLOBSTORAGE": true, "AZUREBLOBSTORAGECLUSTER": true,
+	"DELTALAKE": true, "HUDI": true, "ICEBERG": true, "MYSQL": true, "POSTGRESQL": true,
+	"MONGODB": true, "REDIS": true, "SQLITE": true, "ODBC": true, "JDBC": true,
+	"EXECUTABLE": true, "INPUT": true,
+}
+
+// SavedQueries is the process-wide saved query library
+var SavedQueries = &SavedQueryStore{
+	config: SavedQueriesConfig{
+		File:           "data/saved_queries.json",
+		MaxRows:        10000,
+		TimeoutSeconds: 30,
+	},
+	queries: make(map[string]*SavedQuery),
+}
+
+// LoadConfig reads the saved_queries section and the persisted library
+func (s *SavedQueryStore) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		SavedQueries SavedQueriesConfig `yaml:"saved_queries"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if wrapper.SavedQueries.File != "" {
+		s.config.File = wrapper.SavedQueries.File
+	}
+	if wrapper.SavedQueries.MaxRows > 0 {
+		s.config.MaxRows = wrapper.SavedQueries.MaxRows
+	}
+	if wrapper.SavedQueries.TimeoutSeconds > 0 {
+		s.config.TimeoutSeconds = wrapper.SavedQueries.TimeoutSeconds
+	}
+
+	data, err = os.ReadFile(s.config.File)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved queries file: %v", err)
+	}
+	var list []*SavedQuery
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse saved queries file: %v", err)
+	}
+	s.queries = make(map[string]*SavedQuery, len(list))
+	for _, query := range list {
+		s.queries[query.Name] = query
+	}
+	return nil
+}
+
+// save writes the library; callers must hold the lock
+func (s *SavedQueryStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.config.File), 0755); err != nil {
+		return fmt.Errorf("failed to create saved queries directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s.sortedQueries(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal saved queries: %v", err)
+	}
+
+	tmp := s.config.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write saved queries file: %v", err)
+	}
+	return os.Rename(tmp, s.config.File)
+}
+
+// sortedQueries returns the library ordered by name; callers must hold the lock
+func (s *SavedQueryStore) sortedQueries() []*SavedQuery {
+	list := make([]*SavedQuery, 0, len(s.queries))
+	for _, query := range s.queries {
+		list = append(list, query)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// List returns all saved queries ordered by name
+func (s *SavedQueryStore) List() []SavedQuery {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	list := make([]SavedQuery, 0, len(s.queries))
+	for _, query := range s.sortedQueries() {
+		list = append(list, *query)
+	}
+	return list
+}
+
+// Get returns a saved query by name
+func (s *SavedQueryStore) Get(name string) (SavedQuery, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	query, ok := s.queries[name]
+	if !ok {
+		return SavedQuery{}, false
+	}
+	return *query, true
+}
+
+// Put validates and stores a query, replacing any query with the same name. It
+// returns true when the query was newly created.
+func (s *SavedQueryStore) Put(query SavedQuery, user string) (bool, error) {
+	query.SQL = strings.TrimSpace(query.SQL)
+	if query.Target == "" {
+		query.Target = TargetMain
+	}
+	params := make([]QueryParam, len(query.Params))
+	for i, param := range query.Params {
+		if param.Type == "" {
+			param.Type = ParamString
+		}
+		params[i] = param
+	}
+	query.Params = params
+	if err := ValidateSavedQuery(query); err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	existing, exists := s.queries[query.Name]
+	if exists {
+		query.CreatedBy = existing.CreatedBy
+		query.CreatedAt = existing.CreatedAt
+	} else {
+		query.CreatedBy = user
+		query.CreatedAt = now
+	}
+	query.UpdatedBy = user
+	query.UpdatedAt = now
+
+	s.queries[query.Name] = &query
+	if err := s.save(); err != nil {
+		if exists {
+			s.queries[query.Name] = existing
+		} else {
+			delete(s.queries, query.Name)
+		}
+		return false, err
+	}
+	logger.LogWithNode("System", "ClickHouse", fmt.Sprintf("Saved query %s stored by %s", query.Name, user), "info")
+	return !exists, nil
+}
+
+// Delete removes a saved query
+func (s *SavedQueryStore) Delete(name, user string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	query, ok := s.queries[name]
+	if !ok {
+		return fmt.Errorf("saved query %s not found", name)
+	}
+	delete(s.queries, name)
+	if err := s.save(); err != nil {
+		s.queries[name] = query
+		return err
+	}
+	logger.LogWithNode("System", "ClickHouse", fmt.Sprintf("Saved query %s deleted by %s", name, user), "info")
+	return nil
+}
+
+// ValidateSavedQuery checks the name, target, parameters and that the SQL is a single
+// SELECT statement
+func ValidateSavedQuery(query SavedQuery) error {
+	if !savedQueryNamePattern.MatchString(query.Name) {
+		return fmt.Errorf("name must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if query.Target != TargetMain && query.Target != TargetMonitoring {
+		return fmt.Errorf("target must be %s or %s", TargetMain, TargetMonitoring)
+	}
+	if err := ValidateReadOnlySQL(query.SQL); err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool, len(query.Params))
+	for _, param := range query.Params {
+		if !paramNamePattern.MatchString(param.Name) {
+			return fmt.Errorf("invalid parameter name %q", param.Name)
+		}
+		if declared[param.Name] {
+			return fmt.Errorf("parameter %s is declared more than once", param.Name)
+		}
+		declared[param.Name] = true
+		if param.Default != "" {
+			if _, err := convertParam(param, param.Default); err != nil {
+				return fmt.Errorf("invalid default for parameter %s: %v", param.Name, err)
+			}
+		}
+		switch param.Type {
+		case ParamString, ParamInt, ParamFloat, ParamDateTime:
+		default:
+			return fmt.Errorf("parameter %s has unknown type %q (expected string, int, float or datetime)", param.Name, param.Type)
+		}
+	}
+
+	for _, placeholder := range placeholderPattern.FindAllString(stripLiterals(query.SQL), -1) {
+		if !declared[placeholder[1:]] {
+			return fmt.Errorf("SQL references undeclared parameter %s", placeholder)
+		}
+	}
+	return nil
+}
+
+// ValidateReadOnlySQL accepts a single SELECT (or WITH ... SELECT) statement only, without
+// table functions that reach outside the database. Run also executes it with readonly=1.
+func ValidateReadOnlySQL(sql string) error {
+	stripped := strings.TrimSpace(stripLiterals(sql))
+	stripped = strings.TrimSpace(strings.TrimSuffix(stripped, ";"))
+	if stripped == "" {
+		return fmt.Errorf("sql is required")
+	}
+	if strings.Contains(stripped, ";") {
+		return fmt.Errorf("only a single statement is allowed")
+	}
+
+	words := wordPattern.FindAllString(stripped, -1)
+	if len(words) == 0 {
+		return fmt.Errorf("only SELECT queries are allowed")
+	}
+	if first := strings.ToUpper(words[0]); first != "SELECT" && first != "WITH" {
+		return fmt.Errorf("only SELECT queries are allowed, got %s", first)
+	}
+	for _, word := range words {
+		if forbiddenKeywords[strings.ToUpper(word)] {
+			return fmt.Errorf("keyword %s is not allowed in a saved query", strings.ToUpper(word))
+		}
+	}
+	for _, call := range functionCall.FindAllStringSubmatch(stripped, -1) {
+		if forbiddenTableFunctions[strings.ToUpper(call[1])] {
+			return fmt.Errorf("table function %s is not allowed in a saved query", call[1])
+		}
+	}
+	return nil
+}
+
+// stripLiterals removes comments and string literals so keyword checks only see SQL
+func stripLiterals(sql string) string {
+	sql = blockComment.ReplaceAllString(sql, " ")
+	sql = stringLiteral.ReplaceAllString(sql, "''")
+	return lineComment.ReplaceAllString(sql, " ")
+}
+
+// convertParam converts a raw request value to the parameter's type
+func convertParam(param QueryParam, raw string) (interface{}, error) {
+	switch param.Type {
+	case ParamString:
+		return raw, nil
+	case ParamInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case ParamFloat:
+		return strconv.ParseFloat(raw, 64)
+	case ParamDateTime:
+		return time.Parse(time.RFC3339, raw)
+	default:
+		return nil, fmt.Errorf("unknown parameter type %q", param.Type)
+	}
+}
+
+// Run executes a saved query with the given parameter values. At most max_rows rows
+// are returned; Truncated reports whether more were available.
+func (s *SavedQueryStore) Run(ctx context.Context, name string, values map[string]string) (*QueryResult, error) {
+	query, ok := s.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("saved query %s not found", name)
+	}
+
+	var args []interface{}
+	for _, param := range query.Params {
+		raw, provided := values[param.Name]
+		if !provided || raw == "" {
+			if param.Required {
+				return nil, fmt.Errorf("parameter %s is required", param.Name)
+			}
+			raw = param.Default
+		}
+		if raw == "" && param.Type != ParamString {
+			return nil, fmt.Errorf("parameter %s is required", param.Name)
+		}
+		value, err := convertParam(param, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for parameter %s: %v", param.Name, err)
+		}
+		args = append(args, clickhouse.Named(param.Name, value))
+	}
+	for key := range values {
+		if !queryDeclares(query, key) {
+			return nil, fmt.Errorf("unknown parameter %s", key)
+		}
+	}
+
+	client := clickHouseClient
+	if query.Target == TargetMonitoring {
+		client = monitoringDBClient
+	}
+	if client == nil {
+		return nil, fmt.Errorf("ClickHouse %s client not initialized", query.Target)
+	}
+
+	s.mutex.RLock()
+	maxRows, timeout := s.config.MaxRows, time.Duration(s.config.TimeoutSeconds)*time.Second
+	s.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// The server enforces what the validation can only approximate
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"readonly": 1}))
+	start := time.Now()
+	rows, err := client.Client.Query(ctx, query.SQL, args...)
+	selfstats.Record(selfstats.CategoryClickHouse, err)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := &QueryResult{Query: query.Name, Rows: [][]interface{}{}}
+	columnTypes := rows.ColumnTypes()
+	for _, columnType := range columnTypes {
+		result.Columns = append(result.Columns, QueryColumn{Name: columnType.Name(), Type: columnType.DatabaseTypeName()})
+	}
+
+	for rows.Next() {
+		if len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+		dest := make([]interface{}, len(columnTypes))
+		for i, columnType := range columnTypes {
+			dest[i] = reflect.New(columnType.ScanType()).Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		row := make([]interface{}, len(dest))
+		for i, value := range dest {
+			row[i] = reflect.ValueOf(value).Elem().Interface()
+			if t, ok := row[i].(time.Time); ok {
+				row[i] = t.UTC()
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+
+	result.RowCount = len(result.Rows)
+	result.ElapsedMs = time.Since(start).Milliseconds()
+	logger.Debugf(logger.ModuleClickHouse, "Saved query %s on %s returned %d rows in %d ms", query.Name, query.Target, result.RowCount, result.ElapsedMs)
+	return result, nil
+}
+
+func queryDeclares(query SavedQuery, name string) bool {
+	for _, param := range query.Params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
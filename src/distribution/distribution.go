@@ -0,0 +1,605 @@
+package distribution
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/selfstats"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JobTypeFileDistribution is the transfer scheduler job type of file distributions
+const JobTypeFileDistribution = "file_distribution"
+
+// Source kinds
+const (
+	KindFile      = "file"
+	KindDirectory = "directory"
+)
+
+// Distribution statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusPartial   = "partial"
+	StatusFailed    = "failed"
+)
+
+// Config holds the distribution section of config.yaml
+type Config struct {
+	SourceDirs  []string `yaml:"source_dirs"`
+	HistoryFile string   `yaml:"history_file"`
+	MaxHistory  int      `yaml:"max_history"`
+}
+
+// Request describes a file or directory to push to nodes
+type Request struct {
+	// Source is a path on the manager inside one of the configured source_dirs
+	Source string `json:"source"`
+	// Destination is the remote path; relative paths are resolved against the node's conf_dir
+	Destination string `json:"destination"`
+	// Nodes limits the distribution to these nodes; empty means all enabled nodes
+	Nodes []string `json:"nodes,omitempty"`
+	// Mode is an optional octal file mode applied to the copied file, e.g. "0755"
+	Mode string `json:"mode,omitempty"`
+	// Replace removes an existing destination directory before extracting a directory source
+	Replace bool `json:"replace,omitempty"`
+}
+
+// NodeResult is the outcome of distributing to a single node
+type NodeResult struct {
+	Node       string `json:"node"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	RemotePath string `json:"remotePath"`
+	Checksum   string `json:"checksum,omitempty"` // sha256 measured on the node
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Distribution is one entry of the distribution history
+type Distribution struct {
+	ID          string                `json:"id"`
+	JobID       string                `json:"jobId"`
+	Status      string                `json:"status"`
+	Source      string                `json:"source"`
+	Destination string                `json:"destination"`
+	Kind        string                `json:"kind"`
+	Checksum    string                `json:"checksum"` // sha256 of the file, or of the archive for directories
+	Bytes       int64                 `json:"bytes"`
+	Nodes       []string              `json:"nodes"`
+	RequestedBy string                `json:"requestedBy,omitempty"`
+	StartedAt   time.Time             `json:"startedAt"`
+	FinishedAt  *time.Time            `json:"finishedAt,omitempty"`
+	Results     map[string]NodeResult `json:"results"`
+}
+
+// Service pushes files and directories to nodes through the shared transfer scheduler
+// and keeps a history of distributions
+type Service struct {
+	mutex         sync.Mutex
+	config        Config
+	transfers     *jobs.Scheduler
+	distributions map[string]*Distribution
+	order         []string
+	done          map[string]chan struct{} // closed when a running distribution finished
+}
+
+var (
+	remotePathPattern = regexp.MustCompile(`^[A-Za-z0-9._/+@=-]+$`)
+	modePattern       = regexp.MustCompile(`^0?[0-7]{3}$`)
+)
+
+// NewService creates a distribution service that submits transfers to the given scheduler
+func NewService(transfers *jobs.Scheduler) *Service {
+	return &Service{
+		config: Config{
+			SourceDirs:  []string{"data/files", "src/migrate", "src/node_metrics_api/build"},
+			HistoryFile: "data/distributions.json",
+			MaxHistory:  100,
+		},
+		transfers:     transfers,
+		distributions: make(map[string]*Distribution),
+		done:          make(map[string]chan struct{}),
+	}
+}
+
+// LoadConfig reads the distribution section and the persisted history
+func (s *Service) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		Distribution Config `yaml:"distribution"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(wrapper.Distribution.SourceDirs) > 0 {
+		s.config.SourceDirs = wrapper.Distribution.SourceDirs
+	}
+	if wrapper.Distribution.HistoryFile != "" {
+		s.config.HistoryFile = wrapper.Distribution.HistoryFile
+	}
+	if wrapper.Distribution.MaxHistory > 0 {
+		s.config.MaxHistory = wrapper.Distribution.MaxHistory
+	}
+
+	data, err = os.ReadFile(s.config.HistoryFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read distribution history: %v", err)
+	}
+	var list []*Distribution
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse distribution history: %v", err)
+	}
+
+	s.distributions = make(map[string]*Distribution, len(list))
+	s.order = nil
+	// The file is newest first; order is kept oldest first
+	for i := len(list) - 1; i >= 0; i-- {
+		dist := list[i]
+		// A distribution still marked running was interrupted by a manager restart
+		if dist.Status == StatusRunning {
+			dist.Status = StatusFailed
+		}
+		s.distributions[dist.ID] = dist
+		s.order = append(s.order, dist.ID)
+	}
+	return nil
+}
+
+// save writes the history newest first; callers must hold the lock
+func (s *Service) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.config.HistoryFile), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal distribution history: %v", err)
+	}
+
+	tmp := s.config.HistoryFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write distribution history: %v", err)
+	}
+	return os.Rename(tmp, s.config.HistoryFile)
+}
+
+// listLocked returns copies of the history newest first; callers must hold the lock
+func (s *Service) listLocked() []Distribution {
+	list := make([]Distribution, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		list = append(list, s.distributions[s.order[i]].copy())
+	}
+	return list
+}
+
+// copy returns a copy that is safe to use without the service lock
+func (d *Distribution) copy() Distribution {
+	copied := *d
+	copied.Nodes = append([]string(nil), d.Nodes...)
+	copied.Results = make(map[string]NodeResult, len(d.Results))
+	for node, result := range d.Results {
+		copied.Results[node] = result
+	}
+	return copied
+}
+
+// List returns the distribution history, newest first
+func (s *Service) List() []Distribution {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.listLocked()
+}
+
+// Get returns a single distribution
+func (s *Service) Get(id string) (Distribution, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dist, ok := s.distributions[id]
+	if !ok {
+		return Distribution{}, false
+	}
+	return dist.copy(), true
+}
+
+// Wait blocks until every node of the distribution reported and returns the final entry
+func (s *Service) Wait(id string) (Distribution, error) {
+	s.mutex.Lock()
+	done := s.done[id]
+	s.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	dist, ok := s.Get(id)
+	if !ok {
+		return Distribution{}, fmt.Errorf("distribution %s not found", id)
+	}
+	return dist, nil
+}
+
+// resolveSource checks that the source lies inside one of the configured source dirs
+func (s *Service) resolveSource(source string) (string, os.FileInfo, error) {
+	if strings.TrimSpace(source) == "" {
+		return "", nil, fmt.Errorf("source is required")
+	}
+	cleaned := filepath.Clean(source)
+
+	s.mutex.Lock()
+	roots := append([]string(nil), s.config.SourceDirs...)
+	s.mutex.Unlock()
+
+	for _, root := range roots {
+		rootAbs, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		candidate := cleaned
+		if !filepath.IsAbs(candidate) {
+			candidate = filepath.Join(rootAbs, cleaned)
+		}
+		// Resolve symlinks on both sides, so a link cannot point outside the root
+		resolvedRoot, err := filepath.EvalSymlinks(rootAbs)
+		if err != nil {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(candidate)
+		if err != nil || !isWithin(resolvedRoot, resolved) {
+			continue
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			continue
+		}
+		return resolved, info, nil
+	}
+	return "", nil, fmt.Errorf("source %s not found in any of the allowed source directories (%s)", source, strings.Join(roots, ", "))
+}
+
+func isWithin(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// remotePath resolves the destination for a node
+func remotePath(destination string, node node_control.NodeConfig) (string, error) {
+	if !remotePathPattern.MatchString(destination) {
+		return "", fmt.Errorf("destination contains unsupported characters")
+	}
+	for _, part := range strings.Split(destination, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("destination must not contain '..'")
+		}
+	}
+	if strings.HasPrefix(destination, "/") {
+		return path.Clean(destination), nil
+	}
+	if node.ConfDir == "" {
+		return "", fmt.Errorf("relative destination needs conf_dir to be set on the node")
+	}
+	return path.Join(node.ConfDir, destination), nil
+}
+
+// Start validates the request, queues one transfer task per node and returns the new
+// history entry. nodes must already be filtered to the requested targets.
+func (s *Service) Start(req Request, nodes map[string]node_control.NodeConfig, requestedBy string) (*Distribution, error) {
+	if strings.TrimSpace(req.Destination) == "" {
+		return nil, fmt.Errorf("destination is required")
+	}
+	if req.Mode != "" && !modePattern.MatchString(req.Mode) {
+		return nil, fmt.Errorf("mode must be an octal file mode such as 0644")
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no target nodes")
+	}
+	for name, node := range nodes {
+		if _, err := remotePath(req.Destination, node); err != nil {
+			return nil, fmt.Errorf("node %s: %v", name, err)
+		}
+	}
+
+	source, info, err := s.resolveSource(req.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, payload := KindFile, source
+	cleanup := func() {}
+	if info.IsDir() {
+		kind = KindDirectory
+		payload, err = packDirectory(source)
+		if err != nil {
+			return nil, err
+		}
+		cleanup = func() { os.Remove(payload) }
+	}
+
+	checksum, size, err := fileSHA256(payload)
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to checksum %s: %v", source, err)
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dist := &Distribution{
+		ID:          newDistributionID(),
+		Status:      StatusRunning,
+		Source:      req.Source,
+		Destination: req.Destination,
+		Kind:        kind,
+		Checksum:    checksum,
+		Bytes:       size,
+		Nodes:       names,
+		RequestedBy: requestedBy,
+		StartedAt:   time.Now().UTC(),
+		Results:     make(map[string]NodeResult),
+	}
+
+	tasks := make([]jobs.Task, 0, len(names))
+	for _, name := range names {
+		name, node := name, nodes[name]
+		tasks = append(tasks, jobs.Task{
+			Name:  name,
+			Bytes: size,
+			Run: func(limitKbps int) error {
+				result := pushToNode(name, node, req, kind, payload, checksum, limitKbps)
+				s.setResult(dist.ID, result)
+				if !result.Success {
+					err := fmt.Errorf("%s: %s", name, result.Message)
+					selfstats.Record(selfstats.CategoryDistribution, err)
+					return err
+				}
+				selfstats.Record(selfstats.CategoryDistribution, nil)
+				return nil
+			},
+		})
+	}
+
+	s.mutex.Lock()
+	s.distributions[dist.ID] = dist
+	s.done[dist.ID] = make(chan struct{})
+	s.order = append(s.order, dist.ID)
+	s.prune()
+	s.mutex.Unlock()
+
+	logger.LogWithNode("System", "Distribution", fmt.Sprintf("Distributing %s %s (%d bytes, sha256 %s) to %s on %d nodes, requested by %s",
+		kind, req.Source, size, checksum[:12], req.Destination, len(names), requestedBy), "info")
+
+	// Submit after the entry is recorded, so task results always find it
+	jobID := s.transfers.Submit(JobTypeFileDistribution, tasks, func(jobs.JobStatus) {
+		cleanup()
+		s.finish(dist.ID)
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dist.JobID = jobID
+	if err := s.save(); err != nil {
+		logger.LogWarning("System", "Distribution", fmt.Sprintf("Failed to save distribution history: %v", err))
+	}
+	copied := dist.copy()
+	return &copied, nil
+}
+
+func (s *Service) setResult(id string, result NodeResult) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if dist, ok := s.distributions[id]; ok {
+		dist.Results[result.Node] = result
+	}
+}
+
+// finish derives the final status once every node reported
+func (s *Service) finish(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dist, ok := s.distributions[id]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	dist.FinishedAt = &now
+
+	succeeded := 0
+	for _, result := range dist.Results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	switch {
+	case succeeded == len(dist.Nodes):
+		dist.Status = StatusCompleted
+	case succeeded == 0:
+		dist.Status = StatusFailed
+	default:
+		dist.Status = StatusPartial
+	}
+
+	message := fmt.Sprintf("Distribution %s of %s finished: %d/%d nodes successful", dist.ID, dist.Source, succeeded, len(dist.Nodes))
+	if dist.Status == StatusCompleted {
+		logger.LogSuccess("System", "Distribution", message)
+	} else {
+		logger.LogWarning("System", "Distribution", message)
+	}
+	if err := s.save(); err != nil {
+		logger.LogWarning("System", "Distribution", fmt.Sprintf("Failed to save distribution history: %v", err))
+	}
+	if done, ok := s.done[id]; ok {
+		close(done)
+		delete(s.done, id)
+	}
+}
+
+// prune drops the oldest finished entries beyond max_history; callers must hold the lock
+func (s *Service) prune() {
+	excess := len(s.order) - s.config.MaxHistory
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if excess > 0 && s.distributions[id].Status != StatusRunning {
+			delete(s.distributions, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+// pushToNode copies the payload, verifies its checksum on the node and installs it
+func pushToNode(name string, node node_control.NodeConfig, req Request, kind, payload, checksum string, limitKbps int) (result NodeResult) {
+	start := time.Now()
+	result.Node = name
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	target, err := remotePath(req.Destination, node)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.RemotePath = target
+
+	// Files are uploaded next to the target and moved into place only after the
+	// checksum matched, so a failed transfer never leaves a truncated file behind
+	upload := target + ".upload-" + checksum[:12]
+	if kind == KindDirectory {
+		upload = "/tmp/" + name + "_" + filepath.Base(payload)
+	}
+
+	if err := sshExec(node, fmt.Sprintf("mkdir -p %s", remotecmd.Quote(path.Dir(upload)))); err != nil {
+		result.Message = fmt.Sprintf("Failed to create remote directory: %v", err)
+		return result
+	}
+	if err := scpCopy(node, payload, upload, limitKbps); err != nil {
+		result.Message = fmt.Sprintf("Failed to copy: %v", err)
+		return result
+	}
+
+	remoteSum, err := sshOutput(node, fmt.Sprintf("sha256sum %s | cut -d' ' -f1", remotecmd.Quote(upload)))
+	if err != nil || remoteSum != checksum {
+		sshExec(node, fmt.Sprintf("rm -f %s", remotecmd.Quote(upload)))
+		if err != nil {
+			result.Message = fmt.Sprintf("Failed to verify checksum: %v", err)
+		} else {
+			result.Message = fmt.Sprintf("Checksum mismatch: expected %s, got %s", checksum, remoteSum)
+		}
+		return result
+	}
+	result.Checksum = remoteSum
+
+	var install string
+	if kind == KindDirectory {
+		// The archive holds the directory contents, so they land directly in target
+		install = fmt.Sprintf("mkdir -p %[1]s && tar -xzf %[2]s -C %[1]s; status=$?; rm -f %[2]s; exit $status", remotecmd.Quote(target), remotecmd.Quote(upload))
+		if req.Replace {
+			install = fmt.Sprintf("rm -rf %s && %s", remotecmd.Quote(target), install)
+		}
+	} else {
+		install = fmt.Sprintf("mv -f %s %s", remotecmd.Quote(upload), remotecmd.Quote(target))
+		if req.Mode != "" {
+			install += fmt.Sprintf(" && chmod %s %s", req.Mode, remotecmd.Quote(target))
+		}
+	}
+	if err := sshExec(node, install); err != nil {
+		result.Message = fmt.Sprintf("Failed to install at %s: %v", target, err)
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf("Distributed %s to %s", kind, target)
+	return result
+}
+
+// packDirectory archives the contents of dir into a temporary tar.gz
+func packDirectory(dir string) (string, error) {
+	tempFile, err := os.CreateTemp("", "distribution_*.tar.gz")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary archive: %v", err)
+	}
+	archive := tempFile.Name()
+	tempFile.Close()
+
+	if output, err := exec.Command("tar", "-czf", archive, "-C", dir, ".").CombinedOutput(); err != nil {
+		os.Remove(archive)
+		return "", fmt.Errorf("failed to archive %s: %v: %s", dir, err, strings.TrimSpace(string(output)))
+	}
+	return archive, nil
+}
+
+func fileSHA256(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// sshExec runs a command on the node, returning its output on failure
+func sshExec(node node_control.NodeConfig, command string) error {
+	output, err := node_control.SSH.CombinedOutput(node.SSHTarget(), command)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// sshOutput runs a command on the node and returns its trimmed stdout
+func sshOutput(node node_control.NodeConfig, command string) (string, error) {
+	output, err := node_control.SSH.Output(node.SSHTarget(), command)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// scpCopy copies a file to the node, limited to limitKbps Kbit/s when non-zero
+func scpCopy(node node_control.NodeConfig, localPath, remotePath string, limitKbps int) error {
+	return node_control.SSH.CopyFile(node.SSHTarget(), localPath, remotePath, limitKbps)
+}
+
+func newDistributionID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return fmt.Sprintf("dist-%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,331 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the node_exporter section of config.yaml
+type Config struct {
+	ScrapeIntervalSeconds int `yaml:"scrape_interval_seconds" json:"scrapeIntervalSeconds"`
+	TimeoutSeconds        int `yaml:"timeout_seconds" json:"timeoutSeconds"`
+}
+
+// HostMetrics are node_exporter series normalized to the manager's host metrics.
+// Fields are nil when the exporter does not expose the series, and rates stay nil
+// until a second scrape is available.
+type HostMetrics struct {
+	CPUUsedPercent   *float64 `json:"cpu_used_percent,omitempty"`
+	CPUCores         *float64 `json:"cpu_cores,omitempty"`
+	MemTotalGB       *float64 `json:"mem_total_gb,omitempty"`
+	MemAvailableGB   *float64 `json:"mem_available_gb,omitempty"`
+	MemUsedPercent   *float64 `json:"mem_used_percent,omitempty"`
+	Load1            *float64 `json:"load_1m,omitempty"`
+	Load5            *float64 `json:"load_5m,omitempty"`
+	Load15           *float64 `json:"load_15m,omitempty"`
+	UptimeSeconds    *float64 `json:"uptime_seconds,omitempty"`
+	NetRxBytesPerSec *float64 `json:"net_rx_bytes_per_sec,omitempty"`
+	NetTxBytesPerSec *float64 `json:"net_tx_bytes_per_sec,omitempty"`
+}
+
+// Result is the outcome of one scrape of a node's exporter
+type Result struct {
+	Node       string      `json:"node"`
+	URL        string      `json:"url"`
+	ScrapedAt  time.Time   `json:"scrapedAt"`
+	DurationMs int64       `json:"durationMs"`
+	Series     int         `json:"series"`
+	Metrics    HostMetrics `json:"metrics"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// counters are the cumulative values rates are derived from
+type counters struct {
+	at       time.Time
+	cpuIdle  float64
+	cpuTotal float64
+	netRx    float64
+	netTx    float64
+	hasCPU   bool
+	hasNet   bool
+}
+
+// Scraper pulls node_exporter endpoints and keeps the latest normalized result per node
+type Scraper struct {
+	mutex    sync.RWMutex
+	config   Config
+	client   Getter
+	previous map[string]counters
+	latest   map[string]*Result
+}
+
+// Getter performs HTTP GET requests, e.g. through a shared connection pool
+type Getter interface {
+	Get(ctx context.Context, url string) (*http.Response, error)
+}
+
+// SetClient makes the scraper send its requests through client
+func (s *Scraper) SetClient(client Getter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.client = client
+}
+
+// NewScraper creates a scraper with default settings
+func NewScraper() *Scraper {
+	return &Scraper{
+		config: Config{
+			ScrapeIntervalSeconds: 15,
+			TimeoutSeconds:        5,
+		},
+		previous: make(map[string]counters),
+		latest:   make(map[string]*Result),
+	}
+}
+
+// LoadConfig reads the node_exporter section from the application config file
+func (s *Scraper) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		NodeExporter Config `yaml:"node_exporter"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if wrapper.NodeExporter.ScrapeIntervalSeconds > 0 {
+		s.config.ScrapeIntervalSeconds = wrapper.NodeExporter.ScrapeIntervalSeconds
+	}
+	if wrapper.NodeExporter.TimeoutSeconds > 0 {
+		s.config.TimeoutSeconds = wrapper.NodeExporter.TimeoutSeconds
+	}
+	return nil
+}
+
+// Config returns the current scrape settings
+func (s *Scraper) Config() Config {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config
+}
+
+// Fetch returns the raw exposition of an exporter endpoint
+func (s *Scraper) Fetch(url string) ([]byte, error) {
+	s.mutex.RLock()
+	client, timeout := s.client, time.Duration(s.config.TimeoutSeconds)*time.Second
+	s.mutex.RUnlock()
+
+	var resp *http.Response
+	var err error
+	if client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		resp, err = client.Get(ctx, url)
+	} else {
+		resp, err = (&http.Client{Timeout: timeout}).Get(url)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exporter %s returned HTTP %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32*1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exporter response: %v", err)
+	}
+	return body, nil
+}
+
+// Scrape pulls the node's exporter once, normalizes its series and stores the result
+func (s *Scraper) Scrape(node, url string) *Result {
+	start := time.Now()
+	result := &Result{Node: node, URL: url, ScrapedAt: start.UTC()}
+
+	body, err := s.Fetch(url)
+	if err == nil {
+		var samples []Sample
+		samples, err = Parse(bytes.NewReader(body))
+		if err == nil {
+			result.Series = len(samples)
+			result.Metrics = s.normalize(node, samples, start)
+		}
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.mutex.Lock()
+	s.latest[node] = result
+	s.mutex.Unlock()
+	return result
+}
+
+// Latest returns the most recent scrape result of a node
+func (s *Scraper) Latest(node string) (*Result, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result, ok := s.latest[node]
+	if !ok {
+		return nil, false
+	}
+	copied := *result
+	return &copied, true
+}
+
+// Forget drops the state kept for a node, e.g. after it was removed
+func (s *Scraper) Forget(node string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.previous, node)
+	delete(s.latest, node)
+}
+
+// Metric names differ between node_exporter releases (the _bytes/_seconds/_total
+// suffixes were added in 0.16), so each normalized value accepts both spellings
+var (
+	cpuSecondsNames   = []string{"node_cpu_seconds_total", "node_cpu"}
+	memTotalNames     = []string{"node_memory_MemTotal_bytes", "node_memory_MemTotal"}
+	memAvailableNames = []string{"node_memory_MemAvailable_bytes", "node_memory_MemAvailable"}
+	memFreeNames      = []string{"node_memory_MemFree_bytes", "node_memory_MemFree"}
+	memBuffersNames   = []string{"node_memory_Buffers_bytes", "node_memory_Buffers"}
+	memCachedNames    = []string{"node_memory_Cached_bytes", "node_memory_Cached"}
+	bootTimeNames     = []string{"node_boot_time_seconds", "node_boot_time"}
+	timeNames         = []string{"node_time_seconds", "node_time"}
+	netRxNames        = []string{"node_network_receive_bytes_total", "node_network_receive_bytes"}
+	netTxNames        = []string{"node_network_transmit_bytes_total", "node_network_transmit_bytes"}
+)
+
+// normalize maps node_exporter series onto HostMetrics; rates use the previous scrape
+func (s *Scraper) normalize(node string, samples []Sample, now time.Time) HostMetrics {
+	byName := make(map[string][]Sample)
+	for _, sample := range samples {
+		byName[sample.Name] = append(byName[sample.Name], sample)
+	}
+	first := func(names []string) []Sample {
+		for _, name := range names {
+			if series, ok := byName[name]; ok {
+				return series
+			}
+		}
+		return nil
+	}
+	single := func(names []string) *float64 {
+		if series := first(names); len(series) > 0 {
+			value := series[0].Value
+			return &value
+		}
+		return nil
+	}
+
+	var metrics HostMetrics
+	current := counters{at: now}
+
+	if series := first(cpuSecondsNames); len(series) > 0 {
+		cpus := make(map[string]bool)
+		for _, sample := range series {
+			cpus[sample.Labels["cpu"]] = true
+			current.cpuTotal += sample.Value
+			if sample.Labels["mode"] == "idle" || sample.Labels["mode"] == "iowait" {
+				current.cpuIdle += sample.Value
+			}
+		}
+		current.hasCPU = true
+		cores := float64(len(cpus))
+		metrics.CPUCores = &cores
+	}
+
+	const gb = 1024 * 1024 * 1024
+	if total := single(memTotalNames); total != nil && *total > 0 {
+		totalGB := *total / gb
+		metrics.MemTotalGB = &totalGB
+
+		available := single(memAvailableNames)
+		if available == nil {
+			// Kernels before 3.14 have no MemAvailable
+			if free := single(memFreeNames); free != nil {
+				sum := *free
+				for _, names := range [][]string{memBuffersNames, memCachedNames} {
+					if value := single(names); value != nil {
+						sum += *value
+					}
+				}
+				available = &sum
+			}
+		}
+		if available != nil {
+			availableGB := *available / gb
+			usedPercent := clampPercent((1 - *available / *total) * 100)
+			metrics.MemAvailableGB = &availableGB
+			metrics.MemUsedPercent = &usedPercent
+		}
+	}
+
+	metrics.Load1 = single([]string{"node_load1"})
+	metrics.Load5 = single([]string{"node_load5"})
+	metrics.Load15 = single([]string{"node_load15"})
+	if boot, clock := single(bootTimeNames), single(timeNames); boot != nil && clock != nil {
+		uptime := *clock - *boot
+		metrics.UptimeSeconds = &uptime
+	}
+
+	for _, pair := range []struct {
+		names []string
+		total *float64
+	}{{netRxNames, &current.netRx}, {netTxNames, &current.netTx}} {
+		for _, sample := range first(pair.names) {
+			if sample.Labels["device"] != "lo" {
+				*pair.total += sample.Value
+				current.hasNet = true
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	previous, hasPrevious := s.previous[node]
+	s.previous[node] = current
+	s.mutex.Unlock()
+
+	if hasPrevious {
+		elapsed := current.at.Sub(previous.at).Seconds()
+		if current.hasCPU && previous.hasCPU && current.cpuTotal > previous.cpuTotal {
+			busy := clampPercent((1 - (current.cpuIdle-previous.cpuIdle)/(current.cpuTotal-previous.cpuTotal)) * 100)
+			metrics.CPUUsedPercent = &busy
+		}
+		// Counters going backwards mean the node or exporter restarted
+		if current.hasNet && previous.hasNet && elapsed > 0 && current.netRx >= previous.netRx && current.netTx >= previous.netTx {
+			rx := (current.netRx - previous.netRx) / elapsed
+			tx := (current.netTx - previous.netTx) / elapsed
+			metrics.NetRxBytesPerSec = &rx
+			metrics.NetTxBytesPerSec = &tx
+		}
+	}
+	return metrics
+}
+
+func clampPercent(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	if value > 100 {
+		return 100
+	}
+	return value
+}
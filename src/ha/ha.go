@@ -0,0 +1,348 @@
+package ha
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Roles of a manager instance
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// Config holds the ha section of config.yaml
+type Config struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// InstanceID names this manager in the lease; defaults to hostname:pid
+	InstanceID string `yaml:"instance_id" json:"instanceId"`
+	// AdvertiseURL is how clients reach this manager, reported to them by the follower
+	AdvertiseURL string `yaml:"advertise_url" json:"advertiseUrl"`
+	// LeaseFile must be on storage shared by all instances, next to the data directory
+	LeaseFile    string `yaml:"lease_file" json:"leaseFile"`
+	LeaseSeconds int    `yaml:"lease_seconds" json:"leaseSeconds"`
+	RenewSeconds int    `yaml:"renew_seconds" json:"renewSeconds"`
+}
+
+// Lease is the leadership record kept in the lease file
+type Lease struct {
+	Holder     string    `json:"holder"`
+	URL        string    `json:"url,omitempty"`
+	Term       int64     `json:"term"` // incremented whenever leadership changes hands
+	AcquiredAt time.Time `json:"acquiredAt"`
+	RenewedAt  time.Time `json:"renewedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Status is the response of GET /api/ha/status
+type Status struct {
+	Enabled    bool       `json:"enabled"`
+	InstanceID string     `json:"instanceId"`
+	Role       string     `json:"role"`
+	Leader     *Lease     `json:"leader,omitempty"`
+	LeaderFor  string     `json:"leaderFor,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+	ElectedAt  *time.Time `json:"electedAt,omitempty"`
+}
+
+// Elector elects one leader among manager instances sharing a lease file. The leader
+// renews its lease every renew_seconds; a follower takes over once the lease has not
+// been renewed for lease_seconds. Without HA every instance is the leader.
+type Elector struct {
+	mutex     sync.RWMutex
+	config    Config
+	leader    bool
+	lease     *Lease
+	electedAt *time.Time
+	lastError string
+	stop      chan struct{}
+}
+
+// NewElector creates an elector with HA disabled
+func NewElector() *Elector {
+	return &Elector{
+		config: Config{
+			LeaseFile:    "data/ha/leader.json",
+			LeaseSeconds: 15,
+			RenewSeconds: 5,
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+// LoadConfig reads the ha section from the application config file
+func (e *Elector) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		HA Config `yaml:"ha"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.config.Enabled = wrapper.HA.Enabled
+	e.config.AdvertiseURL = wrapper.HA.AdvertiseURL
+	e.config.InstanceID = wrapper.HA.InstanceID
+	if e.config.InstanceID == "" {
+		hostname, _ := os.Hostname()
+		e.config.InstanceID = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+	if wrapper.HA.LeaseFile != "" {
+		e.config.LeaseFile = wrapper.HA.LeaseFile
+	}
+	if wrapper.HA.LeaseSeconds > 0 {
+		e.config.LeaseSeconds = wrapper.HA.LeaseSeconds
+	}
+	if wrapper.HA.RenewSeconds > 0 {
+		e.config.RenewSeconds = wrapper.HA.RenewSeconds
+	}
+	// Leave room for at least one failed renewal before the lease expires
+	if e.config.RenewSeconds*2 > e.config.LeaseSeconds {
+		e.config.RenewSeconds = e.config.LeaseSeconds / 2
+		if e.config.RenewSeconds < 1 {
+			e.config.RenewSeconds = 1
+		}
+	}
+	return nil
+}
+
+// Start campaigns for leadership in the background. onElected runs once this instance
+// becomes the leader; onDemoted runs if it later loses the lease, after which the
+// instance must not act as leader any more.
+func (e *Elector) Start(onElected, onDemoted func()) {
+	e.mutex.Lock()
+	config := e.config
+	if !config.Enabled {
+		now := time.Now().UTC()
+		e.leader = true
+		e.electedAt = &now
+		e.mutex.Unlock()
+		onElected()
+		return
+	}
+	e.mutex.Unlock()
+
+	logger.LogWithNode("System", "HA", fmt.Sprintf("HA enabled, instance %s campaigning for leadership via %s", config.InstanceID, config.LeaseFile), "info")
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.RenewSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			e.tick(onElected, onDemoted)
+			select {
+			case <-ticker.C:
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// tick acquires or renews the lease once
+func (e *Elector) tick(onElected, onDemoted func()) {
+	e.mutex.RLock()
+	wasLeader := e.leader
+	lastRenewal := time.Time{}
+	if e.lease != nil && e.leader {
+		lastRenewal = e.lease.RenewedAt
+	}
+	e.mutex.RUnlock()
+
+	lease, acquired, err := e.campaign()
+
+	e.mutex.Lock()
+	if err != nil {
+		e.lastError = err.Error()
+	} else {
+		e.lastError = ""
+		e.lease = lease
+	}
+
+	switch {
+	case err == nil && acquired && !wasLeader:
+		now := time.Now().UTC()
+		e.leader = true
+		e.electedAt = &now
+		e.mutex.Unlock()
+		logger.LogSuccess("System", "HA", fmt.Sprintf("Instance %s elected leader (term %d)", e.config.InstanceID, lease.Term))
+		onElected()
+	case err == nil && !acquired && wasLeader:
+		e.leader = false
+		e.mutex.Unlock()
+		logger.LogError("System", "HA", fmt.Sprintf("Instance %s lost leadership to %s", e.config.InstanceID, lease.Holder))
+		onDemoted()
+	case err != nil && wasLeader && time.Since(lastRenewal) >= time.Duration(e.config.LeaseSeconds)*time.Second:
+		// A follower may already have taken over; stop acting as leader
+		e.leader = false
+		e.mutex.Unlock()
+		logger.LogError("System", "HA", fmt.Sprintf("Instance %s could not renew its lease: %v", e.config.InstanceID, err))
+		onDemoted()
+	default:
+		e.mutex.Unlock()
+		if err != nil {
+			logger.LogWarning("System", "HA", fmt.Sprintf("Lease update failed: %v", err))
+		}
+	}
+}
+
+// campaign takes the lease if it is free, expired or already ours and renews it. The
+// read-modify-write is serialised across instances with an flock on a sibling lock file.
+func (e *Elector) campaign() (*Lease, bool, error) {
+	e.mutex.RLock()
+	config := e.config
+	e.mutex.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(config.LeaseFile), 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create lease directory: %v", err)
+	}
+	lockFile, err := os.OpenFile(config.LeaseFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, false, fmt.Errorf("failed to lock lease: %v", err)
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	current, err := readLease(config.LeaseFile)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now().UTC()
+	if current != nil && current.Holder != config.InstanceID && now.Before(current.ExpiresAt) {
+		return current, false, nil
+	}
+
+	next := Lease{
+		Holder:     config.InstanceID,
+		URL:        config.AdvertiseURL,
+		AcquiredAt: now,
+		RenewedAt:  now,
+		ExpiresAt:  now.Add(time.Duration(config.LeaseSeconds) * time.Second),
+		Term:       1,
+	}
+	if current != nil {
+		next.Term = current.Term
+		if current.Holder == config.InstanceID {
+			next.AcquiredAt = current.AcquiredAt
+		} else {
+			next.Term++
+		}
+	}
+	if err := writeLease(config.LeaseFile, &next); err != nil {
+		return nil, false, err
+	}
+	return &next, true, nil
+}
+
+// Resign gives up the lease so a follower can take over without waiting for it to expire
+func (e *Elector) Resign() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.config.Enabled || !e.leader {
+		return
+	}
+	close(e.stop)
+	e.leader = false
+
+	lockFile, err := os.OpenFile(e.config.LeaseFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return
+	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+
+	current, err := readLease(e.config.LeaseFile)
+	if err != nil || current == nil || current.Holder != e.config.InstanceID {
+		return
+	}
+	current.ExpiresAt = time.Now().UTC()
+	if err := writeLease(e.config.LeaseFile, current); err == nil {
+		logger.LogWithNode("System", "HA", fmt.Sprintf("Instance %s resigned leadership", e.config.InstanceID), "info")
+	}
+}
+
+// IsLeader reports whether this instance currently holds leadership
+func (e *Elector) IsLeader() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.leader
+}
+
+// InstanceID returns the name of this instance
+func (e *Elector) InstanceID() string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.config.InstanceID
+}
+
+// Status returns the role of this instance and the current lease
+func (e *Elector) Status() Status {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	status := Status{
+		Enabled:    e.config.Enabled,
+		InstanceID: e.config.InstanceID,
+		Role:       RoleFollower,
+		LastError:  e.lastError,
+		ElectedAt:  e.electedAt,
+	}
+	if e.leader {
+		status.Role = RoleLeader
+	}
+	if e.lease != nil {
+		lease := *e.lease
+		status.Leader = &lease
+		status.LeaderFor = time.Since(lease.AcquiredAt).Round(time.Second).String()
+	}
+	return status
+}
+
+func readLease(path string) (*Lease, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease file: %v", err)
+	}
+
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, fmt.Errorf("failed to parse lease file: %v", err)
+	}
+	return &lease, nil
+}
+
+func writeLease(path string, lease *Lease) error {
+	data, err := json.MarshalIndent(lease, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lease: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease file: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
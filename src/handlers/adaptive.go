@@ -0,0 +1,646 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Signals the adaptive controller can hold below a limit
+const (
+	SignalClickHouseLatency = "clickhouse_latency" // seconds the newest ClickHouse row lags behind now
+	SignalKafkaLag          = "kafka_lag"          // consumer lag returned by adaptive_eps.lag_query
+)
+
+// Adaptive controller states
+const (
+	AdaptiveSearching = "searching" // raising or lowering EPS to find the sustainable rate
+	AdaptiveHolding   = "holding"   // holding the discovered capacity, searching again on a breach
+	AdaptiveStopped   = "stopped"
+	AdaptiveFailed    = "failed"
+)
+
+// adaptiveMaxFailures consecutive failed measurements or adjustments stop the controller
+const adaptiveMaxFailures = 3
+
+// AdaptiveConfig holds the adaptive_eps section of config.yaml
+type AdaptiveConfig struct {
+	IntervalSeconds int     `yaml:"interval_seconds" json:"intervalSeconds"` // time at each rate before the signal is judged
+	StepPct         float64 `yaml:"step_pct" json:"stepPct"`                 // change while no ceiling or floor is known
+	ResolutionPct   float64 `yaml:"resolution_pct" json:"resolutionPct"`     // stop searching once the bounds are this close
+	MinEPS          int     `yaml:"min_eps" json:"minEps"`
+	MaxEPS          int     `yaml:"max_eps" json:"maxEps"` // also capped by max_eps.yaml of the enabled sources
+	LatencyColumn   string  `yaml:"latency_column" json:"latencyColumn"`
+	LagQuery        string  `yaml:"lag_query" json:"lagQuery,omitempty"` // saved query returning the lag in its first column
+	CapacityFile    string  `yaml:"capacity_file" json:"capacityFile"`
+}
+
+// AdaptiveRequest starts the controller on the running simulation
+type AdaptiveRequest struct {
+	Signal   string  `json:"signal"`
+	Target   float64 `json:"target"`             // the signal's ceiling
+	StartEPS int     `json:"startEps,omitempty"` // defaults to the run's current target EPS
+	MaxEPS   int     `json:"maxEps,omitempty"`   // lowers adaptive_eps.max_eps for this search
+}
+
+// AdaptiveStep is one judged interval of the controller
+type AdaptiveStep struct {
+	Time    time.Time `json:"time"`
+	EPS     int       `json:"eps"`
+	Value   *float64  `json:"value,omitempty"`
+	Within  bool      `json:"within"` // the signal stayed at or below the target
+	NextEPS int       `json:"nextEps"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// CapacityRecord is a sustainable rate discovered by the adaptive controller
+type CapacityRecord struct {
+	RunID        string    `json:"runId"`
+	Scenario     string    `json:"scenario,omitempty"`
+	Signal       string    `json:"signal"`
+	Target       float64   `json:"target"`
+	Value        float64   `json:"value"` // the signal at the capacity
+	CapacityEPS  int       `json:"capacityEps"`
+	LimitedByMax bool      `json:"limitedByMax"` // the signal stayed below the target up to the maximum EPS
+	Nodes        int       `json:"nodes"`
+	Sources      []string  `json:"sources"`
+	DiscoveredAt time.Time `json:"discoveredAt"`
+
+	// AllocatableCores is the CPU left to the simulator on the enabled nodes after their
+	// reservations, so capacities of hosts shared with other workloads compare fairly
+	AllocatableCores      float64  `json:"allocatableCores,omitempty"`
+	EPSPerAllocatableCore *float64 `json:"epsPerAllocatableCore,omitempty"`
+}
+
+// AdaptiveStatus is the state of the controller
+type AdaptiveStatus struct {
+	State          string          `json:"state,omitempty"` // empty before the first start
+	RunID          string          `json:"runId,omitempty"`
+	Signal         string          `json:"signal,omitempty"`
+	Target         float64         `json:"target,omitempty"`
+	CurrentEPS     int             `json:"currentEps,omitempty"`
+	SustainableEPS int             `json:"sustainableEps,omitempty"` // highest rate that held the signal
+	FailingEPS     int             `json:"failingEps,omitempty"`     // lowest rate that exceeded it
+	MaxEPS         int             `json:"maxEps,omitempty"`
+	Message        string          `json:"message,omitempty"`
+	StartedAt      *time.Time      `json:"startedAt,omitempty"`
+	Steps          []AdaptiveStep  `json:"steps"`
+	Capacity       *CapacityRecord `json:"capacity,omitempty"`
+	Config         AdaptiveConfig  `json:"config"`
+}
+
+// AdaptiveController raises and lowers the total EPS of the running simulation to find
+// the highest rate at which ClickHouse ingest latency or Kafka lag stays below a limit.
+// The rate is raised in steps until the signal exceeds the limit and then bisected
+// between the highest good and the lowest failing rate; the result is recorded as the
+// cluster's capacity and held.
+type AdaptiveController struct {
+	mutex  sync.Mutex
+	config AdaptiveConfig
+	status AdaptiveStatus
+	stop   chan struct{}
+}
+
+var Adaptive = &AdaptiveController{config: defaultAdaptiveConfig()}
+
+func defaultAdaptiveConfig() AdaptiveConfig {
+	return AdaptiveConfig{
+		IntervalSeconds: 120,
+		StepPct:         20,
+		ResolutionPct:   5,
+		MinEPS:          1000,
+		MaxEPS:          100000,
+		LatencyColumn:   "timestamp",
+		CapacityFile:    "data/capacity.json",
+	}
+}
+
+// LoadConfig reads the adaptive_eps section from the application config file
+func (ac *AdaptiveController) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultAdaptiveConfig()
+	fileConfig := struct {
+		Adaptive *AdaptiveConfig `yaml:"adaptive_eps"`
+	}{Adaptive: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.IntervalSeconds < 10 || config.StepPct <= 0 || config.ResolutionPct <= 0 || config.MinEPS < 1 || config.MaxEPS < config.MinEPS {
+		return fmt.Errorf("adaptive_eps needs interval_seconds >= 10, positive step_pct and resolution_pct and 1 <= min_eps <= max_eps")
+	}
+
+	ac.mutex.Lock()
+	ac.config = config
+	ac.mutex.Unlock()
+	return nil
+}
+
+// Active reports whether the controller is adjusting the running simulation
+func (ac *AdaptiveController) Active() bool {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	return ac.stop != nil
+}
+
+// Status returns the state of the controller
+func (ac *AdaptiveController) Status() AdaptiveStatus {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	status := ac.status
+	status.Steps = append([]AdaptiveStep{}, ac.status.Steps...)
+	status.Config = ac.config
+	return status
+}
+
+// Capacity returns the capacity discovered during a run
+func (ac *AdaptiveController) Capacity(runID string) (int, bool) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if ac.status.RunID != runID || ac.status.Capacity == nil {
+		return 0, false
+	}
+	return ac.status.Capacity.CapacityEPS, true
+}
+
+// Start begins the search on the running simulation
+func (ac *AdaptiveController) Start(request AdaptiveRequest) (AdaptiveStatus, error) {
+	switch request.Signal {
+	case SignalClickHouseLatency:
+		if topicMapping == nil {
+			return AdaptiveStatus{}, fmt.Errorf("topics_tables.yaml mapping not loaded")
+		}
+	case SignalKafkaLag:
+		if ac.Status().Config.LagQuery == "" {
+			return AdaptiveStatus{}, fmt.Errorf("kafka_lag needs adaptive_eps.lag_query, a saved query returning the lag")
+		}
+	default:
+		return AdaptiveStatus{}, fmt.Errorf("signal must be %s or %s", SignalClickHouseLatency, SignalKafkaLag)
+	}
+	if request.Target <= 0 {
+		return AdaptiveStatus{}, fmt.Errorf("target must be positive")
+	}
+
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	currentEPS := sim.TargetEPS
+	if !running {
+		return AdaptiveStatus{}, fmt.Errorf("no simulation is currently running")
+	}
+	if EPSRamp.Active() {
+		return AdaptiveStatus{}, fmt.Errorf("an EPS ramp is adjusting this run; stop it first")
+	}
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if ac.stop != nil {
+		return AdaptiveStatus{}, fmt.Errorf("the adaptive controller is already running on run %s", ac.status.RunID)
+	}
+	config := ac.config
+	maxEPS := adaptiveMaxEPS(config.MaxEPS)
+	if request.MaxEPS > 0 && request.MaxEPS < maxEPS {
+		maxEPS = request.MaxEPS
+	}
+	startEPS := request.StartEPS
+	if startEPS == 0 {
+		startEPS = currentEPS
+	}
+	if startEPS < config.MinEPS || startEPS > maxEPS {
+		return AdaptiveStatus{}, fmt.Errorf("start EPS %d is outside %d to %d", startEPS, config.MinEPS, maxEPS)
+	}
+
+	now := time.Now().UTC()
+	ac.status = AdaptiveStatus{
+		State:      AdaptiveSearching,
+		RunID:      runID,
+		Signal:     request.Signal,
+		Target:     request.Target,
+		CurrentEPS: currentEPS,
+		MaxEPS:     maxEPS,
+		Message:    fmt.Sprintf("Searching from %d EPS", startEPS),
+		StartedAt:  &now,
+		Steps:      []AdaptiveStep{},
+	}
+	ac.stop = make(chan struct{})
+	go ac.loop(ac.stop, config, startEPS)
+
+	status := ac.status
+	status.Config = config
+	return status, nil
+}
+
+// Stop ends the search; the run keeps its current EPS
+func (ac *AdaptiveController) Stop(reason string) bool {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	if ac.stop == nil {
+		return false
+	}
+	ac.finishLocked(ac.stop, AdaptiveStopped, reason)
+	return true
+}
+
+// finishLocked ends the search started with stop, unless it already ended; callers
+// must hold ac.mutex
+func (ac *AdaptiveController) finishLocked(stop chan struct{}, state, message string) {
+	if ac.stop != stop {
+		return
+	}
+	close(ac.stop)
+	ac.stop = nil
+	ac.status.State = state
+	ac.status.Message = message
+}
+
+// adaptiveMaxEPS caps the configured maximum by max_eps.yaml of the enabled sources
+func adaptiveMaxEPS(configured int) int {
+	numNodes := len(NodeManager.GetEnabledNodes())
+	if err := O11yManager.LoadMainConfig(); err != nil || numNodes == 0 {
+		return configured
+	}
+	limits := O11yManager.GetMaxEPSConfig()
+	sourceMax := 0
+	for _, source := range O11yManager.GetEnabledSources() {
+		sourceMax += limits[source]
+	}
+	if total := sourceMax * numNodes; total > 0 && total < configured {
+		return total
+	}
+	return configured
+}
+
+func (ac *AdaptiveController) loop(stop chan struct{}, config AdaptiveConfig, startEPS int) {
+	failures := 0
+	fail := func(step AdaptiveStep, err error) bool {
+		step.Error = err.Error()
+		failures++
+		ac.mutex.Lock()
+		defer ac.mutex.Unlock()
+		ac.status.Steps = append(ac.status.Steps, step)
+		if failures < adaptiveMaxFailures {
+			return false
+		}
+		ac.finishLocked(stop, AdaptiveFailed, fmt.Sprintf("Stopped after %d failures: %v", failures, err))
+		logger.LogWarning("System", "Adaptive", ac.status.Message)
+		return true
+	}
+
+	if err := ac.apply(startEPS); err != nil {
+		ac.mutex.Lock()
+		ac.finishLocked(stop, AdaptiveFailed, fmt.Sprintf("Failed to set the start EPS: %v", err))
+		ac.mutex.Unlock()
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		sim := AppState.Simulation()
+		running := sim.Running
+		runID := sim.RunID
+		ac.mutex.Lock()
+		current, target, signal := ac.status.CurrentEPS, ac.status.Target, ac.status.Signal
+		sameRun := ac.status.RunID == runID
+		ac.mutex.Unlock()
+		if !running || !sameRun {
+			ac.mutex.Lock()
+			ac.finishLocked(stop, AdaptiveStopped, "The run ended")
+			ac.mutex.Unlock()
+			return
+		}
+
+		step := AdaptiveStep{Time: time.Now().UTC(), EPS: current}
+		value, err := measureAdaptiveSignal(signal, config)
+		if err != nil {
+			if fail(step, err) {
+				return
+			}
+			continue
+		}
+		step.Value = &value
+		step.Within = value <= target
+
+		next, record := ac.decide(step, config)
+		step.NextEPS = next
+		if next != current {
+			if err := ac.apply(next); err != nil {
+				step.NextEPS = current
+				if fail(step, err) {
+					return
+				}
+				continue
+			}
+		}
+		failures = 0
+
+		ac.mutex.Lock()
+		ac.status.Steps = append(ac.status.Steps, step)
+		ac.mutex.Unlock()
+		if record != nil {
+			ac.recordCapacity(record, config)
+		}
+	}
+}
+
+// decide moves the search bounds by the judged step and returns the next EPS, plus the
+// capacity when the search just converged
+func (ac *AdaptiveController) decide(step AdaptiveStep, config AdaptiveConfig) (int, *CapacityRecord) {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	s := &ac.status
+	current := step.EPS
+
+	if step.Within {
+		if current > s.SustainableEPS {
+			s.SustainableEPS = current
+		}
+		if s.State == AdaptiveHolding {
+			return current, nil
+		}
+	} else {
+		if s.FailingEPS == 0 || current < s.FailingEPS {
+			s.FailingEPS = current
+		}
+		// The rate that held before no longer does, so conditions changed: search again
+		if current <= s.SustainableEPS {
+			s.SustainableEPS = 0
+		}
+		s.State = AdaptiveSearching
+	}
+
+	switch {
+	case s.FailingEPS == 0 && current >= s.MaxEPS:
+		return ac.convergedLocked(current, true, *step.Value)
+	case s.FailingEPS == 0:
+		s.Message = fmt.Sprintf("Raising: %d EPS held the signal", current)
+		return min(int(math.Ceil(float64(current)*(1+config.StepPct/100))), s.MaxEPS), nil
+	case s.SustainableEPS == 0:
+		if current <= config.MinEPS {
+			s.Message = fmt.Sprintf("The signal exceeds %g even at the minimum of %d EPS", s.Target, config.MinEPS)
+			return current, nil
+		}
+		s.Message = fmt.Sprintf("Lowering: %d EPS exceeded the signal's limit", current)
+		return max(int(float64(current)*(1-config.StepPct/100)), config.MinEPS), nil
+	case float64(s.FailingEPS-s.SustainableEPS) <= float64(s.SustainableEPS)*config.ResolutionPct/100:
+		return ac.convergedLocked(s.SustainableEPS, false, *step.Value)
+	}
+	s.Message = fmt.Sprintf("Bisecting: %d EPS held the signal, %d EPS exceeded it", s.SustainableEPS, s.FailingEPS)
+	return (s.SustainableEPS + s.FailingEPS) / 2, nil
+}
+
+// convergedLocked holds the sustainable rate; callers must hold ac.mutex
+func (ac *AdaptiveController) convergedLocked(capacity int, limitedByMax bool, value float64) (int, *CapacityRecord) {
+	s := &ac.status
+	s.State = AdaptiveHolding
+	s.Message = fmt.Sprintf("Holding the discovered capacity of %d EPS", capacity)
+	if limitedByMax {
+		s.Message = fmt.Sprintf("Holding %d EPS, the maximum; the signal stayed below %g", capacity, s.Target)
+	}
+	record := &CapacityRecord{
+		RunID:        s.RunID,
+		Signal:       s.Signal,
+		Target:       s.Target,
+		Value:        value,
+		CapacityEPS:  capacity,
+		LimitedByMax: limitedByMax,
+		DiscoveredAt: time.Now().UTC(),
+	}
+	s.Capacity = record
+	return capacity, record
+}
+
+// apply sets the total EPS of the run, restarting the simulators
+func (ac *AdaptiveController) apply(eps int) error {
+	adjustment, _, err := adjustRunEPS(EPSAdjustRequest{TotalEPS: eps}, true, 30)
+	if err != nil {
+		return err
+	}
+	if !adjustment.AllOK {
+		return fmt.Errorf("%s", adjustment.Message)
+	}
+	ac.mutex.Lock()
+	ac.status.CurrentEPS = adjustment.TargetEPS
+	ac.mutex.Unlock()
+	return nil
+}
+
+// measureAdaptiveSignal reads the current value of a signal
+func measureAdaptiveSignal(signal string, config AdaptiveConfig) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if signal == SignalKafkaLag {
+		result, err := clickhouse.SavedQueries.Run(ctx, config.LagQuery, nil)
+		if err != nil {
+			return 0, err
+		}
+		if len(result.Rows) == 0 || len(result.Rows[0]) == 0 {
+			return 0, fmt.Errorf("lag query %s returned no rows", config.LagQuery)
+		}
+		return numericValue(result.Rows[0][0])
+	}
+
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return 0, fmt.Errorf("failed to read conf.yml: %v", err)
+	}
+	var tables []string
+	for _, source := range O11yManager.GetEnabledSources() {
+		if topicConfig, ok := topicMapping.SourceConfig(source); ok {
+			tables = append(tables, topicConfig.ClickhouseTables...)
+		}
+	}
+	if len(tables) == 0 {
+		return 0, fmt.Errorf("no ClickHouse tables are mapped for the enabled sources")
+	}
+	return clickhouse.IngestLatency(ctx, tables, config.LatencyColumn)
+}
+
+// numericValue converts a scanned ClickHouse value to float64
+func numericValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	}
+	return 0, fmt.Errorf("value %v of type %T is not a number", value, value)
+}
+
+// recordCapacity adds the run's scenario and cluster shape to a discovered capacity and
+// appends it to the capacity file
+func (ac *AdaptiveController) recordCapacity(record *CapacityRecord, config AdaptiveConfig) {
+	if run, ok := RunStore.GetRun(record.RunID); ok {
+		record.Scenario = run.Scenario
+	}
+	record.Nodes = len(NodeManager.GetEnabledNodes())
+	if cores := allocatableCores(); cores > 0 {
+		perCore := float64(record.CapacityEPS) / cores
+		record.AllocatableCores = cores
+		record.EPSPerAllocatableCore = &perCore
+	}
+	record.Sources = O11yManager.GetEnabledSources()
+
+	message := fmt.Sprintf("Discovered capacity of %d EPS (%s %.1f, limit %g)", record.CapacityEPS, record.Signal, record.Value, record.Target)
+	logger.LogSuccess("System", "Adaptive", message)
+	if err := RunStore.AddTimelineEvent(record.RunID, "capacity_discovered", message, map[string]interface{}{
+		"capacityEps":  record.CapacityEPS,
+		"signal":       record.Signal,
+		"target":       record.Target,
+		"value":        record.Value,
+		"limitedByMax": record.LimitedByMax,
+	}); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record capacity on run %s: %v", record.RunID, err))
+	}
+	go AppState.BroadcastEvent("capacity_discovered", record)
+
+	records, err := readCapacityRecords(config.CapacityFile)
+	if err == nil {
+		records = append([]CapacityRecord{*record}, records...)
+		err = writeCapacityRecords(config.CapacityFile, records)
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to save discovered capacity")
+	}
+}
+
+func readCapacityRecords(file string) ([]CapacityRecord, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return []CapacityRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capacity records: %v", err)
+	}
+	var records []CapacityRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse capacity records: %v", err)
+	}
+	return records, nil
+}
+
+func writeCapacityRecords(file string, records []CapacityRecord) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create capacity directory: %v", err)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal capacity records: %v", err)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write capacity records: %v", err)
+	}
+	return os.Rename(tmp, file)
+}
+
+// HandleAPIStartAdaptive Handles POST /api/simulation/adaptive
+// Body: {"signal": "clickhouse_latency", "target": 30} searches for the highest total EPS
+// at which ClickHouse ingest latency stays at or below 30 seconds. With "kafka_lag" the
+// target is the lag returned by adaptive_eps.lag_query.
+func HandleAPIStartAdaptive(w http.ResponseWriter, r *http.Request) {
+	var request AdaptiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	status, err := Adaptive.Start(request)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to start the adaptive controller: %v", err),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Adaptive controller started: holding %s at or below %g, up to %d EPS", status.Signal, status.Target, status.MaxEPS)
+	logger.LogWithNode("System", "Adaptive", message, "info")
+	if err := RunStore.AddTimelineEvent(status.RunID, "adaptive_started", message, map[string]interface{}{
+		"signal": status.Signal,
+		"target": status.Target,
+		"maxEps": status.MaxEPS,
+	}); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record adaptive start on run %s: %v", status.RunID, err))
+	}
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    status,
+	})
+}
+
+// HandleAPIGetAdaptive Handles GET /api/simulation/adaptive
+func HandleAPIGetAdaptive(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    Adaptive.Status(),
+	})
+}
+
+// HandleAPIStopAdaptive Handles DELETE /api/simulation/adaptive
+// Stops the search; the run keeps its current EPS.
+func HandleAPIStopAdaptive(w http.ResponseWriter, r *http.Request) {
+	if !Adaptive.Stop("Stopped through the API") {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "The adaptive controller is not running",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Adaptive controller stopped",
+		Data:    Adaptive.Status(),
+	})
+}
+
+// HandleAPIGetCapacity Handles GET /api/capacity
+// Lists the capacities discovered by the adaptive controller, newest first.
+func HandleAPIGetCapacity(w http.ResponseWriter, r *http.Request) {
+	records, err := readCapacityRecords(Adaptive.Status().Config.CapacityFile)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d capacity records", len(records)),
+		Data:    records,
+	}, "capacity")
+}
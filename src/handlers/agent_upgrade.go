@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/distribution"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/timeutil"
+)
+
+// Node outcomes of an agent upgrade
+const (
+	UpgradeNodePending   = "pending"
+	UpgradeNodeRunning   = "upgrading"
+	UpgradeNodeUpgraded  = "upgraded"
+	UpgradeNodeFailed    = "failed"
+	UpgradeNodeCancelled = "cancelled" // not reached before the upgrade aborted
+)
+
+// How long an upgraded agent has to answer with the new build
+const (
+	agentUpgradeHealthTimeoutSeconds = 60
+	agentUpgradePollSeconds          = 3
+)
+
+// AgentUpgradeNode is the outcome of one node
+type AgentUpgradeNode struct {
+	Node           string `json:"node"`
+	Batch          int    `json:"batch"`
+	Status         string `json:"status"`
+	Message        string `json:"message,omitempty"`
+	From           string `json:"from,omitempty"` // version and commit before the upgrade
+	DistributionID string `json:"distributionId,omitempty"`
+}
+
+// AgentUpgradeResult is the state of the running or latest agent upgrade
+type AgentUpgradeResult struct {
+	Status      string             `json:"status"` // a rolling restart status
+	Target      AgentBuild         `json:"target"`
+	BatchSize   int                `json:"batchSize"`
+	Nodes       []AgentUpgradeNode `json:"nodes"`
+	Message     string             `json:"message,omitempty"`
+	TriggeredBy string             `json:"triggeredBy"`
+	StartedAt   time.Time          `json:"startedAt"`
+	EndedAt     *time.Time         `json:"endedAt,omitempty"`
+}
+
+// AgentUpgrader replaces the node agents batch by batch with the manager's agent binary:
+// it distributes the binary, restarts the agent and waits for it to report the new
+// build. A failed node aborts the upgrade, so a bad build never reaches the whole fleet.
+type AgentUpgrader struct {
+	mutex  sync.Mutex
+	latest *AgentUpgradeResult
+}
+
+var AgentUpgrade = &AgentUpgrader{}
+
+// Latest returns the running or last finished agent upgrade, or nil if none ran yet
+func (au *AgentUpgrader) Latest() *AgentUpgradeResult {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	if au.latest == nil {
+		return nil
+	}
+	result := *au.latest
+	result.Nodes = append([]AgentUpgradeNode(nil), au.latest.Nodes...)
+	return &result
+}
+
+// Start upgrades the agents of the nodes to target in the background, batchSize nodes
+// at a time in the given order
+func (au *AgentUpgrader) Start(nodes []AgentUpgradeNode, target AgentBuild, batchSize int, triggeredBy string) (*AgentUpgradeResult, error) {
+	au.mutex.Lock()
+	if au.latest != nil && au.latest.Status == RollingRestartRunning {
+		au.mutex.Unlock()
+		return nil, fmt.Errorf("an agent upgrade is already running")
+	}
+	result := &AgentUpgradeResult{
+		Status:      RollingRestartRunning,
+		Target:      target,
+		BatchSize:   batchSize,
+		Nodes:       make([]AgentUpgradeNode, 0, len(nodes)),
+		TriggeredBy: triggeredBy,
+		StartedAt:   timeutil.Now(),
+	}
+	for i, node := range nodes {
+		node.Batch, node.Status = i/batchSize+1, UpgradeNodePending
+		result.Nodes = append(result.Nodes, node)
+	}
+	au.latest = result
+	au.mutex.Unlock()
+
+	go au.run()
+	return au.Latest(), nil
+}
+
+// update changes the latest result under the lock
+func (au *AgentUpgrader) update(change func(*AgentUpgradeResult)) {
+	au.mutex.Lock()
+	defer au.mutex.Unlock()
+	change(au.latest)
+}
+
+// run upgrades one batch at a time and stops after the first batch with a failure
+func (au *AgentUpgrader) run() {
+	latest := au.Latest()
+	batches := 0
+	if len(latest.Nodes) > 0 {
+		batches = latest.Nodes[len(latest.Nodes)-1].Batch
+	}
+
+	failed := false
+	for batch := 1; batch <= batches && !failed; batch++ {
+		var names []string
+		for i, node := range latest.Nodes {
+			if node.Batch == batch {
+				names = append(names, node.Node)
+				au.update(func(r *AgentUpgradeResult) { r.Nodes[i].Status = UpgradeNodeRunning })
+			}
+		}
+		outcomes := upgradeAgents(names, latest.Target, latest.TriggeredBy)
+		au.update(func(r *AgentUpgradeResult) {
+			for i := range r.Nodes {
+				outcome, ok := outcomes[r.Nodes[i].Node]
+				if !ok || r.Nodes[i].Batch != batch {
+					continue
+				}
+				r.Nodes[i].Status, r.Nodes[i].Message, r.Nodes[i].DistributionID = outcome.Status, outcome.Message, outcome.DistributionID
+				failed = failed || outcome.Status == UpgradeNodeFailed
+			}
+		})
+	}
+
+	var result AgentUpgradeResult
+	au.update(func(r *AgentUpgradeResult) {
+		upgraded, failures := 0, 0
+		for i := range r.Nodes {
+			switch r.Nodes[i].Status {
+			case UpgradeNodePending:
+				r.Nodes[i].Status = UpgradeNodeCancelled
+			case UpgradeNodeUpgraded:
+				upgraded++
+			case UpgradeNodeFailed:
+				failures++
+			}
+		}
+		r.Status = RollingRestartCompleted
+		r.Message = fmt.Sprintf("Upgraded %d agents to %s, %d failed", upgraded, r.Target.Version, failures)
+		if failed {
+			r.Status = RollingRestartAborted
+			r.Message = "Aborted after a failed batch: " + r.Message
+		}
+		now := timeutil.Now()
+		r.EndedAt = &now
+		result = *r
+	})
+
+	if result.Status == RollingRestartAborted {
+		logger.LogWarning("System", "Agents", "Agent upgrade "+result.Message)
+	} else {
+		logger.LogSuccess("System", "Agents", "Agent upgrade finished: "+result.Message)
+	}
+}
+
+// upgradeAgents distributes the agent binary to the nodes, one distribution per binary
+// directory, then restarts each agent whose copy succeeded and waits for the target build
+func upgradeAgents(names []string, target AgentBuild, triggeredBy string) map[string]AgentUpgradeNode {
+	outcomes := make(map[string]AgentUpgradeNode, len(names))
+	source, err := filepath.Abs(node_control.LocalMetricsBinary)
+	if err != nil {
+		for _, name := range names {
+			outcomes[name] = AgentUpgradeNode{Node: name, Status: UpgradeNodeFailed, Message: err.Error()}
+		}
+		return outcomes
+	}
+
+	enabled := NodeManager.GetEnabledNodes()
+	byDir := make(map[string]map[string]node_control.NodeConfig)
+	for _, name := range names {
+		node, ok := enabled[name]
+		if !ok {
+			outcomes[name] = AgentUpgradeNode{Node: name, Status: UpgradeNodeFailed, Message: "Node is no longer enabled"}
+			continue
+		}
+		if byDir[node.BinaryDir] == nil {
+			byDir[node.BinaryDir] = make(map[string]node_control.NodeConfig)
+		}
+		byDir[node.BinaryDir][name] = node
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for binaryDir, nodes := range byDir {
+		dist, err := FileDistribution.Start(distribution.Request{
+			Source:      source,
+			Destination: remotecmd.Join(binaryDir, remotecmd.MetricsBinary),
+			Mode:        "0755",
+		}, nodes, triggeredBy)
+		if err == nil {
+			var final distribution.Distribution
+			if final, err = FileDistribution.Wait(dist.ID); err == nil {
+				dist = &final
+			}
+		}
+		for name, node := range nodes {
+			outcome := AgentUpgradeNode{Node: name, Status: UpgradeNodeFailed}
+			switch {
+			case err != nil:
+				outcome.Message = fmt.Sprintf("Failed to distribute the agent binary: %v", err)
+			case !dist.Results[name].Success:
+				outcome.DistributionID = dist.ID
+				outcome.Message = "Failed to distribute the agent binary: " + dist.Results[name].Message
+			default:
+				wg.Add(1)
+				go func(name string, node node_control.NodeConfig, distributionID string) {
+					defer wg.Done()
+					outcome := restartAgent(name, node, target)
+					outcome.DistributionID = distributionID
+					mutex.Lock()
+					outcomes[name] = outcome
+					mutex.Unlock()
+				}(name, node, dist.ID)
+				continue
+			}
+			mutex.Lock()
+			outcomes[name] = outcome
+			mutex.Unlock()
+		}
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// restartAgent restarts the agent of a node on the distributed binary and waits until it
+// reports the target build
+func restartAgent(name string, node node_control.NodeConfig, target AgentBuild) AgentUpgradeNode {
+	outcome := AgentUpgradeNode{Node: name, Status: UpgradeNodeFailed}
+	// A stopped agent is started all the same, so a stop failure is not fatal
+	if response, err := BinaryControl.StopMetricsBinary(name, 30); err != nil {
+		logger.LogWarning(name, "Agents", "Stopping the agent before the upgrade: "+binaryFailure(response, err))
+	}
+	if response, err := BinaryControl.StartMetricsBinary(name, 30); err != nil || !response.Success {
+		outcome.Message = "Start failed: " + binaryFailure(response, err)
+		return outcome
+	}
+
+	var reported AgentBuild
+	waited, err := pollSmokeTest(agentUpgradeHealthTimeoutSeconds, agentUpgradePollSeconds, func() (bool, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		agent := fetchNodeAgentSelf(ctx, name, node)
+		if !agent.Supported {
+			return false, fmt.Errorf("%s", agent.Error)
+		}
+		reported = agent.build()
+		if !target.Matches(reported) {
+			return false, fmt.Errorf("agent reports %s (%s)", reported.Version, reported.Commit)
+		}
+		return true, nil
+	})
+	if err != nil {
+		outcome.Message = fmt.Sprintf("Agent not running the new build: %v", err)
+		return outcome
+	}
+	outcome.Status = UpgradeNodeUpgraded
+	outcome.Message = fmt.Sprintf("Running %s after %v", reported.Version, waited)
+	return outcome
+}
+
+// HandleAPIStartAgentUpgrade Handles POST /api/nodes/agents/upgrade
+// Upgrades the outdated agents of GET /api/nodes/agents to the manager's agent binary,
+// batchSize nodes at a time (default 1). Optional query: nodes (comma-separated) to
+// upgrade those even if they are current. Returns 202; poll GET /api/nodes/agents/upgrade
+// for the progress.
+func HandleAPIStartAgentUpgrade(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	batchSize := 1
+	if value := query.Get("batchSize"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "batchSize must be a positive number",
+			})
+			return
+		}
+		batchSize = parsed
+	}
+
+	report := collectNodeAgents(r.Context())
+	if report.Expected == nil {
+		SendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Cannot upgrade agents: %s", report.ExpectedError),
+		})
+		return
+	}
+
+	var nodes []AgentUpgradeNode
+	if selected := filterSet(query.Get("nodes")); selected != nil {
+		agents := make(map[string]NodeAgentSelf, len(report.Agents))
+		for _, agent := range report.Agents {
+			agents[agent.Node] = agent
+		}
+		for name := range selected {
+			agent, ok := agents[name]
+			if !ok {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Node %s is not an enabled node", name),
+				})
+				return
+			}
+			nodes = append(nodes, AgentUpgradeNode{Node: name, From: describeAgentBuild(agent)})
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	} else {
+		for _, agent := range report.Agents {
+			if agent.Outdated {
+				nodes = append(nodes, AgentUpgradeNode{Node: agent.Node, From: describeAgentBuild(agent)})
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("All reachable agents run %s", report.Expected.Version),
+			Data:    report,
+		})
+		return
+	}
+
+	result, err := AgentUpgrade.Start(nodes, *report.Expected, batchSize, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Agent upgrade not started: %v", err),
+			Data:    AgentUpgrade.Latest(),
+		})
+		return
+	}
+	logger.LogWithNode("System", "Agents", fmt.Sprintf("Upgrade of %d agents to %s, %d at a time, started by %s", len(nodes), result.Target.Version, batchSize, result.TriggeredBy), "info")
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Upgrading %d agents to %s, %d at a time", len(nodes), result.Target.Version, batchSize),
+		Data:    result,
+	})
+}
+
+// HandleAPIGetAgentUpgrade Handles GET /api/nodes/agents/upgrade
+func HandleAPIGetAgentUpgrade(w http.ResponseWriter, r *http.Request) {
+	result := AgentUpgrade.Latest()
+	if result == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "No agent upgrade has run yet",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Agent upgrade %s", result.Status),
+		Data:    result,
+	})
+}
+
+// describeAgentBuild names the build an agent ran before an upgrade
+func describeAgentBuild(agent NodeAgentSelf) string {
+	switch {
+	case !agent.Reachable:
+		return "unreachable"
+	case !agent.Supported:
+		return "unknown"
+	case agent.Commit != "":
+		return fmt.Sprintf("%s (%s)", agent.Version, agent.Commit)
+	}
+	return agent.Version
+}
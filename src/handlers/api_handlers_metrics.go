@@ -29,7 +29,7 @@ func GetMetrics(w http.ResponseWriter, r *http.Request) {
 			From: startTime,
 			To:   endTime,
 		}
-		handleMetricsRequest(w, timeRange)
+		handleMetricsRequest(w, r, timeRange)
 		return
 	}
 
@@ -55,10 +55,10 @@ func GetMetrics(w http.ResponseWriter, r *http.Request) {
 		From: startTime,
 		To:   endTime,
 	}
-	handleMetricsRequest(w, timeRange)
+	handleMetricsRequest(w, r, timeRange)
 }
 
-func handleMetricsRequest(w http.ResponseWriter, timeRange clickhouse.TimeRange) {
+func handleMetricsRequest(w http.ResponseWriter, r *http.Request, timeRange clickhouse.TimeRange) {
 	metrics, err := clickhouse.CollectClickHouseMetrics(timeRange)
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
@@ -68,10 +68,10 @@ func handleMetricsRequest(w http.ResponseWriter, timeRange clickhouse.TimeRange)
 		return
 	}
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    metrics,
-	})
+	}, "metrics")
 }
 
 func HandleProxyMetrics(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyView is a minted key as listed by the API, without its hash
+type apiKeyView struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	Scope     string     `json:"scope"`
+	Status    string     `json:"status"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy string     `json:"revokedBy,omitempty"`
+}
+
+func newAPIKeyView(key auth.MintedKey) apiKeyView {
+	return apiKeyView{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      key.Role,
+		Scope:     key.Scope,
+		Status:    key.Status(time.Now()),
+		CreatedBy: key.CreatedBy,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+		RevokedAt: key.RevokedAt,
+		RevokedBy: key.RevokedBy,
+	}
+}
+
+// HandleAPIListAPIKeys Handles GET /api/auth/keys?status=active
+func HandleAPIListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "active" && status != "expired" && status != "revoked" {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "status must be active, expired or revoked",
+		})
+		return
+	}
+
+	keys := []apiKeyView{}
+	for _, key := range Auth.MintedKeys() {
+		view := newAPIKeyView(key)
+		if status == "" || view.Status == status {
+			keys = append(keys, view)
+		}
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d minted API keys", len(keys)),
+		Data:    keys,
+	}, "api_keys")
+}
+
+// HandleAPIMintAPIKey Handles POST /api/auth/keys
+// Body: {"name": "exec-dashboard", "expiresInDays": 30} mints a read-only dashboard key.
+// The key is returned once and only its hash is stored.
+func HandleAPIMintAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name          string `json:"name"`
+		ExpiresInDays int    `json:"expiresInDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = 30
+	}
+	ttl := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	if maxTTL := Auth.MaxKeyTTL(); ttl > maxTTL {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("expiresInDays may be at most %d", int(maxTTL.Hours()/24)),
+		})
+		return
+	}
+
+	createdBy := auth.Describe(r.Context())
+	plain, key, err := Auth.MintKey(request.Name, ttl, createdBy)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to mint API key: %v", err),
+		})
+		return
+	}
+
+	logger.LogSuccess("System", "Auth", fmt.Sprintf("%s minted dashboard API key %s (%s) expiring %s",
+		createdBy, key.Name, key.ID, key.ExpiresAt.Format(time.RFC3339)))
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Minted API key %s; store it now, it is not shown again", key.Name),
+		Data: struct {
+			apiKeyView
+			Key string `json:"key"`
+		}{newAPIKeyView(key), plain},
+	})
+}
+
+// HandleAPIRevokeAPIKey Handles DELETE /api/auth/keys/{id}
+func HandleAPIRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	revokedBy := auth.Describe(r.Context())
+	key, err := Auth.RevokeKey(id, revokedBy)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	logger.LogWarning("System", "Auth", fmt.Sprintf("%s revoked API key %s (%s)", revokedBy, key.Name, key.ID))
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Revoked API key %s", key.Name),
+		Data:    newAPIKeyView(key),
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"vuDataSim/src/availability"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// availabilityWindows are summarized in every availability response
+var availabilityWindows = []string{"24h", "7d", "30d"}
+
+// HandleAPIGetNodeAvailability Handles GET /api/nodes/{name}/availability?window=7d
+// Availability is derived from the node's metric reports; a node counts as down once
+// its last report is older than metrics.stale_after_seconds.
+func HandleAPIGetNodeAvailability(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+	if _, exists := NodeManager.GetNodes()[nodeName]; !exists {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s not found", nodeName),
+		})
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	duration, err := Availability.ParseWindow(window)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	now := timeutil.Now()
+	gap := Staleness.Threshold()
+	report := Availability.Report(nodeName, window, duration, now, gap)
+
+	summaries := make(map[string]*float64, len(availabilityWindows))
+	for _, name := range availabilityWindows {
+		if d, err := Availability.ParseWindow(name); err == nil {
+			summaries[name] = Availability.Report(nodeName, name, d, now, gap).AvailabilityPct
+		}
+	}
+
+	message := fmt.Sprintf("Node %s has no recorded heartbeats", nodeName)
+	if report.AvailabilityPct != nil {
+		message = fmt.Sprintf("Node %s was available %.2f%% of the last %s with %d incidents", nodeName, *report.AvailabilityPct, window, len(report.Incidents))
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data: struct {
+			availability.Report
+			Windows map[string]*float64 `json:"windows"`
+		}{report, summaries},
+	}, fmt.Sprintf("node_%s_availability", nodeName))
+}
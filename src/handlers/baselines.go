@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/runs"
+
+	"github.com/gorilla/mux"
+)
+
+// summarizeRunMetrics reduces the ClickHouse metrics of a run window to the summary
+// metrics compared against baselines. Rates use the latest sample per topic or client.
+func summarizeRunMetrics(run *runs.Run, metrics *clickhouse.ClickHouseMetrics) map[string]float64 {
+	summary := make(map[string]float64)
+
+	latestTopic := make(map[string]clickhouse.KafkaTopicMetric)
+	for _, m := range metrics.KafkaTopicMetrics {
+		if current, ok := latestTopic[m.Topic]; !ok || m.Timestamp.After(current.Timestamp) {
+			latestTopic[m.Topic] = m
+		}
+	}
+	if len(latestTopic) > 0 {
+		ingest := 0.0
+		for _, m := range latestTopic {
+			ingest += m.OneMinuteRate
+		}
+		summary[runs.MetricIngestEPS] = ingest
+		if run.TargetEPS > 0 {
+			summary[runs.MetricTargetAttainment] = ingest / float64(run.TargetEPS) * 100
+		}
+		if run.TargetKafka > 0 {
+			summary[runs.MetricKafkaAttainment] = ingest / float64(run.TargetKafka) * 100
+		}
+	}
+
+	if rate, ok := Watchdog.ClickHouseRowRate(run.ID); ok {
+		summary[runs.MetricClickHouseRowsPerSec] = rate
+		if run.TargetClickHouse > 0 {
+			summary[runs.MetricClickHouseAttainment] = rate / float64(run.TargetClickHouse) * 100
+		}
+	}
+
+	if capacity, ok := Adaptive.Capacity(run.ID); ok {
+		summary[runs.MetricCapacityEPS] = float64(capacity)
+	}
+
+	latestProducer := make(map[string]clickhouse.KafkaProducerMetric)
+	for _, m := range metrics.KafkaProducerMetrics {
+		key := m.ClientID + "/" + m.Topic
+		if current, ok := latestProducer[key]; !ok || m.Timestamp.After(current.Timestamp) {
+			latestProducer[key] = m
+		}
+	}
+	if len(latestProducer) > 0 {
+		sendRate, errorRate := 0.0, 0.0
+		for _, m := range latestProducer {
+			sendRate += m.RecordSendRate
+			errorRate += m.RecordErrorRate
+		}
+		summary[runs.MetricProducerSendRate] = sendRate
+		summary[runs.MetricProducerErrorRate] = errorRate
+	}
+
+	if len(metrics.SystemMetrics) > 0 {
+		cpu, memory := 0.0, 0.0
+		for _, m := range metrics.SystemMetrics {
+			cpu += m.CPUUsage
+			memory += m.MemoryUsage
+		}
+		summary[runs.MetricAvgCPUUsage] = cpu / float64(len(metrics.SystemMetrics))
+		summary[runs.MetricAvgMemoryUsage] = memory / float64(len(metrics.SystemMetrics))
+	}
+
+	if len(metrics.PodResourceMetrics) > 0 {
+		peak := 0.0
+		for _, m := range metrics.PodResourceMetrics {
+			if m.MemoryPercentage > peak {
+				peak = m.MemoryPercentage
+			}
+		}
+		summary[runs.MetricMaxPodMemoryPct] = peak
+	}
+	return summary
+}
+
+// recordRunSummary stores the summary of a finished run and, if its scenario has a
+// baseline, the regression verdict, which is also added to the timeline and broadcast
+func recordRunSummary(run *runs.Run, summary map[string]float64) *runs.Comparison {
+	if err := RunStore.SetSummary(run.ID, summary); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to store summary of run %s: %v", run.ID, err))
+		return nil
+	}
+	run.Summary = summary
+
+	comparison, err := compareWithBaseline(run)
+	if err != nil || comparison == nil {
+		return nil
+	}
+	if err := RunStore.SetComparison(run.ID, comparison); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to store regression verdict of run %s: %v", run.ID, err))
+	}
+
+	message := fmt.Sprintf("Regression check against baseline %s: %s", comparison.BaselineRunID, comparison.Verdict)
+	if len(comparison.Regressions) > 0 {
+		message = fmt.Sprintf("%s (%v regressed)", message, comparison.Regressions)
+	}
+	RunStore.AddTimelineEvent(run.ID, "regression_check", message, map[string]interface{}{
+		"verdict":       comparison.Verdict,
+		"baselineRunId": comparison.BaselineRunID,
+		"regressions":   comparison.Regressions,
+	})
+	AppState.BroadcastEvent("run_regression_verdict", map[string]interface{}{
+		"runId":      run.ID,
+		"comparison": comparison,
+	})
+
+	if comparison.Verdict == runs.VerdictFail {
+		logger.LogError("System", "Runs", fmt.Sprintf("Run %s regressed against baseline %s: %v", run.ID, comparison.BaselineRunID, comparison.Regressions))
+	} else {
+		logger.LogWithNode("System", "Runs", fmt.Sprintf("Run %s: %s", run.ID, message), "info")
+	}
+	return comparison
+}
+
+// compareWithBaseline compares a run with the baseline of its scenario; it returns nil
+// if no baseline is pinned or the run is the baseline itself
+func compareWithBaseline(run *runs.Run) (*runs.Comparison, error) {
+	baseline, ok := RunStore.GetBaseline(run.ScenarioName())
+	if !ok || baseline.RunID == run.ID {
+		return nil, nil
+	}
+	baselineRun, ok := RunStore.GetRun(baseline.RunID)
+	if !ok {
+		return nil, fmt.Errorf("baseline run %s not found", baseline.RunID)
+	}
+	return runs.Compare(baselineRun, run, RunStore.RegressionTolerances(baseline)), nil
+}
+
+// HandleAPIGetBaselines Handles GET /api/baselines
+func HandleAPIGetBaselines(w http.ResponseWriter, r *http.Request) {
+	baselines, err := RunStore.Baselines()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d baselines", len(baselines)),
+		Data: map[string]interface{}{
+			"baselines":  baselines,
+			"tolerances": RunStore.RegressionTolerances(nil),
+		},
+	}, "baselines")
+}
+
+// HandleAPIPinBaseline Handles POST /api/runs/{id}/baseline
+// Pins a finished run as the baseline of its scenario. Optional body:
+// {"tolerances": {"ingest_eps": 5}} overrides the configured tolerances (percent).
+func HandleAPIPinBaseline(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+
+	var request struct {
+		Tolerances map[string]float64 `json:"tolerances"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	baseline, err := RunStore.PinBaseline(runID, auth.Describe(r.Context()), request.Tolerances)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	logger.LogWithNode("System", "Runs", fmt.Sprintf("Run %s pinned as baseline of scenario %s by %s", runID, baseline.Scenario, baseline.PinnedBy), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Run %s is now the baseline of scenario %s", runID, baseline.Scenario),
+		Data:    baseline,
+	})
+}
+
+// HandleAPIUnpinBaseline Handles DELETE /api/baselines/{scenario}
+func HandleAPIUnpinBaseline(w http.ResponseWriter, r *http.Request) {
+	scenario := mux.Vars(r)["scenario"]
+	if err := RunStore.UnpinBaseline(scenario); err != nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Baseline of scenario %s removed", scenario),
+	})
+}
+
+// HandleAPIGetRunComparison Handles GET /api/runs/{id}/comparison
+// Compares a run with the baseline of its scenario, or with ?baseline=<run id>
+func HandleAPIGetRunComparison(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	if len(run.Summary) == 0 {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s has no summary metrics yet", runID),
+		})
+		return
+	}
+
+	var comparison *runs.Comparison
+	if baselineID := r.URL.Query().Get("baseline"); baselineID != "" {
+		baselineRun, ok := RunStore.GetRun(baselineID)
+		if !ok {
+			SendJSONResponse(w, http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("baseline run %s not found", baselineID),
+			})
+			return
+		}
+		comparison = runs.Compare(baselineRun, run, RunStore.RegressionTolerances(nil))
+	} else {
+		var err error
+		comparison, err = compareWithBaseline(run)
+		if err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		if comparison == nil {
+			SendJSONResponse(w, http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("No other baseline pinned for scenario %s", run.ScenarioName()),
+			})
+			return
+		}
+	}
+
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Verdict against %s: %s", comparison.BaselineRunID, comparison.Verdict),
+		Data:    comparison,
+	}, fmt.Sprintf("run_%s_comparison", runID))
+}
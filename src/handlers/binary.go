@@ -3,13 +3,27 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"vuDataSim/src/bin_control"
 
 	"github.com/gorilla/mux"
 )
 
+// HandleAPIGetAllBinaryStatus Handles GET /api/binary/status[?generator=name][&refresh=true]
+// Without a generator, or with finalvudatasim, reports the simulator on every enabled
+// node from the background poller's cache, or checked live with refresh=true; otherwise
+// the generator on the enabled nodes it is assigned to
 func HandleAPIGetAllBinaryStatus(w http.ResponseWriter, r *http.Request) {
-	response, err := BinaryControl.GetAllBinaryStatuses()
+	var response *bin_control.BinaryControlResponse
+	var err error
+	if generator := r.URL.Query().Get("generator"); !bin_control.IsSimulator(generator) {
+		response, err = BinaryControl.GetAllGeneratorStatuses(generator)
+	} else if r.URL.Query().Get("refresh") == "true" {
+		response, err = BinaryControl.GetAllBinaryStatuses()
+	} else {
+		response, err = BinaryControl.CachedBinaryStatuses()
+	}
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -26,6 +40,13 @@ func HandleAPIGetAllBinaryStatus(w http.ResponseWriter, r *http.Request) {
 	SendJSONResponse(w, http.StatusOK, apiResponse)
 }
 
+// BroadcastBinaryStatusChange pushes a node's simulator going between running, stopped
+// and error to WebSocket clients as a binary_status_changed event
+func BroadcastBinaryStatusChange(change bin_control.BinaryStatusChange) {
+	go AppState.BroadcastEvent("binary_status_changed", change)
+}
+
+// HandleAPIGetBinaryStatus Handles GET /api/binary/status/{node}[?generator=name]
 func HandleAPIGetBinaryStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	nodeName := vars["node"]
@@ -38,7 +59,13 @@ func HandleAPIGetBinaryStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	status, err := BinaryControl.GetBinaryStatus(nodeName)
+	var status *bin_control.BinaryStatus
+	var err error
+	if generator := r.URL.Query().Get("generator"); bin_control.IsSimulator(generator) {
+		status, err = BinaryControl.GetBinaryStatus(nodeName)
+	} else {
+		status, err = BinaryControl.GetGeneratorStatus(nodeName, generator)
+	}
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -53,7 +80,7 @@ func HandleAPIGetBinaryStatus(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleAPIStartBinary handles POST /api/binary/start/{node}
+// handleAPIStartBinary handles POST /api/binary/start/{node}[?generator=name]
 func HandleAPIStartBinary(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	nodeName := vars["node"]
@@ -74,11 +101,23 @@ func HandleAPIStartBinary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	response, err := BinaryControl.StartBinary(nodeName, timeout)
+	var response *bin_control.BinaryControlResponse
+	var err error
+	if generator := r.URL.Query().Get("generator"); bin_control.IsSimulator(generator) {
+		response, err = BinaryControl.StartBinary(nodeName, timeout)
+	} else {
+		response, err = BinaryControl.StartGenerator(nodeName, generator, timeout)
+	}
 	if err != nil {
+		// Data carries the start verification checks and diagnostics, if any
+		var data interface{}
+		if response != nil {
+			data = response.Data
+		}
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: fmt.Sprintf("Failed to start binary on node %s: %v", nodeName, err),
+			Data:    data,
 		})
 		return
 	}
@@ -100,7 +139,28 @@ func HandleAPIStartBinary(w http.ResponseWriter, r *http.Request) {
 	SendJSONResponse(w, statusCode, apiResponse)
 }
 
-// handleAPIStopBinary handles POST /api/binary/stop/{node}
+// parseStopOptions reads ?mode=graceful|force and ?gracefulTimeout= (seconds), which
+// override the stop_mode and graceful_shutdown_timeout cluster settings for one stop
+func parseStopOptions(query url.Values) (bin_control.StopOptions, error) {
+	options := bin_control.StopOptions{Mode: query.Get("mode")}
+	if !bin_control.ValidStopMode(options.Mode) {
+		return options, fmt.Errorf("mode must be %s or %s", bin_control.StopModeGraceful, bin_control.StopModeForce)
+	}
+	if value := query.Get("gracefulTimeout"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return options, fmt.Errorf("gracefulTimeout must be a positive number of seconds")
+		}
+		options.GracefulTimeoutSeconds = parsed
+	}
+	return options, nil
+}
+
+// HandleAPIStopBinary Handles POST /api/binary/stop/{node}[?mode=graceful|force][&gracefulTimeout=10]
+// With ?dryRun=true nothing is killed: the response lists the PIDs, child processes and
+// scheduled kill timers the stop would affect and the commands it would run.
+// With ?generator=name the generator's stop command runs instead; the stop options and
+// dry runs apply to finalvudatasim only.
 func HandleAPIStopBinary(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	nodeName := vars["node"]
@@ -121,11 +181,51 @@ func HandleAPIStopBinary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	response, err := BinaryControl.StopBinary(nodeName, timeout)
+	query := r.URL.Query()
+	if generator := query.Get("generator"); !bin_control.IsSimulator(generator) {
+		if query.Get("mode") != "" || query.Get("gracefulTimeout") != "" || query.Get("dryRun") != "" {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "mode, gracefulTimeout and dryRun apply to finalvudatasim only",
+			})
+			return
+		}
+		handleStopGenerator(w, nodeName, generator)
+		return
+	}
+
+	options, err := parseStopOptions(query)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("dryRun") == "true" {
+		plan, err := BinaryControl.PlanStop(nodeName, options)
+		if err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to plan the stop on node %s: %v", nodeName, err),
+			})
+			return
+		}
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Dry run: %d actions on node %s, nothing was executed", len(plan.Actions), nodeName),
+			Data:    plan,
+		})
+		return
+	}
+
+	response, err := BinaryControl.StopBinaryWith(nodeName, timeout, options)
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: fmt.Sprintf("Failed to stop binary on node %s: %v", nodeName, err),
+			Data:    response.Data,
 		})
 		return
 	}
@@ -146,3 +246,28 @@ func HandleAPIStopBinary(w http.ResponseWriter, r *http.Request) {
 	}
 	SendJSONResponse(w, statusCode, apiResponse)
 }
+
+// handleStopGenerator stops a generator other than finalvudatasim on a node
+func handleStopGenerator(w http.ResponseWriter, nodeName, generator string) {
+	response, err := BinaryControl.StopGenerator(nodeName, generator)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to stop %s on node %s: %v", generator, nodeName, err),
+			Data:    response.Data,
+		})
+		return
+	}
+
+	statusCode := http.StatusOK
+	if data, ok := response.Data.(map[string]interface{}); ok {
+		if _, hasWarning := data["warning"]; hasWarning {
+			statusCode = http.StatusAccepted // 202 for warnings
+		}
+	}
+	SendJSONResponse(w, statusCode, APIResponse{
+		Success: response.Success,
+		Message: response.Message,
+		Data:    response.Data,
+	})
+}
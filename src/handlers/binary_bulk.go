@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bulkBinaryWriteTimeout bounds a start-all or stop-all response, which waits for every
+// node's start verification or graceful stop
+const bulkBinaryWriteTimeout = 10 * time.Minute
+
+// Outcomes of a node in a start-all or stop-all
+const (
+	BulkBinaryStarted        = "started"
+	BulkBinaryStopped        = "stopped"
+	BulkBinaryAlreadyRunning = "already_running"
+	BulkBinaryNotRunning     = "not_running"
+	BulkBinaryFailed         = "failed"
+)
+
+// BinaryBulkConfig holds the binary_bulk section of config.yaml
+type BinaryBulkConfig struct {
+	MaxParallel int `yaml:"max_parallel" json:"maxParallel"` // nodes started or stopped at once
+}
+
+// BinaryBulkRunner starts or stops the binary on many nodes at once and waits for all of
+// them, unlike the staggered fleet start which queues a job
+type BinaryBulkRunner struct {
+	mutex  sync.Mutex
+	config BinaryBulkConfig
+}
+
+var BinaryBulk = &BinaryBulkRunner{config: defaultBinaryBulkConfig()}
+
+func defaultBinaryBulkConfig() BinaryBulkConfig {
+	return BinaryBulkConfig{MaxParallel: 10}
+}
+
+// LoadConfig reads the binary_bulk section from the application config file
+func (b *BinaryBulkRunner) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultBinaryBulkConfig()
+	fileConfig := struct {
+		BinaryBulk *BinaryBulkConfig `yaml:"binary_bulk"`
+	}{BinaryBulk: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.MaxParallel <= 0 {
+		return fmt.Errorf("binary_bulk.max_parallel must be positive")
+	}
+
+	b.mutex.Lock()
+	b.config = config
+	b.mutex.Unlock()
+	return nil
+}
+
+// Config returns the bulk start and stop settings
+func (b *BinaryBulkRunner) Config() BinaryBulkConfig {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.config
+}
+
+// BulkBinaryResult is the outcome of a start-all or stop-all on one node
+type BulkBinaryResult struct {
+	Node       string      `json:"node"`
+	Success    bool        `json:"success"`
+	Outcome    string      `json:"outcome"`
+	PID        int         `json:"pid,omitempty"`
+	Message    string      `json:"message"`
+	DurationMs int64       `json:"durationMs"`
+	Data       interface{} `json:"data,omitempty"` // start verification or stop escalation
+}
+
+// BulkBinaryReport is the response of a start-all or stop-all
+type BulkBinaryReport struct {
+	Action      string             `json:"action"`
+	Parallelism int                `json:"parallelism"`
+	Total       int                `json:"total"`
+	Succeeded   int                `json:"succeeded"` // including nodes already in the wanted state
+	Failed      int                `json:"failed"`
+	DurationMs  int64              `json:"durationMs"`
+	Results     []BulkBinaryResult `json:"results"` // in node name order
+}
+
+// Run calls action on every node, at most parallelism at a time, and collects the results
+func (b *BinaryBulkRunner) Run(name string, nodes []string, parallelism int, action func(node string) BulkBinaryResult) *BulkBinaryReport {
+	report := &BulkBinaryReport{Action: name, Parallelism: parallelism, Total: len(nodes), Results: make([]BulkBinaryResult, len(nodes))}
+	start := time.Now()
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			nodeStart := time.Now()
+			result := action(node)
+			result.Node = node
+			result.DurationMs = time.Since(nodeStart).Milliseconds()
+			report.Results[i] = result
+		}(i, node)
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Success {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	report.DurationMs = time.Since(start).Milliseconds()
+	return report
+}
+
+// startNode starts the binary on a node unless it is already running
+func startNode(node string, timeout int) BulkBinaryResult {
+	if status, err := BinaryControl.GetBinaryStatus(node); err == nil && status.Status == "running" {
+		return BulkBinaryResult{
+			Success: true,
+			Outcome: BulkBinaryAlreadyRunning,
+			PID:     status.PID,
+			Message: fmt.Sprintf("Binary already running on node %s (PID %d)", node, status.PID),
+		}
+	}
+	response, err := BinaryControl.StartBinary(node, timeout)
+	return bulkResult(response, err, BulkBinaryStarted)
+}
+
+// stopNode stops the binary on a node unless it is not running
+func stopNode(node string, timeout int, options bin_control.StopOptions) BulkBinaryResult {
+	if status, err := BinaryControl.GetBinaryStatus(node); err == nil && status.Status != "running" {
+		return BulkBinaryResult{
+			Success: true,
+			Outcome: BulkBinaryNotRunning,
+			Message: fmt.Sprintf("Binary not running on node %s", node),
+		}
+	}
+	response, err := BinaryControl.StopBinaryWith(node, timeout, options)
+	return bulkResult(response, err, BulkBinaryStopped)
+}
+
+// bulkResult turns the response of a single start or stop into a node result
+func bulkResult(response *bin_control.BinaryControlResponse, err error, outcome string) BulkBinaryResult {
+	result := BulkBinaryResult{Success: err == nil && response != nil && response.Success, Outcome: outcome}
+	if response != nil {
+		result.Message = response.Message
+		result.Data = response.Data
+		if data, ok := response.Data.(map[string]interface{}); ok {
+			if pid, ok := data["pid"].(int); ok {
+				result.PID = pid
+			}
+		}
+	}
+	if !result.Success {
+		result.Outcome = BulkBinaryFailed
+		if result.Message == "" && err != nil {
+			result.Message = err.Error()
+		}
+	}
+	return result
+}
+
+// parseBulkQuery reads ?parallelism= (default binary_bulk.max_parallel) and ?timeout= in
+// minutes (default 30, as for a single node)
+func parseBulkQuery(w http.ResponseWriter, r *http.Request) (parallelism, timeout int, ok bool) {
+	parallelism, timeout = BinaryBulk.Config().MaxParallel, 30
+	for name, target := range map[string]*int{"parallelism": &parallelism, "timeout": &timeout} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be a positive number", name),
+			})
+			return 0, 0, false
+		}
+		*target = parsed
+	}
+	return parallelism, timeout, true
+}
+
+// sendBulkReport answers 200 when every node succeeded, 206 when some did and 500 when
+// none did; the report lists every node either way
+func sendBulkReport(w http.ResponseWriter, report *BulkBinaryReport, verb string) {
+	statusCode := http.StatusOK
+	message := fmt.Sprintf("Binary %s on all %d nodes", verb, report.Total)
+	switch {
+	case report.Failed == report.Total:
+		statusCode = http.StatusInternalServerError
+		message = fmt.Sprintf("Binary could not be %s on any of the %d nodes", verb, report.Total)
+	case report.Failed > 0:
+		statusCode = http.StatusPartialContent // 206 for partial success
+		message = fmt.Sprintf("Binary %s on %d of %d nodes, %d failed", verb, report.Succeeded, report.Total, report.Failed)
+	}
+
+	if report.Failed > 0 {
+		logger.LogWarning("System", "Binary", message)
+	} else {
+		logger.LogSuccess("System", "Binary", message)
+	}
+	SendJSONResponse(w, statusCode, APIResponse{
+		Success: report.Failed == 0,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// HandleAPIStartAllBinaries Handles POST /api/binary/start-all
+// Starts the binary on every enabled node, or on ?nodes= (comma-separated), up to
+// ?parallelism= at once, and waits for all of them. Nodes where it already runs count as
+// succeeded. Optional ?timeout= in minutes stops each binary again (default 30).
+func HandleAPIStartAllBinaries(w http.ResponseWriter, r *http.Request) {
+	parallelism, timeout, ok := parseBulkQuery(w, r)
+	if !ok {
+		return
+	}
+	nodes, ok := selectFleetNodes(w, r.URL.Query().Get("nodes"), "start")
+	if !ok {
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(bulkBinaryWriteTimeout))
+	logger.LogWithNode("System", "Binary", fmt.Sprintf("Starting the binary on %d nodes, %d at a time", len(nodes), parallelism), "info")
+	report := BinaryBulk.Run("start", nodes, parallelism, func(node string) BulkBinaryResult {
+		return startNode(node, timeout)
+	})
+	sendBulkReport(w, report, "started")
+}
+
+// HandleAPIStopAllBinaries Handles POST /api/binary/stop-all
+// Stops the binary on every enabled node, or on ?nodes= (comma-separated), up to
+// ?parallelism= at once, and waits for all of them. Nodes where it is not running count
+// as succeeded. Takes ?mode= and ?gracefulTimeout= like a single stop.
+func HandleAPIStopAllBinaries(w http.ResponseWriter, r *http.Request) {
+	parallelism, timeout, ok := parseBulkQuery(w, r)
+	if !ok {
+		return
+	}
+	options, err := parseStopOptions(r.URL.Query())
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	nodes, ok := selectFleetNodes(w, r.URL.Query().Get("nodes"), "stop")
+	if !ok {
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(bulkBinaryWriteTimeout))
+	logger.LogWithNode("System", "Binary", fmt.Sprintf("Stopping the binary on %d nodes, %d at a time", len(nodes), parallelism), "info")
+	report := BinaryBulk.Run("stop", nodes, parallelism, func(node string) BulkBinaryResult {
+		return stopNode(node, timeout, options)
+	})
+	sendBulkReport(w, report, "stopped")
+}
@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// BootstrapTokenHeader carries the one-time token of a generated bootstrap script
+const BootstrapTokenHeader = "X-Bootstrap-Token"
+
+const (
+	defaultBootstrapTTLMinutes = 60
+	maxBootstrapTTLMinutes     = 24 * 60
+)
+
+var (
+	nodeNamePattern   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+	unixUserPattern   = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	remotePathPattern = regexp.MustCompile(`^/[a-zA-Z0-9._/-]*$`)
+)
+
+// bootstrapFiles are the artifacts a bootstrapping node may download
+var bootstrapFiles = map[string]string{
+	"finalvudatasim":   node_control.LocalMainBinary,
+	"node_metrics_api": node_control.LocalMetricsBinary,
+	"conf.d.tar.gz":    node_control.LocalConfDir,
+}
+
+// bootstrapToken is the state behind one generated script. Only the SHA-256 of the
+// token is kept; it allows downloads until it expires and a single registration.
+type bootstrapToken struct {
+	NodeName  string // empty lets the node pick its own name
+	User      string
+	KeyPath   string
+	ConfDir   string
+	BinaryDir string
+	Enabled   bool
+	CreatedBy string
+	ExpiresAt time.Time
+	Used      bool
+}
+
+var bootstrapTokens = struct {
+	sync.Mutex
+	tokens map[string]*bootstrapToken
+}{tokens: make(map[string]*bootstrapToken)}
+
+// issueBootstrapToken stores the script settings and returns the plain token
+func issueBootstrapToken(settings bootstrapToken) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	bootstrapTokens.Lock()
+	defer bootstrapTokens.Unlock()
+	now := time.Now()
+	for hash, existing := range bootstrapTokens.tokens {
+		if now.After(existing.ExpiresAt) {
+			delete(bootstrapTokens.tokens, hash)
+		}
+	}
+	bootstrapTokens.tokens[auth.HashKey(token)] = &settings
+	return token, nil
+}
+
+// lookupBootstrapToken returns a copy of the settings of a valid, unused token
+func lookupBootstrapToken(r *http.Request) (*bootstrapToken, error) {
+	token := strings.TrimSpace(r.Header.Get(BootstrapTokenHeader))
+	if token == "" {
+		return nil, fmt.Errorf("missing %s header", BootstrapTokenHeader)
+	}
+
+	bootstrapTokens.Lock()
+	defer bootstrapTokens.Unlock()
+	settings, ok := bootstrapTokens.tokens[auth.HashKey(token)]
+	if !ok || time.Now().After(settings.ExpiresAt) {
+		return nil, fmt.Errorf("invalid or expired bootstrap token")
+	}
+	if settings.Used {
+		return nil, fmt.Errorf("bootstrap token was already used to register a node")
+	}
+	copied := *settings
+	return &copied, nil
+}
+
+// consumeBootstrapToken marks a token used; it returns false if another node won the race
+func consumeBootstrapToken(r *http.Request) bool {
+	bootstrapTokens.Lock()
+	defer bootstrapTokens.Unlock()
+	settings, ok := bootstrapTokens.tokens[auth.HashKey(strings.TrimSpace(r.Header.Get(BootstrapTokenHeader)))]
+	if !ok || settings.Used {
+		return false
+	}
+	settings.Used = true
+	return true
+}
+
+func releaseBootstrapToken(r *http.Request) {
+	bootstrapTokens.Lock()
+	defer bootstrapTokens.Unlock()
+	if settings, ok := bootstrapTokens.tokens[auth.HashKey(strings.TrimSpace(r.Header.Get(BootstrapTokenHeader)))]; ok {
+		settings.Used = false
+	}
+}
+
+// managerURL returns the manager's base URL as seen by the caller
+func managerURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	return scheme + "://" + host
+}
+
+// managerPublicKey reads the public half of the SSH key the manager uses for a node
+func managerPublicKey(keyPath string) (string, error) {
+	if strings.HasPrefix(keyPath, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		keyPath = filepath.Join(home, keyPath[2:])
+	}
+	data, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+var bootstrapScriptTemplate = template.Must(template.New("bootstrap").Funcs(template.FuncMap{"q": remotecmd.Quote}).Parse(`#!/usr/bin/env bash
+# vuDataSim node bootstrap script
+# Generated {{.GeneratedAt}} by {{.CreatedBy}}; the token expires {{.ExpiresAt}} and registers one node.
+# Run on the new VM as root or as the node user (with sudo for packages):
+#   NODE_NAME=<name> NODE_HOST=<reachable ip> bash bootstrap.sh
+set -euo pipefail
+
+MANAGER_URL={{q .ManagerURL}}
+BOOTSTRAP_TOKEN={{q .Token}}
+NODE_NAME="${NODE_NAME:-{{if .NodeName}}{{.NodeName}}{{else}}$(hostname -s){{end}}}"
+NODE_USER={{q .User}}
+CONF_DIR={{q .ConfDir}}
+BINARY_DIR={{q .BinaryDir}}
+MANAGER_PUBLIC_KEY={{q .PublicKey}}
+
+log() { echo "[bootstrap] $*"; }
+fail() { echo "[bootstrap] ERROR: $*" >&2; exit 1; }
+
+SUDO=""
+if [ "$(id -u)" -ne 0 ]; then
+  [ "$(id -un)" = "$NODE_USER" ] || fail "run as root or as $NODE_USER"
+  SUDO="sudo -n"
+fi
+
+log "Installing dependencies"
+missing=""
+for cmd in curl tar gzip ip tc pgrep; do
+  command -v "$cmd" >/dev/null 2>&1 || missing="$missing $cmd"
+done
+if [ -n "$missing" ]; then
+  if command -v apt-get >/dev/null 2>&1; then
+    $SUDO apt-get update -qq && $SUDO apt-get install -y -qq curl tar gzip iproute2 procps
+  elif command -v dnf >/dev/null 2>&1; then
+    $SUDO dnf install -y -q curl tar gzip iproute iproute-tc procps-ng
+  elif command -v yum >/dev/null 2>&1; then
+    $SUDO yum install -y -q curl tar gzip iproute procps-ng
+  else
+    fail "missing commands:$missing and no supported package manager"
+  fi
+fi
+
+if ! id "$NODE_USER" >/dev/null 2>&1; then
+  log "Creating user $NODE_USER"
+  $SUDO useradd -m -s /bin/bash "$NODE_USER"
+fi
+NODE_HOME="$(getent passwd "$NODE_USER" | cut -d: -f6)"
+
+log "Creating $CONF_DIR and $BINARY_DIR"
+$SUDO mkdir -p "$CONF_DIR" "$BINARY_DIR"
+
+if [ -n "$MANAGER_PUBLIC_KEY" ]; then
+  log "Authorizing the manager's SSH key for $NODE_USER"
+  $SUDO mkdir -p "$NODE_HOME/.ssh"
+  if ! $SUDO grep -qF "$MANAGER_PUBLIC_KEY" "$NODE_HOME/.ssh/authorized_keys" 2>/dev/null; then
+    echo "$MANAGER_PUBLIC_KEY" | $SUDO tee -a "$NODE_HOME/.ssh/authorized_keys" >/dev/null
+  fi
+  $SUDO chmod 700 "$NODE_HOME/.ssh"
+  $SUDO chmod 600 "$NODE_HOME/.ssh/authorized_keys"
+  $SUDO chown -R "$NODE_USER:" "$NODE_HOME/.ssh"
+else
+  log "WARNING: manager public key not available; add it to $NODE_HOME/.ssh/authorized_keys manually"
+fi
+
+fetch() {
+  curl -fsS --retry 3 -H "{{.TokenHeader}}: $BOOTSTRAP_TOKEN" "$MANAGER_URL/api/{{.APIVersion}}/nodes/bootstrap/files/$1" -o "$2"
+}
+
+log "Fetching binaries from $MANAGER_URL"
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+fetch finalvudatasim "$tmp/finalvudatasim"
+fetch node_metrics_api "$tmp/node_metrics_api"
+fetch conf.d.tar.gz "$tmp/conf.d.tar.gz"
+$SUDO install -m 0755 "$tmp/finalvudatasim" "$tmp/node_metrics_api" "$BINARY_DIR/"
+$SUDO tar -xzf "$tmp/conf.d.tar.gz" -C "$CONF_DIR"
+$SUDO chown -R "$NODE_USER:" "$CONF_DIR" "$BINARY_DIR"
+
+if [ -z "${NODE_HOST:-}" ]; then
+  NODE_HOST="$(ip -4 route get 1.1.1.1 2>/dev/null | awk '{for (i = 1; i < NF; i++) if ($i == "src") { print $(i + 1); exit }}')"
+  [ -n "$NODE_HOST" ] || NODE_HOST="$(hostname -I | awk '{print $1}')"
+fi
+
+log "Registering node $NODE_NAME ($NODE_HOST)"
+curl -fsS --retry 3 -X POST -H "{{.TokenHeader}}: $BOOTSTRAP_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"name\":\"$NODE_NAME\",\"host\":\"$NODE_HOST\"}" \
+  "$MANAGER_URL/api/{{.APIVersion}}/nodes/bootstrap/register"
+echo
+log "Done"
+`))
+
+// HandleAPIGetBootstrapScript Handles GET /api/nodes/bootstrap-script
+// Emits a shell script that prepares a fresh VM and registers it as a node. Query
+// parameters: name, user, key_path, conf_dir, binary_dir, enabled, ttl (minutes),
+// manager_url (defaults to the URL the request was made to).
+func HandleAPIGetBootstrapScript(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	settings := bootstrapToken{
+		NodeName:  query.Get("name"),
+		User:      query.Get("user"),
+		KeyPath:   query.Get("key_path"),
+		ConfDir:   query.Get("conf_dir"),
+		BinaryDir: query.Get("binary_dir"),
+		Enabled:   query.Get("enabled") != "false",
+		CreatedBy: auth.Describe(r.Context()),
+	}
+	if settings.User == "" {
+		settings.User = "vunet"
+	}
+	if settings.KeyPath == "" {
+		settings.KeyPath = "~/.ssh/id_rsa"
+	}
+	if settings.ConfDir == "" {
+		settings.ConfDir = fmt.Sprintf("/home/%s/vuDataSim", settings.User)
+	}
+	if settings.BinaryDir == "" {
+		settings.BinaryDir = settings.ConfDir + "/bin"
+	}
+
+	ttl := defaultBootstrapTTLMinutes
+	if ttlStr := query.Get("ttl"); ttlStr != "" {
+		parsed, err := strconv.Atoi(ttlStr)
+		if err != nil || parsed < 1 || parsed > maxBootstrapTTLMinutes {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("ttl must be between 1 and %d minutes", maxBootstrapTTLMinutes),
+			})
+			return
+		}
+		ttl = parsed
+	}
+
+	var problems []string
+	if settings.NodeName != "" && !nodeNamePattern.MatchString(settings.NodeName) {
+		problems = append(problems, "invalid name")
+	}
+	if !unixUserPattern.MatchString(settings.User) {
+		problems = append(problems, "invalid user")
+	}
+	if !remotePathPattern.MatchString(settings.ConfDir) || !remotePathPattern.MatchString(settings.BinaryDir) {
+		problems = append(problems, "conf_dir and binary_dir must be absolute paths")
+	}
+	if settings.NodeName != "" {
+		if _, exists := NodeManager.GetNodes()[settings.NodeName]; exists {
+			problems = append(problems, fmt.Sprintf("node %s already exists", settings.NodeName))
+		}
+	}
+	if len(problems) > 0 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: strings.Join(problems, "; "),
+		})
+		return
+	}
+
+	publicKey, err := managerPublicKey(settings.KeyPath)
+	if err != nil {
+		logger.LogWarning("System", "Bootstrap", fmt.Sprintf("Manager public key %s.pub not readable, script will not authorize it: %v", settings.KeyPath, err))
+	}
+
+	baseURL := query.Get("manager_url")
+	if baseURL == "" {
+		baseURL = managerURL(r)
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	settings.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Minute)
+	token, err := issueBootstrapToken(settings)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var script bytes.Buffer
+	err = bootstrapScriptTemplate.Execute(&script, map[string]string{
+		"GeneratedAt": timeutil.Format(timeutil.Now()),
+		"CreatedBy":   settings.CreatedBy,
+		"ExpiresAt":   timeutil.Format(settings.ExpiresAt),
+		"ManagerURL":  baseURL,
+		"Token":       token,
+		"TokenHeader": BootstrapTokenHeader,
+		"APIVersion":  "v1",
+		"NodeName":    settings.NodeName,
+		"User":        settings.User,
+		"ConfDir":     settings.ConfDir,
+		"BinaryDir":   settings.BinaryDir,
+		"PublicKey":   publicKey,
+	})
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to render script: %v", err),
+		})
+		return
+	}
+
+	logger.LogWithNode("System", "Bootstrap", fmt.Sprintf("Bootstrap script generated by %s (expires %s)", settings.CreatedBy, timeutil.Format(settings.ExpiresAt)), "info")
+	w.Header().Set(ContentTypeHeader, "text/x-shellscript")
+	w.Header().Set("Content-Disposition", `attachment; filename="bootstrap.sh"`)
+	w.Write(script.Bytes())
+}
+
+// HandleAPIBootstrapFile Handles GET /api/nodes/bootstrap/files/{file}
+// Authenticated with the bootstrap token instead of an API key
+func HandleAPIBootstrapFile(w http.ResponseWriter, r *http.Request) {
+	if _, err := lookupBootstrapToken(r); err != nil {
+		SendJSONResponse(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	file := mux.Vars(r)["file"]
+	localPath, ok := bootstrapFiles[file]
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown bootstrap file %s", file),
+		})
+		return
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s is not available on the manager", localPath),
+		})
+		return
+	}
+
+	if file != "conf.d.tar.gz" {
+		w.Header().Set(ContentTypeHeader, "application/octet-stream")
+		http.ServeFile(w, r, localPath)
+		return
+	}
+
+	output, err := exec.Command("tar", "-czf", "-", "-C", filepath.Dir(localPath), filepath.Base(localPath)).Output()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to archive conf.d: %v", err),
+		})
+		return
+	}
+	w.Header().Set(ContentTypeHeader, "application/gzip")
+	w.Write(output)
+}
+
+// HandleAPIBootstrapRegister Handles POST /api/nodes/bootstrap/register
+// Called by the bootstrap script once the node is prepared; consumes the token
+func HandleAPIBootstrapRegister(w http.ResponseWriter, r *http.Request) {
+	settings, err := lookupBootstrapToken(r)
+	if err != nil {
+		SendJSONResponse(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+		Host string `json:"host"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid JSON data",
+		})
+		return
+	}
+
+	name := request.Name
+	if settings.NodeName != "" {
+		name = settings.NodeName
+	}
+	if !nodeNamePattern.MatchString(name) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid node name %q", name),
+		})
+		return
+	}
+	host := request.Host
+	if host == "" {
+		// Fall back to the address the node called from
+		host, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	if net.ParseIP(host) == nil && !nodeNamePattern.MatchString(host) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid host %q", host),
+		})
+		return
+	}
+
+	if !consumeBootstrapToken(r) {
+		SendJSONResponse(w, http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "bootstrap token was already used to register a node",
+		})
+		return
+	}
+
+	err = NodeManager.RegisterNode(node_control.AddNodeRequest{
+		Name:        name,
+		Host:        host,
+		User:        settings.User,
+		KeyPath:     settings.KeyPath,
+		ConfDir:     settings.ConfDir,
+		BinaryDir:   settings.BinaryDir,
+		Description: fmt.Sprintf("Bootstrapped %s", timeutil.Format(timeutil.Now())),
+		Enabled:     settings.Enabled,
+	})
+	if err != nil {
+		// Let the operator retry with another name
+		releaseBootstrapToken(r)
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		logger.LogWarning(name, "Bootstrap", fmt.Sprintf("Failed to reload nodes for binary control: %v", err))
+	}
+
+	logger.LogSuccess(name, "Bootstrap", fmt.Sprintf("Node registered from %s via bootstrap script generated by %s", host, settings.CreatedBy))
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Node %s registered", name),
+		Data: map[string]interface{}{
+			"name":       name,
+			"host":       host,
+			"user":       settings.User,
+			"conf_dir":   settings.ConfDir,
+			"binary_dir": settings.BinaryDir,
+			"enabled":    settings.Enabled,
+		},
+	})
+}
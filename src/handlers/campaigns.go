@@ -0,0 +1,1252 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Campaign states
+const (
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused" // no further point starts until it is resumed
+	CampaignCompleted = "completed"
+	CampaignFailed    = "failed" // a point failed and stopOnFailure was set
+	CampaignCancelled = "cancelled"
+)
+
+// Campaign point states
+const (
+	CampaignPointPending   = "pending"
+	CampaignPointRunning   = "running"
+	CampaignPointCompleted = "completed"
+	CampaignPointFailed    = "failed"
+	CampaignPointCancelled = "cancelled" // stopped half way by a cancel
+	CampaignPointSkipped   = "skipped"   // never ran because the campaign ended first
+)
+
+// campaignReportMetrics are the run summary metrics compared in a campaign report
+var campaignReportMetrics = []string{
+	runs.MetricIngestEPS,
+	runs.MetricTargetAttainment,
+	runs.MetricClickHouseRowsPerSec,
+	runs.MetricProducerErrorRate,
+	runs.MetricAvgCPUUsage,
+	runs.MetricCapacityEPS,
+}
+
+// CampaignConfig holds the campaigns section of config.yaml
+type CampaignConfig struct {
+	File                string `yaml:"file" json:"file"`
+	MaxPoints           int    `yaml:"max_points" json:"maxPoints"`                      // runs one campaign may contain
+	BinaryMarginMinutes int    `yaml:"binary_margin_minutes" json:"binaryMarginMinutes"` // binaries stop on their own this long after a point's duration
+	WaitPollSeconds     int    `yaml:"wait_poll_seconds" json:"waitPollSeconds"`         // how often a waiting campaign checks whether it may start its next point
+}
+
+// CampaignRequest is the body of POST /api/campaigns. Its points are every source set
+// at every EPS value.
+type CampaignRequest struct {
+	Name            string     `json:"name"`
+	Profile         string     `json:"profile,omitempty"`    // recorded on every run, defaults to the name
+	Scenario        string     `json:"scenario,omitempty"`   // groups the runs for baseline comparison
+	EPS             []int      `json:"eps"`                  // cluster-wide target EPS values
+	SourceSets      [][]string `json:"sourceSets,omitempty"` // empty runs every point with the sources enabled at its start
+	DurationMinutes int        `json:"durationMinutes"`
+	CooldownMinutes int        `json:"cooldownMinutes,omitempty"` // gap between two points, 0 for back to back
+	StopOnFailure   bool       `json:"stopOnFailure,omitempty"`
+	SkipTableCheck  bool       `json:"skipTableCheck,omitempty"`
+	Workspace       string     `json:"workspace,omitempty"`
+}
+
+// CampaignPoint is one run of a campaign
+type CampaignPoint struct {
+	Index     int        `json:"index"`
+	TargetEPS int        `json:"targetEps"`
+	Sources   []string   `json:"sources,omitempty"` // empty for the sources enabled at its start
+	Status    string     `json:"status"`
+	RunID     string     `json:"runId,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// CampaignProgress is how far a campaign got
+type CampaignProgress struct {
+	Total      int        `json:"total"`
+	Completed  int        `json:"completed"`
+	Failed     int        `json:"failed"` // failed or cancelled
+	Skipped    int        `json:"skipped"`
+	Remaining  int        `json:"remaining"` // pending or running
+	Percent    float64    `json:"percent"`
+	Current    *int       `json:"current,omitempty"`    // index of the running point
+	EstimateAt *time.Time `json:"estimateAt,omitempty"` // when the last point should end, if nothing waits
+}
+
+// Campaign runs a matrix of simulation runs one after the other
+type Campaign struct {
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Profile         string           `json:"profile"`
+	Scenario        string           `json:"scenario,omitempty"`
+	EPS             []int            `json:"eps"`
+	SourceSets      [][]string       `json:"sourceSets,omitempty"`
+	DurationMinutes int              `json:"durationMinutes"`
+	CooldownMinutes int              `json:"cooldownMinutes"`
+	StopOnFailure   bool             `json:"stopOnFailure"`
+	Workspace       string           `json:"workspace,omitempty"`
+	Owner           runs.RunOwner    `json:"owner"`
+	Status          string           `json:"status"`
+	Message         string           `json:"message,omitempty"` // what the campaign is doing or why it ended
+	Points          []CampaignPoint  `json:"points"`
+	Progress        CampaignProgress `json:"progress"`
+	CreatedBy       string           `json:"createdBy,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedBy       string           `json:"updatedBy,omitempty"`   // who last paused, resumed or cancelled it
+	NextPointAt     *time.Time       `json:"nextPointAt,omitempty"` // end of the current cool-down
+	EndedAt         *time.Time       `json:"endedAt,omitempty"`
+}
+
+// CampaignReportCell is the outcome of one point in the report matrix
+type CampaignReportCell struct {
+	TargetEPS int                `json:"targetEps"`
+	Status    string             `json:"status"`
+	RunID     string             `json:"runId,omitempty"`
+	RunStatus string             `json:"runStatus,omitempty"`
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+}
+
+// CampaignReportRow is one source set across every EPS value
+type CampaignReportRow struct {
+	Label   string               `json:"label"`
+	Sources []string             `json:"sources,omitempty"`
+	Cells   []CampaignReportCell `json:"cells"`
+	// MaxSustainedEPS is the highest EPS whose run reached the attainment threshold
+	MaxSustainedEPS int `json:"maxSustainedEps"`
+}
+
+// CampaignReport compares the runs of a campaign: a row per source set, a column per EPS
+type CampaignReport struct {
+	CampaignID    string              `json:"campaignId"`
+	Name          string              `json:"name"`
+	Status        string              `json:"status"`
+	EPS           []int               `json:"eps"`
+	Metrics       []string            `json:"metrics"`
+	AttainmentPct float64             `json:"attainmentPct"` // threshold of maxSustainedEps
+	Rows          []CampaignReportRow `json:"rows"`
+	Progress      CampaignProgress    `json:"progress"`
+	GeneratedAt   time.Time           `json:"generatedAt"`
+}
+
+// campaignReportGridRow is a row of the single-metric view of a report, ?metric=. It is
+// encoded as the label followed by a key per EPS value in the campaign's order, null
+// where the point has no value.
+type campaignReportGridRow struct {
+	Label  string
+	EPS    []int
+	Values []*float64
+}
+
+func (row campaignReportGridRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	label, err := json.Marshal(row.Label)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`{"label":`)
+	buf.Write(label)
+	for i, eps := range row.EPS {
+		value, err := json.Marshal(row.Values[i])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, `,"%d":`, eps)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// CampaignManager keeps the campaigns on disk and runs at most one at a time
+type CampaignManager struct {
+	mutex     sync.Mutex
+	config    CampaignConfig
+	campaigns []*Campaign
+	runner    string        // campaign whose runner goroutine is active
+	interrupt chan struct{} // closed by a cancel to end the runner's current wait
+}
+
+var (
+	errCampaignNotFound = errors.New("campaign not found")
+	errCampaignConflict = errors.New("another campaign is running")
+)
+
+var Campaigns = &CampaignManager{config: defaultCampaignConfig()}
+
+func defaultCampaignConfig() CampaignConfig {
+	return CampaignConfig{
+		File:                "data/campaigns.json",
+		MaxPoints:           50,
+		BinaryMarginMinutes: 10,
+		WaitPollSeconds:     30,
+	}
+}
+
+// LoadConfig reads the campaigns section from the application config file and the
+// stored campaigns. A campaign that was running when the manager stopped is paused, and
+// the point it was running is failed, since nothing watched it to its end.
+func (cm *CampaignManager) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig struct {
+		Campaigns *CampaignConfig `yaml:"campaigns"`
+	}
+	config := defaultCampaignConfig()
+	fileConfig.Campaigns = &config
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	defaults := defaultCampaignConfig()
+	if config.File == "" {
+		config.File = defaults.File
+	}
+	if config.MaxPoints <= 0 {
+		config.MaxPoints = defaults.MaxPoints
+	}
+	if config.BinaryMarginMinutes < 0 {
+		config.BinaryMarginMinutes = 0
+	}
+	if config.WaitPollSeconds <= 0 {
+		config.WaitPollSeconds = defaults.WaitPollSeconds
+	}
+
+	var campaigns []*Campaign
+	data, err = os.ReadFile(config.File)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read campaigns: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &campaigns); err != nil {
+			return fmt.Errorf("failed to parse campaigns: %v", err)
+		}
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	if cm.runner != "" {
+		return fmt.Errorf("campaign %s is running, campaigns not reloaded", cm.runner)
+	}
+	cm.config = config
+	cm.campaigns = campaigns
+	interrupted := false
+	now := timeutil.Now()
+	for _, campaign := range campaigns {
+		if campaign.Status != CampaignRunning {
+			continue
+		}
+		interrupted = true
+		campaign.Status = CampaignPaused
+		campaign.Message = "Paused: the manager restarted while the campaign was running"
+		campaign.NextPointAt = nil
+		for i := range campaign.Points {
+			if point := &campaign.Points[i]; point.Status == CampaignPointRunning {
+				point.Status = CampaignPointFailed
+				point.Message = "The manager restarted during the run"
+				point.EndedAt = &now
+			}
+		}
+	}
+	if interrupted {
+		return cm.saveLocked()
+	}
+	return nil
+}
+
+// Config returns the campaign settings
+func (cm *CampaignManager) Config() CampaignConfig {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	return cm.config
+}
+
+// Create validates a campaign, stores it and starts running it
+func (cm *CampaignManager) Create(request CampaignRequest, identity *auth.Identity, by string, now time.Time) (Campaign, error) {
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		return Campaign{}, fmt.Errorf("name is required")
+	}
+	if len(request.EPS) == 0 {
+		return Campaign{}, fmt.Errorf("at least one EPS value is required")
+	}
+	seen := make(map[int]bool, len(request.EPS))
+	for _, eps := range request.EPS {
+		if eps < 1 || eps > 100000 {
+			return Campaign{}, fmt.Errorf("EPS %d must be between 1 and 100,000", eps)
+		}
+		if seen[eps] {
+			return Campaign{}, fmt.Errorf("EPS %d is listed twice", eps)
+		}
+		seen[eps] = true
+	}
+	if request.DurationMinutes <= 0 {
+		return Campaign{}, fmt.Errorf("durationMinutes must be positive, every point runs for a fixed time")
+	}
+	if request.CooldownMinutes < 0 {
+		return Campaign{}, fmt.Errorf("cooldownMinutes must not be negative")
+	}
+	sets := make([][]string, 0, len(request.SourceSets))
+	for i, set := range request.SourceSets {
+		if len(set) == 0 {
+			return Campaign{}, fmt.Errorf("source set %d is empty", i+1)
+		}
+		sources := append([]string(nil), set...)
+		sort.Strings(sources)
+		for j, source := range sources {
+			if !O11yManager.IsKnownSource(source) {
+				return Campaign{}, fmt.Errorf("unknown source %q in source set %d", source, i+1)
+			}
+			if j > 0 && sources[j-1] == source {
+				return Campaign{}, fmt.Errorf("source %s is listed twice in source set %d", source, i+1)
+			}
+		}
+		sets = append(sets, sources)
+	}
+	config := cm.Config()
+	rows := len(sets)
+	if rows == 0 {
+		rows = 1
+	}
+	if points := rows * len(request.EPS); points > config.MaxPoints {
+		return Campaign{}, fmt.Errorf("%d points exceed the limit of %d per campaign", points, config.MaxPoints)
+	}
+
+	maxEPS := 0
+	for _, eps := range request.EPS {
+		if eps > maxEPS {
+			maxEPS = eps
+		}
+	}
+	if violation := Quotas.CheckStart(identity, maxEPS, request.DurationMinutes); violation != nil {
+		return Campaign{}, fmt.Errorf("%s", violation.Message)
+	}
+	workspace, err := ReportStorage.WorkspaceFor(request.Workspace, identity)
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	profile := request.Profile
+	if profile == "" {
+		profile = request.Name
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	campaign := &Campaign{
+		ID:              "campaign-" + hex.EncodeToString(suffix),
+		Name:            request.Name,
+		Profile:         profile,
+		Scenario:        request.Scenario,
+		EPS:             append([]int(nil), request.EPS...),
+		SourceSets:      sets,
+		DurationMinutes: request.DurationMinutes,
+		CooldownMinutes: request.CooldownMinutes,
+		StopOnFailure:   request.StopOnFailure,
+		Workspace:       workspace,
+		Owner:           runOwner(identity),
+		Status:          CampaignRunning,
+		CreatedBy:       by,
+		CreatedAt:       now,
+	}
+	// Each source set climbs through the EPS values before the next set starts
+	if len(sets) == 0 {
+		sets = [][]string{nil}
+	}
+	for _, set := range sets {
+		for _, eps := range campaign.EPS {
+			campaign.Points = append(campaign.Points, CampaignPoint{
+				Index:     len(campaign.Points),
+				TargetEPS: eps,
+				Sources:   set,
+				Status:    CampaignPointPending,
+			})
+		}
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	if cm.runner != "" {
+		return Campaign{}, fmt.Errorf("%w: %s", errCampaignConflict, cm.runner)
+	}
+	cm.campaigns = append(cm.campaigns, campaign)
+	if err := cm.saveLocked(); err != nil {
+		cm.campaigns = cm.campaigns[:len(cm.campaigns)-1]
+		return Campaign{}, err
+	}
+	cm.startRunnerLocked(campaign.ID)
+	return cm.copyLocked(campaign, now), nil
+}
+
+// Pause stops a running campaign from starting further points. A point that is running
+// keeps running to its end.
+func (cm *CampaignManager) Pause(id, by string) (Campaign, error) {
+	return cm.change(id, func(campaign *Campaign) error {
+		if campaign.Status != CampaignRunning {
+			return fmt.Errorf("campaign %s is %s, only a running campaign can be paused", id, campaign.Status)
+		}
+		campaign.Status = CampaignPaused
+		campaign.Message = "Paused by " + by
+		if current := runningPoint(campaign); current != nil {
+			campaign.Message += fmt.Sprintf(", point %d finishes first", current.Index+1)
+		}
+		campaign.NextPointAt = nil
+		campaign.UpdatedBy = by
+		return nil
+	})
+}
+
+// Resume continues a paused campaign with its next pending point
+func (cm *CampaignManager) Resume(id, by string) (Campaign, error) {
+	return cm.change(id, func(campaign *Campaign) error {
+		if campaign.Status != CampaignPaused {
+			return fmt.Errorf("campaign %s is %s, only a paused campaign can be resumed", id, campaign.Status)
+		}
+		if cm.runner != "" && cm.runner != id {
+			return fmt.Errorf("%w: %s", errCampaignConflict, cm.runner)
+		}
+		campaign.Status = CampaignRunning
+		campaign.Message = "Resumed by " + by
+		campaign.UpdatedBy = by
+		if cm.runner == "" {
+			cm.startRunnerLocked(id)
+		}
+		return nil
+	})
+}
+
+// Cancel ends a campaign: its running point is stopped and the pending ones are skipped
+func (cm *CampaignManager) Cancel(id, by string) (Campaign, error) {
+	return cm.change(id, func(campaign *Campaign) error {
+		if campaign.Status != CampaignRunning && campaign.Status != CampaignPaused {
+			return fmt.Errorf("campaign %s already %s", id, campaign.Status)
+		}
+		now := timeutil.Now()
+		campaign.Status = CampaignCancelled
+		campaign.Message = "Cancelled by " + by
+		campaign.UpdatedBy = by
+		campaign.NextPointAt = nil
+		campaign.EndedAt = &now
+		skipPending(campaign, "The campaign was cancelled")
+		if cm.runner == id && cm.interrupt != nil {
+			close(cm.interrupt)
+			cm.interrupt = nil
+		}
+		return nil
+	})
+}
+
+// change applies fn to a campaign under the lock and saves it
+func (cm *CampaignManager) change(id string, fn func(campaign *Campaign) error) (Campaign, error) {
+	cm.mutex.Lock()
+	campaign := cm.findLocked(id)
+	if campaign == nil {
+		cm.mutex.Unlock()
+		return Campaign{}, errCampaignNotFound
+	}
+	previous := cloneCampaign(campaign)
+	if err := fn(campaign); err != nil {
+		cm.mutex.Unlock()
+		return Campaign{}, err
+	}
+	if err := cm.saveLocked(); err != nil {
+		*campaign = previous
+		cm.mutex.Unlock()
+		return Campaign{}, err
+	}
+	copied := cm.copyLocked(campaign, timeutil.Now())
+	cm.mutex.Unlock()
+
+	AppState.BroadcastEvent("campaign_updated", copied)
+	return copied, nil
+}
+
+// update applies fn to a campaign on behalf of its runner, saves and announces it
+func (cm *CampaignManager) update(id string, fn func(campaign *Campaign)) Campaign {
+	cm.mutex.Lock()
+	campaign := cm.findLocked(id)
+	if campaign == nil {
+		cm.mutex.Unlock()
+		return Campaign{}
+	}
+	fn(campaign)
+	if err := cm.saveLocked(); err != nil {
+		logger.Warn().Err(err).Str("campaign", id).Msg("Failed to save campaigns")
+	}
+	copied := cm.copyLocked(campaign, timeutil.Now())
+	cm.mutex.Unlock()
+
+	AppState.BroadcastEvent("campaign_updated", copied)
+	return copied
+}
+
+// List returns every campaign without its points, newest first
+func (cm *CampaignManager) List() []Campaign {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	now := timeutil.Now()
+	list := make([]Campaign, 0, len(cm.campaigns))
+	for _, campaign := range cm.campaigns {
+		copied := cm.copyLocked(campaign, now)
+		copied.Points = nil
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Get returns a campaign with its points
+func (cm *CampaignManager) Get(id string) (Campaign, bool) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	campaign := cm.findLocked(id)
+	if campaign == nil {
+		return Campaign{}, false
+	}
+	return cm.copyLocked(campaign, timeutil.Now()), true
+}
+
+// Report builds the comparative matrix of a campaign from the summaries of its runs. A
+// row's maxSustainedEps is the highest EPS whose run completed with at least
+// attainmentPct of its target.
+func (cm *CampaignManager) Report(id string, attainmentPct float64) (*CampaignReport, error) {
+	campaign, ok := cm.Get(id)
+	if !ok {
+		return nil, errCampaignNotFound
+	}
+
+	report := &CampaignReport{
+		CampaignID:    campaign.ID,
+		Name:          campaign.Name,
+		Status:        campaign.Status,
+		EPS:           campaign.EPS,
+		Metrics:       campaignReportMetrics,
+		AttainmentPct: attainmentPct,
+		Rows:          []CampaignReportRow{},
+		Progress:      campaign.Progress,
+		GeneratedAt:   timeutil.Now(),
+	}
+	rows := make(map[string]*CampaignReportRow)
+	for _, point := range campaign.Points {
+		label := "enabled sources"
+		if len(point.Sources) > 0 {
+			label = strings.Join(point.Sources, "+")
+		}
+		row, ok := rows[label]
+		if !ok {
+			report.Rows = append(report.Rows, CampaignReportRow{Label: label, Sources: point.Sources, Cells: []CampaignReportCell{}})
+			row = &report.Rows[len(report.Rows)-1]
+			rows[label] = row
+		}
+
+		cell := CampaignReportCell{TargetEPS: point.TargetEPS, Status: point.Status, RunID: point.RunID}
+		if run, ok := RunStore.GetRun(point.RunID); point.RunID != "" && ok {
+			cell.RunStatus = run.Status
+			for _, metric := range campaignReportMetrics {
+				if value, ok := run.Summary[metric]; ok {
+					if cell.Metrics == nil {
+						cell.Metrics = make(map[string]float64)
+					}
+					cell.Metrics[metric] = value
+				}
+			}
+			if attainment, ok := run.Summary[runs.MetricTargetAttainment]; ok && point.Status == CampaignPointCompleted &&
+				attainment >= attainmentPct && point.TargetEPS > row.MaxSustainedEPS {
+				row.MaxSustainedEPS = point.TargetEPS
+			}
+		}
+		row.Cells = append(row.Cells, cell)
+	}
+	return report, nil
+}
+
+// grid returns one metric of a report as a row per source set with a value per EPS
+func (report *CampaignReport) grid(metric string) []campaignReportGridRow {
+	grid := make([]campaignReportGridRow, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		gridRow := campaignReportGridRow{Label: row.Label}
+		for _, cell := range row.Cells {
+			var value *float64
+			if v, ok := cell.Metrics[metric]; ok {
+				value = &v
+			}
+			gridRow.EPS = append(gridRow.EPS, cell.TargetEPS)
+			gridRow.Values = append(gridRow.Values, value)
+		}
+		grid = append(grid, gridRow)
+	}
+	return grid
+}
+
+// startRunnerLocked starts the goroutine that runs a campaign's points; callers must
+// hold the lock and have checked that no runner is active
+func (cm *CampaignManager) startRunnerLocked(id string) {
+	cm.runner = id
+	interrupt := make(chan struct{})
+	cm.interrupt = interrupt
+	go cm.run(id, interrupt)
+}
+
+// run runs the pending points of a campaign one after the other until none is left or
+// the campaign is paused or cancelled
+func (cm *CampaignManager) run(id string, interrupt <-chan struct{}) {
+	defer func() {
+		cm.mutex.Lock()
+		defer cm.mutex.Unlock()
+		cm.runner = ""
+		cm.interrupt = nil
+		// Resumed while the runner was on its way out
+		if campaign := cm.findLocked(id); campaign != nil && campaign.Status == CampaignRunning {
+			cm.startRunnerLocked(id)
+		}
+	}()
+
+	for {
+		if !cm.waitForSlot(id, interrupt) {
+			return
+		}
+		campaign, index, ok := cm.nextPoint(id)
+		if !ok {
+			return
+		}
+
+		status, message := cm.runPoint(campaign, index, interrupt)
+		now := timeutil.Now()
+		updated := cm.update(id, func(c *Campaign) {
+			point := &c.Points[index]
+			point.Status = status
+			point.Message = message
+			point.EndedAt = &now
+			if status == CampaignPointFailed && c.StopOnFailure && c.Status != CampaignCancelled {
+				c.Status = CampaignFailed
+				c.Message = fmt.Sprintf("Point %d failed: %s", index+1, message)
+				c.EndedAt = &now
+				skipPending(c, "An earlier point failed")
+			}
+		})
+		logCampaignPoint(updated, index)
+		if updated.Status != CampaignRunning || updated.Progress.Remaining == 0 || campaign.CooldownMinutes == 0 {
+			continue
+		}
+
+		next := now.Add(time.Duration(campaign.CooldownMinutes) * time.Minute)
+		cm.update(id, func(c *Campaign) {
+			c.NextPointAt = &next
+			c.Message = fmt.Sprintf("Cooling down until %s", timeutil.Format(next))
+		})
+		if !cm.wait(id, time.Until(next), interrupt) {
+			return
+		}
+		cm.update(id, func(c *Campaign) { c.NextPointAt = nil })
+	}
+}
+
+// nextPoint marks the next pending point of a running campaign as running. When no point
+// is left the campaign is completed.
+func (cm *CampaignManager) nextPoint(id string) (Campaign, int, bool) {
+	cm.mutex.Lock()
+	campaign := cm.findLocked(id)
+	if campaign == nil || campaign.Status != CampaignRunning {
+		cm.mutex.Unlock()
+		return Campaign{}, 0, false
+	}
+
+	now := timeutil.Now()
+	index := -1
+	for i, point := range campaign.Points {
+		if point.Status == CampaignPointPending {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		campaign.Status = CampaignCompleted
+		campaign.EndedAt = &now
+		progress := campaignProgress(campaign, now)
+		campaign.Message = fmt.Sprintf("%d of %d points completed", progress.Completed, progress.Total)
+	} else {
+		campaign.Points[index].Status = CampaignPointRunning
+		campaign.Points[index].StartedAt = &now
+		campaign.Points[index].Message = ""
+		campaign.Message = fmt.Sprintf("Running point %d of %d", index+1, len(campaign.Points))
+	}
+	if err := cm.saveLocked(); err != nil {
+		logger.Warn().Err(err).Str("campaign", id).Msg("Failed to save campaigns")
+	}
+	copied := cm.copyLocked(campaign, now)
+	cm.mutex.Unlock()
+
+	AppState.BroadcastEvent("campaign_updated", copied)
+	if index < 0 {
+		logger.LogSuccess("System", "Campaigns", fmt.Sprintf("Campaign %s (%s) finished: %s", copied.ID, copied.Name, copied.Message))
+		return copied, 0, false
+	}
+	return copied, index, true
+}
+
+// waitForSlot waits while another simulation runs or a maintenance window covers
+// scheduled runs. It returns false if the campaign was paused or cancelled meanwhile.
+func (cm *CampaignManager) waitForSlot(id string, interrupt <-chan struct{}) bool {
+	poll := time.Duration(cm.Config().WaitPollSeconds) * time.Second
+	waiting := ""
+	for {
+		current, _ := cm.Get(id)
+		if current.Status != CampaignRunning {
+			return false
+		}
+		if current.Progress.Remaining == 0 {
+			return true // nothing left to start, nextPoint completes the campaign
+		}
+		reason := ""
+		now := timeutil.Now()
+		if sim := AppState.Simulation(); sim.Running {
+			reason = "Waiting for the running simulation to end"
+		}
+		for _, window := range Maintenance.Active(now) {
+			if coversScope(window.Scope, MaintenanceScopeScheduledRuns) {
+				reason = fmt.Sprintf("Waiting for maintenance window %s to end", window.ID)
+				break
+			}
+		}
+		if reason == "" {
+			return true
+		}
+		if reason != waiting {
+			waiting = reason
+			cm.update(id, func(c *Campaign) { c.Message = reason })
+		}
+		select {
+		case <-interrupt:
+			return false
+		case <-time.After(poll):
+		}
+	}
+}
+
+// wait sleeps for d unless the campaign is cancelled, and reports whether it slept
+// through. A pause cuts a cool-down short too, the next point waits for the resume.
+func (cm *CampaignManager) wait(id string, d time.Duration, interrupt <-chan struct{}) bool {
+	deadline := time.Now().Add(d)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > 5*time.Second {
+			remaining = 5 * time.Second
+		}
+		select {
+		case <-interrupt:
+			return false
+		case <-time.After(remaining):
+		}
+		if current, _ := cm.Get(id); current.Status != CampaignRunning {
+			return false
+		}
+	}
+}
+
+// runPoint configures the point's sources and EPS, starts a run and the binaries, lets
+// the run last the campaign's duration and stops everything again. It returns the
+// point's status and a message explaining a failure.
+func (cm *CampaignManager) runPoint(campaign Campaign, index int, interrupt <-chan struct{}) (string, string) {
+	point := campaign.Points[index]
+	sources, err := configureCampaignPoint(point.Sources, point.TargetEPS)
+	if err != nil {
+		return CampaignPointFailed, err.Error()
+	}
+
+	select {
+	case <-interrupt:
+		return CampaignPointCancelled, "Cancelled before the run started"
+	default:
+	}
+
+	var nodes []string
+	for name := range BinaryControl.GetEnabledNodes() {
+		nodes = append(nodes, name)
+	}
+	_, status, message := executeTimedRun(timedRun{
+		Config: SimulationConfig{
+			Profile:         campaign.Profile,
+			Scenario:        campaign.Scenario,
+			TargetEPS:       point.TargetEPS,
+			DurationMinutes: campaign.DurationMinutes,
+		},
+		Workspace:     campaign.Workspace,
+		Owner:         campaign.Owner,
+		Nodes:         nodes,
+		BinaryTimeout: campaign.DurationMinutes + cm.Config().BinaryMarginMinutes,
+		Cancelled:     "Stopped by the cancel of the campaign",
+		OnStarted: func(runID string) {
+			cm.update(campaign.ID, func(c *Campaign) { c.Points[index].RunID = runID })
+			RunStore.AddTimelineEvent(runID, "campaign_point", fmt.Sprintf("Point %d of %d of campaign %s: %d EPS over %s",
+				index+1, len(campaign.Points), campaign.Name, point.TargetEPS, strings.Join(sources, ", ")),
+				map[string]interface{}{"campaignId": campaign.ID, "point": index, "targetEps": point.TargetEPS, "sources": sources})
+		},
+	}, interrupt)
+	return status, message
+}
+
+// timedRun is a run of a fixed duration on a set of nodes whose sources and EPS are
+// already configured, as started by a campaign point or a schedule
+type timedRun struct {
+	Config        SimulationConfig
+	Workspace     string
+	Owner         runs.RunOwner
+	Nodes         []string
+	BinaryTimeout int                // minutes after which the binaries stop on their own
+	Cancelled     string             // message of a run ended by the interrupt
+	OnStarted     func(runID string) // called once the run is recorded, before the binaries start
+}
+
+// executeTimedRun starts a run and the binaries on its nodes, lets the run last its
+// duration and stops everything again. It returns the run's ID, if one was recorded, its
+// outcome as a campaign point state (completed, failed or cancelled) and a message
+// explaining a failure or a partial start.
+func executeTimedRun(spec timedRun, interrupt <-chan struct{}) (string, string, string) {
+	runID, started := beginRun(spec.Config, spec.Workspace, spec.Owner)
+	if !started {
+		return "", CampaignPointFailed, "Another simulation started first"
+	}
+	go AppState.BroadcastUpdate()
+	if runID == "" {
+		// Without a run there is nothing to compare, so do not generate load for it
+		AppState.UpdateSimulation(func(sim *SimulationState) {
+			if sim.Running && sim.RunID == "" {
+				stopSimulation(sim, runs.StatusFailed)
+			}
+		})
+		return "", CampaignPointFailed, "The run could not be recorded"
+	}
+	if spec.OnStarted != nil {
+		spec.OnStarted(runID)
+	}
+
+	nodes := spec.Nodes
+	fleet := FleetStart.Config()
+	job, err := FleetScheduler.Wait(FleetStart.Start(nodes, time.Duration(fleet.StaggerMs)*time.Millisecond, time.Duration(fleet.JitterMs)*time.Millisecond, spec.BinaryTimeout))
+	if err != nil || job.CompletedTasks == 0 {
+		endCampaignRun(runID, runs.StatusFailed, nodes)
+		return runID, CampaignPointFailed, fmt.Sprintf("The binary started on none of %d nodes", len(nodes))
+	}
+	message := ""
+	if job.FailedTasks > 0 {
+		message = fmt.Sprintf("The binary started on %d of %d nodes", job.CompletedTasks, job.TotalTasks)
+	}
+
+	// The run may end early: stopped by hand or by the watchdog
+	deadline := time.Now().Add(time.Duration(spec.Config.DurationMinutes) * time.Minute)
+	for time.Now().Before(deadline) && AppState.Simulation().RunID == runID {
+		select {
+		case <-interrupt:
+			endCampaignRun(runID, runs.StatusCompleted, nodes)
+			return runID, CampaignPointCancelled, spec.Cancelled
+		case <-time.After(minDuration(5*time.Second, time.Until(deadline))):
+		}
+	}
+	endedEarly := AppState.Simulation().RunID != runID
+	endCampaignRun(runID, runs.StatusCompleted, nodes)
+
+	run, ok := RunStore.GetRun(runID)
+	switch {
+	case !ok:
+		return runID, CampaignPointFailed, "The run was not recorded"
+	case run.Status != runs.StatusCompleted:
+		return runID, CampaignPointFailed, fmt.Sprintf("Run %s ended %s", runID, run.Status)
+	case endedEarly:
+		return runID, CampaignPointFailed, fmt.Sprintf("Run %s was stopped before its %d minutes", runID, spec.Config.DurationMinutes)
+	}
+	return runID, CampaignPointCompleted, message
+}
+
+// configureCampaignPoint enables exactly the given sources, or keeps the enabled ones
+// when there are none, splits the EPS across them and pushes conf.d to the nodes. It
+// returns the enabled sources.
+func configureCampaignPoint(sources []string, eps int) ([]string, error) {
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, fmt.Errorf("failed to load main config: %v", err)
+	}
+	if len(sources) == 0 {
+		sources = O11yManager.GetEnabledSources()
+		sort.Strings(sources)
+	} else {
+		for _, source := range O11yManager.GetEnabledSources() {
+			if !containsString(sources, source) {
+				if err := O11yManager.DisableSource(source); err != nil {
+					return nil, fmt.Errorf("failed to disable source %s: %v", source, err)
+				}
+			}
+		}
+		for _, source := range sources {
+			if err := O11yManager.EnableSource(source); err != nil {
+				return nil, fmt.Errorf("failed to enable source %s: %v", source, err)
+			}
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no o11y sources are enabled")
+	}
+
+	if _, err := O11yManager.DistributeEPS(o11y_source_manager.EPSDistributionRequest{
+		SelectedSources: sources,
+		TotalEPS:        eps,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to distribute %d EPS: %v", eps, err)
+	}
+	relPaths := []string{"conf.yml"}
+	for _, source := range sources {
+		relPaths = append(relPaths, filepath.Join(source, "conf.yml"))
+	}
+	results, err := O11yManager.PushConfDFiles(relPaths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push conf.d: %v", err)
+	}
+	if failed := failedNodes(results); len(failed) > 0 {
+		return nil, fmt.Errorf("conf.d was not pushed to %s", strings.Join(failed, ", "))
+	}
+	return sources, nil
+}
+
+// endCampaignRun finishes a campaign's run if it is still the current one and stops the
+// binaries it started
+func endCampaignRun(runID, status string, nodes []string) {
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		if sim.Running && sim.RunID == runID {
+			stopSimulation(sim, status)
+		}
+	})
+	go AppState.BroadcastUpdate()
+	if len(nodes) > 0 {
+		FleetScheduler.Wait(StopFleet(nodes, 60, bin_control.StopOptions{}))
+	}
+}
+
+func logCampaignPoint(campaign Campaign, index int) {
+	if index >= len(campaign.Points) {
+		return
+	}
+	point := campaign.Points[index]
+	message := fmt.Sprintf("Campaign %s point %d of %d (%d EPS) %s", campaign.ID, index+1, len(campaign.Points), point.TargetEPS, point.Status)
+	if point.Message != "" {
+		message += ": " + point.Message
+	}
+	if point.Status == CampaignPointCompleted {
+		logger.LogWithNode("System", "Campaigns", message, "info")
+	} else {
+		logger.LogWarning("System", "Campaigns", message)
+	}
+}
+
+func runningPoint(campaign *Campaign) *CampaignPoint {
+	for i := range campaign.Points {
+		if campaign.Points[i].Status == CampaignPointRunning {
+			return &campaign.Points[i]
+		}
+	}
+	return nil
+}
+
+// skipPending marks the points that never ran as skipped
+func skipPending(campaign *Campaign, message string) {
+	for i := range campaign.Points {
+		if point := &campaign.Points[i]; point.Status == CampaignPointPending {
+			point.Status = CampaignPointSkipped
+			point.Message = message
+		}
+	}
+}
+
+// campaignProgress counts the points by state and estimates when the last one ends,
+// assuming each lasts the campaign's duration plus its cool-down
+func campaignProgress(campaign *Campaign, now time.Time) CampaignProgress {
+	progress := CampaignProgress{Total: len(campaign.Points)}
+	var runningSince *time.Time
+	for _, point := range campaign.Points {
+		switch point.Status {
+		case CampaignPointCompleted:
+			progress.Completed++
+		case CampaignPointFailed, CampaignPointCancelled:
+			progress.Failed++
+		case CampaignPointSkipped:
+			progress.Skipped++
+		case CampaignPointRunning:
+			index := point.Index
+			progress.Current = &index
+			runningSince = point.StartedAt
+			progress.Remaining++
+		default:
+			progress.Remaining++
+		}
+	}
+	if progress.Total > 0 {
+		progress.Percent = float64(progress.Total-progress.Remaining) * 100 / float64(progress.Total)
+	}
+	if campaign.Status != CampaignRunning || progress.Remaining == 0 {
+		return progress
+	}
+
+	duration := time.Duration(campaign.DurationMinutes) * time.Minute
+	cooldown := time.Duration(campaign.CooldownMinutes) * time.Minute
+	pending := progress.Remaining
+	start := now
+	switch {
+	case runningSince != nil:
+		start = runningSince.Add(duration + cooldown)
+		pending--
+	case campaign.NextPointAt != nil && campaign.NextPointAt.After(now):
+		start = *campaign.NextPointAt
+	}
+	estimate := start.Add(time.Duration(pending)*(duration+cooldown) - cooldown)
+	if pending == 0 {
+		estimate = start.Add(-cooldown)
+	}
+	progress.EstimateAt = &estimate
+	return progress
+}
+
+func (cm *CampaignManager) findLocked(id string) *Campaign {
+	for _, campaign := range cm.campaigns {
+		if campaign.ID == id {
+			return campaign
+		}
+	}
+	return nil
+}
+
+// copyLocked returns a copy of campaign with its progress at now; callers must hold the
+// lock
+func (cm *CampaignManager) copyLocked(campaign *Campaign, now time.Time) Campaign {
+	copied := cloneCampaign(campaign)
+	copied.Progress = campaignProgress(campaign, now)
+	return copied
+}
+
+func cloneCampaign(campaign *Campaign) Campaign {
+	copied := *campaign
+	copied.EPS = append([]int(nil), campaign.EPS...)
+	copied.SourceSets = make([][]string, 0, len(campaign.SourceSets))
+	for _, set := range campaign.SourceSets {
+		copied.SourceSets = append(copied.SourceSets, append([]string(nil), set...))
+	}
+	copied.Points = append([]CampaignPoint(nil), campaign.Points...)
+	return copied
+}
+
+// saveLocked writes the campaigns; callers must hold the lock
+func (cm *CampaignManager) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(cm.config.File), 0755); err != nil {
+		return fmt.Errorf("failed to create campaigns directory: %v", err)
+	}
+	data, err := json.MarshalIndent(cm.campaigns, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal campaigns: %v", err)
+	}
+	tmp := cm.config.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write campaigns: %v", err)
+	}
+	return os.Rename(tmp, cm.config.File)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// campaignError sends the response of a failed campaign operation
+func campaignError(w http.ResponseWriter, err error) {
+	status := http.StatusConflict
+	if errors.Is(err, errCampaignNotFound) {
+		status = http.StatusNotFound
+	}
+	SendJSONResponse(w, status, APIResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// HandleAPIListCampaigns Handles GET /api/campaigns
+// Lists the campaigns newest first, with their progress but without their points
+func HandleAPIListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns := Campaigns.List()
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d campaigns", len(campaigns)),
+		Data:    campaigns,
+	})
+}
+
+// HandleAPICreateCampaign Handles POST /api/campaigns
+// Body: {"name": "...", "eps": [10000, 25000, 50000], "sourceSets": [["linux"], ["linux",
+// "mysql"]], "durationMinutes": 30, "cooldownMinutes": 5, "stopOnFailure": false}. Every
+// source set runs at every EPS value, one run after the other; without sourceSets the
+// enabled sources are used. Returns 201 with the campaign, which starts at once or as
+// soon as the running simulation ends.
+func HandleAPICreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var request CampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	// Fail fast on missing ClickHouse tables instead of a night of failed points
+	tableCheck, err := TableCheck.BeforeRun(r.Context(), request.SkipTableCheck)
+	if err != nil {
+		SendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Cannot verify ClickHouse tables before the campaign: %v (set skipTableCheck to start anyway)", err),
+		})
+		return
+	}
+	if tableCheck != nil && !tableCheck.Passed {
+		SendJSONResponse(w, http.StatusPreconditionFailed, APIResponse{
+			Success: false,
+			Message: tableCheck.Summary(),
+			Data:    tableCheck,
+		})
+		return
+	}
+
+	by := auth.Describe(r.Context())
+	campaign, err := Campaigns.Create(request, auth.FromContext(r.Context()), by, timeutil.Now())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errCampaignConflict) {
+			status = http.StatusConflict
+		}
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Campaign not started: %v", err),
+		})
+		return
+	}
+
+	logger.LogWithNode("System", "Campaigns", fmt.Sprintf("Campaign %s (%s) of %d points created by %s", campaign.ID, campaign.Name, len(campaign.Points), by), "info")
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Campaign %s started with %d points", campaign.ID, len(campaign.Points)),
+		Data:    campaign,
+	})
+}
+
+// HandleAPIGetCampaign Handles GET /api/campaigns/{id}
+func HandleAPIGetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := Campaigns.Get(mux.Vars(r)["id"])
+	if !ok {
+		campaignError(w, errCampaignNotFound)
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Campaign %s is %s, %d of %d points done", campaign.ID, campaign.Status, campaign.Progress.Total-campaign.Progress.Remaining, campaign.Progress.Total),
+		Data:    campaign,
+	})
+}
+
+// HandleAPIPauseCampaign Handles POST /api/campaigns/{id}/pause
+func HandleAPIPauseCampaign(w http.ResponseWriter, r *http.Request) {
+	handleCampaignAction(w, r, "paused", Campaigns.Pause)
+}
+
+// HandleAPIResumeCampaign Handles POST /api/campaigns/{id}/resume
+func HandleAPIResumeCampaign(w http.ResponseWriter, r *http.Request) {
+	handleCampaignAction(w, r, "resumed", Campaigns.Resume)
+}
+
+// HandleAPICancelCampaign Handles POST /api/campaigns/{id}/cancel
+func HandleAPICancelCampaign(w http.ResponseWriter, r *http.Request) {
+	handleCampaignAction(w, r, "cancelled", Campaigns.Cancel)
+}
+
+func handleCampaignAction(w http.ResponseWriter, r *http.Request, done string, action func(id, by string) (Campaign, error)) {
+	id := mux.Vars(r)["id"]
+	by := auth.Describe(r.Context())
+	campaign, err := action(id, by)
+	if err != nil {
+		campaignError(w, err)
+		return
+	}
+	logger.LogWithNode("System", "Campaigns", fmt.Sprintf("Campaign %s %s by %s", id, done, by), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Campaign %s %s", id, done),
+		Data:    campaign,
+	})
+}
+
+// HandleAPIGetCampaignReport Handles GET /api/campaigns/{id}/report
+// Optional query: attainmentPct (default 95) for each row's maxSustainedEps, and metric
+// to get only that metric as a grid of source sets by EPS. Supports ?format=csv.
+func HandleAPIGetCampaignReport(w http.ResponseWriter, r *http.Request) {
+	attainment := 95.0
+	if value := r.URL.Query().Get("attainmentPct"); value != "" {
+		if _, err := fmt.Sscanf(value, "%g", &attainment); err != nil || attainment <= 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "attainmentPct must be a positive number",
+			})
+			return
+		}
+	}
+	metric := r.URL.Query().Get("metric")
+	if metric != "" && !containsString(campaignReportMetrics, metric) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown metric %q, use %s", metric, strings.Join(campaignReportMetrics, ", ")),
+		})
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	report, err := Campaigns.Report(id, attainment)
+	if err != nil {
+		campaignError(w, err)
+		return
+	}
+	var data interface{} = report
+	message := fmt.Sprintf("Report of campaign %s: %d source sets by %d EPS values", id, len(report.Rows), len(report.EPS))
+	if metric != "" {
+		data = report.grid(metric)
+		message = fmt.Sprintf("%s of campaign %s by source set and EPS", metric, id)
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    data,
+	}, "campaign-"+strings.TrimPrefix(id, "campaign-")+"-report")
+}
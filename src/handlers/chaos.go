@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Chaos action types
+const (
+	ChaosKillSimulator     = "kill_simulator"
+	ChaosNetworkLatency    = "network_latency"
+	ChaosPauseClickHouse   = "pause_clickhouse_pod"
+	chaosStatusActive      = "active"
+	chaosStatusReverted    = "reverted"
+	chaosStatusRevertError = "revert_failed"
+)
+
+var (
+	networkInterfacePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,15}$`)
+	podNamePattern          = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+)
+
+// ChaosConfig holds the chaos section of config.yaml
+type ChaosConfig struct {
+	Enabled              bool   `yaml:"enabled" json:"enabled"`
+	MaxDurationSeconds   int    `yaml:"max_duration_seconds" json:"maxDurationSeconds"`
+	MaxLatencyMs         int    `yaml:"max_latency_ms" json:"maxLatencyMs"`
+	ClickHouseNamespace  string `yaml:"clickhouse_namespace" json:"clickhouseNamespace"`
+	ClickHousePodPrefix  string `yaml:"clickhouse_pod_prefix" json:"clickhousePodPrefix"`
+	DefaultClickHousePod string `yaml:"default_clickhouse_pod" json:"defaultClickhousePod"`
+}
+
+// ChaosRequest is the body of POST /api/chaos/actions
+type ChaosRequest struct {
+	Action          string `json:"action"`
+	Node            string `json:"node,omitempty"` // empty picks a random enabled node
+	DurationSeconds int    `json:"durationSeconds"`
+	LatencyMs       int    `json:"latencyMs,omitempty"`
+	Interface       string `json:"interface,omitempty"` // defaults to the node's default-route interface
+	Pod             string `json:"pod,omitempty"`
+}
+
+// ChaosAction is an injected fault, reverted automatically when it expires or the run ends
+type ChaosAction struct {
+	ID          string       `json:"id"`
+	Action      string       `json:"action"`
+	Target      string       `json:"target"`
+	RunID       string       `json:"runId"`
+	Status      string       `json:"status"`
+	Params      ChaosRequest `json:"params"`
+	TriggeredBy string       `json:"triggeredBy"`
+	StartedAt   time.Time    `json:"startedAt"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	RevertedAt  *time.Time   `json:"revertedAt,omitempty"`
+	Error       string       `json:"error,omitempty"`
+
+	revert func() error
+	timer  *time.Timer
+}
+
+// ChaosManager runs and reverts chaos actions
+type ChaosManager struct {
+	mutex   sync.Mutex
+	config  ChaosConfig
+	actions map[string]*ChaosAction
+	// pending holds the action/target pairs being injected, before they are in actions
+	pending map[string]bool
+}
+
+var Chaos = &ChaosManager{
+	config:  defaultChaosConfig(),
+	actions: make(map[string]*ChaosAction),
+	pending: make(map[string]bool),
+}
+
+func defaultChaosConfig() ChaosConfig {
+	return ChaosConfig{
+		Enabled:              false,
+		MaxDurationSeconds:   600,
+		MaxLatencyMs:         2000,
+		ClickHouseNamespace:  "vsmaps",
+		ClickHousePodPrefix:  "chi-clickhouse-",
+		DefaultClickHousePod: "chi-clickhouse-vusmart-0-0-0",
+	}
+}
+
+// LoadConfig reads the chaos section from the application config file
+func (cm *ChaosManager) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultChaosConfig()
+	fileConfig := struct {
+		Chaos *ChaosConfig `yaml:"chaos"`
+	}{Chaos: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+
+	cm.mutex.Lock()
+	cm.config = config
+	cm.mutex.Unlock()
+	return nil
+}
+
+// List returns all actions, newest first
+func (cm *ChaosManager) List() []ChaosAction {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	list := make([]ChaosAction, 0, len(cm.actions))
+	for _, action := range cm.actions {
+		list = append(list, *action)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StartedAt.After(list[j].StartedAt) })
+	return list
+}
+
+// Start validates and injects a chaos action scoped to the given run
+func (cm *ChaosManager) Start(req ChaosRequest, runID, triggeredBy string) (*ChaosAction, int, error) {
+	cm.mutex.Lock()
+	config := cm.config
+	cm.mutex.Unlock()
+
+	if !config.Enabled {
+		return nil, http.StatusForbidden, fmt.Errorf("chaos actions are disabled (chaos.enabled in config.yaml)")
+	}
+	if req.DurationSeconds < 1 || req.DurationSeconds > config.MaxDurationSeconds {
+		return nil, http.StatusBadRequest, fmt.Errorf("durationSeconds must be between 1 and %d", config.MaxDurationSeconds)
+	}
+
+	action := &ChaosAction{
+		ID:          newChaosID(),
+		Action:      req.Action,
+		RunID:       runID,
+		Status:      chaosStatusActive,
+		TriggeredBy: triggeredBy,
+	}
+
+	var err error
+	switch req.Action {
+	case ChaosKillSimulator:
+		err = cm.killSimulator(action, &req)
+	case ChaosNetworkLatency:
+		if req.LatencyMs < 1 || req.LatencyMs > config.MaxLatencyMs {
+			return nil, http.StatusBadRequest, fmt.Errorf("latencyMs must be between 1 and %d", config.MaxLatencyMs)
+		}
+		if req.Interface != "" && !networkInterfacePattern.MatchString(req.Interface) {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid interface %q", req.Interface)
+		}
+		err = cm.addNetworkLatency(action, &req)
+	case ChaosPauseClickHouse:
+		if req.Pod == "" {
+			req.Pod = config.DefaultClickHousePod
+		}
+		if !podNamePattern.MatchString(req.Pod) || !strings.HasPrefix(req.Pod, config.ClickHousePodPrefix) {
+			return nil, http.StatusBadRequest, fmt.Errorf("pod %q is not a ClickHouse pod (prefix %s)", req.Pod, config.ClickHousePodPrefix)
+		}
+		err = cm.pauseClickHousePod(action, &req, config.ClickHouseNamespace)
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown action %q (expected %s, %s or %s)", req.Action, ChaosKillSimulator, ChaosNetworkLatency, ChaosPauseClickHouse)
+	}
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	action.Params = req
+	action.StartedAt = timeutil.Now()
+	action.ExpiresAt = action.StartedAt.Add(time.Duration(req.DurationSeconds) * time.Second)
+
+	cm.mutex.Lock()
+	cm.actions[action.ID] = action
+	delete(cm.pending, chaosTargetKey(action.Action, action.Target))
+	id := action.ID
+	action.timer = time.AfterFunc(time.Duration(req.DurationSeconds)*time.Second, func() {
+		cm.Revert(id, "expired")
+	})
+	snapshot := *action
+	cm.mutex.Unlock()
+
+	message := fmt.Sprintf("Chaos %s on %s for %ds by %s", action.Action, action.Target, req.DurationSeconds, triggeredBy)
+	logger.LogWarning(action.Target, "Chaos", message)
+	RunStore.AddTimelineEvent(runID, "chaos_started", message, map[string]interface{}{
+		"actionId": action.ID, "action": action.Action, "target": action.Target, "durationSeconds": req.DurationSeconds,
+	})
+	return &snapshot, http.StatusCreated, nil
+}
+
+// Revert undoes an active action; reason is recorded on the run timeline
+func (cm *ChaosManager) Revert(id, reason string) (*ChaosAction, error) {
+	cm.mutex.Lock()
+	action, ok := cm.actions[id]
+	if !ok {
+		cm.mutex.Unlock()
+		return nil, fmt.Errorf("chaos action %s not found", id)
+	}
+	if action.Status != chaosStatusActive {
+		snapshot := *action
+		cm.mutex.Unlock()
+		return &snapshot, nil
+	}
+	action.timer.Stop()
+	// Mark first so a concurrent expiry does not revert twice
+	action.Status = chaosStatusReverted
+	revert := action.revert
+	cm.mutex.Unlock()
+
+	err := revert()
+
+	cm.mutex.Lock()
+	now := timeutil.Now()
+	action.RevertedAt = &now
+	if err != nil {
+		action.Status = chaosStatusRevertError
+		action.Error = err.Error()
+	}
+	snapshot := *action
+	cm.mutex.Unlock()
+
+	message := fmt.Sprintf("Chaos %s on %s reverted (%s)", action.Action, action.Target, reason)
+	if err != nil {
+		message = fmt.Sprintf("Chaos %s on %s failed to revert (%s): %v", action.Action, action.Target, reason, err)
+		logger.LogError(action.Target, "Chaos", message)
+	} else {
+		logger.LogWithNode(action.Target, "Chaos", message, "info")
+	}
+	RunStore.AddTimelineEvent(action.RunID, "chaos_reverted", message, map[string]interface{}{
+		"actionId": action.ID, "action": action.Action, "target": action.Target, "reason": reason,
+	})
+	return &snapshot, err
+}
+
+// RevertRun reverts every active action of a run, e.g. when the run stops
+func (cm *ChaosManager) RevertRun(runID, reason string) {
+	cm.mutex.Lock()
+	var ids []string
+	for id, action := range cm.actions {
+		if action.RunID == runID && action.Status == chaosStatusActive {
+			ids = append(ids, id)
+		}
+	}
+	cm.mutex.Unlock()
+
+	for _, id := range ids {
+		cm.Revert(id, reason)
+	}
+}
+
+// killSimulator force-kills the simulator binary; revert starts it again
+func (cm *ChaosManager) killSimulator(action *ChaosAction, req *ChaosRequest) error {
+	if req.Node == "" {
+		var running []string
+		for nodeName := range BinaryControl.GetEnabledNodes() {
+			if status, err := BinaryControl.GetBinaryStatus(nodeName); err == nil && status.Status == "running" {
+				running = append(running, nodeName)
+			}
+		}
+		if len(running) == 0 {
+			return fmt.Errorf("no enabled node is running the simulator")
+		}
+		req.Node = randomChoice(running)
+	}
+
+	status, err := BinaryControl.GetBinaryStatus(req.Node)
+	if err != nil {
+		return fmt.Errorf("failed to get binary status on %s: %v", req.Node, err)
+	}
+	if status.Status != "running" {
+		return fmt.Errorf("simulator is not running on %s", req.Node)
+	}
+	if _, err := BinaryControl.RunCommand(req.Node, remotecmd.Signal("KILL", status.PID)); err != nil {
+		return fmt.Errorf("failed to kill simulator on %s: %v", req.Node, err)
+	}
+
+	node := req.Node
+	action.Target = node
+	action.revert = func() error {
+		_, err := BinaryControl.StartBinary(node, 0)
+		return err
+	}
+	return nil
+}
+
+// addNetworkLatency adds a netem delay on the node. The node also schedules its own
+// cleanup, so the delay disappears even if the manager goes away mid-action.
+func (cm *ChaosManager) addNetworkLatency(action *ChaosAction, req *ChaosRequest) (err error) {
+	if req.Node == "" {
+		var nodes []string
+		for nodeName := range BinaryControl.GetEnabledNodes() {
+			nodes = append(nodes, nodeName)
+		}
+		if len(nodes) == 0 {
+			return fmt.Errorf("no enabled nodes")
+		}
+		req.Node = randomChoice(nodes)
+	}
+	node := req.Node
+	if !cm.reserve(ChaosNetworkLatency, node) {
+		return fmt.Errorf("network latency is already being injected on %s", node)
+	}
+	defer func() {
+		if err != nil {
+			cm.release(ChaosNetworkLatency, node)
+		}
+	}()
+
+	if req.Interface == "" {
+		iface, err := BinaryControl.RunCommand(req.Node, "ip route show default | awk '{print $5; exit}'")
+		if err != nil || !networkInterfacePattern.MatchString(iface) {
+			return fmt.Errorf("failed to detect default interface on %s: %v", req.Node, err)
+		}
+		req.Interface = iface
+	}
+
+	removeCmd := fmt.Sprintf("sudo -n tc qdisc del dev %s root netem", req.Interface)
+	addCmd := fmt.Sprintf("sudo -n tc qdisc replace dev %s root netem delay %dms && (sleep %d; %s) >/dev/null 2>&1 &",
+		req.Interface, req.LatencyMs, req.DurationSeconds+5, removeCmd)
+	if _, err := BinaryControl.RunCommand(req.Node, addCmd); err != nil {
+		return fmt.Errorf("failed to add latency on %s: %v", req.Node, err)
+	}
+
+	action.Target = node
+	action.revert = func() error {
+		_, err := BinaryControl.RunCommand(node, removeCmd)
+		return err
+	}
+	return nil
+}
+
+// pauseClickHousePod stops the ClickHouse server processes in a pod with SIGSTOP
+func (cm *ChaosManager) pauseClickHousePod(action *ChaosAction, req *ChaosRequest, namespace string) (err error) {
+	pod := req.Pod
+	if !cm.reserve(ChaosPauseClickHouse, pod) {
+		return fmt.Errorf("pod %s is already paused", pod)
+	}
+	defer func() {
+		if err != nil {
+			cm.release(ChaosPauseClickHouse, pod)
+		}
+	}()
+
+	signal := func(sig string) error {
+		cmd := exec.Command("kubectl", "exec", req.Pod, "-n", namespace, "--", "sh", "-c",
+			fmt.Sprintf("pkill -%s -f clickhouse-server", sig))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("kubectl exec failed: %v (%s)", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	if err := signal("STOP"); err != nil {
+		return fmt.Errorf("failed to pause pod %s: %v", req.Pod, err)
+	}
+
+	action.Target = req.Pod
+	action.revert = func() error { return signal("CONT") }
+	return nil
+}
+
+// reserve claims a target for an action about to be injected. It fails when the same
+// action is active or being injected on the target; Start drops the reservation when it
+// registers the action, and the injecting function releases it when injection fails.
+func (cm *ChaosManager) reserve(actionType, target string) bool {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	key := chaosTargetKey(actionType, target)
+	if cm.pending[key] {
+		return false
+	}
+	for _, action := range cm.actions {
+		if action.Action == actionType && action.Target == target && action.Status == chaosStatusActive {
+			return false
+		}
+	}
+	cm.pending[key] = true
+	return true
+}
+
+func (cm *ChaosManager) release(actionType, target string) {
+	cm.mutex.Lock()
+	delete(cm.pending, chaosTargetKey(actionType, target))
+	cm.mutex.Unlock()
+}
+
+func chaosTargetKey(actionType, target string) string {
+	return actionType + "/" + target
+}
+
+func randomChoice(values []string) string {
+	sort.Strings(values)
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(values))))
+	if err != nil {
+		return values[0]
+	}
+	return values[n.Int64()]
+}
+
+func newChaosID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return "chaos-" + hex.EncodeToString(suffix)
+}
+
+// HandleAPIStartChaos Handles POST /api/chaos/actions
+func HandleAPIStartChaos(w http.ResponseWriter, r *http.Request) {
+	var req ChaosRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid JSON payload",
+		})
+		return
+	}
+
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	if !running || runID == "" {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "Chaos actions can only be injected during a run",
+		})
+		return
+	}
+
+	action, status, err := Chaos.Start(req, runID, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	SendJSONResponse(w, status, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Chaos action %s started on %s until %s", action.Action, action.Target, timeutil.Format(action.ExpiresAt)),
+		Data:    action,
+	})
+}
+
+// HandleAPIListChaos Handles GET /api/chaos/actions
+func HandleAPIListChaos(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    Chaos.List(),
+	})
+}
+
+// HandleAPIRevertChaos Handles DELETE /api/chaos/actions/{id}
+func HandleAPIRevertChaos(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	action, err := Chaos.Revert(id, "reverted by "+auth.Describe(r.Context()))
+	if action == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: err.Error(),
+			Data:    action,
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Chaos action %s reverted", id),
+		Data:    action,
+	})
+}
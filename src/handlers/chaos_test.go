@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestChaosReserve checks that only one of many concurrent injections can claim a target,
+// and that a released or registered target can be claimed as the manager allows
+func TestChaosReserve(t *testing.T) {
+	cm := &ChaosManager{actions: make(map[string]*ChaosAction), pending: make(map[string]bool)}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	claimed := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cm.reserve(ChaosNetworkLatency, "node1") {
+				mutex.Lock()
+				claimed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("%d concurrent reservations of one target succeeded, want 1", claimed)
+	}
+	if !cm.reserve(ChaosPauseClickHouse, "node1") || !cm.reserve(ChaosNetworkLatency, "node2") {
+		t.Errorf("a reservation blocked another action or target")
+	}
+
+	// A failed injection releases its target
+	cm.release(ChaosNetworkLatency, "node1")
+	if !cm.reserve(ChaosNetworkLatency, "node1") {
+		t.Fatalf("a released target could not be reserved again")
+	}
+
+	// A registered action keeps the target until it is reverted
+	cm.actions["a1"] = &ChaosAction{ID: "a1", Action: ChaosNetworkLatency, Target: "node1", Status: chaosStatusActive}
+	delete(cm.pending, chaosTargetKey(ChaosNetworkLatency, "node1"))
+	if cm.reserve(ChaosNetworkLatency, "node1") {
+		t.Errorf("a target with an active action was reserved")
+	}
+	cm.actions["a1"].Status = chaosStatusReverted
+	if !cm.reserve(ChaosNetworkLatency, "node1") {
+		t.Errorf("a target whose action was reverted could not be reserved")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 	"vuDataSim/src/clickhouse"
 	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
 )
 
 func HandleAPIGetClickHouseMetrics(w http.ResponseWriter, r *http.Request) {
@@ -50,11 +51,11 @@ func HandleAPIGetClickHouseMetrics(w http.ResponseWriter, r *http.Request) {
 	// Log the metrics before sending
 	logger.LogWithNode("System", "ClickHouse", fmt.Sprintf("Sending metrics response: %+v", metrics), "info")
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "ClickHouse metrics retrieved successfully",
 		Data:    metrics,
-	})
+	}, "clickhouse_metrics")
 }
 
 // handleAPIClickHouseHealth handles GET /api/clickhouse/health
@@ -69,14 +70,25 @@ func HandleAPIClickHouseHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "ClickHouse is healthy",
 		Data:    healthData,
-	})
+	}, "clickhouse_health")
 }
 
 
+// monitoredKafkaTopics are the simulator input topics whose ingest rate is tracked
+var monitoredKafkaTopics = []string{
+	"apache-metrics-input",
+	"azure-firewall-input",
+	"azure-redis-cache-input",
+	"vuazure-storage-blob-input",
+	"linux-monitor-input",
+	"mongo-metrics-input",
+	"mssql-telegraf",
+}
+
 // HandleAPIGetKafkaTopicMetrics handles GET /api/clickhouse/kafka-topics
 func HandleAPIGetKafkaTopicMetrics(w http.ResponseWriter, r *http.Request) {
 	// Get time range from query parameters
@@ -108,18 +120,7 @@ func HandleAPIGetKafkaTopicMetrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Define Kafka topics to monitor
-	topics := []string{
-		"apache-metrics-input",
-		"azure-firewall-input",
-		"azure-redis-cache-input",
-		"vuazure-storage-blob-input",
-		"linux-monitor-input",
-		"mongo-metrics-input",
-		"mssql-telegraf",
-	}
-
-	kafkaMetrics, err := clickhouse.GetKafkaTopicMetrics(r.Context(), topics)
+	kafkaMetrics, err := clickhouse.GetKafkaTopicMetrics(r.Context(), monitoredKafkaTopics)
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -127,12 +128,16 @@ func HandleAPIGetKafkaTopicMetrics(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	now := timeutil.Now()
+	for i := range kafkaMetrics {
+		kafkaMetrics[i].AgeSeconds, kafkaMetrics[i].Stale = Staleness.Evaluate(kafkaMetrics[i].Timestamp, now)
+	}
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Kafka topic metrics retrieved successfully",
 		Data:    kafkaMetrics,
-	})
+	}, "kafka_topic_metrics")
 }
 
 // HandleAPIGetPodMetrics handles GET /api/clickhouse/pod-metrics
@@ -176,6 +181,9 @@ func HandleAPIGetPodMetrics(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	for i := range podResourceMetrics {
+		podResourceMetrics[i].AgeSeconds, podResourceMetrics[i].Stale = Staleness.Evaluate(podResourceMetrics[i].LastTimestamp, timeRange.To)
+	}
 
 	// Get pod status metrics
 	podStatusMetrics, err := clickhouse.GetPodStatusMetrics(r.Context(), clickhouse.GetMonitoredPods(), timeRange)
@@ -199,7 +207,7 @@ func HandleAPIGetPodMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Pod metrics retrieved successfully",
 		Data: map[string]interface{}{
@@ -207,5 +215,5 @@ func HandleAPIGetPodMetrics(w http.ResponseWriter, r *http.Request) {
 			"podStatusMetrics":    podStatusMetrics,
 			"topPodMemoryMetrics": topPodMemoryMetrics,
 		},
-	})
+	}, "pod_metrics")
 }
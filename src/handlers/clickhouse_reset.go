@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClickHouseResetConfig holds the clickhouse_reset section of config.yaml
+type ClickHouseResetConfig struct {
+	DefaultStrategy string `yaml:"default_strategy" json:"defaultStrategy"`
+	TTLColumn       string `yaml:"ttl_column" json:"ttlColumn"`
+	TTLMinutes      int    `yaml:"ttl_minutes" json:"ttlMinutes"`
+}
+
+// ClickHouseResetRequest is the optional body of POST /api/clickhouse/truncate
+type ClickHouseResetRequest struct {
+	Strategy string `json:"strategy"`
+	// drop_partitions: the test window, either a run or from/to (to defaults to now)
+	RunID string     `json:"runId"`
+	From  *time.Time `json:"from"`
+	To    *time.Time `json:"to"`
+	// ttl
+	TTLColumn  string `json:"ttlColumn"`
+	TTLMinutes int    `json:"ttlMinutes"`
+	RemoveTTL  bool   `json:"removeTtl"`
+	// Required in a protected environment, see EnvironmentGuard
+	Justification string `json:"justification"`
+}
+
+var clickHouseReset = struct {
+	mutex  sync.Mutex
+	config ClickHouseResetConfig
+}{config: defaultClickHouseResetConfig()}
+
+func defaultClickHouseResetConfig() ClickHouseResetConfig {
+	return ClickHouseResetConfig{
+		DefaultStrategy: kafka_ch_reset.ResetTruncate,
+		TTLColumn:       "timestamp",
+		TTLMinutes:      5,
+	}
+}
+
+// LoadClickHouseResetConfig reads the clickhouse_reset section from the application config file
+func LoadClickHouseResetConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultClickHouseResetConfig()
+	fileConfig := struct {
+		ClickHouseReset *ClickHouseResetConfig `yaml:"clickhouse_reset"`
+	}{ClickHouseReset: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if !kafka_ch_reset.ValidResetStrategy(config.DefaultStrategy) {
+		return fmt.Errorf("invalid clickhouse_reset.default_strategy %q", config.DefaultStrategy)
+	}
+
+	clickHouseReset.mutex.Lock()
+	clickHouseReset.config = config
+	clickHouseReset.mutex.Unlock()
+	return nil
+}
+
+// resetOptions turns a reset request into options, filling the defaults and resolving
+// the window of a run
+func (req ClickHouseResetRequest) resetOptions() (kafka_ch_reset.ResetOptions, error) {
+	clickHouseReset.mutex.Lock()
+	config := clickHouseReset.config
+	clickHouseReset.mutex.Unlock()
+
+	options := kafka_ch_reset.ResetOptions{
+		Strategy:   req.Strategy,
+		TTLColumn:  req.TTLColumn,
+		TTLMinutes: req.TTLMinutes,
+		RemoveTTL:  req.RemoveTTL,
+	}
+	if options.Strategy == "" {
+		options.Strategy = config.DefaultStrategy
+	}
+	if !kafka_ch_reset.ValidResetStrategy(options.Strategy) {
+		return options, fmt.Errorf("strategy must be %s, %s or %s", kafka_ch_reset.ResetTruncate, kafka_ch_reset.ResetDropPartitions, kafka_ch_reset.ResetTTL)
+	}
+	if options.TTLColumn == "" {
+		options.TTLColumn = config.TTLColumn
+	}
+	if options.TTLMinutes == 0 {
+		options.TTLMinutes = config.TTLMinutes
+	}
+
+	if options.Strategy != kafka_ch_reset.ResetDropPartitions {
+		return options, nil
+	}
+	options.To = timeutil.Now()
+	if req.RunID != "" {
+		run, ok := RunStore.GetRun(req.RunID)
+		if !ok {
+			return options, fmt.Errorf("run %s not found", req.RunID)
+		}
+		options.From = run.StartedAt
+		if run.EndedAt != nil {
+			options.To = *run.EndedAt
+		}
+	}
+	if req.From != nil {
+		options.From = *req.From
+	}
+	if req.To != nil {
+		options.To = *req.To
+	}
+	if options.From.IsZero() {
+		return options, fmt.Errorf("drop_partitions needs runId or from")
+	}
+	if options.To.Before(options.From) {
+		return options, fmt.Errorf("to must not be before from")
+	}
+	return options, nil
+}
+
+// resetClickHouseTables resets the tables with drop_partitions or ttl and reports the
+// partitions or TTLs it touched per table
+func (kh *KafkaHandler) resetClickHouseTables(w http.ResponseWriter, options kafka_ch_reset.ResetOptions) {
+	logger.Info().Str("strategy", options.Strategy).Msg("Starting ClickHouse table reset for enabled o11y sources")
+	result, err := kh.kafkaManager.ResetClickHouseTablesForO11ySources(options)
+	if err != nil {
+		sendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to reset ClickHouse tables: %v", err),
+			Data:    result,
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Reset %d ClickHouse tables with %s", len(result.Tables), result.Strategy)
+	if result.Strategy == kafka_ch_reset.ResetDropPartitions {
+		message = fmt.Sprintf("Dropped %d partitions in the window from %d ClickHouse tables", result.DroppedPartitions, len(result.Tables))
+	}
+	status := http.StatusOK
+	if !result.Success {
+		status = http.StatusPartialContent
+		message += fmt.Sprintf(", %d errors", len(result.Errors))
+	}
+	sendJSONResponse(w, status, APIResponse{
+		Success: result.Success,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// decodeResetRequest reads the optional body of a reset; an empty body is a request
+// with the defaults
+func decodeResetRequest(r *http.Request) (ClickHouseResetRequest, error) {
+	var req ClickHouseResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return req, err
+	}
+	return req, nil
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/timeutil"
+)
+
+// clickHouseSummaryTTL is how long the ClickHouse ping of the summary is reused, so
+// polling the landing page does not ping ClickHouse on every request
+const clickHouseSummaryTTL = 30 * time.Second
+
+// k6 verdicts of the cluster summary
+const (
+	K6VerdictNone    = "none" // no k6 test ran since the manager started
+	K6VerdictRunning = "running"
+	K6VerdictPassed  = "passed"
+	K6VerdictFailed  = "failed"
+)
+
+// SummaryNodes counts the configured nodes by state
+type SummaryNodes struct {
+	Total   int `json:"total"`
+	Enabled int `json:"enabled"`
+	Online  int `json:"online"` // enabled nodes that reported recently
+	Stale   int `json:"stale"`
+}
+
+// SummarySimulation is the state of the current simulation
+type SummarySimulation struct {
+	Running   bool       `json:"running"`
+	Profile   string     `json:"profile"`
+	TargetEPS int        `json:"targetEps"`
+	RunID     string     `json:"runId,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+// SummaryK6 is the outcome of the latest k6 test
+type SummaryK6 struct {
+	Verdict   string     `json:"verdict"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// SummaryRun is the latest finished run with its regression verdict
+type SummaryRun struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Scenario string     `json:"scenario"`
+	Verdict  string     `json:"verdict,omitempty"` // pass, fail or no_data; empty without a baseline
+	EndedAt  *time.Time `json:"endedAt"`
+}
+
+// SummaryClickHouse is the cached result of the ClickHouse ping
+type SummaryClickHouse struct {
+	Status    string    `json:"status"` // connected, error or disconnected
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// SummaryAlerts counts the conditions that currently need attention
+type SummaryAlerts struct {
+	Active           int `json:"active"`
+	StaleNodes       int `json:"staleNodes"`
+	WatchdogWarnings int `json:"watchdogWarnings"` // raised for the current run
+	LowDisks         int `json:"lowDisks"`         // manager disks below storage.min_free_pct
+	ClickHouse       int `json:"clickhouse"`       // 1 while ClickHouse is unreachable
+}
+
+// ClusterSummary is the response of GET /api/cluster/summary
+type ClusterSummary struct {
+	Nodes       SummaryNodes      `json:"nodes"`
+	CurrentEPS  int               `json:"currentEps"` // reported by the online nodes
+	Simulation  SummarySimulation `json:"simulation"`
+	K6          SummaryK6         `json:"k6"`
+	LatestRun   *SummaryRun       `json:"latestRun,omitempty"`
+	ClickHouse  SummaryClickHouse `json:"clickhouse"`
+	Alerts      SummaryAlerts     `json:"alerts"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+var clickHouseSummary struct {
+	mutex  sync.Mutex
+	result *SummaryClickHouse
+}
+
+// summarizeClickHouse pings ClickHouse at most once per clickHouseSummaryTTL
+func summarizeClickHouse(now time.Time) SummaryClickHouse {
+	clickHouseSummary.mutex.Lock()
+	defer clickHouseSummary.mutex.Unlock()
+	if cached := clickHouseSummary.result; cached != nil && now.Sub(cached.CheckedAt) < clickHouseSummaryTTL {
+		return *cached
+	}
+
+	result := SummaryClickHouse{Status: "connected", CheckedAt: now}
+	health, err := clickhouse.GetClickHouseHealth()
+	if err != nil {
+		result.Status = "error"
+		if status, ok := health["status"].(string); ok {
+			result.Status = status
+		}
+		result.Error = err.Error()
+	}
+	clickHouseSummary.result = &result
+	return result
+}
+
+// summarizeK6 derives a verdict from the k6 handler's status
+func summarizeK6() SummaryK6 {
+	K6Manager.mutex.RLock()
+	status := K6Manager.status
+	K6Manager.mutex.RUnlock()
+
+	summary := SummaryK6{Verdict: K6VerdictNone}
+	if status.StartTime.IsZero() {
+		return summary
+	}
+	startedAt := status.StartTime
+	summary.StartedAt = &startedAt
+	switch {
+	case status.IsRunning:
+		summary.Verdict = K6VerdictRunning
+	case status.LastError != "":
+		summary.Verdict = K6VerdictFailed
+		summary.Error = status.LastError
+	default:
+		summary.Verdict = K6VerdictPassed
+	}
+	return summary
+}
+
+// BuildClusterSummary aggregates the landing page figures from in-memory state; only
+// the ClickHouse ping leaves the process, and it is cached
+func BuildClusterSummary() ClusterSummary {
+	now := timeutil.Now()
+	nodes := NodeManager.GetNodes()
+	snapshot := AppState.SyncNodes(nodes, now)
+
+	summary := ClusterSummary{
+		Nodes: SummaryNodes{Total: len(nodes)},
+		Simulation: SummarySimulation{
+			Running:   snapshot.Running,
+			Profile:   snapshot.Profile,
+			TargetEPS: snapshot.TargetEPS,
+			RunID:     snapshot.RunID,
+		},
+		K6:          summarizeK6(),
+		ClickHouse:  summarizeClickHouse(now),
+		GeneratedAt: now,
+	}
+	if fleet := snapshot.Fleet; fleet != nil {
+		summary.Nodes.Enabled = fleet.Nodes
+		summary.Nodes.Online = fleet.FreshNodes
+		summary.Nodes.Stale = len(fleet.StaleNodes)
+		summary.CurrentEPS = fleet.TotalEPS
+	}
+	if snapshot.Running {
+		startedAt := snapshot.StartTime
+		summary.Simulation.StartedAt = &startedAt
+	}
+
+	if run := RunStore.LatestFinished(); run != nil {
+		summary.LatestRun = &SummaryRun{
+			ID:       run.ID,
+			Status:   run.Status,
+			Scenario: run.ScenarioName(),
+			EndedAt:  run.EndedAt,
+		}
+		if run.Comparison != nil {
+			summary.LatestRun.Verdict = run.Comparison.Verdict
+		}
+	}
+
+	alerts := &summary.Alerts
+	alerts.StaleNodes = summary.Nodes.Stale
+	if snapshot.Running {
+		alerts.WatchdogWarnings = len(Watchdog.Status().Warnings)
+	}
+	for _, disk := range Storage.Status().Disks {
+		if disk.Low {
+			alerts.LowDisks++
+		}
+	}
+	if summary.ClickHouse.Status != "connected" {
+		alerts.ClickHouse = 1
+	}
+	alerts.Active = alerts.StaleNodes + alerts.WatchdogWarnings + alerts.LowDisks + alerts.ClickHouse
+	return summary
+}
+
+// HandleAPIGetClusterSummary Handles GET /api/cluster/summary
+func HandleAPIGetClusterSummary(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Cluster summary retrieved successfully",
+		Data:    BuildClusterSummary(),
+	})
+}
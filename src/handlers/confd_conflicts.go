@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIGetConfDConflicts Handles GET /api/o11y/confd/conflicts?status=open
+func HandleAPIGetConfDConflicts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != o11y_source_manager.ConflictStatusOpen && status != o11y_source_manager.ConflictStatusResolved {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "status must be open or resolved",
+		})
+		return
+	}
+
+	conflicts := O11yManager.ConfDConflicts(status)
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d conf.d conflicts", len(conflicts)),
+		Data: map[string]interface{}{
+			"conflicts":          conflicts,
+			"conflictResolution": NodeManager.GetClusterSettings().ConflictResolution,
+		},
+	}, "confd_conflicts")
+}
+
+// HandleAPIGetConfDConflict Handles GET /api/o11y/confd/conflicts/{id}
+// The files carry a unified diff from the manager's copy to the node's
+func HandleAPIGetConfDConflict(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	conflict, ok := O11yManager.GetConfDConflict(id)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("conflict %s not found", id),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    conflict,
+	})
+}
+
+// HandleAPIResolveConfDConflict Handles POST /api/o11y/confd/conflicts/{id}/resolve
+// Body: {"resolution": "ours"} overwrites the node's edits, "theirs" keeps them
+func HandleAPIResolveConfDConflict(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var request struct {
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if _, ok := O11yManager.GetConfDConflict(id); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("conflict %s not found", id),
+		})
+		return
+	}
+
+	resolvedBy := auth.Describe(r.Context())
+	result, err := O11yManager.ResolveConfDConflict(id, request.Resolution, resolvedBy)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !result.Success {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: result.Message,
+			Data:    result,
+		})
+		return
+	}
+
+	logger.LogWithNode(result.NodeName, "Conf.d", fmt.Sprintf("Conflict %s resolved with %s by %s", id, request.Resolution, resolvedBy), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Conflict %s resolved with %s: %s", id, request.Resolution, result.Message),
+		Data:    result,
+	})
+}
+
+// HandleAPIGetConfDDiff Handles GET /api/nodes/{name}/confd/diff[?content=false][&all=true]
+// Compares the node's deployed conf.d with the manager's copy file by file. Differing
+// files carry a unified diff unless content=false; all=true also lists identical files.
+func HandleAPIGetConfDDiff(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+	if _, ok := NodeManager.GetNodes()[nodeName]; !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("node %s not found", nodeName),
+		})
+		return
+	}
+	query := r.URL.Query()
+	withContent := query.Get("content") != "false"
+	includeSame := query.Get("all") == "true"
+
+	diff, err := O11yManager.ConfDDiff(nodeName, withContent, includeSame)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("conf.d of node %s matches the manager's copy", nodeName)
+	if !diff.InSync {
+		message = fmt.Sprintf("%d conf.d files of node %s differ from the manager's copy", diff.Differing, nodeName)
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    diff,
+	})
+}
+
+// HandleAPIVerifyConfD Handles GET /api/o11y/confd/verify
+// Checksums the manager's conf.d and compares it with the conf.d of every enabled node,
+// listing the differing files of each node and the nodes each differing file is on.
+// Use /api/nodes/{name}/confd/diff for the content of a node's differences.
+func HandleAPIVerifyConfD(w http.ResponseWriter, r *http.Request) {
+	report, err := O11yManager.VerifyConfD()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("conf.d matches the manager's copy on all %d nodes", report.InSync)
+	if report.Drifted > 0 || report.Unreachable > 0 {
+		message = fmt.Sprintf("conf.d drifted on %d of %d nodes (%d files), %d nodes could not be checked",
+			report.Drifted, len(report.Nodes), len(report.DriftedFiles), report.Unreachable)
+		logger.LogWarning("System", "Conf.d", message)
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
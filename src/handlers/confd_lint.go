@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfDLintConfig holds the confd_lint section of config.yaml
+type ConfDLintConfig struct {
+	// BlockDistribution refuses conf.d distribution while the lint reports warnings
+	BlockDistribution bool `yaml:"block_distribution" json:"blockDistribution"`
+}
+
+// ConfDLinter runs the conf.d lint on demand and before distribution
+type ConfDLinter struct {
+	mutex  sync.Mutex
+	config ConfDLintConfig
+}
+
+var ConfDLint = &ConfDLinter{}
+
+// LoadConfig reads the confd_lint section from the application config file
+func (cl *ConfDLinter) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var config ConfDLintConfig
+	fileConfig := struct {
+		ConfDLint *ConfDLintConfig `yaml:"confd_lint"`
+	}{ConfDLint: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+
+	cl.mutex.Lock()
+	cl.config = config
+	cl.mutex.Unlock()
+	return nil
+}
+
+// Config returns the lint settings
+func (cl *ConfDLinter) Config() ConfDLintConfig {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+	return cl.config
+}
+
+// BeforeDistribution lints conf.d ahead of a distribution. Warnings are logged; with
+// block_distribution they are returned as an error, unless skip is set.
+func (cl *ConfDLinter) BeforeDistribution(skip bool) (*o11y_source_manager.LintReport, error) {
+	if skip {
+		return nil, nil
+	}
+	report, err := O11yManager.LintConfD()
+	if err != nil {
+		return nil, err
+	}
+	if report.Passed {
+		return report, nil
+	}
+	if cl.Config().BlockDistribution {
+		return report, fmt.Errorf("conf.d distribution blocked by lint: %s", report.Summary())
+	}
+	logger.LogWarning("System", "ConfD", report.Summary())
+	return report, nil
+}
+
+// HandleAPILintConfD Handles GET /api/o11y/confd/lint
+// Reports submodule files no source includes, references to missing files and
+// uniquekey names shared by submodules of a source.
+func HandleAPILintConfD(w http.ResponseWriter, r *http.Request) {
+	report, err := O11yManager.LintConfD()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to lint conf.d: %v", err),
+		})
+		return
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: report.Summary(),
+		Data:    report,
+	}, "confd_lint")
+}
@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// managedConfigs are the configs every backup contains, relative to the working directory
+var managedConfigs = []string{
+	"src/configs/nodes.yaml",
+	"src/migrate/conf.d",
+	"src/configs/max_eps.yaml",
+	"src/configs/topics_tables.yaml",
+}
+
+var configBackupNamePattern = regexp.MustCompile(`^configs-\d{8}-\d{6}\.tar\.gz$`)
+
+// ConfigBackupConfig holds the config_backup section of config.yaml
+type ConfigBackupConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// SnapshotAt is the local time of day (HH:MM in TimeZone) the daily backup is taken
+	SnapshotAt    string `yaml:"snapshot_at" json:"snapshotAt"`
+	TimeZone      string `yaml:"time_zone" json:"timeZone"`
+	Dir           string `yaml:"dir" json:"dir"`
+	RetentionDays int    `yaml:"retention_days" json:"retentionDays"` // older local backups are deleted
+	MaxBackups    int    `yaml:"max_backups" json:"maxBackups"`       // the oldest local backups beyond this are deleted
+	// Upload ships every backup to <report_storage.prefix>config-backups/ in the
+	// report_storage.s3 bucket, where RemoteExpireDays becomes a lifecycle rule
+	Upload           bool `yaml:"upload" json:"upload"`
+	RemoteExpireDays int  `yaml:"remote_expire_days" json:"remoteExpireDays"`
+}
+
+// ConfigBackup is one archive of the managed configs
+type ConfigBackup struct {
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Reason      string    `json:"reason"` // scheduled, or who asked for it
+	Bytes       int64     `json:"bytes"`
+	SHA256      string    `json:"sha256"`
+	Files       []string  `json:"files"`
+	Location    string    `json:"location,omitempty"` // s3:// URL of the uploaded copy
+	UploadError string    `json:"uploadError,omitempty"`
+}
+
+// ConfigBackupStatus is the response of GET /api/config-backups
+type ConfigBackupStatus struct {
+	Config     ConfigBackupConfig `json:"config"`
+	NextBackup *time.Time         `json:"nextBackup,omitempty"`
+	Backups    []ConfigBackup     `json:"backups"` // newest first
+}
+
+// ConfigBackupScheduler archives the managed configs daily and keeps the archives within
+// the retention settings, so a broken conf.d or nodes.yaml can be recovered even after
+// the manager machine is lost
+type ConfigBackupScheduler struct {
+	mutex         sync.Mutex
+	config        ConfigBackupConfig
+	location      *time.Location
+	backups       []ConfigBackup // oldest first, as saved in <dir>/index.json
+	scheduledFrom time.Time      // the next backup is due at the first scheduled time after this
+}
+
+var ConfigBackups = &ConfigBackupScheduler{config: defaultConfigBackupConfig(), location: time.UTC}
+
+func defaultConfigBackupConfig() ConfigBackupConfig {
+	return ConfigBackupConfig{
+		Enabled:       true,
+		SnapshotAt:    "02:00",
+		TimeZone:      "UTC",
+		Dir:           "data/config_backups",
+		RetentionDays: 30,
+		MaxBackups:    60,
+	}
+}
+
+// LoadConfig reads the config_backup section from the application config file and the
+// index of the backups already taken
+func (cb *ConfigBackupScheduler) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultConfigBackupConfig()
+	fileConfig := struct {
+		ConfigBackup *ConfigBackupConfig `yaml:"config_backup"`
+	}{ConfigBackup: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if _, err := time.Parse("15:04", config.SnapshotAt); err != nil {
+		return fmt.Errorf("invalid config_backup.snapshot_at %q, use HH:MM", config.SnapshotAt)
+	}
+	location, err := timeutil.ParseLocation(config.TimeZone)
+	if err != nil {
+		return err
+	}
+	if config.Dir == "" {
+		config.Dir = "data/config_backups"
+	}
+	if config.RetentionDays <= 0 {
+		config.RetentionDays = 30
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 60
+	}
+	if config.RemoteExpireDays < 0 {
+		return fmt.Errorf("config_backup.remote_expire_days must not be negative")
+	}
+
+	var backups []ConfigBackup
+	if data, err := os.ReadFile(filepath.Join(config.Dir, "index.json")); err == nil {
+		if err := json.Unmarshal(data, &backups); err != nil {
+			return fmt.Errorf("failed to parse config backup index: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config backup index: %v", err)
+	}
+
+	cb.mutex.Lock()
+	cb.config = config
+	cb.location = location
+	cb.backups = backups
+	if len(backups) > 0 {
+		cb.scheduledFrom = backups[len(backups)-1].CreatedAt
+	}
+	cb.mutex.Unlock()
+	return nil
+}
+
+// Config returns the config backup settings
+func (cb *ConfigBackupScheduler) Config() ConfigBackupConfig {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.config
+}
+
+// Start checks every minute whether the daily backup is due
+func (cb *ConfigBackupScheduler) Start() {
+	cb.mutex.Lock()
+	config := cb.config
+	if cb.scheduledFrom.IsZero() {
+		// No backup yet: wait for the scheduled time instead of archiving on startup
+		cb.scheduledFrom = time.Now().UTC()
+	}
+	cb.mutex.Unlock()
+
+	if !config.Enabled {
+		log.Println("Scheduled config backups disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			cb.backupIfDue(time.Now().UTC())
+		}
+	}()
+}
+
+// scheduledAfterLocked returns the first scheduled backup time after t; callers must hold the lock
+func (cb *ConfigBackupScheduler) scheduledAfterLocked(t time.Time) time.Time {
+	snapshotAt, _ := time.Parse("15:04", cb.config.SnapshotAt)
+	local := t.In(cb.location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), snapshotAt.Hour(), snapshotAt.Minute(), 0, 0, cb.location)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.UTC()
+}
+
+func (cb *ConfigBackupScheduler) backupIfDue(now time.Time) {
+	cb.mutex.Lock()
+	due := !now.Before(cb.scheduledAfterLocked(cb.scheduledFrom))
+	if due {
+		// Also on failure, so a broken backup is retried the next day and not every minute
+		cb.scheduledFrom = now
+	}
+	cb.mutex.Unlock()
+	if !due {
+		return
+	}
+	if _, err := cb.Backup(context.Background(), "scheduled", now); err != nil {
+		logger.LogError("System", "ConfigBackup", fmt.Sprintf("Scheduled config backup failed: %v", err))
+	}
+}
+
+// Status returns the settings, the next scheduled backup and the backups kept
+func (cb *ConfigBackupScheduler) Status() ConfigBackupStatus {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	status := ConfigBackupStatus{Config: cb.config, Backups: make([]ConfigBackup, 0, len(cb.backups))}
+	for i := len(cb.backups) - 1; i >= 0; i-- {
+		status.Backups = append(status.Backups, cb.backups[i])
+	}
+	if cb.config.Enabled {
+		from := cb.scheduledFrom
+		if from.IsZero() {
+			from = time.Now().UTC()
+		}
+		next := cb.scheduledAfterLocked(from)
+		status.NextBackup = &next
+	}
+	return status
+}
+
+// Backup archives the managed configs now, uploads the archive if configured and applies
+// the retention settings. A failed upload is recorded on the backup, not returned.
+func (cb *ConfigBackupScheduler) Backup(ctx context.Context, reason string, now time.Time) (*ConfigBackup, error) {
+	config := cb.Config()
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	var files []string
+	for _, path := range managedConfigs {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("none of the managed configs exist")
+	}
+
+	backup := &ConfigBackup{
+		Name:      fmt.Sprintf("configs-%s.tar.gz", now.Format("20060102-150405")),
+		CreatedAt: now,
+		Reason:    reason,
+		Files:     files,
+	}
+	archive := filepath.Join(config.Dir, backup.Name)
+	args := append([]string{"-czf", archive + ".tmp"}, files...)
+	if output, err := exec.Command("tar", args...).CombinedOutput(); err != nil {
+		os.Remove(archive + ".tmp")
+		return nil, fmt.Errorf("failed to archive configs: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if err := os.Rename(archive+".tmp", archive); err != nil {
+		return nil, fmt.Errorf("failed to store backup: %v", err)
+	}
+	if err := checksumFile(archive, backup); err != nil {
+		return nil, err
+	}
+
+	if config.Upload {
+		location, err := ReportStorage.UploadConfigBackup(ctx, backup.Name, archive)
+		if err != nil {
+			backup.UploadError = err.Error()
+			logger.LogWarning("System", "ConfigBackup", fmt.Sprintf("Failed to upload config backup %s: %v", backup.Name, err))
+		} else {
+			backup.Location = location
+		}
+	}
+
+	cb.mutex.Lock()
+	cb.backups = append(cb.backups, *backup)
+	removed := cb.pruneLocked(now)
+	err := cb.saveLocked()
+	cb.mutex.Unlock()
+	if err != nil {
+		return backup, fmt.Errorf("failed to save config backup index: %v", err)
+	}
+
+	message := fmt.Sprintf("Config backup %s taken (%s, %d bytes)", backup.Name, reason, backup.Bytes)
+	if len(removed) > 0 {
+		message += fmt.Sprintf(", removed %d old backups", len(removed))
+	}
+	logger.LogSuccess("System", "ConfigBackup", message)
+	return backup, nil
+}
+
+func checksumFile(path string, backup *ConfigBackup) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("failed to checksum backup: %v", err)
+	}
+	backup.Bytes = size
+	backup.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// pruneLocked deletes the local backups older than retention_days and the oldest beyond
+// max_backups; uploaded copies are left to the bucket's lifecycle rule
+func (cb *ConfigBackupScheduler) pruneLocked(now time.Time) []string {
+	cutoff := now.Add(-time.Duration(cb.config.RetentionDays) * 24 * time.Hour)
+	sort.Slice(cb.backups, func(i, j int) bool { return cb.backups[i].CreatedAt.Before(cb.backups[j].CreatedAt) })
+
+	var removed []string
+	kept := cb.backups[:0]
+	for i, backup := range cb.backups {
+		if backup.CreatedAt.Before(cutoff) || len(cb.backups)-i > cb.config.MaxBackups {
+			if err := os.Remove(filepath.Join(cb.config.Dir, backup.Name)); err != nil && !os.IsNotExist(err) {
+				logger.LogWarning("System", "ConfigBackup", fmt.Sprintf("Failed to remove config backup %s: %v", backup.Name, err))
+				kept = append(kept, backup)
+				continue
+			}
+			removed = append(removed, backup.Name)
+			continue
+		}
+		kept = append(kept, backup)
+	}
+	cb.backups = kept
+	return removed
+}
+
+func (cb *ConfigBackupScheduler) saveLocked() error {
+	data, err := json.MarshalIndent(cb.backups, "", "  ")
+	if err != nil {
+		return err
+	}
+	index := filepath.Join(cb.config.Dir, "index.json")
+	tmp := index + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, index)
+}
+
+// Path returns the local archive of a backup kept in the index
+func (cb *ConfigBackupScheduler) Path(name string) (string, bool) {
+	if !configBackupNamePattern.MatchString(name) {
+		return "", false
+	}
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	for _, backup := range cb.backups {
+		if backup.Name == name {
+			return filepath.Join(cb.config.Dir, name), true
+		}
+	}
+	return "", false
+}
+
+// HandleAPIGetConfigBackups Handles GET /api/config-backups
+func HandleAPIGetConfigBackups(w http.ResponseWriter, r *http.Request) {
+	status := ConfigBackups.Status()
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d config backups kept", len(status.Backups)),
+		Data:    status,
+	})
+}
+
+// HandleAPICreateConfigBackup Handles POST /api/config-backups
+func HandleAPICreateConfigBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := ConfigBackups.Backup(r.Context(), "requested by "+auth.Describe(r.Context()), time.Now().UTC())
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Config backup failed: %v", err),
+			Data:    backup,
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Config backup %s taken", backup.Name),
+		Data:    backup,
+	})
+}
+
+// HandleAPIDownloadConfigBackup Handles GET /api/config-backups/{name}
+func HandleAPIDownloadConfigBackup(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	path, ok := ConfigBackups.Path(name)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Config backup %s not found", name),
+		})
+		return
+	}
+	w.Header().Set(ContentTypeHeader, "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/sshlimit"
+	"vuDataSim/src/timeutil"
+)
+
+// appConfigPath is the application config file the sections below are read from
+const appConfigPath = "src/configs/config.yaml"
+
+// reloadableSections are the config.yaml sections a config sync re-reads. Sections that
+// hold connections or load history from disk (clickhouse, ha, distribution, availability,
+// config_backup) are only read at startup, and intervals of background loops keep their
+// startup value until a restart. Add new sections here as well as in main.
+var reloadableSections = []struct {
+	name string
+	load func(string) error
+}{
+	{"auth", func(path string) error { return Auth.LoadConfig(path) }},
+	{"runs", func(path string) error { return RunStore.LoadConfig(path) }},
+	{"event_history", func(path string) error { return EventHistory.LoadConfig(path) }},
+	{"metrics", func(path string) error { return Staleness.LoadConfig(path) }},
+	{"notifications", func(path string) error { return Notifier.LoadConfig(path) }},
+	{"digest", func(path string) error { return Digest.LoadConfig(path) }},
+	{"maintenance", func(path string) error { return Maintenance.LoadConfig(path) }},
+	{"binary_verification", func(path string) error { return BinaryControl.LoadVerifyConfig(path) }},
+	{"generators", func(path string) error { return BinaryControl.LoadGeneratorsConfig(path) }},
+	{"binary_status", func(path string) error { return BinaryControl.LoadStatusConfig(path) }},
+	{"node_polling", func(path string) error { return NodeClient.LoadConfig(path) }},
+	{"node_exporter", func(path string) error { return NodeExporter.LoadConfig(path) }},
+	{"ssh_limits", func(path string) error { return sshlimit.Default().LoadConfig(path) }},
+	{"ssh", func(path string) error { return node_control.SSH.LoadConfig(path) }},
+	{"watchdog", func(path string) error { return Watchdog.LoadConfig(path) }},
+	{"node_samples", func(path string) error { return NodeSampler.LoadConfig(path) }},
+	{"table_check", func(path string) error { return TableCheck.LoadConfig(path) }},
+	{"view_lag", func(path string) error { return ViewLagCheck.LoadConfig(path) }},
+	{"fleet_start", func(path string) error { return FleetStart.LoadConfig(path) }},
+	{"binary_bulk", func(path string) error { return BinaryBulk.LoadConfig(path) }},
+	{"volume_estimate", func(path string) error { return VolumeEstimator.LoadConfig(path) }},
+	{"confd_lint", func(path string) error { return ConfDLint.LoadConfig(path) }},
+	{"adaptive_eps", func(path string) error { return Adaptive.LoadConfig(path) }},
+	{"storage", func(path string) error { return Storage.LoadConfig(path) }},
+	{"report_storage", func(path string) error { return ReportStorage.LoadConfig(path) }},
+	{"quotas", func(path string) error { return Quotas.LoadConfig(path) }},
+	{"rolling_restart", func(path string) error { return RollingRestart.LoadConfig(path) }},
+	{"troubleshooting", func(path string) error { return Troubleshooting.LoadConfig(path) }},
+	{"clickhouse_reset", LoadClickHouseResetConfig},
+	{"environment", func(path string) error { return Environment.LoadConfig(path) }},
+	{"smoke_test", func(path string) error { return SmokeTest.LoadConfig(path) }},
+	{"schema_validation", func(path string) error { return SchemaValidation.LoadConfig(path) }},
+	{"generation_errors", func(path string) error { return GenerationErrors.LoadConfig(path) }},
+	{"orphans", func(path string) error { return Orphans.LoadConfig(path) }},
+	{"idempotency", func(path string) error { return Idempotency.LoadConfig(path) }},
+	{"chaos", func(path string) error { return Chaos.LoadConfig(path) }},
+	{"saved_queries", func(path string) error { return clickhouse.SavedQueries.LoadConfig(path) }},
+	{"debug", func(path string) error { return Debug.LoadConfig(path) }},
+}
+
+// ConfigSectionReload is the outcome of re-reading one config.yaml section
+type ConfigSectionReload struct {
+	Section string `json:"section"`
+	Error   string `json:"error,omitempty"` // the previous settings stay in place
+}
+
+// SourceSync lists how the enabled sources in conf.yml changed
+type SourceSync struct {
+	Enabled     []string `json:"enabled"`
+	NowEnabled  []string `json:"nowEnabled,omitempty"`
+	NowDisabled []string `json:"nowDisabled,omitempty"`
+}
+
+// ConfDDrift is the conf.d drift of one enabled node and what the sync did about it
+type ConfDDrift struct {
+	Node       string   `json:"node"`
+	InSync     bool     `json:"inSync"`
+	Files      []string `json:"files,omitempty"` // differing files, relative to conf.d
+	Pushed     bool     `json:"pushed"`
+	ConflictID string   `json:"conflictId,omitempty"` // hand edits on the node blocked the push
+	Error      string   `json:"error,omitempty"`
+}
+
+// ConfigSyncResult is the summary of POST /api/config/sync
+type ConfigSyncResult struct {
+	Nodes        *node_control.NodesReload    `json:"nodes,omitempty"`
+	Sources      *SourceSync                  `json:"sources,omitempty"`
+	TopicMapping *kafka_ch_reset.ReloadResult `json:"topicMapping,omitempty"`
+	Sections     []ConfigSectionReload        `json:"sections"`
+	Drift        []ConfDDrift                 `json:"drift"`
+	Errors       []string                     `json:"errors,omitempty"`
+	SyncedAt     time.Time                    `json:"syncedAt"`
+}
+
+// configSyncMutex runs one sync at a time; a second request waits and then syncs again,
+// so every caller gets a result that reflects the files as they were when it asked
+var configSyncMutex sync.Mutex
+
+// SyncConfig reloads nodes.yaml, conf.yml, the max EPS config, topics_tables.yaml and
+// the reloadable config.yaml sections from disk, then compares every enabled node's
+// conf.d with the manager's and, with push, redistributes conf.d to the nodes that
+// drifted. A failing step is recorded and the others still run.
+func SyncConfig(push bool) *ConfigSyncResult {
+	configSyncMutex.Lock()
+	defer configSyncMutex.Unlock()
+
+	result := &ConfigSyncResult{Sections: []ConfigSectionReload{}, Drift: []ConfDDrift{}}
+	fail := func(format string, args ...interface{}) {
+		result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+	}
+
+	// Nodes, and the transfer budget from their cluster settings
+	if nodes, err := NodeManager.ReloadNodesConfig(); err != nil {
+		fail("nodes.yaml: %v", err)
+	} else {
+		result.Nodes = nodes
+		settings := NodeManager.GetClusterSettings()
+		TransferScheduler.SetBudget(settings.MaxConcurrentTransfers, settings.TransferBandwidthKbps)
+	}
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		fail("nodes.yaml for binary control: %v", err)
+	}
+
+	// O11y sources
+	if err := O11yManager.LoadMaxEPSConfig(); err != nil {
+		fail("max EPS config: %v", err)
+	}
+	before := O11yManager.GetEnabledSources()
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		fail("conf.yml: %v", err)
+	} else {
+		after := O11yManager.GetEnabledSources()
+		result.Sources = &SourceSync{
+			Enabled:     after,
+			NowEnabled:  missingFrom(after, before),
+			NowDisabled: missingFrom(before, after),
+		}
+	}
+
+	// Kafka topic and ClickHouse table mapping
+	if topicMapping == nil {
+		fail("topics_tables.yaml: Kafka manager not available")
+	} else if reload, err := topicMapping.Reload(); err != nil {
+		fail("topics_tables.yaml, keeping the current mapping: %v", err)
+	} else {
+		result.TopicMapping = reload
+	}
+
+	for _, section := range reloadableSections {
+		reload := ConfigSectionReload{Section: section.name}
+		if err := section.load(appConfigPath); err != nil {
+			reload.Error = err.Error()
+			fail("config.yaml %s: %v", section.name, err)
+		}
+		result.Sections = append(result.Sections, reload)
+	}
+
+	result.Drift = syncConfDDrift(push, fail)
+	result.SyncedAt = timeutil.Now()
+	return result
+}
+
+// syncConfDDrift compares the conf.d of every enabled node with the manager's and, with
+// push, distributes conf.d to the drifted nodes
+func syncConfDDrift(push bool, fail func(string, ...interface{})) []ConfDDrift {
+	enabled := NodeManager.GetEnabledNodes()
+	drift := make([]ConfDDrift, 0, len(enabled))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name := range enabled {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			entry := ConfDDrift{Node: name}
+			diff, err := O11yManager.ConfDDiff(name, false, false)
+			if err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.InSync = diff.InSync
+				for _, file := range diff.Files {
+					entry.Files = append(entry.Files, file.Path)
+				}
+			}
+			mutex.Lock()
+			drift = append(drift, entry)
+			mutex.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Node < drift[j].Node })
+
+	var drifted []string
+	for _, entry := range drift {
+		if entry.Error != "" {
+			fail("conf.d drift of %s: %s", entry.Node, entry.Error)
+		} else if !entry.InSync {
+			drifted = append(drifted, entry.Node)
+		}
+	}
+	if !push || len(drifted) == 0 {
+		return drift
+	}
+
+	response, err := O11yManager.DistributeConfDToNodes(drifted)
+	if err != nil {
+		fail("conf.d distribution: %v", err)
+		return drift
+	}
+	for i := range drift {
+		outcome, ok := response.Distribution[drift[i].Node]
+		if !ok {
+			continue
+		}
+		drift[i].ConflictID = outcome.ConflictID
+		if !outcome.Success {
+			drift[i].Error = outcome.Message
+			fail("conf.d distribution to %s: %s", drift[i].Node, outcome.Message)
+			continue
+		}
+		drift[i].Pushed = true
+	}
+	return drift
+}
+
+// missingFrom returns the names of a that are not in b
+func missingFrom(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, name := range b {
+		present[name] = true
+	}
+	var missing []string
+	for _, name := range a {
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// HandleAPISyncConfig Handles POST /api/config/sync
+// Reloads the configs from disk into the running manager and pushes conf.d to enabled
+// nodes whose copy drifted from the manager's. ?push=false only reports the drift. Safe to
+// repeat; concurrent requests run one after the other.
+func HandleAPISyncConfig(w http.ResponseWriter, r *http.Request) {
+	push := r.URL.Query().Get("push") != "false"
+	result := SyncConfig(push)
+
+	drifted, pushed := 0, 0
+	for _, entry := range result.Drift {
+		if !entry.InSync {
+			drifted++
+		}
+		if entry.Pushed {
+			pushed++
+		}
+	}
+	message := fmt.Sprintf("Reloaded %d config sections; %d of %d nodes drifted, conf.d pushed to %d", len(result.Sections), drifted, len(result.Drift), pushed)
+	if len(result.Errors) > 0 {
+		logger.LogWarning("System", "Config", fmt.Sprintf("Config sync finished with %d problems: %s", len(result.Errors), strings.Join(result.Errors, "; ")))
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s, %d problems", message, len(result.Errors)),
+			Data:    result,
+		})
+		return
+	}
+	logger.LogWithNode("System", "Config", "Configuration synced: "+message, "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    result,
+	})
+}
@@ -6,39 +6,19 @@ import (
 	"net/http"
 	"time"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/timeutil"
 
 	"github.com/gorilla/mux"
 )
 
 func GetDashboardData(w http.ResponseWriter, r *http.Request) {
-	AppState.Mutex.Lock()
-	defer AppState.Mutex.Unlock()
-
-	// Populate AppState.NodeData with current node information from NodeManager
-	nodes := NodeManager.GetNodes()
-	AppState.NodeData = make(map[string]*node_control.NodeMetrics)
-
-	for name, config := range nodes {
-		AppState.NodeData[name] = &node_control.NodeMetrics{
-			NodeID:     name,
-			Status:     "active",
-			EPS:        0,
-			KafkaLoad:  0,
-			CHLoad:     0,
-			CPU:        0,
-			Memory:     0,
-			TotalCPU:   8.0,
-			TotalMemory: 8.0,
-			LastUpdate: time.Now(),
-		}
-		if !config.Enabled {
-			AppState.NodeData[name].Status = "inactive"
-		}
-	}
+	// Align the node data with the configured nodes. Reported metrics and their
+	// LastUpdate are kept so stale nodes can be detected.
+	snapshot := AppState.SyncNodes(NodeManager.GetNodes(), timeutil.Now())
 
 	response := APIResponse{
 		Success: true,
-		Data:    AppState,
+		Data:    snapshot,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -46,16 +26,14 @@ func GetDashboardData(w http.ResponseWriter, r *http.Request) {
 }
 
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	AppState.Mutex.RLock()
-	defer AppState.Mutex.RUnlock()
-
 	response := APIResponse{
 		Success: true,
 		Data: map[string]interface{}{
-			"status":    "healthy",
-			"version":   AppVersion,
-			"timestamp": time.Now(),
-			"uptime":    time.Since(AppState.StartTime).String(),
+			"status":         "healthy",
+			"version":        AppVersion,
+			"timestamp":      timeutil.Now(),
+			"uptime":         time.Since(AppState.Simulation().StartTime).String(),
+			"serverTimeZone": timeutil.LocalZone(),
 		},
 	}
 
@@ -73,16 +51,20 @@ func UpdateNodeMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	AppState.Mutex.Lock()
-	defer AppState.Mutex.Unlock()
-
-	if node, exists := AppState.NodeData[nodeID]; exists {
+	node, exists := AppState.UpdateNode(nodeID, false, func(node *node_control.NodeMetrics) {
 		node.EPS = metrics.EPS
 		node.KafkaLoad = metrics.KafkaLoad
 		node.CHLoad = metrics.CHLoad
-		node.CPU = metrics.CPU
-		node.Memory = metrics.Memory
-		node.LastUpdate = time.Now()
+		// Host metrics of nodes in exporter replace mode come only from node_exporter
+		if config, ok := NodeManager.GetNodes()[nodeID]; !ok || !config.ExporterReplaces() {
+			node.CPU = metrics.CPU
+			node.Memory = metrics.Memory
+		}
+		node.LastUpdate = timeutil.Now()
+		node.AgeSeconds, node.Stale = Staleness.Evaluate(node.LastUpdate, node.LastUpdate)
+	})
+	if exists {
+		Availability.Heartbeat(nodeID, node.LastUpdate, Staleness.Threshold())
 
 		response := APIResponse{
 			Success: true,
@@ -93,7 +75,6 @@ func UpdateNodeMetrics(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 
-		// Broadcast update
 		// Broadcast update
 		go AppState.BroadcastUpdate()
 	} else {
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/remotecmd"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// pprofPrefix is the path net/http/pprof expects its handlers under
+const pprofPrefix = "/debug/pprof/"
+
+// maxProfileSeconds bounds ?seconds= of CPU profiles and traces
+const maxProfileSeconds = 300
+
+// DebugConfig holds the debug section of config.yaml
+type DebugConfig struct {
+	// PprofEnabled mounts net/http/pprof under /api/debug/pprof/ and lets admins open
+	// the profiling listener of node agents; off, those endpoints answer 404
+	PprofEnabled bool `yaml:"pprof_enabled" json:"pprofEnabled"`
+}
+
+// Debugger gates the profiling endpoints of the manager and the node agents
+type Debugger struct {
+	mutex  sync.RWMutex
+	config DebugConfig
+}
+
+var Debug = &Debugger{config: defaultDebugConfig()}
+
+func defaultDebugConfig() DebugConfig {
+	return DebugConfig{}
+}
+
+// LoadConfig reads the debug section from the application config file
+func (d *Debugger) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultDebugConfig()
+	fileConfig := struct {
+		Debug *DebugConfig `yaml:"debug"`
+	}{Debug: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+
+	d.mutex.Lock()
+	d.config = config
+	d.mutex.Unlock()
+	return nil
+}
+
+// Config returns the current debug settings
+func (d *Debugger) Config() DebugConfig {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.config
+}
+
+// pprofEnabled answers 404 and returns false while debug.pprof_enabled is off
+func (d *Debugger) pprofEnabled(w http.ResponseWriter) bool {
+	if d.Config().PprofEnabled {
+		return true
+	}
+	SendJSONResponse(w, http.StatusNotFound, APIResponse{
+		Success: false,
+		Message: "Profiling is disabled, set debug.pprof_enabled in config.yaml",
+	})
+	return false
+}
+
+// HandleAPIPprof Handles GET /api/debug/pprof/ and /api/debug/pprof/{profile}
+// Serves net/http/pprof: the index, cmdline, profile, symbol, trace and the named
+// runtime profiles (goroutine, heap, allocs, block, mutex, threadcreate)
+func HandleAPIPprof(w http.ResponseWriter, r *http.Request) {
+	if !Debug.pprofEnabled(w) {
+		return
+	}
+
+	profile := mux.Vars(r)["profile"]
+	switch profile {
+	case "profile", "trace":
+		seconds, _ := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if seconds <= 0 {
+			seconds = 30 // the default of net/http/pprof
+		}
+		if seconds > maxProfileSeconds {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("seconds must be at most %d", maxProfileSeconds),
+			})
+			return
+		}
+		// Collecting takes longer than the server's write timeout allows, so extend the
+		// deadline of this response and keep net/http/pprof from refusing on its own
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(seconds)*time.Second + time.Minute)); err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, nil))
+		}
+	}
+
+	logger.Info().Str("profile", profile).Str("query", r.URL.RawQuery).Msg("Serving pprof profile")
+	switch profile {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		// The index serves named profiles and lists them with links relative to the
+		// request path, so it only needs the path it was written for
+		request := r.Clone(r.Context())
+		request.URL.Path = pprofPrefix + profile
+		pprof.Index(w, request)
+	}
+}
+
+// GoroutineGroup is a set of goroutines with the same stack
+type GoroutineGroup struct {
+	Count    int      `json:"count"`
+	Function string   `json:"function"` // innermost frame outside the runtime
+	Stack    []string `json:"stack"`    // function and file:line per frame, innermost first
+}
+
+// GoroutineSummary is the grouped goroutine dump of GET /api/self/goroutines
+type GoroutineSummary struct {
+	Total     int              `json:"total"`
+	Groups    []GoroutineGroup `json:"groups"` // most goroutines first
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// summarizeGoroutines groups the manager's goroutines by stack. A count that keeps
+// growing between calls points at the leaking call site.
+func summarizeGoroutines() (*GoroutineSummary, error) {
+	var dump bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&dump, 1); err != nil {
+		return nil, err
+	}
+
+	summary := &GoroutineSummary{Total: runtime.NumGoroutine(), Timestamp: time.Now().UTC()}
+	var group *GoroutineGroup
+	scanner := bufio.NewScanner(&dump)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// A group starts with "<count> @ <pcs>", followed by "#  <pc>  <function+offset>  <file:line>"
+		if count, _, ok := strings.Cut(line, " @ "); ok && !strings.HasPrefix(line, "#") {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				continue
+			}
+			summary.Groups = append(summary.Groups, GoroutineGroup{Count: n})
+			group = &summary.Groups[len(summary.Groups)-1]
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "#"))
+		if group == nil || !strings.HasPrefix(line, "#") || len(fields) < 3 {
+			continue
+		}
+		function := fields[1]
+		if i := strings.LastIndex(function, "+0x"); i > 0 {
+			function = function[:i]
+		}
+		group.Stack = append(group.Stack, function+" "+fields[2])
+		if group.Function == "" && !strings.HasPrefix(function, "runtime.") && !strings.HasPrefix(function, "internal/") {
+			group.Function = function
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(summary.Groups, func(i, j int) bool { return summary.Groups[i].Count > summary.Groups[j].Count })
+	return summary, nil
+}
+
+// HandleAPISelfGoroutines Handles GET /api/self/goroutines
+// Returns the manager's goroutines grouped by stack, or with ?debug=2 the full text dump
+// of every goroutine with its state and how long it has been blocked
+func HandleAPISelfGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("debug") == "2" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+		return
+	}
+
+	summary, err := summarizeGoroutines()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to dump goroutines: %v", err),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d goroutines in %d groups", summary.Total, len(summary.Groups)),
+		Data:    summary,
+	})
+}
+
+// NodePprofRequest is the body of POST /api/nodes/{name}/pprof
+type NodePprofRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// HandleAPINodePprof Handles POST /api/nodes/{name}/pprof
+// Opens (SIGUSR1) or closes (SIGUSR2) the profiling listener of the node's
+// node_metrics_api. The listener binds the agent's -pprof-addr, by default
+// 127.0.0.1:6061, so it is reached through an SSH tunnel to the node.
+func HandleAPINodePprof(w http.ResponseWriter, r *http.Request) {
+	if !Debug.pprofEnabled(w) {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	var req NodePprofRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid JSON payload",
+		})
+		return
+	}
+
+	signal, action := "USR2", "closed"
+	if req.Enabled {
+		signal, action = "USR1", "opened"
+	}
+	if _, err := BinaryControl.RunCommand(name, remotecmd.SignalProcesses(signal, remotecmd.MetricsBinary)); err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to signal node_metrics_api on %s (is it running?): %v", name, err),
+		})
+		return
+	}
+
+	logger.Info().Str("node", name).Bool("enabled", req.Enabled).Msg("Toggled node agent profiling")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Profiling listener of node_metrics_api on %s %s", name, action),
+		Data:    map[string]interface{}{"node": name, "enabled": req.Enabled},
+	})
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Digest run results
+const (
+	DigestResultPass = "pass"
+	DigestResultFail = "fail"
+)
+
+// DigestConfig holds the digest section of config.yaml
+type DigestConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// SendAt is the local time of day (HH:MM in TimeZone) the digest is sent
+	SendAt        string `yaml:"send_at" json:"sendAt"`
+	TimeZone      string `yaml:"time_zone" json:"timeZone"`
+	LookbackHours int    `yaml:"lookback_hours" json:"lookbackHours"`
+	// Scenarios limits the digest to runs of these scenarios, e.g. the nightly soak; empty means all runs
+	Scenarios    []string `yaml:"scenarios" json:"scenarios,omitempty"`
+	DashboardURL string   `yaml:"dashboard_url" json:"dashboardUrl,omitempty"` // base of the report links
+	SkipEmpty    bool     `yaml:"skip_empty" json:"skipEmpty"`
+	StateFile    string   `yaml:"state_file" json:"stateFile"`
+}
+
+// DigestRun is one finished run in a digest
+type DigestRun struct {
+	RunID       string     `json:"runId"`
+	Scenario    string     `json:"scenario"`
+	Status      string     `json:"status"`
+	Result      string     `json:"result"`
+	Verdict     string     `json:"verdict,omitempty"` // regression verdict against the scenario baseline
+	Regressions []string   `json:"regressions,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     *time.Time `json:"endedAt"`
+	Duration    string     `json:"duration"`
+	TargetEPS   int        `json:"targetEps"`
+	IngestEPS   *float64   `json:"ingestEps,omitempty"`
+	Attainment  *float64   `json:"targetAttainmentPct,omitempty"`
+	ErrorRate   *float64   `json:"producerErrorRate,omitempty"`
+	ReportURL   string     `json:"reportUrl,omitempty"`
+}
+
+// RunDigestSummary is the digest of the runs that finished in a period
+type RunDigestSummary struct {
+	From   time.Time   `json:"from"`
+	To     time.Time   `json:"to"`
+	Passed int         `json:"passed"`
+	Failed int         `json:"failed"`
+	Runs   []DigestRun `json:"runs"`
+}
+
+// DigestStatus is the response of GET /api/digest
+type DigestStatus struct {
+	Config         DigestConfig      `json:"config"`
+	Channels       []string          `json:"channels"`
+	LastSent       *time.Time        `json:"lastSent,omitempty"`
+	NextSend       *time.Time        `json:"nextSend,omitempty"`
+	LastDeliveries []notify.Delivery `json:"lastDeliveries,omitempty"`
+	Preview        *RunDigestSummary `json:"preview,omitempty"`
+}
+
+// RunDigest sends a daily summary of finished runs to the notification channels
+type RunDigest struct {
+	mutex          sync.Mutex
+	config         DigestConfig
+	location       *time.Location
+	lastSent       time.Time
+	scheduledFrom  time.Time // the next digest is due at the first scheduled time after this
+	lastDeliveries []notify.Delivery
+}
+
+var Digest = &RunDigest{config: defaultDigestConfig(), location: time.UTC}
+
+func defaultDigestConfig() DigestConfig {
+	return DigestConfig{
+		Enabled:       false,
+		SendAt:        "08:00",
+		TimeZone:      "UTC",
+		LookbackHours: 24,
+		SkipEmpty:     true,
+		StateFile:     "data/digest.json",
+	}
+}
+
+// LoadConfig reads the digest section from the application config file and the time
+// the last digest was sent
+func (d *RunDigest) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig struct {
+		Digest *DigestConfig `yaml:"digest"`
+	}
+	config := defaultDigestConfig()
+	fileConfig.Digest = &config
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if _, err := time.Parse("15:04", config.SendAt); err != nil {
+		return fmt.Errorf("invalid digest.send_at %q, use HH:MM", config.SendAt)
+	}
+	location, err := timeutil.ParseLocation(config.TimeZone)
+	if err != nil {
+		return err
+	}
+	if config.LookbackHours <= 0 {
+		config.LookbackHours = 24
+	}
+	config.DashboardURL = strings.TrimRight(config.DashboardURL, "/")
+
+	var state struct {
+		LastSent time.Time `json:"lastSent"`
+	}
+	if data, err := os.ReadFile(config.StateFile); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("failed to parse digest state: %v", err)
+		}
+	}
+
+	d.mutex.Lock()
+	d.config = config
+	d.location = location
+	if !state.LastSent.IsZero() {
+		d.lastSent = state.LastSent
+		d.scheduledFrom = state.LastSent
+	}
+	d.mutex.Unlock()
+	return nil
+}
+
+// Start checks every minute whether a digest is due
+func (d *RunDigest) Start() {
+	d.mutex.Lock()
+	config := d.config
+	if d.scheduledFrom.IsZero() {
+		// Never sent: wait for the next scheduled time instead of sending on startup
+		d.scheduledFrom = time.Now().UTC()
+	}
+	d.mutex.Unlock()
+
+	if !config.Enabled {
+		log.Println("Run digest disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			d.sendIfDue(time.Now().UTC())
+		}
+	}()
+}
+
+// Status returns the digest settings, delivery state and a preview of the next digest
+func (d *RunDigest) Status(now time.Time) DigestStatus {
+	d.mutex.Lock()
+	status := DigestStatus{
+		Config:         d.config,
+		LastDeliveries: append([]notify.Delivery(nil), d.lastDeliveries...),
+	}
+	if !d.lastSent.IsZero() {
+		lastSent := d.lastSent
+		status.LastSent = &lastSent
+	}
+	if d.config.Enabled {
+		from := d.scheduledFrom
+		if from.IsZero() {
+			from = now
+		}
+		next := d.scheduledAfterLocked(from)
+		status.NextSend = &next
+	}
+	d.mutex.Unlock()
+
+	status.Channels = Notifier.Channels()
+	status.Preview = d.Compose(now)
+	return status
+}
+
+// scheduledAfterLocked returns the first scheduled send time after t; callers must hold the lock
+func (d *RunDigest) scheduledAfterLocked(t time.Time) time.Time {
+	sendAt, _ := time.Parse("15:04", d.config.SendAt)
+	local := t.In(d.location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), sendAt.Hour(), sendAt.Minute(), 0, 0, d.location)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.UTC()
+}
+
+func (d *RunDigest) sendIfDue(now time.Time) {
+	d.mutex.Lock()
+	due := !now.Before(d.scheduledAfterLocked(d.scheduledFrom))
+	skipEmpty := d.config.SkipEmpty
+	d.mutex.Unlock()
+	if !due {
+		return
+	}
+
+	summary := d.Compose(now)
+	if len(summary.Runs) == 0 && skipEmpty {
+		logger.LogWithNode("System", "Digest", "No finished runs since the last digest, skipping", "info")
+		d.mutex.Lock()
+		d.scheduledFrom = now
+		d.mutex.Unlock()
+		return
+	}
+	d.mutex.Lock()
+	location := d.location
+	d.mutex.Unlock()
+	if Maintenance.Suppress(formatDigest(summary, location), now) {
+		d.mutex.Lock()
+		d.scheduledFrom = now
+		d.mutex.Unlock()
+		return
+	}
+	d.Send(summary, now)
+}
+
+// Compose builds the digest of the runs that finished in the lookback period before now
+func (d *RunDigest) Compose(now time.Time) *RunDigestSummary {
+	d.mutex.Lock()
+	config := d.config
+	d.mutex.Unlock()
+
+	scenarios := make(map[string]bool, len(config.Scenarios))
+	for _, scenario := range config.Scenarios {
+		scenarios[scenario] = true
+	}
+
+	summary := &RunDigestSummary{
+		From: now.Add(-time.Duration(config.LookbackHours) * time.Hour),
+		To:   now,
+		Runs: []DigestRun{},
+	}
+	for _, run := range RunStore.FinishedBetween(summary.From, summary.To) {
+		if len(scenarios) > 0 && !scenarios[run.ScenarioName()] {
+			continue
+		}
+		entry := DigestRun{
+			RunID:     run.ID,
+			Scenario:  run.ScenarioName(),
+			Status:    run.Status,
+			Result:    DigestResultPass,
+			StartedAt: run.StartedAt,
+			EndedAt:   run.EndedAt,
+			Duration:  run.EndedAt.Sub(run.StartedAt).Round(time.Second).String(),
+			TargetEPS: run.TargetEPS,
+		}
+		if value, ok := run.Summary[runs.MetricIngestEPS]; ok {
+			entry.IngestEPS = &value
+		}
+		if value, ok := run.Summary[runs.MetricTargetAttainment]; ok {
+			entry.Attainment = &value
+		}
+		if value, ok := run.Summary[runs.MetricProducerErrorRate]; ok {
+			entry.ErrorRate = &value
+		}
+		if run.Comparison != nil {
+			entry.Verdict = run.Comparison.Verdict
+			entry.Regressions = run.Comparison.Regressions
+		}
+		// A run fails when it did not complete or regressed against its baseline
+		if run.Status != runs.StatusCompleted || entry.Verdict == runs.VerdictFail {
+			entry.Result = DigestResultFail
+			summary.Failed++
+		} else {
+			summary.Passed++
+		}
+		if config.DashboardURL != "" {
+			entry.ReportURL = fmt.Sprintf("%s/api/v1/runs/%s/report", config.DashboardURL, run.ID)
+		}
+		summary.Runs = append(summary.Runs, entry)
+	}
+	return summary
+}
+
+// Send delivers a digest to every notification channel and records it as sent
+func (d *RunDigest) Send(summary *RunDigestSummary, now time.Time) []notify.Delivery {
+	d.mutex.Lock()
+	location := d.location
+	d.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deliveries := Notifier.Send(ctx, formatDigest(summary, location))
+
+	for _, delivery := range deliveries {
+		if delivery.Success {
+			logger.LogSuccess("System", "Digest", fmt.Sprintf("Run digest sent via %s (%d passed, %d failed)", delivery.Channel, summary.Passed, summary.Failed))
+		} else {
+			logger.LogError("System", "Digest", fmt.Sprintf("Failed to send run digest via %s: %s", delivery.Channel, delivery.Error))
+		}
+	}
+	if len(deliveries) == 0 {
+		logger.LogWarning("System", "Digest", "Run digest not sent, no notification channel receives digests")
+	}
+	d.markSent(now, deliveries)
+	return deliveries
+}
+
+func (d *RunDigest) markSent(now time.Time, deliveries []notify.Delivery) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lastSent = now
+	d.scheduledFrom = now
+	d.lastDeliveries = deliveries
+	data, err := json.Marshal(map[string]time.Time{"lastSent": now})
+	if err == nil {
+		os.MkdirAll(filepath.Dir(d.config.StateFile), 0755)
+		tmp := d.config.StateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, d.config.StateFile)
+		}
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to save digest state")
+	}
+}
+
+// formatDigest renders a digest as a notification message
+func formatDigest(summary *RunDigestSummary, location *time.Location) notify.Message {
+	subject := fmt.Sprintf("vuDataSim digest: %d passed, %d failed", summary.Passed, summary.Failed)
+	severity := notify.SeverityInfo
+	if summary.Failed > 0 {
+		subject = "[FAIL] " + subject
+		severity = notify.SeverityWarning
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "Runs finished between %s and %s\n",
+		timeutil.FormatIn(summary.From, location), timeutil.FormatIn(summary.To, location))
+	if len(summary.Runs) == 0 {
+		text.WriteString("\nNo runs finished in this period.\n")
+	}
+	for _, run := range summary.Runs {
+		fmt.Fprintf(&text, "\n%s %s (%s) - %s, ran %s\n",
+			strings.ToUpper(run.Result), run.Scenario, run.RunID, run.Status, run.Duration)
+		var metrics []string
+		if run.IngestEPS != nil {
+			metrics = append(metrics, fmt.Sprintf("ingest %.0f EPS of %d target", *run.IngestEPS, run.TargetEPS))
+		}
+		if run.Attainment != nil {
+			metrics = append(metrics, fmt.Sprintf("attainment %.1f%%", *run.Attainment))
+		}
+		if run.ErrorRate != nil {
+			metrics = append(metrics, fmt.Sprintf("producer errors %.2f/s", *run.ErrorRate))
+		}
+		if len(metrics) > 0 {
+			fmt.Fprintf(&text, "  %s\n", strings.Join(metrics, ", "))
+		}
+		if run.Verdict != "" {
+			fmt.Fprintf(&text, "  Baseline: %s", run.Verdict)
+			if len(run.Regressions) > 0 {
+				fmt.Fprintf(&text, " (regressed: %s)", strings.Join(run.Regressions, ", "))
+			}
+			text.WriteString("\n")
+		}
+		if run.ReportURL != "" {
+			fmt.Fprintf(&text, "  Report: %s\n", run.ReportURL)
+		}
+	}
+	return notify.Message{Subject: subject, Text: text.String(), Severity: severity, Event: notify.EventDigest}
+}
+
+// HandleAPIGetDigest Handles GET /api/digest
+// Returns the digest settings, the last delivery and a preview of the next digest
+func HandleAPIGetDigest(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    Digest.Status(time.Now().UTC()),
+	})
+}
+
+// HandleAPISendDigest Handles POST /api/digest/send
+// Sends the digest of the lookback period now, regardless of the schedule
+func HandleAPISendDigest(w http.ResponseWriter, r *http.Request) {
+	if len(Notifier.Channels()) == 0 {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "No notification channels configured",
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	summary := Digest.Compose(now)
+	deliveries := Digest.Send(summary, now)
+	if len(deliveries) == 0 {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "No notification channel receives digests, check notifications.routes",
+		})
+		return
+	}
+
+	failed := 0
+	for _, delivery := range deliveries {
+		if !delivery.Success {
+			failed++
+		}
+	}
+	status := http.StatusOK
+	if failed == len(deliveries) {
+		status = http.StatusBadGateway
+	}
+	SendJSONResponse(w, status, APIResponse{
+		Success: failed == 0,
+		Message: fmt.Sprintf("Digest of %d runs sent to %d of %d channels", len(summary.Runs), len(deliveries)-failed, len(deliveries)),
+		Data: map[string]interface{}{
+			"digest":     summary,
+			"deliveries": deliveries,
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/distribution"
+	"vuDataSim/src/node_control"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIDistributeFiles Handles POST /api/files/distribute
+// Pushes a file or directory to the selected nodes; ?async=true returns the queued distribution immediately
+func HandleAPIDistributeFiles(w http.ResponseWriter, r *http.Request) {
+	var req distribution.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	targets := NodeManager.GetEnabledNodes()
+	if len(req.Nodes) > 0 {
+		allNodes := NodeManager.GetNodes()
+		targets = make(map[string]node_control.NodeConfig, len(req.Nodes))
+		for _, name := range req.Nodes {
+			node, ok := allNodes[name]
+			if !ok {
+				SendJSONResponse(w, http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Node %s not found", name),
+				})
+				return
+			}
+			targets[name] = node
+		}
+	}
+
+	dist, err := FileDistribution.Start(req, targets, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to distribute %s: %v", req.Source, err),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" {
+		SendJSONResponse(w, http.StatusAccepted, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Distribution queued as %s (job %s)", dist.ID, dist.JobID),
+			Data:    dist,
+		})
+		return
+	}
+
+	final, err := FileDistribution.Wait(dist.ID)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	succeeded := 0
+	for _, result := range final.Results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	statusCode := http.StatusOK
+	if final.Status != distribution.StatusCompleted {
+		statusCode = http.StatusPartialContent
+	}
+	SendJSONResponse(w, statusCode, APIResponse{
+		Success: final.Status == distribution.StatusCompleted,
+		Message: fmt.Sprintf("Distribution of %s completed: %d/%d nodes successful", final.Source, succeeded, len(final.Nodes)),
+		Data:    final,
+	})
+}
+
+// HandleAPIListDistributions Handles GET /api/files/distributions
+func HandleAPIListDistributions(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    FileDistribution.List(),
+	})
+}
+
+// HandleAPIGetDistribution Handles GET /api/files/distributions/{id}
+func HandleAPIGetDistribution(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dist, ok := FileDistribution.Get(id)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Distribution %s not found", id),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    dist,
+	})
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Destructive operations guarded in a protected environment
+const (
+	DestructiveDeleteTopic    = "kafka_delete_topic"
+	DestructiveRecreateTopics = "kafka_recreate_topics"
+	DestructiveResetTables    = "clickhouse_reset_tables"
+	DestructiveDisableCleanup = "source_disable_cleanup"
+)
+
+// maxDestructiveAuditEntries bounds GET /api/environment/audit
+const maxDestructiveAuditEntries = 1000
+
+// EnvironmentConfig holds the environment section of config.yaml: which Kafka and
+// ClickHouse this manager works against and whether they are shared
+type EnvironmentConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// Protected environments only allow topic deletion and recreation and table resets to
+	// callers with RequiredRole that give a justification, and audit every attempt
+	Protected        bool   `yaml:"protected" json:"protected"`
+	RequiredRole     string `yaml:"required_role" json:"requiredRole"`
+	MinJustification int    `yaml:"min_justification_length" json:"minJustificationLength"`
+	AllowAnonymous   bool   `yaml:"allow_anonymous" json:"allowAnonymous"` // while auth is disabled every caller is an anonymous admin
+	AuditFile        string `yaml:"audit_file" json:"auditFile"`           // NDJSON, appended to before each operation
+}
+
+// DestructiveAuditEntry records an attempt at a destructive operation in a protected
+// environment
+type DestructiveAuditEntry struct {
+	Time          time.Time   `json:"time"`
+	Environment   string      `json:"environment"`
+	Action        string      `json:"action"`
+	Target        string      `json:"target"`
+	Caller        string      `json:"caller"`
+	Role          string      `json:"role,omitempty"`
+	Justification string      `json:"justification,omitempty"`
+	Allowed       bool        `json:"allowed"`
+	Reason        string      `json:"reason,omitempty"` // why it was denied
+	RequestID     string      `json:"requestId,omitempty"`
+	Details       interface{} `json:"details,omitempty"`
+}
+
+// EnvironmentGuard enforces the protection of the environment's Kafka and ClickHouse
+type EnvironmentGuard struct {
+	mutex  sync.Mutex
+	config EnvironmentConfig
+}
+
+var Environment = &EnvironmentGuard{config: defaultEnvironmentConfig()}
+
+func defaultEnvironmentConfig() EnvironmentConfig {
+	return EnvironmentConfig{
+		Name:             "default",
+		RequiredRole:     auth.RoleAdmin,
+		MinJustification: 10,
+		AuditFile:        "data/audit/destructive.ndjson",
+	}
+}
+
+// LoadConfig reads the environment section from the application config file
+func (eg *EnvironmentGuard) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultEnvironmentConfig()
+	fileConfig := struct {
+		Environment *EnvironmentConfig `yaml:"environment"`
+	}{Environment: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if !auth.ValidRole(config.RequiredRole) {
+		return fmt.Errorf("invalid environment.required_role %q", config.RequiredRole)
+	}
+	if config.MinJustification < 1 {
+		config.MinJustification = 1
+	}
+	if config.AuditFile == "" {
+		config.AuditFile = defaultEnvironmentConfig().AuditFile
+	}
+
+	eg.mutex.Lock()
+	eg.config = config
+	eg.mutex.Unlock()
+	return nil
+}
+
+// Config returns the environment settings
+func (eg *EnvironmentGuard) Config() EnvironmentConfig {
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+	return eg.config
+}
+
+// AuthorizeDestructive decides whether the caller may run a destructive operation. In an
+// unprotected environment it always may. In a protected one the caller needs the required
+// role and a justification, every attempt is appended to the audit file and the operation
+// is refused if that fails. A refusal has been sent on w when false is returned.
+func (eg *EnvironmentGuard) AuthorizeDestructive(w http.ResponseWriter, r *http.Request, action, target, justification string, details interface{}) bool {
+	config := eg.Config()
+	if !config.Protected {
+		return true
+	}
+
+	entry := DestructiveAuditEntry{
+		Time:          timeutil.Now(),
+		Environment:   config.Name,
+		Action:        action,
+		Target:        target,
+		Caller:        "unknown",
+		Justification: strings.TrimSpace(justification),
+		RequestID:     logger.RequestID(r.Context()),
+		Details:       details,
+	}
+	status := http.StatusForbidden
+	identity := auth.FromContext(r.Context())
+	if identity != nil {
+		entry.Caller, entry.Role = identity.Name, identity.Role
+	}
+	switch {
+	case identity == nil || (identity.Anonymous && !config.AllowAnonymous):
+		entry.Reason = fmt.Sprintf("environment %s is protected: %s needs an authenticated caller", config.Name, action)
+	case !auth.RoleAllows(identity.Role, config.RequiredRole):
+		entry.Reason = fmt.Sprintf("environment %s is protected: %s requires the %s role", config.Name, action, config.RequiredRole)
+	case len([]rune(entry.Justification)) < config.MinJustification:
+		status = http.StatusBadRequest
+		entry.Reason = fmt.Sprintf("environment %s is protected: give a justification of at least %d characters in the request body", config.Name, config.MinJustification)
+	default:
+		entry.Allowed = true
+	}
+
+	if err := eg.appendAudit(config, entry); err != nil {
+		logger.Error().Err(err).Str("action", action).Msg("Failed to write destructive operation audit entry")
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Refusing %s: the audit entry could not be written: %v", action, err),
+		})
+		return false
+	}
+	EventHistory.Record(HistoryEvent{Time: entry.Time, Type: "destructive_operation", Source: EventSourceAudit, Message: fmt.Sprintf("%s of %s by %s", action, target, entry.Caller), Data: entry})
+
+	if !entry.Allowed {
+		logger.LogWarning("System", "Environment", fmt.Sprintf("Denied %s of %s to %s: %s", action, target, auth.Describe(r.Context()), entry.Reason))
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: entry.Reason,
+		})
+		return false
+	}
+	logger.LogWithNode("System", "Environment", fmt.Sprintf("%s of %s in protected environment %s by %s: %s", action, target, config.Name, auth.Describe(r.Context()), entry.Justification), "info")
+	return true
+}
+
+// appendAudit appends one entry to the audit file and syncs it, so an operation never
+// runs without its entry on disk
+func (eg *EnvironmentGuard) appendAudit(config EnvironmentConfig, entry DestructiveAuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+	if err := os.MkdirAll(filepath.Dir(config.AuditFile), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(config.AuditFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// AuditEntries returns the most recent entries of the audit file, newest first
+func (eg *EnvironmentGuard) AuditEntries(limit int) ([]DestructiveAuditEntry, error) {
+	config := eg.Config()
+	eg.mutex.Lock()
+	defer eg.mutex.Unlock()
+	file, err := os.Open(config.AuditFile)
+	if os.IsNotExist(err) {
+		return []DestructiveAuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []DestructiveAuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var entry DestructiveAuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if entries == nil {
+		entries = []DestructiveAuditEntry{}
+	}
+	return entries, nil
+}
+
+// decodeJustification reads the optional {"justification": "..."} body of a destructive
+// endpoint that takes no other input
+func decodeJustification(r *http.Request) (string, error) {
+	var body struct {
+		Justification string `json:"justification"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil && err != io.EOF {
+		return "", err
+	}
+	return body.Justification, nil
+}
+
+// HandleAPIGetEnvironment Handles GET /api/environment
+// Returns the environment's name and protection settings
+func HandleAPIGetEnvironment(w http.ResponseWriter, r *http.Request) {
+	config := Environment.Config()
+	message := fmt.Sprintf("Environment %s is not protected", config.Name)
+	if config.Protected {
+		message = fmt.Sprintf("Environment %s is protected: topic deletion, recreation and table resets need the %s role and a justification", config.Name, config.RequiredRole)
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    config,
+	})
+}
+
+// HandleAPIGetEnvironmentAudit Handles GET /api/environment/audit?limit=100
+// Returns the audited attempts at destructive operations, newest first
+func HandleAPIGetEnvironmentAudit(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxDestructiveAuditEntries {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("limit must be between 1 and %d", maxDestructiveAuditEntries),
+			})
+			return
+		}
+		limit = parsed
+	}
+	entries, err := Environment.AuditEntries(limit)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read the audit file: %v", err),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d audit entries", len(entries)),
+		Data:    entries,
+	})
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+)
+
+// EPS ramp states
+const (
+	RampRunning   = "running"
+	RampCompleted = "completed" // every step was applied, the run keeps the last EPS
+	RampStopped   = "stopped"
+	RampFailed    = "failed"
+)
+
+// rampMaxFailures consecutive failed steps stop the ramp
+const rampMaxFailures = 3
+
+// RampStep is one planned change of a ramp
+type RampStep struct {
+	At        time.Time  `json:"at"`
+	EPS       int        `json:"eps"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// RampStatus is the state and progress of the EPS ramp
+type RampStatus struct {
+	State      string                           `json:"state,omitempty"` // empty before the first start
+	RunID      string                           `json:"runId,omitempty"`
+	Profile    *o11y_source_manager.RampProfile `json:"profile,omitempty"`
+	CurrentEPS int                              `json:"currentEps,omitempty"`
+	NextEPS    int                              `json:"nextEps,omitempty"`
+	NextAt     *time.Time                       `json:"nextAt,omitempty"`
+	Step       int                              `json:"step"` // steps applied or given up on
+	TotalSteps int                              `json:"totalSteps"`
+	Percent    float64                          `json:"percent"`
+	StartedAt  *time.Time                       `json:"startedAt,omitempty"`
+	EndsAt     *time.Time                       `json:"endsAt,omitempty"`
+	Message    string                           `json:"message,omitempty"`
+	Steps      []RampStep                       `json:"steps"`
+}
+
+// RampController walks the total EPS of the running simulation through a ramp profile.
+// Each step rewrites the sources' NumUniqKey, pushes the changed conf.d files to the
+// enabled nodes and restarts the simulators, like a manual adjustment.
+type RampController struct {
+	mutex  sync.Mutex
+	status RampStatus
+	stop   chan struct{}
+}
+
+var EPSRamp = &RampController{}
+
+// Active reports whether a ramp is adjusting the running simulation
+func (rc *RampController) Active() bool {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.stop != nil
+}
+
+// Status returns the state and progress of the ramp
+func (rc *RampController) Status() RampStatus {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	status := rc.status
+	status.Steps = append([]RampStep{}, rc.status.Steps...)
+	status.TotalSteps = len(status.Steps)
+	if status.TotalSteps > 0 {
+		status.Percent = float64(status.Step) * 100 / float64(status.TotalSteps)
+	}
+	if status.State == RampRunning && status.Step < status.TotalSteps {
+		next := status.Steps[status.Step]
+		status.NextEPS = next.EPS
+		status.NextAt = &next.At
+	}
+	return status
+}
+
+// Start plans the profile and begins walking the running simulation through it
+func (rc *RampController) Start(profile o11y_source_manager.RampProfile) (RampStatus, error) {
+	plan, err := profile.Plan()
+	if err != nil {
+		return RampStatus{}, err
+	}
+	if peak, limit := rampPeakEPS(plan), adaptiveMaxEPS(100000); peak > limit {
+		return RampStatus{}, fmt.Errorf("the ramp peaks at %d EPS, above the %d EPS max_eps.yaml allows for the enabled sources", peak, limit)
+	}
+
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	currentEPS := sim.TargetEPS
+	if !running {
+		return RampStatus{}, fmt.Errorf("no simulation is currently running")
+	}
+	if Adaptive.Active() {
+		return RampStatus{}, fmt.Errorf("the adaptive EPS controller is adjusting this run; stop it first")
+	}
+
+	rc.mutex.Lock()
+	if rc.stop != nil {
+		rc.mutex.Unlock()
+		return RampStatus{}, fmt.Errorf("a ramp is already running on run %s", rc.status.RunID)
+	}
+	now := time.Now().UTC()
+	steps := make([]RampStep, len(plan))
+	for i, point := range plan {
+		steps[i] = RampStep{At: now.Add(point.Offset), EPS: point.EPS}
+	}
+	endsAt := steps[len(steps)-1].At
+	rc.status = RampStatus{
+		State:      RampRunning,
+		RunID:      runID,
+		Profile:    &profile,
+		CurrentEPS: currentEPS,
+		StartedAt:  &now,
+		EndsAt:     &endsAt,
+		Message:    fmt.Sprintf("Ramping %s from %d to %d EPS", profile.Type, profile.Start, profile.End),
+		Steps:      steps,
+	}
+	rc.stop = make(chan struct{})
+	go rc.loop(rc.stop, runID)
+	rc.mutex.Unlock()
+
+	return rc.Status(), nil
+}
+
+// Stop ends the ramp; the run keeps its current EPS
+func (rc *RampController) Stop(reason string) bool {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if rc.stop == nil {
+		return false
+	}
+	rc.finishLocked(rc.stop, RampStopped, reason)
+	return true
+}
+
+// finishLocked ends the ramp started with stop, unless it already ended; callers must
+// hold rc.mutex
+func (rc *RampController) finishLocked(stop chan struct{}, state, message string) {
+	if rc.stop != stop {
+		return
+	}
+	close(rc.stop)
+	rc.stop = nil
+	rc.status.State = state
+	rc.status.Message = message
+}
+
+func (rc *RampController) loop(stop chan struct{}, runID string) {
+	failures := 0
+	for {
+		rc.mutex.Lock()
+		if rc.stop != stop {
+			rc.mutex.Unlock()
+			return
+		}
+		index := rc.status.Step
+		if index == len(rc.status.Steps) {
+			last := rc.status.Steps[index-1].EPS
+			rc.finishLocked(stop, RampCompleted, fmt.Sprintf("Ramp completed, holding %d EPS", last))
+			status := rc.status
+			rc.mutex.Unlock()
+			rc.recordEnd(status)
+			return
+		}
+		step := rc.status.Steps[index]
+		endsAt := *rc.status.EndsAt
+		rc.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(step.At))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		sim := AppState.Simulation()
+		if !sim.Running || sim.RunID != runID {
+			rc.mutex.Lock()
+			rc.finishLocked(stop, RampStopped, "The run ended")
+			rc.mutex.Unlock()
+			return
+		}
+
+		// Restarted simulators outlive the ramp by the usual 30 minutes
+		timeout := 30 + int(time.Until(endsAt).Minutes())
+		adjustment, _, err := adjustRunEPS(EPSAdjustRequest{TotalEPS: step.EPS}, true, timeout)
+		if err == nil && !adjustment.AllOK {
+			err = fmt.Errorf("%s", adjustment.Message)
+		}
+
+		appliedAt := time.Now().UTC()
+		rc.mutex.Lock()
+		if rc.stop != stop {
+			rc.mutex.Unlock()
+			return
+		}
+		applied := &rc.status.Steps[index]
+		applied.AppliedAt = &appliedAt
+		rc.status.Step = index + 1
+		if adjustment != nil {
+			rc.status.CurrentEPS = adjustment.TargetEPS
+		}
+		if err != nil {
+			applied.Error = err.Error()
+			failures++
+		} else {
+			failures = 0
+			rc.status.Message = fmt.Sprintf("Step %d of %d: %d EPS", index+1, len(rc.status.Steps), step.EPS)
+		}
+		if failures >= rampMaxFailures {
+			rc.finishLocked(stop, RampFailed, fmt.Sprintf("Stopped after %d failed steps: %v", failures, err))
+			status := rc.status
+			rc.mutex.Unlock()
+			logger.LogWarning("System", "Ramp", status.Message)
+			rc.recordEnd(status)
+			return
+		}
+		rc.mutex.Unlock()
+		go AppState.BroadcastEvent("eps_ramp", rc.Status())
+	}
+}
+
+// recordEnd records the end of a ramp on its run's timeline
+func (rc *RampController) recordEnd(status RampStatus) {
+	if status.State == RampCompleted {
+		logger.LogSuccess("System", "Ramp", status.Message)
+	}
+	if err := RunStore.AddTimelineEvent(status.RunID, "eps_ramp_finished", status.Message, map[string]interface{}{
+		"state":      status.State,
+		"currentEps": status.CurrentEPS,
+		"step":       status.Step,
+		"totalSteps": len(status.Steps),
+	}); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record ramp end on run %s: %v", status.RunID, err))
+	}
+	go AppState.BroadcastEvent("eps_ramp", rc.Status())
+}
+
+// rampPeakEPS returns the highest EPS a plan sets
+func rampPeakEPS(plan []o11y_source_manager.RampPoint) int {
+	peak := 0
+	for _, point := range plan {
+		peak = max(peak, point.EPS)
+	}
+	return peak
+}
+
+// HandleAPIStartRamp Handles POST /api/o11y/eps/ramp
+// Body: {"type": "step", "start": 1000, "end": 50000, "stepEvery": "5m"} walks the total
+// EPS of the running simulation from 1000 to 50000 in steps of stepSize (default a tenth
+// of the range) every 5 minutes. "linear" moves evenly from start to end over duration,
+// updating every stepEvery; "spike" holds start for stepEvery, jumps to end for duration
+// and drops back, repeat times.
+func HandleAPIStartRamp(w http.ResponseWriter, r *http.Request) {
+	var profile o11y_source_manager.RampProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	if plan, err := profile.Plan(); err == nil {
+		if sim := AppState.Simulation(); sim.Running {
+			if violation := Quotas.CheckEPS(sim.RunID, rampPeakEPS(plan)); violation != nil {
+				SendJSONResponse(w, http.StatusForbidden, APIResponse{Success: false, Message: violation.Message, Data: violation})
+				return
+			}
+		}
+	}
+
+	status, err := EPSRamp.Start(profile)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to start the EPS ramp: %v", err),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("EPS ramp started: %s from %d to %d EPS in %d steps, ending at %s",
+		profile.Type, profile.Start, profile.End, status.TotalSteps, status.EndsAt.Format(time.RFC3339))
+	logger.LogWithNode("System", "Ramp", message, "info")
+	if err := RunStore.AddTimelineEvent(status.RunID, "eps_ramp_started", message, map[string]interface{}{
+		"profile":    profile,
+		"totalSteps": status.TotalSteps,
+		"endsAt":     status.EndsAt,
+	}); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record ramp start on run %s: %v", status.RunID, err))
+	}
+	go AppState.BroadcastEvent("eps_ramp", status)
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    status,
+	})
+}
+
+// HandleAPIGetRampStatus Handles GET /api/o11y/eps/ramp/status
+func HandleAPIGetRampStatus(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    EPSRamp.Status(),
+	})
+}
+
+// HandleAPIStopRamp Handles DELETE /api/o11y/eps/ramp
+// Stops the ramp; the run keeps its current EPS.
+func HandleAPIStopRamp(w http.ResponseWriter, r *http.Request) {
+	if !EPSRamp.Stop("Stopped through the API") {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "No EPS ramp is running",
+		})
+		return
+	}
+	status := EPSRamp.Status()
+	EPSRamp.recordEnd(status)
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "EPS ramp stopped",
+		Data:    status,
+	})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Event history query limits
+const (
+	defaultEventHistoryLimit = 1000
+	maxEventHistoryLimit     = 10000
+	defaultEventHistoryRange = time.Hour
+)
+
+var eventHistoryFilePattern = regexp.MustCompile(`^events-(\d{4}-\d{2}-\d{2})\.ndjson$`)
+
+// EventHistoryConfig holds the event_history section of config.yaml
+type EventHistoryConfig struct {
+	Enabled       bool   `yaml:"enabled" json:"enabled"`
+	Dir           string `yaml:"dir" json:"dir"`                      // one events-YYYY-MM-DD.ndjson file per UTC day
+	RetentionDays int    `yaml:"retention_days" json:"retentionDays"` // older day files are deleted
+}
+
+// HistoryEvent is a stored event: a WebSocket event, or a run timeline entry with its run
+type HistoryEvent struct {
+	Time    time.Time   `json:"time"`
+	Type    string      `json:"type"`
+	Source  string      `json:"source"` // websocket, run_timeline, audit or maintenance
+	RunID   string      `json:"runId,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Event history sources
+const (
+	EventSourceWebSocket   = "websocket"
+	EventSourceRunTimeline = "run_timeline"
+	EventSourceAudit       = "audit"       // attempts at destructive operations in a protected environment
+	EventSourceMaintenance = "maintenance" // alerts and scheduled runs suppressed by a maintenance window
+)
+
+// EventHistoryStore appends every structured event to daily NDJSON files, so a test
+// window can be reconstructed after the fact
+type EventHistoryStore struct {
+	mutex    sync.Mutex
+	config   EventHistoryConfig
+	file     *os.File
+	fileDay  string
+	dropped  uint64 // events that could not be written
+	lastDrop string
+}
+
+var EventHistory = &EventHistoryStore{config: defaultEventHistoryConfig()}
+
+func defaultEventHistoryConfig() EventHistoryConfig {
+	return EventHistoryConfig{
+		Enabled:       true,
+		Dir:           "data/events",
+		RetentionDays: 14,
+	}
+}
+
+// LoadConfig reads the event_history section from the application config file
+func (eh *EventHistoryStore) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultEventHistoryConfig()
+	fileConfig := struct {
+		EventHistory *EventHistoryConfig `yaml:"event_history"`
+	}{EventHistory: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.Dir == "" {
+		config.Dir = "data/events"
+	}
+	if config.RetentionDays <= 0 {
+		config.RetentionDays = 14
+	}
+
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	eh.closeLocked()
+	eh.config = config
+	return nil
+}
+
+// Config returns the event history settings
+func (eh *EventHistoryStore) Config() EventHistoryConfig {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	return eh.config
+}
+
+// Record appends an event to the file of its day. Write errors are counted rather than
+// returned, so a full disk never blocks the event feed.
+func (eh *EventHistoryStore) Record(event HistoryEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		eh.drop(err)
+		return
+	}
+
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	if !eh.config.Enabled {
+		return
+	}
+	day := event.Time.UTC().Format("2006-01-02")
+	if eh.file == nil || eh.fileDay != day {
+		eh.closeLocked()
+		if err := os.MkdirAll(eh.config.Dir, 0755); err != nil {
+			eh.dropLocked(err)
+			return
+		}
+		file, err := os.OpenFile(eh.dayPath(day), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			eh.dropLocked(err)
+			return
+		}
+		eh.file, eh.fileDay = file, day
+		// A new day is the natural point to expire old files
+		eh.pruneLocked(event.Time)
+	}
+	if _, err := eh.file.Write(append(line, '\n')); err != nil {
+		eh.dropLocked(err)
+	}
+}
+
+func (eh *EventHistoryStore) drop(err error) {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	eh.dropLocked(err)
+}
+
+func (eh *EventHistoryStore) dropLocked(err error) {
+	eh.dropped++
+	eh.lastDrop = err.Error()
+}
+
+func (eh *EventHistoryStore) closeLocked() {
+	if eh.file != nil {
+		eh.file.Close()
+		eh.file, eh.fileDay = nil, ""
+	}
+}
+
+func (eh *EventHistoryStore) dayPath(day string) string {
+	return filepath.Join(eh.config.Dir, "events-"+day+".ndjson")
+}
+
+// pruneLocked deletes the day files older than retention_days
+func (eh *EventHistoryStore) pruneLocked(now time.Time) {
+	cutoff := now.UTC().AddDate(0, 0, -eh.config.RetentionDays).Format("2006-01-02")
+	for _, day := range eh.daysLocked() {
+		if day < cutoff {
+			os.Remove(eh.dayPath(day))
+		}
+	}
+}
+
+// daysLocked lists the days with a history file, oldest first
+func (eh *EventHistoryStore) daysLocked() []string {
+	entries, err := os.ReadDir(eh.config.Dir)
+	if err != nil {
+		return nil
+	}
+	var days []string
+	for _, entry := range entries {
+		if match := eventHistoryFilePattern.FindStringSubmatch(entry.Name()); match != nil {
+			days = append(days, match[1])
+		}
+	}
+	sort.Strings(days)
+	return days
+}
+
+// Query returns the stored events between from and to, oldest first, optionally only
+// of the given types, and whether more than limit events matched
+func (eh *EventHistoryStore) Query(from, to time.Time, types map[string]bool, limit int) ([]HistoryEvent, bool, error) {
+	eh.mutex.Lock()
+	days := eh.daysLocked()
+	dir := eh.config.Dir
+	eh.mutex.Unlock()
+
+	events := []HistoryEvent{}
+	fromDay, toDay := from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02")
+	for _, day := range days {
+		if day < fromDay || day > toDay {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, "events-"+day+".ndjson"))
+		if err != nil {
+			return nil, false, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			var event HistoryEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				continue // a line cut short by a crash
+			}
+			if event.Time.Before(from) || event.Time.After(to) {
+				continue
+			}
+			if types != nil && !types[event.Type] {
+				continue
+			}
+			if len(events) == limit {
+				file.Close()
+				return events, true, nil
+			}
+			events = append(events, event)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return events, false, nil
+}
+
+// Status reports the stored days and write failures
+func (eh *EventHistoryStore) Status() map[string]interface{} {
+	eh.mutex.Lock()
+	defer eh.mutex.Unlock()
+	status := map[string]interface{}{
+		"config":  eh.config,
+		"days":    eh.daysLocked(),
+		"dropped": eh.dropped,
+	}
+	if eh.lastDrop != "" {
+		status["lastDropError"] = eh.lastDrop
+	}
+	return status
+}
+
+// RecordTimelineEvent stores a run timeline entry in the event history
+func (eh *EventHistoryStore) RecordTimelineEvent(runID string, event runs.TimelineEvent) {
+	eh.Record(HistoryEvent{
+		Time:    event.Time,
+		Type:    event.Type,
+		Source:  EventSourceRunTimeline,
+		RunID:   runID,
+		Message: event.Message,
+		Data:    event.Data,
+	})
+}
+
+// HandleAPIGetEventHistory Handles GET /api/events/history?from=&to=&type=&limit=
+// Returns the stored events between from and to (RFC3339, default the last hour),
+// optionally only of the comma-separated types, oldest first
+func HandleAPIGetEventHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	to := timeutil.Now()
+	from := to.Add(-defaultEventHistoryRange)
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Invalid %s time format: %v", name, err),
+				})
+				return
+			}
+			*target = parsed
+		}
+	}
+	if query.Get("from") == "" && query.Get("to") != "" {
+		from = to.Add(-defaultEventHistoryRange)
+	}
+	if from.After(to) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "from must not be after to",
+		})
+		return
+	}
+	limit := defaultEventHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxEventHistoryLimit {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("limit must be between 1 and %d", maxEventHistoryLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	events, truncated, err := EventHistory.Query(from, to, filterSet(query.Get("type")), limit)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read event history: %v", err),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d events between %s and %s", len(events), timeutil.Format(from), timeutil.Format(to)),
+		Data: map[string]interface{}{
+			"from":      from.UTC(),
+			"to":        to.UTC(),
+			"events":    events,
+			"truncated": truncated, // more events matched than limit
+			"status":    EventHistory.Status(),
+		},
+	})
+}
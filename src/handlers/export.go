@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Response formats supported by the data endpoints
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ResponseFormat picks the response format from ?format= or, failing that, the Accept header.
+// JSON is the default so browsers and existing clients are unaffected.
+func ResponseFormat(r *http.Request) (string, error) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "":
+	case FormatJSON, FormatCSV, FormatNDJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("format must be json, csv or ndjson")
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accepted, ";", 2)[0])
+		switch mediaType {
+		case "text/csv":
+			return FormatCSV, nil
+		case "application/x-ndjson", "application/ndjson":
+			return FormatNDJSON, nil
+		case "application/json":
+			return FormatJSON, nil
+		}
+	}
+	return FormatJSON, nil
+}
+
+// SendDataResponse sends the response as JSON, or its Data as CSV/NDJSON rows when the
+// client asked for one of those. Failed responses are always sent as JSON. name is used
+// for the download file name; ?table= selects one series of a multi-series payload.
+func SendDataResponse(w http.ResponseWriter, r *http.Request, status int, response APIResponse, name string) {
+	format, err := ResponseFormat(r)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if format == FormatJSON || !response.Success {
+		SendJSONResponse(w, status, response)
+		return
+	}
+
+	rows, err := exportRows(response.Data, r.URL.Query().Get("table"))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var body bytes.Buffer
+	if format == FormatCSV {
+		writeRowsCSV(&body, rows)
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		if err := writeRowsNDJSON(&body, rows); err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to encode rows: %v", err),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
+// jsonObject is a decoded JSON object that keeps its key order, so exported columns
+// follow the struct field order of the payload
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]interface{})}
+}
+
+func (o *jsonObject) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON writes the object with its keys in their original order
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered decodes the next JSON value, keeping object key order
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := newJSONObject()
+		for dec.More() {
+			keyToken, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(keyToken.(string), value)
+		}
+		_, err = dec.Token()
+		return obj, err
+	default:
+		values := make([]interface{}, 0)
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = dec.Token()
+		return values, err
+	}
+}
+
+// exportRows turns a response payload into flat rows:
+//   - an array becomes one row per element
+//   - an object holding arrays of objects becomes the rows of those arrays, with a
+//     "table" column naming the array (table picks a single one)
+//   - an object of objects (e.g. keyed by node) becomes one row per key
+//   - any other object becomes a single row
+//
+// Nested objects are flattened into dotted column names.
+func exportRows(data interface{}, table string) ([]*jsonObject, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if table != "" {
+		obj, ok := value.(*jsonObject)
+		if !ok {
+			return nil, fmt.Errorf("table %s not found", table)
+		}
+		selected, exists := obj.values[table]
+		if !exists {
+			return nil, fmt.Errorf("table %s not found, available: %s", table, strings.Join(obj.keys, ", "))
+		}
+		value = selected
+	}
+
+	switch typed := value.(type) {
+	case []interface{}:
+		return arrayRows(typed, "", ""), nil
+	case *jsonObject:
+		var tables []string
+		for _, key := range typed.keys {
+			if isObjectArray(typed.values[key]) {
+				tables = append(tables, key)
+			}
+		}
+		if len(tables) > 0 {
+			var rows []*jsonObject
+			for _, key := range tables {
+				column := "table"
+				if len(tables) == 1 {
+					column = ""
+				}
+				rows = append(rows, arrayRows(typed.values[key].([]interface{}), column, key)...)
+			}
+			return rows, nil
+		}
+
+		if len(typed.keys) > 0 && allObjects(typed) {
+			rows := make([]*jsonObject, 0, len(typed.keys))
+			for _, key := range typed.keys {
+				row := newJSONObject()
+				row.set("key", key)
+				flattenInto(row, "", typed.values[key])
+				rows = append(rows, row)
+			}
+			return rows, nil
+		}
+
+		row := newJSONObject()
+		flattenInto(row, "", typed)
+		return []*jsonObject{row}, nil
+	default:
+		row := newJSONObject()
+		row.set("value", typed)
+		return []*jsonObject{row}, nil
+	}
+}
+
+// arrayRows flattens each element into a row, optionally prefixed with a label column
+func arrayRows(values []interface{}, labelColumn, label string) []*jsonObject {
+	rows := make([]*jsonObject, 0, len(values))
+	for _, value := range values {
+		row := newJSONObject()
+		if labelColumn != "" {
+			row.set(labelColumn, label)
+		}
+		if _, ok := value.(*jsonObject); ok {
+			flattenInto(row, "", value)
+		} else {
+			row.set("value", value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// flattenInto copies value into row, joining nested object keys with dots. Arrays are
+// kept as values.
+func flattenInto(row *jsonObject, prefix string, value interface{}) {
+	obj, ok := value.(*jsonObject)
+	if !ok {
+		row.set(prefix, value)
+		return
+	}
+	for _, key := range obj.keys {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		flattenInto(row, name, obj.values[key])
+	}
+}
+
+func isObjectArray(value interface{}) bool {
+	values, ok := value.([]interface{})
+	if !ok || len(values) == 0 {
+		return false
+	}
+	_, ok = values[0].(*jsonObject)
+	return ok
+}
+
+func allObjects(obj *jsonObject) bool {
+	for _, key := range obj.keys {
+		if _, ok := obj.values[key].(*jsonObject); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRowsCSV writes the rows with a header holding the union of their columns
+func writeRowsCSV(buf *bytes.Buffer, rows []*jsonObject) {
+	columns := newJSONObject()
+	for _, row := range rows {
+		for _, key := range row.keys {
+			columns.set(key, nil)
+		}
+	}
+
+	writer := csv.NewWriter(buf)
+	writer.Write(columns.keys)
+	record := make([]string, len(columns.keys))
+	for _, row := range rows {
+		for i, column := range columns.keys {
+			record[i] = exportCell(row.values[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
+
+// writeRowsNDJSON writes one JSON object per line
+func writeRowsNDJSON(buf *bytes.Buffer, rows []*jsonObject) error {
+	for _, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// exportCell renders a decoded JSON value as a CSV field; arrays are written as JSON
+func exportCell(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case bool:
+		return fmt.Sprint(typed)
+	default:
+		encoded, _ := json.Marshal(typed)
+		return string(encoded)
+	}
+}
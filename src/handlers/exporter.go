@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+	"vuDataSim/src/exporter"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// MetricsSourceExporter marks NodeMetrics whose host metrics came from node_exporter
+const MetricsSourceExporter = "exporter"
+
+var NodeExporter = exporter.NewScraper()
+
+// StartExporterScraping scrapes the exporter_url of every enabled node in the background
+// and merges the normalized host metrics into the dashboard node data
+func StartExporterScraping() {
+	interval := time.Duration(NodeExporter.Config().ScrapeIntervalSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ScrapeNodeExporters()
+			<-ticker.C
+		}
+	}()
+}
+
+// ScrapeNodeExporters scrapes all configured exporters once
+func ScrapeNodeExporters() {
+	nodes := NodeManager.GetNodes()
+	names := make([]string, 0, len(nodes))
+	for name, config := range nodes {
+		if config.Enabled && config.ExporterURL != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	results := make(chan *exporter.Result, len(names))
+	for _, name := range names {
+		go func(name string, config node_control.NodeConfig) {
+			previous, scraped := NodeExporter.Latest(name)
+			result := NodeExporter.Scrape(name, config.ExporterURL)
+			// Only log when an exporter starts failing, not on every interval
+			if result.Error != "" && (!scraped || previous.Error == "") {
+				logger.LogWarning(name, "Exporter", result.Error)
+			}
+			results <- result
+		}(name, nodes[name])
+	}
+
+	updated := false
+	for range names {
+		result := <-results
+		if result.Error != "" {
+			continue
+		}
+		if applyExporterMetrics(result) {
+			updated = true
+		}
+	}
+	if updated {
+		go AppState.BroadcastUpdate()
+	}
+}
+
+// applyExporterMetrics copies the normalized host metrics of a scrape into the node data of AppState
+func applyExporterMetrics(result *exporter.Result) bool {
+	metrics := result.Metrics
+	if metrics.CPUUsedPercent == nil && metrics.MemUsedPercent == nil &&
+		metrics.CPUCores == nil && metrics.MemTotalGB == nil {
+		return false
+	}
+
+	node, _ := AppState.UpdateNode(result.Node, true, func(node *node_control.NodeMetrics) {
+		if metrics.CPUUsedPercent != nil {
+			node.CPU = *metrics.CPUUsedPercent
+		}
+		if metrics.MemUsedPercent != nil {
+			node.Memory = *metrics.MemUsedPercent
+		}
+		if metrics.CPUCores != nil {
+			node.TotalCPU = *metrics.CPUCores
+		}
+		if metrics.MemTotalGB != nil {
+			node.TotalMemory = *metrics.MemTotalGB
+		}
+		node.Source = MetricsSourceExporter
+		node.LastUpdate = timeutil.Now()
+		node.AgeSeconds, node.Stale = Staleness.Evaluate(node.LastUpdate, node.LastUpdate)
+	})
+	Availability.Heartbeat(result.Node, node.LastUpdate, Staleness.Threshold())
+	return true
+}
+
+// HandleAPINodeExporter Handles GET /api/nodes/{name}/exporter
+// Returns the latest normalized scrape, or the exporter's own output with ?raw=true
+func HandleAPINodeExporter(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+
+	config, exists := NodeManager.GetNodes()[nodeName]
+	if !exists {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s not found", nodeName),
+		})
+		return
+	}
+	if config.ExporterURL == "" {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s has no exporter_url configured", nodeName),
+		})
+		return
+	}
+
+	if r.URL.Query().Get("raw") == "true" {
+		body, err := NodeExporter.Fetch(config.ExporterURL)
+		if err != nil {
+			SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+		return
+	}
+
+	result, ok := NodeExporter.Latest(nodeName)
+	if !ok {
+		// Not scraped yet, e.g. the node was just added
+		result = NodeExporter.Scrape(nodeName, config.ExporterURL)
+	}
+
+	mode := config.ExporterMode
+	if mode == "" {
+		mode = node_control.ExporterModeMerge
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: result.Error == "",
+		Message: fmt.Sprintf("Exporter of node %s scraped at %s", nodeName, result.ScrapedAt.Format(time.RFC3339)),
+		Data: map[string]interface{}{
+			"mode":   mode,
+			"result": result,
+		},
+	})
+}
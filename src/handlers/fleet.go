@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fleet scheduler job types of fleet-wide binary starts and stops
+const (
+	JobTypeFleetStart = "binary_fleet_start"
+	JobTypeFleetStop  = "binary_fleet_stop"
+)
+
+// FleetStartConfig holds the fleet_start section of config.yaml
+type FleetStartConfig struct {
+	StaggerMs     int `yaml:"stagger_ms" json:"staggerMs"`         // delay between the starts of consecutive nodes
+	JitterMs      int `yaml:"jitter_ms" json:"jitterMs"`           // random extra delay per node, 0 to jitter_ms
+	MaxConcurrent int `yaml:"max_concurrent" json:"maxConcurrent"` // starts in flight at once
+}
+
+// FleetStarter starts the binary on every enabled node with a per-node delay, so the
+// simulators do not all connect to Kafka and start producing at the same moment
+type FleetStarter struct {
+	mutex  sync.Mutex
+	config FleetStartConfig
+}
+
+var FleetStart = &FleetStarter{config: defaultFleetStartConfig()}
+
+// FleetScheduler runs fleet-wide operations. It is separate from TransferScheduler so
+// a start does not wait behind file distributions.
+var FleetScheduler = jobs.NewScheduler()
+
+func defaultFleetStartConfig() FleetStartConfig {
+	return FleetStartConfig{StaggerMs: 2000, JitterMs: 500, MaxConcurrent: 10}
+}
+
+// LoadConfig reads the fleet_start section from the application config file
+func (fs *FleetStarter) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultFleetStartConfig()
+	fileConfig := struct {
+		FleetStart *FleetStartConfig `yaml:"fleet_start"`
+	}{FleetStart: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.StaggerMs < 0 {
+		config.StaggerMs = 0
+	}
+	if config.JitterMs < 0 {
+		config.JitterMs = 0
+	}
+
+	fs.mutex.Lock()
+	fs.config = config
+	fs.mutex.Unlock()
+	FleetScheduler.SetBudget(config.MaxConcurrent, 0)
+	return nil
+}
+
+// Config returns the fleet start settings
+func (fs *FleetStarter) Config() FleetStartConfig {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.config
+}
+
+// Start submits a job that starts the binary on the given nodes in name order, the
+// n-th node no earlier than n*stagger plus a random jitter after now
+func (fs *FleetStarter) Start(nodes []string, stagger, jitter time.Duration, timeout int) string {
+	sort.Strings(nodes)
+	now := time.Now()
+	tasks := make([]jobs.Task, 0, len(nodes))
+	for i, node := range nodes {
+		node := node
+		notBefore := now.Add(time.Duration(i) * stagger)
+		if jitter > 0 {
+			notBefore = notBefore.Add(time.Duration(rand.Int63n(int64(jitter) + 1)))
+		}
+		tasks = append(tasks, jobs.Task{
+			Name:      node,
+			NotBefore: notBefore,
+			Run: func(int) error {
+				response, err := BinaryControl.StartBinary(node, timeout)
+				if err != nil {
+					return err
+				}
+				if !response.Success {
+					return fmt.Errorf("%s", response.Message)
+				}
+				return nil
+			},
+		})
+	}
+
+	return FleetScheduler.Submit(JobTypeFleetStart, tasks, func(status jobs.JobStatus) {
+		fs.finished(status, stagger, jitter)
+	})
+}
+
+// finished logs the outcome of a fleet start and records it in the timeline of the
+// active run, if any
+func (fs *FleetStarter) finished(status jobs.JobStatus, stagger, jitter time.Duration) {
+	var failed []string
+	for _, task := range status.Tasks {
+		if task.Status == jobs.StatusFailed {
+			failed = append(failed, task.Name)
+		}
+	}
+	message := fmt.Sprintf("Fleet start %s started the binary on %d of %d nodes (stagger %v, jitter %v)",
+		status.ID, status.CompletedTasks, status.TotalTasks, stagger, jitter)
+	if len(failed) > 0 {
+		message += fmt.Sprintf("; failed: %v", failed)
+		logger.LogWarning("System", "Binary", message)
+	} else {
+		logger.LogSuccess("System", "Binary", message)
+	}
+
+	runID := AppState.Simulation().RunID
+	if runID == "" {
+		return
+	}
+	starts := make([]map[string]interface{}, 0, len(status.Tasks))
+	for _, task := range status.Tasks {
+		starts = append(starts, map[string]interface{}{
+			"node":        task.Name,
+			"status":      task.Status,
+			"scheduledAt": task.ScheduledAt,
+			"startedAt":   task.StartedAt,
+			"finishedAt":  task.FinishedAt,
+			"error":       task.Error,
+		})
+	}
+	if err := RunStore.AddTimelineEvent(runID, "fleet_started", message, map[string]interface{}{
+		"jobId":     status.ID,
+		"staggerMs": stagger.Milliseconds(),
+		"jitterMs":  jitter.Milliseconds(),
+		"starts":    starts,
+	}); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record fleet start for run %s: %v", runID, err))
+	}
+}
+
+// HandleAPIStartFleet Handles POST /api/binary/start
+// Starts the binary on every enabled node, staggered to avoid a Kafka connection storm.
+// Optional query: nodes (comma-separated subset), staggerMs and jitterMs to override
+// fleet_start, and timeout in minutes after which each binary stops again (default 30,
+// as for a single node). Returns 202 with the job to poll at /api/jobs/{id}; each task
+// reports when it was scheduled and when it started.
+func HandleAPIStartFleet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	config := FleetStart.Config()
+	values := map[string]*int{"staggerMs": &config.StaggerMs, "jitterMs": &config.JitterMs}
+	timeout := 30
+	values["timeout"] = &timeout
+	for name, target := range values {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || (name == "timeout" && parsed == 0) {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be a non-negative number (timeout a positive one)", name),
+			})
+			return
+		}
+		*target = parsed
+	}
+
+	nodes, ok := selectFleetNodes(w, query.Get("nodes"), "start")
+	if !ok {
+		return
+	}
+
+	stagger := time.Duration(config.StaggerMs) * time.Millisecond
+	jitter := time.Duration(config.JitterMs) * time.Millisecond
+	jobID := FleetStart.Start(nodes, stagger, jitter, timeout)
+	status, _ := FleetScheduler.Get(jobID)
+	logger.LogWithNode("System", "Binary", fmt.Sprintf("Starting the binary on %d nodes, %v apart (jitter %v), job %s", len(nodes), stagger, jitter, jobID), "info")
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Starting the binary on %d nodes over about %v", len(nodes), time.Duration(len(nodes)-1)*stagger+jitter),
+		Data:    status,
+	})
+}
+
+// selectFleetNodes returns the enabled nodes, or the subset named in nodes (comma-separated).
+// It answers the request itself and returns false when a node is unknown or none is left.
+func selectFleetNodes(w http.ResponseWriter, nodes, action string) ([]string, bool) {
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to load nodes config: %v", err),
+		})
+		return nil, false
+	}
+	enabled := BinaryControl.GetEnabledNodes()
+	selected := filterSet(nodes)
+	for name := range selected {
+		if _, ok := enabled[name]; !ok {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Node %s is not an enabled node", name),
+			})
+			return nil, false
+		}
+	}
+	var names []string
+	for name := range enabled {
+		if selected == nil || selected[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("No enabled nodes to %s", action),
+		})
+		return nil, false
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+// FleetStopPlan is the dry run of a fleet-wide stop
+type FleetStopPlan struct {
+	Nodes        []*bin_control.StopPlan `json:"nodes"`
+	RunningNodes int                     `json:"runningNodes"`
+	PIDs         int                     `json:"pids"` // binaries that would be killed
+	Children     int                     `json:"children"`
+	Timers       int                     `json:"killTimers"`
+	Errors       map[string]string       `json:"errors,omitempty"`      // nodes that could not be inspected
+	ActiveRunID  string                  `json:"activeRunId,omitempty"` // the run whose binaries would stop
+}
+
+// PlanFleetStop inspects the nodes in parallel and returns what a fleet stop would do
+func PlanFleetStop(nodes []string, options bin_control.StopOptions) *FleetStopPlan {
+	plan := &FleetStopPlan{Nodes: []*bin_control.StopPlan{}, Errors: make(map[string]string)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			nodePlan, err := BinaryControl.PlanStop(node, options)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				plan.Errors[node] = err.Error()
+				return
+			}
+			plan.Nodes = append(plan.Nodes, nodePlan)
+		}(node)
+	}
+	wg.Wait()
+
+	sort.Slice(plan.Nodes, func(i, j int) bool { return plan.Nodes[i].NodeName < plan.Nodes[j].NodeName })
+	for _, nodePlan := range plan.Nodes {
+		if nodePlan.Status != "running" {
+			continue
+		}
+		plan.RunningNodes++
+		plan.PIDs++
+		plan.Children += len(nodePlan.Children)
+		plan.Timers += len(nodePlan.Timers)
+	}
+	if len(plan.Errors) == 0 {
+		plan.Errors = nil
+	}
+	plan.ActiveRunID = AppState.Simulation().RunID
+	return plan
+}
+
+// StopFleet submits a job that stops the binary on the given nodes. Nodes where it is
+// not running count as done.
+func StopFleet(nodes []string, timeout int, options bin_control.StopOptions) string {
+	tasks := make([]jobs.Task, 0, len(nodes))
+	for _, node := range nodes {
+		node := node
+		tasks = append(tasks, jobs.Task{
+			Name: node,
+			Run: func(int) error {
+				if status, err := BinaryControl.GetBinaryStatus(node); err == nil && status.Status != "running" {
+					return nil
+				}
+				response, err := BinaryControl.StopBinaryWith(node, timeout, options)
+				if err != nil {
+					return err
+				}
+				if !response.Success {
+					return fmt.Errorf("%s", response.Message)
+				}
+				return nil
+			},
+		})
+	}
+	return FleetScheduler.Submit(JobTypeFleetStop, tasks, func(status jobs.JobStatus) {
+		message := fmt.Sprintf("Fleet stop %s finished on %d of %d nodes", status.ID, status.CompletedTasks, status.TotalTasks)
+		if status.FailedTasks > 0 {
+			logger.LogWarning("System", "Binary", message)
+		} else {
+			logger.LogSuccess("System", "Binary", message)
+		}
+	})
+}
+
+// HandleAPIStopFleet Handles POST /api/binary/stop
+// Stops the binary on every enabled node, or on ?nodes= (comma-separated). Returns 202
+// with the job to poll at /api/jobs/{id}. With ?dryRun=true nothing is stopped: every node
+// is inspected and the response lists the PIDs, child processes and kill timers that
+// would be affected, with the commands each stop would run.
+func HandleAPIStopFleet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	nodes, ok := selectFleetNodes(w, query.Get("nodes"), "stop")
+	if !ok {
+		return
+	}
+
+	options, err := parseStopOptions(query)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if query.Get("dryRun") == "true" {
+		plan := PlanFleetStop(nodes, options)
+		message := fmt.Sprintf("Dry run: would stop %d binaries on %d of %d nodes (%d child processes, %d kill timers), nothing was executed",
+			plan.PIDs, plan.RunningNodes, len(nodes), plan.Children, plan.Timers)
+		if len(plan.Errors) > 0 {
+			message += fmt.Sprintf("; %d nodes could not be inspected", len(plan.Errors))
+		}
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: message,
+			Data:    plan,
+		})
+		return
+	}
+
+	timeout := 30
+	if value := query.Get("timeout"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			timeout = parsed
+		}
+	}
+	jobID := StopFleet(nodes, timeout, options)
+	status, _ := FleetScheduler.Get(jobID)
+	logger.LogWithNode("System", "Binary", fmt.Sprintf("Stopping the binary on %d nodes, job %s", len(nodes), jobID), "info")
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Stopping the binary on %d nodes", len(nodes)),
+		Data:    status,
+	})
+}
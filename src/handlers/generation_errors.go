@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// generationErrorsArtifact holds the error and warning counts read from the simulator
+// logs during a run, one JSON record per node, source and poll
+const generationErrorsArtifact = "generation_errors.ndjson"
+
+// unattributedSource collects log lines that name no source
+const unattributedSource = "unattributed"
+
+// generationErrorsRunCheck is how often the tracker looks for a started or stopped run
+const generationErrorsRunCheck = 5 * time.Second
+
+// maxExampleLineLength truncates the example lines kept in the records
+const maxExampleLineLength = 300
+
+// GenerationErrorConfig holds the generation_errors section of config.yaml
+type GenerationErrorConfig struct {
+	Enabled         bool `yaml:"enabled" json:"enabled"`
+	IntervalSeconds int  `yaml:"interval_seconds" json:"intervalSeconds"`
+	// ErrorPattern and WarningPattern classify simulator log lines; a line matching both
+	// counts as an error
+	ErrorPattern   string `yaml:"error_pattern" json:"errorPattern"`
+	WarningPattern string `yaml:"warning_pattern" json:"warningPattern"`
+	// SourcePattern names the source of a line with its first capture group. Empty
+	// attributes a line to the enabled source whose name it contains.
+	SourcePattern   string `yaml:"source_pattern" json:"sourcePattern,omitempty"`
+	MaxBytesPerPoll int64  `yaml:"max_bytes_per_poll" json:"maxBytesPerPoll"`
+	MaxExamples     int    `yaml:"max_examples" json:"maxExamples"`
+}
+
+// GenerationErrorRecord is the count of error and warning lines one node logged for a
+// source between two polls
+type GenerationErrorRecord struct {
+	Time     time.Time `json:"time"`
+	Node     string    `json:"node"`
+	Source   string    `json:"source"`
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Examples []string  `json:"examples,omitempty"`
+}
+
+// SourceGenerationErrors is the error and warning count of one source over a run
+type SourceGenerationErrors struct {
+	Source   string         `json:"source"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+	Nodes    map[string]int `json:"nodes"` // errors and warnings per node
+	FirstAt  time.Time      `json:"firstAt"`
+	LastAt   time.Time      `json:"lastAt"`
+	Examples []string       `json:"examples,omitempty"`
+}
+
+// NodeLogStatus is where the tracker is in a node's simulator log
+type NodeLogStatus struct {
+	Node         string    `json:"node"`
+	LogFile      string    `json:"logFile"`
+	Offset       int64     `json:"offset"` // bytes of the log read so far
+	Missing      bool      `json:"missing,omitempty"`
+	SkippedBytes int64     `json:"skippedBytes,omitempty"` // not read because the log grew too fast
+	LastPollAt   time.Time `json:"lastPollAt"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// RunGenerationErrors is the "generation errors by source" panel of a run report
+type RunGenerationErrors struct {
+	RunID         string                   `json:"runId"`
+	TotalErrors   int                      `json:"totalErrors"`
+	TotalWarnings int                      `json:"totalWarnings"`
+	Sources       []SourceGenerationErrors `json:"sources"`         // most errors first
+	Nodes         []NodeLogStatus          `json:"nodes,omitempty"` // while the run is active
+}
+
+// nodeLogState is the read position in one node's simulator log
+type nodeLogState struct {
+	offset int64
+	status NodeLogStatus
+}
+
+// GenerationErrorTracker reads the simulator logs of the enabled nodes over SSH during
+// a run and counts error and warning lines per source, so failures to generate events
+// are not mistaken for low downstream EPS
+type GenerationErrorTracker struct {
+	polling   sync.Mutex // one read of the logs at a time, so no part is counted twice
+	mutex     sync.Mutex
+	config    GenerationErrorConfig
+	errorRe   *regexp.Regexp
+	warningRe *regexp.Regexp
+	sourceRe  *regexp.Regexp // nil attributes by enabled source name
+	runID     string
+	lastPoll  time.Time
+	nodes     map[string]*nodeLogState
+	reported  map[string]bool // sources already put on the run's timeline
+}
+
+var GenerationErrors = newGenerationErrorTracker()
+
+func defaultGenerationErrorConfig() GenerationErrorConfig {
+	return GenerationErrorConfig{
+		Enabled:         false,
+		IntervalSeconds: 30,
+		ErrorPattern:    `(?i)\b(error|fatal|panic|failed)\b`,
+		WarningPattern:  `(?i)\bwarn(ing)?\b`,
+		MaxBytesPerPoll: 4 * 1024 * 1024,
+		MaxExamples:     5,
+	}
+}
+
+func newGenerationErrorTracker() *GenerationErrorTracker {
+	config := defaultGenerationErrorConfig()
+	return &GenerationErrorTracker{
+		config:    config,
+		errorRe:   regexp.MustCompile(config.ErrorPattern),
+		warningRe: regexp.MustCompile(config.WarningPattern),
+		nodes:     make(map[string]*nodeLogState),
+	}
+}
+
+// LoadConfig reads the generation_errors section from the application config file.
+// While enabled, started simulators keep their output in the log the tracker reads.
+func (t *GenerationErrorTracker) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultGenerationErrorConfig()
+	wrapper := struct {
+		GenerationErrors *GenerationErrorConfig `yaml:"generation_errors"`
+	}{GenerationErrors: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 30
+	}
+	if config.MaxBytesPerPoll <= 0 {
+		config.MaxBytesPerPoll = 4 * 1024 * 1024
+	}
+	if config.MaxExamples < 0 {
+		config.MaxExamples = 0
+	}
+	errorRe, err := regexp.Compile(config.ErrorPattern)
+	if err != nil {
+		return fmt.Errorf("invalid generation_errors.error_pattern: %v", err)
+	}
+	warningRe, err := regexp.Compile(config.WarningPattern)
+	if err != nil {
+		return fmt.Errorf("invalid generation_errors.warning_pattern: %v", err)
+	}
+	var sourceRe *regexp.Regexp
+	if config.SourcePattern != "" {
+		if sourceRe, err = regexp.Compile(config.SourcePattern); err != nil {
+			return fmt.Errorf("invalid generation_errors.source_pattern: %v", err)
+		}
+		if sourceRe.NumSubexp() < 1 {
+			return fmt.Errorf("generation_errors.source_pattern needs a capture group naming the source")
+		}
+	}
+
+	t.mutex.Lock()
+	t.config = config
+	t.errorRe, t.warningRe, t.sourceRe = errorRe, warningRe, sourceRe
+	t.mutex.Unlock()
+	BinaryControl.SetKeepOutput(config.Enabled)
+	return nil
+}
+
+// Config returns the generation error settings
+func (t *GenerationErrorTracker) Config() GenerationErrorConfig {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.config
+}
+
+// Start follows the simulator logs of every run in the background
+func (t *GenerationErrorTracker) Start() {
+	if !t.Config().Enabled {
+		log.Println("Generation error tracking disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(generationErrorsRunCheck)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			t.Check(now)
+		}
+	}()
+}
+
+// Check starts following the logs when a run starts, reads them every interval and
+// reads them a last time when the run stops
+func (t *GenerationErrorTracker) Check(now time.Time) {
+	t.polling.Lock()
+	defer t.polling.Unlock()
+
+	sim := AppState.Simulation()
+	runID := ""
+	if sim.Running {
+		runID = sim.RunID
+	}
+
+	t.mutex.Lock()
+	previous := t.runID
+	interval := time.Duration(t.config.IntervalSeconds) * time.Second
+	due := now.Sub(t.lastPoll) >= interval
+	t.mutex.Unlock()
+
+	if previous != "" && previous != runID {
+		t.finish(previous)
+	}
+	if runID == "" {
+		return
+	}
+	if previous != runID {
+		// Skip what the logs held before the run; a simulator restarted for the run
+		// truncates its log and is read from the start
+		t.mutex.Lock()
+		t.runID, t.nodes, t.reported = runID, make(map[string]*nodeLogState), make(map[string]bool)
+		t.mutex.Unlock()
+		t.poll(runID)
+		return
+	}
+	if due {
+		t.poll(runID)
+	}
+}
+
+// Finish reads the logs of a stopped run a last time, so its report counts everything
+// logged until the stop, and stops following them
+func (t *GenerationErrorTracker) Finish(runID string) {
+	t.polling.Lock()
+	defer t.polling.Unlock()
+	t.mutex.Lock()
+	following := runID != "" && t.runID == runID
+	t.mutex.Unlock()
+	if following {
+		t.finish(runID)
+	}
+}
+
+func (t *GenerationErrorTracker) finish(runID string) {
+	t.poll(runID)
+	t.mutex.Lock()
+	t.runID, t.nodes, t.reported = "", make(map[string]*nodeLogState), nil
+	t.mutex.Unlock()
+}
+
+// poll reads what the simulator log of every enabled node gained since the last poll,
+// records the error and warning counts per source on the run and puts each source on
+// the run's timeline the first time it logs errors. Nodes seen for the first time are
+// only positioned at the end of their log.
+func (t *GenerationErrorTracker) poll(runID string) {
+	nodes := NodeManager.GetEnabledNodes()
+	t.mutex.Lock()
+	config := t.config
+	errorRe, warningRe := t.errorRe, t.warningRe
+	sourceRe := t.sourceRe
+	t.lastPoll = timeutil.Now()
+	states := make(map[string]nodeLogState, len(nodes))
+	for name := range nodes {
+		if state, ok := t.nodes[name]; ok {
+			states[name] = *state
+		}
+	}
+	t.mutex.Unlock()
+	enabled := O11yManager.GetEnabledSources()
+	if sourceRe == nil {
+		sourceRe = enabledSourcesPattern(enabled)
+	}
+	canonical := make(map[string]string, len(enabled))
+	for _, source := range enabled {
+		canonical[strings.ToLower(source)] = source
+	}
+	logFile := BinaryControl.VerifyConfig().ReadyLogFile
+
+	type nodeResult struct {
+		name    string
+		state   nodeLogState
+		records []GenerationErrorRecord
+	}
+	results := make(chan nodeResult, len(nodes))
+	for name, nodeConfig := range nodes {
+		state, known := states[name]
+		go func(name string, nodeConfig node_control.NodeConfig) {
+			result := nodeResult{name: name, state: state}
+			result.state.status = NodeLogStatus{Node: name, LogFile: remotecmd.Join(nodeConfig.BinaryDir, logFile), Offset: state.offset, SkippedBytes: state.status.SkippedBytes}
+			maxBytes := config.MaxBytesPerPoll
+			if !known {
+				maxBytes = 0
+			}
+			content, err := readNodeLog(nodeConfig, &result.state, maxBytes)
+			result.state.status.LastPollAt = timeutil.Now()
+			if err != nil {
+				result.state.status.Error = err.Error()
+			} else if known {
+				result.records = countGenerationErrors(name, content, errorRe, warningRe, sourceRe, canonical, config.MaxExamples, result.state.status.LastPollAt)
+			}
+			results <- result
+		}(name, nodeConfig)
+	}
+
+	var records []GenerationErrorRecord
+	t.mutex.Lock()
+	for range nodes {
+		result := <-results
+		state := result.state
+		if t.runID == runID {
+			t.nodes[result.name] = &state
+		}
+		records = append(records, result.records...)
+	}
+	var flagged []string
+	for _, record := range records {
+		if record.Errors > 0 && t.reported != nil && !t.reported[record.Source] && t.runID == runID {
+			t.reported[record.Source] = true
+			flagged = append(flagged, record.Source)
+		}
+	}
+	t.mutex.Unlock()
+	if len(records) == 0 {
+		return
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Node != records[j].Node {
+			return records[i].Node < records[j].Node
+		}
+		return records[i].Source < records[j].Source
+	})
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+	if err := RunStore.AppendArtifact(runID, runs.KindMetrics, generationErrorsArtifact, buf.Bytes()); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record generation errors for run %s: %v", runID, err))
+	}
+
+	sort.Strings(flagged)
+	for _, source := range flagged {
+		errors := 0
+		var nodeNames []string
+		for _, record := range records {
+			if record.Source == source && record.Errors > 0 {
+				errors += record.Errors
+				nodeNames = append(nodeNames, record.Node)
+			}
+		}
+		message := fmt.Sprintf("The simulator logged %d errors for %s on %s", errors, source, strings.Join(nodeNames, ", "))
+		logger.LogWarning("System", "GenerationErrors", fmt.Sprintf("Run %s: %s", runID, message))
+		if err := RunStore.AddTimelineEvent(runID, "generation_errors", message, map[string]interface{}{
+			"source": source,
+			"errors": errors,
+			"nodes":  nodeNames,
+		}); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record generation errors on run %s: %v", runID, err))
+		}
+	}
+}
+
+// readNodeLog reads up to maxBytes of the node's simulator log from the state's offset
+// and advances it past the complete lines read. A log that keeps growing faster than
+// it is read is skipped ahead to its end.
+func readNodeLog(nodeConfig node_control.NodeConfig, state *nodeLogState, maxBytes int64) (string, error) {
+	output, err := NodeManager.SSHExecWithOutput(nodeConfig, remotecmd.ReadFileFrom(state.status.LogFile, state.offset, maxBytes))
+	if err != nil {
+		return "", err
+	}
+	size, offset, content, missing, err := remotecmd.SplitFileFrom(output)
+	if err != nil {
+		return "", err
+	}
+	state.status.Missing = missing
+	if missing {
+		state.offset, state.status.Offset = 0, 0
+		return "", nil
+	}
+	if maxBytes == 0 {
+		state.offset, state.status.Offset = size, size
+		return "", nil
+	}
+
+	// Keep a partial last line for the next poll, unless it alone fills the read
+	if end := strings.LastIndexByte(content, '\n'); end >= 0 {
+		content = content[:end+1]
+	} else if int64(len(content)) < maxBytes {
+		content = ""
+	}
+	state.offset = offset + int64(len(content))
+	if backlog := size - state.offset; backlog > 4*maxBytes {
+		state.status.SkippedBytes += backlog
+		state.offset = size
+	}
+	state.status.Offset = state.offset
+	return content, nil
+}
+
+// countGenerationErrors counts the error and warning lines of a log excerpt per source.
+// Source names found in a different case are counted as the enabled source.
+func countGenerationErrors(node, content string, errorRe, warningRe, sourceRe *regexp.Regexp, canonical map[string]string, maxExamples int, now time.Time) []GenerationErrorRecord {
+	bySource := make(map[string]*GenerationErrorRecord)
+	for _, line := range strings.Split(content, "\n") {
+		isError := errorRe.MatchString(line)
+		if !isError && !warningRe.MatchString(line) {
+			continue
+		}
+		source := unattributedSource
+		if sourceRe != nil {
+			if match := sourceRe.FindStringSubmatch(line); len(match) > 1 && match[1] != "" {
+				source = match[1]
+				if enabled, ok := canonical[strings.ToLower(source)]; ok {
+					source = enabled
+				}
+			}
+		}
+		record := bySource[source]
+		if record == nil {
+			record = &GenerationErrorRecord{Time: now, Node: node, Source: source}
+			bySource[source] = record
+		}
+		if !isError {
+			record.Warnings++
+			continue
+		}
+		record.Errors++
+		if len(record.Examples) < maxExamples {
+			if len(line) > maxExampleLineLength {
+				line = line[:maxExampleLineLength] + "..."
+			}
+			record.Examples = append(record.Examples, strings.TrimSpace(line))
+		}
+	}
+
+	records := make([]GenerationErrorRecord, 0, len(bySource))
+	for _, record := range bySource {
+		records = append(records, *record)
+	}
+	return records
+}
+
+// enabledSourcesPattern matches the name of any of the sources in a log line, longer
+// names first so a source is not mistaken for another whose name it contains
+func enabledSourcesPattern(sources []string) *regexp.Regexp {
+	if len(sources) == 0 {
+		return nil
+	}
+	names := append([]string{}, sources...)
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for i, name := range names {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(names, "|") + `)\b`)
+}
+
+// summarizeGenerationErrors adds up the generation error records of a run per source
+func summarizeGenerationErrors(runID string, maxExamples int) (*RunGenerationErrors, error) {
+	summary := &RunGenerationErrors{RunID: runID, Sources: []SourceGenerationErrors{}}
+	sources := make(map[string]*SourceGenerationErrors)
+	err := readRunArtifactLines(runID, generationErrorsArtifact, func(line []byte) {
+		var record GenerationErrorRecord
+		if json.Unmarshal(line, &record) != nil {
+			return
+		}
+		entry := sources[record.Source]
+		if entry == nil {
+			entry = &SourceGenerationErrors{Source: record.Source, Nodes: make(map[string]int), FirstAt: record.Time}
+			sources[record.Source] = entry
+		}
+		entry.Errors += record.Errors
+		entry.Warnings += record.Warnings
+		entry.Nodes[record.Node] += record.Errors + record.Warnings
+		entry.LastAt = record.Time
+		for _, example := range record.Examples {
+			if len(entry.Examples) < maxExamples {
+				entry.Examples = append(entry.Examples, example)
+			}
+		}
+		summary.TotalErrors += record.Errors
+		summary.TotalWarnings += record.Warnings
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range sources {
+		summary.Sources = append(summary.Sources, *entry)
+	}
+	sort.Slice(summary.Sources, func(i, j int) bool {
+		a, b := summary.Sources[i], summary.Sources[j]
+		if a.Errors != b.Errors {
+			return a.Errors > b.Errors
+		}
+		if a.Warnings != b.Warnings {
+			return a.Warnings > b.Warnings
+		}
+		return a.Source < b.Source
+	})
+	return summary, nil
+}
+
+// NodeStatus returns the read position in every node's log for the followed run
+func (t *GenerationErrorTracker) NodeStatus(runID string) []NodeLogStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.runID != runID {
+		return nil
+	}
+	statuses := make([]NodeLogStatus, 0, len(t.nodes))
+	for _, state := range t.nodes {
+		statuses = append(statuses, state.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Node < statuses[j].Node })
+	return statuses
+}
+
+// HandleAPIGetRunGenerationErrors Handles GET /api/runs/{id}/generation-errors
+// Returns the errors and warnings the simulators logged per source during the run, with
+// the nodes that logged them and example lines. While the run is active it also lists
+// how far each node's log has been read. Supports ?format=csv|ndjson with ?table=sources.
+func HandleAPIGetRunGenerationErrors(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+
+	summary, err := summarizeGenerationErrors(runID, GenerationErrors.Config().MaxExamples)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	summary.Nodes = GenerationErrors.NodeStatus(runID)
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    summary,
+	}, runID+"-generation-errors")
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/node_control"
+)
+
+// maxGeneratorEPSBody bounds what is read from a generator's eps_url
+const maxGeneratorEPSBody = 64 << 10
+
+// GeneratorEPSPoller polls the eps_url of the load generators besides finalvudatasim, so
+// what they produce counts towards the fleet EPS like the simulators' pushed metrics
+type GeneratorEPSPoller struct {
+	mutex    sync.Mutex
+	reported map[string]bool // nodes whose GeneratorEPS was set by the last poll
+}
+
+var GeneratorEPS = &GeneratorEPSPoller{reported: make(map[string]bool)}
+
+// Start polls every eps_poll_seconds of the generators section
+func (p *GeneratorEPSPoller) Start() {
+	interval := time.Duration(BinaryControl.GeneratorsConfig().EPSPollSeconds) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.poll(interval)
+		}
+	}()
+}
+
+// poll fetches the EPS of every assigned generator with an eps_url in parallel. A
+// generator that does not answer, usually because it is stopped, counts as 0.
+func (p *GeneratorEPSPoller) poll(timeout time.Duration) {
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		return
+	}
+	targets := BinaryControl.GeneratorEPSTargets()
+
+	results := make(map[string]map[string]int)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target bin_control.GeneratorEPSTarget) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			eps, err := fetchGeneratorEPS(ctx, target.URL)
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if results[target.NodeName] == nil {
+				results[target.NodeName] = make(map[string]int)
+			}
+			results[target.NodeName][target.Generator] = eps
+		}(target)
+	}
+	wg.Wait()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for nodeName := range p.reported {
+		if _, ok := results[nodeName]; !ok {
+			AppState.UpdateNode(nodeName, false, func(node *node_control.NodeMetrics) { node.GeneratorEPS = nil })
+		}
+	}
+	p.reported = make(map[string]bool, len(results))
+	for nodeName, eps := range results {
+		if _, exists := AppState.UpdateNode(nodeName, false, func(node *node_control.NodeMetrics) { node.GeneratorEPS = eps }); exists {
+			p.reported[nodeName] = true
+		}
+	}
+}
+
+// fetchGeneratorEPS reads an eps_url answering with a bare number or a JSON object with
+// an "eps" field
+func fetchGeneratorEPS(ctx context.Context, url string) (int, error) {
+	resp, err := NodeClient.Get(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGeneratorEPSBody))
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(string(body))
+	if value, err := strconv.ParseFloat(text, 64); err == nil {
+		return int(value), nil
+	}
+	var payload struct {
+		EPS *float64 `json:"eps"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.EPS == nil {
+		return 0, fmt.Errorf("expected a number or {\"eps\": <number>}")
+	}
+	return int(*payload.EPS), nil
+}
+
+// HandleAPIGetGenerators Handles GET /api/binary/generators
+// Lists finalvudatasim and the load generators of config.yaml with their commands and
+// the nodes they are assigned to
+func HandleAPIGetGenerators(w http.ResponseWriter, r *http.Request) {
+	generators, err := BinaryControl.ListGenerators()
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d load generators", len(generators)),
+		Data:    generators,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"vuDataSim/src/logger"
+)
+
+// ResumeLeaderState reloads the run history written by the previous leader and, if it
+// left a simulation running, adopts that run so monitoring continues where it stopped
+func ResumeLeaderState() {
+	run, err := RunStore.Resume()
+	if err != nil {
+		logger.LogWarning("System", "HA", fmt.Sprintf("Failed to reload run history: %v", err))
+		return
+	}
+	if run == nil {
+		return
+	}
+
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		*sim = SimulationState{
+			Running:          true,
+			RunID:            run.ID,
+			Profile:          run.Profile,
+			TargetEPS:        run.TargetEPS,
+			TargetKafka:      run.TargetKafka,
+			TargetClickHouse: run.TargetClickHouse,
+			StartTime:        run.StartedAt,
+			DurationMinutes:  run.DurationMinutes,
+		}
+	})
+
+	message := fmt.Sprintf("Instance %s took over run %s", HA.InstanceID(), run.ID)
+	if err := RunStore.AddTimelineEvent(run.ID, "leader_takeover", message, nil); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record takeover on run %s: %v", run.ID, err))
+	}
+	logger.LogWithNode("System", "HA", message, "info")
+	go AppState.BroadcastUpdate()
+}
+
+// HandleAPIGetHAStatus Handles GET /api/ha/status
+// Returns 200 on the leader and 503 on a follower, so it can serve as a load balancer check
+func HandleAPIGetHAStatus(w http.ResponseWriter, r *http.Request) {
+	status := HA.Status()
+	code := http.StatusOK
+	if !HA.IsLeader() {
+		code = http.StatusServiceUnavailable
+	}
+	SendJSONResponse(w, code, APIResponse{
+		Success: code == http.StatusOK,
+		Message: fmt.Sprintf("Instance %s is the %s", status.InstanceID, status.Role),
+		Data:    status,
+	})
+}
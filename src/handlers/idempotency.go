@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IdempotencyConfig holds the idempotency section of config.yaml
+type IdempotencyConfig struct {
+	Enabled    bool `yaml:"enabled" json:"enabled"`
+	TTLMinutes int  `yaml:"ttl_minutes" json:"ttlMinutes"` // how long a stored outcome is replayed
+	MaxEntries int  `yaml:"max_entries" json:"maxEntries"` // oldest outcomes are dropped beyond this
+	MaxBodyKB  int  `yaml:"max_body_kb" json:"maxBodyKb"`  // larger responses are not stored
+}
+
+// IdempotentResponse is the stored outcome of the first attempt of a request
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+	StoredAt    time.Time
+}
+
+// idempotencyEntry is a key that is in flight (response nil) or has finished
+type idempotencyEntry struct {
+	fingerprint string
+	response    *IdempotentResponse
+	expires     time.Time
+}
+
+// IdempotencyStore remembers the outcome of mutating requests sent with an
+// Idempotency-Key header, so a client that retries after a timeout gets the first
+// response again instead of starting a second binary or distribution
+type IdempotencyStore struct {
+	mutex   sync.Mutex
+	config  IdempotencyConfig
+	entries map[string]*idempotencyEntry
+}
+
+var Idempotency = &IdempotencyStore{
+	config:  defaultIdempotencyConfig(),
+	entries: make(map[string]*idempotencyEntry),
+}
+
+func defaultIdempotencyConfig() IdempotencyConfig {
+	return IdempotencyConfig{Enabled: true, TTLMinutes: 60, MaxEntries: 10000, MaxBodyKB: 1024}
+}
+
+// LoadConfig reads the idempotency section from the application config file
+func (is *IdempotencyStore) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultIdempotencyConfig()
+	fileConfig := struct {
+		Idempotency *IdempotencyConfig `yaml:"idempotency"`
+	}{Idempotency: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.TTLMinutes <= 0 {
+		config.TTLMinutes = 60
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	if config.MaxBodyKB <= 0 {
+		config.MaxBodyKB = 1024
+	}
+
+	is.mutex.Lock()
+	is.config = config
+	is.mutex.Unlock()
+	return nil
+}
+
+// Config returns the idempotency settings
+func (is *IdempotencyStore) Config() IdempotencyConfig {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	return is.config
+}
+
+// Begin claims key for a request with the given fingerprint. It returns the stored
+// response of a finished first attempt, or inFlight when the first attempt has not
+// finished yet. With neither, the caller owns the key and must call Finish or Abandon.
+// A fingerprint that differs from the first attempt's is reported as a mismatch.
+func (is *IdempotencyStore) Begin(key, fingerprint string) (stored *IdempotentResponse, inFlight, mismatch bool) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	now := time.Now()
+	is.pruneLocked(now)
+	if entry, ok := is.entries[key]; ok {
+		if entry.fingerprint != fingerprint {
+			return nil, false, true
+		}
+		if entry.response == nil {
+			return nil, true, false
+		}
+		return entry.response, false, false
+	}
+	is.entries[key] = &idempotencyEntry{
+		fingerprint: fingerprint,
+		expires:     now.Add(time.Duration(is.config.TTLMinutes) * time.Minute),
+	}
+	return nil, false, false
+}
+
+// Finish stores the outcome of the first attempt for replay until the TTL expires
+func (is *IdempotencyStore) Finish(key string, response IdempotentResponse) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	entry, ok := is.entries[key]
+	if !ok {
+		return
+	}
+	response.Fingerprint = entry.fingerprint
+	response.StoredAt = time.Now()
+	entry.response = &response
+	entry.expires = response.StoredAt.Add(time.Duration(is.config.TTLMinutes) * time.Minute)
+}
+
+// Abandon releases a key without storing an outcome, so a retry runs the request again
+func (is *IdempotencyStore) Abandon(key string) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	delete(is.entries, key)
+}
+
+// pruneLocked drops expired outcomes and, beyond max_entries, the oldest finished ones
+func (is *IdempotencyStore) pruneLocked(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range is.entries {
+		if now.After(entry.expires) {
+			delete(is.entries, key)
+			continue
+		}
+		if entry.response != nil && (oldestKey == "" || entry.expires.Before(oldest)) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(is.entries) >= is.config.MaxEntries && oldestKey != "" {
+		delete(is.entries, oldestKey)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIGetNodeInventory Handles GET /api/nodes/{name}/inventory[?refresh=true]
+// Returns the node's OS, kernel, CPU model and tool versions as reported by its agent
+func HandleAPIGetNodeInventory(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+
+	node, ok := NodeManager.GetNodes()[nodeName]
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s not found", nodeName),
+		})
+		return
+	}
+
+	path := "/api/system/inventory"
+	if r.URL.Query().Get("refresh") == "true" {
+		path += "?refresh=true"
+	}
+
+	// Tool version commands may take a few seconds each on a cold refresh
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	resp, err := NodeClient.Get(ctx, node.AgentURL(path))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s is unreachable: %v", nodeName, err),
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read inventory from %s: %v", nodeName, err),
+		})
+		return
+	}
+	var inventory map[string]interface{}
+	if err := json.Unmarshal(body, &inventory); err != nil || resp.StatusCode != http.StatusOK {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid inventory response from %s (HTTP %d)", nodeName, resp.StatusCode),
+		})
+		return
+	}
+	if _, ok := inventory["collected_at"]; !ok {
+		// Agents deployed before inventory support answer with the catch-all status page
+		SendJSONResponse(w, http.StatusNotImplemented, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s does not support inventory, redeploy node_metrics_api", nodeName),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Inventory for %s retrieved", nodeName),
+		Data:    inventory,
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIListJobs Handles GET /api/jobs
+// Lists the transfer jobs followed by the fleet start jobs.
+func HandleAPIListJobs(w http.ResponseWriter, r *http.Request) {
+	maxConcurrent, bandwidthKbps := TransferScheduler.Budget()
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"jobs": append(TransferScheduler.List(), FleetScheduler.List()...),
+			"budget": map[string]int{
+				"maxConcurrentTransfers": maxConcurrent,
+				"transferBandwidthKbps":  bandwidthKbps,
+			},
+		},
+	})
+}
+
+// HandleAPIGetJob Handles GET /api/jobs/{id}
+func HandleAPIGetJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	status, ok := TransferScheduler.Get(id)
+	if !ok {
+		status, ok = FleetScheduler.Get(id)
+	}
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
@@ -4,12 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"vuDataSim/src/logger"
+	"vuDataSim/src/remotecmd"
 )
 
 // K6Config represents the K6 load testing configuration
@@ -20,8 +26,30 @@ type K6Config struct {
 	MaxDuration          int      `json:"maxDuration"` // seconds
 	EnabledScripts       []string `json:"enabledScripts"`
 	IntervalBetweenTests int      `json:"intervalBetweenTests"` // seconds
+	// Environment selects the target of Environments the scripts run against; empty keeps
+	// the target built into the scripts
+	Environment  string                   `json:"environment,omitempty"`
+	Environments map[string]K6Environment `json:"environments,omitempty"`
 }
 
+// K6Environment is a target the k6 scripts can run against, e.g. dev, staging or perf.
+// It reaches the scripts as K6_* environment variables.
+type K6Environment struct {
+	BaseURL               string `json:"baseUrl"`               // K6_BASE_URL, e.g. https://perf.example.com
+	UsersFile             string `json:"usersFile,omitempty"`   // K6_USERS_FILE, the user cookie file
+	Username              string `json:"username,omitempty"`    // K6_USERNAME
+	PasswordEnv           string `json:"passwordEnv,omitempty"` // manager environment variable passed on as K6_PASSWORD
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTlsVerify"` // K6_INSECURE_SKIP_TLS_VERIFY
+	CACertFile            string `json:"caCertFile,omitempty"`  // SSL_CERT_FILE, trusted instead of the system CAs
+}
+
+var (
+	// k6EnvironmentName matches the name of a K6 environment, e.g. perf-eu
+	k6EnvironmentName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	// envVarName matches the name of an environment variable holding a secret
+	envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
 // K6Status represents the current K6 execution status
 type K6Status struct {
 	IsRunning         bool      `json:"isRunning"`
@@ -194,8 +222,17 @@ func (h *K6Handler) StartK6Test(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	variables, password, err := h.environmentVariables()
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Cannot target the K6 environment: %v", err),
+		})
+		return
+	}
+
 	// Generate dynamic script with current configuration
-	scriptPath, err := h.generateK6Script()
+	scriptPath, err := h.generateK6Script(variables)
 	if err != nil {
 		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -205,19 +242,20 @@ func (h *K6Handler) StartK6Test(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Start K6 execution in background
-	go h.executeK6Script(scriptPath)
+	go h.executeK6Script(scriptPath, password)
 
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "K6 test started successfully",
 		Data: map[string]interface{}{
-			"scriptPath": scriptPath,
-			"userCount":  h.config.GlobalUserCount,
-			"duration":   h.config.TestDuration,
+			"scriptPath":  scriptPath,
+			"userCount":   h.config.GlobalUserCount,
+			"duration":    h.config.TestDuration,
+			"environment": h.config.Environment,
 		},
 	})
 
-	logger.LogWithNode("System", "k6", fmt.Sprintf("K6 test started: %d users, %s duration", h.config.GlobalUserCount, h.config.TestDuration), "info")
+	logger.LogWithNode("System", "k6", fmt.Sprintf("K6 test started: %d users, %s duration, environment %q", h.config.GlobalUserCount, h.config.TestDuration, h.config.Environment), "info")
 }
 
 // StopK6Test handles POST /api/k6/stop
@@ -277,18 +315,75 @@ func (h *K6Handler) validateConfig(config K6Config) error {
 		return fmt.Errorf("at least one script must be enabled")
 	}
 
+	for name, env := range config.Environments {
+		if !k6EnvironmentName.MatchString(name) {
+			return fmt.Errorf("environment name %q may only contain letters, digits, '.', '_' and '-'", name)
+		}
+		if parsed, err := url.Parse(env.BaseURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("environment %s: baseUrl must be an http or https URL", name)
+		}
+		if env.PasswordEnv != "" && !envVarName.MatchString(env.PasswordEnv) {
+			return fmt.Errorf("environment %s: passwordEnv must be the name of an environment variable", name)
+		}
+	}
+	if _, ok := config.Environments[config.Environment]; config.Environment != "" && !ok {
+		return fmt.Errorf("environment %s is not defined", config.Environment)
+	}
+
 	return nil
 }
 
+// environmentVariables returns the K6_* variables of the selected environment, sorted by
+// name, and the password separately so it is never written to the generated script.
+// Callers must hold h.mutex.
+func (h *K6Handler) environmentVariables() ([]string, string, error) {
+	if h.config.Environment == "" {
+		return nil, "", nil
+	}
+	env, ok := h.config.Environments[h.config.Environment]
+	if !ok {
+		return nil, "", fmt.Errorf("environment %s is not defined", h.config.Environment)
+	}
+
+	values := map[string]string{
+		"K6_ENVIRONMENT":              h.config.Environment,
+		"K6_BASE_URL":                 strings.TrimSuffix(env.BaseURL, "/"),
+		"K6_INSECURE_SKIP_TLS_VERIFY": strconv.FormatBool(env.InsecureSkipTLSVerify),
+	}
+	if env.UsersFile != "" {
+		values["K6_USERS_FILE"] = env.UsersFile
+	}
+	if env.Username != "" {
+		values["K6_USERNAME"] = env.Username
+	}
+	if env.CACertFile != "" {
+		values["SSL_CERT_FILE"] = env.CACertFile
+	}
+	password := ""
+	if env.PasswordEnv != "" {
+		password = os.Getenv(env.PasswordEnv)
+		if password == "" {
+			return nil, "", fmt.Errorf("environment variable %s with the password of environment %s is not set", env.PasswordEnv, h.config.Environment)
+		}
+	}
+
+	variables := make([]string, 0, len(values))
+	for name, value := range values {
+		variables = append(variables, name+"="+value)
+	}
+	sort.Strings(variables)
+	return variables, password, nil
+}
+
 // generateK6Script generates a dynamic K6 script based on current configuration
-func (h *K6Handler) generateK6Script() (string, error) {
+func (h *K6Handler) generateK6Script(variables []string) (string, error) {
 	template := `#!/bin/bash
 
 # Auto-generated K6 script
 # Generated at: %s
 # Global User Count: %d
 # Test Duration: %s
-
+%s
 echo "Starting K6 load test with %d users for %s duration"
 echo "Generated at: %s"
 echo "Working directory: $(pwd)"
@@ -328,11 +423,24 @@ echo "K6 load test completed"
 		scriptCommands += scriptCmd
 	}
 
+	// Export the target environment, if one is selected
+	var exports string
+	if len(variables) > 0 {
+		exports = fmt.Sprintf("\n# Target environment: %s\n", h.config.Environment)
+		for _, variable := range variables {
+			name, value, _ := strings.Cut(variable, "=")
+			exports += fmt.Sprintf("export %s=%s\n", name, remotecmd.Quote(value))
+		}
+	}
+
 	// Generate the complete script
 	generatedScript := fmt.Sprintf(template,
 		time.Now().Format("2006-01-02 15:04:05"),
 		h.config.GlobalUserCount,
 		h.config.TestDuration,
+		exports,
+		h.config.GlobalUserCount,
+		h.config.TestDuration,
 		time.Now().Format("2006-01-02 15:04:05"),
 		scriptCommands)
 
@@ -345,8 +453,9 @@ echo "K6 load test completed"
 	return scriptPath, nil
 }
 
-// executeK6Script executes the generated K6 script
-func (h *K6Handler) executeK6Script(scriptPath string) {
+// executeK6Script executes the generated K6 script, passing the environment's password
+// as K6_PASSWORD if it has one
+func (h *K6Handler) executeK6Script(scriptPath, password string) {
 	h.mutex.Lock()
 	h.status.IsRunning = true
 	h.status.StartTime = time.Now()
@@ -376,6 +485,9 @@ func (h *K6Handler) executeK6Script(scriptPath string) {
 	// Execute the script
 	cmd := exec.Command("/bin/bash", scriptPath)
 	cmd.Dir = "k6_final" // Working directory
+	if password != "" {
+		cmd.Env = append(os.Environ(), "K6_PASSWORD="+password)
+	}
 
 	// Set up process for potential cancellation
 	h.mutex.Lock()
@@ -411,6 +523,8 @@ func (h *K6Handler) ResetK6Config(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.mutex.Lock()
+	// The environments describe targets rather than test settings and are kept
+	defaultConfig.Environments = h.config.Environments
 	h.config = defaultConfig
 	h.status.CurrentUserCount = defaultConfig.GlobalUserCount
 	h.mutex.Unlock()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"vuDataSim/src/kafka_ch_reset"
 	"vuDataSim/src/logger"
@@ -24,6 +25,10 @@ type KafkaHandler struct {
 	kafkaManager *kafka_ch_reset.KafkaManager
 }
 
+// topicMapping is the topics_tables.yaml mapping of the Kafka handler, shared with
+// handlers outside it such as the pre-run table check
+var topicMapping *kafka_ch_reset.KafkaManager
+
 // NewKafkaHandler creates a new KafkaHandler instance
 func NewKafkaHandler() *KafkaHandler {
 	configPath := filepath.Join("src", "configs", "topics_tables.yaml")
@@ -33,6 +38,7 @@ func NewKafkaHandler() *KafkaHandler {
 	if err := kafkaManager.LoadConfig(); err != nil {
 		logger.Error().Err(err).Msg("Failed to load Kafka configuration")
 	}
+	topicMapping = kafkaManager
 
 	return &KafkaHandler{
 		kafkaManager: kafkaManager,
@@ -58,6 +64,34 @@ func (kh *KafkaHandler) GetTopics(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ReloadTopics handles POST /api/kafka/topics/reload - re-reads topics_tables.yaml without a restart
+func (kh *KafkaHandler) ReloadTopics(w http.ResponseWriter, r *http.Request) {
+	result, err := kh.kafkaManager.Reload()
+	if err != nil {
+		logger.LogWarning("System", "Kafka", fmt.Sprintf("topics_tables.yaml reload rejected: %v", err))
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Reload rejected, keeping the current mapping: %v", err),
+		})
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Reloaded %d topic groups: %s", result.Sources, result.Summary()),
+		Data:    result,
+	})
+}
+
+// WatchTopicsConfig reloads topics_tables.yaml whenever the file changes
+func (kh *KafkaHandler) WatchTopicsConfig(interval time.Duration) {
+	kh.kafkaManager.Watch(interval, func(result *kafka_ch_reset.ReloadResult, err error) {
+		if err != nil {
+			logger.LogWarning("System", "Kafka", fmt.Sprintf("topics_tables.yaml changed but was rejected, keeping the current mapping: %v", err))
+		}
+	})
+}
+
 // RecreateTopics handles POST /api/kafka/recreate - recreates topics for enabled o11y sources
 func (kh *KafkaHandler) RecreateTopics(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -68,6 +102,18 @@ func (kh *KafkaHandler) RecreateTopics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	justification, err := decodeJustification(r)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if !Environment.AuthorizeDestructive(w, r, DestructiveRecreateTopics, "enabled o11y sources", justification, nil) {
+		return
+	}
+
 	logger.Info().Msg("Starting Kafka topic recreation for enabled o11y sources from conf.yml")
 
 	result, err := kh.kafkaManager.RecreateTopicsForO11ySources()
@@ -166,6 +212,7 @@ func (kh *KafkaHandler) DescribeTopic(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteTopic handles DELETE /api/kafka/delete/{topic} - deletes a single topic
+// A protected environment needs a body {"justification": "..."}.
 func (kh *KafkaHandler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		sendJSONResponse(w, http.StatusMethodNotAllowed, APIResponse{
@@ -187,7 +234,19 @@ func (kh *KafkaHandler) DeleteTopic(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := kh.kafkaManager.DeleteTopic(topicName)
+	justification, err := decodeJustification(r)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if !Environment.AuthorizeDestructive(w, r, DestructiveDeleteTopic, topicName, justification, nil) {
+		return
+	}
+
+	err = kh.kafkaManager.DeleteTopic(topicName)
 	if err != nil {
 		logger.Error().Err(err).Str("topic", topicName).Msg("Failed to delete topic")
 		sendJSONResponse(w, http.StatusInternalServerError, APIResponse{
@@ -272,6 +331,7 @@ func (kh *KafkaHandler) CreateTopic(w http.ResponseWriter, r *http.Request) {
 }
 
 // RecreateTopicsForO11ySources handles POST /api/kafka/recreate/o11y - recreates topics for enabled o11y sources from conf.yml
+// A protected environment needs a body {"justification": "..."}.
 func (kh *KafkaHandler) RecreateTopicsForO11ySources(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		sendJSONResponse(w, http.StatusMethodNotAllowed, APIResponse{
@@ -281,6 +341,18 @@ func (kh *KafkaHandler) RecreateTopicsForO11ySources(w http.ResponseWriter, r *h
 		return
 	}
 
+	justification, err := decodeJustification(r)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	if !Environment.AuthorizeDestructive(w, r, DestructiveRecreateTopics, "enabled o11y sources", justification, nil) {
+		return
+	}
+
 	logger.Info().Msg("Starting Kafka topic recreation for enabled o11y sources from conf.yml")
 
 	result, err := kh.kafkaManager.RecreateTopicsForO11ySources()
@@ -313,6 +385,9 @@ func (kh *KafkaHandler) RecreateTopicsForO11ySources(w http.ResponseWriter, r *h
 }
 
 // TruncateClickHouseTables handles POST /api/clickhouse/truncate - truncates ClickHouse tables for enabled o11y sources
+// An optional body {"strategy": "drop_partitions", "runId": "..."} or {"strategy": "ttl"}
+// selects another reset strategy than clickhouse_reset.default_strategy. A protected
+// environment also needs a "justification".
 func (kh *KafkaHandler) TruncateClickHouseTables(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		sendJSONResponse(w, http.StatusMethodNotAllowed, APIResponse{
@@ -322,9 +397,34 @@ func (kh *KafkaHandler) TruncateClickHouseTables(w http.ResponseWriter, r *http.
 		return
 	}
 
+	req, err := decodeResetRequest(r)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	options, err := req.resetOptions()
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !Environment.AuthorizeDestructive(w, r, DestructiveResetTables, "enabled o11y sources", req.Justification, map[string]interface{}{"strategy": options.Strategy}) {
+		return
+	}
+	if options.Strategy != kafka_ch_reset.ResetTruncate {
+		kh.resetClickHouseTables(w, options)
+		return
+	}
+
 	logger.Info().Msg("Starting ClickHouse table truncation for enabled o11y sources")
 
 	result, err := kh.kafkaManager.TruncateClickHouseTablesForO11ySources()
+	result["strategy"] = kafka_ch_reset.ResetTruncate
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to truncate ClickHouse tables for enabled o11y sources")
 		sendJSONResponse(w, http.StatusInternalServerError, APIResponse{
@@ -384,11 +484,11 @@ func (kh *KafkaHandler) GetClickHouseTableNames(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	sendJSONResponse(w, http.StatusOK, APIResponse{
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "ClickHouse table names retrieved successfully for enabled o11y sources",
 		Data:    tableResult,
-	})
+	}, "clickhouse_tables")
 }
 
 // getAllTableNames extracts all table names from the configuration
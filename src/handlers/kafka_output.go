@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSourceKafkaOutput handles GET /api/o11y/sources/{source}/output/kafka - returns the source's output.kafka section
+func (kh *KafkaHandler) GetSourceKafkaOutput(w http.ResponseWriter, r *http.Request) {
+	source := mux.Vars(r)["source"]
+	output, err := O11yManager.GetSourceKafkaOutput(source)
+	if err != nil {
+		sendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    output,
+	})
+}
+
+// UpdateSourceKafkaOutput handles PUT /api/o11y/sources/{source}/output/kafka - updates enabled, topic and brokers.
+// The topic must be an input topic of the source in topics_tables.yaml. ?push=true copies the
+// changed conf.yml to all enabled nodes.
+func (kh *KafkaHandler) UpdateSourceKafkaOutput(w http.ResponseWriter, r *http.Request) {
+	source := mux.Vars(r)["source"]
+
+	var update o11y_source_manager.KafkaOutputUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid JSON payload",
+		})
+		return
+	}
+
+	if _, err := O11yManager.GetSourceKafkaOutput(source); err != nil {
+		sendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := o11y_source_manager.ValidateKafkaOutputUpdate(update); err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if update.Topic != nil {
+		if err := kh.kafkaManager.ValidateSourceInputTopic(source, *update.Topic); err != nil {
+			sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	output, err := O11yManager.UpdateSourceKafkaOutput(source, update)
+	if err != nil {
+		sendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to update Kafka output: %v", err),
+		})
+		return
+	}
+	logger.LogWithNode("System", "O11y", fmt.Sprintf("Updated output.kafka of %s (topic: %s, enabled: %v)", source, output.Topic, output.Enabled), "info")
+
+	data := map[string]interface{}{"output": output}
+	if r.URL.Query().Get("push") == "true" {
+		results, err := O11yManager.PushConfDFiles([]string{filepath.Join(source, "conf.yml")})
+		if err != nil {
+			sendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Kafka output updated but push failed: %v", err),
+				Data:    data,
+			})
+			return
+		}
+		data["push"] = results
+		for _, result := range results {
+			if !result.Success {
+				sendJSONResponse(w, http.StatusPartialContent, APIResponse{
+					Success: false,
+					Message: "Kafka output updated but not pushed to all nodes",
+					Data:    data,
+				})
+				return
+			}
+		}
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Kafka output of %s updated", source),
+		Data:    data,
+	})
+}
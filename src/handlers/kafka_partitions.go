@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// parsePartitionReportOptions reads ?windowSeconds= and ?hotFactor= of a partition report
+func parsePartitionReportOptions(query url.Values) (time.Duration, float64, error) {
+	window := kafka_ch_reset.DefaultPartitionWindow
+	hotFactor := kafka_ch_reset.DefaultPartitionHotFactor
+	if value := query.Get("windowSeconds"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		maxSeconds := int(kafka_ch_reset.MaxPartitionWindow / time.Second)
+		if err != nil || parsed <= 0 || parsed > maxSeconds {
+			return 0, 0, fmt.Errorf("windowSeconds must be between 1 and %d", maxSeconds)
+		}
+		window = time.Duration(parsed) * time.Second
+	}
+	if value := query.Get("hotFactor"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 1 {
+			return 0, 0, fmt.Errorf("hotFactor must be a number greater than 1")
+		}
+		hotFactor = parsed
+	}
+	return window, hotFactor, nil
+}
+
+// GetTopicPartitions handles GET /api/kafka/topics/{topic}/partitions - samples the
+// partitions of a topic over a window and returns their message rates and sizes,
+// flagging hot and idle partitions
+func (kh *KafkaHandler) GetTopicPartitions(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["topic"]
+	if !kafka_ch_reset.ValidTopicName(topicName) {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid topic name %q", topicName),
+		})
+		return
+	}
+	window, hotFactor, err := parsePartitionReportOptions(r.URL.Query())
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(window + time.Minute))
+
+	report, err := kh.kafkaManager.TopicPartitionReport(topicName, window, hotFactor)
+	if err != nil {
+		logger.Error().Err(err).Str("topic", topicName).Msg("Failed to sample topic partitions")
+		sendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Topic %s is not available: %v", topicName, err),
+		})
+		return
+	}
+	if report.Skewed {
+		logger.LogWarning("System", "Kafka", report.Summary)
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: report.Summary,
+		Data:    report,
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// parseProduceTestOptions reads ?messages= and ?timeoutSeconds= of a produce test
+func parseProduceTestOptions(query url.Values) (int, time.Duration, error) {
+	messages := kafka_ch_reset.DefaultProduceTestMessages
+	timeout := kafka_ch_reset.DefaultProduceTestTimeout
+	if value := query.Get("messages"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > kafka_ch_reset.MaxProduceTestMessages {
+			return 0, 0, fmt.Errorf("messages must be between 1 and %d", kafka_ch_reset.MaxProduceTestMessages)
+		}
+		messages = parsed
+	}
+	if value := query.Get("timeoutSeconds"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		maxSeconds := int(kafka_ch_reset.MaxProduceTestTimeout / time.Second)
+		if err != nil || parsed <= 0 || parsed > maxSeconds {
+			return 0, 0, fmt.Errorf("timeoutSeconds must be between 1 and %d", maxSeconds)
+		}
+		timeout = time.Duration(parsed) * time.Second
+	}
+	return messages, timeout, nil
+}
+
+// ProduceTest handles POST /api/kafka/produce-test/{topic} - produces a small batch of
+// synthetic messages and checks they can be consumed back, returning the round-trip latency
+func (kh *KafkaHandler) ProduceTest(w http.ResponseWriter, r *http.Request) {
+	topicName := mux.Vars(r)["topic"]
+	if !kafka_ch_reset.ValidTopicName(topicName) {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid topic name %q", topicName),
+		})
+		return
+	}
+	messages, timeout, err := parseProduceTestOptions(r.URL.Query())
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// Producing and consuming start console clients in the Kafka pod, which can take
+	// longer than the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(2*timeout + time.Minute))
+
+	result, err := kh.kafkaManager.ProduceTest(topicName, messages, timeout)
+	if err != nil {
+		logger.Error().Err(err).Str("topic", topicName).Msg("Failed to start produce test")
+		sendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Topic %s is not available: %v", topicName, err),
+		})
+		return
+	}
+
+	if !result.Passed {
+		logger.Error().Str("topic", topicName).Str("error", result.Error).Msg("Kafka produce test failed")
+		sendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Produce test on %s failed: %s", topicName, result.Error),
+			Data:    result,
+		})
+		return
+	}
+
+	logger.Info().Str("topic", topicName).Int64("round_trip_ms", result.RoundTripMs).Msg("Kafka produce test passed")
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Produced and consumed %d messages on %s in %d ms", result.Consumed, topicName, result.RoundTripMs),
+		Data:    result,
+	})
+}
@@ -116,7 +116,7 @@ func HandleAPIGetKubernetesPods(w http.ResponseWriter, r *http.Request) {
 			Status:    item.Status.Phase,
 			IP:        item.Status.PodIP,
 			QoS:       item.Status.QoSClass,
-			Age:       item.Metadata.CreationTimestamp.Format(time.RFC3339),
+			Age:       item.Metadata.CreationTimestamp.UTC().Format(time.RFC3339),
 		}
 
 		// Ready status
@@ -154,7 +154,7 @@ func HandleAPIGetKubernetesPods(w http.ResponseWriter, r *http.Request) {
 		var lastRestarts []string
 		for _, cs := range item.Status.ContainerStatuses {
 			if !cs.State.Terminated.FinishedAt.IsZero() {
-				lastRestarts = append(lastRestarts, cs.State.Terminated.FinishedAt.Format(time.RFC3339))
+				lastRestarts = append(lastRestarts, cs.State.Terminated.FinishedAt.UTC().Format(time.RFC3339))
 			}
 		}
 		pod.LastRestart = fmt.Sprintf("%s", lastRestarts) // Join with ", "
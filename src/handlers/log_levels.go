@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"vuDataSim/src/logger"
+)
+
+// HandleAPIGetLogLevels Handles GET /api/logging/levels
+// Returns the log level of every module
+func HandleAPIGetLogLevels(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    logger.Levels(),
+	})
+}
+
+// HandleAPISetLogLevels Handles PUT /api/logging/levels
+// Body: {"o11y": "debug", "ssh": "info"}. Modules not in the body keep their level. The
+// change applies immediately and is saved, so it survives a restart.
+func HandleAPISetLogLevels(w http.ResponseWriter, r *http.Request) {
+	var changes map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil || len(changes) == 0 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf(`Body must map modules to levels, e.g. {"o11y": "debug"}; modules: %s`, strings.Join(logger.Modules, ", ")),
+		})
+		return
+	}
+
+	levels, err := logger.SetLevels(changes)
+	if levels == nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	modules := make([]string, 0, len(changes))
+	for module := range changes {
+		modules = append(modules, fmt.Sprintf("%s=%s", module, levels[module]))
+	}
+	sort.Strings(modules)
+	message := fmt.Sprintf("Log levels changed: %s", strings.Join(modules, ", "))
+	logger.LogWithNode("System", "API", message, "info")
+	if err != nil {
+		logger.LogWarning("System", "API", fmt.Sprintf("Log levels applied but not saved: %v", err))
+		message += fmt.Sprintf("; not saved, the change is lost on restart: %v", err)
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    levels,
+	})
+}
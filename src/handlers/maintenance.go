@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// MaintenanceScopeScheduledRuns covers runs started by a schedule rather than by a person
+const MaintenanceScopeScheduledRuns = "scheduled_runs"
+
+// maintenanceScopes are the values a window scope may list: the notification events
+// that raise alerts, the digest, and scheduled runs. Test notifications are never held back.
+var maintenanceScopes = []string{
+	notify.EventWatchdog,
+	notify.EventStorage,
+	notify.EventViewLag,
+	notify.EventReservation,
+	notify.EventDigest,
+	MaintenanceScopeScheduledRuns,
+}
+
+// Maintenance window states
+const (
+	MaintenanceUpcoming = "upcoming"
+	MaintenanceActive   = "active"
+	MaintenanceEnded    = "ended"
+)
+
+// MaintenanceConfig holds the maintenance section of config.yaml
+type MaintenanceConfig struct {
+	File          string `yaml:"file" json:"file"`
+	KeepEndedDays int    `yaml:"keep_ended_days" json:"keepEndedDays"` // ended windows are dropped after this
+	MaxSuppressed int    `yaml:"max_suppressed" json:"maxSuppressed"`  // suppressed items kept per window
+}
+
+// MaintenanceRecord is an alert held back or a scheduled run skipped during a window
+type MaintenanceRecord struct {
+	Time     time.Time `json:"time"`
+	Scope    string    `json:"scope"` // the notification event, or scheduled_runs
+	Severity string    `json:"severity,omitempty"`
+	Subject  string    `json:"subject"`
+	Text     string    `json:"text,omitempty"`
+}
+
+// MaintenanceWindow is a period the lab is deliberately down, e.g. for patching. While
+// it is active the alerts and scheduled runs in its scope are suppressed and recorded.
+type MaintenanceWindow struct {
+	ID              string              `json:"id"`
+	Start           time.Time           `json:"start"`
+	End             time.Time           `json:"end"`
+	Scope           []string            `json:"scope,omitempty"` // empty covers every alert and scheduled runs
+	Reason          string              `json:"reason,omitempty"`
+	Status          string              `json:"status"`
+	CreatedBy       string              `json:"createdBy,omitempty"`
+	CreatedAt       time.Time           `json:"createdAt"`
+	EndedBy         string              `json:"endedBy,omitempty"` // who ended it early
+	SuppressedCount int                 `json:"suppressedCount"`
+	Suppressed      []MaintenanceRecord `json:"suppressed,omitempty"` // the latest max_suppressed
+}
+
+// MaintenanceStatus is the response of GET /api/maintenance
+type MaintenanceStatus struct {
+	Active  []MaintenanceWindow `json:"active"`
+	Windows []MaintenanceWindow `json:"windows"`
+	Scopes  []string            `json:"scopes"`
+}
+
+// MaintenanceSchedule keeps the maintenance windows on disk and answers whether an
+// alert or scheduled run falls into one
+type MaintenanceSchedule struct {
+	mutex   sync.Mutex
+	config  MaintenanceConfig
+	windows []*MaintenanceWindow
+	active  map[string]bool // windows active at the last check, to announce changes
+}
+
+var errMaintenanceNotFound = errors.New("maintenance window not found")
+
+var Maintenance = &MaintenanceSchedule{config: defaultMaintenanceConfig(), active: make(map[string]bool)}
+
+func defaultMaintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{
+		File:          "data/maintenance_windows.json",
+		KeepEndedDays: 30,
+		MaxSuppressed: 100,
+	}
+}
+
+// LoadConfig reads the maintenance section from the application config file and the
+// stored windows
+func (m *MaintenanceSchedule) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig struct {
+		Maintenance *MaintenanceConfig `yaml:"maintenance"`
+	}
+	config := defaultMaintenanceConfig()
+	fileConfig.Maintenance = &config
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.File == "" {
+		config.File = defaultMaintenanceConfig().File
+	}
+	if config.KeepEndedDays <= 0 {
+		config.KeepEndedDays = 30
+	}
+	if config.MaxSuppressed <= 0 {
+		config.MaxSuppressed = 100
+	}
+
+	var windows []*MaintenanceWindow
+	data, err = os.ReadFile(config.File)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read maintenance windows: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &windows); err != nil {
+			return fmt.Errorf("failed to parse maintenance windows: %v", err)
+		}
+	}
+
+	m.mutex.Lock()
+	m.config = config
+	m.windows = windows
+	m.mutex.Unlock()
+	return nil
+}
+
+// Start checks every 30 seconds for windows that began or ended, announces them to the
+// dashboards and drops windows that ended more than keep_ended_days ago
+func (m *MaintenanceSchedule) Start() {
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		m.Check(timeutil.Now())
+		for range ticker.C {
+			m.Check(timeutil.Now())
+		}
+	}()
+}
+
+// Check announces the windows that began or ended since the last check
+func (m *MaintenanceSchedule) Check(now time.Time) {
+	m.mutex.Lock()
+	var started, ended []MaintenanceWindow
+	active := make(map[string]bool)
+	for _, window := range m.windows {
+		copied := m.copyLocked(window, now, false)
+		if copied.Status == MaintenanceActive {
+			active[window.ID] = true
+			if !m.active[window.ID] {
+				started = append(started, copied)
+			}
+		} else if m.active[window.ID] {
+			ended = append(ended, copied)
+		}
+	}
+	m.active = active
+
+	cutoff := now.AddDate(0, 0, -m.config.KeepEndedDays)
+	kept := m.windows[:0]
+	for _, window := range m.windows {
+		if window.End.After(cutoff) {
+			kept = append(kept, window)
+		}
+	}
+	pruned := len(kept) < len(m.windows)
+	m.windows = kept
+	if pruned {
+		if err := m.saveLocked(); err != nil {
+			logger.Warn().Err(err).Msg("Failed to save maintenance windows")
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, window := range started {
+		logger.LogWarning("System", "Maintenance", fmt.Sprintf("Maintenance window %s started (%s), until %s", window.ID, describeMaintenanceScope(window.Scope), timeutil.Format(window.End)))
+		AppState.BroadcastEvent("maintenance_started", window)
+	}
+	for _, window := range ended {
+		logger.LogWithNode("System", "Maintenance", fmt.Sprintf("Maintenance window %s ended, %d alerts and scheduled runs suppressed", window.ID, window.SuppressedCount), "info")
+		AppState.BroadcastEvent("maintenance_ended", window)
+	}
+	if len(started) > 0 || len(ended) > 0 {
+		AppState.BroadcastUpdate()
+	}
+}
+
+// Create validates and stores a new window
+func (m *MaintenanceSchedule) Create(window MaintenanceWindow, by string, now time.Time) (MaintenanceWindow, error) {
+	if window.Start.IsZero() {
+		window.Start = now
+	}
+	if window.End.IsZero() {
+		return MaintenanceWindow{}, fmt.Errorf("end is required")
+	}
+	if !window.End.After(window.Start) {
+		return MaintenanceWindow{}, fmt.Errorf("end must be after start")
+	}
+	if !window.End.After(now) {
+		return MaintenanceWindow{}, fmt.Errorf("end %s is in the past", timeutil.Format(window.End))
+	}
+	for _, scope := range window.Scope {
+		if !containsString(maintenanceScopes, scope) {
+			return MaintenanceWindow{}, fmt.Errorf("unknown scope %q, use %s", scope, strings.Join(maintenanceScopes, ", "))
+		}
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	stored := &MaintenanceWindow{
+		ID:        "mw-" + hex.EncodeToString(suffix),
+		Start:     window.Start.UTC(),
+		End:       window.End.UTC(),
+		Scope:     window.Scope,
+		Reason:    window.Reason,
+		CreatedBy: by,
+		CreatedAt: now,
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.windows = append(m.windows, stored)
+	if err := m.saveLocked(); err != nil {
+		m.windows = m.windows[:len(m.windows)-1]
+		return MaintenanceWindow{}, err
+	}
+	return m.copyLocked(stored, now, true), nil
+}
+
+// End ends an active window now, or deletes one that has not started yet
+func (m *MaintenanceSchedule) End(id, by string, now time.Time) (MaintenanceWindow, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, window := range m.windows {
+		if window.ID != id {
+			continue
+		}
+		previous, windows := *window, m.windows
+		switch maintenanceState(window, now) {
+		case MaintenanceEnded:
+			return MaintenanceWindow{}, fmt.Errorf("maintenance window %s already ended at %s", id, timeutil.Format(window.End))
+		case MaintenanceUpcoming:
+			m.windows = append(append([]*MaintenanceWindow(nil), windows[:i]...), windows[i+1:]...)
+		default:
+			window.End = now
+			window.EndedBy = by
+		}
+		if err := m.saveLocked(); err != nil {
+			*window, m.windows = previous, windows
+			return MaintenanceWindow{}, err
+		}
+		return m.copyLocked(window, now, true), nil
+	}
+	return MaintenanceWindow{}, errMaintenanceNotFound
+}
+
+// Status returns the active windows and every stored window, oldest start first
+func (m *MaintenanceSchedule) Status(now time.Time) MaintenanceStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	status := MaintenanceStatus{
+		Active:  []MaintenanceWindow{},
+		Windows: make([]MaintenanceWindow, 0, len(m.windows)),
+		Scopes:  maintenanceScopes,
+	}
+	for _, window := range m.windows {
+		copied := m.copyLocked(window, now, true)
+		if copied.Status == MaintenanceActive {
+			status.Active = append(status.Active, copied)
+		}
+		status.Windows = append(status.Windows, copied)
+	}
+	sort.Slice(status.Windows, func(i, j int) bool { return status.Windows[i].Start.Before(status.Windows[j].Start) })
+	return status
+}
+
+// Active returns the windows active at now without their suppressed items, for the
+// dashboard badge
+func (m *MaintenanceSchedule) Active(now time.Time) []MaintenanceWindow {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var active []MaintenanceWindow
+	for _, window := range m.windows {
+		if maintenanceState(window, now) == MaintenanceActive {
+			active = append(active, m.copyLocked(window, now, false))
+		}
+	}
+	return active
+}
+
+// Suppress records message against the active window covering its event and reports
+// whether it must not be sent. Test notifications are always sent.
+func (m *MaintenanceSchedule) Suppress(message notify.Message, now time.Time) bool {
+	if message.Event == notify.EventTest {
+		return false
+	}
+	return m.record(MaintenanceRecord{
+		Time:     now,
+		Scope:    message.Event,
+		Severity: message.Severity,
+		Subject:  message.Subject,
+		Text:     message.Text,
+	})
+}
+
+// SkipScheduled records a scheduled run that is due during a window covering scheduled
+// runs and reports whether the scheduler must skip it
+func (m *MaintenanceSchedule) SkipScheduled(name string, now time.Time) bool {
+	return m.record(MaintenanceRecord{
+		Time:    now,
+		Scope:   MaintenanceScopeScheduledRuns,
+		Subject: fmt.Sprintf("Scheduled run %s skipped", name),
+	})
+}
+
+// record adds item to the first active window covering its scope, saves the windows and
+// keeps the item in the event history
+func (m *MaintenanceSchedule) record(item MaintenanceRecord) bool {
+	m.mutex.Lock()
+	var window *MaintenanceWindow
+	for _, candidate := range m.windows {
+		if maintenanceState(candidate, item.Time) == MaintenanceActive && coversScope(candidate.Scope, item.Scope) {
+			window = candidate
+			break
+		}
+	}
+	if window == nil {
+		m.mutex.Unlock()
+		return false
+	}
+	window.SuppressedCount++
+	window.Suppressed = append(window.Suppressed, item)
+	if excess := len(window.Suppressed) - m.config.MaxSuppressed; excess > 0 {
+		window.Suppressed = append([]MaintenanceRecord(nil), window.Suppressed[excess:]...)
+	}
+	windowID := window.ID
+	if err := m.saveLocked(); err != nil {
+		logger.Warn().Err(err).Msg("Failed to save maintenance windows")
+	}
+	m.mutex.Unlock()
+
+	logger.LogWithNode("System", "Maintenance", fmt.Sprintf("Suppressed during maintenance window %s: %s", windowID, item.Subject), "info")
+	EventHistory.Record(HistoryEvent{
+		Time:    item.Time,
+		Type:    "maintenance_suppressed",
+		Source:  EventSourceMaintenance,
+		RunID:   AppState.Simulation().RunID,
+		Message: item.Subject,
+		Data:    map[string]interface{}{"windowId": windowID, "scope": item.Scope, "severity": item.Severity, "text": item.Text},
+	})
+	return true
+}
+
+// copyLocked returns a copy of window with its state at now; callers must hold the lock
+func (m *MaintenanceSchedule) copyLocked(window *MaintenanceWindow, now time.Time, withSuppressed bool) MaintenanceWindow {
+	copied := *window
+	copied.Status = maintenanceState(window, now)
+	copied.Scope = append([]string(nil), window.Scope...)
+	copied.Suppressed = nil
+	if withSuppressed {
+		copied.Suppressed = append([]MaintenanceRecord(nil), window.Suppressed...)
+	}
+	return copied
+}
+
+// saveLocked writes the windows; callers must hold the lock
+func (m *MaintenanceSchedule) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(m.config.File), 0755); err != nil {
+		return fmt.Errorf("failed to create maintenance directory: %v", err)
+	}
+	data, err := json.MarshalIndent(m.windows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance windows: %v", err)
+	}
+	tmp := m.config.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write maintenance windows: %v", err)
+	}
+	return os.Rename(tmp, m.config.File)
+}
+
+func maintenanceState(window *MaintenanceWindow, now time.Time) string {
+	switch {
+	case now.Before(window.Start):
+		return MaintenanceUpcoming
+	case now.Before(window.End):
+		return MaintenanceActive
+	default:
+		return MaintenanceEnded
+	}
+}
+
+func coversScope(scopes []string, scope string) bool {
+	return len(scopes) == 0 || containsString(scopes, scope)
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func describeMaintenanceScope(scopes []string) string {
+	if len(scopes) == 0 {
+		return "all alerts and scheduled runs"
+	}
+	return strings.Join(scopes, ", ")
+}
+
+// HandleAPIGetMaintenance Handles GET /api/maintenance
+func HandleAPIGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	status := Maintenance.Status(timeutil.Now())
+	message := fmt.Sprintf("%d maintenance windows, none active", len(status.Windows))
+	if len(status.Active) > 0 {
+		message = fmt.Sprintf("%d maintenance windows, %d active", len(status.Windows), len(status.Active))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    status,
+	})
+}
+
+// HandleAPICreateMaintenanceWindow Handles POST /api/maintenance/windows
+// Body: {"start": RFC3339 (default now), "end": RFC3339, "scope": ["watchdog", ...],
+// "reason": "..."}. An empty scope suppresses every alert and scheduled run.
+func HandleAPICreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	var request MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	by := auth.Describe(r.Context())
+	window, err := Maintenance.Create(request, by, timeutil.Now())
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid maintenance window: %v", err),
+		})
+		return
+	}
+
+	logger.LogWithNode("System", "Maintenance", fmt.Sprintf("Maintenance window %s from %s to %s created by %s (%s)",
+		window.ID, timeutil.Format(window.Start), timeutil.Format(window.End), by, describeMaintenanceScope(window.Scope)), "info")
+	go Maintenance.Check(timeutil.Now())
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Maintenance window %s created", window.ID),
+		Data:    window,
+	})
+}
+
+// HandleAPIEndMaintenanceWindow Handles DELETE /api/maintenance/windows/{id}
+// Ends an active window now; a window that has not started yet is removed
+func HandleAPIEndMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	by := auth.Describe(r.Context())
+	window, err := Maintenance.End(id, by, timeutil.Now())
+	if err != nil {
+		status := http.StatusConflict
+		if errors.Is(err, errMaintenanceNotFound) {
+			status = http.StatusNotFound
+		}
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Maintenance window %s cancelled", id)
+	if window.Status == MaintenanceEnded {
+		message = fmt.Sprintf("Maintenance window %s ended early", id)
+	}
+	logger.LogWithNode("System", "Maintenance", fmt.Sprintf("%s by %s", message, by), "info")
+	go Maintenance.Check(timeutil.Now())
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    window,
+	})
+}
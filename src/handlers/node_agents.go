@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/node_control"
+)
+
+// NodeAgentSelf is what the manager shows of one node agent's own health
+type NodeAgentSelf struct {
+	Node      string                 `json:"node"`
+	Host      string                 `json:"host"`
+	Reachable bool                   `json:"reachable"`
+	Supported bool                   `json:"supported"` // false for agents built before self metrics
+	Version   string                 `json:"version,omitempty"`
+	Commit    string                 `json:"commit,omitempty"`
+	BuildDate string                 `json:"buildDate,omitempty"`
+	Outdated  bool                   `json:"outdated"`        // reachable, but not running the build the manager deploys
+	Agent     map[string]interface{} `json:"agent,omitempty"` // the agent section of its health payload
+	Error     string                 `json:"error,omitempty"`
+}
+
+// NodeAgentsReport lists the agents of all enabled nodes and the versions they run
+type NodeAgentsReport struct {
+	Agents   []NodeAgentSelf `json:"agents"`
+	Versions map[string]int  `json:"versions"` // agents per version, "unknown" for old agents
+	Mixed    bool            `json:"mixed"`    // more than one version is deployed
+	// Expected is the build of the agent binary the manager deploys; Outdated lists the
+	// nodes running another one, for POST /api/nodes/agents/upgrade
+	Expected      *AgentBuild `json:"expected,omitempty"`
+	ExpectedError string      `json:"expectedError,omitempty"`
+	Outdated      []string    `json:"outdated"`
+}
+
+// fetchNodeAgentSelf reads a node agent's health payload
+func fetchNodeAgentSelf(ctx context.Context, name string, node node_control.NodeConfig) NodeAgentSelf {
+	result := NodeAgentSelf{Node: name, Host: node.Host}
+	resp, err := NodeClient.Get(ctx, node.AgentURL("/api/system/health"))
+	if err != nil {
+		result.Error = fmt.Sprintf("unreachable: %v", err)
+		return result
+	}
+	defer resp.Body.Close()
+	result.Reachable = true
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read health: %v", err)
+		return result
+	}
+	var health struct {
+		Version   string                 `json:"version"`
+		Commit    string                 `json:"commit"`
+		BuildDate string                 `json:"buildDate"`
+		Agent     map[string]interface{} `json:"agent"`
+	}
+	if err := json.Unmarshal(body, &health); err != nil || resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("invalid health response (HTTP %d)", resp.StatusCode)
+		return result
+	}
+	if health.Agent == nil {
+		result.Error = "agent does not report self metrics, redeploy node_metrics_api"
+		return result
+	}
+	result.Supported = true
+	result.Version = health.Version
+	result.Commit, result.BuildDate = health.Commit, health.BuildDate
+	result.Agent = health.Agent
+	return result
+}
+
+// build returns the build the agent reported
+func (a NodeAgentSelf) build() AgentBuild {
+	return AgentBuild{Version: a.Version, Commit: a.Commit, BuildDate: a.BuildDate}
+}
+
+// HandleAPIGetNodeAgents Handles GET /api/nodes/agents
+// Returns version, uptime, sampling loop latency, memory use and collection errors of
+// every enabled node's agent, to spot fleet-wide agent problems such as a leaking build,
+// and which agents do not run the build the manager deploys
+func HandleAPIGetNodeAgents(w http.ResponseWriter, r *http.Request) {
+	report := collectNodeAgents(r.Context())
+	message := fmt.Sprintf("Agent health of %d nodes retrieved", len(report.Agents))
+	if len(report.Outdated) > 0 {
+		message += fmt.Sprintf(", %d outdated", len(report.Outdated))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// collectNodeAgents queries the agents of all enabled nodes and compares their builds
+// with the local agent binary
+func collectNodeAgents(ctx context.Context) NodeAgentsReport {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	report := NodeAgentsReport{Agents: []NodeAgentSelf{}, Versions: make(map[string]int), Outdated: []string{}}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, node := range NodeManager.GetNodes() {
+		if !node.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, node node_control.NodeConfig) {
+			defer wg.Done()
+			agent := fetchNodeAgentSelf(ctx, name, node)
+			mutex.Lock()
+			report.Agents = append(report.Agents, agent)
+			mutex.Unlock()
+		}(name, node)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Agents, func(i, j int) bool { return report.Agents[i].Node < report.Agents[j].Node })
+	for _, agent := range report.Agents {
+		switch {
+		case agent.Supported:
+			report.Versions[agent.Version]++
+		case agent.Reachable:
+			report.Versions["unknown"]++
+		}
+	}
+	report.Mixed = len(report.Versions) > 1
+
+	expected, err := LocalAgentBuild()
+	if err != nil {
+		report.ExpectedError = err.Error()
+		return report
+	}
+	report.Expected = expected
+	for i, agent := range report.Agents {
+		// Agents from before self metrics report no build and are outdated by definition
+		if agent.Reachable && (!agent.Supported || !expected.Matches(agent.build())) {
+			report.Agents[i].Outdated = true
+			report.Outdated = append(report.Outdated, agent.Node)
+		}
+	}
+	return report
+}
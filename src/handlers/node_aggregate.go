@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// Gap handling of the aggregated node metrics, for polls a node missed
+const (
+	GapCarryForward = "carry_forward" // repeat the node's last value
+	GapNull         = "null"          // leave the gap, so the fleet value is null
+	GapInterpolate  = "interpolate"   // linear between the values around the gap
+)
+
+// validGapMode reports whether mode is one of the gap handling modes
+func validGapMode(mode string) bool {
+	return mode == GapCarryForward || mode == GapNull || mode == GapInterpolate
+}
+
+// AggregatePoint is the fleet value of one metric at one sampling time. Avg and Sum are
+// null when a node expected at that time has no value, instead of dipping.
+type AggregatePoint struct {
+	Time    string   `json:"time"`
+	Metric  string   `json:"metric"`
+	Avg     *float64 `json:"avg"`
+	Sum     *float64 `json:"sum"`
+	Samples int      `json:"samples"` // nodes that reported the metric at this time
+	Filled  int      `json:"filled"`  // nodes whose missed poll was carried forward or interpolated
+	Missing int      `json:"missing"` // nodes that missed the poll without a fill
+}
+
+// NodeMetricsAggregate is the fleet view of a run's node samples
+type NodeMetricsAggregate struct {
+	RunID         string           `json:"runId"`
+	GapMode       string           `json:"gapMode"`
+	MaxGapSamples int              `json:"maxGapSamples"`
+	Nodes         []string         `json:"nodes"`
+	Points        []AggregatePoint `json:"points"`
+}
+
+// aggregateNodeSamples computes the fleet average and sum of every metric at each sampling
+// time. A node is expected from its first sample until maxGap polls after its last one.
+// Polls it missed in between are filled per gapMode if the gap is at most maxGap polls
+// long; a gap at the end has no value after it and is carried forward unless gapMode is
+// null. A metric a node's sample does not have, like process_cpu_percent of a stopped
+// simulator, is not a missed poll and only leaves that node out.
+func aggregateNodeSamples(samples []NodeSample, metrics map[string]bool, gapMode string, maxGap int, loc *time.Location) ([]string, []AggregatePoint) {
+	var times []time.Time
+	tickIndex := make(map[int64]int)
+	for _, sample := range samples {
+		if _, ok := tickIndex[sample.Time.UnixNano()]; !ok {
+			tickIndex[sample.Time.UnixNano()] = 0
+			times = append(times, sample.Time)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i, t := range times {
+		tickIndex[t.UnixNano()] = i
+	}
+
+	// bySample[node][tick] is the node's sample at that tick, nil for a missed poll
+	bySample := make(map[string][]*NodeSample)
+	metricSet := make(map[string]bool)
+	for i := range samples {
+		sample := &samples[i]
+		if bySample[sample.Node] == nil {
+			bySample[sample.Node] = make([]*NodeSample, len(times))
+		}
+		bySample[sample.Node][tickIndex[sample.Time.UnixNano()]] = sample
+		for name := range sample.Metrics {
+			if metrics == nil || metrics[name] {
+				metricSet[name] = true
+			}
+		}
+	}
+	nodes := make([]string, 0, len(bySample))
+	for node := range bySample {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	metricNames := make([]string, 0, len(metricSet))
+	for name := range metricSet {
+		metricNames = append(metricNames, name)
+	}
+	sort.Strings(metricNames)
+
+	points := []AggregatePoint{}
+	for _, metric := range metricNames {
+		// values[node][tick] is the node's value for the metric, nil if it has none
+		values := make(map[string][]*float64, len(nodes))
+		missing := make([]int, len(times))
+		filled := make([]int, len(times))
+		for _, node := range nodes {
+			series, gaps := fillNodeGaps(bySample[node], metric, gapMode, maxGap)
+			values[node] = series
+			for tick, gap := range gaps {
+				switch {
+				case gap && series[tick] != nil:
+					filled[tick]++
+				case gap:
+					missing[tick]++
+				}
+			}
+		}
+
+		for tick, t := range times {
+			point := AggregatePoint{Time: timeutil.FormatIn(t, loc), Metric: metric, Filled: filled[tick], Missing: missing[tick]}
+			var sum float64
+			count := 0
+			for _, node := range nodes {
+				if value := values[node][tick]; value != nil {
+					sum += *value
+					count++
+					if bySample[node][tick] != nil {
+						point.Samples++
+					}
+				}
+			}
+			if count > 0 && point.Missing == 0 {
+				avg := sum / float64(count)
+				point.Avg, point.Sum = &avg, &sum
+			}
+			points = append(points, point)
+		}
+	}
+	return nodes, points
+}
+
+// fillNodeGaps returns a node's value of metric at every tick with the missed polls filled
+// per gapMode, and which ticks are missed polls the node was expected to report it at
+func fillNodeGaps(samples []*NodeSample, metric, gapMode string, maxGap int) ([]*float64, []bool) {
+	series := make([]*float64, len(samples))
+	gaps := make([]bool, len(samples))
+	first := -1
+	for tick, sample := range samples {
+		if sample == nil {
+			continue
+		}
+		if first < 0 {
+			first = tick
+		}
+		if value, ok := sample.Metrics[metric]; ok {
+			series[tick] = &value
+		}
+	}
+
+	for tick := first + 1; first >= 0 && tick < len(samples); {
+		if samples[tick] != nil {
+			tick++
+			continue
+		}
+		end := tick // first tick after the gap with a sample
+		for end < len(samples) && samples[end] == nil {
+			end++
+		}
+		length, next := end-tick, end
+		if end == len(samples) {
+			// Trailing gap: after maxGap polls the node is gone, not missing
+			length, next = min(length, maxGap), -1
+		}
+		// A node without the metric before the gap would not have reported it anyway
+		if previous := series[tick-1]; previous != nil {
+			for i := 0; i < length; i++ {
+				gaps[tick+i] = true
+				if length > maxGap || gapMode == GapNull {
+					continue
+				}
+				value := *previous
+				if gapMode == GapInterpolate && next >= 0 && series[next] != nil {
+					value += (*series[next] - *previous) * float64(i+1) / float64(length+1)
+				}
+				series[tick+i] = &value
+			}
+		}
+		tick = end
+	}
+	return series, gaps
+}
+
+// HandleAPIGetRunNodeMetricsAggregate Handles GET /api/runs/{id}/node-metrics/aggregate
+// Returns the fleet average and sum of the run's node samples per sampling time, with
+// the nodes that reported, were filled and missed the poll. Optional query: metric and
+// node (comma-separated filters), from and to (RFC3339), gap (carry_forward, null or
+// interpolate) and maxGap (polls) over node_samples.gap_mode and max_gap_samples, tz,
+// and format=csv or ndjson.
+func HandleAPIGetRunNodeMetricsAggregate(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	query := r.URL.Query()
+	loc, err := timeutil.ParseLocation(query.Get(timeutil.QueryParam))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	var from, to time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Invalid %s time format: %v", name, err),
+				})
+				return
+			}
+		}
+	}
+	config := NodeSampler.Config()
+	gapMode, maxGap := config.GapMode, config.MaxGapSamples
+	if value := query.Get("gap"); value != "" {
+		if !validGapMode(value) {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "gap must be carry_forward, null or interpolate",
+			})
+			return
+		}
+		gapMode = value
+	}
+	if value := query.Get("maxGap"); value != "" {
+		if maxGap, err = strconv.Atoi(value); err != nil || maxGap < 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "maxGap must be a number of polls, 0 or more",
+			})
+			return
+		}
+	}
+	nodes := filterSet(query.Get("node"))
+	metrics := filterSet(query.Get("metric"))
+
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	file, err := RunStore.OpenArtifact(runID, runs.KindMetrics, nodeSamplesArtifact)
+	if os.IsNotExist(err) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("No node samples were recorded for run %s", runID),
+		})
+		return
+	}
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read node samples: %v", err),
+		})
+		return
+	}
+	defer file.Close()
+
+	var samples []NodeSample
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample NodeSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // a sample cut short by a crash
+		}
+		if (!from.IsZero() && sample.Time.Before(from)) || (!to.IsZero() && sample.Time.After(to)) {
+			continue
+		}
+		if nodes != nil && !nodes[sample.Node] {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read node samples: %v", err),
+		})
+		return
+	}
+
+	aggregate := NodeMetricsAggregate{RunID: runID, GapMode: gapMode, MaxGapSamples: maxGap}
+	aggregate.Nodes, aggregate.Points = aggregateNodeSamples(samples, metrics, gapMode, maxGap, loc)
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d points of %d nodes, gaps up to %d polls: %s", len(aggregate.Points), len(aggregate.Nodes), maxGap, gapMode),
+		Data:    aggregate,
+	}, runID+"-node-metrics-aggregate")
+}
@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// nodeSamplesArtifact holds the node samples of a run, one JSON sample per line
+const nodeSamplesArtifact = "node_samples.ndjson"
+
+// Node sample sources
+const (
+	SampleSourceAgent     = "agent"     // the node's metrics agent
+	SampleSourceDashboard = "dashboard" // the last pushed or exporter metrics, when the agent did not answer
+	SampleSourceReplay    = "replay"    // buffered by the agent while the manager could not poll it
+)
+
+// NodeSampleConfig holds the node_samples section of config.yaml
+type NodeSampleConfig struct {
+	Enabled         bool `yaml:"enabled" json:"enabled"`
+	IntervalSeconds int  `yaml:"interval_seconds" json:"intervalSeconds"`
+	// GapMode fills the polls a node missed in the aggregated view: carry_forward, null
+	// or interpolate, for gaps of up to MaxGapSamples polls
+	GapMode       string `yaml:"gap_mode" json:"gapMode"`
+	MaxGapSamples int    `yaml:"max_gap_samples" json:"maxGapSamples"`
+	// Replay backfills the polls a node missed, because the manager was down or the node
+	// unreachable, from the agent's sample buffer once it answers again, going back at
+	// most MaxReplayMinutes
+	Replay           bool `yaml:"replay" json:"replay"`
+	MaxReplayMinutes int  `yaml:"max_replay_minutes" json:"maxReplayMinutes"`
+}
+
+// NodeSample holds the metrics of one node at one point of a run
+type NodeSample struct {
+	Time    time.Time          `json:"time"`
+	Node    string             `json:"node"`
+	Source  string             `json:"source"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// agentBufferedSample is a sample from the agent's /api/system/metrics/history
+type agentBufferedSample struct {
+	Timestamp         time.Time `json:"timestamp"`
+	ProcessRunning    bool      `json:"process_running"`
+	ProcessCPUPercent float64   `json:"process_cpu_percent"`
+	ProcessMemMB      float64   `json:"process_mem_mb"`
+	CPUUsage          float64   `json:"cpu_usage"`
+	CPUCores          int       `json:"cpu_cores"`
+	MemTotalMB        float64   `json:"mem_total_mb"`
+	MemUsedMB         float64   `json:"mem_used_mb"`
+	LoadAvg1          float64   `json:"load_avg_1"`
+	NetRxBytes        *uint64   `json:"net_rx_bytes"`
+	NetTxBytes        *uint64   `json:"net_tx_bytes"`
+}
+
+// agentMetrics is the part of the agent's /api/system/metrics response that is sampled
+type agentMetrics struct {
+	Process struct {
+		Running    bool    `json:"running"`
+		CPUPercent float64 `json:"cpu_percent"`
+		MemMB      float64 `json:"mem_mb"`
+	} `json:"process"`
+	System struct {
+		CPUUsage   float64 `json:"cpu_usage"`
+		CPUCores   int     `json:"cpu_cores"`
+		MemTotalMB float64 `json:"mem_total_mb"`
+		MemUsedMB  float64 `json:"mem_used_mb"`
+		LoadAvg1   float64 `json:"load_avg_1"`
+		NetRxBytes *uint64 `json:"net_rx_bytes"` // nil from agents without network counters
+		NetTxBytes *uint64 `json:"net_tx_bytes"`
+	} `json:"system"`
+}
+
+// RunNodeSampler records the CPU, memory and simulator process metrics of every enabled
+// node while a run is active, so they can be exported for offline analysis
+type RunNodeSampler struct {
+	mutex  sync.Mutex
+	config NodeSampleConfig
+
+	// Time of the last sample recorded for each node of the run being sampled, to find
+	// the polls it missed
+	runID      string
+	lastSample map[string]time.Time
+}
+
+var NodeSampler = &RunNodeSampler{config: defaultNodeSampleConfig()}
+
+func defaultNodeSampleConfig() NodeSampleConfig {
+	return NodeSampleConfig{Enabled: true, IntervalSeconds: 15, GapMode: GapCarryForward, MaxGapSamples: 2, Replay: true, MaxReplayMinutes: 60}
+}
+
+// LoadConfig reads the node_samples section from the application config file
+func (s *RunNodeSampler) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultNodeSampleConfig()
+	fileConfig := struct {
+		NodeSamples *NodeSampleConfig `yaml:"node_samples"`
+	}{NodeSamples: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = 15
+	}
+	if !validGapMode(config.GapMode) {
+		return fmt.Errorf("invalid node_samples.gap_mode %q: use carry_forward, null or interpolate", config.GapMode)
+	}
+	if config.MaxGapSamples < 0 {
+		config.MaxGapSamples = 0
+	}
+	if config.MaxReplayMinutes <= 0 {
+		config.MaxReplayMinutes = 60
+	}
+
+	s.mutex.Lock()
+	s.config = config
+	s.mutex.Unlock()
+	return nil
+}
+
+// Config returns the node sampling settings
+func (s *RunNodeSampler) Config() NodeSampleConfig {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config
+}
+
+// Start samples the nodes of the active run in the background
+func (s *RunNodeSampler) Start() {
+	s.mutex.Lock()
+	config := s.config
+	s.mutex.Unlock()
+
+	if !config.Enabled {
+		log.Println("Run node sampling disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			sim := AppState.Simulation()
+			running := sim.Running
+			runID := sim.RunID
+			if running && runID != "" {
+				s.Sample(runID)
+			}
+		}
+	}()
+}
+
+// Sample records one sample of every enabled node for the run
+func (s *RunNodeSampler) Sample(runID string) {
+	nodes := NodeManager.GetEnabledNodes()
+	if len(nodes) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	config := s.config
+	s.mutex.Unlock()
+	interval := time.Duration(config.IntervalSeconds) * time.Second
+
+	now := timeutil.Now()
+	lastSample := s.lastSamples(runID, now)
+
+	type result struct {
+		sample   NodeSample
+		replayed []NodeSample
+	}
+	results := make(chan result, len(nodes))
+	for name, nodeConfig := range nodes {
+		go func(name string, nodeConfig node_control.NodeConfig) {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			defer cancel()
+			r := result{sample: sampleNode(ctx, name, nodeConfig, now)}
+			// A node answering again after missed polls gets them from its agent's buffer
+			last, known := lastSample[name]
+			if config.Replay && known && r.sample.Source == SampleSourceAgent && now.Sub(last) > interval*3/2 {
+				since := last
+				if oldest := now.Add(-time.Duration(config.MaxReplayMinutes) * time.Minute); since.Before(oldest) {
+					since = oldest
+				}
+				replayed, err := replayAgentSamples(name, nodeConfig, since, now, interval)
+				if err != nil {
+					logger.Debug().Err(err).Str("node", name).Msg("No node samples replayed")
+				}
+				r.replayed = replayed
+			}
+			results <- r
+		}(name, nodeConfig)
+	}
+
+	collected := make([]NodeSample, 0, len(nodes))
+	var replayed []NodeSample
+	for range nodes {
+		r := <-results
+		if len(r.sample.Metrics) > 0 {
+			collected = append(collected, r.sample)
+		}
+		replayed = append(replayed, r.replayed...)
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].Node < collected[j].Node })
+	sort.Slice(replayed, func(i, j int) bool {
+		if !replayed[i].Time.Equal(replayed[j].Time) {
+			return replayed[i].Time.Before(replayed[j].Time)
+		}
+		return replayed[i].Node < replayed[j].Node
+	})
+	Reservations.Check(runID, collected)
+
+	s.mutex.Lock()
+	if s.runID == runID {
+		for _, sample := range collected {
+			s.lastSample[sample.Node] = sample.Time
+		}
+	}
+	s.mutex.Unlock()
+	if len(replayed) > 0 {
+		logger.Info().Str("run", runID).Int("samples", len(replayed)).Msg("Replayed node samples buffered by the agents")
+	}
+
+	// Replayed samples go before the new ones, keeping each node's samples in time order
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, sample := range replayed {
+		encoder.Encode(sample)
+	}
+	for _, sample := range collected {
+		encoder.Encode(sample)
+	}
+	if buf.Len() == 0 {
+		return
+	}
+	if err := RunStore.AppendArtifact(runID, runs.KindMetrics, nodeSamplesArtifact, buf.Bytes()); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record node samples for run %s: %v", runID, err))
+	}
+}
+
+// lastSamples returns the time of the last sample recorded for each node of the run. On
+// the first poll of a run, e.g. after the manager restarted during it, they are read
+// from the samples already recorded; nodes without any count from the run's start.
+func (s *RunNodeSampler) lastSamples(runID string, now time.Time) map[string]time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.runID != runID {
+		s.runID = runID
+		s.lastSample = make(map[string]time.Time)
+		err := readRunArtifactLines(runID, nodeSamplesArtifact, func(line []byte) {
+			var sample NodeSample
+			if json.Unmarshal(line, &sample) == nil && sample.Time.After(s.lastSample[sample.Node]) {
+				s.lastSample[sample.Node] = sample.Time
+			}
+		})
+		if err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to read node samples of run %s: %v", runID, err))
+		}
+		if run, ok := RunStore.GetRun(runID); ok && !run.StartedAt.IsZero() && run.StartedAt.Before(now) {
+			for name := range NodeManager.GetEnabledNodes() {
+				if _, known := s.lastSample[name]; !known {
+					s.lastSample[name] = run.StartedAt
+				}
+			}
+		}
+	}
+
+	lastSample := make(map[string]time.Time, len(s.lastSample))
+	for name, last := range s.lastSample {
+		lastSample[name] = last
+	}
+	return lastSample
+}
+
+// replayAgentSamples fetches the samples the node's agent buffered after since and before
+// until, one per interval, as node samples with their original timestamps
+func replayAgentSamples(name string, config node_control.NodeConfig, since, until time.Time, interval time.Duration) ([]NodeSample, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	// Leave half an interval on both sides, so replayed samples do not crowd the polled ones
+	query := url.Values{}
+	query.Set("since", since.Add(interval/2).Format(time.RFC3339Nano))
+	query.Set("until", until.Add(-interval/2).Format(time.RFC3339Nano))
+	query.Set("step", interval.String())
+	resp, err := NodeClient.Get(ctx, config.AgentURL("/api/system/metrics/history?"+query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d, the agent has no sample buffer", resp.StatusCode)
+	}
+	var history struct {
+		Samples []agentBufferedSample `json:"samples"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, fmt.Errorf("invalid agent response: %v", err)
+	}
+
+	samples := make([]NodeSample, 0, len(history.Samples))
+	for _, buffered := range history.Samples {
+		var agent agentMetrics
+		agent.Process.Running = buffered.ProcessRunning
+		agent.Process.CPUPercent = buffered.ProcessCPUPercent
+		agent.Process.MemMB = buffered.ProcessMemMB
+		agent.System.CPUUsage = buffered.CPUUsage
+		agent.System.CPUCores = buffered.CPUCores
+		agent.System.MemTotalMB = buffered.MemTotalMB
+		agent.System.MemUsedMB = buffered.MemUsedMB
+		agent.System.LoadAvg1 = buffered.LoadAvg1
+		agent.System.NetRxBytes = buffered.NetRxBytes
+		agent.System.NetTxBytes = buffered.NetTxBytes
+		samples = append(samples, NodeSample{
+			Time:    buffered.Timestamp.UTC(),
+			Node:    name,
+			Source:  SampleSourceReplay,
+			Metrics: agentSampleMetrics(&agent),
+		})
+	}
+	return samples, nil
+}
+
+// agentSampleMetrics returns the sampled metrics of an agent response
+func agentSampleMetrics(agent *agentMetrics) map[string]float64 {
+	metrics := make(map[string]float64)
+	metrics["cpu_percent"] = agent.System.CPUUsage
+	metrics["cpu_cores"] = float64(agent.System.CPUCores)
+	metrics["mem_used_mb"] = agent.System.MemUsedMB
+	metrics["mem_total_mb"] = agent.System.MemTotalMB
+	if agent.System.MemTotalMB > 0 {
+		metrics["mem_used_percent"] = agent.System.MemUsedMB / agent.System.MemTotalMB * 100
+	}
+	metrics["load_avg_1"] = agent.System.LoadAvg1
+	if agent.System.NetRxBytes != nil && agent.System.NetTxBytes != nil {
+		metrics[metricNetRxBytes] = float64(*agent.System.NetRxBytes)
+		metrics[metricNetTxBytes] = float64(*agent.System.NetTxBytes)
+	}
+	metrics["process_running"] = 0
+	if agent.Process.Running {
+		metrics["process_running"] = 1
+		metrics["process_cpu_percent"] = agent.Process.CPUPercent
+		metrics["process_mem_mb"] = agent.Process.MemMB
+	}
+	return metrics
+}
+
+// sampleNode reads the node's agent and adds the dashboard's EPS and load figures. If
+// the agent does not answer, the last fresh CPU and memory on the dashboard are used.
+func sampleNode(ctx context.Context, name string, config node_control.NodeConfig, now time.Time) NodeSample {
+	sample := NodeSample{Time: now, Node: name, Metrics: make(map[string]float64)}
+
+	agent, err := fetchAgentMetrics(ctx, config)
+	if err == nil {
+		sample.Source = SampleSourceAgent
+		sample.Metrics = agentSampleMetrics(agent)
+	}
+
+	node, ok := AppState.Node(name)
+	if !ok || node.LastUpdate.IsZero() {
+		return sample
+	}
+	if _, stale := Staleness.Evaluate(node.LastUpdate, now); stale {
+		return sample
+	}
+	if sample.Source == "" {
+		sample.Source = SampleSourceDashboard
+		sample.Metrics["cpu_percent"] = node.CPU
+		sample.Metrics["mem_used_percent"] = node.Memory
+	}
+	sample.Metrics["eps"] = float64(node.EPS)
+	sample.Metrics["kafka_load"] = float64(node.KafkaLoad)
+	sample.Metrics["ch_load"] = float64(node.CHLoad)
+	return sample
+}
+
+func fetchAgentMetrics(ctx context.Context, config node_control.NodeConfig) (*agentMetrics, error) {
+	resp, err := NodeClient.Get(ctx, config.AgentURL("/api/system/metrics"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	var metrics agentMetrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("invalid agent response: %v", err)
+	}
+	return &metrics, nil
+}
+
+// HandleAPIExportRunNodeMetrics Handles GET /api/runs/{id}/node-metrics.csv
+// Exports the node samples of a run as long-format CSV (timestamp,node,metric,value).
+// Optional query: node and metric (comma-separated filters), from and to (RFC3339) to
+// narrow the window, and tz for the timestamps.
+func HandleAPIExportRunNodeMetrics(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	query := r.URL.Query()
+	loc, err := timeutil.ParseLocation(query.Get(timeutil.QueryParam))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	var from, to time.Time
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := query.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Invalid %s time format: %v", name, err),
+				})
+				return
+			}
+		}
+	}
+	nodes := filterSet(query.Get("node"))
+	metrics := filterSet(query.Get("metric"))
+
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	file, err := RunStore.OpenArtifact(runID, runs.KindMetrics, nodeSamplesArtifact)
+	if os.IsNotExist(err) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("No node samples were recorded for run %s", runID),
+		})
+		return
+	}
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read node samples: %v", err),
+		})
+		return
+	}
+	defer file.Close()
+
+	// Build the CSV in memory so a corrupt sample file can still be reported as JSON
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"timestamp", "node", "metric", "value"})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample NodeSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue // a sample cut short by a crash
+		}
+		if (!from.IsZero() && sample.Time.Before(from)) || (!to.IsZero() && sample.Time.After(to)) {
+			continue
+		}
+		if nodes != nil && !nodes[sample.Node] {
+			continue
+		}
+		names := make([]string, 0, len(sample.Metrics))
+		for name := range sample.Metrics {
+			if metrics == nil || metrics[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		timestamp := timeutil.FormatIn(sample.Time, loc)
+		for _, name := range names {
+			writer.Write([]string{timestamp, sample.Node, name, strconv.FormatFloat(sample.Metrics[name], 'f', -1, 64)})
+		}
+	}
+	writer.Flush()
+	if err := scanner.Err(); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read node samples: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set(ContentTypeHeader, "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-node-metrics.csv"))
+	w.Write(buf.Bytes())
+}
+
+// filterSet parses a comma-separated filter; nil means no filter
+func filterSet(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			set[item] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIGetNodeTop Handles GET /api/nodes/{name}/top[?n=10][&interval=500ms]
+// Returns the node's top processes by CPU and by RSS as sampled by its agent, to find
+// what else is loading a worker without SSHing in
+func HandleAPIGetNodeTop(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+
+	node, ok := NodeManager.GetNodes()[nodeName]
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s not found", nodeName),
+		})
+		return
+	}
+
+	params := url.Values{}
+	for _, key := range []string{"n", "interval"} {
+		if value := r.URL.Query().Get(key); value != "" {
+			params.Set(key, value)
+		}
+	}
+	path := "/api/system/top"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	// The agent samples for up to 5 seconds before answering
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	resp, err := NodeClient.Get(ctx, node.AgentURL(path))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s is unreachable: %v", nodeName, err),
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read top processes from %s: %v", nodeName, err),
+		})
+		return
+	}
+	var top map[string]interface{}
+	if err := json.Unmarshal(body, &top); err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid top processes response from %s (HTTP %d)", nodeName, resp.StatusCode),
+		})
+		return
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s rejected the request: %v", nodeName, top["error"]),
+		})
+		return
+	}
+	if _, ok := top["by_cpu"]; !ok || resp.StatusCode != http.StatusOK {
+		// Agents deployed before top support answer with the catch-all status page
+		SendJSONResponse(w, http.StatusNotImplemented, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s does not support top processes, redeploy node_metrics_api", nodeName),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Top processes for %s retrieved", nodeName),
+		Data:    top,
+	})
+}
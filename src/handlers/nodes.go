@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"vuDataSim/src/bin_control"
 	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/o11y_source_manager"
+	"vuDataSim/src/timeutil"
 
 	"github.com/gorilla/mux"
 )
@@ -29,14 +33,18 @@ func HandleAPINodes(w http.ResponseWriter, r *http.Request) {
 		}
 
 		nodeList = append(nodeList, map[string]interface{}{
-			"name":        name,
-			"host":        config.Host,
-			"user":        config.User,
-			"status":      status,
-			"description": config.Description,
-			"binary_dir":  config.BinaryDir,
-			"conf_dir":    config.ConfDir,
-			"enabled":     config.Enabled,
+			"name":          name,
+			"host":          config.Host,
+			"user":          config.User,
+			"status":        status,
+			"description":   config.Description,
+			"binary_dir":    config.BinaryDir,
+			"conf_dir":      config.ConfDir,
+			"enabled":       config.Enabled,
+			"exporter_url":  config.ExporterURL,
+			"exporter_mode": config.ExporterMode,
+			"generators":    config.Generators,
+			"reserved":      config.Reserved,
 		})
 	}
 
@@ -93,8 +101,7 @@ func HandleCreateNode(w http.ResponseWriter, r *http.Request, nodeName string) {
 		return
 	}
 
-	// Debug log the received data
-	fmt.Printf("DEBUG: Received node data - Host: %s, User: %s, KeyPath: %s, ConfDir: %s, BinaryDir: %s\n",
+	logger.Debugf(logger.ModuleSSH, "Received node data - Host: %s, User: %s, KeyPath: %s, ConfDir: %s, BinaryDir: %s",
 		nodeData.Host, nodeData.User, nodeData.KeyPath, nodeData.ConfDir, nodeData.BinaryDir)
 
 	addNodeReq := node_control.AddNodeRequest{
@@ -127,6 +134,9 @@ func HandleCreateNode(w http.ResponseWriter, r *http.Request, nodeName string) {
 func HandleUpdateNode(w http.ResponseWriter, r *http.Request, nodeName string) {
 	var nodeData struct {
 		Enabled *bool `json:"enabled,omitempty"`
+		Force   bool  `json:"force"` // disable although a simulation is running
+		// Reserved replaces the node's reservation; {} removes it
+		Reserved *node_control.Reservation `json:"reserved,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&nodeData); err != nil {
@@ -137,6 +147,30 @@ func HandleUpdateNode(w http.ResponseWriter, r *http.Request, nodeName string) {
 		return
 	}
 
+	if nodeData.Enabled != nil && !*nodeData.Enabled {
+		if _, enabled := NodeManager.GetEnabledNodes()[nodeName]; enabled {
+			impact := fmt.Sprintf("node %s drops out of the run: its metrics stop being collected and stopping the run no longer stops its simulator", nodeName)
+			if !guardActiveRun(w, r, "disable node "+nodeName, impact, nodeData.Force) {
+				return
+			}
+		}
+	}
+
+	if nodeData.Reserved != nil {
+		if err := NodeManager.SetReservation(nodeName, nodeData.Reserved); err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		message := "Reservation removed"
+		if reserved := NodeManager.GetNodes()[nodeName].Reserved; reserved != nil {
+			message = fmt.Sprintf("Reserved %g cores and %g GB memory (%s)", reserved.CPUCores, reserved.MemoryGB, reserved.Reason)
+		}
+		logger.LogWithNode(nodeName, "node_control", message, "info")
+	}
+
 	if nodeData.Enabled != nil {
 		if *nodeData.Enabled {
 			err := NodeManager.EnableNode(nodeName)
@@ -192,6 +226,8 @@ func HandleDeleteNode(w http.ResponseWriter, r *http.Request, nodeName string) {
 		})
 		return
 	}
+	NodeExporter.Forget(nodeName)
+	Availability.Forget(nodeName)
 
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
@@ -215,6 +251,27 @@ func HandleAPIClusterSettings(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		if settings.MaxConcurrentTransfers < 0 || settings.TransferBandwidthKbps < 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "MaxConcurrentTransfers and TransferBandwidthKbps must not be negative",
+			})
+			return
+		}
+		if !bin_control.ValidStopMode(settings.StopMode) || settings.GracefulShutdownTimeout < 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "StopMode must be graceful or force and GracefulShutdownTimeout must not be negative",
+			})
+			return
+		}
+		if settings.ConflictResolution != "" && !o11y_source_manager.ValidConflictResolution(settings.ConflictResolution) {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "ConflictResolution must be manual, ours or theirs",
+			})
+			return
+		}
 
 		err := NodeManager.UpdateClusterSettings(settings)
 		if err != nil {
@@ -224,6 +281,7 @@ func HandleAPIClusterSettings(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
+		TransferScheduler.SetBudget(settings.MaxConcurrentTransfers, settings.TransferBandwidthKbps)
 
 		SendJSONResponse(w, http.StatusOK, APIResponse{
 			Success: true,
@@ -247,6 +305,13 @@ func HandleAPIGetClusterMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Results are cached, so the age is computed per response
+	now := timeutil.Now()
+	for name, m := range metrics {
+		m.AgeSeconds, m.Stale = Staleness.Evaluate(m.LastSampleAt, now)
+		metrics[name] = m
+	}
+
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Message: "Cluster metrics retrieved successfully",
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+	"vuDataSim/src/timeutil"
+)
+
+// NotificationStatus lists the configured channels and routing rules
+type NotificationStatus struct {
+	Channels []string       `json:"channels"`
+	Routes   []notify.Route `json:"routes"`
+}
+
+// sendNotification delivers a message in the background and logs failed channels, so
+// monitoring loops are not held up by slow webhooks or SMTP servers. During a maintenance
+// window covering the message's event it is only recorded.
+func sendNotification(message notify.Message) {
+	if Maintenance.Suppress(message, timeutil.Now()) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for _, delivery := range Notifier.Send(ctx, message) {
+			if !delivery.Success {
+				logger.LogError("System", "Notify", fmt.Sprintf("Failed to send %q via %s: %s", message.Subject, delivery.Channel, delivery.Error))
+			}
+		}
+	}()
+}
+
+// HandleAPIGetNotifications Handles GET /api/notifications
+func HandleAPIGetNotifications(w http.ResponseWriter, r *http.Request) {
+	status := NotificationStatus{Channels: Notifier.Channels(), Routes: Notifier.Routes()}
+	if status.Channels == nil {
+		status.Channels = []string{}
+	}
+	if status.Routes == nil {
+		status.Routes = []notify.Route{}
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d notification channels configured", len(status.Channels)),
+		Data:    status,
+	})
+}
+
+// HandleAPITestNotification Handles POST /api/notifications/test
+// Body: {"severity": "critical"} sends a test message through the routes, so the
+// channels that receive messages of that severity can be checked.
+func HandleAPITestNotification(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Severity string `json:"severity"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+	switch request.Severity {
+	case "":
+		request.Severity = notify.SeverityInfo
+	case notify.SeverityInfo, notify.SeverityWarning, notify.SeverityCritical:
+	default:
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "severity must be info, warning or critical",
+		})
+		return
+	}
+
+	deliveries := Notifier.Send(r.Context(), notify.Message{
+		Subject:  fmt.Sprintf("vuDataSim test notification (%s)", request.Severity),
+		Text:     fmt.Sprintf("Test message sent by %s.", auth.Describe(r.Context())),
+		Severity: request.Severity,
+		Event:    notify.EventTest,
+	})
+	if len(deliveries) == 0 {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("No notification channel receives %s messages", request.Severity),
+		})
+		return
+	}
+
+	failed := 0
+	for _, delivery := range deliveries {
+		if !delivery.Success {
+			failed++
+		}
+	}
+	status := http.StatusOK
+	if failed == len(deliveries) {
+		status = http.StatusBadGateway
+	}
+	SendJSONResponse(w, status, APIResponse{
+		Success: failed == 0,
+		Message: fmt.Sprintf("Test notification sent to %d of %d channels", len(deliveries)-failed, len(deliveries)),
+		Data:    deliveries,
+	})
+}
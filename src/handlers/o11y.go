@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"vuDataSim/src/o11y_source_manager"
 
 	"github.com/gorilla/mux"
@@ -42,6 +44,9 @@ func LoadCategoriesConfig() (*CategoriesConfig, error) {
 	return &config, nil
 }
 
+// HandleAPIGetO11ySources Handles GET /api/o11y/sources
+// Returns the source names; with ?detail=true, each source's catalog description (display
+// name, description, event schema, typical message size, default topic) and settings.
 func HandleAPIGetO11ySources(w http.ResponseWriter, r *http.Request) {
 	// Initialize o11y manager if not already done
 	if len(O11yManager.GetMaxEPSConfig()) == 0 {
@@ -65,6 +70,16 @@ func HandleAPIGetO11ySources(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("detail") == "true" {
+		catalog := O11yManager.GetSourceCatalog()
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Data:    catalog,
+			Message: fmt.Sprintf("Retrieved %d available o11y sources with their catalog", len(catalog)),
+		})
+		return
+	}
+
 	sources := O11yManager.GetAvailableSources()
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
@@ -167,63 +182,72 @@ func HandleAPIGetCurrentEPS(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HandleAPIEnableO11ySource Handles POST /api/o11y/sources/{source}/enable
-func HandleAPIEnableO11ySource(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sourceName := vars["source"]
-
-	if sourceName == "" {
+// HandleAPIGetEPSWhatIf Handles GET /api/o11y/eps/what-if?sources=a,b&totalEps=50000&strategy=proportional
+// Returns the NumUniqKey and per-submodule EPS a distribution of totalEps would produce for
+// each source, the enabled sources if none are given, without writing any configuration
+func HandleAPIGetEPSWhatIf(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	totalEPS, err := strconv.Atoi(query.Get("totalEps"))
+	if err != nil || totalEPS < 1 {
 		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
 			Success: false,
-			Message: "Source name is required",
+			Message: "totalEps must be a positive number",
 		})
 		return
 	}
 
-	// Available sources are loaded dynamically when needed
-
-	err := O11yManager.EnableSource(sourceName)
-	if err != nil {
-		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
+	if len(O11yManager.GetMaxEPSConfig()) == 0 {
+		if err := O11yManager.LoadMaxEPSConfig(); err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to load max EPS config: %v", err),
+			})
+			return
+		}
 	}
 
-	SendJSONResponse(w, http.StatusOK, APIResponse{
-		Success: true,
-		Message: fmt.Sprintf("Source %s enabled successfully", sourceName),
-	})
-}
-
-// HandleAPIDisableO11ySource Handles POST /api/o11y/sources/{source}/disable
-func HandleAPIDisableO11ySource(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sourceName := vars["source"]
-
-	if sourceName == "" {
-		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
-			Success: false,
-			Message: "Source name is required",
-		})
-		return
+	// The order matters: the last source takes the rounding remainder of the split
+	var sources []string
+	for _, source := range strings.Split(query.Get("sources"), ",") {
+		if source = strings.TrimSpace(source); source == "" {
+			continue
+		}
+		if !O11yManager.IsKnownSource(source) {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Unknown source %s", source),
+			})
+			return
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) == 0 {
+		if err := O11yManager.LoadMainConfig(); err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to read conf.yml: %v", err),
+			})
+			return
+		}
+		sources = O11yManager.GetEnabledSources()
 	}
 
-	// Available sources are loaded dynamically when needed
-
-	err := O11yManager.DisableSource(sourceName)
+	whatIf, err := O11yManager.WhatIfEPS(sources, totalEPS, query.Get("strategy"))
 	if err != nil {
-		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
 			Success: false,
 			Message: err.Error(),
 		})
 		return
 	}
-
+	message := fmt.Sprintf("%d EPS across %d sources on %d nodes produces %.0f EPS", totalEPS, len(whatIf.Sources), whatIf.NumEnabledNodes, whatIf.FleetEPS)
+	if !whatIf.Feasible {
+		message += "; a source would exceed its max EPS"
+	}
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Source %s disabled successfully", sourceName),
+		Message: message,
+		Data:    whatIf,
 	})
 }
 
@@ -248,6 +272,75 @@ func HandleAPIGetMaxEPSConfig(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// HandleAPIGetSourceMaxEPS Handles GET /api/o11y/max-eps/{source}
+func HandleAPIGetSourceMaxEPS(w http.ResponseWriter, r *http.Request) {
+	sourceName := mux.Vars(r)["source"]
+
+	maxEPS, exists := O11yManager.GetMaxEPSConfig()[sourceName]
+	if !exists {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("No max EPS configured for source %s", sourceName),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"source": sourceName,
+			"maxEps": maxEPS,
+		},
+	})
+}
+
+// HandleAPIUpdateSourceMaxEPS Handles PUT /api/o11y/max-eps/{source}
+// Body: {"maxEps": 50000}. The previous max_eps.yaml is snapshotted before it is rewritten.
+func HandleAPIUpdateSourceMaxEPS(w http.ResponseWriter, r *http.Request) {
+	sourceName := mux.Vars(r)["source"]
+
+	var request struct {
+		MaxEPS *int `json:"maxEps"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body, maxEps must be a positive integer: %v", err),
+		})
+		return
+	}
+	if request.MaxEPS == nil || *request.MaxEPS <= 0 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "maxEps must be a positive integer",
+		})
+		return
+	}
+	if !O11yManager.IsKnownSource(sourceName) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Unknown source %s", sourceName),
+		})
+		return
+	}
+
+	update, err := O11yManager.SetMaxEPS(sourceName, *request.MaxEPS)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to update max EPS: %v", err),
+		})
+		return
+	}
+
+	go AppState.BroadcastEvent("max_eps_updated", update)
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Max EPS of %s set to %d", sourceName, update.MaxEPS),
+		Data:    update,
+	})
+}
+
 // HandleAPIDistributeConfD Handles POST /api/o11y/confd/distribute
 func HandleAPIDistributeConfD(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -258,6 +351,40 @@ func HandleAPIDistributeConfD(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// With confd_lint.block_distribution, lint warnings stop the distribution unless ?skipLint=true
+	lint, err := ConfDLint.BeforeDistribution(r.URL.Query().Get("skipLint") == "true")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if lint != nil {
+			status = http.StatusPreconditionFailed
+		}
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: err.Error(),
+			Data:    lint,
+		})
+		return
+	}
+
+	// ?async=true queues the job and returns its ID for polling via /api/jobs/{id}
+	if r.URL.Query().Get("async") == "true" {
+		jobID, err := O11yManager.StartConfDDistribution()
+		if err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to distribute conf.d: %v", err),
+			})
+			return
+		}
+		status, _ := TransferScheduler.Get(jobID)
+		SendJSONResponse(w, http.StatusAccepted, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Conf.d distribution queued as job %s", jobID),
+			Data:    status,
+		})
+		return
+	}
+
 	// Distribute conf.d to all enabled nodes
 	response, err := O11yManager.DistributeConfD()
 	if err != nil {
@@ -284,6 +411,9 @@ func HandleAPIDistributeConfD(w http.ResponseWriter, r *http.Request) {
 		apiResponse.Data = make(map[string]interface{})
 	}
 	apiResponse.Data.(map[string]interface{})["distribution"] = response.Distribution
+	if lint != nil && !lint.Passed {
+		apiResponse.Data.(map[string]interface{})["lintWarnings"] = lint.Warnings
+	}
 
 	SendJSONResponse(w, statusCode, apiResponse)
 }
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OrphansConfig holds the orphans section of config.yaml
+type OrphansConfig struct {
+	ScanOnStartup bool `yaml:"scan_on_startup" json:"scanOnStartup"`
+	// Distribution leftovers in /tmp younger than this may belong to a running
+	// distribution and are not reported
+	TempMinAgeMinutes int `yaml:"temp_min_age_minutes" json:"tempMinAgeMinutes"`
+}
+
+// OrphanReport is the latest scan of the enabled nodes
+type OrphanReport struct {
+	Nodes     []*bin_control.NodeOrphans `json:"nodes"`
+	Orphans   int                        `json:"orphans"`
+	Errors    map[string]string          `json:"errors,omitempty"` // nodes that could not be scanned
+	ScannedAt time.Time                  `json:"scannedAt"`
+}
+
+// OrphanCleanupReport is the outcome of a cleanup on the selected nodes
+type OrphanCleanupReport struct {
+	Nodes       []*bin_control.OrphanCleanup `json:"nodes"`
+	Removed     int                          `json:"removed"`
+	Failed      int                          `json:"failed"`
+	Errors      map[string]string            `json:"errors,omitempty"` // nodes that could not be scanned
+	TriggeredBy string                       `json:"triggeredBy"`
+}
+
+// OrphanScanner finds what earlier manager sessions left behind on the nodes: kill
+// timers of simulators that are gone, node_metrics_api processes of replaced binaries
+// and conf.d archives in /tmp
+type OrphanScanner struct {
+	mutex  sync.Mutex
+	config OrphansConfig
+	latest *OrphanReport
+}
+
+var Orphans = &OrphanScanner{config: defaultOrphansConfig()}
+
+func defaultOrphansConfig() OrphansConfig {
+	return OrphansConfig{ScanOnStartup: true, TempMinAgeMinutes: 30}
+}
+
+// LoadConfig reads the orphans section from the application config file
+func (sc *OrphanScanner) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultOrphansConfig()
+	fileConfig := struct {
+		Orphans *OrphansConfig `yaml:"orphans"`
+	}{Orphans: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.TempMinAgeMinutes < 0 {
+		config.TempMinAgeMinutes = 30
+	}
+
+	sc.mutex.Lock()
+	sc.config = config
+	sc.mutex.Unlock()
+	return nil
+}
+
+// Config returns the orphan scan settings
+func (sc *OrphanScanner) Config() OrphansConfig {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.config
+}
+
+func (sc *OrphanScanner) tempMinAge() time.Duration {
+	return time.Duration(sc.Config().TempMinAgeMinutes) * time.Minute
+}
+
+// Latest returns the most recent scan, nil before the first one
+func (sc *OrphanScanner) Latest() *OrphanReport {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.latest
+}
+
+// ScanAtStartup scans the enabled nodes in the background when scan_on_startup is set
+// and logs the nodes with orphans
+func (sc *OrphanScanner) ScanAtStartup() {
+	if !sc.Config().ScanOnStartup {
+		return
+	}
+	go func() {
+		if err := BinaryControl.LoadNodesConfig(); err != nil {
+			logger.LogWarning("System", "Orphans", fmt.Sprintf("Startup orphan scan skipped: %v", err))
+			return
+		}
+		var nodes []string
+		for name := range BinaryControl.GetEnabledNodes() {
+			nodes = append(nodes, name)
+		}
+		report := sc.Scan(nodes)
+		for _, node := range report.Nodes {
+			if len(node.Orphans) > 0 {
+				logger.LogWarning(node.NodeName, "Orphans", fmt.Sprintf("%d orphans left by an earlier session, see GET /api/cluster/orphans", len(node.Orphans)))
+			}
+		}
+		if report.Orphans == 0 && len(report.Errors) == 0 {
+			logger.LogSuccess("System", "Orphans", fmt.Sprintf("No orphans on %d nodes", len(report.Nodes)))
+		}
+	}()
+}
+
+// Scan inspects the nodes in parallel and keeps the result as the latest report
+func (sc *OrphanScanner) Scan(nodes []string) *OrphanReport {
+	report := &OrphanReport{Nodes: []*bin_control.NodeOrphans{}, Errors: make(map[string]string)}
+	minAge := sc.tempMinAge()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			result, err := BinaryControl.ScanOrphans(node, minAge)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				report.Errors[node] = err.Error()
+				return
+			}
+			report.Nodes = append(report.Nodes, result)
+			report.Orphans += len(result.Orphans)
+		}(node)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].NodeName < report.Nodes[j].NodeName })
+	if len(report.Errors) == 0 {
+		report.Errors = nil
+	}
+	report.ScannedAt = time.Now().UTC()
+
+	sc.mutex.Lock()
+	sc.latest = report
+	sc.mutex.Unlock()
+	return report
+}
+
+// Cleanup removes the orphans of the nodes in parallel. Each node is scanned again
+// first, so only what is still there is touched.
+func (sc *OrphanScanner) Cleanup(nodes []string, triggeredBy string) *OrphanCleanupReport {
+	report := &OrphanCleanupReport{Nodes: []*bin_control.OrphanCleanup{}, Errors: make(map[string]string), TriggeredBy: triggeredBy}
+	minAge := sc.tempMinAge()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			result, err := BinaryControl.CleanupOrphans(node, minAge)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				report.Errors[node] = err.Error()
+				return
+			}
+			report.Nodes = append(report.Nodes, result)
+			report.Removed += result.Removed
+			report.Failed += result.Failed
+		}(node)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].NodeName < report.Nodes[j].NodeName })
+	if len(report.Errors) == 0 {
+		report.Errors = nil
+	}
+
+	// The previous scan is out of date now
+	sc.mutex.Lock()
+	sc.latest = nil
+	sc.mutex.Unlock()
+	return report
+}
+
+// HandleAPIGetOrphans Handles GET /api/cluster/orphans?refresh=true
+// Returns the orphaned kill timers, stale node_metrics_api processes and conf.d
+// leftovers in /tmp per enabled node, from the startup scan unless refresh is set
+func HandleAPIGetOrphans(w http.ResponseWriter, r *http.Request) {
+	report := Orphans.Latest()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		nodes, ok := selectFleetNodes(w, "", "scan")
+		if !ok {
+			return
+		}
+		report = Orphans.Scan(nodes)
+	}
+	message := fmt.Sprintf("%d orphans on %d nodes", report.Orphans, len(report.Nodes))
+	if len(report.Errors) > 0 {
+		message += fmt.Sprintf("; %d nodes could not be scanned", len(report.Errors))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// HandleAPICleanupOrphans Handles POST /api/cluster/orphans/cleanup?nodes=a,b
+// Kills orphaned kill timers before they fire, stops stale node_metrics_api processes
+// (starting the agent again if none is left) and deletes conf.d leftovers in /tmp, on
+// the given enabled nodes or all of them. Returns the outcome per node and orphan.
+func HandleAPICleanupOrphans(w http.ResponseWriter, r *http.Request) {
+	nodes, ok := selectFleetNodes(w, r.URL.Query().Get("nodes"), "clean up")
+	if !ok {
+		return
+	}
+	triggeredBy := auth.Describe(r.Context())
+	report := Orphans.Cleanup(nodes, triggeredBy)
+	logger.LogWithNode("System", "Orphans", fmt.Sprintf("Orphan cleanup on %d nodes by %s: %d removed, %d failed", len(nodes), triggeredBy, report.Removed, report.Failed), "info")
+
+	message := fmt.Sprintf("Removed %d orphans on %d nodes", report.Removed, len(nodes))
+	if report.Failed > 0 {
+		message += fmt.Sprintf(", %d could not be removed", report.Failed)
+	}
+	if len(report.Errors) > 0 {
+		message += fmt.Sprintf("; %d nodes could not be scanned", len(report.Errors))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: report.Failed == 0 && len(report.Errors) == 0,
+		Message: message,
+		Data:    report,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIProbeNode Handles GET /api/nodes/{name}/probe?target=kafka|clickhouse
+// Asks the node's agent to check Kafka/ClickHouse reachability from the node's network
+func HandleAPIProbeNode(w http.ResponseWriter, r *http.Request) {
+	nodeName := mux.Vars(r)["name"]
+	target := r.URL.Query().Get("target")
+	if target != "kafka" && target != "clickhouse" {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "target must be kafka or clickhouse",
+		})
+		return
+	}
+
+	node, ok := NodeManager.GetNodes()[nodeName]
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node %s not found", nodeName),
+		})
+		return
+	}
+
+	params := url.Values{}
+	params.Set("target", target)
+	// The agent refuses addresses it was not started with; the manager's ClickHouse is
+	// passed to it on start
+	if addr := r.URL.Query().Get("addr"); addr != "" {
+		params.Set("addr", addr)
+	}
+	if timeout := r.URL.Query().Get("timeout"); timeout != "" {
+		params.Set("timeout", timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 35*time.Second)
+	defer cancel()
+	resp, err := NodeClient.Get(ctx, node.AgentURL("/api/system/probe?"+params.Encode()))
+	if err != nil {
+		// The agent itself is unreachable, which is a different failure from the probe failing
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Node agent on %s is unreachable: %v", nodeName, err),
+		})
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read probe response from %s: %v", nodeName, err),
+		})
+		return
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid probe response from %s: %v", nodeName, err),
+		})
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		SendJSONResponse(w, resp.StatusCode, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Probe on %s failed: %v", nodeName, result["error"]),
+		})
+		return
+	}
+
+	reachable, _ := result["reachable"].(bool)
+	if !reachable {
+		logger.LogWarning(nodeName, "Probe", fmt.Sprintf("Node cannot reach %s", target))
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%s probe from %s completed", target, nodeName),
+		Data:    result,
+	})
+}
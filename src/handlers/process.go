@@ -5,8 +5,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/timeutil"
 )
 
 // handleAPIGetProcessMetrics handles GET /api/process/metrics
@@ -38,14 +39,14 @@ func HandleAPIGetProcessMetrics(w http.ResponseWriter, r *http.Request) {
 func CollectProcessMetricsForNode(nodeName string, nodeConfig *node_control.NodeConfig) ProcessMetrics {
 	metrics := ProcessMetrics{
 		NodeID:    nodeName,
-		Timestamp: time.Now(),
+		Timestamp: timeutil.Now(),
 	}
 
 	// Use SSH to collect process metrics from the remote node
 	// Use the same SSH execution method as used in node_manager.go
 
 	// Check if finalvudatasim process is running using SSHExecWithOutput
-	output, err := NodeManager.SSHExecWithOutput(*nodeConfig, "pgrep -f finalvudatasim")
+	output, err := NodeManager.SSHExecWithOutput(*nodeConfig, remotecmd.FindProcesses(remotecmd.SimulatorBinary))
 	if err != nil || output == "" {
 		metrics.Running = false
 		return metrics
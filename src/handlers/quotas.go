@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/runs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Quota subjects
+const (
+	QuotaSubjectUser = "user"
+	QuotaSubjectTeam = "team"
+)
+
+// QuotaLimits are the limits of one user or team; 0 means unlimited
+type QuotaLimits struct {
+	MaxConcurrentRuns  int `yaml:"max_concurrent_runs" json:"maxConcurrentRuns"`
+	MaxTotalEPS        int `yaml:"max_total_eps" json:"maxTotalEps"` // summed over the subject's running runs
+	MaxDurationMinutes int `yaml:"max_duration_minutes" json:"maxDurationMinutes"`
+}
+
+// QuotaConfig holds the quotas section of config.yaml. Users are matched by the user
+// of their API key, or its name when it has no user; teams by the key's team.
+type QuotaConfig struct {
+	Enabled     bool                   `yaml:"enabled" json:"enabled"`
+	DefaultUser QuotaLimits            `yaml:"default_user" json:"defaultUser"` // users without an entry
+	Users       map[string]QuotaLimits `yaml:"users" json:"users"`
+	Teams       map[string]QuotaLimits `yaml:"teams" json:"teams"` // teams without an entry are unlimited
+}
+
+// QuotaUsage is what a user or team currently consumes against its limits
+type QuotaUsage struct {
+	Subject     string      `json:"subject"` // user or team
+	Name        string      `json:"name"`
+	Limits      QuotaLimits `json:"limits"`
+	RunningRuns int         `json:"runningRuns"`
+	TotalEPS    int         `json:"totalEps"`
+	RunIDs      []string    `json:"runIds"`
+}
+
+// QuotaViolation explains why a start or EPS change was refused
+type QuotaViolation struct {
+	Subject string `json:"subject"`
+	Name    string `json:"name"`
+	Limit   string `json:"limit"` // the QuotaLimits field, e.g. maxTotalEps
+	Allowed int    `json:"allowed"`
+	Wanted  int    `json:"wanted"`
+	Message string `json:"message"`
+}
+
+// QuotaManager enforces per-user and per-team simulation quotas at start time
+type QuotaManager struct {
+	mutex  sync.Mutex
+	config QuotaConfig
+}
+
+var Quotas = &QuotaManager{config: defaultQuotaConfig()}
+
+func defaultQuotaConfig() QuotaConfig {
+	return QuotaConfig{
+		DefaultUser: QuotaLimits{MaxConcurrentRuns: 1},
+		Users:       map[string]QuotaLimits{},
+		Teams:       map[string]QuotaLimits{},
+	}
+}
+
+// LoadConfig reads the quotas section from the application config file
+func (qm *QuotaManager) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultQuotaConfig()
+	fileConfig := struct {
+		Quotas *QuotaConfig `yaml:"quotas"`
+	}{Quotas: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.Users == nil {
+		config.Users = map[string]QuotaLimits{}
+	}
+	if config.Teams == nil {
+		config.Teams = map[string]QuotaLimits{}
+	}
+	limits := []QuotaLimits{config.DefaultUser}
+	for _, limit := range config.Users {
+		limits = append(limits, limit)
+	}
+	for _, limit := range config.Teams {
+		limits = append(limits, limit)
+	}
+	for _, limit := range limits {
+		if limit.MaxConcurrentRuns < 0 || limit.MaxTotalEPS < 0 || limit.MaxDurationMinutes < 0 {
+			return fmt.Errorf("quota limits must not be negative")
+		}
+	}
+
+	qm.mutex.Lock()
+	qm.config = config
+	qm.mutex.Unlock()
+	return nil
+}
+
+// Config returns the quota settings
+func (qm *QuotaManager) Config() QuotaConfig {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	return qm.config
+}
+
+// quotaUser is the user name quotas and run ownership use for an identity
+func quotaUser(identity *auth.Identity) string {
+	if identity.User != "" {
+		return identity.User
+	}
+	return identity.Name
+}
+
+// runOwner records the caller as the owner of a run
+func runOwner(identity *auth.Identity) runs.RunOwner {
+	if identity == nil {
+		return runs.RunOwner{Name: "unknown"}
+	}
+	return runs.RunOwner{Name: identity.Name, User: quotaUser(identity), Team: identity.Team}
+}
+
+// limitsFor returns the limits of a subject and whether it has any
+func (config QuotaConfig) limitsFor(subject, name string) (QuotaLimits, bool) {
+	if subject == QuotaSubjectTeam {
+		limits, ok := config.Teams[name]
+		return limits, ok
+	}
+	if limits, ok := config.Users[name]; ok {
+		return limits, true
+	}
+	return config.DefaultUser, true
+}
+
+// Usage returns the running runs and EPS of every user and team that has a running
+// run or a configured quota, users first
+func (qm *QuotaManager) Usage() []QuotaUsage {
+	config := qm.Config()
+	usage := make(map[string]*QuotaUsage)
+	entry := func(subject, name string) *QuotaUsage {
+		key := subject + "/" + name
+		if usage[key] == nil {
+			limits, _ := config.limitsFor(subject, name)
+			usage[key] = &QuotaUsage{Subject: subject, Name: name, Limits: limits, RunIDs: []string{}}
+		}
+		return usage[key]
+	}
+	for name := range config.Users {
+		entry(QuotaSubjectUser, name)
+	}
+	for name := range config.Teams {
+		entry(QuotaSubjectTeam, name)
+	}
+
+	sim := AppState.Simulation()
+	for _, run := range RunStore.RunningRuns() {
+		if run.Owner == nil {
+			continue
+		}
+		eps := run.TargetEPS
+		if sim.Running && sim.RunID == run.ID {
+			// Live EPS adjustments only update the simulation state
+			eps = sim.TargetEPS
+		}
+		subjects := []*QuotaUsage{entry(QuotaSubjectUser, run.Owner.User)}
+		if run.Owner.Team != "" {
+			subjects = append(subjects, entry(QuotaSubjectTeam, run.Owner.Team))
+		}
+		for _, subject := range subjects {
+			subject.RunningRuns++
+			subject.TotalEPS += eps
+			subject.RunIDs = append(subject.RunIDs, run.ID)
+		}
+	}
+
+	list := make([]QuotaUsage, 0, len(usage))
+	for _, subject := range usage {
+		list = append(list, *subject)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Subject != list[j].Subject {
+			return list[i].Subject == QuotaSubjectUser
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// usageOf returns the current usage of one subject
+func (qm *QuotaManager) usageOf(subject, name string) QuotaUsage {
+	for _, usage := range qm.Usage() {
+		if usage.Subject == subject && usage.Name == name {
+			return usage
+		}
+	}
+	limits, _ := qm.Config().limitsFor(subject, name)
+	return QuotaUsage{Subject: subject, Name: name, Limits: limits, RunIDs: []string{}}
+}
+
+// quotaSubjects lists the user and, if set, the team of an owner
+func quotaSubjects(owner runs.RunOwner) [][2]string {
+	subjects := [][2]string{{QuotaSubjectUser, owner.User}}
+	if owner.Team != "" {
+		subjects = append(subjects, [2]string{QuotaSubjectTeam, owner.Team})
+	}
+	return subjects
+}
+
+// CheckStart checks a new run of the caller against its user and team quotas. Quotas
+// do not apply while they are disabled or auth is off, since every caller is then the
+// same anonymous admin.
+func (qm *QuotaManager) CheckStart(identity *auth.Identity, eps, durationMinutes int) *QuotaViolation {
+	config := qm.Config()
+	if !config.Enabled || identity == nil || identity.Anonymous {
+		return nil
+	}
+	for _, subject := range quotaSubjects(runOwner(identity)) {
+		limits, ok := config.limitsFor(subject[0], subject[1])
+		if !ok {
+			continue
+		}
+		usage := qm.usageOf(subject[0], subject[1])
+		if limits.MaxConcurrentRuns > 0 && usage.RunningRuns+1 > limits.MaxConcurrentRuns {
+			return newQuotaViolation(subject, "maxConcurrentRuns", limits.MaxConcurrentRuns, usage.RunningRuns+1,
+				fmt.Sprintf("%s %s already has %d of %d concurrent runs", subject[0], subject[1], usage.RunningRuns, limits.MaxConcurrentRuns))
+		}
+		if limits.MaxTotalEPS > 0 && usage.TotalEPS+eps > limits.MaxTotalEPS {
+			return newQuotaViolation(subject, "maxTotalEps", limits.MaxTotalEPS, usage.TotalEPS+eps,
+				fmt.Sprintf("%s %s would run %d EPS in total, its quota is %d", subject[0], subject[1], usage.TotalEPS+eps, limits.MaxTotalEPS))
+		}
+		if limits.MaxDurationMinutes > 0 && (durationMinutes == 0 || durationMinutes > limits.MaxDurationMinutes) {
+			return newQuotaViolation(subject, "maxDurationMinutes", limits.MaxDurationMinutes, durationMinutes,
+				fmt.Sprintf("%s %s may run for at most %d minutes, set durationMinutes accordingly", subject[0], subject[1], limits.MaxDurationMinutes))
+		}
+	}
+	return nil
+}
+
+// CheckEPS checks a live EPS change of a running run against its owner's quotas
+func (qm *QuotaManager) CheckEPS(runID string, newEPS int) *QuotaViolation {
+	config := qm.Config()
+	if !config.Enabled || !Auth.Enabled() {
+		return nil
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok || run.Owner == nil {
+		return nil
+	}
+	currentEPS := run.TargetEPS
+	if sim := AppState.Simulation(); sim.Running && sim.RunID == runID {
+		currentEPS = sim.TargetEPS
+	}
+	for _, subject := range quotaSubjects(*run.Owner) {
+		limits, ok := config.limitsFor(subject[0], subject[1])
+		if !ok || limits.MaxTotalEPS == 0 {
+			continue
+		}
+		total := qm.usageOf(subject[0], subject[1]).TotalEPS - currentEPS + newEPS
+		if total > limits.MaxTotalEPS {
+			return newQuotaViolation(subject, "maxTotalEps", limits.MaxTotalEPS, total,
+				fmt.Sprintf("%s %s would run %d EPS in total, its quota is %d", subject[0], subject[1], total, limits.MaxTotalEPS))
+		}
+	}
+	return nil
+}
+
+func newQuotaViolation(subject [2]string, limit string, allowed, wanted int, message string) *QuotaViolation {
+	return &QuotaViolation{Subject: subject[0], Name: subject[1], Limit: limit, Allowed: allowed, Wanted: wanted, Message: "Quota exceeded: " + message}
+}
+
+// HandleAPIGetQuotas Handles GET /api/quotas
+// Returns the quota settings, the caller's limits and the running runs and EPS every
+// user and team consumes
+func HandleAPIGetQuotas(w http.ResponseWriter, r *http.Request) {
+	config := Quotas.Config()
+	data := map[string]interface{}{
+		"enabled": config.Enabled && Auth.Enabled(),
+		"config":  config,
+		"usage":   Quotas.Usage(),
+	}
+	if identity := auth.FromContext(r.Context()); identity != nil && !identity.Anonymous {
+		caller := []QuotaUsage{}
+		for _, subject := range quotaSubjects(runOwner(identity)) {
+			if _, ok := config.limitsFor(subject[0], subject[1]); ok {
+				caller = append(caller, Quotas.usageOf(subject[0], subject[1]))
+			}
+		}
+		data["caller"] = caller
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
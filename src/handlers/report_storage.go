@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/objectstore"
+	"vuDataSim/src/runs"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Report storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// DefaultWorkspace is used for runs started by callers without a configured workspace
+const DefaultWorkspace = "default"
+
+// lifecycleRuleIDPrefix marks the bucket lifecycle rules the manager owns
+const lifecycleRuleIDPrefix = "vudatasim-"
+
+// configBackupsFolder holds the config backups under report_storage.prefix; it cannot be
+// used as a workspace name
+const configBackupsFolder = "config-backups"
+
+// WorkspaceStorage overrides where the runs of one workspace are uploaded. Empty fields
+// fall back to the report_storage defaults.
+type WorkspaceStorage struct {
+	Backend    string                `yaml:"backend" json:"backend,omitempty"`
+	Prefix     string                `yaml:"prefix" json:"prefix,omitempty"`          // defaults to <prefix><workspace>/
+	ExpireDays *int                  `yaml:"expire_days" json:"expireDays,omitempty"` // 0 keeps uploads forever
+	S3         *objectstore.S3Config `yaml:"s3" json:"s3,omitempty"`                  // replaces the default bucket entirely
+}
+
+// ReportStorageConfig holds the report_storage section of config.yaml
+type ReportStorageConfig struct {
+	Backend                string                      `yaml:"backend" json:"backend"` // local or s3
+	Prefix                 string                      `yaml:"prefix" json:"prefix"`
+	ExpireDays             int                         `yaml:"expire_days" json:"expireDays"`         // lifecycle rule deleting uploads after this many days; 0 keeps them
+	PresignMinutes         int                         `yaml:"presign_minutes" json:"presignMinutes"` // default validity of the links
+	DeleteLocalAfterUpload bool                        `yaml:"delete_local_after_upload" json:"deleteLocalAfterUpload"`
+	S3                     objectstore.S3Config        `yaml:"s3" json:"s3"`
+	Workspaces             map[string]WorkspaceStorage `yaml:"workspaces" json:"workspaces,omitempty"`
+}
+
+// storageTarget is where the runs of one workspace go, after applying the defaults
+type storageTarget struct {
+	Workspace  string
+	Backend    string
+	Prefix     string
+	ExpireDays int
+	S3         objectstore.S3Config
+}
+
+// ArtifactLink is a download link for one artifact of a run
+type ArtifactLink struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+}
+
+// ArtifactLinks is the response of GET /api/runs/{id}/artifacts/links
+type ArtifactLinks struct {
+	RunID     string         `json:"runId"`
+	Workspace string         `json:"workspace"`
+	Backend   string         `json:"backend"`
+	Bucket    string         `json:"bucket,omitempty"`
+	ExpiresAt *time.Time     `json:"expiresAt,omitempty"`
+	Links     []ArtifactLink `json:"links"`
+}
+
+// ReportStore uploads the artifacts and report of finished runs to object storage, so
+// they outlive the manager's small disk, and hands out presigned links to them
+type ReportStore struct {
+	mutex     sync.Mutex
+	config    ReportStorageConfig
+	lifecycle map[string]bool // buckets whose lifecycle rules are in place
+}
+
+var ReportStorage = &ReportStore{
+	config:    defaultReportStorageConfig(),
+	lifecycle: make(map[string]bool),
+}
+
+func defaultReportStorageConfig() ReportStorageConfig {
+	return ReportStorageConfig{Backend: BackendLocal, Prefix: "vudatasim/", PresignMinutes: 60}
+}
+
+// LoadConfig reads the report_storage section from the application config file
+func (rs *ReportStore) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultReportStorageConfig()
+	fileConfig := struct {
+		ReportStorage *ReportStorageConfig `yaml:"report_storage"`
+	}{ReportStorage: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.PresignMinutes <= 0 {
+		config.PresignMinutes = 60
+	}
+	if time.Duration(config.PresignMinutes)*time.Minute > objectstore.MaxPresignExpiry {
+		return fmt.Errorf("report_storage.presign_minutes must be at most %d", int(objectstore.MaxPresignExpiry.Minutes()))
+	}
+	if config.Prefix != "" && !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+	if _, ok := config.Workspaces[configBackupsFolder]; ok {
+		return fmt.Errorf("workspace name %s is reserved for config backups", configBackupsFolder)
+	}
+	for _, name := range append([]string{DefaultWorkspace}, sortedWorkspaces(config)...) {
+		target := config.target(name)
+		if target.Backend != BackendLocal && target.Backend != BackendS3 {
+			return fmt.Errorf("unknown backend %q for workspace %s, use local or s3", target.Backend, name)
+		}
+		if target.ExpireDays < 0 {
+			return fmt.Errorf("expire_days of workspace %s must not be negative", name)
+		}
+		if target.Backend == BackendS3 && (target.S3.Endpoint == "" || target.S3.Bucket == "") {
+			return fmt.Errorf("workspace %s uploads to s3 but has no endpoint or bucket", name)
+		}
+	}
+
+	rs.mutex.Lock()
+	rs.config = config
+	rs.lifecycle = make(map[string]bool)
+	rs.mutex.Unlock()
+	return nil
+}
+
+// Config returns the report storage settings
+func (rs *ReportStore) Config() ReportStorageConfig {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	return rs.config
+}
+
+func sortedWorkspaces(config ReportStorageConfig) []string {
+	names := make([]string, 0, len(config.Workspaces))
+	for name := range config.Workspaces {
+		if name != DefaultWorkspace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// target resolves the storage of a workspace; unknown workspaces use the defaults
+func (c ReportStorageConfig) target(workspace string) storageTarget {
+	target := storageTarget{
+		Workspace:  workspace,
+		Backend:    c.Backend,
+		Prefix:     c.Prefix + workspace + "/",
+		ExpireDays: c.ExpireDays,
+		S3:         c.S3,
+	}
+	override, ok := c.Workspaces[workspace]
+	if !ok {
+		return target
+	}
+	if override.Backend != "" {
+		target.Backend = override.Backend
+	}
+	if override.Prefix != "" {
+		target.Prefix = strings.TrimSuffix(override.Prefix, "/") + "/"
+	}
+	if override.ExpireDays != nil {
+		target.ExpireDays = *override.ExpireDays
+	}
+	if override.S3 != nil {
+		target.S3 = *override.S3
+	}
+	return target
+}
+
+// WorkspaceFor picks the workspace of a new run: the one requested, else the caller's
+// team when it is configured as a workspace, else the default workspace
+func (rs *ReportStore) WorkspaceFor(requested string, identity *auth.Identity) (string, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+	if requested != "" {
+		if _, ok := rs.config.Workspaces[requested]; !ok && requested != DefaultWorkspace {
+			return "", fmt.Errorf("unknown workspace %s", requested)
+		}
+		return requested, nil
+	}
+	if identity != nil && identity.Team != "" {
+		if _, ok := rs.config.Workspaces[identity.Team]; ok {
+			return identity.Team, nil
+		}
+	}
+	return DefaultWorkspace, nil
+}
+
+// s3Client returns a client for the target's bucket, first putting the lifecycle rules
+// of every workspace that uploads to the bucket in place
+func (rs *ReportStore) s3Client(ctx context.Context, target storageTarget) (*objectstore.S3Client, error) {
+	client, err := objectstore.NewS3Client(target.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	rs.mutex.Lock()
+	config := rs.config
+	bucketKey := target.S3.Endpoint + "/" + target.S3.Bucket
+	done := rs.lifecycle[bucketKey]
+	rs.mutex.Unlock()
+	if done {
+		return client, nil
+	}
+
+	var rules []objectstore.LifecycleRule
+	for _, name := range append([]string{DefaultWorkspace}, sortedWorkspaces(config)...) {
+		other := config.target(name)
+		if other.Backend != BackendS3 || other.S3.Endpoint+"/"+other.S3.Bucket != bucketKey || other.ExpireDays == 0 {
+			continue
+		}
+		rules = append(rules, objectstore.LifecycleRule{
+			ID:             lifecycleRuleIDPrefix + name,
+			Prefix:         other.Prefix,
+			ExpirationDays: other.ExpireDays,
+		})
+	}
+	if backups := ConfigBackups.Config(); backups.Upload && backups.RemoteExpireDays > 0 && config.S3.Endpoint+"/"+config.S3.Bucket == bucketKey {
+		rules = append(rules, objectstore.LifecycleRule{
+			ID:             lifecycleRuleIDPrefix + configBackupsFolder,
+			Prefix:         config.Prefix + configBackupsFolder + "/",
+			ExpirationDays: backups.RemoteExpireDays,
+		})
+	}
+	if err := client.SetLifecycleRules(ctx, lifecycleRuleIDPrefix, rules); err != nil {
+		return nil, err
+	}
+	rs.mutex.Lock()
+	rs.lifecycle[bucketKey] = true
+	rs.mutex.Unlock()
+	return client, nil
+}
+
+// UploadConfigBackup copies a config backup archive to <prefix>config-backups/ in the
+// default bucket and returns its location
+func (rs *ReportStore) UploadConfigBackup(ctx context.Context, name, path string) (string, error) {
+	config := rs.Config()
+	if config.S3.Endpoint == "" || config.S3.Bucket == "" {
+		return "", fmt.Errorf("report_storage.s3 has no endpoint or bucket")
+	}
+	target := config.target(DefaultWorkspace)
+	target.S3 = config.S3
+	client, err := rs.s3Client(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	key := config.Prefix + configBackupsFolder + "/" + name
+	if err := client.PutFile(ctx, key, path, "application/gzip"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("s3://%s/%s", config.S3.Bucket, key), nil
+}
+
+// Upload copies the artifacts of a finished run, and its run record, to the object
+// storage of its workspace. Runs of local workspaces are left alone and return nil.
+func (rs *ReportStore) Upload(ctx context.Context, runID string) (*runs.RemoteCopy, error) {
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		return nil, fmt.Errorf("run %s not found", runID)
+	}
+	if run.Status == runs.StatusRunning {
+		return nil, fmt.Errorf("run %s is still running", runID)
+	}
+	config := rs.Config()
+	workspace := run.Workspace
+	if workspace == "" {
+		workspace = DefaultWorkspace
+	}
+	target := config.target(workspace)
+	if target.Backend == BackendLocal {
+		return nil, nil
+	}
+	// Checked before anything is recorded so a retry after delete_local_after_upload does
+	// not replace the record of the earlier upload
+	artifacts, err := RunStore.ListArtifacts(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) == 0 {
+		return nil, fmt.Errorf("run %s has no local artifacts to upload", run.ID)
+	}
+
+	remote := &runs.RemoteCopy{
+		Backend: target.Backend,
+		Bucket:  target.S3.Bucket,
+		Prefix:  target.Prefix + run.ID + "/",
+		Objects: []string{},
+	}
+	err = rs.upload(ctx, run, artifacts, target, remote)
+	if err != nil {
+		remote.Error = err.Error()
+	} else {
+		now := time.Now().UTC()
+		remote.UploadedAt = &now
+	}
+	if saveErr := RunStore.SetRemoteCopy(run.ID, remote); saveErr != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record upload of run %s: %v", run.ID, saveErr))
+	}
+	if err != nil {
+		return remote, err
+	}
+
+	if config.DeleteLocalAfterUpload {
+		if err := RunStore.RemoveArtifacts(run.ID); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to remove local artifacts of uploaded run %s: %v", run.ID, err))
+		}
+	}
+	return remote, nil
+}
+
+func (rs *ReportStore) upload(ctx context.Context, run *runs.Run, artifacts []runs.Artifact, target storageTarget, remote *runs.RemoteCopy) error {
+	client, err := rs.s3Client(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	root := RunStore.ArtifactsDir(run.ID)
+	for _, artifact := range artifacts {
+		key := remote.Prefix + artifact.Path
+		if err := client.PutFile(ctx, key, filepath.Join(root, filepath.FromSlash(artifact.Path)), contentTypeOf(artifact.Path)); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", artifact.Path, err)
+		}
+		remote.Objects = append(remote.Objects, artifact.Path)
+		remote.Bytes += artifact.Size
+	}
+
+	// The run record goes last so its presence marks a complete upload
+	record, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := client.PutBytes(ctx, remote.Prefix+"run.json", record, "application/json"); err != nil {
+		return fmt.Errorf("failed to upload run.json: %v", err)
+	}
+	remote.Objects = append(remote.Objects, "run.json")
+	remote.Bytes += int64(len(record))
+	return nil
+}
+
+func contentTypeOf(name string) string {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// uploadRunArtifacts uploads a finished run and notes the outcome on its timeline
+func uploadRunArtifacts(run *runs.Run) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	remote, err := ReportStorage.Upload(ctx, run.ID)
+	if err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to upload artifacts of run %s: %v", run.ID, err))
+		RunStore.AddTimelineEvent(run.ID, "artifacts_upload_failed", fmt.Sprintf("Artifact upload failed: %v", err), nil)
+		return
+	}
+	if remote == nil {
+		return
+	}
+	logger.LogSuccess("System", "Runs", fmt.Sprintf("Uploaded %d artifacts of run %s to %s/%s", len(remote.Objects), run.ID, remote.Bucket, remote.Prefix))
+	RunStore.AddTimelineEvent(run.ID, "artifacts_uploaded", fmt.Sprintf("Uploaded %d artifacts to %s", len(remote.Objects), remote.Backend), map[string]interface{}{
+		"bucket": remote.Bucket,
+		"prefix": remote.Prefix,
+		"bytes":  remote.Bytes,
+	})
+}
+
+// Links returns download links for a run's artifacts: presigned object storage URLs when
+// the run was uploaded, else the manager's own download endpoints
+func (rs *ReportStore) Links(run *runs.Run, expiry time.Duration) (*ArtifactLinks, error) {
+	workspace := run.Workspace
+	if workspace == "" {
+		workspace = DefaultWorkspace
+	}
+	links := &ArtifactLinks{RunID: run.ID, Workspace: workspace, Backend: BackendLocal, Links: []ArtifactLink{}}
+
+	remote := run.Remote
+	if remote == nil || remote.UploadedAt == nil {
+		links.Links = append(links.Links,
+			ArtifactLink{Path: "artifacts.zip", URL: fmt.Sprintf("/api/v1/runs/%s/artifacts.zip", run.ID)},
+			ArtifactLink{Path: "report", URL: fmt.Sprintf("/api/v1/runs/%s/report", run.ID)},
+		)
+		return links, nil
+	}
+
+	// Presign with the bucket's current credentials, wherever the workspace points now
+	s3Config := rs.Config().target(workspace).S3
+	if s3Config.Bucket != remote.Bucket {
+		return nil, fmt.Errorf("run %s was uploaded to bucket %s, which workspace %s no longer uses", run.ID, remote.Bucket, workspace)
+	}
+	client, err := objectstore.NewS3Client(s3Config)
+	if err != nil {
+		return nil, err
+	}
+	links.Backend = remote.Backend
+	links.Bucket = remote.Bucket
+	for _, object := range remote.Objects {
+		url, expiresAt, err := client.PresignGet(remote.Prefix+object, expiry)
+		if err != nil {
+			return nil, err
+		}
+		links.ExpiresAt = &expiresAt
+		links.Links = append(links.Links, ArtifactLink{Path: object, URL: url})
+	}
+	return links, nil
+}
+
+// HandleAPIGetRunArtifactLinks Handles GET /api/runs/{id}/artifacts/links?expiresMinutes=60
+func HandleAPIGetRunArtifactLinks(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+
+	minutes := ReportStorage.Config().PresignMinutes
+	if value := r.URL.Query().Get("expiresMinutes"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || time.Duration(parsed)*time.Minute > objectstore.MaxPresignExpiry {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("expiresMinutes must be between 1 and %d", int(objectstore.MaxPresignExpiry.Minutes())),
+			})
+			return
+		}
+		minutes = parsed
+	}
+
+	links, err := ReportStorage.Links(run, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to create links: %v", err),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d links for run %s", len(links.Links), runID),
+		Data:    links,
+	})
+}
+
+// HandleAPIUploadRunArtifacts Handles POST /api/runs/{id}/artifacts/upload
+func HandleAPIUploadRunArtifacts(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	if run.Status == runs.StatusRunning {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s is still running", runID),
+		})
+		return
+	}
+
+	remote, err := ReportStorage.Upload(r.Context(), runID)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to upload artifacts of run %s: %v", runID, err),
+			Data:    remote,
+		})
+		return
+	}
+	if remote == nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Workspace of run %s keeps its artifacts locally", runID),
+		})
+		return
+	}
+	logger.LogSuccess("System", "Runs", fmt.Sprintf("Artifacts of run %s uploaded by %s", runID, auth.Describe(r.Context())))
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Uploaded %d artifacts of run %s", len(remote.Objects), runID),
+		Data:    remote,
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/notify"
+)
+
+// reservationBreachSamples consecutive node samples over the allocatable share raise an
+// encroachment, so a short burst at startup does not page anyone
+const reservationBreachSamples = 2
+
+// Reserved resources
+const (
+	ReservedCPU    = "cpu"
+	ReservedMemory = "memory"
+)
+
+// NodeReservationStatus compares what the simulator uses on a node with the share of the
+// node left to it by the reservation
+type NodeReservationStatus struct {
+	Node                string                    `json:"node"`
+	Reserved            *node_control.Reservation `json:"reserved"`
+	TotalCPU            float64                   `json:"totalCpu"`
+	TotalMemoryGB       float64                   `json:"totalMemoryGb"`
+	AllocatableCPU      float64                   `json:"allocatableCpu"`
+	AllocatableMemoryGB float64                   `json:"allocatableMemoryGb"`
+	SimulatorCPU        *float64                  `json:"simulatorCpu,omitempty"` // cores used by finalvudatasim
+	SimulatorMemoryGB   *float64                  `json:"simulatorMemoryGb,omitempty"`
+	Encroaching         []string                  `json:"encroaching"` // cpu and/or memory
+	SampledAt           *time.Time                `json:"sampledAt,omitempty"`
+}
+
+// ReservationMonitor warns when finalvudatasim uses more of a node than its reservation
+// leaves allocatable, i.e. when it starts taking CPU or memory from the colocated
+// workload. It is fed by the run node sampler.
+type ReservationMonitor struct {
+	mutex    sync.Mutex
+	runID    string
+	statuses map[string]NodeReservationStatus
+	breaches map[string]int  // consecutive samples over the share per node and resource
+	raised   map[string]bool // encroachments already reported for the run
+}
+
+var Reservations = &ReservationMonitor{
+	statuses: make(map[string]NodeReservationStatus),
+	breaches: make(map[string]int),
+	raised:   make(map[string]bool),
+}
+
+// Check compares the simulator usage in the samples of a run with the allocatable share
+// of the nodes that have a reservation
+func (rm *ReservationMonitor) Check(runID string, samples []NodeSample) {
+	nodes := NodeManager.GetNodes()
+
+	rm.mutex.Lock()
+	if rm.runID != runID {
+		rm.runID = runID
+		rm.breaches = make(map[string]int)
+		rm.raised = make(map[string]bool)
+	}
+	var raised []NodeReservationStatus
+	for _, sample := range samples {
+		config, ok := nodes[sample.Node]
+		if !ok || config.Reserved == nil || sample.Source != SampleSourceAgent {
+			continue
+		}
+		status := reservationStatus(sample.Node, config, sample)
+		rm.statuses[sample.Node] = status
+
+		encroaching := make(map[string]bool, len(status.Encroaching))
+		for _, resource := range status.Encroaching {
+			encroaching[resource] = true
+		}
+		newlyRaised := false
+		for _, resource := range []string{ReservedCPU, ReservedMemory} {
+			key := sample.Node + "/" + resource
+			if !encroaching[resource] {
+				rm.breaches[key] = 0
+				continue
+			}
+			rm.breaches[key]++
+			if rm.breaches[key] >= reservationBreachSamples && !rm.raised[key] {
+				rm.raised[key] = true
+				newlyRaised = true
+			}
+		}
+		if newlyRaised {
+			raised = append(raised, status)
+		}
+	}
+	rm.mutex.Unlock()
+
+	for _, status := range raised {
+		message := describeEncroachment(status)
+		logger.LogWarning(status.Node, "Reservations", message)
+		sendNotification(notify.Message{
+			Subject:  fmt.Sprintf("vuDataSim encroaches on reserved capacity of %s", status.Node),
+			Text:     fmt.Sprintf("Run %s: %s", runID, message),
+			Severity: notify.SeverityWarning,
+			Event:    notify.EventReservation,
+		})
+		if err := RunStore.AddTimelineEvent(runID, "reservation_encroached", message, map[string]interface{}{
+			"node":                status.Node,
+			"resources":           status.Encroaching,
+			"reserved":            status.Reserved,
+			"allocatableCpu":      status.AllocatableCPU,
+			"allocatableMemoryGb": status.AllocatableMemoryGB,
+			"simulatorCpu":        status.SimulatorCPU,
+			"simulatorMemoryGb":   status.SimulatorMemoryGB,
+		}); err != nil {
+			log.Printf("Warning: Failed to record reservation encroachment for run %s: %v", runID, err)
+		}
+	}
+}
+
+// reservationStatus works out the allocatable share of a node from an agent sample and
+// which resources the simulator uses beyond it
+func reservationStatus(name string, config node_control.NodeConfig, sample NodeSample) NodeReservationStatus {
+	status := NodeReservationStatus{
+		Node:          name,
+		Reserved:      config.Reserved,
+		TotalCPU:      sample.Metrics["cpu_cores"],
+		TotalMemoryGB: sample.Metrics["mem_total_mb"] / 1024,
+		Encroaching:   []string{},
+		SampledAt:     &sample.Time,
+	}
+	status.AllocatableCPU, status.AllocatableMemoryGB = config.Allocatable(status.TotalCPU, status.TotalMemoryGB)
+	if sample.Metrics["process_running"] != 1 {
+		return status
+	}
+
+	cores := sample.Metrics["process_cpu_percent"] / 100 // ps reports percent of one core
+	memoryGB := sample.Metrics["process_mem_mb"] / 1024
+	status.SimulatorCPU, status.SimulatorMemoryGB = &cores, &memoryGB
+	if config.Reserved.CPUCores > 0 && status.TotalCPU > 0 && cores > status.AllocatableCPU {
+		status.Encroaching = append(status.Encroaching, ReservedCPU)
+	}
+	if config.Reserved.MemoryGB > 0 && status.TotalMemoryGB > 0 && memoryGB > status.AllocatableMemoryGB {
+		status.Encroaching = append(status.Encroaching, ReservedMemory)
+	}
+	return status
+}
+
+func describeEncroachment(status NodeReservationStatus) string {
+	reason := ""
+	if status.Reserved.Reason != "" {
+		reason = " for " + status.Reserved.Reason
+	}
+	message := fmt.Sprintf("finalvudatasim on %s uses capacity reserved%s:", status.Node, reason)
+	for _, resource := range status.Encroaching {
+		switch resource {
+		case ReservedCPU:
+			message += fmt.Sprintf(" %.1f cores of %.1f allocatable (%.1f reserved)", *status.SimulatorCPU, status.AllocatableCPU, status.Reserved.CPUCores)
+		case ReservedMemory:
+			message += fmt.Sprintf(" %.1f GB memory of %.1f allocatable (%.1f reserved)", *status.SimulatorMemoryGB, status.AllocatableMemoryGB, status.Reserved.MemoryGB)
+		}
+	}
+	return message
+}
+
+// Status returns the nodes with a reservation, with the simulator usage of the last
+// sample during a run. Nodes not sampled yet use the totals on the dashboard.
+func (rm *ReservationMonitor) Status() []NodeReservationStatus {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	statuses := []NodeReservationStatus{}
+	for name, config := range NodeManager.GetNodes() {
+		if config.Reserved == nil {
+			continue
+		}
+		status, ok := rm.statuses[name]
+		if !ok {
+			status = NodeReservationStatus{Node: name, Encroaching: []string{}}
+			if node, known := AppState.Node(name); known {
+				status.TotalCPU, status.TotalMemoryGB = node.TotalCPU, node.TotalMemory
+			}
+		}
+		// The reservation may have changed since the sample
+		status.Reserved = config.Reserved
+		status.AllocatableCPU, status.AllocatableMemoryGB = config.Allocatable(status.TotalCPU, status.TotalMemoryGB)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Node < statuses[j].Node })
+	return statuses
+}
+
+// allocatableCores sums the cores left to the simulator on the enabled nodes, as last
+// reported on the dashboard. It is 0 when no enabled node reported its cores.
+func allocatableCores() float64 {
+	total := 0.0
+	for name, config := range NodeManager.GetEnabledNodes() {
+		if node, ok := AppState.Node(name); ok && !node.LastUpdate.IsZero() {
+			cores, _ := config.Allocatable(node.TotalCPU, node.TotalMemory)
+			total += cores
+		}
+	}
+	return total
+}
+
+// HandleAPIGetNodeReservations Handles GET /api/nodes/reservations
+// Lists the nodes with reserved capacity, what is allocatable to the simulator and
+// whether it used more than that in the last sample of the active run.
+func HandleAPIGetNodeReservations(w http.ResponseWriter, r *http.Request) {
+	statuses := Reservations.Status()
+	encroaching := 0
+	for _, status := range statuses {
+		if len(status.Encroaching) > 0 {
+			encroaching++
+		}
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d nodes with reserved capacity, %d encroached on", len(statuses), encroaching),
+		Data:    statuses,
+	})
+}
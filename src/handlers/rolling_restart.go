@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/bin_control"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rolling restart statuses
+const (
+	RollingRestartRunning   = "running"
+	RollingRestartCompleted = "completed"
+	RollingRestartAborted   = "aborted"
+)
+
+// Node outcomes of a rolling restart
+const (
+	RestartNodePending   = "pending"
+	RestartNodeRunning   = "restarting"
+	RestartNodeHealthy   = "healthy"
+	RestartNodeFailed    = "failed"
+	RestartNodeSkipped   = "skipped"   // the binary was not running, so it is not started either
+	RestartNodeCancelled = "cancelled" // not reached before the restart aborted
+)
+
+// RollingRestartConfig holds the rolling_restart section of config.yaml
+type RollingRestartConfig struct {
+	BatchSize              int `yaml:"batch_size" json:"batchSize"` // nodes restarted at the same time
+	HealthTimeoutSeconds   int `yaml:"health_timeout_seconds" json:"healthTimeoutSeconds"`
+	PollSeconds            int `yaml:"poll_seconds" json:"pollSeconds"`
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures" json:"maxConsecutiveFailures"`
+	// MinEPS is the EPS a restarted node must report to the dashboard to count as
+	// producing again; 0 only requires a fresh report after the restart
+	MinEPS int `yaml:"min_eps" json:"minEps"`
+}
+
+// RollingRestartRequest holds the per-restart overrides of POST /api/binary/rolling-restart
+type RollingRestartRequest struct {
+	Nodes                  []string
+	BatchSize              int
+	MaxConsecutiveFailures int
+	Timeout                int // minutes after which the restarted binaries stop, 0 never
+}
+
+// RollingRestartNode is the outcome of one node
+type RollingRestartNode struct {
+	Node          string     `json:"node"`
+	Batch         int        `json:"batch"`
+	Status        string     `json:"status"`
+	Message       string     `json:"message,omitempty"`
+	EPSBefore     int        `json:"epsBefore"`
+	EPSAfter      int        `json:"epsAfter,omitempty"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	HealthyAfterS float64    `json:"healthyAfterSeconds,omitempty"` // from the stop to the first healthy report
+}
+
+// RollingRestartResult is the state of the running or latest rolling restart
+type RollingRestartResult struct {
+	Status                 string               `json:"status"`
+	BatchSize              int                  `json:"batchSize"`
+	MaxConsecutiveFailures int                  `json:"maxConsecutiveFailures"`
+	ConsecutiveFailures    int                  `json:"consecutiveFailures"`
+	Nodes                  []RollingRestartNode `json:"nodes"`
+	Message                string               `json:"message,omitempty"`
+	TriggeredBy            string               `json:"triggeredBy"`
+	RunID                  string               `json:"runId,omitempty"`
+	StartedAt              time.Time            `json:"startedAt"`
+	EndedAt                *time.Time           `json:"endedAt,omitempty"`
+}
+
+// RollingRestarter restarts the simulators batch by batch, waiting for every node of a
+// batch to produce again before the next one, so total EPS never drops by more than a
+// batch while new configuration is rolled out
+type RollingRestarter struct {
+	mutex  sync.Mutex
+	config RollingRestartConfig
+	latest *RollingRestartResult
+}
+
+var RollingRestart = &RollingRestarter{config: defaultRollingRestartConfig()}
+
+func defaultRollingRestartConfig() RollingRestartConfig {
+	return RollingRestartConfig{
+		BatchSize:              1,
+		HealthTimeoutSeconds:   120,
+		PollSeconds:            5,
+		MaxConsecutiveFailures: 2,
+		MinEPS:                 1,
+	}
+}
+
+// LoadConfig reads the rolling_restart section from the application config file
+func (rr *RollingRestarter) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultRollingRestartConfig()
+	fileConfig := struct {
+		RollingRestart *RollingRestartConfig `yaml:"rolling_restart"`
+	}{RollingRestart: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.BatchSize <= 0 || config.HealthTimeoutSeconds <= 0 || config.PollSeconds <= 0 || config.MaxConsecutiveFailures <= 0 {
+		return fmt.Errorf("rolling_restart.batch_size, health_timeout_seconds, poll_seconds and max_consecutive_failures must be positive")
+	}
+	if config.MinEPS < 0 {
+		return fmt.Errorf("rolling_restart.min_eps must not be negative")
+	}
+
+	rr.mutex.Lock()
+	rr.config = config
+	rr.mutex.Unlock()
+	return nil
+}
+
+// Config returns the rolling restart settings
+func (rr *RollingRestarter) Config() RollingRestartConfig {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	return rr.config
+}
+
+// Latest returns the running or last finished rolling restart, or nil if none ran yet
+func (rr *RollingRestarter) Latest() *RollingRestartResult {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	if rr.latest == nil {
+		return nil
+	}
+	result := *rr.latest
+	result.Nodes = append([]RollingRestartNode(nil), rr.latest.Nodes...)
+	return &result
+}
+
+// Start plans the batches and restarts them in the background. Nodes are taken in
+// name order.
+func (rr *RollingRestarter) Start(req RollingRestartRequest, triggeredBy string) (*RollingRestartResult, error) {
+	rr.mutex.Lock()
+	if rr.latest != nil && rr.latest.Status == RollingRestartRunning {
+		rr.mutex.Unlock()
+		return nil, fmt.Errorf("a rolling restart is already running")
+	}
+	config := rr.config
+	if req.BatchSize > 0 {
+		config.BatchSize = req.BatchSize
+	}
+	if req.MaxConsecutiveFailures > 0 {
+		config.MaxConsecutiveFailures = req.MaxConsecutiveFailures
+	}
+	result := &RollingRestartResult{
+		Status:                 RollingRestartRunning,
+		BatchSize:              config.BatchSize,
+		MaxConsecutiveFailures: config.MaxConsecutiveFailures,
+		Nodes:                  make([]RollingRestartNode, 0, len(req.Nodes)),
+		TriggeredBy:            triggeredBy,
+		RunID:                  AppState.Simulation().RunID,
+		StartedAt:              timeutil.Now(),
+	}
+	for i, node := range req.Nodes {
+		result.Nodes = append(result.Nodes, RollingRestartNode{Node: node, Batch: i/config.BatchSize + 1, Status: RestartNodePending})
+	}
+	rr.latest = result
+	rr.mutex.Unlock()
+
+	go rr.run(config, req.Timeout)
+	return rr.Latest(), nil
+}
+
+// update changes the latest result under the lock
+func (rr *RollingRestarter) update(change func(*RollingRestartResult)) {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	change(rr.latest)
+}
+
+// run restarts one batch at a time. Nodes of a batch restart in parallel; a healthy node
+// resets the consecutive failure count, and once it reaches the limit the remaining
+// nodes are cancelled.
+func (rr *RollingRestarter) run(config RollingRestartConfig, timeout int) {
+	latest := rr.Latest()
+	batches := 0
+	if len(latest.Nodes) > 0 {
+		batches = latest.Nodes[len(latest.Nodes)-1].Batch
+	}
+
+	aborted := false
+	for batch := 1; batch <= batches && !aborted; batch++ {
+		var wg sync.WaitGroup
+		for i, node := range latest.Nodes {
+			if node.Batch != batch {
+				continue
+			}
+			wg.Add(1)
+			rr.update(func(r *RollingRestartResult) { r.Nodes[i].Status = RestartNodeRunning })
+			go func(index int, name string) {
+				defer wg.Done()
+				outcome := restartNodeGated(name, config, timeout)
+				outcome.Batch = batch
+				rr.update(func(r *RollingRestartResult) { r.Nodes[index] = outcome })
+			}(i, node.Node)
+		}
+		wg.Wait()
+
+		// Count failures in node order so the result does not depend on finishing order
+		rr.update(func(r *RollingRestartResult) {
+			for _, node := range r.Nodes {
+				if node.Batch != batch {
+					continue
+				}
+				switch node.Status {
+				case RestartNodeHealthy:
+					r.ConsecutiveFailures = 0
+				case RestartNodeFailed:
+					r.ConsecutiveFailures++
+				}
+			}
+			aborted = r.ConsecutiveFailures >= r.MaxConsecutiveFailures
+		})
+	}
+
+	var result RollingRestartResult
+	rr.update(func(r *RollingRestartResult) {
+		healthy, failed, skipped := 0, 0, 0
+		for i := range r.Nodes {
+			switch r.Nodes[i].Status {
+			case RestartNodePending:
+				r.Nodes[i].Status = RestartNodeCancelled
+			case RestartNodeHealthy:
+				healthy++
+			case RestartNodeFailed:
+				failed++
+			case RestartNodeSkipped:
+				skipped++
+			}
+		}
+		r.Status = RollingRestartCompleted
+		r.Message = fmt.Sprintf("Restarted %d nodes healthy, %d failed, %d not running", healthy, failed, skipped)
+		if aborted {
+			r.Status = RollingRestartAborted
+			r.Message = fmt.Sprintf("Aborted after %d consecutive failures: %s", r.ConsecutiveFailures, r.Message)
+		}
+		now := timeutil.Now()
+		r.EndedAt = &now
+		result = *r
+		result.Nodes = append([]RollingRestartNode(nil), r.Nodes...)
+	})
+
+	if result.Status == RollingRestartAborted {
+		logger.LogWarning("System", "Binary", "Rolling restart "+result.Message)
+	} else {
+		logger.LogSuccess("System", "Binary", "Rolling restart finished: "+result.Message)
+	}
+	if result.RunID != "" {
+		if err := RunStore.AddTimelineEvent(result.RunID, "rolling_restart", "Rolling restart "+result.Status+": "+result.Message, map[string]interface{}{
+			"batchSize": result.BatchSize,
+			"nodes":     result.Nodes,
+		}); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record rolling restart for run %s: %v", result.RunID, err))
+		}
+	}
+}
+
+// restartNodeGated restarts the binary of a node where it runs and waits until the node
+// reports production again: a dashboard update newer than the restart with at least
+// min_eps EPS
+func restartNodeGated(name string, config RollingRestartConfig, timeout int) RollingRestartNode {
+	outcome := RollingRestartNode{Node: name, Status: RestartNodeFailed}
+	if metrics, ok := AppState.Node(name); ok {
+		outcome.EPSBefore = metrics.EPS
+	}
+
+	status, err := BinaryControl.GetBinaryStatus(name)
+	if err != nil {
+		outcome.Message = fmt.Sprintf("Failed to get binary status: %v", err)
+		return outcome
+	}
+	if status.Status != "running" {
+		outcome.Status = RestartNodeSkipped
+		outcome.Message = "Binary not running, left stopped"
+		return outcome
+	}
+
+	restartedAt := time.Now()
+	started := timeutil.Now()
+	outcome.StartedAt = &started
+	if response, err := BinaryControl.StopBinary(name, 30); err != nil || !response.Success {
+		outcome.Message = "Stop failed: " + binaryFailure(response, err)
+		return outcome
+	}
+	if response, err := BinaryControl.StartBinary(name, timeout); err != nil || !response.Success {
+		outcome.Message = "Start failed: " + binaryFailure(response, err)
+		return outcome
+	}
+
+	var eps int
+	waited, err := pollSmokeTest(config.HealthTimeoutSeconds, config.PollSeconds, func() (bool, error) {
+		metrics, ok := AppState.Node(name)
+		if !ok || !metrics.LastUpdate.After(restartedAt) {
+			return false, fmt.Errorf("no metrics reported since the restart")
+		}
+		eps = metrics.EPS
+		if eps < config.MinEPS {
+			return false, fmt.Errorf("reporting %d EPS, below min_eps %d", eps, config.MinEPS)
+		}
+		return true, nil
+	})
+	outcome.EPSAfter = eps
+	if err != nil {
+		outcome.Message = fmt.Sprintf("Not producing after the restart: %v", err)
+		return outcome
+	}
+	outcome.Status = RestartNodeHealthy
+	outcome.HealthyAfterS = time.Since(restartedAt).Round(time.Second).Seconds()
+	outcome.Message = fmt.Sprintf("Producing %d EPS again after %v", eps, waited)
+	return outcome
+}
+
+// HandleAPIStartRollingRestart Handles POST /api/binary/rolling-restart
+// Restarts the binary on the enabled nodes where it runs, batchSize nodes at a time,
+// and waits for each batch to produce again before the next. Optional query: nodes
+// (comma-separated), batchSize and maxFailures to override rolling_restart, and timeout
+// in minutes after which the restarted binaries stop (default 0, never). Returns 202;
+// poll GET /api/binary/rolling-restart for the progress.
+func HandleAPIStartRollingRestart(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := RollingRestartRequest{}
+	for name, target := range map[string]*int{"batchSize": &req.BatchSize, "maxFailures": &req.MaxConsecutiveFailures, "timeout": &req.Timeout} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || (name != "timeout" && parsed == 0) {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be a positive number (timeout may be 0)", name),
+			})
+			return
+		}
+		*target = parsed
+	}
+
+	nodes, ok := selectFleetNodes(w, query.Get("nodes"), "restart")
+	if !ok {
+		return
+	}
+	req.Nodes = nodes
+
+	result, err := RollingRestart.Start(req, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Rolling restart not started: %v", err),
+			Data:    RollingRestart.Latest(),
+		})
+		return
+	}
+	logger.LogWithNode("System", "Binary", fmt.Sprintf("Rolling restart of %d nodes, %d at a time, started by %s", len(nodes), result.BatchSize, result.TriggeredBy), "info")
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Restarting %d nodes, %d at a time", len(nodes), result.BatchSize),
+		Data:    result,
+	})
+}
+
+// HandleAPIGetRollingRestart Handles GET /api/binary/rolling-restart
+func HandleAPIGetRollingRestart(w http.ResponseWriter, r *http.Request) {
+	result := RollingRestart.Latest()
+	if result == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "No rolling restart has run yet",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Rolling restart %s", result.Status),
+		Data:    result,
+	})
+}
+
+// binaryFailure describes why a binary control call failed
+func binaryFailure(response *bin_control.BinaryControlResponse, err error) string {
+	if response != nil && response.Message != "" {
+		return response.Message
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "unknown error"
+}
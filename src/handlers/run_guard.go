@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+)
+
+// ActiveRunConflict is returned with 409 when a change would break the active run
+type ActiveRunConflict struct {
+	RunID     string    `json:"runId"`
+	Profile   string    `json:"profile"`
+	StartedAt time.Time `json:"startedAt"`
+	Change    string    `json:"change"` // e.g. "disable source apache"
+	Impact    string    `json:"impact"` // what happens to the run if the change is forced
+}
+
+// guardActiveRun lets change go ahead when no simulation is running. During a run it
+// rejects the request with 409 naming the run, unless force is set; a forced change is
+// logged and recorded on the run's timeline with its impact. It returns false when the
+// response has been written and the caller must stop.
+func guardActiveRun(w http.ResponseWriter, r *http.Request, change, impact string, force bool) bool {
+	sim := AppState.Simulation()
+	if !sim.Running {
+		return true
+	}
+	conflict := ActiveRunConflict{RunID: sim.RunID, Profile: sim.Profile, StartedAt: sim.StartTime, Change: change, Impact: impact}
+	run := "The simulation"
+	if sim.RunID != "" {
+		run = fmt.Sprintf("Simulation run %s", sim.RunID)
+	}
+
+	if !force {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s (profile %s) is active and would break: %s. Stop the run first, or repeat with force to %s anyway",
+				run, sim.Profile, impact, change),
+			Data: conflict,
+		})
+		return false
+	}
+
+	by := auth.Describe(r.Context())
+	message := fmt.Sprintf("Forced %s during the run by %s: %s", change, by, impact)
+	logger.LogWarning("System", "Runs", fmt.Sprintf("%s: %s", run, message))
+	if sim.RunID != "" {
+		data := map[string]interface{}{"change": change, "impact": impact, "by": by}
+		if err := RunStore.AddTimelineEvent(sim.RunID, "forced_change", message, data); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record forced change on run %s: %v", sim.RunID, err))
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// transfersArtifact holds the transfers finished during a run, one JSON record per line
+const transfersArtifact = "network_transfers.ndjson"
+
+// Node sample metrics with the agent's interface counters
+const (
+	metricNetRxBytes = "net_rx_bytes"
+	metricNetTxBytes = "net_tx_bytes"
+)
+
+// TransferRecord is one finished transfer of a distribution job to a node
+type TransferRecord struct {
+	Time    time.Time `json:"time"`
+	Node    string    `json:"node"`
+	JobID   string    `json:"jobId"`
+	JobType string    `json:"jobType"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// RunNodeNetwork is the network usage of one node during a run
+type RunNodeNetwork struct {
+	Node          string  `json:"node"`
+	TransferBytes int64   `json:"transferBytes"` // sent to the node by distribution jobs
+	Transfers     int     `json:"transfers"`
+	RxBytes       uint64  `json:"rxBytes"` // from the agent's interface counters
+	TxBytes       uint64  `json:"txBytes"`
+	PeakRxMbps    float64 `json:"peakRxMbps"` // highest rate between two samples
+	PeakTxMbps    float64 `json:"peakTxMbps"`
+	Samples       int     `json:"samples"`
+}
+
+// RunNetwork is the network usage of a run per node
+type RunNetwork struct {
+	RunID              string           `json:"runId"`
+	TotalTransferBytes int64            `json:"totalTransferBytes"`
+	TotalRxBytes       uint64           `json:"totalRxBytes"`
+	TotalTxBytes       uint64           `json:"totalTxBytes"`
+	TransferBytesByJob map[string]int64 `json:"transferBytesByJobType"`
+	Nodes              []RunNodeNetwork `json:"nodes"`
+	Transfers          []TransferRecord `json:"transfers"`
+}
+
+// RecordRunTransfer adds a finished transfer task to the active run, so the traffic of
+// distributions can be told apart from the traffic of the simulators. It is the task
+// hook of TransferScheduler.
+func RecordRunTransfer(jobID, jobType string, task jobs.TaskStatus) {
+	if task.Status != jobs.StatusCompleted || task.Bytes <= 0 {
+		return
+	}
+	sim := AppState.Simulation()
+	if !sim.Running || sim.RunID == "" {
+		return
+	}
+
+	data, err := json.Marshal(TransferRecord{
+		Time:    timeutil.Now(),
+		Node:    task.Name,
+		JobID:   jobID,
+		JobType: jobType,
+		Bytes:   task.Bytes,
+	})
+	if err != nil {
+		return
+	}
+	if err := RunStore.AppendArtifact(sim.RunID, runs.KindMetrics, transfersArtifact, append(data, '\n')); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record transfer to %s for run %s: %v", task.Name, sim.RunID, err))
+	}
+}
+
+// summarizeRunNetwork aggregates the transfers and the interface counters of the node
+// samples of a run. Counters that went down, e.g. after a node reboot, restart from zero.
+func summarizeRunNetwork(runID string) (*RunNetwork, error) {
+	network := &RunNetwork{
+		RunID:              runID,
+		TransferBytesByJob: make(map[string]int64),
+		Nodes:              []RunNodeNetwork{},
+		Transfers:          []TransferRecord{},
+	}
+	nodes := make(map[string]*RunNodeNetwork)
+	node := func(name string) *RunNodeNetwork {
+		if nodes[name] == nil {
+			nodes[name] = &RunNodeNetwork{Node: name}
+		}
+		return nodes[name]
+	}
+
+	err := readRunArtifactLines(runID, transfersArtifact, func(line []byte) {
+		var record TransferRecord
+		if json.Unmarshal(line, &record) != nil {
+			return
+		}
+		network.Transfers = append(network.Transfers, record)
+		network.TransferBytesByJob[record.JobType] += record.Bytes
+		network.TotalTransferBytes += record.Bytes
+		entry := node(record.Node)
+		entry.TransferBytes += record.Bytes
+		entry.Transfers++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type counters struct {
+		time   time.Time
+		rx, tx float64
+	}
+	previous := make(map[string]counters)
+	err = readRunArtifactLines(runID, nodeSamplesArtifact, func(line []byte) {
+		var sample NodeSample
+		if json.Unmarshal(line, &sample) != nil {
+			return
+		}
+		rx, hasRx := sample.Metrics[metricNetRxBytes]
+		tx, hasTx := sample.Metrics[metricNetTxBytes]
+		if !hasRx || !hasTx {
+			return
+		}
+		entry := node(sample.Node)
+		entry.Samples++
+		current := counters{time: sample.Time, rx: rx, tx: tx}
+		last, ok := previous[sample.Node]
+		previous[sample.Node] = current
+		if !ok {
+			return
+		}
+		rxDelta, txDelta := counterDelta(last.rx, rx), counterDelta(last.tx, tx)
+		entry.RxBytes += uint64(rxDelta)
+		entry.TxBytes += uint64(txDelta)
+		if seconds := sample.Time.Sub(last.time).Seconds(); seconds > 0 {
+			entry.PeakRxMbps = maxFloat(entry.PeakRxMbps, rxDelta*8/seconds/1e6)
+			entry.PeakTxMbps = maxFloat(entry.PeakTxMbps, txDelta*8/seconds/1e6)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range nodes {
+		network.TotalRxBytes += entry.RxBytes
+		network.TotalTxBytes += entry.TxBytes
+		network.Nodes = append(network.Nodes, *entry)
+	}
+	sort.Slice(network.Nodes, func(i, j int) bool { return network.Nodes[i].Node < network.Nodes[j].Node })
+	return network, nil
+}
+
+// readRunArtifactLines calls fn for every line of a metrics artifact of a run; a run
+// without the artifact has no lines
+func readRunArtifactLines(runID, name string, fn func(line []byte)) error {
+	file, err := RunStore.OpenArtifact(runID, runs.KindMetrics, name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return nil
+}
+
+func counterDelta(previous, current float64) float64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+func maxFloat(a, b float64) float64 {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// HandleAPIGetRunNetwork Handles GET /api/runs/{id}/network
+// Returns the bytes distribution jobs sent to each node during the run and the traffic
+// the node's agent counted on its interfaces. Supports ?format=csv|ndjson, with
+// ?table=nodes or ?table=transfers to export one of them.
+func HandleAPIGetRunNetwork(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+
+	network, err := summarizeRunNetwork(runID)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    network,
+	}, runID+"-network")
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+	"vuDataSim/src/runs"
+
+	"github.com/gorilla/mux"
+)
+
+// runTopicSuffix matches the run ID a temporary topic ends with
+var runTopicSuffix = regexp.MustCompile(`-run-\d{8}-\d{6}-[0-9a-f]{4}$`)
+
+// RunTopicManager gives a run its own Kafka topics, so parallel experiments on the same
+// cluster do not count each other's messages
+type RunTopicManager struct {
+	mutex sync.Mutex // one setup or teardown rewrites the sources' conf.yml at a time
+}
+
+var RunTopics = &RunTopicManager{}
+
+// temporaryTopicName is the topic a source writes to during a run, e.g.
+// linux-input-run-20250101-120000-ab12
+func temporaryTopicName(original, runID string) string {
+	return original + "-" + runID
+}
+
+// Setup creates a temporary topic for every enabled source that writes to a Kafka topic,
+// with the partitions and replication factor of the source's own topic, points the
+// sources' conf.yml at them and pushes it to the enabled nodes. Sources without a topic
+// are skipped with a warning. The topics are recorded on the run for Teardown. On
+// failure everything done so far is undone.
+func (rt *RunTopicManager) Setup(runID string) ([]runs.TemporaryTopic, []string, error) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	if topicMapping == nil {
+		return nil, nil, fmt.Errorf("Kafka manager not available")
+	}
+	// A run stopped before now has been torn down already and would leak the topics
+	if run, ok := RunStore.GetRun(runID); !ok || run.Status != runs.StatusRunning {
+		return nil, nil, fmt.Errorf("run %s is not running", runID)
+	}
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, nil, fmt.Errorf("failed to load main config: %v", err)
+	}
+	sources := O11yManager.GetEnabledSources()
+	sort.Strings(sources)
+
+	var topics []runs.TemporaryTopic
+	var warnings []string
+	for _, source := range sources {
+		output, err := O11yManager.GetSourceKafkaOutput(source)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("source %s: %v", source, err)
+		}
+		if !output.Enabled || output.Topic == "" {
+			warnings = append(warnings, fmt.Sprintf("%s has no Kafka topic of its own and keeps its output", source))
+			continue
+		}
+		if runTopicSuffix.MatchString(output.Topic) {
+			return nil, warnings, fmt.Errorf("source %s still writes to %s, a temporary topic of an earlier run; tear that run's topics down first", source, output.Topic)
+		}
+		topic := temporaryTopicName(output.Topic, runID)
+		if len(topic) > 249 {
+			return nil, warnings, fmt.Errorf("temporary topic of %s would be longer than 249 characters", source)
+		}
+		topics = append(topics, runs.TemporaryTopic{Source: source, Original: output.Topic, Topic: topic})
+	}
+	if len(topics) == 0 {
+		return nil, warnings, fmt.Errorf("no enabled source writes to a Kafka topic")
+	}
+
+	var created []runs.TemporaryTopic
+	var relPaths []string
+	fail := func(err error) ([]runs.TemporaryTopic, []string, error) {
+		rt.restore(created)
+		return nil, warnings, err
+	}
+	for _, topic := range topics {
+		partitions, replication := 1, 1
+		if metadata, err := topicMapping.DescribeTopic(topic.Original); err == nil {
+			partitions, replication = metadata.PartitionCount, metadata.ReplicationFactor
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s: %v, creating %s with 1 partition and replication factor 1", topic.Source, err, topic.Topic))
+		}
+		if err := topicMapping.CreateTopic(topic.Topic, partitions, replication); err != nil {
+			return fail(err)
+		}
+		// Restored until the source's conf.yml points at the topic
+		created = append(created, runs.TemporaryTopic{Source: topic.Source, Original: topic.Original, Topic: topic.Topic, Restored: true})
+
+		name := topic.Topic
+		if _, err := O11yManager.UpdateSourceKafkaOutput(topic.Source, o11y_source_manager.KafkaOutputUpdate{Topic: &name}); err != nil {
+			return fail(fmt.Errorf("failed to point %s at %s: %v", topic.Source, name, err))
+		}
+		created[len(created)-1].Restored = false
+		relPaths = append(relPaths, filepath.Join(topic.Source, "conf.yml"))
+	}
+
+	results, err := O11yManager.PushConfDFiles(relPaths)
+	if err != nil {
+		return fail(fmt.Errorf("failed to push conf.d: %v", err))
+	}
+	if failed := failedNodes(results); len(failed) > 0 {
+		return fail(fmt.Errorf("conf.d was not pushed to %s", strings.Join(failed, ", ")))
+	}
+	// Recorded before unlocking, so a stop waiting for the lock tears them down
+	if err := RunStore.SetTemporaryTopics(runID, topics); err != nil {
+		return fail(fmt.Errorf("failed to record the topics on the run: %v", err))
+	}
+	return topics, warnings, nil
+}
+
+// restore points the sources back at their own topics, pushes their conf.yml and deletes
+// the temporary topics. Topics already restored or deleted are skipped, so a teardown that
+// failed half way can be repeated. Each topic's Error holds why it did not finish.
+func (rt *RunTopicManager) restore(topics []runs.TemporaryTopic) {
+	var relPaths []string
+	for i := range topics {
+		topic := &topics[i]
+		topic.Error = ""
+		if topic.Restored {
+			continue
+		}
+		output, err := O11yManager.GetSourceKafkaOutput(topic.Source)
+		if err != nil {
+			topic.Error = err.Error()
+			continue
+		}
+		// Someone pointed the source elsewhere during the run; leave their change
+		if output.Topic == topic.Topic {
+			original := topic.Original
+			if _, err := O11yManager.UpdateSourceKafkaOutput(topic.Source, o11y_source_manager.KafkaOutputUpdate{Topic: &original}); err != nil {
+				topic.Error = fmt.Sprintf("failed to restore %s: %v", original, err)
+				continue
+			}
+		}
+		relPaths = append(relPaths, filepath.Join(topic.Source, "conf.yml"))
+	}
+
+	if len(relPaths) > 0 {
+		results, err := O11yManager.PushConfDFiles(relPaths)
+		if err == nil {
+			if failed := failedNodes(results); len(failed) > 0 {
+				err = fmt.Errorf("conf.d was not pushed to %s", strings.Join(failed, ", "))
+			}
+		}
+		for i := range topics {
+			if topics[i].Restored || topics[i].Error != "" {
+				continue
+			}
+			if err != nil {
+				topics[i].Error = err.Error()
+				continue
+			}
+			topics[i].Restored = true
+		}
+	}
+
+	for i := range topics {
+		topic := &topics[i]
+		// A node still writing to the topic would recreate it, so delete only once restored
+		if topic.Deleted || !topic.Restored {
+			continue
+		}
+		if topicMapping == nil {
+			topic.Error = "Kafka manager not available"
+			continue
+		}
+		if err := topicMapping.DeleteTopic(topic.Topic); err != nil {
+			topic.Error = err.Error()
+			continue
+		}
+		topic.Deleted = true
+	}
+}
+
+// Teardown restores the sources of a run to their own topics and deletes its temporary
+// topics, recording the outcome on the run. It returns the topics and whether all were
+// torn down.
+func (rt *RunTopicManager) Teardown(runID string) ([]runs.TemporaryTopic, bool, error) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		return nil, false, fmt.Errorf("run %s not found", runID)
+	}
+	topics := run.TemporaryTopics
+	if len(topics) == 0 {
+		return topics, true, nil
+	}
+	rt.restore(topics)
+	if err := RunStore.SetTemporaryTopics(runID, topics); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record temporary topics of run %s: %v", runID, err))
+	}
+
+	var names, problems []string
+	for _, topic := range topics {
+		names = append(names, topic.Topic)
+		if topic.Error != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", topic.Topic, topic.Error))
+		}
+	}
+	if len(problems) > 0 {
+		message := fmt.Sprintf("Temporary topics not torn down: %s", strings.Join(problems, "; "))
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Run %s: %s", runID, message))
+		RunStore.AddTimelineEvent(runID, "temporary_topics_failed", message, nil)
+		return topics, false, nil
+	}
+	RunStore.AddTimelineEvent(runID, "temporary_topics_removed", fmt.Sprintf("Sources restored to their topics, deleted %s", strings.Join(names, ", ")), nil)
+	logger.LogWithNode("System", "Runs", fmt.Sprintf("Run %s: deleted temporary topics %s", runID, strings.Join(names, ", ")), "info")
+	return topics, true, nil
+}
+
+// failedNodes returns the nodes a conf.d push did not reach, sorted
+func failedNodes(results map[string]o11y_source_manager.ConfDNodeResult) []string {
+	var failed []string
+	for nodeName, result := range results {
+		if !result.Success {
+			failed = append(failed, nodeName)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// HandleAPITeardownRunTopics Handles POST /api/runs/{id}/temporary-topics/teardown
+// Repeats the teardown of a finished run's temporary topics, e.g. after a node was
+// unreachable when the run stopped
+func HandleAPITeardownRunTopics(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	if run.Status == runs.StatusRunning {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Run %s is still running; its topics are torn down when it stops", runID),
+		})
+		return
+	}
+
+	topics, done, err := RunTopics.Teardown(runID)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !done {
+		SendJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Message: "Some temporary topics were not torn down",
+			Data:    topics,
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d temporary topics of run %s torn down", len(topics), runID),
+		Data:    topics,
+	})
+}
@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+)
+
+// Files snapshotted into the configs artifacts of every run
+var runConfigArtifacts = []string{
+	"src/migrate/conf.d",
+	"src/configs/nodes.yaml",
+	"src/configs/max_eps.yaml",
+	"src/configs/topics_tables.yaml",
+	"src/configs/k6_config.json",
+}
+
+// collectRunStartArtifacts snapshots the generated configs a run starts with
+func collectRunStartArtifacts(run *runs.Run) {
+	for _, path := range runConfigArtifacts {
+		if err := RunStore.CopyArtifact(run.ID, runs.KindConfigs, path); err != nil && !os.IsNotExist(err) {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to collect %s for run %s: %v", path, run.ID, err))
+		}
+	}
+}
+
+// captureRunConfiguration records the name of a run and the EPS distribution, nodes and
+// k6 settings it starts with
+func captureRunConfiguration(runID, name string) {
+	configuration := runs.Configuration{
+		SourceEPS:  make(map[string]int),
+		Nodes:      []string{},
+		CapturedAt: timeutil.Now(),
+	}
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to read the EPS distribution of run %s: %v", runID, err))
+	}
+	for source, info := range O11yManager.GetSourceEPSBreakdown() {
+		configuration.SourceEPS[source] = info.AssignedEPS
+		configuration.NodeEPS += info.AssignedEPS
+	}
+	for node := range BinaryControl.GetEnabledNodes() {
+		configuration.Nodes = append(configuration.Nodes, node)
+	}
+	sort.Strings(configuration.Nodes)
+	configuration.ClusterEPS = configuration.NodeEPS * len(configuration.Nodes)
+
+	K6Manager.mutex.RLock()
+	k6, err := json.Marshal(K6Manager.config)
+	K6Manager.mutex.RUnlock()
+	if err == nil {
+		configuration.K6 = k6
+	}
+	if err := RunStore.SetConfiguration(runID, name, configuration); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record the configuration of run %s: %v", runID, err))
+	}
+}
+
+// collectRunEndArtifacts stores k6 summaries, log excerpts and the report of a finished run
+func collectRunEndArtifacts(run *runs.Run) {
+	end := time.Now().UTC()
+	if run.EndedAt != nil {
+		end = *run.EndedAt
+	}
+
+	K6Manager.mutex.RLock()
+	k6Summary := map[string]interface{}{
+		"config": K6Manager.config,
+		"status": K6Manager.status,
+	}
+	K6Manager.mutex.RUnlock()
+	writeJSONArtifact(run.ID, runs.KindK6, "summary.json", k6Summary)
+	if err := RunStore.CopyArtifact(run.ID, runs.KindK6, "/tmp/k6_dynamic_script.sh"); err != nil && !os.IsNotExist(err) {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to collect k6 script for run %s: %v", run.ID, err))
+	}
+
+	if excerpt := readLogExcerpt(run.StartedAt, end); len(excerpt) > 0 {
+		if err := RunStore.WriteArtifact(run.ID, runs.KindLogs, "vuDataSim.log", excerpt); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to write log excerpt for run %s: %v", run.ID, err))
+		}
+	}
+
+	report := map[string]interface{}{
+		"run":         run,
+		"generatedAt": time.Now().UTC(),
+	}
+	GenerationErrors.Finish(run.ID)
+	if generationErrors, err := summarizeGenerationErrors(run.ID, GenerationErrors.Config().MaxExamples); err == nil && len(generationErrors.Sources) > 0 {
+		report["generationErrors"] = generationErrors
+	}
+	if metrics, err := clickhouse.CollectClickHouseMetrics(clickhouse.TimeRange{From: run.StartedAt, To: end}); err == nil {
+		report["clickhouse"] = metrics
+		if summary := summarizeRunMetrics(run, metrics); len(summary) > 0 {
+			report["summary"] = summary
+			if comparison := recordRunSummary(run, summary); comparison != nil {
+				report["comparison"] = comparison
+			}
+		}
+	} else {
+		report["clickhouseError"] = err.Error()
+	}
+	writeJSONArtifact(run.ID, runs.KindReports, "report.json", report)
+	uploadRunArtifacts(run)
+
+	if removed, err := RunStore.ApplyRetention(); err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Artifact retention failed: %v", err))
+	} else if len(removed) > 0 {
+		logger.LogWithNode("System", "Runs", fmt.Sprintf("Removed artifacts of %d expired runs", len(removed)), "info")
+	}
+}
+
+func writeJSONArtifact(runID, kind, name string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err == nil {
+		err = RunStore.WriteArtifact(runID, kind, name, data)
+	}
+	if err != nil {
+		logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to write %s/%s for run %s: %v", kind, name, runID, err))
+	}
+}
+
+// readLogExcerpt returns the raw manager log lines written between start and end
+func readLogExcerpt(start, end time.Time) []byte {
+	file, err := os.Open("logs/vuDataSim.log")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var excerpt bytes.Buffer
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry struct {
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(start.Add(-time.Second)) || entry.Time.After(end.Add(time.Second)) {
+			continue
+		}
+		excerpt.Write(line)
+		excerpt.WriteByte('\n')
+	}
+	return excerpt.Bytes()
+}
+
+// RunHistoryEntry is a run in the run history with how long it ran
+type RunHistoryEntry struct {
+	*runs.Run
+	DurationSeconds float64 `json:"durationSeconds"` // so far for a running run
+}
+
+// RunDetail is a run with its timeline, configuration and artifacts
+type RunDetail struct {
+	RunHistoryEntry
+	Artifacts []runs.Artifact `json:"artifacts"`
+}
+
+func runHistoryEntry(run *runs.Run) RunHistoryEntry {
+	end := timeutil.Now()
+	if run.EndedAt != nil {
+		end = *run.EndedAt
+	}
+	return RunHistoryEntry{Run: run, DurationSeconds: end.Sub(run.StartedAt).Seconds()}
+}
+
+// HandleAPICreateRun Handles POST /api/runs
+// Starts a named run. Takes the body of POST /api/simulation/start with a required
+// "name"; the profile defaults to the name. Returns 201 with the run, including the EPS
+// distribution, nodes and k6 settings it started with.
+func HandleAPICreateRun(w http.ResponseWriter, r *http.Request) {
+	var config SimulationConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	config.Name = strings.TrimSpace(config.Name)
+	if config.Name == "" {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "name is required",
+		})
+		return
+	}
+	if config.Profile == "" {
+		config.Profile = config.Name
+	}
+
+	runID, message, ok := startSimulation(w, r, config)
+	if !ok {
+		return
+	}
+	run, found := RunStore.GetRun(runID)
+	if runID == "" || !found {
+		// A run that is not recorded cannot be found in the history later
+		AppState.UpdateSimulation(func(sim *SimulationState) {
+			if sim.Running && sim.RunID == runID {
+				stopSimulation(sim, runs.StatusFailed)
+			}
+		})
+		go AppState.BroadcastUpdate()
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "The run could not be recorded and was stopped",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Run %s (%s) started: %s", run.ID, run.Name, message),
+		Data:    runHistoryEntry(run),
+	})
+}
+
+// HandleAPIListRuns Handles GET /api/runs
+// Lists past and running runs newest first, without their timelines. Optional query:
+// status, profile, scenario, since and until (RFC3339, on the start time) and limit
+// (default 100).
+func HandleAPIListRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := runs.ListFilter{
+		Status:   query.Get("status"),
+		Profile:  query.Get("profile"),
+		Scenario: query.Get("scenario"),
+		Limit:    100,
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Invalid %s time format: %v", name, err),
+				})
+				return
+			}
+			*target = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "limit must be a positive number",
+			})
+			return
+		}
+		filter.Limit = parsed
+	}
+
+	list, total := RunStore.List(filter)
+	entries := make([]RunHistoryEntry, 0, len(list))
+	for _, run := range list {
+		entries = append(entries, runHistoryEntry(run))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d of %d runs", len(entries), total),
+		Data:    entries,
+	})
+}
+
+// HandleAPIGetRun Handles GET /api/runs/{id}
+// Returns a run with its timeline, summary metrics, regression verdict, configuration
+// and artifacts
+func HandleAPIGetRun(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Run %s not found", runID),
+		})
+		return
+	}
+
+	artifacts, err := RunStore.ListArtifacts(runID)
+	if err != nil {
+		artifacts = []runs.Artifact{} // none collected yet, or removed by retention
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Run %s is %s", run.ID, run.Status),
+		Data:    RunDetail{RunHistoryEntry: runHistoryEntry(run), Artifacts: artifacts},
+	})
+}
+
+// HandleAPIGetRunArtifacts Handles GET /api/runs/{id}/artifacts
+func HandleAPIGetRunArtifacts(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+
+	artifacts, err := RunStore.ListArtifacts(runID)
+	if err != nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Found %d artifacts for run %s", len(artifacts), runID),
+		Data: map[string]interface{}{
+			"runId":       runID,
+			"artifacts":   artifacts,
+			"downloadUrl": fmt.Sprintf("/api/v1/runs/%s/artifacts.zip", runID),
+		},
+	}, fmt.Sprintf("run_%s_artifacts", runID))
+}
+
+// HandleAPIDownloadRunArtifacts Handles GET /api/runs/{id}/artifacts.zip
+func HandleAPIDownloadRunArtifacts(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	if _, ok := RunStore.GetRun(runID); !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+
+	// Build the archive in memory so errors can still be reported as JSON
+	var buf bytes.Buffer
+	if err := RunStore.WriteZip(runID, &buf); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to build artifact bundle: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set(ContentTypeHeader, "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-artifacts.zip"))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// RunReportEvent is a timeline event rendered for a report
+type RunReportEvent struct {
+	Time    string                 `json:"time"`
+	Type    string                 `json:"type"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// RunReport is a run summary with timestamps rendered in the requested time zone
+type RunReport struct {
+	RunID            string               `json:"runId"`
+	Status           string               `json:"status"`
+	Profile          string               `json:"profile"`
+	Scenario         string               `json:"scenario"`
+	TargetEPS        int                  `json:"targetEps"`
+	TargetKafka      int                  `json:"targetKafka"`
+	TargetClickHouse int                  `json:"targetClickHouse"`
+	TimeZone         string               `json:"timeZone"`
+	StartedAt        string               `json:"startedAt"`
+	EndedAt          string               `json:"endedAt,omitempty"`
+	Duration         string               `json:"duration"`
+	Timeline         []RunReportEvent     `json:"timeline"`
+	Targets          []RunTarget          `json:"targets"`
+	Summary          map[string]float64   `json:"summary,omitempty"`
+	Comparison       *runs.Comparison     `json:"comparison,omitempty"`       // regression verdict against the scenario baseline
+	GenerationErrors *RunGenerationErrors `json:"generationErrors,omitempty"` // errors the simulators logged per source
+	GeneratedAt      string               `json:"generatedAt"`
+}
+
+// RunTarget compares a target rate of a run with the rate observed at its end
+type RunTarget struct {
+	Name          string   `json:"name"` // eps, kafka or clickhouse
+	Unit          string   `json:"unit"`
+	Target        int      `json:"target"`
+	Observed      *float64 `json:"observed,omitempty"`
+	AttainmentPct *float64 `json:"attainmentPct,omitempty"`
+}
+
+// runTargets lists the targets set for a run with the observed rates from its summary
+func runTargets(run *runs.Run) []RunTarget {
+	candidates := []struct {
+		name, unit                   string
+		target                       int
+		observedMetric, attainMetric string
+	}{
+		{"eps", "events/s", run.TargetEPS, runs.MetricIngestEPS, runs.MetricTargetAttainment},
+		{"kafka", "msg/s", run.TargetKafka, runs.MetricIngestEPS, runs.MetricKafkaAttainment},
+		{"clickhouse", "rows/s", run.TargetClickHouse, runs.MetricClickHouseRowsPerSec, runs.MetricClickHouseAttainment},
+	}
+
+	targets := make([]RunTarget, 0, len(candidates))
+	for _, c := range candidates {
+		if c.target <= 0 {
+			continue
+		}
+		target := RunTarget{Name: c.name, Unit: c.unit, Target: c.target}
+		if value, ok := run.Summary[c.observedMetric]; ok {
+			target.Observed = &value
+		}
+		if value, ok := run.Summary[c.attainMetric]; ok {
+			target.AttainmentPct = &value
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// HandleAPIGetRunReport Handles GET /api/runs/{id}/report?tz=Asia/Kolkata
+func HandleAPIGetRunReport(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	loc, err := timeutil.ParseLocation(r.URL.Query().Get(timeutil.QueryParam))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+
+	end := timeutil.Now()
+	report := RunReport{
+		RunID:            run.ID,
+		Status:           run.Status,
+		Profile:          run.Profile,
+		Scenario:         run.ScenarioName(),
+		TargetEPS:        run.TargetEPS,
+		TargetKafka:      run.TargetKafka,
+		TargetClickHouse: run.TargetClickHouse,
+		Targets:          runTargets(run),
+		Summary:          run.Summary,
+		Comparison:       run.Comparison,
+		TimeZone:         loc.String(),
+		StartedAt:        timeutil.FormatIn(run.StartedAt, loc),
+		Timeline:         make([]RunReportEvent, 0, len(run.Timeline)),
+		GeneratedAt:      timeutil.FormatIn(end, loc),
+	}
+	if run.EndedAt != nil {
+		end = *run.EndedAt
+		report.EndedAt = timeutil.FormatIn(end, loc)
+	}
+	report.Duration = end.Sub(run.StartedAt).Round(time.Second).String()
+	if generationErrors, err := summarizeGenerationErrors(run.ID, GenerationErrors.Config().MaxExamples); err == nil && len(generationErrors.Sources) > 0 {
+		report.GenerationErrors = generationErrors
+	}
+	for _, event := range run.Timeline {
+		report.Timeline = append(report.Timeline, RunReportEvent{
+			Time:    timeutil.FormatIn(event.Time, loc),
+			Type:    event.Type,
+			Message: event.Message,
+			Data:    event.Data,
+		})
+	}
+
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    report,
+	}, fmt.Sprintf("run_%s_report", runID))
+}
+
+// HandleAPIGetRunJUnit Handles GET /api/runs/{id}/junit.xml
+// Returns the pass/fail checks of a finished run as JUnit XML, so CI pipelines can show
+// the performance gate as test results: whether the run completed and each metric
+// compared against the scenario baseline with its regression tolerance.
+func HandleAPIGetRunJUnit(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	if !runs.ValidRunID(runID) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid run id",
+		})
+		return
+	}
+	run, ok := RunStore.GetRun(runID)
+	if !ok {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("run %s not found", runID),
+		})
+		return
+	}
+	if run.EndedAt == nil {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Run %s is still %s; JUnit results are available once it finished", runID, run.Status),
+		})
+		return
+	}
+
+	data, err := xml.MarshalIndent(run.JUnit(), "", "  ")
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to render JUnit report: %v", err),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID+"-junit.xml"))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleAPIListSavedQueries Handles GET /api/clickhouse/saved
+func HandleAPIListSavedQueries(w http.ResponseWriter, r *http.Request) {
+	SendDataResponse(w, r, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Saved queries retrieved successfully",
+		Data:    clickhouse.SavedQueries.List(),
+	}, "saved_queries")
+}
+
+// HandleAPIPutSavedQuery Handles PUT /api/clickhouse/saved/{name}
+// Registers or replaces a named read-only query
+func HandleAPIPutSavedQuery(w http.ResponseWriter, r *http.Request) {
+	var query clickhouse.SavedQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+		return
+	}
+	query.Name = mux.Vars(r)["name"]
+
+	created, err := clickhouse.SavedQueries.Put(query, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid saved query: %v", err),
+		})
+		return
+	}
+
+	status, message := http.StatusOK, fmt.Sprintf("Saved query %s updated", query.Name)
+	if created {
+		status, message = http.StatusCreated, fmt.Sprintf("Saved query %s created", query.Name)
+	}
+	saved, _ := clickhouse.SavedQueries.Get(query.Name)
+	SendJSONResponse(w, status, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    saved,
+	})
+}
+
+// HandleAPIDeleteSavedQuery Handles DELETE /api/clickhouse/saved/{name}
+func HandleAPIDeleteSavedQuery(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := clickhouse.SavedQueries.Delete(name, auth.Describe(r.Context())); err != nil {
+		status := http.StatusInternalServerError
+		if _, exists := clickhouse.SavedQueries.Get(name); !exists {
+			status = http.StatusNotFound
+		}
+		SendJSONResponse(w, status, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Saved query %s deleted", name),
+	})
+}
+
+// HandleAPIRunSavedQuery Handles GET /api/clickhouse/saved/{name}?params={...}&format=json|csv|ndjson
+// Parameters can be passed as a JSON object in params or as individual query arguments
+func HandleAPIRunSavedQuery(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, exists := clickhouse.SavedQueries.Get(name); !exists {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Saved query %s not found", name),
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := ResponseFormat(r)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	values := make(map[string]string)
+	if raw := query.Get("params"); raw != "" {
+		var params map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &params); err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "params must be a JSON object",
+			})
+			return
+		}
+		for key, value := range params {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	for key := range query {
+		if key != "params" && key != "format" {
+			values[key] = query.Get(key)
+		}
+	}
+
+	result, err := clickhouse.SavedQueries.Run(r.Context(), name, values)
+	if err != nil {
+		logger.LogWarning("System", "ClickHouse", fmt.Sprintf("Saved query %s run by %s failed: %v", name, auth.Describe(r.Context()), err))
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Saved query %s failed: %v", name, err),
+		})
+		return
+	}
+	logger.LogWithNode("System", "ClickHouse", fmt.Sprintf("Saved query %s run by %s returned %d rows in %dms", name, auth.Describe(r.Context()), result.RowCount, result.ElapsedMs), "info")
+
+	switch format {
+	case FormatCSV:
+		writeQueryResultCSV(w, result)
+		return
+	case FormatNDJSON:
+		writeQueryResultNDJSON(w, result)
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Saved query %s returned %d rows", name, result.RowCount),
+		Data:    result,
+	})
+}
+
+// writeQueryResultCSV streams the result as CSV with a header row
+func writeQueryResultCSV(w http.ResponseWriter, result *clickhouse.QueryResult) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", result.Query+".csv"))
+	if result.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+
+	writer := csv.NewWriter(w)
+	header := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		header[i] = column.Name
+	}
+	writer.Write(header)
+
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for i, value := range row {
+			record[i] = csvValue(value)
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
+
+// writeQueryResultNDJSON streams the result as one JSON object per row
+func writeQueryResultNDJSON(w http.ResponseWriter, result *clickhouse.QueryResult) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", result.Query+".ndjson"))
+	if result.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, row := range result.Rows {
+		record := newJSONObject()
+		for i, value := range row {
+			record.set(result.Columns[i].Name, value)
+		}
+		encoder.Encode(record)
+	}
+}
+
+// csvValue formats a scanned ClickHouse value, rendering NULL as an empty field
+func csvValue(value interface{}) string {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return ""
+	}
+
+	switch typed := v.Interface().(type) {
+	case time.Time:
+		return typed.UTC().Format(time.RFC3339Nano)
+	case []string:
+		return strings.Join(typed, ",")
+	default:
+		return fmt.Sprint(typed)
+	}
+}
@@ -0,0 +1,871 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/cron"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Schedule states
+const (
+	ScheduleScheduled = "scheduled" // waiting for its next run
+	ScheduleRunning   = "running"
+	ScheduleDisabled  = "disabled"
+	ScheduleFinished  = "finished" // a one-off schedule that ran, or a cron that never matches again
+)
+
+// Scheduled run states; a run that started ends like a campaign point
+const (
+	ScheduledRunRunning   = "running"
+	ScheduledRunCompleted = CampaignPointCompleted
+	ScheduledRunFailed    = CampaignPointFailed
+	ScheduledRunCancelled = CampaignPointCancelled // the schedule was deleted during the run
+	ScheduledRunSkipped   = "skipped"              // due during a maintenance window covering scheduled runs
+	ScheduledRunMissed    = "missed"               // another simulation ran for longer than max_delay_minutes
+)
+
+// ScheduleConfig holds the schedules section of config.yaml
+type ScheduleConfig struct {
+	File                string `yaml:"file" json:"file"`
+	PollSeconds         int    `yaml:"poll_seconds" json:"pollSeconds"`                  // how often due schedules are looked for
+	MaxDelayMinutes     int    `yaml:"max_delay_minutes" json:"maxDelayMinutes"`         // how long a due run waits for a running simulation before it is missed
+	BinaryMarginMinutes int    `yaml:"binary_margin_minutes" json:"binaryMarginMinutes"` // binaries stop on their own this long after a run's duration
+	HistoryLimit        int    `yaml:"history_limit" json:"historyLimit"`                // past runs kept per schedule
+}
+
+// ScheduleRequest is the body of POST /api/schedules. A schedule repeats on a cron
+// expression or runs once at startAt.
+type ScheduleRequest struct {
+	Name            string     `json:"name"`
+	Cron            string     `json:"cron,omitempty"`     // five fields or a macro such as @daily
+	Timezone        string     `json:"timezone,omitempty"` // IANA zone the cron expression is read in, default UTC
+	StartAt         *time.Time `json:"startAt,omitempty"`
+	DurationMinutes int        `json:"durationMinutes"`
+	TargetEPS       int        `json:"targetEps"`         // cluster-wide, over the schedule's nodes
+	Sources         []string   `json:"sources,omitempty"` // empty runs with the sources enabled at its start
+	Nodes           []string   `json:"nodes,omitempty"`   // empty runs on every node enabled at its start
+	Profile         string     `json:"profile,omitempty"` // recorded on every run, defaults to the name
+	Scenario        string     `json:"scenario,omitempty"`
+	Workspace       string     `json:"workspace,omitempty"`
+	SkipTableCheck  bool       `json:"skipTableCheck,omitempty"`
+	Enabled         *bool      `json:"enabled,omitempty"` // default true
+}
+
+// ScheduledRun is one occurrence of a schedule
+type ScheduledRun struct {
+	DueAt     time.Time          `json:"dueAt"`
+	StartedAt *time.Time         `json:"startedAt,omitempty"`
+	EndedAt   *time.Time         `json:"endedAt,omitempty"`
+	Status    string             `json:"status"`
+	RunID     string             `json:"runId,omitempty"`
+	Message   string             `json:"message,omitempty"`
+	Summary   map[string]float64 `json:"summary,omitempty"` // the run's summary metrics, once computed
+}
+
+// Schedule starts a simulation run of a fixed duration, EPS, sources and nodes at set
+// times
+type Schedule struct {
+	ID              string         `json:"id"`
+	Name            string         `json:"name"`
+	Cron            string         `json:"cron,omitempty"`
+	Timezone        string         `json:"timezone,omitempty"`
+	StartAt         *time.Time     `json:"startAt,omitempty"`
+	DurationMinutes int            `json:"durationMinutes"`
+	TargetEPS       int            `json:"targetEps"`
+	Sources         []string       `json:"sources,omitempty"`
+	Nodes           []string       `json:"nodes,omitempty"`
+	Profile         string         `json:"profile"`
+	Scenario        string         `json:"scenario,omitempty"`
+	Workspace       string         `json:"workspace,omitempty"`
+	SkipTableCheck  bool           `json:"skipTableCheck"`
+	Owner           runs.RunOwner  `json:"owner"`
+	Enabled         bool           `json:"enabled"`
+	Status          string         `json:"status"`
+	NextRunAt       *time.Time     `json:"nextRunAt,omitempty"`
+	History         []ScheduledRun `json:"history"` // oldest first, up to history_limit
+	CreatedBy       string         `json:"createdBy,omitempty"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	UpdatedBy       string         `json:"updatedBy,omitempty"` // who last enabled or disabled it
+}
+
+// Scheduler keeps the schedules on disk and starts their runs when they are due, at most
+// one at a time
+type Scheduler struct {
+	mutex     sync.Mutex
+	config    ScheduleConfig
+	schedules []*Schedule
+	running   string        // schedule whose run is active
+	interrupt chan struct{} // closed by a delete to stop the active run
+}
+
+var errScheduleNotFound = errors.New("schedule not found")
+
+var Schedules = &Scheduler{config: defaultScheduleConfig()}
+
+func defaultScheduleConfig() ScheduleConfig {
+	return ScheduleConfig{
+		File:                "data/schedules.json",
+		PollSeconds:         30,
+		MaxDelayMinutes:     15,
+		BinaryMarginMinutes: 10,
+		HistoryLimit:        20,
+	}
+}
+
+// LoadConfig reads the schedules section from the application config file and the
+// stored schedules. A run that was active when the manager stopped is failed, since
+// nothing watched it to its end; the schedule's next run is unaffected.
+func (s *Scheduler) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig struct {
+		Schedules *ScheduleConfig `yaml:"schedules"`
+	}
+	config := defaultScheduleConfig()
+	fileConfig.Schedules = &config
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	defaults := defaultScheduleConfig()
+	if config.File == "" {
+		config.File = defaults.File
+	}
+	if config.PollSeconds <= 0 {
+		config.PollSeconds = defaults.PollSeconds
+	}
+	if config.MaxDelayMinutes < 0 {
+		config.MaxDelayMinutes = 0
+	}
+	if config.BinaryMarginMinutes < 0 {
+		config.BinaryMarginMinutes = 0
+	}
+	if config.HistoryLimit <= 0 {
+		config.HistoryLimit = defaults.HistoryLimit
+	}
+
+	var schedules []*Schedule
+	data, err = os.ReadFile(config.File)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read schedules: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &schedules); err != nil {
+			return fmt.Errorf("failed to parse schedules: %v", err)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running != "" {
+		return fmt.Errorf("schedule %s is running, schedules not reloaded", s.running)
+	}
+	s.config = config
+	s.schedules = schedules
+	interrupted := false
+	now := timeutil.Now()
+	for _, schedule := range schedules {
+		for i := range schedule.History {
+			if run := &schedule.History[i]; run.Status == ScheduledRunRunning {
+				interrupted = true
+				run.Status = ScheduledRunFailed
+				run.Message = "The manager restarted during the run"
+				run.EndedAt = &now
+			}
+		}
+	}
+	if interrupted {
+		return s.saveLocked()
+	}
+	return nil
+}
+
+// Config returns the scheduler settings
+func (s *Scheduler) Config() ScheduleConfig {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config
+}
+
+// Create validates a schedule and stores it
+func (s *Scheduler) Create(request ScheduleRequest, identity *auth.Identity, by string, now time.Time) (Schedule, error) {
+	request.Name = strings.TrimSpace(request.Name)
+	request.Cron = strings.TrimSpace(request.Cron)
+	if request.Name == "" {
+		return Schedule{}, fmt.Errorf("name is required")
+	}
+	if (request.Cron == "") == (request.StartAt == nil) {
+		return Schedule{}, fmt.Errorf("give either a cron expression or a startAt time")
+	}
+	location, err := timeutil.ParseLocation(request.Timezone)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if request.Cron != "" {
+		if _, err := cron.Parse(request.Cron); err != nil {
+			return Schedule{}, err
+		}
+	} else if !request.StartAt.After(now) {
+		return Schedule{}, fmt.Errorf("startAt %s is not in the future", timeutil.Format(*request.StartAt))
+	}
+	if request.DurationMinutes <= 0 {
+		return Schedule{}, fmt.Errorf("durationMinutes must be positive, every run lasts a fixed time")
+	}
+	if request.TargetEPS < 1 || request.TargetEPS > 100000 {
+		return Schedule{}, fmt.Errorf("targetEps %d must be between 1 and 100,000", request.TargetEPS)
+	}
+	sources := append([]string(nil), request.Sources...)
+	sort.Strings(sources)
+	for i, source := range sources {
+		if !O11yManager.IsKnownSource(source) {
+			return Schedule{}, fmt.Errorf("unknown source %q", source)
+		}
+		if i > 0 && sources[i-1] == source {
+			return Schedule{}, fmt.Errorf("source %s is listed twice", source)
+		}
+	}
+	nodes := append([]string(nil), request.Nodes...)
+	sort.Strings(nodes)
+	if len(nodes) > 0 {
+		if err := BinaryControl.LoadNodesConfig(); err != nil {
+			return Schedule{}, fmt.Errorf("failed to load nodes config: %v", err)
+		}
+		enabled := BinaryControl.GetEnabledNodes()
+		for i, node := range nodes {
+			if _, ok := enabled[node]; !ok {
+				return Schedule{}, fmt.Errorf("node %s is not an enabled node", node)
+			}
+			if i > 0 && nodes[i-1] == node {
+				return Schedule{}, fmt.Errorf("node %s is listed twice", node)
+			}
+		}
+	}
+	if violation := Quotas.CheckStart(identity, request.TargetEPS, request.DurationMinutes); violation != nil {
+		return Schedule{}, fmt.Errorf("%s", violation.Message)
+	}
+	workspace, err := ReportStorage.WorkspaceFor(request.Workspace, identity)
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	profile := request.Profile
+	if profile == "" {
+		profile = request.Name
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	schedule := &Schedule{
+		ID:              "schedule-" + hex.EncodeToString(suffix),
+		Name:            request.Name,
+		Cron:            request.Cron,
+		Timezone:        location.String(),
+		StartAt:         request.StartAt,
+		DurationMinutes: request.DurationMinutes,
+		TargetEPS:       request.TargetEPS,
+		Sources:         sources,
+		Nodes:           nodes,
+		Profile:         profile,
+		Scenario:        request.Scenario,
+		Workspace:       workspace,
+		SkipTableCheck:  request.SkipTableCheck,
+		Owner:           runOwner(identity),
+		Enabled:         request.Enabled == nil || *request.Enabled,
+		History:         []ScheduledRun{},
+		CreatedBy:       by,
+		CreatedAt:       now,
+	}
+	if schedule.StartAt != nil {
+		startAt := schedule.StartAt.UTC()
+		schedule.StartAt = &startAt
+		schedule.Timezone = ""
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = nextScheduledRun(schedule, now)
+	}
+
+	s.mutex.Lock()
+	s.schedules = append(s.schedules, schedule)
+	if err := s.saveLocked(); err != nil {
+		s.schedules = s.schedules[:len(s.schedules)-1]
+		s.mutex.Unlock()
+		return Schedule{}, err
+	}
+	copied := s.copyLocked(schedule)
+	s.mutex.Unlock()
+
+	AppState.BroadcastEvent("schedule_updated", copied)
+	return copied, nil
+}
+
+// Enable lets a schedule run again from its next due time. A one-off schedule whose
+// start time has passed cannot be enabled.
+func (s *Scheduler) Enable(id, by string) (Schedule, error) {
+	return s.change(id, func(schedule *Schedule) error {
+		if schedule.Enabled {
+			return fmt.Errorf("schedule %s is already enabled", id)
+		}
+		next := nextScheduledRun(schedule, timeutil.Now())
+		if next == nil {
+			return fmt.Errorf("schedule %s has no run left to enable", id)
+		}
+		schedule.Enabled = true
+		schedule.NextRunAt = next
+		schedule.UpdatedBy = by
+		return nil
+	})
+}
+
+// Disable stops a schedule from starting further runs. A run that is active keeps
+// running to its end.
+func (s *Scheduler) Disable(id, by string) (Schedule, error) {
+	return s.change(id, func(schedule *Schedule) error {
+		if !schedule.Enabled {
+			return fmt.Errorf("schedule %s is already disabled", id)
+		}
+		schedule.Enabled = false
+		schedule.NextRunAt = nil
+		schedule.UpdatedBy = by
+		return nil
+	})
+}
+
+// Delete removes a schedule and stops its run if one is active
+func (s *Scheduler) Delete(id string) error {
+	s.mutex.Lock()
+	kept := make([]*Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		if schedule.ID != id {
+			kept = append(kept, schedule)
+		}
+	}
+	if len(kept) == len(s.schedules) {
+		s.mutex.Unlock()
+		return errScheduleNotFound
+	}
+	previous := s.schedules
+	s.schedules = kept
+	if err := s.saveLocked(); err != nil {
+		s.schedules = previous
+		s.mutex.Unlock()
+		return err
+	}
+	if s.running == id && s.interrupt != nil {
+		close(s.interrupt)
+		s.interrupt = nil
+	}
+	s.mutex.Unlock()
+
+	AppState.BroadcastEvent("schedule_deleted", map[string]string{"id": id})
+	return nil
+}
+
+// change applies fn to a schedule under the lock and saves it
+func (s *Scheduler) change(id string, fn func(schedule *Schedule) error) (Schedule, error) {
+	s.mutex.Lock()
+	schedule := s.findLocked(id)
+	if schedule == nil {
+		s.mutex.Unlock()
+		return Schedule{}, errScheduleNotFound
+	}
+	previous := cloneSchedule(schedule)
+	if err := fn(schedule); err != nil {
+		s.mutex.Unlock()
+		return Schedule{}, err
+	}
+	if err := s.saveLocked(); err != nil {
+		*schedule = previous
+		s.mutex.Unlock()
+		return Schedule{}, err
+	}
+	copied := s.copyLocked(schedule)
+	s.mutex.Unlock()
+
+	AppState.BroadcastEvent("schedule_updated", copied)
+	return copied, nil
+}
+
+// List returns every schedule without its history, newest first
+func (s *Scheduler) List() []Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		copied := s.copyLocked(schedule)
+		copied.History = nil
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// Get returns a schedule with its history and the summary of every recorded run
+func (s *Scheduler) Get(id string) (Schedule, bool) {
+	s.mutex.Lock()
+	schedule := s.findLocked(id)
+	if schedule == nil {
+		s.mutex.Unlock()
+		return Schedule{}, false
+	}
+	copied := s.copyLocked(schedule)
+	s.mutex.Unlock()
+
+	for i := range copied.History {
+		run := &copied.History[i]
+		if stored, ok := RunStore.GetRun(run.RunID); run.RunID != "" && ok {
+			for _, metric := range campaignReportMetrics {
+				if value, ok := stored.Summary[metric]; ok {
+					if run.Summary == nil {
+						run.Summary = make(map[string]float64)
+					}
+					run.Summary[metric] = value
+				}
+			}
+		}
+	}
+	return copied, true
+}
+
+// Start looks for due schedules every poll_seconds in the background
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.Config().PollSeconds) * time.Second)
+		defer ticker.Stop()
+		s.Check(timeutil.Now())
+		for range ticker.C {
+			s.Check(timeutil.Now())
+		}
+	}()
+}
+
+// Check handles the schedules due at now, earliest first. A run due during a maintenance
+// window is skipped. While another simulation runs a due run waits, and is missed once
+// it is more than max_delay_minutes late. At most one run starts per check.
+func (s *Scheduler) Check(now time.Time) {
+	busy := AppState.Simulation().Running
+
+	s.mutex.Lock()
+	var due []*Schedule
+	for _, schedule := range s.schedules {
+		if schedule.Enabled && schedule.NextRunAt != nil && !schedule.NextRunAt.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRunAt.Before(*due[j].NextRunAt) })
+
+	maxDelay := time.Duration(s.config.MaxDelayMinutes) * time.Minute
+	var changed []*Schedule
+	var start *Schedule
+	var startDue time.Time
+	for _, schedule := range due {
+		dueAt := *schedule.NextRunAt
+		run := ScheduledRun{DueAt: dueAt}
+		switch {
+		case Maintenance.SkipScheduled(schedule.Name, now):
+			run.Status = ScheduledRunSkipped
+			run.Message = "Due during a maintenance window"
+		case busy || s.running != "" || start != nil:
+			if now.Sub(dueAt) <= maxDelay {
+				continue
+			}
+			run.Status = ScheduledRunMissed
+			run.Message = fmt.Sprintf("Another simulation was still running %d minutes after the due time", s.config.MaxDelayMinutes)
+		default:
+			start, startDue = schedule, dueAt
+			run.Status = ScheduledRunRunning
+			run.StartedAt = &now
+		}
+		if run.Status != ScheduledRunRunning {
+			run.EndedAt = &now
+		}
+		s.appendRunLocked(schedule, run)
+		schedule.NextRunAt = nextScheduledRun(schedule, now)
+		changed = append(changed, schedule)
+	}
+	if len(changed) == 0 {
+		s.mutex.Unlock()
+		return
+	}
+	if start != nil {
+		s.running = start.ID
+		interrupt := make(chan struct{})
+		s.interrupt = interrupt
+		go s.execute(cloneSchedule(start), startDue, interrupt)
+	}
+	if err := s.saveLocked(); err != nil {
+		logger.Warn().Err(err).Msg("Failed to save schedules")
+	}
+	copies := make([]Schedule, 0, len(changed))
+	for _, schedule := range changed {
+		copies = append(copies, s.copyLocked(schedule))
+	}
+	s.mutex.Unlock()
+
+	for _, copied := range copies {
+		AppState.BroadcastEvent("schedule_updated", copied)
+		if last := copied.History[len(copied.History)-1]; last.Status != ScheduledRunRunning {
+			logger.LogWarning("System", "Schedules", fmt.Sprintf("Run of schedule %s (%s) due at %s %s: %s",
+				copied.ID, copied.Name, timeutil.Format(last.DueAt), last.Status, last.Message))
+		}
+	}
+}
+
+// execute checks the ClickHouse tables, configures the schedule's sources and EPS and
+// runs it on its nodes for its duration, then records the outcome
+func (s *Scheduler) execute(schedule Schedule, dueAt time.Time, interrupt <-chan struct{}) {
+	runID, status, message := s.runSchedule(schedule, dueAt, interrupt)
+
+	now := timeutil.Now()
+	s.mutex.Lock()
+	s.running = ""
+	s.interrupt = nil
+	current := s.findLocked(schedule.ID)
+	if current == nil {
+		s.mutex.Unlock()
+		logger.LogWithNode("System", "Schedules", fmt.Sprintf("Run of deleted schedule %s (%s) %s", schedule.ID, schedule.Name, status), "info")
+		return
+	}
+	for i := range current.History {
+		if run := &current.History[i]; run.DueAt.Equal(dueAt) && run.Status == ScheduledRunRunning {
+			run.RunID = runID
+			run.Status = status
+			run.Message = message
+			run.EndedAt = &now
+		}
+	}
+	if err := s.saveLocked(); err != nil {
+		logger.Warn().Err(err).Str("schedule", schedule.ID).Msg("Failed to save schedules")
+	}
+	copied := s.copyLocked(current)
+	s.mutex.Unlock()
+
+	AppState.BroadcastEvent("schedule_updated", copied)
+	text := fmt.Sprintf("Run of schedule %s (%s) due at %s %s", schedule.ID, schedule.Name, timeutil.Format(dueAt), status)
+	if message != "" {
+		text += ": " + message
+	}
+	if status == ScheduledRunCompleted {
+		logger.LogWithNode("System", "Schedules", text, "info")
+	} else {
+		logger.LogWarning("System", "Schedules", text)
+	}
+}
+
+// runSchedule prepares and runs one occurrence of a schedule and returns its run ID,
+// status and a message explaining a failure
+func (s *Scheduler) runSchedule(schedule Schedule, dueAt time.Time, interrupt <-chan struct{}) (string, string, string) {
+	tableCheck, err := TableCheck.BeforeRun(context.Background(), schedule.SkipTableCheck)
+	if err != nil {
+		return "", ScheduledRunFailed, fmt.Sprintf("Cannot verify ClickHouse tables before the run: %v", err)
+	}
+	if tableCheck != nil && !tableCheck.Passed {
+		return "", ScheduledRunFailed, tableCheck.Summary()
+	}
+
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		return "", ScheduledRunFailed, fmt.Sprintf("Failed to load nodes config: %v", err)
+	}
+	enabled := BinaryControl.GetEnabledNodes()
+	var nodes, gone []string
+	for name := range enabled {
+		if len(schedule.Nodes) == 0 {
+			nodes = append(nodes, name)
+		}
+	}
+	for _, name := range schedule.Nodes {
+		if _, ok := enabled[name]; ok {
+			nodes = append(nodes, name)
+		} else {
+			gone = append(gone, name)
+		}
+	}
+	if len(nodes) == 0 {
+		return "", ScheduledRunFailed, "None of the schedule's nodes is enabled"
+	}
+	sort.Strings(nodes)
+
+	// The EPS is split across every enabled node, so ask for enough that the schedule's
+	// nodes alone produce the target
+	perNode := (schedule.TargetEPS + len(nodes) - 1) / len(nodes)
+	sources, err := configureCampaignPoint(schedule.Sources, perNode*len(enabled))
+	if err != nil {
+		return "", ScheduledRunFailed, err.Error()
+	}
+
+	select {
+	case <-interrupt:
+		return "", ScheduledRunCancelled, "The schedule was deleted before the run started"
+	default:
+	}
+
+	runID, status, message := executeTimedRun(timedRun{
+		Config: SimulationConfig{
+			Profile:         schedule.Profile,
+			Scenario:        schedule.Scenario,
+			TargetEPS:       schedule.TargetEPS,
+			DurationMinutes: schedule.DurationMinutes,
+		},
+		Workspace:     schedule.Workspace,
+		Owner:         schedule.Owner,
+		Nodes:         nodes,
+		BinaryTimeout: schedule.DurationMinutes + s.Config().BinaryMarginMinutes,
+		Cancelled:     "Stopped by the delete of the schedule",
+		OnStarted: func(runID string) {
+			s.setRunID(schedule.ID, dueAt, runID)
+			RunStore.AddTimelineEvent(runID, "scheduled_run", fmt.Sprintf("Run of schedule %s due at %s: %d EPS over %s on %d nodes",
+				schedule.Name, timeutil.Format(dueAt), schedule.TargetEPS, strings.Join(sources, ", "), len(nodes)),
+				map[string]interface{}{"scheduleId": schedule.ID, "dueAt": dueAt, "targetEps": schedule.TargetEPS, "sources": sources, "nodes": nodes})
+		},
+	}, interrupt)
+	if len(gone) > 0 && status == ScheduledRunCompleted {
+		note := fmt.Sprintf("Nodes %s are no longer enabled and did not run", strings.Join(gone, ", "))
+		if message != "" {
+			note = message + "; " + note
+		}
+		message = note
+	}
+	return runID, status, message
+}
+
+// setRunID records the run started for an occurrence as soon as it exists
+func (s *Scheduler) setRunID(id string, dueAt time.Time, runID string) {
+	s.mutex.Lock()
+	schedule := s.findLocked(id)
+	if schedule == nil {
+		s.mutex.Unlock()
+		return
+	}
+	for i := range schedule.History {
+		if run := &schedule.History[i]; run.DueAt.Equal(dueAt) && run.Status == ScheduledRunRunning {
+			run.RunID = runID
+		}
+	}
+	if err := s.saveLocked(); err != nil {
+		logger.Warn().Err(err).Str("schedule", id).Msg("Failed to save schedules")
+	}
+	copied := s.copyLocked(schedule)
+	s.mutex.Unlock()
+
+	AppState.BroadcastEvent("schedule_updated", copied)
+}
+
+// nextScheduledRun returns when a schedule is next due after now, or nil if it never is.
+// Occurrences missed while the manager was down are not caught up.
+func nextScheduledRun(schedule *Schedule, now time.Time) *time.Time {
+	if schedule.Cron == "" {
+		if schedule.StartAt == nil || !schedule.StartAt.After(now) {
+			return nil
+		}
+		startAt := *schedule.StartAt
+		return &startAt
+	}
+	expression, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil
+	}
+	location, err := timeutil.ParseLocation(schedule.Timezone)
+	if err != nil {
+		return nil
+	}
+	next := expression.Next(now.In(location))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// appendRunLocked adds an occurrence to a schedule's history and drops the oldest past
+// history_limit; callers must hold the lock
+func (s *Scheduler) appendRunLocked(schedule *Schedule, run ScheduledRun) {
+	schedule.History = append(schedule.History, run)
+	if excess := len(schedule.History) - s.config.HistoryLimit; excess > 0 {
+		schedule.History = append([]ScheduledRun(nil), schedule.History[excess:]...)
+	}
+}
+
+func (s *Scheduler) findLocked(id string) *Schedule {
+	for _, schedule := range s.schedules {
+		if schedule.ID == id {
+			return schedule
+		}
+	}
+	return nil
+}
+
+// copyLocked returns a copy of schedule with its current state; callers must hold the
+// lock
+func (s *Scheduler) copyLocked(schedule *Schedule) Schedule {
+	copied := cloneSchedule(schedule)
+	switch {
+	case s.running == schedule.ID:
+		copied.Status = ScheduleRunning
+	case !schedule.Enabled:
+		copied.Status = ScheduleDisabled
+	case schedule.NextRunAt == nil:
+		copied.Status = ScheduleFinished
+	default:
+		copied.Status = ScheduleScheduled
+	}
+	return copied
+}
+
+func cloneSchedule(schedule *Schedule) Schedule {
+	copied := *schedule
+	copied.Sources = append([]string(nil), schedule.Sources...)
+	copied.Nodes = append([]string(nil), schedule.Nodes...)
+	copied.History = append([]ScheduledRun{}, schedule.History...)
+	return copied
+}
+
+// saveLocked writes the schedules; callers must hold the lock
+func (s *Scheduler) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.config.File), 0755); err != nil {
+		return fmt.Errorf("failed to create schedules directory: %v", err)
+	}
+	data, err := json.MarshalIndent(s.schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %v", err)
+	}
+	tmp := s.config.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedules: %v", err)
+	}
+	return os.Rename(tmp, s.config.File)
+}
+
+// scheduleError sends the response of a failed schedule operation
+func scheduleError(w http.ResponseWriter, err error) {
+	status := http.StatusConflict
+	if errors.Is(err, errScheduleNotFound) {
+		status = http.StatusNotFound
+	}
+	SendJSONResponse(w, status, APIResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// HandleAPIListSchedules Handles GET /api/schedules
+// Lists the schedules newest first, with their next run but without their history
+func HandleAPIListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules := Schedules.List()
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d schedules", len(schedules)),
+		Data:    schedules,
+	})
+}
+
+// HandleAPICreateSchedule Handles POST /api/schedules
+// Body: {"name": "...", "cron": "0 2 * * MON-FRI", "timezone": "Asia/Kolkata",
+// "durationMinutes": 60, "targetEps": 50000, "sources": ["linux", "mysql"], "nodes":
+// ["node1", "node2"]}, or "startAt" (RFC3339) instead of cron for a single run. At each
+// due time the sources are enabled, the EPS is distributed so the nodes together produce
+// targetEps, and the binaries run for the duration. Returns 201 with the schedule.
+func HandleAPICreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var request ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	by := auth.Describe(r.Context())
+	schedule, err := Schedules.Create(request, auth.FromContext(r.Context()), by, timeutil.Now())
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Schedule not created: %v", err),
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Schedule %s created, disabled", schedule.ID)
+	if schedule.NextRunAt != nil {
+		message = fmt.Sprintf("Schedule %s created, next run at %s", schedule.ID, timeutil.Format(*schedule.NextRunAt))
+	}
+	logger.LogWithNode("System", "Schedules", fmt.Sprintf("Schedule %s (%s) created by %s", schedule.ID, schedule.Name, by), "info")
+	SendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    schedule,
+	})
+}
+
+// HandleAPIGetSchedule Handles GET /api/schedules/{id}
+func HandleAPIGetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := Schedules.Get(mux.Vars(r)["id"])
+	if !ok {
+		scheduleError(w, errScheduleNotFound)
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Schedule %s is %s, %d past runs", schedule.ID, schedule.Status, len(schedule.History)),
+		Data:    schedule,
+	})
+}
+
+// HandleAPIDeleteSchedule Handles DELETE /api/schedules/{id}
+// A run of the schedule that is active is stopped
+func HandleAPIDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := Schedules.Delete(id); err != nil {
+		scheduleError(w, err)
+		return
+	}
+	logger.LogWithNode("System", "Schedules", fmt.Sprintf("Schedule %s deleted by %s", id, auth.Describe(r.Context())), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Schedule %s deleted", id),
+	})
+}
+
+// HandleAPIEnableSchedule Handles POST /api/schedules/{id}/enable
+func HandleAPIEnableSchedule(w http.ResponseWriter, r *http.Request) {
+	handleScheduleAction(w, r, "enabled", Schedules.Enable)
+}
+
+// HandleAPIDisableSchedule Handles POST /api/schedules/{id}/disable
+func HandleAPIDisableSchedule(w http.ResponseWriter, r *http.Request) {
+	handleScheduleAction(w, r, "disabled", Schedules.Disable)
+}
+
+func handleScheduleAction(w http.ResponseWriter, r *http.Request, done string, action func(id, by string) (Schedule, error)) {
+	id := mux.Vars(r)["id"]
+	by := auth.Describe(r.Context())
+	schedule, err := action(id, by)
+	if err != nil {
+		scheduleError(w, err)
+		return
+	}
+	logger.LogWithNode("System", "Schedules", fmt.Sprintf("Schedule %s %s by %s", id, done, by), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Schedule %s %s", id, done),
+		Data:    schedule,
+	})
+}
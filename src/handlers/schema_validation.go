@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema validation states of a source
+const (
+	SchemaValid      = "valid"
+	SchemaInvalid    = "invalid"
+	SchemaNoSchema   = "no_schema"   // the source has no schema in src/configs/schemas
+	SchemaNoMessages = "no_messages" // its topics held nothing to sample
+	SchemaError      = "error"
+)
+
+// schemaViolationExcerpt caps how much of an invalid message is kept in a report
+const schemaViolationExcerpt = 500
+
+var arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// maxSchemaBodyBytes bounds the body of PUT /api/o11y/sources/{source}/schema
+const maxSchemaBodyBytes = 1 << 20
+
+// SchemaValidationConfig holds the schema_validation section of config.yaml
+type SchemaValidationConfig struct {
+	Enabled         bool `yaml:"enabled" json:"enabled"` // validate the enabled sources periodically during runs
+	IntervalSeconds int  `yaml:"interval_seconds" json:"intervalSeconds"`
+	SampleMessages  int  `yaml:"sample_messages" json:"sampleMessages"` // most recent messages read per topic
+	MaxExamples     int  `yaml:"max_examples" json:"maxExamples"`       // invalid messages kept per source
+	TimeoutSeconds  int  `yaml:"timeout_seconds" json:"timeoutSeconds"` // per topic read
+}
+
+// SchemaViolation is an invalid message with what is wrong with it
+type SchemaViolation struct {
+	Topic   string   `json:"topic"`
+	Message string   `json:"message"` // cut to 500 bytes
+	Errors  []string `json:"errors"`
+}
+
+// SourceSchemaValidation is the validation of the sampled messages of one source
+type SourceSchemaValidation struct {
+	Source      string            `json:"source"`
+	Status      string            `json:"status"`
+	Topics      []string          `json:"topics"`
+	Sampled     int               `json:"sampled"`
+	Invalid     int               `json:"invalid"`
+	Examples    []SchemaViolation `json:"examples,omitempty"`
+	TopErrors   map[string]int    `json:"topErrors,omitempty"` // invalid messages per field path and problem
+	Error       string            `json:"error,omitempty"`
+	TopicErrors map[string]string `json:"topicErrors,omitempty"`
+}
+
+// SchemaValidationReport is one validation pass over the sources
+type SchemaValidationReport struct {
+	RunID     string                   `json:"runId,omitempty"` // set for the periodic validation during a run
+	Passed    bool                     `json:"passed"`          // no source had an invalid message
+	Sources   []SourceSchemaValidation `json:"sources"`
+	CheckedAt time.Time                `json:"checkedAt"`
+	TookMs    int64                    `json:"tookMs"`
+}
+
+// SchemaValidator checks samples of what the simulators produce against each source's
+// message schema, so malformed output is caught during a run rather than on a dashboard
+type SchemaValidator struct {
+	mutex    sync.Mutex
+	config   SchemaValidationConfig
+	latest   *SchemaValidationReport
+	runID    string
+	reported map[string]bool // sources already flagged on the run's timeline
+}
+
+var SchemaValidation = &SchemaValidator{config: defaultSchemaValidationConfig()}
+
+func defaultSchemaValidationConfig() SchemaValidationConfig {
+	return SchemaValidationConfig{
+		Enabled:         true,
+		IntervalSeconds: 300,
+		SampleMessages:  20,
+		MaxExamples:     5,
+		TimeoutSeconds:  10,
+	}
+}
+
+// LoadConfig reads the schema_validation section from the application config file
+func (sv *SchemaValidator) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultSchemaValidationConfig()
+	fileConfig := struct {
+		SchemaValidation *SchemaValidationConfig `yaml:"schema_validation"`
+	}{SchemaValidation: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	defaults := defaultSchemaValidationConfig()
+	if config.IntervalSeconds <= 0 {
+		config.IntervalSeconds = defaults.IntervalSeconds
+	}
+	if config.SampleMessages <= 0 || config.SampleMessages > kafka_ch_reset.MaxSampleMessages {
+		config.SampleMessages = defaults.SampleMessages
+	}
+	if config.MaxExamples < 0 {
+		config.MaxExamples = defaults.MaxExamples
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = defaults.TimeoutSeconds
+	}
+
+	sv.mutex.Lock()
+	sv.config = config
+	sv.mutex.Unlock()
+	return nil
+}
+
+// Config returns the schema validation settings
+func (sv *SchemaValidator) Config() SchemaValidationConfig {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+	return sv.config
+}
+
+// Latest returns the most recent report, nil before the first validation
+func (sv *SchemaValidator) Latest() *SchemaValidationReport {
+	sv.mutex.Lock()
+	defer sv.mutex.Unlock()
+	if sv.latest == nil {
+		return nil
+	}
+	report := *sv.latest
+	report.Sources = append([]SourceSchemaValidation{}, sv.latest.Sources...)
+	return &report
+}
+
+// Start validates the enabled sources every interval_seconds while a run is active
+func (sv *SchemaValidator) Start() {
+	config := sv.Config()
+	if !config.Enabled {
+		log.Println("Message schema validation disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.IntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			sim := AppState.Simulation()
+			if sim.Running && sim.RunID != "" {
+				sv.CheckRun(sim.RunID)
+			}
+		}
+	}()
+}
+
+// CheckRun validates the enabled sources for a run and puts each source with invalid
+// messages on the run's timeline, once per run
+func (sv *SchemaValidator) CheckRun(runID string) {
+	report := sv.validate(O11yManager.GetEnabledSources(), 0)
+	report.RunID = runID
+
+	sv.mutex.Lock()
+	sv.latest = report
+	if sv.runID != runID {
+		sv.runID, sv.reported = runID, make(map[string]bool)
+	}
+	var flagged []SourceSchemaValidation
+	for _, source := range report.Sources {
+		if source.Status == SchemaInvalid && !sv.reported[source.Source] {
+			sv.reported[source.Source] = true
+			flagged = append(flagged, source)
+		}
+	}
+	sv.mutex.Unlock()
+
+	for _, source := range flagged {
+		message := fmt.Sprintf("%d of %d sampled %s messages violate its schema", source.Invalid, source.Sampled, source.Source)
+		logger.LogWarning("System", "SchemaValidation", fmt.Sprintf("Run %s: %s", runID, message))
+		if err := RunStore.AddTimelineEvent(runID, "schema_violation", message, map[string]interface{}{
+			"source":    source.Source,
+			"sampled":   source.Sampled,
+			"invalid":   source.Invalid,
+			"topErrors": source.TopErrors,
+		}); err != nil {
+			log.Printf("Warning: Failed to record schema violation for run %s: %v", runID, err)
+		}
+	}
+}
+
+// Validate samples the most recent messages of each source's input topics and checks
+// them against the source's schema. messages of 0 uses sample_messages.
+func (sv *SchemaValidator) Validate(sources []string, messages int) *SchemaValidationReport {
+	report := sv.validate(sources, messages)
+	sv.mutex.Lock()
+	sv.latest = report
+	sv.mutex.Unlock()
+	return report
+}
+
+func (sv *SchemaValidator) validate(sources []string, messages int) *SchemaValidationReport {
+	config := sv.Config()
+	if messages <= 0 {
+		messages = config.SampleMessages
+	}
+	started := time.Now()
+	report := &SchemaValidationReport{Sources: make([]SourceSchemaValidation, len(sources))}
+
+	// Every source reads from the Kafka pod separately, so validate them side by side
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source string) {
+			defer wg.Done()
+			report.Sources[i] = validateSourceMessages(source, messages, config)
+		}(i, source)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Sources, func(i, j int) bool { return report.Sources[i].Source < report.Sources[j].Source })
+	report.Passed = true
+	for _, source := range report.Sources {
+		if source.Status == SchemaInvalid {
+			report.Passed = false
+		}
+	}
+	report.CheckedAt = time.Now().UTC()
+	report.TookMs = time.Since(started).Milliseconds()
+	return report
+}
+
+// validateSourceMessages validates the sampled messages of one source
+func validateSourceMessages(source string, messages int, config SchemaValidationConfig) SourceSchemaValidation {
+	result := SourceSchemaValidation{Source: source, Topics: []string{}}
+	schema, err := O11yManager.LoadSourceSchema(source)
+	if err != nil {
+		result.Status, result.Error = SchemaError, err.Error()
+		return result
+	}
+	if schema == nil {
+		result.Status = SchemaNoSchema
+		return result
+	}
+	if topicMapping == nil {
+		result.Status, result.Error = SchemaError, "topics_tables.yaml mapping not loaded"
+		return result
+	}
+	topicConfig, mapped := topicMapping.SourceConfig(source)
+	if !mapped || len(topicConfig.InputTopic) == 0 {
+		result.Status, result.Error = SchemaError, "no input topic in topics_tables.yaml"
+		return result
+	}
+	for _, topic := range topicConfig.InputTopic {
+		result.Topics = append(result.Topics, topic.Name)
+	}
+
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	for _, topic := range result.Topics {
+		sampled, err := topicMapping.SampleMessages(topic, messages, timeout)
+		if err != nil {
+			if result.TopicErrors == nil {
+				result.TopicErrors = make(map[string]string)
+			}
+			result.TopicErrors[topic] = err.Error()
+			continue
+		}
+		for _, message := range sampled {
+			result.Sampled++
+			violations := schema.Validate([]byte(message))
+			if len(violations) == 0 {
+				continue
+			}
+			result.Invalid++
+			if result.TopErrors == nil {
+				result.TopErrors = make(map[string]int)
+			}
+			seen := make(map[string]bool)
+			for _, violation := range violations {
+				if kind := violationKind(violation); !seen[kind] {
+					seen[kind] = true
+					result.TopErrors[kind]++
+				}
+			}
+			if len(result.Examples) < config.MaxExamples {
+				if len(message) > schemaViolationExcerpt {
+					message = message[:schemaViolationExcerpt] + "..."
+				}
+				result.Examples = append(result.Examples, SchemaViolation{Topic: topic, Message: message, Errors: violations})
+			}
+		}
+	}
+
+	switch {
+	case result.Invalid > 0:
+		result.Status = SchemaInvalid
+	case result.Sampled > 0:
+		result.Status = SchemaValid
+	case len(result.TopicErrors) > 0:
+		result.Status, result.Error = SchemaError, "no topic could be sampled"
+	default:
+		result.Status = SchemaNoMessages
+	}
+	return result
+}
+
+// violationKind drops the array indexes from a violation's path, so the same problem
+// in different elements is counted once per message
+func violationKind(violation string) string {
+	return arrayIndexPattern.ReplaceAllString(violation, "[]")
+}
+
+// HandleAPIGetSourceSchemas Handles GET /api/o11y/schemas
+// Lists every source with whether it has a message schema in src/configs/schemas
+func HandleAPIGetSourceSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := O11yManager.ListSourceSchemas()
+	count := 0
+	for _, info := range schemas {
+		if info.HasSchema {
+			count++
+		}
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d of %d sources have a message schema", count, len(schemas)),
+		Data:    schemas,
+	})
+}
+
+// HandleAPIGetSourceSchema Handles GET /api/o11y/sources/{source}/schema
+func HandleAPIGetSourceSchema(w http.ResponseWriter, r *http.Request) {
+	sourceName := mux.Vars(r)["source"]
+	if !O11yManager.IsKnownSource(sourceName) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Source not found: %s", sourceName),
+		})
+		return
+	}
+	schema, err := O11yManager.LoadSourceSchema(sourceName)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if schema == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Source %s has no message schema", sourceName),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    schema,
+	})
+}
+
+// HandleAPIUpdateSourceSchema Handles PUT /api/o11y/sources/{source}/schema[?fromSample=true]
+// The body is a JSON Schema, or with fromSample=true a sample message from which a schema
+// is inferred: every field of the sample becomes required with the type it has there
+func HandleAPIUpdateSourceSchema(w http.ResponseWriter, r *http.Request) {
+	sourceName := mux.Vars(r)["source"]
+	if !O11yManager.IsKnownSource(sourceName) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Source not found: %s", sourceName),
+		})
+		return
+	}
+	fromSample := false
+	if value := r.URL.Query().Get("fromSample"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "fromSample must be true or false",
+			})
+			return
+		}
+		fromSample = parsed
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSchemaBodyBytes))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+	var schema *o11y_source_manager.MessageSchema
+	if fromSample {
+		schema, err = o11y_source_manager.InferMessageSchema(body)
+	} else {
+		schema, err = o11y_source_manager.ParseMessageSchema(body)
+	}
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if fromSample && schema.Title == "" {
+		schema.Title = fmt.Sprintf("%s message, inferred from a sample", sourceName)
+	}
+
+	if err := O11yManager.SaveSourceSchema(sourceName, schema); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	logger.LogWithNode("System", "SchemaValidation", fmt.Sprintf("Message schema of %s updated", sourceName), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Message schema of %s saved", sourceName),
+		Data:    schema,
+	})
+}
+
+// HandleAPIDeleteSourceSchema Handles DELETE /api/o11y/sources/{source}/schema
+func HandleAPIDeleteSourceSchema(w http.ResponseWriter, r *http.Request) {
+	sourceName := mux.Vars(r)["source"]
+	if !O11yManager.IsKnownSource(sourceName) {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Source not found: %s", sourceName),
+		})
+		return
+	}
+	existed, err := O11yManager.DeleteSourceSchema(sourceName)
+	if err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !existed {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Source %s has no message schema", sourceName),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Message schema of %s deleted", sourceName),
+	})
+}
+
+// HandleAPIValidateSourceSchemas Handles POST /api/o11y/schemas/validate?sources=&messages=
+// Samples the most recent messages of the sources' input topics (default the enabled
+// sources and schema_validation.sample_messages per topic) and validates them now
+func HandleAPIValidateSourceSchemas(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	messages := 0
+	if value := query.Get("messages"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > kafka_ch_reset.MaxSampleMessages {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("messages must be between 1 and %d", kafka_ch_reset.MaxSampleMessages),
+			})
+			return
+		}
+		messages = parsed
+	}
+
+	var sources []string
+	if selected := filterSet(query.Get("sources")); selected != nil {
+		for source := range selected {
+			if !O11yManager.IsKnownSource(source) {
+				SendJSONResponse(w, http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Source not found: %s", source),
+				})
+				return
+			}
+			sources = append(sources, source)
+		}
+	} else {
+		if err := O11yManager.LoadMainConfig(); err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to read conf.yml: %v", err),
+			})
+			return
+		}
+		sources = O11yManager.GetEnabledSources()
+	}
+
+	// Sources are sampled side by side, their topics one after another, each waiting on
+	// the Kafka pod for up to timeout_seconds
+	topics := 1
+	for _, source := range sources {
+		if topicConfig, ok := topicMapping.SourceConfig(source); ok && len(topicConfig.InputTopic) > topics {
+			topics = len(topicConfig.InputTopic)
+		}
+	}
+	timeout := time.Duration(SchemaValidation.Config().TimeoutSeconds) * time.Second
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(topics)*2*timeout + time.Minute))
+
+	report := SchemaValidation.Validate(sources, messages)
+	message := fmt.Sprintf("Messages of %d sources match their schemas", len(report.Sources))
+	if !report.Passed {
+		var invalid []string
+		for _, source := range report.Sources {
+			if source.Status == SchemaInvalid {
+				invalid = append(invalid, source.Source)
+			}
+		}
+		message = fmt.Sprintf("Schema violations in %s", strings.Join(invalid, ", "))
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// HandleAPIGetSchemaValidation Handles GET /api/o11y/schemas/validation
+// Returns the latest validation, periodic during a run or on demand
+func HandleAPIGetSchemaValidation(w http.ResponseWriter, r *http.Request) {
+	report := SchemaValidation.Latest()
+	if report == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "No schema validation has run yet",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Schema validation of %d sources at %s", len(report.Sources), timeutil.Format(report.CheckedAt)),
+		Data:    report,
+	})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/selfstats"
+	"vuDataSim/src/sshlimit"
+)
+
+// HandleAPISelfReliability Handles GET /api/self/reliability
+func HandleAPISelfReliability(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    selfstats.Default().Report(),
+	})
+}
+
+// HandleAPISelfPanics Handles GET /api/self/panics
+func HandleAPISelfPanics(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    selfstats.Panics(),
+	})
+}
+
+// HandleAPISelfNodePolling Handles GET /api/self/node-polling
+// Returns the circuit breaker state and success rate of every node agent host
+func HandleAPISelfNodePolling(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"config": NodeClient.Config(),
+			"hosts":  NodeClient.Status(),
+		},
+	})
+}
+
+// HandleAPISelfSSH Handles GET /api/self/ssh
+// Returns the open and queued SSH sessions and the queue wait times of every node host,
+// and the pooled connections to each node
+func HandleAPISelfSSH(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"config":           sshlimit.Default().Config(),
+			"hosts":            sshlimit.Default().Status(),
+			"connectionConfig": node_control.SSH.Config(),
+			"connections":      node_control.SSH.Status(),
+			"pool":             node_control.SSH.PoolStatus(),
+		},
+	})
+}
@@ -4,8 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"time"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"vuDataSim/src/auth"
 	"vuDataSim/src/logger"
+	"vuDataSim/src/o11y_source_manager"
+	"vuDataSim/src/runs"
+	"vuDataSim/src/timeutil"
 )
 
 const (
@@ -13,6 +21,21 @@ const (
 	ApplicationJSON   = "application/json"
 )
 
+// maxTargetRate caps targetKafka (msg/s) and targetClickHouse (rows/s)
+const maxTargetRate = 1000000
+
+// validateDownstreamTargets checks the expected Kafka and ClickHouse rates of a run
+// and returns an error message, or "" if they are valid
+func validateDownstreamTargets(config SimulationConfig) string {
+	if config.TargetKafka < 0 || config.TargetKafka > maxTargetRate {
+		return fmt.Sprintf("Target Kafka rate must be between 0 (no target) and %d msg/s", maxTargetRate)
+	}
+	if config.TargetClickHouse < 0 || config.TargetClickHouse > maxTargetRate {
+		return fmt.Sprintf("Target ClickHouse rate must be between 0 (no target) and %d rows/s", maxTargetRate)
+	}
+	return ""
+}
+
 func StartSimulation(w http.ResponseWriter, r *http.Request) {
 	var config SimulationConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
@@ -20,18 +43,42 @@ func StartSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	AppState.Mutex.Lock()
-	defer AppState.Mutex.Unlock()
+	_, message, ok := startSimulation(w, r, config)
+	if !ok {
+		return
+	}
 
-	if AppState.IsSimulationRunning {
-		response := APIResponse{
+	response := APIResponse{
+		Success: true,
+		Message: message,
+		Data:    AppState.Snapshot(),
+	}
+
+	w.Header().Set(ContentTypeHeader, ApplicationJSON)
+	json.NewEncoder(w).Encode(response)
+}
+
+// startSimulation checks and starts a run for a start request. On failure it sends the
+// error response itself; on success it returns the run ID, empty if the run could not
+// be persisted, and a message for the response.
+func startSimulation(w http.ResponseWriter, r *http.Request, config SimulationConfig) (string, string, bool) {
+	// Fail fast on missing ClickHouse tables instead of an hour of empty charts
+	tableCheck, err := TableCheck.BeforeRun(r.Context(), config.SkipTableCheck)
+	if err != nil {
+		SendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
 			Success: false,
-			Message: "Simulation is already running",
-		}
-		w.Header().Set(ContentTypeHeader, ApplicationJSON)
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(response)
-		return
+			Message: fmt.Sprintf("Cannot verify ClickHouse tables before the run: %v (set skipTableCheck to start anyway)", err),
+		})
+		return "", "", false
+	}
+	if tableCheck != nil && !tableCheck.Passed {
+		logger.LogWarning("System", "Simulation", "Simulation start refused: "+tableCheck.Summary())
+		SendJSONResponse(w, http.StatusPreconditionFailed, APIResponse{
+			Success: false,
+			Message: tableCheck.Summary(),
+			Data:    tableCheck,
+		})
+		return "", "", false
 	}
 
 	// Validate configuration
@@ -43,37 +90,107 @@ func StartSimulation(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(ContentTypeHeader, ApplicationJSON)
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(response)
-		return
+		return "", "", false
+	}
+	if message := validateDownstreamTargets(config); message != "" {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: message,
+		})
+		return "", "", false
+	}
+	workspace, err := ReportStorage.WorkspaceFor(config.Workspace, auth.FromContext(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return "", "", false
+	}
+	if config.DurationMinutes < 0 {
+		response := APIResponse{
+			Success: false,
+			Message: "Duration must not be negative",
+		}
+		w.Header().Set(ContentTypeHeader, ApplicationJSON)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return "", "", false
+	}
+	identity := auth.FromContext(r.Context())
+	if violation := Quotas.CheckStart(identity, config.TargetEPS, config.DurationMinutes); violation != nil {
+		logger.LogWarning("System", "Simulation", fmt.Sprintf("Simulation start by %s refused: %s", auth.Describe(r.Context()), violation.Message))
+		SendJSONResponse(w, http.StatusForbidden, APIResponse{
+			Success: false,
+			Message: violation.Message,
+			Data:    violation,
+		})
+		return "", "", false
 	}
 
 	// Update state
-	AppState.IsSimulationRunning = true
-	AppState.CurrentProfile = config.Profile
-	AppState.TargetEPS = config.TargetEPS
-	AppState.TargetKafka = config.TargetKafka
-	AppState.TargetClickHouse = config.TargetClickHouse
-	AppState.StartTime = time.Now()
-
-	response := APIResponse{
-		Success: true,
-		Message: "Simulation started successfully",
-		Data:    AppState,
+	runID, started := beginRun(config, workspace, runOwner(identity))
+	if !started {
+		response := APIResponse{
+			Success: false,
+			Message: "Simulation is already running",
+		}
+		w.Header().Set(ContentTypeHeader, ApplicationJSON)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(response)
+		return "", "", false
 	}
 
-	w.Header().Set(ContentTypeHeader, ApplicationJSON)
-	json.NewEncoder(w).Encode(response)
+	message := "Simulation started successfully"
+	if config.TemporaryTopics {
+		var topics []runs.TemporaryTopic
+		var warnings []string
+		err := fmt.Errorf("the run was not recorded, so its topics could not be torn down")
+		if runID != "" {
+			topics, warnings, err = RunTopics.Setup(runID)
+		}
+		if err != nil {
+			AppState.UpdateSimulation(func(sim *SimulationState) {
+				if sim.Running && sim.RunID == runID {
+					stopSimulation(sim, runs.StatusFailed)
+				}
+			})
+			go AppState.BroadcastUpdate()
+			logger.LogError("System", "Simulation", fmt.Sprintf("Run %s stopped, temporary topics could not be set up: %v", runID, err))
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Run stopped: temporary topics could not be set up: %v", err),
+				Data:    warnings,
+			})
+			return "", "", false
+		}
+		names := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			names = append(names, topic.Topic)
+		}
+		RunStore.AddTimelineEvent(runID, "temporary_topics_created", fmt.Sprintf("Sources write to %s", strings.Join(names, ", ")), map[string]interface{}{"topics": topics, "warnings": warnings})
+		message = fmt.Sprintf("Simulation started, sources write to %d temporary topics", len(topics))
+		if len(warnings) > 0 {
+			message += ": " + strings.Join(warnings, "; ")
+		}
+	}
 
 	// Broadcast update
 	go AppState.BroadcastUpdate()
 
 	logger.LogWithNode("System", "Simulation", fmt.Sprintf("Simulation started with profile: %s, Target EPS: %d", config.Profile, config.TargetEPS), "info")
+	return runID, message, true
 }
 
 func StopSimulation(w http.ResponseWriter, r *http.Request) {
-	AppState.Mutex.Lock()
-	defer AppState.Mutex.Unlock()
-
-	if !AppState.IsSimulationRunning {
+	stopped := false
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		if sim.Running {
+			stopSimulation(sim, runs.StatusCompleted)
+			stopped = true
+		}
+	})
+	if !stopped {
 		response := APIResponse{
 			Success: false,
 			Message: "No simulation is currently running",
@@ -84,12 +201,10 @@ func StopSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	AppState.IsSimulationRunning = false
-
 	response := APIResponse{
 		Success: true,
 		Message: "Simulation stopped successfully",
-		Data:    AppState,
+		Data:    AppState.Snapshot(),
 	}
 
 	w.Header().Set(ContentTypeHeader, ApplicationJSON)
@@ -101,22 +216,287 @@ func StopSimulation(w http.ResponseWriter, r *http.Request) {
 	logger.LogWithNode("System", "Simulation", "Simulation stopped", "info")
 }
 
-func SyncConfiguration(w http.ResponseWriter, r *http.Request) {
-	AppState.Mutex.Lock()
-	defer AppState.Mutex.Unlock()
+// beginRun marks the simulation running and records its run, unless a simulation is
+// already running. The run ID is empty if the run could not be persisted.
+func beginRun(config SimulationConfig, workspace string, owner runs.RunOwner) (string, bool) {
+	started := false
+	runID := ""
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		if sim.Running {
+			return
+		}
+		started = true
+		*sim = SimulationState{
+			Running:          true,
+			Profile:          config.Profile,
+			TargetEPS:        config.TargetEPS,
+			TargetKafka:      config.TargetKafka,
+			TargetClickHouse: config.TargetClickHouse,
+			StartTime:        timeutil.Now(),
+			DurationMinutes:  config.DurationMinutes,
+		}
 
-	// In a real implementation, this would sync with external configuration sources
-	response := APIResponse{
-		Success: true,
-		Message: "Configuration synced successfully",
-		Data: map[string]interface{}{
-			"timestamp": time.Now(),
-			"version":   AppVersion,
-		},
+		run, err := RunStore.StartRun(config.Profile, config.Scenario, config.TargetEPS, config.TargetKafka, config.TargetClickHouse, config.DurationMinutes)
+		if err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to persist run: %v", err))
+		}
+		if run != nil {
+			sim.RunID, runID = run.ID, run.ID
+			if err := RunStore.SetWorkspace(run.ID, workspace); err != nil {
+				logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record workspace of run %s: %v", run.ID, err))
+			}
+			if err := RunStore.SetOwner(run.ID, owner); err != nil {
+				logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record owner of run %s: %v", run.ID, err))
+			}
+			go collectRunStartArtifacts(run)
+		}
+	})
+	if runID != "" {
+		captureRunConfiguration(runID, config.Name)
 	}
+	return runID, started
+}
 
-	w.Header().Set(ContentTypeHeader, ApplicationJSON)
-	json.NewEncoder(w).Encode(response)
+// stopSimulation marks the simulation stopped and finishes the current run with the
+// given status; call it from AppState.UpdateSimulation
+func stopSimulation(sim *SimulationState, runStatus string) {
+	sim.Running = false
+	sim.DurationMinutes = 0
 
-	logger.LogWithNode("System", "Config", "Configuration synced", "info")
+	if sim.RunID != "" {
+		// Chaos actions are scoped to the run; revert them off the state lock
+		go Chaos.RevertRun(sim.RunID, "run stopped")
+		go RunTopics.Teardown(sim.RunID)
+		// The adaptive controller and the ramp never take the state lock while holding their own
+		Adaptive.Stop("The run ended")
+		EPSRamp.Stop("The run ended")
+
+		run, err := RunStore.FinishRun(sim.RunID, runStatus)
+		if err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to finish run %s: %v", sim.RunID, err))
+		}
+		if run != nil {
+			go collectRunEndArtifacts(run)
+		}
+		sim.RunID = ""
+	}
+}
+
+// EPSAdjustRequest is the body of PATCH /api/simulation/eps. Per-source values are
+// cluster-wide EPS and are split across enabled nodes like totalEps.
+type EPSAdjustRequest struct {
+	TotalEPS int            `json:"totalEps,omitempty"`
+	Sources  map[string]int `json:"sources,omitempty"`
+}
+
+// SourceEPSDelta describes how a source's EPS changed in a live adjustment
+type SourceEPSDelta struct {
+	PreviousEPS      int `json:"previousEps"`
+	NewEPS           int `json:"newEps"`
+	PreviousMainKeys int `json:"previousMainKeys"`
+	NewMainKeys      int `json:"newMainKeys"`
+}
+
+// epsAdjustMutex serializes live EPS adjustments
+var epsAdjustMutex sync.Mutex
+
+// EPSAdjustment is the outcome of a live EPS adjustment
+type EPSAdjustment struct {
+	RunID             string                                         `json:"runId"`
+	PreviousTargetEPS int                                            `json:"previousTargetEps,omitempty"`
+	TargetEPS         int                                            `json:"targetEps"`
+	Deltas            map[string]SourceEPSDelta                      `json:"deltas,omitempty"`
+	PushedFiles       []string                                       `json:"pushedFiles,omitempty"`
+	Distribution      map[string]o11y_source_manager.ConfDNodeResult `json:"distribution,omitempty"`
+	Reload            map[string]string                              `json:"reload,omitempty"`
+	Message           string                                         `json:"-"`
+	AllOK             bool                                           `json:"-"` // every node took the new configs
+}
+
+// AdjustSimulationEPS Handles PATCH /api/simulation/eps
+// Recomputes the EPS distribution of the active run, pushes changed source configs to
+// every enabled node and restarts running binaries so they pick up the new values.
+// Pass reload=false to only push configs, and timeout (minutes) for restarted binaries.
+func AdjustSimulationEPS(w http.ResponseWriter, r *http.Request) {
+	var request EPSAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid JSON payload"})
+		return
+	}
+	if request.TotalEPS == 0 && len(request.Sources) == 0 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{Success: false, Message: "totalEps or sources is required"})
+		return
+	}
+	if request.TotalEPS != 0 && (request.TotalEPS < 1 || request.TotalEPS > 100000) {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{Success: false, Message: "Target EPS must be between 1 and 100,000"})
+		return
+	}
+	if Adaptive.Active() {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{Success: false, Message: "The adaptive EPS controller is adjusting this run; stop it first"})
+		return
+	}
+	if EPSRamp.Active() {
+		SendJSONResponse(w, http.StatusConflict, APIResponse{Success: false, Message: "An EPS ramp is adjusting this run; stop it first"})
+		return
+	}
+	if sim := AppState.Simulation(); sim.Running && request.TotalEPS > 0 {
+		if violation := Quotas.CheckEPS(sim.RunID, request.TotalEPS); violation != nil {
+			SendJSONResponse(w, http.StatusForbidden, APIResponse{Success: false, Message: violation.Message, Data: violation})
+			return
+		}
+	}
+
+	reload := r.URL.Query().Get("reload") != "false"
+	timeout := 30
+	if timeoutStr := r.URL.Query().Get("timeout"); timeoutStr != "" {
+		if parsed, err := strconv.Atoi(timeoutStr); err == nil && parsed > 0 {
+			timeout = parsed
+		}
+	}
+
+	adjustment, status, err := adjustRunEPS(request, reload, timeout)
+	if err != nil {
+		SendJSONResponse(w, status, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	// Nodes that missed the push or the restart are reported per node in the data
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: adjustment.AllOK,
+		Message: adjustment.Message,
+		Data:    adjustment,
+	})
+}
+
+// adjustRunEPS applies a new EPS distribution to the active run. On error it also
+// returns the HTTP status that describes it.
+func adjustRunEPS(request EPSAdjustRequest, reload bool, timeout int) (*EPSAdjustment, int, error) {
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	previousTarget := sim.TargetEPS
+
+	if !running {
+		return nil, http.StatusConflict, fmt.Errorf("No simulation is currently running")
+	}
+	if !epsAdjustMutex.TryLock() {
+		return nil, http.StatusConflict, fmt.Errorf("Another EPS adjustment is in progress")
+	}
+	defer epsAdjustMutex.Unlock()
+
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to load main config: %v", err)
+	}
+	enabledSources := O11yManager.GetEnabledSources()
+	if len(enabledSources) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("No o11y sources are enabled")
+	}
+	numNodes := len(NodeManager.GetEnabledNodes())
+	if numNodes == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("No enabled nodes found")
+	}
+
+	before := O11yManager.GetSourceEPSBreakdown()
+
+	// Recompute the distribution and apply the overrides; an invalid request changes nothing
+	if _, err := O11yManager.AdjustEPS(request.TotalEPS, request.Sources); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Failed to adjust EPS: %v", err)
+	}
+
+	after := O11yManager.GetSourceEPSBreakdown()
+
+	// Only sources whose unique keys changed need to be pushed
+	deltas := make(map[string]SourceEPSDelta)
+	changedFiles := make([]string, 0)
+	for source, info := range after {
+		prev := before[source]
+		if prev.MainUniqueKeys == info.MainUniqueKeys {
+			continue
+		}
+		deltas[source] = SourceEPSDelta{
+			PreviousEPS:      prev.AssignedEPS,
+			NewEPS:           info.AssignedEPS,
+			PreviousMainKeys: prev.MainUniqueKeys,
+			NewMainKeys:      info.MainUniqueKeys,
+		}
+		changedFiles = append(changedFiles, filepath.Join(source, "conf.yml"))
+	}
+	sort.Strings(changedFiles)
+
+	newTarget := request.TotalEPS
+	if newTarget == 0 {
+		newTarget = O11yManager.CalculateCurrentEPS() * numNodes
+	}
+
+	if len(deltas) == 0 {
+		return &EPSAdjustment{
+			RunID:     runID,
+			TargetEPS: newTarget,
+			Message:   "EPS distribution unchanged, nothing to push",
+			AllOK:     true,
+		}, http.StatusOK, nil
+	}
+
+	pushResults, err := O11yManager.PushConfDFiles(changedFiles)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to push configs: %v", err)
+	}
+
+	allOK := true
+	reloadResults := make(map[string]string)
+	for nodeName, result := range pushResults {
+		if !result.Success {
+			allOK = false
+			continue
+		}
+		if !reload {
+			continue
+		}
+		resp, err := BinaryControl.RestartBinary(nodeName, timeout)
+		if err != nil {
+			allOK = false
+			reloadResults[nodeName] = fmt.Sprintf("reload failed: %v", err)
+			continue
+		}
+		reloadResults[nodeName] = resp.Message
+	}
+
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		sim.TargetEPS = newTarget
+	})
+	go AppState.BroadcastUpdate()
+
+	adjustment := &EPSAdjustment{
+		RunID:             runID,
+		PreviousTargetEPS: previousTarget,
+		TargetEPS:         newTarget,
+		Deltas:            deltas,
+		PushedFiles:       changedFiles,
+		Distribution:      pushResults,
+		Reload:            reloadResults,
+		AllOK:             allOK,
+	}
+
+	message := fmt.Sprintf("Target EPS adjusted from %d to %d (%d sources changed)", previousTarget, newTarget, len(deltas))
+	if runID != "" {
+		data := map[string]interface{}{
+			"runId":             runID,
+			"previousTargetEps": previousTarget,
+			"targetEps":         newTarget,
+			"deltas":            deltas,
+			"pushedFiles":       changedFiles,
+			"distribution":      pushResults,
+			"reload":            reloadResults,
+		}
+		if err := RunStore.AddTimelineEvent(runID, "eps_adjusted", message, data); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record EPS adjustment on run %s: %v", runID, err))
+		}
+	}
+	logger.LogWithNode("System", "Simulation", message, "info")
+
+	if !allOK {
+		message += " with errors on some nodes"
+	}
+	adjustment.Message = message
+	return adjustment, http.StatusOK, nil
 }
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Smoke test states
+const (
+	SmokeTestRunning = "running"
+	SmokeTestPassed  = "passed"
+	SmokeTestFailed  = "failed"
+)
+
+// smokeTestBudget bounds the Kafka and ClickHouse waits together, so that with the
+// configure, start and cleanup stages a smoke test finishes in under 5 minutes
+const smokeTestBudget = 240 * time.Second
+
+// smokeTestBinaryTimeout is the kill timer (in minutes) left on the node, so the binary
+// stops even if the manager dies before the cleanup stage
+const smokeTestBinaryTimeout = 5
+
+// smokeConfDDir is the manager's conf.d, whose files the smoke test changes and restores
+const smokeConfDDir = "src/migrate/conf.d"
+
+// SmokeTestConfig holds the smoke_test section of config.yaml
+type SmokeTestConfig struct {
+	Source                   string `yaml:"source" json:"source"` // empty picks the first enabled source with a topic mapping
+	Node                     string `yaml:"node" json:"node"`     // empty picks the first enabled node
+	EPS                      int    `yaml:"eps" json:"eps"`
+	KafkaTimeoutSeconds      int    `yaml:"kafka_timeout_seconds" json:"kafkaTimeoutSeconds"`
+	ClickHouseTimeoutSeconds int    `yaml:"clickhouse_timeout_seconds" json:"clickhouseTimeoutSeconds"`
+	PollSeconds              int    `yaml:"poll_seconds" json:"pollSeconds"`
+}
+
+// SmokeTestRequest is the optional body of POST /api/smoke-test
+type SmokeTestRequest struct {
+	Source string `json:"source,omitempty"`
+	Node   string `json:"node,omitempty"`
+	EPS    int    `json:"eps,omitempty"`
+}
+
+// SmokeTestResult is the stage-by-stage outcome of a smoke test
+type SmokeTestResult struct {
+	Status      string          `json:"status"`
+	Source      string          `json:"source"`
+	Node        string          `json:"node"`
+	EPS         int             `json:"eps"`
+	Topics      []string        `json:"topics"`
+	Tables      []string        `json:"tables"`
+	Stages      []LifecycleStep `json:"stages"`
+	TriggeredBy string          `json:"triggeredBy"`
+	StartedAt   time.Time       `json:"startedAt"`
+	EndedAt     *time.Time      `json:"endedAt,omitempty"`
+}
+
+// SmokeTester runs one smoke test at a time and keeps the result of the latest one
+type SmokeTester struct {
+	mutex  sync.Mutex
+	config SmokeTestConfig
+	latest *SmokeTestResult
+}
+
+var SmokeTest = &SmokeTester{config: defaultSmokeTestConfig()}
+
+func defaultSmokeTestConfig() SmokeTestConfig {
+	return SmokeTestConfig{
+		EPS:                      10,
+		KafkaTimeoutSeconds:      90,
+		ClickHouseTimeoutSeconds: 120,
+		PollSeconds:              5,
+	}
+}
+
+// LoadConfig reads the smoke_test section from the application config file
+func (st *SmokeTester) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultSmokeTestConfig()
+	fileConfig := struct {
+		SmokeTest *SmokeTestConfig `yaml:"smoke_test"`
+	}{SmokeTest: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.EPS <= 0 || config.KafkaTimeoutSeconds <= 0 || config.ClickHouseTimeoutSeconds <= 0 || config.PollSeconds <= 0 {
+		return fmt.Errorf("smoke_test.eps, the timeouts and poll_seconds must be positive")
+	}
+	if wait := time.Duration(config.KafkaTimeoutSeconds+config.ClickHouseTimeoutSeconds) * time.Second; wait > smokeTestBudget {
+		return fmt.Errorf("smoke_test timeouts add up to %s, at most %s is allowed", wait, smokeTestBudget)
+	}
+
+	st.mutex.Lock()
+	st.config = config
+	st.mutex.Unlock()
+	return nil
+}
+
+// Latest returns the running or last finished smoke test, or nil if none ran yet
+func (st *SmokeTester) Latest() *SmokeTestResult {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.latest == nil {
+		return nil
+	}
+	result := *st.latest
+	result.Stages = append([]LifecycleStep(nil), st.latest.Stages...)
+	return &result
+}
+
+// smokeTestPlan is what the preflight resolved for a smoke test
+type smokeTestPlan struct {
+	config SmokeTestConfig
+	source string
+	node   string
+	eps    int
+	topics []string
+	tables []string
+}
+
+// Start runs the preflight checks and then the remaining stages in the background.
+// The returned status code tells why a smoke test could not start.
+func (st *SmokeTester) Start(req SmokeTestRequest, triggeredBy string) (*SmokeTestResult, int, error) {
+	st.mutex.Lock()
+	if st.latest != nil && st.latest.Status == SmokeTestRunning {
+		st.mutex.Unlock()
+		return nil, http.StatusConflict, fmt.Errorf("a smoke test is already running")
+	}
+	config := st.config
+	result := &SmokeTestResult{
+		Status:      SmokeTestRunning,
+		Stages:      []LifecycleStep{},
+		TriggeredBy: triggeredBy,
+		StartedAt:   timeutil.Now(),
+	}
+	st.latest = result
+	st.mutex.Unlock()
+
+	start := time.Now()
+	plan, code, err := preflightSmokeTest(config, req)
+	stage := LifecycleStep{Name: "preflight", Status: StepOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		stage.Status = StepFailed
+		stage.Message = err.Error()
+		st.update(func(r *SmokeTestResult) {
+			r.Stages = append(r.Stages, stage)
+			st.finishLocked(r)
+		})
+		return st.Latest(), code, err
+	}
+	stage.Message = fmt.Sprintf("Testing source %s on node %s at %d EPS", plan.source, plan.node, plan.eps)
+	st.update(func(r *SmokeTestResult) {
+		r.Source, r.Node, r.EPS = plan.source, plan.node, plan.eps
+		r.Topics, r.Tables = plan.topics, plan.tables
+		r.Stages = append(r.Stages, stage)
+	})
+
+	logger.LogWithNode(plan.node, "SmokeTest", stage.Message, "info")
+	go st.run(plan)
+	return st.Latest(), http.StatusAccepted, nil
+}
+
+// preflightSmokeTest picks the source and node and checks nothing else uses them
+func preflightSmokeTest(config SmokeTestConfig, req SmokeTestRequest) (*smokeTestPlan, int, error) {
+	if AppState.Simulation().Running {
+		return nil, http.StatusConflict, fmt.Errorf("a simulation is running; stop it before running a smoke test")
+	}
+	if topicMapping == nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("topics_tables.yaml mapping not loaded")
+	}
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to load conf.yml: %v", err)
+	}
+
+	plan := &smokeTestPlan{config: config, source: req.Source, node: req.Node, eps: req.EPS}
+	if plan.source == "" {
+		plan.source = config.Source
+	}
+	if plan.source == "" {
+		enabled := O11yManager.GetEnabledSources()
+		sort.Strings(enabled)
+		for _, source := range enabled {
+			if topicConfig, ok := topicMapping.SourceConfig(source); ok && len(topicConfig.InputTopic) > 0 && len(topicConfig.ClickhouseTables) > 0 {
+				plan.source = source
+				break
+			}
+		}
+		if plan.source == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("no enabled source has a topic and tables in topics_tables.yaml; pass a source")
+		}
+	}
+	if !O11yManager.IsKnownSource(plan.source) {
+		return nil, http.StatusBadRequest, fmt.Errorf("source %s not found", plan.source)
+	}
+	topicConfig, ok := topicMapping.SourceConfig(plan.source)
+	if !ok || len(topicConfig.InputTopic) == 0 || len(topicConfig.ClickhouseTables) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("source %s has no input topic or ClickHouse tables in topics_tables.yaml", plan.source)
+	}
+	for _, topic := range topicConfig.InputTopic {
+		plan.topics = append(plan.topics, topic.Name)
+	}
+	plan.tables = topicConfig.ClickhouseTables
+
+	if plan.eps == 0 {
+		plan.eps = config.EPS
+	}
+	if maxEPS := O11yManager.GetMaxEPSConfig()[plan.source]; plan.eps <= 0 || plan.eps > maxEPS {
+		return nil, http.StatusBadRequest, fmt.Errorf("EPS must be between 1 and %d for source %s", maxEPS, plan.source)
+	}
+
+	if err := BinaryControl.LoadNodesConfig(); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to load nodes: %v", err)
+	}
+	enabledNodes := BinaryControl.GetEnabledNodes()
+	if plan.node == "" {
+		plan.node = config.Node
+	}
+	if plan.node == "" {
+		names := make([]string, 0, len(enabledNodes))
+		for name := range enabledNodes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("no enabled nodes")
+		}
+		plan.node = names[0]
+	}
+	if _, ok := enabledNodes[plan.node]; !ok {
+		return nil, http.StatusBadRequest, fmt.Errorf("node %s not found or not enabled", plan.node)
+	}
+	status, err := BinaryControl.GetBinaryStatus(plan.node)
+	if err != nil {
+		return nil, http.StatusBadGateway, fmt.Errorf("failed to check the binary on node %s: %v", plan.node, err)
+	}
+	if status.Status == "running" {
+		return nil, http.StatusConflict, fmt.Errorf("the binary is already running on node %s (PID %d)", plan.node, status.PID)
+	}
+	return plan, http.StatusAccepted, nil
+}
+
+// update changes the latest result under the lock
+func (st *SmokeTester) update(change func(*SmokeTestResult)) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	change(st.latest)
+}
+
+// finishLocked sets the verdict from the stages; the caller holds the lock
+func (st *SmokeTester) finishLocked(result *SmokeTestResult) {
+	result.Status = SmokeTestPassed
+	for _, stage := range result.Stages {
+		if stage.Status == StepFailed {
+			result.Status = SmokeTestFailed
+		}
+	}
+	now := timeutil.Now()
+	result.EndedAt = &now
+}
+
+// stage runs one stage and records it; after a failed stage the others are skipped
+func (st *SmokeTester) stage(name string, failed *bool, run func() (string, interface{}, error)) {
+	entry := LifecycleStep{Name: name, Status: StepSkipped, Message: "skipped after an earlier stage failed"}
+	if !*failed {
+		start := time.Now()
+		message, details, err := run()
+		entry = LifecycleStep{Name: name, Status: StepOK, Message: message, Details: details, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			entry.Status = StepFailed
+			entry.Message = err.Error()
+			*failed = true
+		}
+	}
+	st.update(func(r *SmokeTestResult) { r.Stages = append(r.Stages, entry) })
+}
+
+// run configures the source on the node, starts the binary, waits for messages in Kafka
+// and rows in ClickHouse, and always cleans up what it changed
+func (st *SmokeTester) run(plan *smokeTestPlan) {
+	confFiles := []string{"conf.yml", filepath.Join(plan.source, "conf.yml")}
+	var saved map[string][]byte
+	started := false
+	failed := false
+	var baselineOffset int64
+	var baselineRows uint64
+
+	st.stage("configure", &failed, func() (string, interface{}, error) {
+		var err error
+		if saved, err = readConfDFiles(confFiles); err != nil {
+			return "", nil, err
+		}
+		for _, source := range O11yManager.GetEnabledSources() {
+			if source != plan.source {
+				if err := O11yManager.DisableSource(source); err != nil {
+					return "", nil, fmt.Errorf("failed to disable source %s: %v", source, err)
+				}
+			}
+		}
+		if err := O11yManager.EnableSource(plan.source); err != nil {
+			return "", nil, fmt.Errorf("failed to enable source %s: %v", plan.source, err)
+		}
+		if _, err := O11yManager.ApplySourceEPS(map[string]int{plan.source: plan.eps}); err != nil {
+			return "", nil, err
+		}
+		result, err := O11yManager.PushConfDFilesToNode(plan.node, confFiles)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to push conf.d to node %s: %v", plan.node, err)
+		}
+		return fmt.Sprintf("Only %s enabled at %d EPS on node %s", plan.source, plan.eps, plan.node), result, nil
+	})
+
+	st.stage("start_binary", &failed, func() (string, interface{}, error) {
+		offset, err := smokeTestOffsets(plan.topics)
+		if err != nil {
+			return "", nil, err
+		}
+		rows, err := smokeTestRows(plan.tables)
+		if err != nil {
+			return "", nil, err
+		}
+		baselineOffset, baselineRows = offset, rows
+
+		response, err := BinaryControl.StartBinary(plan.node, smokeTestBinaryTimeout)
+		if err != nil {
+			return "", response, fmt.Errorf("failed to start the binary on node %s: %v", plan.node, err)
+		}
+		started = true
+		return response.Message, map[string]interface{}{"baselineOffset": offset, "baselineRows": rows}, nil
+	})
+
+	st.stage("kafka", &failed, func() (string, interface{}, error) {
+		var offset int64
+		waited, err := pollSmokeTest(plan.config.KafkaTimeoutSeconds, plan.config.PollSeconds, func() (bool, error) {
+			var err error
+			offset, err = smokeTestOffsets(plan.topics)
+			return offset > baselineOffset, err
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("no messages reached %s: %v", strings.Join(plan.topics, ", "), err)
+		}
+		return fmt.Sprintf("%d messages reached %s after %s", offset-baselineOffset, strings.Join(plan.topics, ", "), waited),
+			map[string]interface{}{"messages": offset - baselineOffset}, nil
+	})
+
+	st.stage("clickhouse", &failed, func() (string, interface{}, error) {
+		var rows uint64
+		waited, err := pollSmokeTest(plan.config.ClickHouseTimeoutSeconds, plan.config.PollSeconds, func() (bool, error) {
+			var err error
+			rows, err = smokeTestRows(plan.tables)
+			return rows > baselineRows, err
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("no rows landed in %s: %v", strings.Join(plan.tables, ", "), err)
+		}
+		return fmt.Sprintf("%d rows landed in ClickHouse after %s", rows-baselineRows, waited),
+			map[string]interface{}{"rows": rows - baselineRows}, nil
+	})
+
+	// Cleanup runs whatever happened before, undoing only what was changed
+	cleanupFailed := false
+	st.stage("cleanup", &cleanupFailed, func() (string, interface{}, error) {
+		var problems []string
+		if started {
+			if _, err := BinaryControl.StopBinary(plan.node, 30); err != nil {
+				problems = append(problems, fmt.Sprintf("failed to stop the binary: %v", err))
+			}
+		}
+		if saved != nil {
+			if err := restoreConfDFiles(saved); err != nil {
+				problems = append(problems, err.Error())
+			} else {
+				if err := O11yManager.LoadMainConfig(); err != nil {
+					problems = append(problems, fmt.Sprintf("failed to reload conf.yml: %v", err))
+				}
+				if _, err := O11yManager.PushConfDFilesToNode(plan.node, confFiles); err != nil {
+					problems = append(problems, fmt.Sprintf("failed to push the restored conf.d to node %s: %v", plan.node, err))
+				}
+			}
+		}
+		if len(problems) > 0 {
+			return "", nil, fmt.Errorf("%s", strings.Join(problems, "; "))
+		}
+		return "Binary stopped and conf.d restored", nil, nil
+	})
+
+	var status string
+	st.update(func(r *SmokeTestResult) {
+		st.finishLocked(r)
+		status = r.Status
+	})
+	message := fmt.Sprintf("Smoke test of %s on node %s %s", plan.source, plan.node, status)
+	if status == SmokeTestPassed {
+		logger.LogSuccess(plan.node, "SmokeTest", message)
+	} else {
+		logger.LogError(plan.node, "SmokeTest", message)
+	}
+}
+
+// pollSmokeTest calls check every poll seconds until it reports true or the timeout
+// passes, returning how long it waited
+func pollSmokeTest(timeoutSeconds, pollSeconds int, check func() (bool, error)) (time.Duration, error) {
+	start := time.Now()
+	deadline := start.Add(time.Duration(timeoutSeconds) * time.Second)
+	var lastErr error
+	for {
+		done, err := check()
+		if err == nil && done {
+			return time.Since(start).Round(time.Second), nil
+		}
+		lastErr = err
+		if time.Now().Add(time.Duration(pollSeconds) * time.Second).After(deadline) {
+			break
+		}
+		time.Sleep(time.Duration(pollSeconds) * time.Second)
+	}
+	if lastErr != nil {
+		return 0, fmt.Errorf("timed out after %ds: %v", timeoutSeconds, lastErr)
+	}
+	return 0, fmt.Errorf("timed out after %ds", timeoutSeconds)
+}
+
+// smokeTestOffsets sums the end offsets of the source's input topics
+func smokeTestOffsets(topics []string) (int64, error) {
+	var total int64
+	for _, topic := range topics {
+		offset, err := topicMapping.TopicEndOffset(topic)
+		if err != nil {
+			return 0, err
+		}
+		total += offset
+	}
+	return total, nil
+}
+
+// smokeTestRows sums the row counts of the source's tables
+func smokeTestRows(tables []string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	counts, err := clickhouse.TableRowCounts(ctx, tables)
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
+}
+
+// readConfDFiles keeps the contents of conf.d files so they can be restored
+func readConfDFiles(relPaths []string) (map[string][]byte, error) {
+	saved := make(map[string][]byte, len(relPaths))
+	for _, relPath := range relPaths {
+		data, err := os.ReadFile(filepath.Join(smokeConfDDir, relPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", relPath, err)
+		}
+		saved[relPath] = data
+	}
+	return saved, nil
+}
+
+// restoreConfDFiles writes back the files kept by readConfDFiles
+func restoreConfDFiles(saved map[string][]byte) error {
+	for relPath, data := range saved {
+		if err := os.WriteFile(filepath.Join(smokeConfDDir, relPath), data, 0644); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", relPath, err)
+		}
+	}
+	return nil
+}
+
+// HandleAPIStartSmokeTest Handles POST /api/smoke-test
+// Body (optional): {"source": "linux", "node": "node1", "eps": 10}. Returns 202 after the
+// preflight; poll GET /api/smoke-test for the stages.
+func HandleAPIStartSmokeTest(w http.ResponseWriter, r *http.Request) {
+	var req SmokeTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	result, code, err := SmokeTest.Start(req, auth.Describe(r.Context()))
+	if err != nil {
+		SendJSONResponse(w, code, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Smoke test not started: %v", err),
+			Data:    result,
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Smoke test of %s started on node %s", result.Source, result.Node),
+		Data:    result,
+	})
+}
+
+// HandleAPIGetSmokeTest Handles GET /api/smoke-test
+func HandleAPIGetSmokeTest(w http.ResponseWriter, r *http.Request) {
+	result := SmokeTest.Latest()
+	if result == nil {
+		SendJSONResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "No smoke test has run yet",
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Smoke test %s", result.Status),
+		Data:    result,
+	})
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// Lifecycle step statuses
+const (
+	StepOK      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+// SourceLifecycleOptions selects the optional steps of an enable or disable. Without
+// any option only the conf.yml flag is flipped.
+type SourceLifecycleOptions struct {
+	// Enable: create input/output topics that do not exist yet
+	CreateTopics      bool `json:"createTopics"`
+	Partitions        int  `json:"partitions"`
+	ReplicationFactor int  `json:"replicationFactor"`
+	// Enable: fail before pushing anything if a ClickHouse table is missing
+	VerifyTables bool `json:"verifyTables"`
+	// Push conf.d to all enabled nodes
+	PushConfD bool `json:"pushConfD"`
+	// Restart simulators that are currently running, so they pick up the change
+	RestartBinaries bool `json:"restartBinaries"`
+	Timeout         int  `json:"timeout"`
+	// Disable: delete topics and truncate tables not shared with another source
+	DeleteTopics   bool `json:"deleteTopics"`
+	TruncateTables bool `json:"truncateTables"`
+	// Required for DeleteTopics or TruncateTables in a protected environment
+	Justification string `json:"justification"`
+	// Change the source although a simulation is running, see guardActiveRun
+	Force bool `json:"force"`
+}
+
+// LifecycleStep is the outcome of one step of an enable or disable
+type LifecycleStep struct {
+	Name       string      `json:"name"`
+	Status     string      `json:"status"`
+	Message    string      `json:"message"`
+	DurationMs int64       `json:"durationMs"`
+	Details    interface{} `json:"details,omitempty"`
+}
+
+// SourceLifecycleResult is the step-by-step result of an enable or disable
+type SourceLifecycleResult struct {
+	Source  string          `json:"source"`
+	Action  string          `json:"action"`
+	Success bool            `json:"success"`
+	Steps   []LifecycleStep `json:"steps"`
+}
+
+// run executes a step unless it was not requested or an earlier step failed
+func (res *SourceLifecycleResult) run(name string, requested bool, step func() (string, interface{}, error)) {
+	if !requested {
+		res.Steps = append(res.Steps, LifecycleStep{Name: name, Status: StepSkipped, Message: "not requested"})
+		return
+	}
+	if !res.Success {
+		res.Steps = append(res.Steps, LifecycleStep{Name: name, Status: StepSkipped, Message: "skipped after an earlier step failed"})
+		return
+	}
+
+	start := time.Now()
+	message, details, err := step()
+	entry := LifecycleStep{Name: name, Status: StepOK, Message: message, Details: details, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		entry.Status = StepFailed
+		entry.Message = err.Error()
+		res.Success = false
+	}
+	res.Steps = append(res.Steps, entry)
+}
+
+// EnableSource handles POST /api/o11y/sources/{source}/enable - enables a source and
+// optionally creates its topics, verifies its tables, pushes conf.d and restarts simulators
+func (kh *KafkaHandler) EnableSource(w http.ResponseWriter, r *http.Request) {
+	kh.changeSourceState(w, r, true)
+}
+
+// DisableSource handles POST /api/o11y/sources/{source}/disable - disables a source and
+// optionally pushes conf.d, restarts simulators and cleans up its topics and tables
+func (kh *KafkaHandler) DisableSource(w http.ResponseWriter, r *http.Request) {
+	kh.changeSourceState(w, r, false)
+}
+
+func (kh *KafkaHandler) changeSourceState(w http.ResponseWriter, r *http.Request, enable bool) {
+	sourceName := mux.Vars(r)["source"]
+	if sourceName == "" {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Source name is required",
+		})
+		return
+	}
+
+	var opts SourceLifecycleOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+		sendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid JSON payload",
+		})
+		return
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60
+	}
+
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	if !enable && running && (opts.DeleteTopics || opts.TruncateTables) && !(opts.PushConfD && opts.RestartBinaries) {
+		// Simulators would keep producing into the topics that are being removed
+		sendJSONResponse(w, http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "Cleaning up topics or tables during a run requires pushConfD and restartBinaries",
+		})
+		return
+	}
+
+	if running && sourceEnabled(sourceName) != enable {
+		change := fmt.Sprintf("disable source %s", sourceName)
+		impact := fmt.Sprintf("the simulators stop generating %s events once they pick up conf.d, so its topics and tables stop receiving data mid-run", sourceName)
+		if enable {
+			change = fmt.Sprintf("enable source %s", sourceName)
+			impact = fmt.Sprintf("the simulators add %s events once they pick up conf.d, so the run's load no longer matches its profile", sourceName)
+		}
+		if !guardActiveRun(w, r, change, impact, opts.Force) {
+			return
+		}
+	}
+
+	if !enable && (opts.DeleteTopics || opts.TruncateTables) {
+		details := map[string]interface{}{"deleteTopics": opts.DeleteTopics, "truncateTables": opts.TruncateTables}
+		if !Environment.AuthorizeDestructive(w, r, DestructiveDisableCleanup, sourceName, opts.Justification, details) {
+			return
+		}
+	}
+
+	action := "disable"
+	if enable {
+		action = "enable"
+	}
+	result := &SourceLifecycleResult{Source: sourceName, Action: action, Success: true}
+	topicConfig, mapped := kh.kafkaManager.SourceConfig(sourceName)
+	needsMapping := opts.CreateTopics || opts.VerifyTables || opts.DeleteTopics || opts.TruncateTables
+
+	result.run("update_conf", true, func() (string, interface{}, error) {
+		if needsMapping && !mapped {
+			return "", nil, fmt.Errorf("source %s has no entry in topics_tables.yaml", sourceName)
+		}
+		var err error
+		if enable {
+			err = O11yManager.EnableSource(sourceName)
+		} else {
+			err = O11yManager.DisableSource(sourceName)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("Source %s %sd in conf.yml", sourceName, action), nil, nil
+	})
+
+	if enable {
+		result.run("create_topics", opts.CreateTopics, func() (string, interface{}, error) {
+			return kh.createSourceTopics(topicConfig, opts)
+		})
+		result.run("verify_tables", opts.VerifyTables, func() (string, interface{}, error) {
+			ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+			defer cancel()
+			missing, err := clickhouse.MissingTables(ctx, topicConfig.ClickhouseTables)
+			if err != nil {
+				return "", nil, err
+			}
+			if len(missing) > 0 {
+				return "", nil, fmt.Errorf("missing ClickHouse tables: %s", strings.Join(missing, ", "))
+			}
+			return fmt.Sprintf("All %d ClickHouse tables exist", len(topicConfig.ClickhouseTables)), topicConfig.ClickhouseTables, nil
+		})
+	}
+
+	result.run("push_confd", opts.PushConfD, func() (string, interface{}, error) {
+		if lint, err := ConfDLint.BeforeDistribution(false); err != nil {
+			return "", lint, err
+		}
+		response, err := O11yManager.DistributeConfD()
+		if err != nil {
+			return "", nil, err
+		}
+		if !response.Success {
+			return "", response.Distribution, fmt.Errorf("%s", response.Message)
+		}
+		return response.Message, response.Distribution, nil
+	})
+
+	result.run("restart_binaries", opts.RestartBinaries, func() (string, interface{}, error) {
+		restarted := make(map[string]string)
+		var failed []string
+		for nodeName := range NodeManager.GetEnabledNodes() {
+			resp, err := BinaryControl.RestartBinary(nodeName, opts.Timeout)
+			if err != nil {
+				restarted[nodeName] = fmt.Sprintf("failed: %v", err)
+				failed = append(failed, nodeName)
+				continue
+			}
+			restarted[nodeName] = resp.Message
+		}
+		if len(failed) > 0 {
+			sort.Strings(failed)
+			return "", restarted, fmt.Errorf("restart failed on %s", strings.Join(failed, ", "))
+		}
+		return fmt.Sprintf("Restarted running simulators on %d nodes", len(restarted)), restarted, nil
+	})
+
+	if !enable {
+		sharedTopics, sharedTables := kh.sharedResources(topicConfig.Name)
+		result.run("delete_topics", opts.DeleteTopics, func() (string, interface{}, error) {
+			outcome := make(map[string]string)
+			var failed []string
+			for _, topic := range sourceTopics(topicConfig) {
+				if sharedTopics[topic] {
+					outcome[topic] = "kept, shared with another source"
+					continue
+				}
+				if err := kh.kafkaManager.DeleteTopic(topic); err != nil {
+					outcome[topic] = err.Error()
+					failed = append(failed, topic)
+					continue
+				}
+				outcome[topic] = "deleted"
+			}
+			if len(failed) > 0 {
+				return "", outcome, fmt.Errorf("failed to delete %s", strings.Join(failed, ", "))
+			}
+			return fmt.Sprintf("Processed %d topics", len(outcome)), outcome, nil
+		})
+		result.run("truncate_tables", opts.TruncateTables, func() (string, interface{}, error) {
+			outcome := make(map[string]string)
+			var failed []string
+			for _, table := range topicConfig.ClickhouseTables {
+				if sharedTables[table] {
+					outcome[table] = "kept, shared with another source"
+					continue
+				}
+				if err := kh.kafkaManager.TruncateTable(table); err != nil {
+					outcome[table] = err.Error()
+					failed = append(failed, table)
+					continue
+				}
+				outcome[table] = "truncated"
+			}
+			if len(failed) > 0 {
+				return "", outcome, fmt.Errorf("failed to truncate %s", strings.Join(failed, ", "))
+			}
+			return fmt.Sprintf("Processed %d tables", len(outcome)), outcome, nil
+		})
+	}
+
+	var ran []string
+	for _, step := range result.Steps {
+		if step.Status != StepSkipped {
+			ran = append(ran, fmt.Sprintf("%s=%s", step.Name, step.Status))
+		}
+	}
+	message := fmt.Sprintf("Source %s %s by %s: %s", sourceName, action, auth.Describe(r.Context()), strings.Join(ran, ", "))
+	if result.Success {
+		logger.LogSuccess("System", "O11y", message)
+	} else {
+		logger.LogWarning("System", "O11y", message)
+	}
+	if running && runID != "" {
+		if err := RunStore.AddTimelineEvent(runID, "source_"+action+"d", message, map[string]interface{}{"source": sourceName, "steps": result.Steps}); err != nil {
+			logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record source change on run %s: %v", runID, err))
+		}
+	}
+
+	status := http.StatusOK
+	message = fmt.Sprintf("Source %s %sd successfully", sourceName, action)
+	switch {
+	case result.Steps[0].Status == StepFailed:
+		status = http.StatusInternalServerError
+		message = result.Steps[0].Message
+	case !result.Success:
+		status = http.StatusPartialContent
+		message = fmt.Sprintf("Source %s %sd, but a follow-up step failed", sourceName, action)
+	}
+	sendJSONResponse(w, status, APIResponse{
+		Success: result.Success,
+		Message: message,
+		Data:    result,
+	})
+}
+
+// sourceEnabled reports whether the source is enabled in conf.yml
+func sourceEnabled(sourceName string) bool {
+	for _, name := range O11yManager.GetEnabledSources() {
+		if name == sourceName {
+			return true
+		}
+	}
+	return false
+}
+
+// createSourceTopics creates the source's input and output topics that do not exist yet
+func (kh *KafkaHandler) createSourceTopics(topicConfig kafka_ch_reset.TopicConfig, opts SourceLifecycleOptions) (string, interface{}, error) {
+	partitions, replication := opts.Partitions, opts.ReplicationFactor
+	if partitions <= 0 {
+		partitions = 1
+	}
+	if replication <= 0 {
+		replication = 1
+	}
+
+	outcome := make(map[string]string)
+	created := 0
+	for _, topic := range sourceTopics(topicConfig) {
+		if _, err := kh.kafkaManager.DescribeTopic(topic); err == nil {
+			outcome[topic] = "exists"
+			continue
+		}
+		if err := kh.kafkaManager.CreateTopic(topic, partitions, replication); err != nil {
+			outcome[topic] = err.Error()
+			return "", outcome, err
+		}
+		outcome[topic] = "created"
+		created++
+	}
+	return fmt.Sprintf("Created %d of %d topics", created, len(outcome)), outcome, nil
+}
+
+// sharedResources returns the topics and tables also used by sources other than sourceName
+func (kh *KafkaHandler) sharedResources(sourceName string) (map[string]bool, map[string]bool) {
+	topics := make(map[string]bool)
+	tables := make(map[string]bool)
+	for _, other := range kh.kafkaManager.GetAllTopics() {
+		if other.Name == sourceName {
+			continue
+		}
+		for _, topic := range sourceTopics(other) {
+			topics[topic] = true
+		}
+		for _, table := range other.ClickhouseTables {
+			tables[table] = true
+		}
+	}
+	return topics, tables
+}
+
+// sourceTopics lists the input and output topics of a source without duplicates
+func sourceTopics(topicConfig kafka_ch_reset.TopicConfig) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, topic := range append(append([]kafka_ch_reset.TopicName{}, topicConfig.InputTopic...), topicConfig.OutputTopic...) {
+		if !seen[topic.Name] {
+			seen[topic.Name] = true
+			names = append(names, topic.Name)
+		}
+	}
+	return names
+}
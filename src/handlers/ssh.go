@@ -3,11 +3,14 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"vuDataSim/src/logger"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/timeutil"
 )
 
 // SSHHandler handles SSH-related HTTP requests
@@ -34,11 +37,20 @@ func (h *SSHHandler) GetSSHStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var allStatuses []SSHStatus
-	for nodeName, nodeConfig := range enabledNodes {
-		status := h.CheckSSHConnectivity(nodeName, nodeConfig)
-		allStatuses = append(allStatuses, status)
+	// Check the nodes in parallel over the SSH connection pool
+	nodeNames := make([]string, 0, len(enabledNodes))
+	for nodeName := range enabledNodes {
+		nodeNames = append(nodeNames, nodeName)
 	}
+	var mutex sync.Mutex
+	allStatuses := make([]SSHStatus, 0, len(nodeNames))
+	node_control.FanOut(nodeNames, func(nodeName string) {
+		status := h.CheckSSHConnectivity(nodeName, enabledNodes[nodeName])
+		mutex.Lock()
+		allStatuses = append(allStatuses, status)
+		mutex.Unlock()
+	})
+	sort.Slice(allStatuses, func(i, j int) bool { return allStatuses[i].NodeName < allStatuses[j].NodeName })
 
 	SendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
@@ -51,7 +63,7 @@ func (h *SSHHandler) GetSSHStatus(w http.ResponseWriter, r *http.Request) {
 func (h *SSHHandler) CheckSSHConnectivity(nodeName string, nodeConfig node_control.NodeConfig) SSHStatus {
 	status := SSHStatus{
 		NodeName:    nodeName,
-		LastChecked: time.Now().Format("2006-01-02 15:04:05"),
+		LastChecked: timeutil.Format(time.Now()),
 	}
 
 	// Test SSH connection with a simple command
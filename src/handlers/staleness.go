@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/node_control"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultStaleAfterSeconds is how old a metric sample may be before it is flagged stale
+const defaultStaleAfterSeconds = 120
+
+// StalenessConfig holds the metrics section of config.yaml
+type StalenessConfig struct {
+	StaleAfterSeconds int `yaml:"stale_after_seconds" json:"staleAfterSeconds"`
+}
+
+// MetricStaleness flags metric samples that stopped updating, e.g. after a collector stall
+type MetricStaleness struct {
+	mutex  sync.RWMutex
+	config StalenessConfig
+}
+
+var Staleness = &MetricStaleness{
+	config: StalenessConfig{StaleAfterSeconds: defaultStaleAfterSeconds},
+}
+
+// LoadConfig reads the metrics section from the application config file
+func (ms *MetricStaleness) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := StalenessConfig{StaleAfterSeconds: defaultStaleAfterSeconds}
+	fileConfig := struct {
+		Metrics *StalenessConfig `yaml:"metrics"`
+	}{Metrics: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.StaleAfterSeconds <= 0 {
+		config.StaleAfterSeconds = defaultStaleAfterSeconds
+	}
+
+	ms.mutex.Lock()
+	ms.config = config
+	ms.mutex.Unlock()
+	return nil
+}
+
+// Threshold returns the configured staleness threshold
+func (ms *MetricStaleness) Threshold() time.Duration {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	return time.Duration(ms.config.StaleAfterSeconds) * time.Second
+}
+
+// Evaluate returns the age of a sample taken at sampledAt as of now and whether it is
+// stale. A sample that was never taken (zero time) is stale with an unknown age.
+func (ms *MetricStaleness) Evaluate(sampledAt, now time.Time) (*float64, bool) {
+	if sampledAt.IsZero() {
+		return nil, true
+	}
+	age := now.Sub(sampledAt)
+	if age < 0 {
+		// Clock skew between the manager and the metric source
+		age = 0
+	}
+	seconds := math.Round(age.Seconds()*10) / 10
+	return &seconds, age > ms.Threshold()
+}
+
+// FleetSummary aggregates node metrics over the nodes with fresh data only
+type FleetSummary struct {
+	Nodes             int      `json:"nodes"`
+	FreshNodes        int      `json:"freshNodes"`
+	StaleNodes        []string `json:"staleNodes"`
+	TotalEPS          int      `json:"totalEps"`
+	GeneratorEPS      int      `json:"generatorEps"`        // part of TotalEPS from generators besides finalvudatasim
+	AvgCPU            *float64 `json:"avgCpu,omitempty"`    // nil when no node is fresh
+	AvgMemory         *float64 `json:"avgMemory,omitempty"` // nil when no node is fresh
+	StaleAfterSeconds int      `json:"staleAfterSeconds"`
+}
+
+// summarizeFleet flags stale entries in nodeData and aggregates the fresh active ones
+func summarizeFleet(nodeData map[string]*node_control.NodeMetrics, now time.Time) *FleetSummary {
+	summary := &FleetSummary{
+		StaleNodes:        []string{},
+		StaleAfterSeconds: int(Staleness.Threshold() / time.Second),
+	}
+
+	var cpuSum, memorySum float64
+	for name, node := range nodeData {
+		node.AgeSeconds, node.Stale = Staleness.Evaluate(node.LastUpdate, now)
+		if node.Status != "active" {
+			continue
+		}
+		summary.Nodes++
+		// Generator EPS is polled by the manager, so it does not go stale with the agent
+		for _, eps := range node.GeneratorEPS {
+			summary.GeneratorEPS += eps
+			summary.TotalEPS += eps
+		}
+		if node.Stale {
+			summary.StaleNodes = append(summary.StaleNodes, name)
+			continue
+		}
+		summary.FreshNodes++
+		summary.TotalEPS += node.EPS
+		cpuSum += node.CPU
+		memorySum += node.Memory
+	}
+
+	sort.Strings(summary.StaleNodes)
+
+	if summary.FreshNodes > 0 {
+		avgCPU := cpuSum / float64(summary.FreshNodes)
+		avgMemory := memorySum / float64(summary.FreshNodes)
+		summary.AvgCPU = &avgCPU
+		summary.AvgMemory = &avgMemory
+	}
+	return summary
+}
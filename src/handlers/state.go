@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"time"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/timeutil"
+
+	"github.com/gorilla/websocket"
+)
+
+// SimulationState describes the current simulation
+type SimulationState struct {
+	Running          bool      `json:"isSimulationRunning"`
+	Profile          string    `json:"currentProfile"`
+	TargetEPS        int       `json:"targetEps"`
+	TargetKafka      int       `json:"targetKafka"`
+	TargetClickHouse int       `json:"targetClickHouse"`
+	StartTime        time.Time `json:"startTime"`
+	DurationMinutes  int       `json:"durationMinutes,omitempty"`
+	RunID            string    `json:"currentRunId,omitempty"`
+}
+
+// StateSnapshot is a copy of the application state taken under the state lock. It is
+// what the dashboard and WebSocket clients receive and can be read without the lock.
+type StateSnapshot struct {
+	SimulationState
+	NodeData map[string]*node_control.NodeMetrics `json:"nodeData"`
+	Fleet    *FleetSummary                        `json:"fleet,omitempty"`
+	// Maintenance lists the active maintenance windows, for the dashboard badge
+	Maintenance []MaintenanceWindow `json:"maintenance,omitempty"`
+}
+
+// AppStates holds the simulation, node metrics and WebSocket clients shared by the
+// handlers. Its fields are only reachable through methods that take the lock: reads
+// return copies and changes are made in callbacks that run under the lock.
+type AppStates struct {
+	mutex      sync.RWMutex
+	simulation SimulationState
+	nodeData   map[string]*node_control.NodeMetrics
+	fleet      *FleetSummary
+	clients    map[*websocket.Conn]*wsClient
+}
+
+// wsClientBuffer is how many messages may wait for a slow WebSocket client before it
+// is dropped
+const wsClientBuffer = 64
+
+// wsClient queues the messages of one WebSocket connection for its single writer, as a
+// connection allows only one concurrent writer
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+var AppState = NewAppState()
+
+// NewAppState creates the state of an idle manager with the default targets
+func NewAppState() *AppStates {
+	return &AppStates{
+		simulation: SimulationState{
+			Profile:          "medium",
+			TargetEPS:        10000,
+			TargetKafka:      5000,
+			TargetClickHouse: 2000,
+		},
+		nodeData: make(map[string]*node_control.NodeMetrics),
+		clients:  make(map[*websocket.Conn]*wsClient),
+	}
+}
+
+// Simulation returns a copy of the simulation state
+func (s *AppStates) Simulation() SimulationState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.simulation
+}
+
+// UpdateSimulation calls update with the simulation state under the write lock, so a
+// check and the change it guards happen atomically. update must not call other
+// AppState methods.
+func (s *AppStates) UpdateSimulation(update func(sim *SimulationState)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(&s.simulation)
+}
+
+// Snapshot returns a copy of the whole state for serialization
+func (s *AppStates) Snapshot() StateSnapshot {
+	// Maintenance has a lock of its own, which is not taken under the state lock
+	maintenance := Maintenance.Active(timeutil.Now())
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.snapshotLocked(maintenance)
+}
+
+func (s *AppStates) snapshotLocked(maintenance []MaintenanceWindow) StateSnapshot {
+	nodeData := make(map[string]*node_control.NodeMetrics, len(s.nodeData))
+	for name, node := range s.nodeData {
+		copied := *node
+		nodeData[name] = &copied
+	}
+	return StateSnapshot{SimulationState: s.simulation, NodeData: nodeData, Fleet: s.fleet, Maintenance: maintenance}
+}
+
+// Node returns a copy of the last metrics of a node
+func (s *AppStates) Node(name string) (node_control.NodeMetrics, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	node, ok := s.nodeData[name]
+	if !ok {
+		return node_control.NodeMetrics{}, false
+	}
+	return *node, true
+}
+
+// UpdateNode calls update with the metrics of a node under the write lock and returns a
+// copy of the result. A node the dashboard has not seen yet is added when create is
+// set; otherwise UpdateNode reports false.
+func (s *AppStates) UpdateNode(name string, create bool, update func(node *node_control.NodeMetrics)) (node_control.NodeMetrics, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	node, ok := s.nodeData[name]
+	if !ok {
+		if !create {
+			return node_control.NodeMetrics{}, false
+		}
+		node = newNodeMetrics(name)
+		s.nodeData[name] = node
+	}
+	update(node)
+	return *node, true
+}
+
+// SyncNodes aligns the node metrics with the configured nodes, keeping what the nodes
+// reported so stale ones can be detected, refreshes the fleet summary and returns a
+// snapshot of the result
+func (s *AppStates) SyncNodes(nodes map[string]node_control.NodeConfig, now time.Time) StateSnapshot {
+	maintenance := Maintenance.Active(timeutil.Now())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	nodeData := make(map[string]*node_control.NodeMetrics, len(nodes))
+	for name, config := range nodes {
+		node, exists := s.nodeData[name]
+		if !exists {
+			node = newNodeMetrics(name)
+		}
+		node.Status = "active"
+		if !config.Enabled {
+			node.Status = "inactive"
+		}
+		node.AllocatableCPU, node.AllocatableMemory = 0, 0
+		if config.Reserved != nil {
+			node.AllocatableCPU, node.AllocatableMemory = config.Allocatable(node.TotalCPU, node.TotalMemory)
+		}
+		nodeData[name] = node
+	}
+	s.nodeData = nodeData
+	s.fleet = summarizeFleet(nodeData, now)
+	return s.snapshotLocked(maintenance)
+}
+
+// newNodeMetrics is the entry of a node that has not reported yet
+func newNodeMetrics(name string) *node_control.NodeMetrics {
+	return &node_control.NodeMetrics{
+		NodeID:      name,
+		TotalCPU:    8.0,
+		TotalMemory: 8.0,
+	}
+}
+
+// AddClient registers a WebSocket client for broadcasts and starts the goroutine that
+// writes its messages
+func (s *AppStates) AddClient(conn *websocket.Conn) {
+	client := &wsClient{conn: conn, send: make(chan []byte, wsClientBuffer)}
+	s.mutex.Lock()
+	s.clients[conn] = client
+	s.mutex.Unlock()
+	go s.writeClient(client)
+}
+
+// RemoveClient unregisters a WebSocket client and ends its writer
+func (s *AppStates) RemoveClient(conn *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if client, ok := s.clients[conn]; ok {
+		delete(s.clients, conn)
+		close(client.send)
+	}
+}
+
+// SendToClient queues a message for one WebSocket client
+func (s *AppStates) SendToClient(conn *websocket.Conn, data []byte) {
+	s.queue(data, conn)
+}
+
+// queue hands a message to the writers of the given clients, or of all clients if none
+// are given. A client whose queue is full is dropped rather than holding up the others.
+func (s *AppStates) queue(data []byte, only ...*websocket.Conn) {
+	var slow []*websocket.Conn
+	s.mutex.RLock()
+	targets := make([]*wsClient, 0, len(s.clients))
+	if len(only) == 0 {
+		for _, client := range s.clients {
+			targets = append(targets, client)
+		}
+	}
+	for _, conn := range only {
+		if client, ok := s.clients[conn]; ok {
+			targets = append(targets, client)
+		}
+	}
+	// Sends happen under the read lock so RemoveClient cannot close a queue meanwhile
+	for _, client := range targets {
+		select {
+		case client.send <- data:
+		default:
+			slow = append(slow, client.conn)
+		}
+	}
+	s.mutex.RUnlock()
+
+	for _, conn := range slow {
+		log.Printf("WebSocket client %s is too slow, disconnecting", conn.RemoteAddr())
+		s.RemoveClient(conn)
+		conn.Close()
+	}
+}
+
+// writeClient writes the queued messages of a client until it is removed
+func (s *AppStates) writeClient(client *wsClient) {
+	for data := range client.send {
+		if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			s.RemoveClient(client.conn)
+			client.conn.Close()
+		}
+	}
+}
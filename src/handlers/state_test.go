@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"vuDataSim/src/node_control"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsPair returns the server side of a fresh WebSocket connection and the client that
+// reads from it. It does not fail the test itself, as it also runs outside the test
+// goroutine.
+func wsPair(server *httptest.Server, accepted chan *websocket.Conn) (*websocket.Conn, *websocket.Conn, error) {
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial: %v", err)
+	}
+	select {
+	case conn := <-accepted:
+		return conn, client, nil
+	case <-time.After(5 * time.Second):
+		client.Close()
+		return nil, nil, fmt.Errorf("server did not accept the connection")
+	}
+}
+
+func newWSServer(t *testing.T) (*httptest.Server, chan *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 16)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(server.Close)
+	return server, accepted
+}
+
+// TestAppStateConcurrentAccess runs every kind of state access from many goroutines at
+// once; it is meant for go test -race
+func TestAppStateConcurrentAccess(t *testing.T) {
+	state := NewAppState()
+	server, accepted := newWSServer(t)
+
+	const workers = 8
+	const rounds = 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		node := fmt.Sprintf("node%d", w%3)
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				state.UpdateSimulation(func(sim *SimulationState) {
+					sim.Running = !sim.Running
+					sim.TargetEPS++
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				state.UpdateNode(node, true, func(metrics *node_control.NodeMetrics) {
+					metrics.CPU = float64(i)
+				})
+				state.Node(node)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				snapshot := state.Snapshot()
+				for _, metrics := range snapshot.NodeData {
+					_ = metrics.CPU
+				}
+				state.queue([]byte(`{"type":"tick"}`))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds/20; i++ {
+				conn, client, err := wsPair(server, accepted)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				go func() {
+					for {
+						if _, _, err := client.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+				state.AddClient(conn)
+				state.SendToClient(conn, []byte(`{"type":"initial"}`))
+				state.RemoveClient(conn)
+				state.RemoveClient(conn) // removing twice is harmless
+				conn.Close()
+				client.Close()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		nodes := map[string]node_control.NodeConfig{"node0": {Enabled: true}, "node1": {Enabled: false}}
+		for i := 0; i < rounds; i++ {
+			state.SyncNodes(nodes, time.Now())
+		}
+	}()
+	wg.Wait()
+
+	if got := state.Simulation().TargetEPS; got != 10000+workers*rounds {
+		t.Errorf("TargetEPS = %d, want %d: an update was lost", got, 10000+workers*rounds)
+	}
+	state.mutex.RLock()
+	defer state.mutex.RUnlock()
+	if len(state.clients) != 0 {
+		t.Errorf("%d clients left registered after RemoveClient", len(state.clients))
+	}
+}
+
+// TestAppStateBroadcastOrder checks that a client receives broadcasts in the order they
+// were queued, through its single writer
+func TestAppStateBroadcastOrder(t *testing.T) {
+	state := NewAppState()
+	server, accepted := newWSServer(t)
+	conn, client, err := wsPair(server, accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	state.AddClient(conn)
+	defer state.RemoveClient(conn)
+
+	const messages = 50
+	for i := 0; i < messages; i++ {
+		state.queue([]byte(fmt.Sprintf("%d", i)))
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < messages; i++ {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if string(data) != fmt.Sprintf("%d", i) {
+			t.Fatalf("message %d = %s, out of order", i, data)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StorageConfig holds the storage section of config.yaml
+type StorageConfig struct {
+	CheckIntervalSeconds int     `yaml:"check_interval_seconds" json:"checkIntervalSeconds"`
+	LogRotateMB          int     `yaml:"log_rotate_mb" json:"logRotateMb"`           // the active log is rotated beyond this; 0 never rotates
+	LogsQuotaMB          int     `yaml:"logs_quota_mb" json:"logsQuotaMb"`           // rotated logs are deleted oldest first beyond this; 0 disables
+	ArtifactsQuotaMB     int     `yaml:"artifacts_quota_mb" json:"artifactsQuotaMb"` // run artifacts are deleted oldest run first beyond this; 0 disables
+	MinFreePct           float64 `yaml:"min_free_pct" json:"minFreePct"`             // alert when a manager disk has less free space
+}
+
+// StorageDisk is the free space of a filesystem holding the manager's logs or artifacts
+type StorageDisk struct {
+	Paths      []string `json:"paths"`
+	FreeBytes  uint64   `json:"freeBytes"`
+	TotalBytes uint64   `json:"totalBytes"`
+	FreePct    float64  `json:"freePct"`
+	Low        bool     `json:"low"` // below min_free_pct
+}
+
+// StorageUsage is the space taken by one managed directory and its quota
+type StorageUsage struct {
+	Path       string `json:"path"`
+	Bytes      int64  `json:"bytes"`
+	QuotaBytes int64  `json:"quotaBytes,omitempty"`
+}
+
+// StorageCleanup is what one check rotated or deleted to stay within the quotas
+type StorageCleanup struct {
+	Time           time.Time `json:"time"`
+	RotatedLog     string    `json:"rotatedLog,omitempty"`
+	DeletedLogs    []string  `json:"deletedLogs,omitempty"`
+	DeletedRunArts []string  `json:"deletedRunArtifacts,omitempty"`
+}
+
+// StorageStatus is the response of GET /api/self/storage
+type StorageStatus struct {
+	Config      StorageConfig   `json:"config"`
+	LastCheck   *time.Time      `json:"lastCheck,omitempty"`
+	Disks       []StorageDisk   `json:"disks"`
+	Logs        StorageUsage    `json:"logs"`
+	Artifacts   StorageUsage    `json:"artifacts"`
+	LastCleanup *StorageCleanup `json:"lastCleanup,omitempty"`
+	Errors      []string        `json:"errors,omitempty"`
+}
+
+// StorageMonitor keeps the manager's logs and run artifacts within their quotas and
+// alerts when the disk they live on runs low, so a campaign does not die on a full disk
+type StorageMonitor struct {
+	mutex  sync.Mutex
+	status StorageStatus
+	low    map[string]bool // filesystems already alerted about, until they recover
+}
+
+var Storage = &StorageMonitor{
+	status: StorageStatus{Config: defaultStorageConfig(), Disks: []StorageDisk{}},
+	low:    make(map[string]bool),
+}
+
+func defaultStorageConfig() StorageConfig {
+	return StorageConfig{
+		CheckIntervalSeconds: 300,
+		LogRotateMB:          100,
+		LogsQuotaMB:          1024,
+		ArtifactsQuotaMB:     0,
+		MinFreePct:           10,
+	}
+}
+
+// LoadConfig reads the storage section from the application config file
+func (sm *StorageMonitor) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultStorageConfig()
+	fileConfig := struct {
+		Storage *StorageConfig `yaml:"storage"`
+	}{Storage: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.CheckIntervalSeconds <= 0 {
+		config.CheckIntervalSeconds = 300
+	}
+	if config.MinFreePct < 0 || config.MinFreePct >= 100 {
+		config.MinFreePct = 10
+	}
+
+	sm.mutex.Lock()
+	sm.status.Config = config
+	sm.mutex.Unlock()
+	return nil
+}
+
+// Start checks the storage now and then every check_interval_seconds
+func (sm *StorageMonitor) Start() {
+	sm.mutex.Lock()
+	interval := time.Duration(sm.status.Config.CheckIntervalSeconds) * time.Second
+	sm.mutex.Unlock()
+
+	go func() {
+		sm.Check(time.Now())
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sm.Check(time.Now())
+		}
+	}()
+}
+
+// Status returns a copy of the last check
+func (sm *StorageMonitor) Status() StorageStatus {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	status := sm.status
+	status.Disks = append([]StorageDisk(nil), sm.status.Disks...)
+	status.Errors = append([]string(nil), sm.status.Errors...)
+	return status
+}
+
+// Check enforces the quotas and measures the free space of the manager's disks
+func (sm *StorageMonitor) Check(now time.Time) StorageStatus {
+	sm.mutex.Lock()
+	config := sm.status.Config
+	sm.mutex.Unlock()
+
+	var problems []string
+	cleanup := StorageCleanup{Time: now.UTC()}
+
+	logPath := logger.LogFilePath()
+	logsDir := filepath.Dir(logPath)
+	if logPath == "" {
+		logsDir = "logs"
+	}
+	if logPath != "" && config.LogRotateMB > 0 {
+		if info, err := os.Stat(logPath); err == nil && info.Size() > int64(config.LogRotateMB)<<20 {
+			rotated, err := logger.Rotate()
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			cleanup.RotatedLog = rotated
+		}
+	}
+	logs := StorageUsage{Path: logsDir, QuotaBytes: int64(config.LogsQuotaMB) << 20}
+	deleted, used, err := enforceLogsQuota(logsDir, logPath, logs.QuotaBytes)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	logs.Bytes = used
+	cleanup.DeletedLogs = deleted
+
+	artifacts := StorageUsage{Path: RunStore.DataDir(), QuotaBytes: int64(config.ArtifactsQuotaMB) << 20}
+	quota := artifacts.QuotaBytes
+	if quota <= 0 {
+		quota = 1<<63 - 1 // measure only
+	}
+	removed, usage, err := RunStore.ApplyQuota(quota)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	artifacts.Bytes = usage.Bytes
+	cleanup.DeletedRunArts = removed
+
+	if cleanup.RotatedLog != "" || len(cleanup.DeletedLogs) > 0 || len(cleanup.DeletedRunArts) > 0 {
+		logger.LogWarning("System", "Storage", fmt.Sprintf("Storage quotas enforced: rotated log %q, deleted %d old logs and the artifacts of %d runs %v",
+			cleanup.RotatedLog, len(cleanup.DeletedLogs), len(cleanup.DeletedRunArts), cleanup.DeletedRunArts))
+	}
+
+	disks, err := managerDisks([]string{logsDir, artifacts.Path}, config.MinFreePct)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, message := range problems {
+		logger.LogWarning("System", "Storage", message)
+	}
+
+	sm.mutex.Lock()
+	var alerts []StorageDisk
+	seen := make(map[string]bool, len(disks))
+	for _, disk := range disks {
+		key := strings.Join(disk.Paths, ",")
+		seen[key] = true
+		if disk.Low && !sm.low[key] {
+			alerts = append(alerts, disk)
+		}
+		sm.low[key] = disk.Low
+	}
+	for key := range sm.low {
+		if !seen[key] {
+			delete(sm.low, key)
+		}
+	}
+	checked := now.UTC()
+	sm.status.LastCheck = &checked
+	sm.status.Disks = disks
+	sm.status.Logs = logs
+	sm.status.Artifacts = artifacts
+	sm.status.Errors = problems
+	if cleanup.RotatedLog != "" || len(cleanup.DeletedLogs) > 0 || len(cleanup.DeletedRunArts) > 0 {
+		sm.status.LastCleanup = &cleanup
+	}
+	sm.mutex.Unlock()
+
+	for _, disk := range alerts {
+		message := fmt.Sprintf("Only %.1f%% (%s of %s) is free on the manager disk holding %s, below the %g%% threshold",
+			disk.FreePct, formatBytes(disk.FreeBytes), formatBytes(disk.TotalBytes), strings.Join(disk.Paths, " and "), config.MinFreePct)
+		logger.LogError("System", "Storage", message)
+		sendNotification(notify.Message{
+			Subject:  "vuDataSim manager disk space low",
+			Text:     message,
+			Severity: notify.SeverityCritical,
+			Event:    notify.EventStorage,
+		})
+		if runID := AppState.Simulation().RunID; runID != "" {
+			if err := RunStore.AddTimelineEvent(runID, "manager_disk_low", message, map[string]interface{}{
+				"paths":     disk.Paths,
+				"freeBytes": disk.FreeBytes,
+				"freePct":   disk.FreePct,
+			}); err != nil {
+				logger.LogWarning("System", "Runs", fmt.Sprintf("Failed to record low disk space for run %s: %v", runID, err))
+			}
+		}
+	}
+	return sm.Status()
+}
+
+// enforceLogsQuota deletes rotated log files in dir, oldest first, until the directory
+// takes at most quota bytes. The active log is never deleted. A quota of 0 only measures.
+func enforceLogsQuota(dir, activeLog string, quota int64) ([]string, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s: %v", dir, err)
+	}
+
+	type logFile struct {
+		path     string
+		size     int64
+		modified time.Time
+	}
+	var total int64
+	var candidates []logFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		total += info.Size()
+		if path != activeLog {
+			candidates = append(candidates, logFile{path: path, size: info.Size(), modified: info.ModTime()})
+		}
+	}
+	if quota <= 0 {
+		return nil, total, nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].modified.Before(candidates[j].modified) })
+	var deleted []string
+	for _, candidate := range candidates {
+		if total <= quota {
+			break
+		}
+		if err := os.Remove(candidate.path); err != nil {
+			return deleted, total, fmt.Errorf("failed to delete %s: %v", candidate.path, err)
+		}
+		total -= candidate.size
+		deleted = append(deleted, candidate.path)
+	}
+	return deleted, total, nil
+}
+
+// managerDisks returns the free space of the filesystems holding paths, one entry per
+// filesystem
+func managerDisks(paths []string, minFreePct float64) ([]StorageDisk, error) {
+	disks := []StorageDisk{}
+	byFS := make(map[syscall.Fsid]int)
+	for _, path := range paths {
+		// A directory not created yet will be created on the disk of its parent
+		existing := path
+		for {
+			if _, err := os.Stat(existing); err == nil || filepath.Dir(existing) == existing {
+				break
+			}
+			existing = filepath.Dir(existing)
+		}
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(existing, &stat); err != nil {
+			return disks, fmt.Errorf("failed to read free space of %s: %v", path, err)
+		}
+		if index, ok := byFS[stat.Fsid]; ok {
+			disks[index].Paths = append(disks[index].Paths, path)
+			continue
+		}
+		disk := StorageDisk{
+			Paths:      []string{path},
+			FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+			TotalBytes: stat.Blocks * uint64(stat.Bsize),
+		}
+		if disk.TotalBytes > 0 {
+			disk.FreePct = float64(disk.FreeBytes) * 100 / float64(disk.TotalBytes)
+		}
+		disk.Low = disk.FreePct < minFreePct
+		byFS[stat.Fsid] = len(disks)
+		disks = append(disks, disk)
+	}
+	return disks, nil
+}
+
+// HandleAPISelfStorage Handles GET /api/self/storage
+// Returns the free space of the manager's disks, the size of logs/ and of the run
+// artifacts against their quotas, and what the last cleanup rotated or deleted.
+func HandleAPISelfStorage(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    Storage.Status(),
+	})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/selfstats"
+	"vuDataSim/src/sshlimit"
+	"vuDataSim/src/timeutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Support bundle limits
+const (
+	supportBundleLogBytes     = 10 * 1024 * 1024 // tail of the manager log included
+	defaultSupportBundleHours = 24
+	maxSupportBundleHours     = 7 * 24
+	supportBundleEventLimit   = 10000
+)
+
+// supportBundleConfigs are the config files a bundle contains, redacted
+var supportBundleConfigs = []string{
+	"src/configs/config.yaml",
+	"src/configs/nodes.yaml",
+	"src/configs/topics_tables.yaml",
+	"src/configs/max_eps.yaml",
+	"src/configs/categories.yaml",
+}
+
+// supportBundleRedactFields are redacted in bundled configs on top of the
+// troubleshooting redact_fields, since webhook URLs carry their credentials
+var supportBundleRedactFields = []string{"webhookurl", "keysha256"}
+
+// SupportBundleManifest is manifest.json of a bundle
+type SupportBundleManifest struct {
+	Version     string              `json:"version"`
+	GoVersion   string              `json:"goVersion"`
+	OS          string              `json:"os"`
+	GeneratedAt time.Time           `json:"generatedAt"`
+	GeneratedBy string              `json:"generatedBy"`
+	ServerZone  timeutil.ServerZone `json:"serverTimeZone"`
+	EventsFrom  time.Time           `json:"eventsFrom"`
+	Files       []string            `json:"files"`
+	Errors      map[string]string   `json:"errors,omitempty"` // parts that could not be collected
+}
+
+// supportBundle collects the entries of a bundle archive
+type supportBundle struct {
+	root     string
+	zw       *zip.Writer
+	manifest *SupportBundleManifest
+}
+
+// add writes one file to the archive; a failed part is recorded instead of failing the bundle
+func (b *supportBundle) add(name string, data []byte, err error) {
+	if err != nil {
+		b.manifest.Errors[name] = err.Error()
+		return
+	}
+	entry, err := b.zw.CreateHeader(&zip.FileHeader{Name: b.root + "/" + name, Method: zip.Deflate, Modified: b.manifest.GeneratedAt})
+	if err == nil {
+		_, err = entry.Write(data)
+	}
+	if err != nil {
+		b.manifest.Errors[name] = err.Error()
+		return
+	}
+	b.manifest.Files = append(b.manifest.Files, name)
+}
+
+// addJSON writes a value as indented JSON
+func (b *supportBundle) addJSON(name string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	b.add(name, data, err)
+}
+
+// WriteSupportBundle writes a zip with the manager's version, the tail of its log, the
+// config files with sensitive fields redacted, the events since eventsFrom, node and
+// simulation state and the manager's own health
+func WriteSupportBundle(w io.Writer, eventsFrom time.Time, generatedBy string) error {
+	now := timeutil.Now()
+	bundle := &supportBundle{
+		root: "support-bundle-" + now.Format("20060102-150405"),
+		zw:   zip.NewWriter(w),
+		manifest: &SupportBundleManifest{
+			Version:     AppVersion,
+			GoVersion:   runtime.Version(),
+			OS:          runtime.GOOS + "/" + runtime.GOARCH,
+			GeneratedAt: now,
+			GeneratedBy: generatedBy,
+			ServerZone:  timeutil.LocalZone(),
+			EventsFrom:  eventsFrom.UTC(),
+			Files:       []string{},
+			Errors:      make(map[string]string),
+		},
+	}
+
+	if path := logger.LogFilePath(); path != "" {
+		data, err := tailFile(path, supportBundleLogBytes)
+		bundle.add("logs/"+filepath.Base(path), data, err)
+	}
+
+	fields := append(Troubleshooting.Config().RedactFields, supportBundleRedactFields...)
+	for _, path := range supportBundleConfigs {
+		data, err := redactedYAMLFile(path, fields)
+		if os.IsNotExist(err) {
+			continue
+		}
+		bundle.add("configs/"+filepath.Base(path), data, err)
+	}
+
+	events, truncated, err := EventHistory.Query(eventsFrom, now, nil, supportBundleEventLimit)
+	if err != nil {
+		bundle.add("events.json", nil, err)
+	} else {
+		bundle.addJSON("events.json", map[string]interface{}{"events": events, "truncated": truncated})
+	}
+
+	bundle.addJSON("state.json", AppState.Snapshot())
+	bundle.addJSON("node_agents.json", NodeClient.Status())
+	bundle.addJSON("ssh_sessions.json", sshlimit.Default().Status())
+	bundle.addJSON("ssh_connections.json", node_control.SSH.Status())
+	bundle.addJSON("runs.json", RunStore.RunningRuns())
+	bundle.addJSON("jobs.json", map[string]interface{}{
+		"transfers": TransferScheduler.List(),
+		"fleet":     FleetScheduler.List(),
+	})
+	bundle.addJSON("self.json", map[string]interface{}{
+		"reliability": selfstats.Default().Report(),
+		"panics":      selfstats.Panics(),
+		"ha":          HA.Status(),
+	})
+
+	sort.Strings(bundle.manifest.Files)
+	if len(bundle.manifest.Errors) == 0 {
+		bundle.manifest.Errors = nil
+	}
+	bundle.addJSON("manifest.json", bundle.manifest)
+	return bundle.zw.Close()
+}
+
+// tailFile reads at most limit bytes from the end of a file
+func tailFile(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		if _, err := file.Seek(info.Size()-limit, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(file)
+}
+
+// redactedYAMLFile returns a YAML file with the values of sensitive keys replaced. A
+// file that does not parse is left out rather than copied unredacted.
+func redactedYAMLFile(path string, fields []string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("not included, failed to parse: %v", err)
+	}
+	return yaml.Marshal(RedactPayload(value, fields))
+}
+
+// HandleAPICreateSupportBundle Handles POST /api/support-bundle[?hours=24]
+// Returns a zip with the manager's version, the tail of its log, the config files with
+// passwords, tokens and other sensitive fields redacted, the events of the last hours,
+// node and simulation state and the manager's own health, to attach to an issue
+func HandleAPICreateSupportBundle(w http.ResponseWriter, r *http.Request) {
+	hours := defaultSupportBundleHours
+	if value := r.URL.Query().Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxSupportBundleHours {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("hours must be between 1 and %d", maxSupportBundleHours),
+			})
+			return
+		}
+		hours = parsed
+	}
+
+	// Build the archive in memory so errors can still be reported as JSON
+	var buf bytes.Buffer
+	generatedBy := auth.Describe(r.Context())
+	if err := WriteSupportBundle(&buf, timeutil.Now().Add(-time.Duration(hours)*time.Hour), generatedBy); err != nil {
+		SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to build support bundle: %v", err),
+		})
+		return
+	}
+
+	logger.LogWithNode("System", "API", fmt.Sprintf("Support bundle of %d bytes generated by %s", buf.Len(), generatedBy), "info")
+	w.Header().Set(ContentTypeHeader, "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "vudatasim-support-"+timeutil.Now().Format("20060102-150405")+".zip"))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TableCheckConfig holds the table_check section of config.yaml
+type TableCheckConfig struct {
+	Enabled        bool `yaml:"enabled" json:"enabled"`            // check before every simulation start
+	RequireEmpty   bool `yaml:"require_empty" json:"requireEmpty"` // also fail on tables that still hold rows
+	TimeoutSeconds int  `yaml:"timeout_seconds" json:"timeoutSeconds"`
+}
+
+// SourceTableCheck is the table check of one enabled source
+type SourceTableCheck struct {
+	Source   string            `json:"source"`
+	Mapped   bool              `json:"mapped"` // has an entry in topics_tables.yaml
+	Tables   []string          `json:"tables"`
+	Missing  []string          `json:"missing,omitempty"`
+	NonEmpty map[string]uint64 `json:"nonEmpty,omitempty"` // row counts, only with requireEmpty
+}
+
+// TableCheckResult lists the ClickHouse tables of the enabled sources that are missing
+// or, with requireEmpty, not empty
+type TableCheckResult struct {
+	Passed       bool               `json:"passed"`
+	RequireEmpty bool               `json:"requireEmpty"`
+	Sources      []SourceTableCheck `json:"sources"`
+	Problems     []string           `json:"problems,omitempty"`
+	CheckedAt    time.Time          `json:"checkedAt"`
+}
+
+// RunTableCheck verifies before a run that every ClickHouse table the enabled sources
+// write to exists, so a misconfigured run fails at start instead of showing empty charts
+type RunTableCheck struct {
+	mutex  sync.Mutex
+	config TableCheckConfig
+}
+
+var TableCheck = &RunTableCheck{config: defaultTableCheckConfig()}
+
+func defaultTableCheckConfig() TableCheckConfig {
+	return TableCheckConfig{Enabled: true, TimeoutSeconds: 30}
+}
+
+// LoadConfig reads the table_check section from the application config file
+func (tc *RunTableCheck) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultTableCheckConfig()
+	fileConfig := struct {
+		TableCheck *TableCheckConfig `yaml:"table_check"`
+	}{TableCheck: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 30
+	}
+
+	tc.mutex.Lock()
+	tc.config = config
+	tc.mutex.Unlock()
+	return nil
+}
+
+// Config returns the table check settings
+func (tc *RunTableCheck) Config() TableCheckConfig {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.config
+}
+
+// Check looks up the tables of every source enabled in conf.yml. An error means the
+// check could not run, e.g. because ClickHouse is unreachable.
+func (tc *RunTableCheck) Check(ctx context.Context, requireEmpty bool) (*TableCheckResult, error) {
+	if topicMapping == nil {
+		return nil, fmt.Errorf("topics_tables.yaml mapping not loaded")
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(tc.Config().TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read conf.yml: %v", err)
+	}
+	result := &TableCheckResult{RequireEmpty: requireEmpty, Sources: []SourceTableCheck{}}
+	for _, source := range O11yManager.GetEnabledSources() {
+		check := SourceTableCheck{Source: source}
+		topicConfig, mapped := topicMapping.SourceConfig(source)
+		check.Mapped = mapped
+		if !mapped {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: no entry in topics_tables.yaml", source))
+			result.Sources = append(result.Sources, check)
+			continue
+		}
+		check.Tables = topicConfig.ClickhouseTables
+
+		missing, err := clickhouse.MissingTables(ctx, check.Tables)
+		if err != nil {
+			return nil, err
+		}
+		check.Missing = missing
+		for _, table := range missing {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s: table %s does not exist", source, table))
+		}
+
+		if requireEmpty {
+			existing := withoutTables(check.Tables, missing)
+			counts, err := clickhouse.TableRowCounts(ctx, existing)
+			if err != nil {
+				return nil, err
+			}
+			for _, table := range existing {
+				if counts[table] == 0 {
+					continue
+				}
+				if check.NonEmpty == nil {
+					check.NonEmpty = make(map[string]uint64)
+				}
+				check.NonEmpty[table] = counts[table]
+				result.Problems = append(result.Problems, fmt.Sprintf("%s: table %s has %d rows", source, table, counts[table]))
+			}
+		}
+		result.Sources = append(result.Sources, check)
+	}
+	result.Passed = len(result.Problems) == 0
+	result.CheckedAt = time.Now().UTC()
+	return result, nil
+}
+
+// BeforeRun runs the check configured for simulation starts. It returns nil without
+// error when the check is disabled or skipped.
+func (tc *RunTableCheck) BeforeRun(ctx context.Context, skip bool) (*TableCheckResult, error) {
+	config := tc.Config()
+	if !config.Enabled || skip {
+		return nil, nil
+	}
+	return tc.Check(ctx, config.RequireEmpty)
+}
+
+// Summary is a one-line description of a failed check for messages and logs
+func (r *TableCheckResult) Summary() string {
+	if r.Passed {
+		return fmt.Sprintf("All ClickHouse tables of %d enabled sources are ready", len(r.Sources))
+	}
+	return fmt.Sprintf("%d ClickHouse table problems: %s", len(r.Problems), strings.Join(r.Problems, "; "))
+}
+
+func withoutTables(tables, excluded []string) []string {
+	skip := make(map[string]bool, len(excluded))
+	for _, table := range excluded {
+		skip[table] = true
+	}
+	var kept []string
+	for _, table := range tables {
+		if !skip[table] {
+			kept = append(kept, table)
+		}
+	}
+	return kept
+}
+
+// HandleAPICheckRunTables Handles GET /api/clickhouse/tables/check?requireEmpty=true
+// Runs the pre-run table check on demand; requireEmpty defaults to table_check.require_empty.
+func HandleAPICheckRunTables(w http.ResponseWriter, r *http.Request) {
+	requireEmpty := TableCheck.Config().RequireEmpty
+	if value := r.URL.Query().Get("requireEmpty"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "requireEmpty must be true or false",
+			})
+			return
+		}
+		requireEmpty = parsed
+	}
+
+	result, err := TableCheck.Check(r.Context(), requireEmpty)
+	if err != nil {
+		SendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to check ClickHouse tables: %v", err),
+		})
+		return
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: result.Summary(),
+		Data:    result,
+	})
+}
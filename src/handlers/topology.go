@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/kafka_ch_reset"
+	"vuDataSim/src/node_control"
+)
+
+// Topology health colors
+const (
+	HealthGreen  = "green"
+	HealthYellow = "yellow"
+	HealthRed    = "red"
+	HealthGrey   = "grey"
+)
+
+// TopologyNode is a component in the data-flow graph
+type TopologyNode struct {
+	ID      string                 `json:"id"`
+	Type    string                 `json:"type"` // manager, node, kafka_topic, clickhouse_table, clickhouse
+	Label   string                 `json:"label"`
+	Health  string                 `json:"health"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// TopologyEdge is a data flow between two components
+type TopologyEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Label  string `json:"label,omitempty"`
+	Health string `json:"health"`
+}
+
+// Topology is the response of GET /api/topology
+type Topology struct {
+	Nodes       []TopologyNode `json:"nodes"`
+	Edges       []TopologyEdge `json:"edges"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+}
+
+// healthRank orders colors from best to worst; grey (inactive) ranks lowest
+var healthRank = map[string]int{HealthGrey: 0, HealthGreen: 1, HealthYellow: 2, HealthRed: 3}
+
+// edgeHealth is grey if either end is inactive, otherwise the worse of both ends
+func edgeHealth(a, b string) string {
+	if a == HealthGrey || b == HealthGrey {
+		return HealthGrey
+	}
+	if healthRank[a] >= healthRank[b] {
+		return a
+	}
+	return b
+}
+
+// GetTopology handles GET /api/topology - returns the manager→nodes→kafka→clickhouse data-flow graph
+// Pass deep=true to check Kafka topic existence via kubectl (slow).
+func (kh *KafkaHandler) GetTopology(w http.ResponseWriter, r *http.Request) {
+	deep := r.URL.Query().Get("deep") == "true"
+
+	topology := Topology{GeneratedAt: time.Now().UTC()}
+	addNode := func(node TopologyNode) { topology.Nodes = append(topology.Nodes, node) }
+	addEdge := func(from, to, label, health string) {
+		topology.Edges = append(topology.Edges, TopologyEdge{From: from, To: to, Label: label, Health: health})
+	}
+
+	addNode(TopologyNode{ID: "manager", Type: "manager", Label: "vuDataSim Manager", Health: HealthGreen,
+		Details: map[string]interface{}{"version": AppVersion}})
+
+	// Load generator nodes, with health from their metrics agents
+	nodeHealth := checkNodeAgents(NodeManager.GetNodes())
+	nodeNames := make([]string, 0, len(nodeHealth))
+	for name := range nodeHealth {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+	for _, name := range nodeNames {
+		health := nodeHealth[name]
+		addNode(TopologyNode{ID: "node:" + name, Type: "node", Label: name, Health: health.color,
+			Details: map[string]interface{}{"host": health.host, "enabled": health.enabled, "agent": health.message}})
+		addEdge("manager", "node:"+name, "control", edgeHealth(HealthGreen, health.color))
+	}
+
+	// ClickHouse cluster
+	chHealth := HealthGreen
+	chDetails, err := clickhouse.GetClickHouseHealth()
+	if err != nil {
+		chHealth = HealthRed
+	}
+	addNode(TopologyNode{ID: "clickhouse", Type: "clickhouse", Label: "ClickHouse", Health: chHealth, Details: chDetails})
+
+	// Kafka topics and ClickHouse tables per source; a source is active when enabled in conf.d
+	activeSources := make(map[string]bool)
+	if err := O11yManager.LoadMainConfig(); err == nil {
+		for _, source := range O11yManager.GetEnabledSources() {
+			activeSources[kafka_ch_reset.SourceDisplayName(source)] = true
+		}
+	}
+
+	topicHealth := func(name string, active bool) string {
+		if !active {
+			return HealthGrey
+		}
+		if deep && kh.kafkaManager.GetSingleTopicStatus(name) != "exists" {
+			return HealthRed
+		}
+		return HealthGreen
+	}
+
+	seen := make(map[string]bool)
+	for _, source := range kh.kafkaManager.GetAllTopics() {
+		active := activeSources[source.Name]
+
+		for _, input := range source.InputTopic {
+			id := "topic:" + input.Name
+			health := topicHealth(input.Name, active)
+			if !seen[id] {
+				seen[id] = true
+				addNode(TopologyNode{ID: id, Type: "kafka_topic", Label: input.Name, Health: health,
+					Details: map[string]interface{}{"source": source.Name, "role": "input", "active": active}})
+			}
+			for _, name := range nodeNames {
+				if nodeHealth[name].enabled {
+					addEdge("node:"+name, id, source.Name, edgeHealth(nodeHealth[name].color, health))
+				}
+			}
+			for _, output := range source.OutputTopic {
+				outID := "topic:" + output.Name
+				outHealth := topicHealth(output.Name, active)
+				if !seen[outID] {
+					seen[outID] = true
+					addNode(TopologyNode{ID: outID, Type: "kafka_topic", Label: output.Name, Health: outHealth,
+						Details: map[string]interface{}{"source": source.Name, "role": "output", "active": active}})
+				}
+				addEdge(id, outID, source.Name, edgeHealth(health, outHealth))
+			}
+		}
+
+		for _, table := range source.ClickhouseTables {
+			id := "table:" + table
+			tableHealth := HealthGrey
+			if active {
+				tableHealth = chHealth
+			}
+			if !seen[id] {
+				seen[id] = true
+				addNode(TopologyNode{ID: id, Type: "clickhouse_table", Label: table, Health: tableHealth,
+					Details: map[string]interface{}{"source": source.Name, "active": active}})
+			}
+			from := tableSourceTopic(source, table)
+			if from != "" {
+				addEdge("topic:"+from, id, source.Name, edgeHealth(topicHealth(from, active), tableHealth))
+			}
+			addEdge(id, "clickhouse", "", edgeHealth(tableHealth, chHealth))
+		}
+	}
+
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Topology with %d components and %d flows", len(topology.Nodes), len(topology.Edges)),
+		Data:    topology,
+	})
+}
+
+// tableSourceTopic finds the output topic feeding a table by name (mongo-top-stats feeds
+// vmetrics_mongo_top_stats_...), falling back to the source's first topic
+func tableSourceTopic(source kafka_ch_reset.TopicConfig, table string) string {
+	best := ""
+	for _, output := range source.OutputTopic {
+		normalized := strings.ReplaceAll(output.Name, "-", "_")
+		if strings.Contains(table, normalized) && len(output.Name) > len(best) {
+			best = output.Name
+		}
+	}
+	if best != "" {
+		return best
+	}
+	if len(source.OutputTopic) > 0 {
+		return source.OutputTopic[0].Name
+	}
+	if len(source.InputTopic) > 0 {
+		return source.InputTopic[0].Name
+	}
+	return ""
+}
+
+type nodeAgentHealth struct {
+	host    string
+	enabled bool
+	color   string
+	message string
+}
+
+// checkNodeAgents queries every enabled node's metrics agent health endpoint in parallel
+func checkNodeAgents(nodes map[string]node_control.NodeConfig) map[string]nodeAgentHealth {
+	results := make(map[string]nodeAgentHealth, len(nodes))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	// Disabled nodes are filled in before any probe writes the map
+	for name, config := range nodes {
+		if !config.Enabled {
+			results[name] = nodeAgentHealth{host: config.Host, color: HealthGrey, message: "disabled"}
+		}
+	}
+	for name, config := range nodes {
+		if !config.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, config node_control.NodeConfig) {
+			defer wg.Done()
+			health := nodeAgentHealth{host: config.Host, enabled: true, color: HealthGreen, message: "healthy"}
+			resp, err := NodeClient.Get(context.Background(), config.AgentURL("/api/system/health"))
+			if err != nil {
+				health.color = HealthRed
+				health.message = fmt.Sprintf("unreachable: %v", err)
+			} else {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					health.color = HealthYellow
+					health.message = fmt.Sprintf("agent returned HTTP %d", resp.StatusCode)
+				}
+			}
+			mutex.Lock()
+			results[name] = health
+			mutex.Unlock()
+		}(name, config)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue replaces the value of a sensitive field in logged payloads
+const redactedValue = "[REDACTED]"
+
+// TroubleshootingConfig holds the troubleshooting section of config.yaml
+type TroubleshootingConfig struct {
+	DefaultMinutes int `yaml:"default_minutes" json:"defaultMinutes"`
+	MaxMinutes     int `yaml:"max_minutes" json:"maxMinutes"`
+	MaxBodyKB      int `yaml:"max_body_kb" json:"maxBodyKb"` // larger bodies are cut off in the log
+	// RedactFields are matched case-insensitively against JSON keys, ignoring '_' and
+	// '-'; a key containing any of them has its value replaced
+	RedactFields []string `yaml:"redact_fields" json:"redactFields"`
+}
+
+// TroubleshootingSession is an active payload logging window
+type TroubleshootingSession struct {
+	Routes    []string  `json:"routes"` // route templates such as /simulation/start; empty logs every route
+	StartedAt time.Time `json:"startedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	StartedBy string    `json:"startedBy"`
+	Logged    int       `json:"logged"` // requests logged so far
+}
+
+// TroubleshootingMode logs full request and response bodies, with sensitive fields
+// redacted, for a limited time, to debug what a UI user saw without keeping payload
+// logging on
+type TroubleshootingMode struct {
+	mutex   sync.Mutex
+	config  TroubleshootingConfig
+	session *TroubleshootingSession
+}
+
+var Troubleshooting = &TroubleshootingMode{config: defaultTroubleshootingConfig()}
+
+func defaultTroubleshootingConfig() TroubleshootingConfig {
+	return TroubleshootingConfig{
+		DefaultMinutes: 15,
+		MaxMinutes:     120,
+		MaxBodyKB:      64,
+		RedactFields:   []string{"password", "passwd", "secret", "token", "apikey", "authorization", "credential", "privatekey", "keypath"},
+	}
+}
+
+// LoadConfig reads the troubleshooting section from the application config file
+func (tm *TroubleshootingMode) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultTroubleshootingConfig()
+	fileConfig := struct {
+		Troubleshooting *TroubleshootingConfig `yaml:"troubleshooting"`
+	}{Troubleshooting: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.MaxMinutes <= 0 {
+		config.MaxMinutes = 120
+	}
+	if config.DefaultMinutes <= 0 || config.DefaultMinutes > config.MaxMinutes {
+		config.DefaultMinutes = config.MaxMinutes
+	}
+	if config.MaxBodyKB <= 0 {
+		config.MaxBodyKB = 64
+	}
+	for i, field := range config.RedactFields {
+		config.RedactFields[i] = normalizeFieldName(field)
+	}
+
+	tm.mutex.Lock()
+	tm.config = config
+	tm.mutex.Unlock()
+	return nil
+}
+
+// Config returns the troubleshooting settings
+func (tm *TroubleshootingMode) Config() TroubleshootingConfig {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.config
+}
+
+// Start opens a payload logging window, replacing an active one
+func (tm *TroubleshootingMode) Start(routes []string, minutes int, startedBy string) (TroubleshootingSession, error) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if minutes == 0 {
+		minutes = tm.config.DefaultMinutes
+	}
+	if minutes < 0 || minutes > tm.config.MaxMinutes {
+		return TroubleshootingSession{}, fmt.Errorf("minutes must be between 1 and %d", tm.config.MaxMinutes)
+	}
+	cleaned := []string{}
+	for _, route := range routes {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		if !strings.HasPrefix(route, "/") {
+			return TroubleshootingSession{}, fmt.Errorf("route %q must be a template relative to /api, e.g. /simulation/start", route)
+		}
+		cleaned = append(cleaned, route)
+	}
+	now := time.Now().UTC()
+	tm.session = &TroubleshootingSession{
+		Routes:    cleaned,
+		StartedAt: now,
+		ExpiresAt: now.Add(time.Duration(minutes) * time.Minute),
+		StartedBy: startedBy,
+	}
+	return *tm.session, nil
+}
+
+// Stop closes the payload logging window and returns it, or nil if none was active
+func (tm *TroubleshootingMode) Stop() *TroubleshootingSession {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	session := tm.activeLocked()
+	tm.session = nil
+	return session
+}
+
+// Session returns the active window, or nil
+func (tm *TroubleshootingMode) Session() *TroubleshootingSession {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	return tm.activeLocked()
+}
+
+// activeLocked returns a copy of the session unless it expired
+func (tm *TroubleshootingMode) activeLocked() *TroubleshootingSession {
+	if tm.session == nil {
+		return nil
+	}
+	if time.Now().After(tm.session.ExpiresAt) {
+		logger.LogWithNode("System", "API", fmt.Sprintf("Troubleshooting mode expired after logging %d requests", tm.session.Logged), "info")
+		tm.session = nil
+		return nil
+	}
+	session := *tm.session
+	session.Routes = append([]string(nil), tm.session.Routes...)
+	return &session
+}
+
+// Matches reports whether requests to the route template (relative to /api) are logged
+// now, and the body size limit in bytes
+func (tm *TroubleshootingMode) Matches(route string) (bool, int) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	session := tm.activeLocked()
+	if session == nil {
+		return false, 0
+	}
+	// The troubleshooting endpoint itself is never logged
+	if route == "/troubleshooting" {
+		return false, 0
+	}
+	if len(session.Routes) > 0 {
+		matched := false
+		for _, candidate := range session.Routes {
+			if candidate == route {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, 0
+		}
+	}
+	return true, tm.config.MaxBodyKB * 1024
+}
+
+// TroubleshootingExchange is one logged request with its response
+type TroubleshootingExchange struct {
+	Route               string // template relative to /api
+	RequestBody         []byte
+	RequestTruncated    bool // the body exceeded max_body_kb
+	Status              int
+	ResponseBody        []byte
+	ResponseTruncated   bool
+	ResponseContentType string
+	Duration            time.Duration
+}
+
+// LogExchange writes one request and response to the log, with sensitive fields of
+// JSON bodies redacted
+func (tm *TroubleshootingMode) LogExchange(r *http.Request, exchange TroubleshootingExchange) {
+	tm.mutex.Lock()
+	if tm.session != nil {
+		tm.session.Logged++
+	}
+	fields := tm.config.RedactFields
+	tm.mutex.Unlock()
+
+	logger.Info().
+		Str("module", "Troubleshooting").
+		Str("request_id", logger.RequestID(r.Context())).
+		Str("caller", auth.Describe(r.Context())).
+		Str("method", r.Method).
+		Str("route", exchange.Route).
+		Str("path", r.URL.Path).
+		Str("query", redactQuery(r, fields)).
+		Str("request_body", describePayload(exchange.RequestBody, exchange.RequestTruncated, r.Header.Get("Content-Type"), fields)).
+		Int("status", exchange.Status).
+		Str("response_body", describePayload(exchange.ResponseBody, exchange.ResponseTruncated, exchange.ResponseContentType, fields)).
+		Dur("duration", exchange.Duration).
+		Msg("Troubleshooting payload")
+}
+
+// describePayload renders a body for the log: redacted JSON, or a size note for
+// anything that cannot be redacted reliably
+func describePayload(body []byte, truncated bool, contentType string, fields []string) string {
+	if truncated {
+		return "[body larger than troubleshooting.max_body_kb, not logged]"
+	}
+	if len(body) == 0 {
+		return ""
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Sprintf("[%d bytes of %s, not logged]", len(body), contentTypeOrUnknown(contentType))
+	}
+	redacted, _ := json.Marshal(RedactPayload(value, fields))
+	return string(redacted)
+}
+
+func contentTypeOrUnknown(contentType string) string {
+	if contentType == "" {
+		return "unknown content type"
+	}
+	return contentType
+}
+
+// redactQuery returns the query string with the values of sensitive parameters replaced
+func redactQuery(r *http.Request, fields []string) string {
+	query := r.URL.Query()
+	for name := range query {
+		if sensitiveField(name, fields) {
+			query[name] = []string{redactedValue}
+		}
+	}
+	return query.Encode()
+}
+
+// RedactPayload returns a copy of a decoded JSON value with the values of sensitive
+// keys replaced, at any depth
+func RedactPayload(value interface{}, fields []string) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			if sensitiveField(key, fields) {
+				copied[key] = redactedValue
+			} else {
+				copied[key] = RedactPayload(item, fields)
+			}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, item := range typed {
+			copied[i] = RedactPayload(item, fields)
+		}
+		return copied
+	}
+	return value
+}
+
+// sensitiveField reports whether a key contains one of the redacted field names. The
+// API key itself is sent as "key" when minted, so that exact name is redacted too.
+func sensitiveField(key string, fields []string) bool {
+	normalized := normalizeFieldName(key)
+	if normalized == "key" {
+		return true
+	}
+	for _, field := range fields {
+		if field != "" && strings.Contains(normalized, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+// HandleAPIGetTroubleshooting Handles GET /api/troubleshooting
+// Returns the active payload logging window, if any, and the settings
+func HandleAPIGetTroubleshooting(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"active":  Troubleshooting.Session() != nil,
+			"session": Troubleshooting.Session(),
+			"config":  Troubleshooting.Config(),
+		},
+	})
+}
+
+// HandleAPIStartTroubleshooting Handles PUT /api/troubleshooting
+// Body: {"minutes": 15, "routes": ["/simulation/start"]}. Without routes every API
+// request is logged until the window expires.
+func HandleAPIStartTroubleshooting(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Minutes int      `json:"minutes"`
+		Routes  []string `json:"routes"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	startedBy := auth.Describe(r.Context())
+	session, err := Troubleshooting.Start(request.Routes, request.Minutes, startedBy)
+	if err != nil {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	scope := "all routes"
+	if len(session.Routes) > 0 {
+		scope = strings.Join(session.Routes, ", ")
+	}
+	message := fmt.Sprintf("Troubleshooting mode on for %s until %s", scope, session.ExpiresAt.Format(time.RFC3339))
+	logger.LogWithNode("System", "API", fmt.Sprintf("%s, started by %s", message, startedBy), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    session,
+	})
+}
+
+// HandleAPIStopTroubleshooting Handles DELETE /api/troubleshooting
+func HandleAPIStopTroubleshooting(w http.ResponseWriter, r *http.Request) {
+	session := Troubleshooting.Stop()
+	if session == nil {
+		SendJSONResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Troubleshooting mode was not active",
+		})
+		return
+	}
+
+	message := fmt.Sprintf("Troubleshooting mode off after logging %d requests", session.Logged)
+	logger.LogWithNode("System", "API", fmt.Sprintf("%s, stopped by %s", message, auth.Describe(r.Context())), "info")
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    session,
+	})
+}
@@ -1,14 +1,19 @@
 package handlers
 
 import (
-	"sync"
 	"time"
+	"vuDataSim/src/auth"
+	"vuDataSim/src/availability"
 	"vuDataSim/src/bin_control"
-	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/buildinfo"
+	"vuDataSim/src/distribution"
+	"vuDataSim/src/ha"
+	"vuDataSim/src/jobs"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/nodeclient"
+	"vuDataSim/src/notify"
 	"vuDataSim/src/o11y_source_manager"
-
-	"github.com/gorilla/websocket"
+	"vuDataSim/src/runs"
 )
 
 type ProcessMetrics struct {
@@ -37,45 +42,34 @@ type APIResponse struct {
 }
 
 type SimulationConfig struct {
+	Name             string `json:"name,omitempty"` // recorded on the run, required by POST /api/runs
 	Profile          string `json:"profile"`
+	Scenario         string `json:"scenario,omitempty"` // groups runs for baseline comparison, defaults to the profile
 	TargetEPS        int    `json:"targetEps"`
-	TargetKafka      int    `json:"targetKafka"`
-	TargetClickHouse int    `json:"targetClickHouse"`
-}
-
-type AppStates struct {
-	IsSimulationRunning bool                                 `json:"isSimulationRunning"`
-	CurrentProfile      string                               `json:"currentProfile"`
-	TargetEPS           int                                  `json:"targetEps"`
-	TargetKafka         int                                  `json:"targetKafka"`
-	TargetClickHouse    int                                  `json:"targetClickHouse"`
-	StartTime           time.Time                            `json:"startTime"`
-	NodeData            map[string]*node_control.NodeMetrics `json:"nodeData"`
-	ClickHouseMetrics   *clickhouse.ClickHouseMetrics        `json:"clickHouseMetrics,omitempty"`
-	Mutex               sync.RWMutex
-	Clients             map[*websocket.Conn]bool
-	Broadcast           chan []byte
-}
-
-// Broadcast updates to all WebSocket clients
-
-var AppState = &AppStates{
-	IsSimulationRunning: false,
-	CurrentProfile:      "medium",
-	TargetEPS:           10000,
-	TargetKafka:         5000,
-	TargetClickHouse:    2000,
-	NodeData:            make(map[string]*node_control.NodeMetrics),
-	Clients:             make(map[*websocket.Conn]bool),
-	Broadcast:           make(chan []byte, 256),
+	TargetKafka      int    `json:"targetKafka"`               // expected ingest on the monitored Kafka topics, msg/s; 0 for none
+	TargetClickHouse int    `json:"targetClickHouse"`          // expected inserts into the enabled sources' tables, rows/s; 0 for none
+	DurationMinutes  int    `json:"durationMinutes,omitempty"` // intended duration, checked by the watchdog
+	SkipTableCheck   bool   `json:"skipTableCheck,omitempty"`  // start without verifying the ClickHouse tables
+	Workspace        string `json:"workspace,omitempty"`       // where artifacts are uploaded, defaults to the caller's team
+	TemporaryTopics  bool   `json:"temporaryTopics,omitempty"` // the sources write to Kafka topics of the run's own
 }
 
 const (
-	AppVersion = "1.0.0"
-	StaticDir  = "./static"
-	Port       = "164.52.213.158:8086"
+	StaticDir = "./static"
+	Port      = "164.52.213.158:8086"
 )
 
+// AppVersion is the manager version, see buildinfo
+var AppVersion = buildinfo.Version
+
 var NodeManager = node_control.NewNodeManager()
 var O11yManager = o11y_source_manager.NewO11ySourceManager()
 var BinaryControl = bin_control.NewBinaryControl()
+var RunStore = runs.NewRunManager()
+var TransferScheduler = jobs.NewScheduler()
+var FileDistribution = distribution.NewService(TransferScheduler)
+var Auth = auth.NewManager()
+var HA = ha.NewElector()
+var Availability = availability.NewTracker()
+var Notifier = notify.NewNotifier()
+var NodeClient = nodeclient.NewPool()
@@ -8,8 +8,7 @@ import (
 	"os"
 	"strconv"
 	"time"
-
-	"github.com/gorilla/websocket"
+	"vuDataSim/src/timeutil"
 )
 
 func SendJSONResponse(w http.ResponseWriter, status int, response APIResponse) {
@@ -60,10 +59,10 @@ func ReadLogsFromFile() []map[string]interface{} {
 func ParseZerologTimestamp(timeInterface interface{}) string {
 	if timeStr, ok := timeInterface.(string); ok {
 		if t, err := time.Parse(time.RFC3339, timeStr); err == nil {
-			return t.Format("2006-01-02 15:04:05")
+			return timeutil.Format(t)
 		}
 	}
-	return time.Now().Format("2006-01-02 15:04:05")
+	return timeutil.Format(time.Now())
 }
 
 func GetLogField(entry map[string]interface{}, field, defaultValue string) string {
@@ -183,29 +182,43 @@ func GetLogs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// BroadcastUpdate sends a snapshot of the state to all WebSocket clients
 func (state *AppStates) BroadcastUpdate() {
-	data, err := json.Marshal(state)
+	data, err := json.Marshal(state.Snapshot())
 	if err != nil {
 		log.Printf("Error marshaling state: %v", err)
 		return
 	}
+	state.broadcast(data)
+}
 
-	state.Mutex.RLock()
-	Clients := make([]*websocket.Conn, 0, len(state.Clients))
-	for client := range state.Clients {
-		Clients = append(Clients, client)
-	}
-	state.Mutex.RUnlock()
+// Event is a named notification pushed to WebSocket clients between state updates.
+// Clients tell them apart from state updates by "type": "event".
+type Event struct {
+	Type      string      `json:"type"`
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
 
-	for _, client := range Clients {
-		go func(c *websocket.Conn) {
-			if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				state.Mutex.Lock()
-				delete(state.Clients, c)
-				state.Mutex.Unlock()
-				c.Close()
-			}
-		}(client)
+// BroadcastEvent sends a named event to all WebSocket clients and keeps it in the
+// event history
+func (state *AppStates) BroadcastEvent(name string, payload interface{}) {
+	now := timeutil.Now()
+	EventHistory.Record(HistoryEvent{Time: now, Type: name, Source: EventSourceWebSocket, Data: payload})
+	data, err := json.Marshal(Event{
+		Type:      "event",
+		Event:     name,
+		Timestamp: now,
+		Data:      payload,
+	})
+	if err != nil {
+		log.Printf("Error marshaling event %s: %v", name, err)
+		return
 	}
+	state.broadcast(data)
+}
+
+func (state *AppStates) broadcast(data []byte) {
+	state.queue(data)
 }
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+	"vuDataSim/src/buildinfo"
+	"vuDataSim/src/node_control"
+)
+
+// AgentBuild is the build a node agent reports, or the one the manager's copy of the
+// agent binary would deploy
+type AgentBuild struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+}
+
+// Matches reports whether an agent runs this build. Commits are compared when both are
+// known, since versions from git describe stay the same across local rebuilds.
+func (b AgentBuild) Matches(other AgentBuild) bool {
+	if b.Commit != "" && other.Commit != "" {
+		return b.Commit == other.Commit
+	}
+	return b.Version == other.Version
+}
+
+// localAgentBuild caches the -version output of the local agent binary per file revision
+var localAgentBuild struct {
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	build   *AgentBuild
+}
+
+// LocalAgentBuild returns the build of node_control.LocalMetricsBinary, the agent binary
+// deployed to nodes, by running it with -version
+func LocalAgentBuild() (*AgentBuild, error) {
+	info, err := os.Stat(node_control.LocalMetricsBinary)
+	if err != nil {
+		return nil, fmt.Errorf("agent binary %s not found: %v", node_control.LocalMetricsBinary, err)
+	}
+
+	localAgentBuild.mutex.Lock()
+	defer localAgentBuild.mutex.Unlock()
+	if localAgentBuild.build != nil && info.ModTime().Equal(localAgentBuild.modTime) && info.Size() == localAgentBuild.size {
+		build := *localAgentBuild.build
+		return &build, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, node_control.LocalMetricsBinary, "-version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("agent binary %s does not report its build, rebuild node_metrics_api: %v", node_control.LocalMetricsBinary, err)
+	}
+	var reported struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		BuildDate string `json:"build_date"`
+	}
+	if err := json.Unmarshal(output, &reported); err != nil || reported.Version == "" {
+		return nil, fmt.Errorf("agent binary %s printed an invalid build", node_control.LocalMetricsBinary)
+	}
+	build := AgentBuild{Version: reported.Version, Commit: reported.Commit, BuildDate: reported.BuildDate}
+	localAgentBuild.modTime, localAgentBuild.size, localAgentBuild.build = info.ModTime(), info.Size(), &build
+	return &build, nil
+}
+
+// VersionInfo is the body of GET /api/version
+type VersionInfo struct {
+	Manager    buildinfo.Info `json:"manager"`
+	Agent      *AgentBuild    `json:"agent,omitempty"` // what an agent deployment or upgrade installs
+	AgentError string         `json:"agentError,omitempty"`
+}
+
+// HandleAPIGetVersion Handles GET /api/version
+// Returns the manager's version, commit and build date, and the build of the agent binary
+// it deploys to nodes
+func HandleAPIGetVersion(w http.ResponseWriter, r *http.Request) {
+	info := VersionInfo{Manager: buildinfo.Get()}
+	agent, err := LocalAgentBuild()
+	if err != nil {
+		info.AgentError = err.Error()
+	}
+	info.Agent = agent
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("vuDataSim manager %s", info.Manager.Version),
+		Data:    info,
+	})
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ViewLagConfig holds the view_lag section of config.yaml
+type ViewLagConfig struct {
+	Enabled              bool   `yaml:"enabled" json:"enabled"`
+	CheckIntervalSeconds int    `yaml:"check_interval_seconds" json:"checkIntervalSeconds"`
+	ThresholdSeconds     int    `yaml:"threshold_seconds" json:"thresholdSeconds"`
+	TimestampColumn      string `yaml:"timestamp_column" json:"timestampColumn"`
+	// A table's view is its name with the _data suffix replaced by ViewSuffix, e.g.
+	// vmetrics_linux_cpu_data -> vmetrics_linux_cpu_view. Tables without such a view are skipped.
+	ViewSuffix string `yaml:"view_suffix" json:"viewSuffix"`
+	// Views maps tables to views that do not follow the naming rule; an empty view skips the table
+	Views map[string]string `yaml:"views" json:"views,omitempty"`
+}
+
+// ViewLag compares one source table with the view derived from it
+type ViewLag struct {
+	Source      string     `json:"source"`
+	Table       string     `json:"table"`
+	View        string     `json:"view"`
+	TableLatest *time.Time `json:"tableLatest,omitempty"`
+	ViewLatest  *time.Time `json:"viewLatest,omitempty"`
+	// LagSeconds is how far the view's newest row trails the table's; unknown while the
+	// view has no rows in the last hour
+	LagSeconds *float64   `json:"lagSeconds,omitempty"`
+	EmptySince *time.Time `json:"emptySince,omitempty"` // the table has rows, the view none
+	Lagging    bool       `json:"lagging"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ViewLagAlert is a view the check found lagging during the current run
+type ViewLagAlert struct {
+	View     string    `json:"view"`
+	Table    string    `json:"table"`
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raisedAt"`
+}
+
+// ViewLagStatus is the response of GET /api/clickhouse/views/lag
+type ViewLagStatus struct {
+	Config    ViewLagConfig  `json:"config"`
+	RunID     string         `json:"runId,omitempty"`
+	LastCheck *time.Time     `json:"lastCheck,omitempty"`
+	Views     []ViewLag      `json:"views"`
+	Error     string         `json:"error,omitempty"`
+	Alerts    []ViewLagAlert `json:"alerts"`
+}
+
+// ViewLagMonitor detects views falling behind the tables they are derived from during a
+// run. Dashboards read the views, so a stale view silently invalidates the results.
+type ViewLagMonitor struct {
+	mutex      sync.Mutex
+	status     ViewLagStatus
+	emptySince map[string]time.Time // per view, during the current run
+}
+
+var ViewLagCheck = &ViewLagMonitor{
+	status: ViewLagStatus{Config: defaultViewLagConfig()},
+}
+
+func defaultViewLagConfig() ViewLagConfig {
+	return ViewLagConfig{
+		Enabled:              true,
+		CheckIntervalSeconds: 60,
+		ThresholdSeconds:     120,
+		TimestampColumn:      "timestamp",
+		ViewSuffix:           "_view",
+	}
+}
+
+// LoadConfig reads the view_lag section from the application config file
+func (vl *ViewLagMonitor) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultViewLagConfig()
+	fileConfig := struct {
+		ViewLag *ViewLagConfig `yaml:"view_lag"`
+	}{ViewLag: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.CheckIntervalSeconds <= 0 {
+		config.CheckIntervalSeconds = 60
+	}
+	if config.ThresholdSeconds <= 0 {
+		config.ThresholdSeconds = 120
+	}
+	if config.TimestampColumn == "" {
+		config.TimestampColumn = "timestamp"
+	}
+	if config.ViewSuffix == "" {
+		config.ViewSuffix = "_view"
+	}
+
+	vl.mutex.Lock()
+	vl.status.Config = config
+	vl.mutex.Unlock()
+	return nil
+}
+
+// Start runs the view lag checks in the background
+func (vl *ViewLagMonitor) Start() {
+	vl.mutex.Lock()
+	config := vl.status.Config
+	vl.mutex.Unlock()
+
+	if !config.Enabled {
+		log.Println("ClickHouse view lag check disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.CheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			vl.Check(time.Now())
+		}
+	}()
+}
+
+// Status returns a copy of the current view lag state
+func (vl *ViewLagMonitor) Status() ViewLagStatus {
+	vl.mutex.Lock()
+	defer vl.mutex.Unlock()
+
+	status := vl.status
+	status.Views = append([]ViewLag{}, vl.status.Views...)
+	status.Alerts = append([]ViewLagAlert{}, vl.status.Alerts...)
+	return status
+}
+
+// Check measures the view lag of the running simulation once and alerts about views
+// lagging by more than threshold_seconds, once per view and run
+func (vl *ViewLagMonitor) Check(now time.Time) {
+	sim := AppState.Simulation()
+	runID := sim.RunID
+
+	vl.mutex.Lock()
+	config := vl.status.Config
+	if !sim.Running {
+		vl.status = ViewLagStatus{Config: config, LastCheck: &now}
+		vl.emptySince = nil
+		vl.mutex.Unlock()
+		return
+	}
+	if vl.status.RunID != runID {
+		// A new run started since the last check
+		vl.status = ViewLagStatus{Config: config, RunID: runID}
+		vl.emptySince = make(map[string]time.Time)
+	}
+	vl.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	views, err := measureViewLag(ctx, config)
+
+	vl.mutex.Lock()
+	if vl.status.RunID != runID {
+		// The run ended while measuring
+		vl.mutex.Unlock()
+		return
+	}
+	vl.status.LastCheck = &now
+	vl.status.Error = ""
+	if err != nil {
+		vl.status.Error = err.Error()
+		vl.mutex.Unlock()
+		log.Printf("Warning: Failed to check ClickHouse view lag: %v", err)
+		return
+	}
+
+	threshold := time.Duration(config.ThresholdSeconds) * time.Second
+	var raised []ViewLagAlert
+	for i := range views {
+		view := &views[i]
+		var message string
+		switch {
+		case view.LagSeconds != nil:
+			delete(vl.emptySince, view.View)
+			if *view.LagSeconds > threshold.Seconds() {
+				view.Lagging = true
+				message = fmt.Sprintf("View %s lags %s by %.0fs", view.View, view.Table, *view.LagSeconds)
+			}
+		case view.TableLatest != nil:
+			since, ok := vl.emptySince[view.View]
+			if !ok {
+				since = now
+				vl.emptySince[view.View] = since
+			}
+			view.EmptySince = &since
+			if emptyFor := now.Sub(since); emptyFor >= threshold {
+				view.Lagging = true
+				message = fmt.Sprintf("View %s has no rows for %s while %s is receiving rows", view.View, emptyFor.Round(time.Second), view.Table)
+			}
+		default:
+			delete(vl.emptySince, view.View)
+		}
+		if message != "" {
+			if alert, ok := vl.raiseLocked(view.View, view.Table, message, now); ok {
+				raised = append(raised, alert)
+			}
+		}
+	}
+	vl.status.Views = views
+	vl.mutex.Unlock()
+
+	for _, alert := range raised {
+		logger.LogWarning("System", "ClickHouse", alert.Message)
+		sendNotification(notify.Message{
+			Subject:  fmt.Sprintf("vuDataSim: ClickHouse view %s is lagging", alert.View),
+			Text:     fmt.Sprintf("Run %s: %s. Dashboards reading the view show stale data.", runID, alert.Message),
+			Severity: notify.SeverityWarning,
+			Event:    notify.EventViewLag,
+		})
+		if err := RunStore.AddTimelineEvent(runID, "view_lag", alert.Message, map[string]interface{}{"view": alert.View, "table": alert.Table}); err != nil {
+			log.Printf("Warning: Failed to record view lag for run %s: %v", runID, err)
+		}
+	}
+}
+
+// raiseLocked records an alert once per run and view; callers must hold vl.mutex
+func (vl *ViewLagMonitor) raiseLocked(view, table, message string, now time.Time) (ViewLagAlert, bool) {
+	for i, existing := range vl.status.Alerts {
+		if existing.View == view {
+			vl.status.Alerts[i].Message = message
+			return existing, false
+		}
+	}
+	alert := ViewLagAlert{View: view, Table: table, Message: message, RaisedAt: now}
+	vl.status.Alerts = append(vl.status.Alerts, alert)
+	return alert, true
+}
+
+// viewOf returns the view derived from a table and whether it was configured explicitly
+func viewOf(table string, config ViewLagConfig) (string, bool) {
+	if view, ok := config.Views[table]; ok {
+		return view, true
+	}
+	if strings.HasSuffix(table, config.ViewSuffix) {
+		return "", false // a view itself
+	}
+	return strings.TrimSuffix(table, "_data") + config.ViewSuffix, false
+}
+
+// measureViewLag compares the newest timestamp of every table of the enabled sources with
+// that of its view. Derived views that do not exist are skipped; configured ones are
+// reported with an error.
+func measureViewLag(ctx context.Context, config ViewLagConfig) ([]ViewLag, error) {
+	if topicMapping == nil {
+		return nil, fmt.Errorf("topics_tables.yaml mapping not loaded")
+	}
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read conf.yml: %v", err)
+	}
+
+	var views []ViewLag
+	explicit := make(map[string]bool)
+	var candidates []string
+	for _, source := range O11yManager.GetEnabledSources() {
+		topicConfig, ok := topicMapping.SourceConfig(source)
+		if !ok {
+			continue
+		}
+		for _, table := range topicConfig.ClickhouseTables {
+			view, configured := viewOf(table, config)
+			if view == "" {
+				continue
+			}
+			views = append(views, ViewLag{Source: source, Table: table, View: view})
+			explicit[view] = explicit[view] || configured
+			candidates = append(candidates, view)
+		}
+	}
+	if len(views) == 0 {
+		return []ViewLag{}, nil
+	}
+
+	missing, err := clickhouse.MissingTables(ctx, candidates)
+	if err != nil {
+		return nil, err
+	}
+	absent := make(map[string]bool, len(missing))
+	for _, view := range missing {
+		absent[view] = true
+	}
+
+	var tables []string
+	present := views[:0]
+	for _, view := range views {
+		switch {
+		case !absent[view.View]:
+			tables = append(tables, view.Table, view.View)
+		case explicit[view.View]:
+			view.Error = "view not found"
+		default:
+			continue
+		}
+		present = append(present, view)
+	}
+	views = present
+
+	latest, err := clickhouse.LatestTimestamps(ctx, tables, config.TimestampColumn)
+	if err != nil {
+		return nil, err
+	}
+	for i := range views {
+		view := &views[i]
+		if view.Error != "" {
+			continue
+		}
+		if t, ok := latest[view.Table]; ok {
+			view.TableLatest = &t
+		}
+		if t, ok := latest[view.View]; ok {
+			view.ViewLatest = &t
+		}
+		if view.TableLatest != nil && view.ViewLatest != nil {
+			// A view ahead of its table, e.g. from a later insert, does not lag
+			lag := max(view.TableLatest.Sub(*view.ViewLatest).Seconds(), 0)
+			view.LagSeconds = &lag
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Table < views[j].Table })
+	return views, nil
+}
+
+// HandleAPIGetViewLag Handles GET /api/clickhouse/views/lag
+// Returns the view lag of the current run and its alerts. With ?refresh=true the views are
+// measured now, also between runs; alerts are only raised by the periodic check.
+func HandleAPIGetViewLag(w http.ResponseWriter, r *http.Request) {
+	status := ViewLagCheck.Status()
+	if r.URL.Query().Get("refresh") == "true" {
+		views, err := measureViewLag(r.Context(), status.Config)
+		if err != nil {
+			SendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to measure view lag: %v", err),
+			})
+			return
+		}
+		threshold := float64(status.Config.ThresholdSeconds)
+		for i := range views {
+			views[i].Lagging = views[i].LagSeconds != nil && *views[i].LagSeconds > threshold
+		}
+		now := time.Now()
+		status.Views, status.LastCheck, status.Error = views, &now, ""
+	}
+
+	lagging := 0
+	for _, view := range status.Views {
+		if view.Lagging {
+			lagging++
+		}
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d of %d views lagging", lagging, len(status.Views)),
+		Data:    status,
+	})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VolumeEstimateConfig holds the volume_estimate section of config.yaml
+type VolumeEstimateConfig struct {
+	DefaultMessageBytes int            `yaml:"default_message_bytes" json:"defaultMessageBytes"`
+	MessageBytes        map[string]int `yaml:"message_bytes" json:"messageBytes"` // average message size per source, over the source catalog's
+	KafkaReplication    int            `yaml:"kafka_replication" json:"kafkaReplication"`
+	KafkaCapacityGB     float64        `yaml:"kafka_capacity_gb" json:"kafkaCapacityGb"` // free broker disk; 0 skips the check
+	CompressionRatio    float64        `yaml:"clickhouse_compression_ratio" json:"clickhouseCompressionRatio"`
+	DiskHeadroomPct     float64        `yaml:"disk_headroom_pct" json:"diskHeadroomPct"` // share of a disk to keep free
+	TimeoutSeconds      int            `yaml:"timeout_seconds" json:"timeoutSeconds"`
+}
+
+// SourceVolumeEstimate is the data one source generates over the run
+type SourceVolumeEstimate struct {
+	Source          string `json:"source"`
+	EPS             int    `json:"eps"`
+	MessageBytes    int    `json:"messageBytes"`
+	Messages        uint64 `json:"messages"`
+	KafkaBytes      uint64 `json:"kafkaBytes"` // produced, before replication
+	ClickHouseBytes uint64 `json:"clickhouseBytes"`
+}
+
+// VolumeEstimate is the data a run would generate and whether the cluster can hold it
+type VolumeEstimate struct {
+	TotalEPS         int                    `json:"totalEps"`
+	DurationMinutes  int                    `json:"durationMinutes"`
+	Messages         uint64                 `json:"messages"`
+	KafkaBytes       uint64                 `json:"kafkaBytes"`       // produced, before replication
+	KafkaStoredBytes uint64                 `json:"kafkaStoredBytes"` // on broker disks, with replication
+	ClickHouseBytes  uint64                 `json:"clickhouseBytes"`
+	Sources          []SourceVolumeEstimate `json:"sources"`
+	ClickHouseDisks  []clickhouse.DiskSpace `json:"clickhouseDisks,omitempty"`
+	Fits             bool                   `json:"fits"` // false when a disk would run out of space
+	Warnings         []string               `json:"warnings,omitempty"`
+	Config           VolumeEstimateConfig   `json:"assumptions"`
+}
+
+// RunVolumeEstimator estimates how much data a run would produce before it starts, so
+// operators learn about a full Kafka or ClickHouse disk before the run instead of during it
+type RunVolumeEstimator struct {
+	mutex  sync.Mutex
+	config VolumeEstimateConfig
+}
+
+var VolumeEstimator = &RunVolumeEstimator{config: defaultVolumeEstimateConfig()}
+
+func defaultVolumeEstimateConfig() VolumeEstimateConfig {
+	return VolumeEstimateConfig{
+		DefaultMessageBytes: 1024,
+		KafkaReplication:    1,
+		CompressionRatio:    8,
+		DiskHeadroomPct:     10,
+		TimeoutSeconds:      10,
+	}
+}
+
+// LoadConfig reads the volume_estimate section from the application config file
+func (ve *RunVolumeEstimator) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := defaultVolumeEstimateConfig()
+	fileConfig := struct {
+		VolumeEstimate *VolumeEstimateConfig `yaml:"volume_estimate"`
+	}{VolumeEstimate: &config}
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.DefaultMessageBytes <= 0 {
+		config.DefaultMessageBytes = 1024
+	}
+	if config.KafkaReplication <= 0 {
+		config.KafkaReplication = 1
+	}
+	if config.CompressionRatio <= 0 {
+		config.CompressionRatio = 1
+	}
+	if config.DiskHeadroomPct < 0 || config.DiskHeadroomPct >= 100 {
+		config.DiskHeadroomPct = 10
+	}
+	if config.TimeoutSeconds <= 0 {
+		config.TimeoutSeconds = 10
+	}
+
+	ve.mutex.Lock()
+	ve.config = config
+	ve.mutex.Unlock()
+	return nil
+}
+
+// Config returns the estimator settings
+func (ve *RunVolumeEstimator) Config() VolumeEstimateConfig {
+	ve.mutex.Lock()
+	defer ve.mutex.Unlock()
+	return ve.config
+}
+
+// Estimate computes the data of a run at totalEPS over durationMinutes. The EPS is split
+// across the sources in proportion to their max EPS, as a distribution would split it.
+// A ClickHouse that cannot be reached only adds a warning.
+func (ve *RunVolumeEstimator) Estimate(ctx context.Context, sources []string, totalEPS, durationMinutes int) *VolumeEstimate {
+	config := ve.Config()
+	estimate := &VolumeEstimate{
+		TotalEPS:        totalEPS,
+		DurationMinutes: durationMinutes,
+		Sources:         []SourceVolumeEstimate{},
+		Fits:            true,
+		Config:          config,
+	}
+
+	seconds := uint64(durationMinutes) * 60
+	for source, eps := range splitEstimateEPS(sources, totalEPS, O11yManager.GetMaxEPSConfig()) {
+		size, ok := config.MessageBytes[source]
+		if !ok || size <= 0 {
+			size = O11yManager.TypicalMessageBytes(source)
+		}
+		if size <= 0 {
+			size = config.DefaultMessageBytes
+		}
+		messages := uint64(eps) * seconds
+		kafkaBytes := messages * uint64(size)
+		estimate.Sources = append(estimate.Sources, SourceVolumeEstimate{
+			Source:          source,
+			EPS:             eps,
+			MessageBytes:    size,
+			Messages:        messages,
+			KafkaBytes:      kafkaBytes,
+			ClickHouseBytes: uint64(float64(kafkaBytes) / config.CompressionRatio),
+		})
+	}
+	sort.Slice(estimate.Sources, func(i, j int) bool { return estimate.Sources[i].Source < estimate.Sources[j].Source })
+	for _, source := range estimate.Sources {
+		estimate.Messages += source.Messages
+		estimate.KafkaBytes += source.KafkaBytes
+		estimate.ClickHouseBytes += source.ClickHouseBytes
+	}
+	estimate.KafkaStoredBytes = estimate.KafkaBytes * uint64(config.KafkaReplication)
+
+	if config.KafkaCapacityGB > 0 {
+		capacity := uint64(config.KafkaCapacityGB * (1 << 30))
+		if usable := headroomBytes(capacity, capacity, config.DiskHeadroomPct); estimate.KafkaStoredBytes > usable {
+			estimate.Fits = false
+			estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("Kafka would store %s with replication %d, more than the %s usable of kafka_capacity_gb",
+				formatBytes(estimate.KafkaStoredBytes), config.KafkaReplication, formatBytes(usable)))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.TimeoutSeconds)*time.Second)
+	defer cancel()
+	disks, err := clickhouse.DiskSpaces(ctx)
+	if err != nil {
+		estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("ClickHouse disk space could not be checked: %v", err))
+	} else {
+		estimate.ClickHouseDisks = disks
+		var free, total uint64
+		for _, disk := range disks {
+			free += disk.FreeBytes
+			total += disk.TotalBytes
+		}
+		if usable := headroomBytes(free, total, config.DiskHeadroomPct); estimate.ClickHouseBytes > usable {
+			estimate.Fits = false
+			estimate.Warnings = append(estimate.Warnings, fmt.Sprintf("ClickHouse would grow by %s, but only %s is free beyond the %.0f%% headroom",
+				formatBytes(estimate.ClickHouseBytes), formatBytes(usable), config.DiskHeadroomPct))
+		}
+	}
+	return estimate
+}
+
+// splitEstimateEPS splits the EPS in proportion to the sources' max EPS, or evenly when
+// a source has none
+func splitEstimateEPS(sources []string, totalEPS int, maxEPS map[string]int) map[string]int {
+	split := make(map[string]int, len(sources))
+	totalMax := 0
+	for _, source := range sources {
+		if maxEPS[source] <= 0 {
+			totalMax = 0
+			break
+		}
+		totalMax += maxEPS[source]
+	}
+
+	remaining := totalEPS
+	for i, source := range sources {
+		eps := totalEPS / len(sources)
+		if totalMax > 0 {
+			eps = int(float64(totalEPS) * float64(maxEPS[source]) / float64(totalMax))
+		}
+		if i == len(sources)-1 {
+			eps = remaining // the last source takes the rounding remainder
+		}
+		split[source] = eps
+		remaining -= eps
+	}
+	return split
+}
+
+// headroomBytes is the part of free that can be used while keeping headroomPct of
+// total free
+func headroomBytes(free, total uint64, headroomPct float64) uint64 {
+	reserved := uint64(float64(total) * headroomPct / 100)
+	if free <= reserved {
+		return 0
+	}
+	return free - reserved
+}
+
+func formatBytes(bytes uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// HandleAPIEstimateVolume Handles GET /api/o11y/estimate?eps=&durationMinutes=&sources=
+// Estimates the messages, Kafka bytes and ClickHouse growth of a run. sources is a
+// comma-separated list and defaults to the sources enabled in conf.yml. Data.fits is
+// false, with warnings, when a Kafka or ClickHouse disk would run out of space.
+func HandleAPIEstimateVolume(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eps, err := strconv.Atoi(query.Get("eps"))
+	if err != nil || eps < 1 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "eps must be a positive number",
+		})
+		return
+	}
+	durationMinutes, err := strconv.Atoi(query.Get("durationMinutes"))
+	if err != nil || durationMinutes < 1 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "durationMinutes must be a positive number",
+		})
+		return
+	}
+
+	var sources []string
+	if selected := filterSet(query.Get("sources")); selected != nil {
+		for source := range selected {
+			if !O11yManager.IsKnownSource(source) {
+				SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Unknown source %s", source),
+				})
+				return
+			}
+			sources = append(sources, source)
+		}
+	} else {
+		if err := O11yManager.LoadMainConfig(); err != nil {
+			SendJSONResponse(w, http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to read conf.yml: %v", err),
+			})
+			return
+		}
+		sources = O11yManager.GetEnabledSources()
+	}
+	if len(sources) == 0 {
+		SendJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "No sources selected and none enabled in conf.yml",
+		})
+		return
+	}
+	sort.Strings(sources)
+
+	estimate := VolumeEstimator.Estimate(r.Context(), sources, eps, durationMinutes)
+	message := fmt.Sprintf("%d EPS for %d minutes generates %d messages: %s to Kafka, about %s in ClickHouse",
+		eps, durationMinutes, estimate.Messages, formatBytes(estimate.KafkaBytes), formatBytes(estimate.ClickHouseBytes))
+	if !estimate.Fits {
+		message += "; the cluster does not have the disk space for it"
+	}
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: message,
+		Data:    estimate,
+	})
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"vuDataSim/src/clickhouse"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/notify"
+	"vuDataSim/src/runs"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Watchdog reasons
+const (
+	WatchdogReasonOverrun = "overrun"
+	WatchdogReasonIdle    = "idle"
+	// The run's targetKafka or targetClickHouse rate is missed for below_target_minutes
+	WatchdogReasonKafkaBelowTarget      = "kafka_below_target"
+	WatchdogReasonClickHouseBelowTarget = "clickhouse_below_target"
+)
+
+// WatchdogConfig holds the watchdog section of config.yaml
+type WatchdogConfig struct {
+	Enabled                   bool `yaml:"enabled" json:"enabled"`
+	CheckIntervalSeconds      int  `yaml:"check_interval_seconds" json:"checkIntervalSeconds"`
+	DefaultMaxDurationMinutes int  `yaml:"default_max_duration_minutes" json:"defaultMaxDurationMinutes"` // used when a run has no duration
+	OverrunGraceMinutes       int  `yaml:"overrun_grace_minutes" json:"overrunGraceMinutes"`
+	IdleMinutes               int  `yaml:"idle_minutes" json:"idleMinutes"`
+	// A rate below its target by more than TargetTolerancePct for BelowTargetMinutes is
+	// warned about; 0 minutes disables the target checks
+	TargetTolerancePct int  `yaml:"target_tolerance_pct" json:"targetTolerancePct"`
+	BelowTargetMinutes int  `yaml:"below_target_minutes" json:"belowTargetMinutes"`
+	AutoStop           bool `yaml:"auto_stop" json:"autoStop"` // overrun and idle only, not missed targets
+	StopBinaries       bool `yaml:"stop_binaries" json:"stopBinaries"`
+}
+
+// WatchdogWarning is a condition the watchdog raised for the current run
+type WatchdogWarning struct {
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	RaisedAt time.Time `json:"raisedAt"`
+}
+
+// WatchdogStatus is the response of GET /api/watchdog
+type WatchdogStatus struct {
+	Config    WatchdogConfig `json:"config"`
+	RunID     string         `json:"runId,omitempty"`
+	LastCheck *time.Time     `json:"lastCheck,omitempty"`
+	IngestEPS *float64       `json:"ingestEps,omitempty"`
+	IdleSince *time.Time     `json:"idleSince,omitempty"`
+	// ClickHouseRowsPerSec is the insert rate into the tables of the enabled sources
+	// since the previous check
+	ClickHouseRowsPerSec *float64          `json:"clickhouseRowsPerSec,omitempty"`
+	KafkaBelowSince      *time.Time        `json:"kafkaBelowTargetSince,omitempty"`
+	ClickHouseBelowSince *time.Time        `json:"clickhouseBelowTargetSince,omitempty"`
+	Warnings             []WatchdogWarning `json:"warnings"`
+	AutoStopped          *WatchdogWarning  `json:"autoStopped,omitempty"`
+}
+
+// SimulationWatchdog detects simulations running far past their intended duration or
+// without downstream ingest, warns about them and optionally stops them
+type SimulationWatchdog struct {
+	mutex  sync.Mutex
+	status WatchdogStatus
+	rows   runRowSamples // kept after the run ends for its summary
+}
+
+// runRowSamples are the first and latest ClickHouse row totals measured during a run
+type runRowSamples struct {
+	runID       string
+	first, last rowSample
+	previous    rowSample
+}
+
+type rowSample struct {
+	rows uint64
+	at   time.Time
+}
+
+var Watchdog = &SimulationWatchdog{
+	status: WatchdogStatus{Config: defaultWatchdogConfig()},
+}
+
+func defaultWatchdogConfig() WatchdogConfig {
+	return WatchdogConfig{
+		Enabled:                   true,
+		CheckIntervalSeconds:      60,
+		DefaultMaxDurationMinutes: 480,
+		OverrunGraceMinutes:       30,
+		IdleMinutes:               15,
+		TargetTolerancePct:        20,
+		BelowTargetMinutes:        10,
+		AutoStop:                  false,
+		StopBinaries:              true,
+	}
+}
+
+// LoadConfig reads the watchdog section from the application config file
+func (wd *SimulationWatchdog) LoadConfig(configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var fileConfig struct {
+		Watchdog *WatchdogConfig `yaml:"watchdog"`
+	}
+	config := defaultWatchdogConfig()
+	fileConfig.Watchdog = &config
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return fmt.Errorf("failed to parse config YAML: %v", err)
+	}
+	if config.CheckIntervalSeconds <= 0 {
+		config.CheckIntervalSeconds = 60
+	}
+
+	wd.mutex.Lock()
+	wd.status.Config = config
+	wd.mutex.Unlock()
+	return nil
+}
+
+// Start runs the watchdog checks in the background
+func (wd *SimulationWatchdog) Start() {
+	wd.mutex.Lock()
+	config := wd.status.Config
+	wd.mutex.Unlock()
+
+	if !config.Enabled {
+		log.Println("Simulation watchdog disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.CheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			wd.Check(time.Now())
+		}
+	}()
+}
+
+// Status returns a copy of the current watchdog state
+func (wd *SimulationWatchdog) Status() WatchdogStatus {
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+
+	status := wd.status
+	status.Warnings = append([]WatchdogWarning{}, wd.status.Warnings...)
+	return status
+}
+
+// Check evaluates the running simulation once
+func (wd *SimulationWatchdog) Check(now time.Time) {
+	sim := AppState.Simulation()
+	running := sim.Running
+	runID := sim.RunID
+	startTime := sim.StartTime
+	durationMinutes := sim.DurationMinutes
+	targetKafka := sim.TargetKafka
+	targetClickHouse := sim.TargetClickHouse
+
+	wd.mutex.Lock()
+	config := wd.status.Config
+	wd.status.LastCheck = &now
+	if !running {
+		wd.status.RunID = ""
+		wd.status.IngestEPS = nil
+		wd.status.IdleSince = nil
+		wd.status.ClickHouseRowsPerSec = nil
+		wd.status.KafkaBelowSince = nil
+		wd.status.ClickHouseBelowSince = nil
+		wd.status.Warnings = nil
+		wd.mutex.Unlock()
+		return
+	}
+	if wd.status.RunID != runID {
+		// A new run started since the last check
+		wd.status = WatchdogStatus{Config: config, RunID: runID, LastCheck: &now}
+	}
+	wd.mutex.Unlock()
+
+	// Only a successful query with no ingest counts as idle; an unreachable
+	// monitoring DB leaves the idle tracking untouched
+	ingest, ingestErr := currentIngestEPS()
+	var insertRate *float64
+	if targetClickHouse > 0 {
+		insertRate = wd.measureClickHouseRows(runID, now)
+	}
+
+	wd.mutex.Lock()
+	var raised []WatchdogWarning
+
+	intended := time.Duration(durationMinutes) * time.Minute
+	if durationMinutes == 0 {
+		intended = time.Duration(config.DefaultMaxDurationMinutes) * time.Minute
+	}
+	if intended > 0 {
+		elapsed := now.Sub(startTime)
+		if elapsed > intended+time.Duration(config.OverrunGraceMinutes)*time.Minute {
+			message := fmt.Sprintf("Simulation has been running for %s, intended duration was %s", elapsed.Round(time.Minute), intended)
+			if w, ok := wd.raiseLocked(WatchdogReasonOverrun, message, now); ok {
+				raised = append(raised, w)
+			}
+		}
+	}
+
+	if ingestErr == nil {
+		wd.status.IngestEPS = &ingest
+		if ingest > 0 {
+			wd.status.IdleSince = nil
+		} else if wd.status.IdleSince == nil {
+			wd.status.IdleSince = &now
+		}
+	}
+	if config.IdleMinutes > 0 && wd.status.IdleSince != nil {
+		idleFor := now.Sub(*wd.status.IdleSince)
+		if idleFor >= time.Duration(config.IdleMinutes)*time.Minute {
+			message := fmt.Sprintf("No downstream ingest on monitored Kafka topics for %s", idleFor.Round(time.Minute))
+			if w, ok := wd.raiseLocked(WatchdogReasonIdle, message, now); ok {
+				raised = append(raised, w)
+			}
+		}
+	}
+
+	wd.status.ClickHouseRowsPerSec = insertRate
+	if config.BelowTargetMinutes > 0 {
+		floor := 1 - float64(config.TargetTolerancePct)/100
+		if ingestErr == nil && targetKafka > 0 {
+			below := ingest < float64(targetKafka)*floor
+			if w, ok := wd.checkTargetLocked(&wd.status.KafkaBelowSince, below, WatchdogReasonKafkaBelowTarget,
+				fmt.Sprintf("Kafka ingest of %.0f msg/s is below the target of %d msg/s", ingest, targetKafka), config, now); ok {
+				raised = append(raised, w)
+			}
+		}
+		if insertRate != nil {
+			below := *insertRate < float64(targetClickHouse)*floor
+			if w, ok := wd.checkTargetLocked(&wd.status.ClickHouseBelowSince, below, WatchdogReasonClickHouseBelowTarget,
+				fmt.Sprintf("ClickHouse inserts of %.0f rows/s are below the target of %d rows/s", *insertRate, targetClickHouse), config, now); ok {
+				raised = append(raised, w)
+			}
+		}
+	}
+
+	var stopFor *WatchdogWarning
+	if config.AutoStop && wd.status.AutoStopped == nil {
+		for _, w := range wd.status.Warnings {
+			if w.Reason == WatchdogReasonOverrun || w.Reason == WatchdogReasonIdle {
+				w := w
+				stopFor = &w
+				break
+			}
+		}
+	}
+	wd.mutex.Unlock()
+
+	for _, w := range raised {
+		logger.LogWarning("System", "Watchdog", w.Message)
+		sendNotification(notify.Message{
+			Subject:  fmt.Sprintf("vuDataSim watchdog: %s", w.Reason),
+			Text:     fmt.Sprintf("Run %s: %s", runID, w.Message),
+			Severity: notify.SeverityWarning,
+			Event:    notify.EventWatchdog,
+		})
+		if err := RunStore.AddTimelineEvent(runID, "watchdog_warning", w.Message, map[string]interface{}{"reason": w.Reason}); err != nil {
+			log.Printf("Warning: Failed to record watchdog warning for run %s: %v", runID, err)
+		}
+	}
+
+	if stopFor != nil {
+		wd.autoStop(runID, *stopFor, config)
+	}
+}
+
+// raiseLocked records a warning once per run and reason; callers must hold wd.mutex
+func (wd *SimulationWatchdog) raiseLocked(reason, message string, now time.Time) (WatchdogWarning, bool) {
+	for i, existing := range wd.status.Warnings {
+		if existing.Reason == reason {
+			wd.status.Warnings[i].Message = message
+			return existing, false
+		}
+	}
+	w := WatchdogWarning{Reason: reason, Message: message, RaisedAt: now}
+	wd.status.Warnings = append(wd.status.Warnings, w)
+	return w, true
+}
+
+// checkTargetLocked tracks since when a rate has been below its target and raises the
+// warning once that lasted below_target_minutes; callers must hold wd.mutex
+func (wd *SimulationWatchdog) checkTargetLocked(since **time.Time, below bool, reason, message string, config WatchdogConfig, now time.Time) (WatchdogWarning, bool) {
+	if !below {
+		*since = nil
+		return WatchdogWarning{}, false
+	}
+	if *since == nil {
+		*since = &now
+	}
+	belowFor := now.Sub(**since)
+	if belowFor < time.Duration(config.BelowTargetMinutes)*time.Minute {
+		return WatchdogWarning{}, false
+	}
+	return wd.raiseLocked(reason, fmt.Sprintf("%s for %s", message, belowFor.Round(time.Minute)), now)
+}
+
+// measureClickHouseRows samples the row total of the enabled sources' tables and returns
+// the insert rate since the previous sample of the run, nil if it is not known yet
+func (wd *SimulationWatchdog) measureClickHouseRows(runID string, now time.Time) *float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	rows, err := clickHouseRowTotal(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to measure ClickHouse inserts: %v", err)
+		return nil
+	}
+
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+	sample := rowSample{rows: rows, at: now}
+	if wd.rows.runID != runID {
+		wd.rows = runRowSamples{runID: runID, first: sample, last: sample, previous: sample}
+		return nil
+	}
+	wd.rows.previous, wd.rows.last = wd.rows.last, sample
+	return rowRate(wd.rows.previous, sample)
+}
+
+// ClickHouseRowRate returns the average ClickHouse insert rate the watchdog measured
+// over a run, or false if the run was too short or had no targetClickHouse
+func (wd *SimulationWatchdog) ClickHouseRowRate(runID string) (float64, bool) {
+	wd.mutex.Lock()
+	defer wd.mutex.Unlock()
+	if wd.rows.runID != runID {
+		return 0, false
+	}
+	rate := rowRate(wd.rows.first, wd.rows.last)
+	if rate == nil {
+		return 0, false
+	}
+	return *rate, true
+}
+
+func rowRate(from, to rowSample) *float64 {
+	elapsed := to.at.Sub(from.at).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+	// Merges and TTLs can shrink the totals; that is no negative insert rate
+	rate := 0.0
+	if to.rows > from.rows {
+		rate = float64(to.rows-from.rows) / elapsed
+	}
+	return &rate
+}
+
+// clickHouseRowTotal sums the rows of the ClickHouse tables of the sources enabled in conf.yml
+func clickHouseRowTotal(ctx context.Context) (uint64, error) {
+	if topicMapping == nil {
+		return 0, fmt.Errorf("topics_tables.yaml mapping not loaded")
+	}
+	if err := O11yManager.LoadMainConfig(); err != nil {
+		return 0, fmt.Errorf("failed to read conf.yml: %v", err)
+	}
+	var tables []string
+	for _, source := range O11yManager.GetEnabledSources() {
+		if topicConfig, ok := topicMapping.SourceConfig(source); ok {
+			tables = append(tables, topicConfig.ClickhouseTables...)
+		}
+	}
+	if len(tables) == 0 {
+		return 0, fmt.Errorf("no ClickHouse tables mapped for the enabled sources")
+	}
+	return clickhouse.TotalRows(ctx, tables)
+}
+
+// autoStop stops the simulation if the flagged run is still the current one
+func (wd *SimulationWatchdog) autoStop(runID string, reason WatchdogWarning, config WatchdogConfig) {
+	stopped := false
+	AppState.UpdateSimulation(func(sim *SimulationState) {
+		if !sim.Running || sim.RunID != runID {
+			return
+		}
+		if runID != "" {
+			RunStore.AddTimelineEvent(runID, "watchdog_auto_stop", "Simulation stopped by watchdog: "+reason.Message, map[string]interface{}{"reason": reason.Reason})
+		}
+		stopSimulation(sim, runs.StatusAutoStopped)
+		stopped = true
+	})
+	if !stopped {
+		return
+	}
+
+	wd.mutex.Lock()
+	wd.status.AutoStopped = &reason
+	wd.mutex.Unlock()
+
+	logger.LogWarning("System", "Watchdog", fmt.Sprintf("Simulation auto-stopped (%s): %s", reason.Reason, reason.Message))
+	sendNotification(notify.Message{
+		Subject:  fmt.Sprintf("vuDataSim watchdog stopped run %s", runID),
+		Text:     fmt.Sprintf("Simulation auto-stopped (%s): %s", reason.Reason, reason.Message),
+		Severity: notify.SeverityCritical,
+		Event:    notify.EventWatchdog,
+	})
+	go AppState.BroadcastUpdate()
+
+	if !config.StopBinaries {
+		return
+	}
+	for nodeName := range BinaryControl.GetEnabledNodes() {
+		if _, err := BinaryControl.StopBinary(nodeName, 60); err != nil {
+			logger.LogWarning(nodeName, "Watchdog", fmt.Sprintf("Failed to stop binary: %v", err))
+			continue
+		}
+		logger.LogWithNode(nodeName, "Watchdog", "Binary stopped by watchdog", "info")
+	}
+}
+
+// currentIngestEPS sums the latest Kafka input rate of all monitored topics. Stale
+// samples are left out; if every sample is stale the rate is unknown, not zero.
+func currentIngestEPS() (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	metrics, err := clickhouse.GetKafkaTopicMetrics(ctx, monitoredKafkaTopics)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	fresh := 0
+	now := time.Now()
+	for _, m := range metrics {
+		if _, stale := Staleness.Evaluate(m.Timestamp, now); stale {
+			continue
+		}
+		fresh++
+		total += m.OneMinuteRate
+	}
+	if len(metrics) > 0 && fresh == 0 {
+		return 0, fmt.Errorf("all Kafka topic metrics are older than %s", Staleness.Threshold())
+	}
+	return total, nil
+}
+
+// HandleAPIGetWatchdog Handles GET /api/watchdog
+func HandleAPIGetWatchdog(w http.ResponseWriter, r *http.Request) {
+	SendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    Watchdog.Status(),
+	})
+}
@@ -0,0 +1,447 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Job and task statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Defaults used when no budget is configured
+const (
+	DefaultMaxConcurrentTransfers = 4
+	maxFinishedJobs               = 100
+)
+
+// BytesPerSecond converts a bandwidth limit in Kbit/s to bytes per second. A Kbit is
+// 1024 bits, as for scp -l; transfers are throttled and their ETA estimated with it.
+func BytesPerSecond(limitKbps int) float64 {
+	return float64(limitKbps) * 1024 / 8
+}
+
+// Task is a single transfer of a job, typically one node. Run receives the bandwidth
+// limit in Kbit/s the transfer must respect (0 means unlimited). A task with NotBefore
+// set does not start earlier; tasks of a job start in order.
+type Task struct {
+	Name      string
+	Bytes     int64
+	NotBefore time.Time
+	Run       func(limitKbps int) error
+}
+
+// TaskStatus is the reported state of a task
+type TaskStatus struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Bytes       int64      `json:"bytes"`
+	LimitKbps   int        `json:"limitKbps,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"` // NotBefore of a delayed task
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobStatus is a point-in-time view of a job, including its progress-adjusted ETA
+type JobStatus struct {
+	ID               string       `json:"id"`
+	Type             string       `json:"type"`
+	Status           string       `json:"status"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	StartedAt        *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt       *time.Time   `json:"finishedAt,omitempty"`
+	TotalTasks       int          `json:"totalTasks"`
+	QueuedTasks      int          `json:"queuedTasks"`
+	RunningTasks     int          `json:"runningTasks"`
+	CompletedTasks   int          `json:"completedTasks"`
+	FailedTasks      int          `json:"failedTasks"`
+	TotalBytes       int64        `json:"totalBytes"`
+	TransferredBytes int64        `json:"transferredBytes"`
+	Progress         float64      `json:"progress"` // percent
+	ETASeconds       *float64     `json:"etaSeconds,omitempty"`
+	Tasks            []TaskStatus `json:"tasks"`
+}
+
+type job struct {
+	id         string
+	jobType    string
+	status     string
+	createdAt  time.Time
+	startedAt  *time.Time
+	finishedAt *time.Time
+	tasks      []Task
+	states     []TaskStatus
+	pending    []int
+	running    int
+	done       chan struct{}
+	onComplete func(JobStatus)
+}
+
+// Scheduler runs transfer tasks of concurrent jobs within a global concurrency and
+// bandwidth budget. Free slots go to the job with the fewest running tasks, so a large
+// job cannot starve a small one submitted after it.
+type Scheduler struct {
+	mutex         sync.Mutex
+	maxConcurrent int
+	bandwidthKbps int
+	running       int
+	jobs          map[string]*job
+	order         []string
+	wake          time.Time // when a delayed task is due and dispatch runs again
+	onTaskDone    func(jobID, jobType string, task TaskStatus)
+}
+
+// NewScheduler creates a scheduler with the default budget
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		maxConcurrent: DefaultMaxConcurrentTransfers,
+		jobs:          make(map[string]*job),
+	}
+}
+
+// SetBudget updates the global budget. maxConcurrent <= 0 keeps the default and
+// bandwidthKbps <= 0 disables bandwidth limiting. Running transfers keep their limit.
+func (s *Scheduler) SetBudget(maxConcurrent, bandwidthKbps int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrentTransfers
+	}
+	if bandwidthKbps < 0 {
+		bandwidthKbps = 0
+	}
+	s.maxConcurrent = maxConcurrent
+	s.bandwidthKbps = bandwidthKbps
+	s.dispatch()
+}
+
+// OnTaskDone sets a function called after every task of every job finished, e.g. to
+// account the bytes transferred to each node
+func (s *Scheduler) OnTaskDone(hook func(jobID, jobType string, task TaskStatus)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onTaskDone = hook
+}
+
+// Budget returns the current concurrency and bandwidth budget
+func (s *Scheduler) Budget() (maxConcurrent, bandwidthKbps int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.maxConcurrent, s.bandwidthKbps
+}
+
+// Submit queues a job and returns its ID. onComplete, if set, is called once every task finished.
+func (s *Scheduler) Submit(jobType string, tasks []Task, onComplete func(JobStatus)) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j := &job{
+		id:         newJobID(),
+		jobType:    jobType,
+		status:     StatusQueued,
+		createdAt:  time.Now().UTC(),
+		tasks:      tasks,
+		states:     make([]TaskStatus, len(tasks)),
+		pending:    make([]int, len(tasks)),
+		done:       make(chan struct{}),
+		onComplete: onComplete,
+	}
+	for i, task := range tasks {
+		j.states[i] = TaskStatus{Name: task.Name, Status: StatusQueued, Bytes: task.Bytes}
+		if !task.NotBefore.IsZero() {
+			scheduledAt := task.NotBefore.UTC()
+			j.states[i].ScheduledAt = &scheduledAt
+		}
+		j.pending[i] = i
+	}
+
+	s.jobs[j.id] = j
+	s.order = append(s.order, j.id)
+	s.pruneFinished()
+
+	if len(tasks) == 0 {
+		s.finish(j)
+		return j.id
+	}
+	s.dispatch()
+	return j.id
+}
+
+// Wait blocks until the job finished and returns its final status
+func (s *Scheduler) Wait(id string) (JobStatus, error) {
+	s.mutex.Lock()
+	j, ok := s.jobs[id]
+	s.mutex.Unlock()
+	if !ok {
+		return JobStatus{}, fmt.Errorf("job %s not found", id)
+	}
+
+	<-j.done
+	status, _ := s.Get(id)
+	return status, nil
+}
+
+// Get returns the current status of a job
+func (s *Scheduler) Get(id string) (JobStatus, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	return s.snapshot(j, time.Now()), true
+}
+
+// List returns all known jobs, newest first
+func (s *Scheduler) List() []JobStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	list := make([]JobStatus, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		list = append(list, s.snapshot(s.jobs[s.order[i]], now))
+	}
+	return list
+}
+
+// dispatch starts queued tasks while slots are free; callers must hold the lock
+func (s *Scheduler) dispatch() {
+	for s.running < s.maxConcurrent {
+		var next *job
+		var due time.Time
+		for _, id := range s.order {
+			j := s.jobs[id]
+			if len(j.pending) == 0 {
+				continue
+			}
+			if notBefore := j.tasks[j.pending[0]].NotBefore; time.Until(notBefore) > 0 {
+				if due.IsZero() || notBefore.Before(due) {
+					due = notBefore
+				}
+				continue
+			}
+			if next == nil || j.running < next.running {
+				next = j
+			}
+		}
+		if next == nil {
+			s.wakeAt(due)
+			return
+		}
+
+		index := next.pending[0]
+		next.pending = next.pending[1:]
+		next.running++
+		s.running++
+
+		now := time.Now().UTC()
+		if next.startedAt == nil {
+			next.startedAt = &now
+			next.status = StatusRunning
+		}
+		limit := s.perTransferLimit()
+		next.states[index].Status = StatusRunning
+		next.states[index].StartedAt = &now
+		next.states[index].LimitKbps = limit
+
+		go s.runTask(next, index, limit)
+	}
+}
+
+// wakeAt runs dispatch again at t, when the next delayed task is due, unless an earlier
+// wake-up is already set; callers must hold the lock
+func (s *Scheduler) wakeAt(t time.Time) {
+	if t.IsZero() || (s.wake.After(time.Now()) && !s.wake.After(t)) {
+		return
+	}
+	s.wake = t
+	time.AfterFunc(time.Until(t), func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.wake.Equal(t) {
+			s.wake = time.Time{}
+		}
+		s.dispatch()
+	})
+}
+
+// perTransferLimit splits the bandwidth budget evenly across all slots, so the sum of
+// concurrent transfers never exceeds it; callers must hold the lock
+func (s *Scheduler) perTransferLimit() int {
+	if s.bandwidthKbps <= 0 {
+		return 0
+	}
+	limit := s.bandwidthKbps / s.maxConcurrent
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+func (s *Scheduler) runTask(j *job, index int, limit int) {
+	var err error
+	// The slot is released even if the task panics, or the budget would shrink for good
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task %s panicked: %v", j.tasks[index].Name, r)
+		}
+		s.taskDone(j, index, err)
+	}()
+	err = j.tasks[index].Run(limit)
+}
+
+// taskDone records the result of a task, frees its slot and dispatches the next one
+func (s *Scheduler) taskDone(j *job, index int, err error) {
+	s.mutex.Lock()
+	now := time.Now().UTC()
+	state := &j.states[index]
+	state.FinishedAt = &now
+	if err != nil {
+		state.Status = StatusFailed
+		state.Error = err.Error()
+	} else {
+		state.Status = StatusCompleted
+	}
+	j.running--
+	s.running--
+	hook, task := s.onTaskDone, *state
+
+	var callback func(JobStatus)
+	var final JobStatus
+	if j.running == 0 && len(j.pending) == 0 {
+		s.finish(j)
+		callback = j.onComplete
+		final = s.snapshot(j, time.Now())
+	}
+	s.dispatch()
+	s.mutex.Unlock()
+
+	if hook != nil {
+		hook(j.id, j.jobType, task)
+	}
+	if callback != nil {
+		callback(final)
+	}
+}
+
+// finish marks a job as done; callers must hold the lock
+func (s *Scheduler) finish(j *job) {
+	now := time.Now().UTC()
+	j.finishedAt = &now
+	j.status = StatusCompleted
+	for _, state := range j.states {
+		if state.Status == StatusFailed {
+			j.status = StatusFailed
+			break
+		}
+	}
+	close(j.done)
+}
+
+// pruneFinished drops the oldest finished jobs beyond the history limit; callers must hold the lock
+func (s *Scheduler) pruneFinished() {
+	finished := 0
+	for _, id := range s.order {
+		if s.jobs[id].finishedAt != nil {
+			finished++
+		}
+	}
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if finished > maxFinishedJobs && s.jobs[id].finishedAt != nil {
+			delete(s.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+// snapshot builds the status of a job; callers must hold the lock.
+// Progress counts finished bytes plus an estimate for running transfers derived from
+// their bandwidth limit, and the ETA extrapolates the elapsed time by that progress.
+func (s *Scheduler) snapshot(j *job, now time.Time) JobStatus {
+	status := JobStatus{
+		ID:         j.id,
+		Type:       j.jobType,
+		Status:     j.status,
+		CreatedAt:  j.createdAt,
+		StartedAt:  j.startedAt,
+		FinishedAt: j.finishedAt,
+		TotalTasks: len(j.tasks),
+		Tasks:      append([]TaskStatus(nil), j.states...),
+	}
+
+	var doneBytes, estimatedBytes int64
+	var doneTasks float64
+	for _, state := range j.states {
+		status.TotalBytes += state.Bytes
+		switch state.Status {
+		case StatusQueued:
+			status.QueuedTasks++
+		case StatusRunning:
+			status.RunningTasks++
+			if state.LimitKbps > 0 && state.StartedAt != nil && state.Bytes > 0 {
+				estimate := int64(now.Sub(*state.StartedAt).Seconds() * BytesPerSecond(state.LimitKbps))
+				if max := state.Bytes * 95 / 100; estimate > max {
+					estimate = max
+				}
+				estimatedBytes += estimate
+				doneTasks += float64(estimate) / float64(state.Bytes)
+			}
+		case StatusCompleted:
+			status.CompletedTasks++
+			doneBytes += state.Bytes
+			doneTasks++
+		case StatusFailed:
+			status.FailedTasks++
+			doneBytes += state.Bytes
+			doneTasks++
+		}
+	}
+	status.TransferredBytes = doneBytes
+
+	fraction := 1.0
+	if status.TotalBytes > 0 {
+		fraction = float64(doneBytes+estimatedBytes) / float64(status.TotalBytes)
+	} else if status.TotalTasks > 0 {
+		fraction = doneTasks / float64(status.TotalTasks)
+	}
+	status.Progress = fraction * 100
+
+	if j.finishedAt != nil {
+		status.Progress = 100
+		return status
+	}
+
+	var eta float64
+	switch {
+	case fraction > 0 && j.startedAt != nil:
+		elapsed := now.Sub(*j.startedAt).Seconds()
+		eta = elapsed * (1 - fraction) / fraction
+	case s.bandwidthKbps > 0 && status.TotalBytes > 0:
+		eta = float64(status.TotalBytes-doneBytes) / BytesPerSecond(s.bandwidthKbps)
+	default:
+		return status
+	}
+	status.ETASeconds = &eta
+	return status
+}
+
+func newJobID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return fmt.Sprintf("job-%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
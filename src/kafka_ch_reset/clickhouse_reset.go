@@ -0,0 +1,297 @@
+package kafka_ch_reset
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
+)
+
+// ClickHouse reset strategies
+const (
+	ResetTruncate       = "truncate"        // TRUNCATE TABLE ... ON CLUSTER
+	ResetDropPartitions = "drop_partitions" // drop only the partitions overlapping the test window
+	ResetTTL            = "ttl"             // set a short TTL and let background merges delete the rows
+)
+
+// Outcomes of a table reset
+const (
+	TableResetTruncated  = "truncated"
+	TableResetDropped    = "partitions_dropped"
+	TableResetNothing    = "nothing_to_drop"
+	TableResetTTLSet     = "ttl_set"
+	TableResetTTLRemoved = "ttl_removed"
+	TableResetFailed     = "failed"
+)
+
+// The pod the reset queries run in, and the database and cluster of the tables
+const (
+	clickHouseResetPod     = "chi-clickhouse-vusmart-0-0-0"
+	clickHouseResetDB      = "vusmart"
+	clickHouseResetCluster = "vusmart"
+)
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ResetOptions selects how the tables of the enabled sources are reset
+type ResetOptions struct {
+	Strategy string
+	// drop_partitions: partitions whose time range overlaps [From, To] are dropped
+	From time.Time
+	To   time.Time
+	// ttl: rows older than TTLMinutes by TTLColumn expire; RemoveTTL drops the TTL again
+	TTLColumn  string
+	TTLMinutes int
+	RemoveTTL  bool
+}
+
+// PartitionReset is a partition found by a drop_partitions reset
+type PartitionReset struct {
+	PartitionID string     `json:"partitionId"`
+	Partition   string     `json:"partition"`
+	MinTime     *time.Time `json:"minTime,omitempty"`
+	MaxTime     *time.Time `json:"maxTime,omitempty"`
+	Rows        uint64     `json:"rows"`
+	InWindow    bool       `json:"inWindow"`
+	Dropped     bool       `json:"dropped"`
+	Reason      string     `json:"reason,omitempty"` // why a partition was kept
+	Error       string     `json:"error,omitempty"`
+}
+
+// TableReset is the outcome of resetting one table
+type TableReset struct {
+	Source     string           `json:"source"`
+	Table      string           `json:"table"`
+	Status     string           `json:"status"`
+	Partitions []PartitionReset `json:"partitions,omitempty"`
+	TTL        string           `json:"ttl,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// ClickHouseResetResult reports the chosen strategy and what it did to every table
+type ClickHouseResetResult struct {
+	Success           bool         `json:"success"`
+	Strategy          string       `json:"strategy"`
+	From              *time.Time   `json:"from,omitempty"`
+	To                *time.Time   `json:"to,omitempty"`
+	ProcessedSources  []string     `json:"processed_sources"`
+	Tables            []TableReset `json:"tables"`
+	DroppedPartitions int          `json:"dropped_partitions"`
+	Errors            []string     `json:"errors"`
+}
+
+// ValidResetStrategy reports whether strategy is a known reset strategy
+func ValidResetStrategy(strategy string) bool {
+	return strategy == ResetTruncate || strategy == ResetDropPartitions || strategy == ResetTTL
+}
+
+// ResetClickHouseTablesForO11ySources resets the ClickHouse tables of the enabled o11y
+// sources with the given strategy
+func (km *KafkaManager) ResetClickHouseTablesForO11ySources(options ResetOptions) (*ClickHouseResetResult, error) {
+	result := &ClickHouseResetResult{
+		Success:          true,
+		Strategy:         options.Strategy,
+		ProcessedSources: []string{},
+		Tables:           []TableReset{},
+		Errors:           []string{},
+	}
+	switch options.Strategy {
+	case ResetTruncate:
+	case ResetDropPartitions:
+		if options.From.IsZero() || options.To.Before(options.From) {
+			return result, fmt.Errorf("drop_partitions needs a window with from before to")
+		}
+		from, to := options.From.UTC(), options.To.UTC()
+		result.From, result.To = &from, &to
+	case ResetTTL:
+		if !options.RemoveTTL && (options.TTLMinutes <= 0 || !identifierPattern.MatchString(options.TTLColumn)) {
+			return result, fmt.Errorf("ttl needs a positive TTL in minutes and a valid column name")
+		}
+	default:
+		return result, fmt.Errorf("unknown reset strategy %q", options.Strategy)
+	}
+
+	tableResult, err := km.GetTableNamesForO11ySources()
+	if err != nil {
+		result.Success = false
+		result.Errors = append(result.Errors, fmt.Sprintf("Failed to get table names: %v", err))
+		return result, err
+	}
+	sourceTableMap := tableResult["results"].(map[string][]string)
+	result.ProcessedSources = tableResult["processed_sources"].([]string)
+	if !tableResult["success"].(bool) {
+		result.Success = false
+		result.Errors = append(result.Errors, tableResult["errors"].([]string)...)
+		return result, fmt.Errorf("failed to collect table names")
+	}
+
+	sources := make([]string, 0, len(sourceTableMap))
+	for source := range sourceTableMap {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		for _, table := range sourceTableMap[source] {
+			reset := TableReset{Source: source, Table: table}
+			if !identifierPattern.MatchString(table) {
+				reset.Status = TableResetFailed
+				reset.Error = "invalid table name"
+			} else {
+				switch options.Strategy {
+				case ResetTruncate:
+					if err := km.TruncateTable(table); err != nil {
+						reset.Status, reset.Error = TableResetFailed, err.Error()
+					} else {
+						reset.Status = TableResetTruncated
+					}
+				case ResetDropPartitions:
+					km.dropPartitionsInWindow(&reset, options.From, options.To)
+					for _, partition := range reset.Partitions {
+						if partition.Dropped {
+							result.DroppedPartitions++
+						}
+					}
+				case ResetTTL:
+					km.setTableTTL(&reset, options)
+				}
+			}
+			if reset.Status == TableResetFailed {
+				result.Success = false
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", table, reset.Error))
+				logger.Error().Str("table", table).Str("strategy", options.Strategy).Msg(reset.Error)
+			} else {
+				logger.Info().Str("table", table).Str("strategy", options.Strategy).Str("status", reset.Status).Msg("ClickHouse table reset")
+			}
+			result.Tables = append(result.Tables, reset)
+		}
+	}
+	return result, nil
+}
+
+// dropPartitionsInWindow drops the partitions of a table whose time range overlaps the
+// window. Partitions without a time-based key cannot be placed and are kept.
+func (km *KafkaManager) dropPartitionsInWindow(reset *TableReset, from, to time.Time) {
+	partitions, err := km.tablePartitions(reset.Table)
+	if err != nil {
+		reset.Status, reset.Error = TableResetFailed, err.Error()
+		return
+	}
+
+	dropped, failed := 0, 0
+	for i := range partitions {
+		partition := &partitions[i]
+		switch {
+		case partition.MinTime == nil || partition.MaxTime == nil:
+			partition.Reason = "partition key is not time based"
+			continue
+		case partition.MinTime.After(to) || partition.MaxTime.Before(from):
+			partition.Reason = "outside the window"
+			continue
+		}
+		partition.InWindow = true
+		query := fmt.Sprintf("ALTER TABLE %s.%s ON CLUSTER %s DROP PARTITION ID '%s'",
+			clickHouseResetDB, reset.Table, clickHouseResetCluster, partition.PartitionID)
+		if _, err := km.clickHouseQuery(query); err != nil {
+			partition.Error = err.Error()
+			failed++
+			continue
+		}
+		partition.Dropped = true
+		dropped++
+	}
+	reset.Partitions = partitions
+
+	switch {
+	case failed > 0:
+		reset.Status = TableResetFailed
+		reset.Error = fmt.Sprintf("failed to drop %d of %d partitions in the window", failed, failed+dropped)
+	case dropped == 0:
+		reset.Status = TableResetNothing
+	default:
+		reset.Status = TableResetDropped
+	}
+}
+
+// tablePartitions lists the active partitions of a table on all replicas with their
+// time range and row count
+func (km *KafkaManager) tablePartitions(table string) ([]PartitionReset, error) {
+	query := fmt.Sprintf(`SELECT partition_id, any(partition),
+	toUnixTimestamp(min(min_time)), toUnixTimestamp(max(max_time)),
+	toUnixTimestamp(toDateTime(min(min_date), 'UTC')), toUnixTimestamp(toDateTime(max(max_date), 'UTC')),
+	sum(rows)
+FROM clusterAllReplicas('%s', system.parts)
+WHERE database = '%s' AND table = '%s' AND active
+GROUP BY partition_id ORDER BY partition_id FORMAT TSV`, clickHouseResetCluster, clickHouseResetDB, table)
+	output, err := km.clickHouseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %v", table, err)
+	}
+	return parsePartitions(output), nil
+}
+
+// parsePartitions reads the TSV output of tablePartitions. Tables partitioned by time
+// carry min_time/max_time, tables partitioned by a Date column only min_date/max_date.
+func parsePartitions(output string) []PartitionReset {
+	partitions := []PartitionReset{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		partition := PartitionReset{PartitionID: fields[0], Partition: fields[1]}
+		var bounds [4]int64
+		for i := range bounds {
+			bounds[i], _ = strconv.ParseInt(fields[2+i], 10, 64)
+		}
+		partition.Rows, _ = strconv.ParseUint(fields[6], 10, 64)
+
+		minUnix, maxUnix := bounds[0], bounds[1]
+		if maxUnix <= 0 && bounds[3] > 0 {
+			minUnix, maxUnix = bounds[2], bounds[3]+86399 // the whole last day
+		}
+		if maxUnix > 0 {
+			minTime, maxTime := time.Unix(minUnix, 0).UTC(), time.Unix(maxUnix, 0).UTC()
+			partition.MinTime, partition.MaxTime = &minTime, &maxTime
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions
+}
+
+// setTableTTL sets or removes the table TTL on all replicas. The TTL stays on the table
+// until removed again.
+func (km *KafkaManager) setTableTTL(reset *TableReset, options ResetOptions) {
+	query := fmt.Sprintf("ALTER TABLE %s.%s ON CLUSTER %s REMOVE TTL", clickHouseResetDB, reset.Table, clickHouseResetCluster)
+	status := TableResetTTLRemoved
+	if !options.RemoveTTL {
+		reset.TTL = fmt.Sprintf("%s + INTERVAL %d MINUTE", options.TTLColumn, options.TTLMinutes)
+		query = fmt.Sprintf("ALTER TABLE %s.%s ON CLUSTER %s MODIFY TTL %s", clickHouseResetDB, reset.Table, clickHouseResetCluster, reset.TTL)
+		status = TableResetTTLSet
+	}
+	if _, err := km.clickHouseQuery(query); err != nil {
+		reset.Status, reset.Error = TableResetFailed, err.Error()
+		return
+	}
+	reset.Status = status
+}
+
+// clickHouseQuery runs a query with clickhouse-client in the ClickHouse pod. The query
+// is passed as an argument, not through a shell, so it may contain quotes.
+func (km *KafkaManager) clickHouseQuery(query string) (string, error) {
+	cmd := exec.Command("kubectl", "exec", clickHouseResetPod, "-n", "vsmaps", "--", "clickhouse-client", "--query", query)
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryClickHouse, err)
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
+		}
+		return "", fmt.Errorf("%v (output: %s)", err, strings.TrimSpace(string(stderr)))
+	}
+	return string(output), nil
+}
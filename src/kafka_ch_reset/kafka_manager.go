@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,7 +37,8 @@ type TopicMetadata struct {
 // KafkaManager handles Kafka topic operations
 type KafkaManager struct {
 	configPath string
-	topics     []TopicConfig
+	mutex      sync.RWMutex
+	topics     []TopicConfig // replaced as a whole on reload, never modified in place
 }
 
 // O11ySourceConfig represents the configuration for o11y sources from conf.yml
@@ -68,6 +70,14 @@ func (km *KafkaManager) translateSourceName(sourceName string) string {
 	return sourceName
 }
 
+// SourceDisplayName maps a conf.d source name to its topics_tables.yaml name
+func SourceDisplayName(sourceName string) string {
+	if translatedName, exists := sourceNameTranslation[sourceName]; exists {
+		return translatedName
+	}
+	return sourceName
+}
+
 // NewKafkaManager creates a new KafkaManager instance
 func NewKafkaManager(configPath string) *KafkaManager {
 	return &KafkaManager{
@@ -82,32 +92,69 @@ type SourcesConfig struct {
 
 // LoadConfig loads the topic configuration from YAML file
 func (km *KafkaManager) LoadConfig() error {
-	fmt.Printf("Loading config from: %s\n", km.configPath)
-	data, err := exec.Command("cat", km.configPath).Output()
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
-	}
-
-	var config SourcesConfig
-	err = yaml.Unmarshal(data, &config)
+	logger.Debugf(logger.ModuleKafka, "Loading topic config from %s", km.configPath)
+	topics, err := km.readConfig()
 	if err != nil {
-		return fmt.Errorf("failed to parse YAML config: %v", err)
+		return err
 	}
 
-	fmt.Printf("Loaded %d topic configurations\n", len(config.Sources))
-	for i, source := range config.Sources {
-		fmt.Printf("Source %d: %s\n", i, source.Name)
+	logger.Infof(logger.ModuleKafka, "Loaded %d topic configurations", len(topics))
+	for i, source := range topics {
+		logger.Debugf(logger.ModuleKafka, "Source %d: %s", i, source.Name)
 	}
 
-	km.topics = config.Sources
+	km.mutex.Lock()
+	km.topics = topics
+	km.mutex.Unlock()
 	return nil
 }
 
 // GetAllTopics returns all configured topics
 func (km *KafkaManager) GetAllTopics() []TopicConfig {
+	km.mutex.RLock()
+	defer km.mutex.RUnlock()
 	return km.topics
 }
 
+// SourceConfig returns the topics_tables.yaml entry of a conf.d source
+func (km *KafkaManager) SourceConfig(sourceName string) (TopicConfig, bool) {
+	displayName := SourceDisplayName(sourceName)
+	for _, source := range km.GetAllTopics() {
+		if source.Name == displayName {
+			return source, true
+		}
+	}
+	return TopicConfig{}, false
+}
+
+// ValidateSourceInputTopic checks that topic is an input topic of the source in topics_tables.yaml.
+// Sources without an entry may only use input topics known for some other source.
+func (km *KafkaManager) ValidateSourceInputTopic(sourceName, topic string) error {
+	displayName := SourceDisplayName(sourceName)
+	var known []string
+	for _, source := range km.GetAllTopics() {
+		for _, input := range source.InputTopic {
+			if source.Name == displayName && input.Name == topic {
+				return nil
+			}
+			known = append(known, input.Name)
+		}
+		if source.Name == displayName {
+			var allowed []string
+			for _, input := range source.InputTopic {
+				allowed = append(allowed, input.Name)
+			}
+			return fmt.Errorf("topic %q is not an input topic of %s in topics_tables.yaml (allowed: %s)", topic, displayName, strings.Join(allowed, ", "))
+		}
+	}
+	for _, name := range known {
+		if name == topic {
+			return nil
+		}
+	}
+	return fmt.Errorf("topic %q is not defined in topics_tables.yaml", topic)
+}
+
 
 // DescribeTopic describes a single topic and returns its metadata
 func (km *KafkaManager) DescribeTopic(topicName string) (*TopicMetadata, error) {
@@ -115,6 +162,7 @@ func (km *KafkaManager) DescribeTopic(topicName string) (*TopicMetadata, error)
 	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", describeCmd)
 
 	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe topic %s: %v", topicName, err)
 	}
@@ -133,6 +181,7 @@ func (km *KafkaManager) DeleteTopic(topicName string) error {
 	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", deleteCmd)
 
 	_, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
 	if err != nil {
 		// Note: Delete might fail if topic doesn't exist, which is okay for some use cases
 		return fmt.Errorf("failed to delete topic %s: %v", topicName, err)
@@ -149,6 +198,7 @@ func (km *KafkaManager) CreateTopic(topicName string, partitionCount, replicatio
 	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", createCmd)
 
 	_, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
 	if err != nil {
 		return fmt.Errorf("failed to create topic %s: %v", topicName, err)
 	}
@@ -156,6 +206,54 @@ func (km *KafkaManager) CreateTopic(topicName string, partitionCount, replicatio
 	return nil
 }
 
+// TopicEndOffset returns the sum of the latest offsets over all partitions of a topic,
+// i.e. the number of messages ever written to it
+func (km *KafkaManager) TopicEndOffset(topicName string) (int64, error) {
+	offsets, err := km.TopicPartitionOffsets(topicName)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, offset := range offsets {
+		total += offset
+	}
+	return total, nil
+}
+
+// TopicPartitionOffsets returns the latest offset of every partition of a topic
+func (km *KafkaManager) TopicPartitionOffsets(topicName string) (map[int]int64, error) {
+	offsetsCmd := fmt.Sprintf("kafka-get-offsets --bootstrap-server localhost:9092 --topic %s --time -1", topicName)
+	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", offsetsCmd)
+
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get offsets of topic %s: %v", topicName, err)
+	}
+
+	// Each line is topic:partition:offset
+	offsets := make(map[int]int64)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || fields[0] != topicName {
+			continue
+		}
+		partition, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		offsets[partition] = offset
+	}
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("no partitions reported for topic %s", topicName)
+	}
+	return offsets, nil
+}
+
 // LoadO11yConfig loads the o11y source configuration from conf.yml file
 func (km *KafkaManager) LoadO11yConfig(confPath string) (*O11ySourceConfig, error) {
 	data, err := exec.Command("cat", confPath).Output()
@@ -261,7 +359,7 @@ func (km *KafkaManager) RecreateTopicsForO11ySources() (map[string]interface{},
 
 		// Find the topic configuration for this source
 		var sourceTopicConfig *TopicConfig
-		for _, topicConfig := range km.topics {
+		for _, topicConfig := range km.GetAllTopics() {
 			if topicConfig.Name == translatedName {
 				sourceTopicConfig = &topicConfig
 				break
@@ -413,7 +511,7 @@ func (km *KafkaManager) GetTableNamesForO11ySources() (map[string]interface{}, e
 
 		// Find the topic configuration for this source
 		var sourceTopicConfig *TopicConfig
-		for _, topicConfig := range km.topics {
+		for _, topicConfig := range km.GetAllTopics() {
 			if topicConfig.Name == translatedName {
 				sourceTopicConfig = &topicConfig
 				break
@@ -479,13 +577,8 @@ func (km *KafkaManager) TruncateClickHouseTablesForO11ySources() (map[string]int
 		for _, tableName := range tables {
 			logger.Info().Str("source", sourceName).Str("table", tableName).Msg("Truncating ClickHouse table")
 
-			// Execute truncate command
-			truncateCmd := fmt.Sprintf("clickhouse-client --query \"TRUNCATE TABLE vusmart.%s ON CLUSTER vusmart\"", tableName)
-			cmd := exec.Command("kubectl", "exec", "chi-clickhouse-vusmart-0-0-0", "-n", "vsmaps", "--", "bash", "-c", truncateCmd)
-
-			output, err := cmd.Output()
-			if err != nil {
-				errMsg := fmt.Sprintf("Failed to truncate table %s: %v (output: %s)", tableName, err, string(output))
+			if err := km.TruncateTable(tableName); err != nil {
+				errMsg := err.Error()
 				result["success"] = false
 				result["errors"] = append(result["errors"].([]string), errMsg)
 				result["results"].(map[string]string)[tableName] = fmt.Sprintf("failed: %v", err)
@@ -506,12 +599,25 @@ func (km *KafkaManager) TruncateClickHouseTablesForO11ySources() (map[string]int
 	return result, nil
 }
 
+// TruncateTable truncates a single table of the vusmart database on all replicas
+func (km *KafkaManager) TruncateTable(tableName string) error {
+	truncateCmd := fmt.Sprintf("clickhouse-client --query \"TRUNCATE TABLE vusmart.%s ON CLUSTER vusmart\"", tableName)
+	cmd := exec.Command("kubectl", "exec", "chi-clickhouse-vusmart-0-0-0", "-n", "vsmaps", "--", "bash", "-c", truncateCmd)
+
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryClickHouse, err)
+	if err != nil {
+		return fmt.Errorf("failed to truncate table %s: %v (output: %s)", tableName, err, string(output))
+	}
+	return nil
+}
+
 // GetTopicStatus returns the status of all topics
 func (km *KafkaManager) GetTopicStatus() (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 	topics := make([]map[string]interface{}, 0)
 
-	for _, topicGroup := range km.topics {
+	for _, topicGroup := range km.GetAllTopics() {
 		// Check input topics
 		for _, inputTopic := range topicGroup.InputTopic {
 			status := km.getSingleTopicStatus(inputTopic.Name)
@@ -539,6 +645,11 @@ func (km *KafkaManager) GetTopicStatus() (map[string]interface{}, error) {
 	return result, nil
 }
 
+// GetSingleTopicStatus checks whether a single topic exists ("exists", "not_found" or "unknown")
+func (km *KafkaManager) GetSingleTopicStatus(topicName string) string {
+	return km.getSingleTopicStatus(topicName)
+}
+
 // getSingleTopicStatus checks if a single topic exists and its status
 func (km *KafkaManager) getSingleTopicStatus(topicName string) string {
 	describeCmd := fmt.Sprintf("kafka-topics --bootstrap-server localhost:9092 --describe --topic %s", topicName)
@@ -0,0 +1,232 @@
+package kafka_ch_reset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/selfstats"
+)
+
+// Partition report limits
+const (
+	DefaultPartitionWindow    = 10 * time.Second
+	MaxPartitionWindow        = 60 * time.Second
+	DefaultPartitionHotFactor = 2.0
+)
+
+// PartitionStats is the throughput of one partition over the sampling window
+type PartitionStats struct {
+	Partition      int     `json:"partition"`
+	StartOffset    int64   `json:"startOffset"`
+	EndOffset      int64   `json:"endOffset"`
+	Messages       int64   `json:"messages"`
+	MessagesPerSec float64 `json:"messagesPerSec"`
+	SharePercent   float64 `json:"sharePercent"` // of the topic's messages in the window
+	// Sizes are of the largest replica. They are left out when kafka-log-dirs failed;
+	// bytesPerSec is also left out when retention deleted a segment in the window.
+	SizeBytes       *int64   `json:"sizeBytes,omitempty"`
+	BytesPerSec     *float64 `json:"bytesPerSec,omitempty"`
+	AvgMessageBytes *float64 `json:"avgMessageBytes,omitempty"`
+	Hot             bool     `json:"hot"`  // at least hotFactor times the mean rate
+	Idle            bool     `json:"idle"` // received nothing while other partitions did
+}
+
+// PartitionReport is the per-partition throughput of a topic and how evenly it spreads
+type PartitionReport struct {
+	Topic          string           `json:"topic"`
+	WindowSeconds  float64          `json:"windowSeconds"`
+	HotFactor      float64          `json:"hotFactor"`
+	Partitions     []PartitionStats `json:"partitions"`
+	MessagesPerSec float64          `json:"messagesPerSec"`
+	MeanPerSec     float64          `json:"meanPerSec"`
+	MaxPerSec      float64          `json:"maxPerSec"`
+	// SkewRatio is the busiest partition's rate over the mean; 1 is a perfect spread
+	// and the topic's throughput is capped at roughly partitions/skewRatio of it
+	SkewRatio      float64   `json:"skewRatio"`
+	HotPartitions  []int     `json:"hotPartitions"`
+	IdlePartitions []int     `json:"idlePartitions"`
+	Skewed         bool      `json:"skewed"`
+	Summary        string    `json:"summary"`
+	SizeError      string    `json:"sizeError,omitempty"`
+	StartedAt      time.Time `json:"startedAt"`
+}
+
+// TopicPartitionSizes returns the on-disk size of every partition of a topic, taking the
+// largest replica
+func (km *KafkaManager) TopicPartitionSizes(topicName string) (map[int]int64, error) {
+	logDirsCmd := fmt.Sprintf("kafka-log-dirs --bootstrap-server localhost:9092 --describe --topic-list %s", topicName)
+	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", logDirsCmd)
+
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log dirs of topic %s: %s", topicName, commandError(err))
+	}
+	return parseLogDirs(string(output), topicName)
+}
+
+// parseLogDirs reads the JSON line of kafka-log-dirs, which follows a few status lines
+func parseLogDirs(output, topicName string) (map[int]int64, error) {
+	var description struct {
+		Brokers []struct {
+			LogDirs []struct {
+				Error      interface{} `json:"error"`
+				Partitions []struct {
+					Partition string `json:"partition"` // topic-N
+					Size      int64  `json:"size"`
+					IsFuture  bool   `json:"isFuture"`
+				} `json:"partitions"`
+			} `json:"logDirs"`
+		} `json:"brokers"`
+	}
+	found := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &description) == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no log dir description in kafka-log-dirs output")
+	}
+
+	sizes := make(map[int]int64)
+	prefix := topicName + "-"
+	for _, broker := range description.Brokers {
+		for _, dir := range broker.LogDirs {
+			for _, partition := range dir.Partitions {
+				if partition.IsFuture || !strings.HasPrefix(partition.Partition, prefix) {
+					continue
+				}
+				id, err := strconv.Atoi(strings.TrimPrefix(partition.Partition, prefix))
+				if err != nil {
+					continue
+				}
+				if size, ok := sizes[id]; !ok || partition.Size > size {
+					sizes[id] = partition.Size
+				}
+			}
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("no partitions of topic %s in the log dirs", topicName)
+	}
+	return sizes, nil
+}
+
+// TopicPartitionReport samples the end offsets and sizes of a topic's partitions twice,
+// window apart, and reports each partition's rate. A partition at hotFactor times the
+// mean rate or more is hot: keys that hash badly bottleneck the whole topic on it.
+func (km *KafkaManager) TopicPartitionReport(topic string, window time.Duration, hotFactor float64) (*PartitionReport, error) {
+	if !ValidTopicName(topic) {
+		return nil, fmt.Errorf("invalid topic name %q", topic)
+	}
+	report := &PartitionReport{
+		Topic:          topic,
+		HotFactor:      hotFactor,
+		Partitions:     []PartitionStats{},
+		HotPartitions:  []int{},
+		IdlePartitions: []int{},
+		StartedAt:      time.Now().UTC(),
+	}
+
+	before, err := km.TopicPartitionOffsets(topic)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	sizesBefore, sizeErr := km.TopicPartitionSizes(topic)
+	time.Sleep(window)
+	after, err := km.TopicPartitionOffsets(topic)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start).Seconds()
+	var sizesAfter map[int]int64
+	if sizeErr == nil {
+		sizesAfter, sizeErr = km.TopicPartitionSizes(topic)
+	}
+	if sizeErr != nil {
+		report.SizeError = sizeErr.Error()
+	}
+	report.WindowSeconds = elapsed
+
+	var total int64
+	for partition, end := range after {
+		begin, ok := before[partition]
+		if !ok || end < begin {
+			begin = end // added or recreated during the window
+		}
+		stats := PartitionStats{
+			Partition:      partition,
+			StartOffset:    begin,
+			EndOffset:      end,
+			Messages:       end - begin,
+			MessagesPerSec: float64(end-begin) / elapsed,
+		}
+		if size, ok := sizesAfter[partition]; ok {
+			stats.SizeBytes = &size
+			if previous, ok := sizesBefore[partition]; ok && size >= previous {
+				bytesPerSec := float64(size-previous) / elapsed
+				stats.BytesPerSec = &bytesPerSec
+				if stats.Messages > 0 {
+					avg := float64(size-previous) / float64(stats.Messages)
+					stats.AvgMessageBytes = &avg
+				}
+			}
+		}
+		total += stats.Messages
+		report.Partitions = append(report.Partitions, stats)
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool { return report.Partitions[i].Partition < report.Partitions[j].Partition })
+
+	report.MessagesPerSec = float64(total) / elapsed
+	report.MeanPerSec = report.MessagesPerSec / float64(len(report.Partitions))
+	busiest := 0
+	for i := range report.Partitions {
+		stats := &report.Partitions[i]
+		if total > 0 {
+			stats.SharePercent = float64(stats.Messages) * 100 / float64(total)
+		}
+		if stats.MessagesPerSec > report.MaxPerSec {
+			report.MaxPerSec = stats.MessagesPerSec
+			busiest = i
+		}
+		if total == 0 || len(report.Partitions) < 2 {
+			continue
+		}
+		if stats.MessagesPerSec >= hotFactor*report.MeanPerSec {
+			stats.Hot = true
+			report.HotPartitions = append(report.HotPartitions, stats.Partition)
+		}
+		if stats.Messages == 0 {
+			stats.Idle = true
+			report.IdlePartitions = append(report.IdlePartitions, stats.Partition)
+		}
+	}
+	if report.MeanPerSec > 0 {
+		report.SkewRatio = report.MaxPerSec / report.MeanPerSec
+	}
+	report.Skewed = len(report.HotPartitions) > 0 || len(report.IdlePartitions) > 0
+
+	switch {
+	case total == 0:
+		report.Summary = fmt.Sprintf("No messages written to %s in %.0fs", topic, elapsed)
+	case report.Skewed:
+		hot := report.Partitions[busiest]
+		report.Summary = fmt.Sprintf("Partition %d of %s takes %.0f%% of the messages, %.1fx the mean of %d partitions",
+			hot.Partition, topic, hot.SharePercent, report.SkewRatio, len(report.Partitions))
+		if len(report.IdlePartitions) > 0 {
+			report.Summary += fmt.Sprintf("; %d partitions received nothing", len(report.IdlePartitions))
+		}
+	default:
+		report.Summary = fmt.Sprintf("%s spreads %.0f msg/s evenly over %d partitions (skew %.2fx)",
+			topic, report.MessagesPerSec, len(report.Partitions), report.SkewRatio)
+	}
+	return report, nil
+}
@@ -0,0 +1,199 @@
+package kafka_ch_reset
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"vuDataSim/src/selfstats"
+)
+
+// Produce test limits
+const (
+	DefaultProduceTestMessages = 10
+	MaxProduceTestMessages     = 100
+	DefaultProduceTestTimeout  = 10 * time.Second
+	MaxProduceTestTimeout      = 30 * time.Second
+	// produceTestScanLimit bounds how many messages are read back per partition when
+	// simulators write to the topic at the same time
+	produceTestScanLimit = 5000
+)
+
+var topicNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,249}$`)
+
+// ProduceTestPartition is a partition the test messages were written to
+type ProduceTestPartition struct {
+	Partition   int   `json:"partition"`
+	StartOffset int64 `json:"startOffset"`
+	EndOffset   int64 `json:"endOffset"`
+	Scanned     int   `json:"scanned"` // messages read back, including other producers'
+	Found       int   `json:"found"`   // test messages among them
+}
+
+// ProduceTestResult is the outcome of producing a batch to a topic and consuming it back
+type ProduceTestResult struct {
+	Topic      string                 `json:"topic"`
+	Marker     string                 `json:"marker"` // carried by every test message
+	Messages   int                    `json:"messages"`
+	Produced   bool                   `json:"produced"`
+	Consumed   int                    `json:"consumed"`
+	Passed     bool                   `json:"passed"`
+	Partitions []ProduceTestPartition `json:"partitions"`
+	// Durations measured inside the Kafka pod. Produce and consume include the start-up
+	// of the console clients, so they are an upper bound of the broker latency.
+	ProduceMs   int64     `json:"produceMs"`
+	ConsumeMs   int64     `json:"consumeMs"`
+	RoundTripMs int64     `json:"roundTripMs"` // from the first message sent to the last read back
+	StartedAt   time.Time `json:"startedAt"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// ValidTopicName reports whether name is a legal Kafka topic name
+func ValidTopicName(name string) bool {
+	return topicNamePattern.MatchString(name) && name != "." && name != ".."
+}
+
+// ProduceTest writes messages synthetic messages to an existing topic with acks=all and
+// reads them back from the partitions they landed on, measuring the round trip. It is a
+// broker health check that does not involve the simulators.
+func (km *KafkaManager) ProduceTest(topic string, messages int, timeout time.Duration) (*ProduceTestResult, error) {
+	if !ValidTopicName(topic) {
+		return nil, fmt.Errorf("invalid topic name %q", topic)
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	result := &ProduceTestResult{
+		Topic:      topic,
+		Marker:     "vudatasim-produce-test-" + hex.EncodeToString(suffix),
+		Messages:   messages,
+		Partitions: []ProduceTestPartition{},
+		StartedAt:  time.Now().UTC(),
+	}
+
+	before, err := km.TopicPartitionOffsets(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch strings.Builder
+	for i := 0; i < messages; i++ {
+		line, _ := json.Marshal(map[string]interface{}{
+			"produce_test": result.Marker,
+			"seq":          i,
+			"sent_at":      time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		batch.Write(line)
+		batch.WriteByte('\n')
+	}
+	produceCmd := fmt.Sprintf("start=$(date +%%s%%3N); kafka-console-producer --bootstrap-server localhost:9092 --topic %s --producer-property acks=all --producer-property max.block.ms=%d >&2 || exit 1; end=$(date +%%s%%3N); echo \"$start $end\"",
+		topic, timeout.Milliseconds())
+	cmd := exec.Command("kubectl", "exec", "-i", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", produceCmd)
+	cmd.Stdin = strings.NewReader(batch.String())
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
+	if err != nil {
+		result.Error = fmt.Sprintf("produce failed: %s", commandError(err))
+		return result, nil
+	}
+	producedStart, producedEnd, ok := parseTimes(string(output))
+	if !ok {
+		result.Error = fmt.Sprintf("unexpected producer output %q", strings.TrimSpace(string(output)))
+		return result, nil
+	}
+	result.Produced = true
+	result.ProduceMs = producedEnd - producedStart
+
+	after, err := km.TopicPartitionOffsets(topic)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	for partition, end := range after {
+		if start := before[partition]; end > start {
+			result.Partitions = append(result.Partitions, ProduceTestPartition{Partition: partition, StartOffset: start, EndOffset: end})
+		}
+	}
+	sort.Slice(result.Partitions, func(i, j int) bool { return result.Partitions[i].Partition < result.Partitions[j].Partition })
+	if len(result.Partitions) == 0 {
+		result.Error = "no partition offset advanced after producing"
+		return result, nil
+	}
+
+	// One pod call reads every partition; each consumer prints its messages followed by
+	// a line with the partition so the output can be split
+	var consumeCmd strings.Builder
+	consumeCmd.WriteString("start=$(date +%s%3N); ")
+	for _, partition := range result.Partitions {
+		count := partition.EndOffset - partition.StartOffset
+		if count > produceTestScanLimit {
+			count = produceTestScanLimit
+		}
+		fmt.Fprintf(&consumeCmd, "kafka-console-consumer --bootstrap-server localhost:9092 --topic %s --partition %d --offset %d --max-messages %d --timeout-ms %d 2>/dev/null; echo \"@@partition %d\"; ",
+			topic, partition.Partition, partition.StartOffset, count, timeout.Milliseconds(), partition.Partition)
+	}
+	consumeCmd.WriteString("end=$(date +%s%3N); echo \"$start $end\"")
+	cmd = exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", consumeCmd.String())
+	output, err = cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
+	if err != nil {
+		result.Error = fmt.Sprintf("consume failed: %s", commandError(err))
+		return result, nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	consumedStart, consumedEnd, ok := parseTimes(lines[len(lines)-1])
+	if !ok {
+		result.Error = "unexpected consumer output"
+		return result, nil
+	}
+	scanned, found := 0, 0
+	for _, line := range lines[:len(lines)-1] {
+		if strings.HasPrefix(line, "@@partition ") {
+			id, _ := strconv.Atoi(strings.TrimPrefix(line, "@@partition "))
+			for i := range result.Partitions {
+				if result.Partitions[i].Partition == id {
+					result.Partitions[i].Scanned, result.Partitions[i].Found = scanned, found
+				}
+			}
+			result.Consumed += found
+			scanned, found = 0, 0
+			continue
+		}
+		scanned++
+		if strings.Contains(line, result.Marker) {
+			found++
+		}
+	}
+	result.ConsumeMs = consumedEnd - consumedStart
+	result.RoundTripMs = consumedEnd - producedStart
+	result.Passed = result.Consumed == messages
+	if !result.Passed {
+		result.Error = fmt.Sprintf("read back %d of %d messages within %s", result.Consumed, messages, timeout)
+	}
+	return result, nil
+}
+
+// parseTimes reads the "start end" epoch milliseconds a pod command printed last
+func parseTimes(output string) (int64, int64, bool) {
+	fields := strings.Fields(strings.TrimSpace(output))
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+	start, err1 := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	end, err2 := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	return start, end, err1 == nil && err2 == nil
+}
+
+// commandError includes the stderr of a failed command in its error
+func commandError(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Sprintf("%v (output: %s)", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err.Error()
+}
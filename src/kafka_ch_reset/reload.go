@@ -0,0 +1,250 @@
+package kafka_ch_reset
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	kafkaTopicNamePattern  = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+	clickhouseTablePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+)
+
+// SourceChange describes how one source's mapping differs between two loads
+type SourceChange struct {
+	Source              string   `json:"source"`
+	AddedInputTopics    []string `json:"addedInputTopics,omitempty"`
+	RemovedInputTopics  []string `json:"removedInputTopics,omitempty"`
+	AddedOutputTopics   []string `json:"addedOutputTopics,omitempty"`
+	RemovedOutputTopics []string `json:"removedOutputTopics,omitempty"`
+	AddedTables         []string `json:"addedTables,omitempty"`
+	RemovedTables       []string `json:"removedTables,omitempty"`
+}
+
+// ReloadResult is the outcome of re-reading topics_tables.yaml
+type ReloadResult struct {
+	Changed        bool           `json:"changed"`
+	Sources        int            `json:"sources"`
+	AddedSources   []string       `json:"addedSources,omitempty"`
+	RemovedSources []string       `json:"removedSources,omitempty"`
+	ChangedSources []SourceChange `json:"changedSources,omitempty"`
+	ReloadedAt     time.Time      `json:"reloadedAt"`
+}
+
+// Summary returns a one-line description of the changes for logs
+func (rr *ReloadResult) Summary() string {
+	if !rr.Changed {
+		return "no changes"
+	}
+	var parts []string
+	if len(rr.AddedSources) > 0 {
+		parts = append(parts, "added "+strings.Join(rr.AddedSources, ", "))
+	}
+	if len(rr.RemovedSources) > 0 {
+		parts = append(parts, "removed "+strings.Join(rr.RemovedSources, ", "))
+	}
+	for _, change := range rr.ChangedSources {
+		var details []string
+		for _, d := range []struct {
+			label string
+			names []string
+		}{
+			{"+input", change.AddedInputTopics}, {"-input", change.RemovedInputTopics},
+			{"+output", change.AddedOutputTopics}, {"-output", change.RemovedOutputTopics},
+			{"+tables", change.AddedTables}, {"-tables", change.RemovedTables},
+		} {
+			if len(d.names) > 0 {
+				details = append(details, fmt.Sprintf("%s %s", d.label, strings.Join(d.names, ",")))
+			}
+		}
+		parts = append(parts, fmt.Sprintf("changed %s (%s)", change.Source, strings.Join(details, "; ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// readConfig reads, parses and validates topics_tables.yaml without applying it
+func (km *KafkaManager) readConfig() ([]TopicConfig, error) {
+	data, err := os.ReadFile(km.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var config SourcesConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML config: %v", err)
+	}
+	if err := ValidateTopicsConfig(config.Sources); err != nil {
+		return nil, err
+	}
+	return config.Sources, nil
+}
+
+// ValidateTopicsConfig checks source names, topic names and ClickHouse table names
+func ValidateTopicsConfig(sources []TopicConfig) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("topics_tables.yaml defines no sources")
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, source := range sources {
+		if strings.TrimSpace(source.Name) == "" {
+			problems = append(problems, fmt.Sprintf("source #%d has no name", i+1))
+			continue
+		}
+		if seen[source.Name] {
+			problems = append(problems, fmt.Sprintf("source %s is defined more than once", source.Name))
+		}
+		seen[source.Name] = true
+
+		if len(source.InputTopic) == 0 {
+			problems = append(problems, fmt.Sprintf("source %s has no inputTopic", source.Name))
+		}
+		for _, topic := range append(append([]TopicName{}, source.InputTopic...), source.OutputTopic...) {
+			if !kafkaTopicNamePattern.MatchString(topic.Name) {
+				problems = append(problems, fmt.Sprintf("source %s has invalid topic name %q", source.Name, topic.Name))
+			}
+		}
+		for _, table := range source.ClickhouseTables {
+			if !clickhouseTablePattern.MatchString(table) {
+				problems = append(problems, fmt.Sprintf("source %s has invalid ClickHouse table %q", source.Name, table))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid topics_tables.yaml: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Reload re-reads topics_tables.yaml and swaps it in if it is valid. On any error the
+// current mapping stays in place.
+func (km *KafkaManager) Reload() (*ReloadResult, error) {
+	topics, err := km.readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	km.mutex.Lock()
+	previous := km.topics
+	km.topics = topics
+	km.mutex.Unlock()
+
+	result := diffTopics(previous, topics)
+	result.ReloadedAt = time.Now().UTC()
+
+	if result.Changed {
+		logger.LogWithNode("System", "Kafka", fmt.Sprintf("Reloaded topics_tables.yaml (%d sources): %s", result.Sources, result.Summary()), "info")
+	}
+	return result, nil
+}
+
+// Watch polls topics_tables.yaml and reloads it whenever its content changes. Invalid
+// edits are reported through onReload and the previous mapping is kept.
+func (km *KafkaManager) Watch(interval time.Duration, onReload func(*ReloadResult, error)) {
+	go func() {
+		var lastModTime time.Time
+		var lastSize int64 = -1
+		if info, err := os.Stat(km.configPath); err == nil {
+			lastModTime, lastSize = info.ModTime(), info.Size()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			info, err := os.Stat(km.configPath)
+			if err != nil || (info.ModTime().Equal(lastModTime) && info.Size() == lastSize) {
+				continue
+			}
+			lastModTime, lastSize = info.ModTime(), info.Size()
+
+			result, err := km.Reload()
+			if onReload != nil && (err != nil || result.Changed) {
+				onReload(result, err)
+			}
+		}
+	}()
+}
+
+// diffTopics compares two mappings source by source
+func diffTopics(previous, current []TopicConfig) *ReloadResult {
+	result := &ReloadResult{Sources: len(current)}
+
+	before := make(map[string]TopicConfig, len(previous))
+	for _, source := range previous {
+		before[source.Name] = source
+	}
+	after := make(map[string]TopicConfig, len(current))
+	for _, source := range current {
+		after[source.Name] = source
+	}
+
+	for name, source := range after {
+		old, existed := before[name]
+		if !existed {
+			result.AddedSources = append(result.AddedSources, name)
+			continue
+		}
+		change := SourceChange{Source: name}
+		change.AddedInputTopics, change.RemovedInputTopics = diffNames(topicNames(old.InputTopic), topicNames(source.InputTopic))
+		change.AddedOutputTopics, change.RemovedOutputTopics = diffNames(topicNames(old.OutputTopic), topicNames(source.OutputTopic))
+		change.AddedTables, change.RemovedTables = diffNames(old.ClickhouseTables, source.ClickhouseTables)
+		if len(change.AddedInputTopics)+len(change.RemovedInputTopics)+len(change.AddedOutputTopics)+
+			len(change.RemovedOutputTopics)+len(change.AddedTables)+len(change.RemovedTables) > 0 {
+			result.ChangedSources = append(result.ChangedSources, change)
+		}
+	}
+	for name := range before {
+		if _, exists := after[name]; !exists {
+			result.RemovedSources = append(result.RemovedSources, name)
+		}
+	}
+
+	sort.Strings(result.AddedSources)
+	sort.Strings(result.RemovedSources)
+	sort.Slice(result.ChangedSources, func(i, j int) bool {
+		return result.ChangedSources[i].Source < result.ChangedSources[j].Source
+	})
+	// Reordering sources or entries does not change the mapping
+	result.Changed = len(result.AddedSources)+len(result.RemovedSources)+len(result.ChangedSources) > 0
+	return result
+}
+
+func topicNames(topics []TopicName) []string {
+	names := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+// diffNames returns the names only in current (added) and only in previous (removed)
+func diffNames(previous, current []string) ([]string, []string) {
+	inPrevious := make(map[string]bool, len(previous))
+	for _, name := range previous {
+		inPrevious[name] = true
+	}
+	inCurrent := make(map[string]bool, len(current))
+	var added []string
+	for _, name := range current {
+		inCurrent[name] = true
+		if !inPrevious[name] {
+			added = append(added, name)
+		}
+	}
+	var removed []string
+	for _, name := range previous {
+		if !inCurrent[name] {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,69 @@
+package kafka_ch_reset
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+	"vuDataSim/src/selfstats"
+)
+
+// MaxSampleMessages bounds how many messages SampleMessages reads from a topic
+const MaxSampleMessages = 500
+
+// SampleMessages reads up to count of the most recent messages of a topic, spread over
+// its partitions, without committing consumer offsets. A topic that received nothing
+// yet returns no messages.
+func (km *KafkaManager) SampleMessages(topic string, count int, timeout time.Duration) ([]string, error) {
+	if !ValidTopicName(topic) {
+		return nil, fmt.Errorf("invalid topic name %q", topic)
+	}
+	if count <= 0 || count > MaxSampleMessages {
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxSampleMessages)
+	}
+	ends, err := km.TopicPartitionOffsets(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]int, 0, len(ends))
+	for partition, end := range ends {
+		if end > 0 {
+			partitions = append(partitions, partition)
+		}
+	}
+	if len(partitions) == 0 {
+		return []string{}, nil
+	}
+	sort.Ints(partitions)
+
+	// Read the tail of every non-empty partition in one pod call; an offset before the
+	// start of a compacted or expired log only yields fewer messages
+	perPartition := int64((count + len(partitions) - 1) / len(partitions))
+	var consumeCmd strings.Builder
+	for _, partition := range partitions {
+		start := ends[partition] - perPartition
+		if start < 0 {
+			start = 0
+		}
+		fmt.Fprintf(&consumeCmd, "kafka-console-consumer --bootstrap-server localhost:9092 --topic %s --partition %d --offset %d --max-messages %d --timeout-ms %d 2>/dev/null; ",
+			topic, partition, start, ends[partition]-start, timeout.Milliseconds())
+	}
+	// A consumer that times out before reading its count exits non-zero
+	consumeCmd.WriteString("true")
+	cmd := exec.Command("kubectl", "exec", "kafka-cluster-cp-kafka-0", "-n", "vsmaps", "--", "bash", "-c", consumeCmd.String())
+	output, err := cmd.Output()
+	selfstats.Record(selfstats.CategoryKafkaAdmin, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample topic %s: %s", topic, commandError(err))
+	}
+
+	messages := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" && len(messages) < count {
+			messages = append(messages, line)
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Modules with their own log level, adjustable at runtime
+const (
+	ModuleO11y       = "o11y"
+	ModuleBinControl = "bin_control"
+	ModuleClickHouse = "clickhouse"
+	ModuleKafka      = "kafka"
+	ModuleSSH        = "ssh"
+)
+
+// Modules lists the modules whose level can be changed
+var Modules = []string{ModuleO11y, ModuleBinControl, ModuleClickHouse, ModuleKafka, ModuleSSH}
+
+// defaultModuleLevel hides the modules' debug output until it is asked for
+const defaultModuleLevel = zerolog.InfoLevel
+
+// moduleLevels holds the level of every module and the file it is persisted to
+type moduleLevels struct {
+	mutex  sync.RWMutex
+	file   string
+	levels map[string]zerolog.Level
+}
+
+var levels = newModuleLevels()
+
+func newModuleLevels() *moduleLevels {
+	ml := &moduleLevels{levels: make(map[string]zerolog.Level, len(Modules))}
+	for _, module := range Modules {
+		ml.levels[module] = defaultModuleLevel
+	}
+	return ml
+}
+
+// LoadLevels reads the module levels saved by SetLevels; modules missing from the file
+// keep the default info level. Later changes are saved to the same file.
+func LoadLevels(file string) error {
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+
+	levels.file = file
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read log levels: %v", err)
+	}
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to parse log levels: %v", err)
+	}
+	for module, name := range saved {
+		level, err := parseModuleLevel(module, name)
+		if err != nil {
+			return err
+		}
+		levels.levels[module] = level
+	}
+	return nil
+}
+
+// Levels returns the level of every module by name
+func Levels() map[string]string {
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+	return levels.namesLocked()
+}
+
+// SetLevels changes the levels of the given modules and saves all levels. Nothing is
+// changed if a module or level is unknown.
+func SetLevels(changes map[string]string) (map[string]string, error) {
+	parsed := make(map[string]zerolog.Level, len(changes))
+	for module, name := range changes {
+		level, err := parseModuleLevel(module, name)
+		if err != nil {
+			return nil, err
+		}
+		parsed[module] = level
+	}
+
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+	for module, level := range parsed {
+		levels.levels[module] = level
+	}
+	current := levels.namesLocked()
+	if levels.file == "" {
+		return current, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(levels.file), 0755); err != nil {
+		return current, fmt.Errorf("failed to create log levels directory: %v", err)
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return current, fmt.Errorf("failed to marshal log levels: %v", err)
+	}
+	tmp := levels.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return current, fmt.Errorf("failed to write log levels: %v", err)
+	}
+	return current, os.Rename(tmp, levels.file)
+}
+
+func (ml *moduleLevels) namesLocked() map[string]string {
+	names := make(map[string]string, len(ml.levels))
+	for module, level := range ml.levels {
+		names[module] = level.String()
+	}
+	return names
+}
+
+func parseModuleLevel(module, name string) (zerolog.Level, error) {
+	known := append([]string(nil), Modules...)
+	sort.Strings(known)
+	if index := sort.SearchStrings(known, module); index == len(known) || known[index] != module {
+		return zerolog.NoLevel, fmt.Errorf("unknown module %q, modules: %v", module, known)
+	}
+	level, err := zerolog.ParseLevel(name)
+	if err != nil || level == zerolog.NoLevel || level > zerolog.ErrorLevel {
+		return zerolog.NoLevel, fmt.Errorf("invalid level %q for %s, use trace, debug, info, warn or error", name, module)
+	}
+	return level, nil
+}
+
+// Enabled reports whether module logs at level
+func Enabled(module string, level zerolog.Level) bool {
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+	current, ok := levels.levels[module]
+	return !ok || level >= current
+}
+
+// Debugf logs a debug message of a module if the module's level allows it
+func Debugf(module, format string, args ...interface{}) {
+	if !Enabled(module, zerolog.DebugLevel) {
+		return
+	}
+	Logger.Debug().
+		Str("node", "System").
+		Str("module", module).
+		Str("type", "debug").
+		Msgf(format, args...)
+}
+
+// Infof logs an info message of a module if the module's level allows it
+func Infof(module, format string, args ...interface{}) {
+	if !Enabled(module, zerolog.InfoLevel) {
+		return
+	}
+	Logger.Info().
+		Str("node", "System").
+		Str("module", module).
+		Str("type", "info").
+		Msgf(format, args...)
+}
@@ -30,8 +30,7 @@ func InitLogger(logFilePath string) error {
 	}
 
 	// Open log file
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
+	if err := logFile.open(logFilePath); err != nil {
 		return err
 	}
 
@@ -44,6 +43,9 @@ func InitLogger(logFilePath string) error {
 		logFile,
 	)
 
+	// Log timestamps are always UTC, matching the API
+	zerolog.TimestampFunc = func() time.Time { return time.Now().UTC() }
+
 	// Configure logger
 	Logger = zerolog.New(multi).With().Timestamp().Logger()
 
@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotatingFile is the log file writer; Rotate swaps the file underneath it
+type rotatingFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+var logFile = &rotatingFile{}
+
+func (rf *rotatingFile) open(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	rf.path = path
+	rf.file = file
+	return nil
+}
+
+func (rf *rotatingFile) Write(data []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.file == nil {
+		return len(data), nil
+	}
+	return rf.file.Write(data)
+}
+
+// LogFilePath returns the path of the active log file, empty before InitLogger
+func LogFilePath() string {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+	return logFile.path
+}
+
+// Rotate renames the active log file to <path>.<UTC timestamp> and continues in a new
+// file at the original path. It returns the name of the rotated file.
+func Rotate() (string, error) {
+	logFile.mutex.Lock()
+	defer logFile.mutex.Unlock()
+	if logFile.file == nil {
+		return "", fmt.Errorf("logger not initialized")
+	}
+
+	rotated := fmt.Sprintf("%s.%s", logFile.path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(logFile.path, rotated); err != nil {
+		return "", fmt.Errorf("failed to rotate %s: %v", logFile.path, err)
+	}
+	file, err := os.OpenFile(logFile.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		// Keep writing to the renamed file rather than losing log lines
+		return rotated, fmt.Errorf("failed to reopen %s: %v", logFile.path, err)
+	}
+	logFile.file.Close()
+	logFile.file = file
+	return rotated, nil
+}
@@ -9,11 +9,14 @@ import (
 	"syscall"
 	"time"
 
+	"vuDataSim/src/auth"
 	"vuDataSim/src/bin_control"
+	"vuDataSim/src/buildinfo"
 	"vuDataSim/src/clickhouse"
 	"vuDataSim/src/handlers"
 	"vuDataSim/src/logger"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/sshlimit"
 
 	"github.com/gorilla/mux"
 )
@@ -38,9 +41,15 @@ func main() {
 	if err := logger.InitLogger(logFilePath); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
+	// Module log levels changed through PUT /api/logging/levels
+	if err := logger.LoadLevels("data/log_levels.json"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load module log levels, using info")
+	}
 
 	// Initialize start time
-	handlers.AppState.StartTime = time.Now()
+	handlers.AppState.UpdateSimulation(func(sim *handlers.SimulationState) {
+		sim.StartTime = time.Now().UTC()
+	})
 
 	// Initialize node manager
 	err := handlers.NodeManager.LoadNodesConfig()
@@ -49,6 +58,11 @@ func main() {
 		logger.Warn().Msg("Node management features may not be available")
 	}
 
+	// Load API keys; with auth disabled every request is treated as admin
+	if err := handlers.Auth.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load auth config, API authentication disabled")
+	}
+
 	// Initialize o11y source manager
 	err = handlers.O11yManager.LoadMaxEPSConfig()
 	if err != nil {
@@ -56,19 +70,244 @@ func main() {
 		log.Println("O11y source management features may not be available")
 	}
 
+	// Share one transfer budget across all distribution jobs
+	settings := handlers.NodeManager.GetClusterSettings()
+	handlers.TransferScheduler.SetBudget(settings.MaxConcurrentTransfers, settings.TransferBandwidthKbps)
+	handlers.O11yManager.SetTransferScheduler(handlers.TransferScheduler)
+	handlers.TransferScheduler.OnTaskDone(handlers.RecordRunTransfer)
+	// A conf.d transaction cut short by a crash is rolled back before anything reads conf.d
+	if restored, err := handlers.O11yManager.RecoverConfDTransaction("data/confd_txn.json"); err != nil {
+		logger.Error().Err(err).Msg("Failed to recover interrupted conf.d transaction")
+	} else if len(restored) > 0 {
+		logger.Warn().Strs("files", restored).Msg("Rolled back interrupted conf.d transaction")
+	}
+	if err := handlers.O11yManager.LoadConfDSyncState("data/confd_sync.json"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load conf.d sync state")
+	}
+
+	// Load generic file distribution settings and history
+	if err := handlers.FileDistribution.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load distribution config, using defaults")
+	}
+
+	// Initialize run history and artifact retention
+	if err := handlers.RunStore.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load runs config, using defaults")
+	}
+	if err := handlers.RunStore.Load(); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load run history")
+	}
+
+	// Keep the event feed and run timelines for post-mortems
+	if err := handlers.EventHistory.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load event history config, using defaults")
+	}
+	handlers.RunStore.OnTimelineEvent(handlers.EventHistory.RecordTimelineEvent)
+
+	// Pick up topics_tables.yaml edits without a restart
+	kafkaHandler.WatchTopicsConfig(10 * time.Second)
+
+	// Metric samples older than metrics.stale_after_seconds are flagged stale
+	if err := handlers.Staleness.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load metrics config, using defaults")
+	}
+
+	// Node heartbeat history for availability reports
+	if err := handlers.Availability.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load node availability history")
+	}
+
+	// Notification channels, the daily run digest and the maintenance windows silencing them
+	if err := handlers.Notifier.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load notification channels")
+	}
+	handlers.Notifier.Watch("src/configs/config.yaml", 10*time.Second, func(err error) {
+		if err != nil {
+			logger.Warn().Err(err).Msg("Notifications config changed but was rejected, keeping the current channels")
+			return
+		}
+		logger.Info().Strs("channels", handlers.Notifier.Channels()).Msg("Reloaded notification channels")
+	})
+	if err := handlers.Digest.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load digest config, using defaults")
+	}
+	if err := handlers.Maintenance.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load maintenance windows")
+	}
+
+	// Checks a binary start must pass before it is reported as running
+	if err := handlers.BinaryControl.LoadVerifyConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load binary verification config, using defaults")
+	}
+	// Load generators besides finalvudatasim, assigned to nodes in nodes.yaml
+	if err := handlers.BinaryControl.LoadGeneratorsConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load generators config, using defaults")
+	}
+	// Background binary status polling; transitions are pushed to WebSocket clients
+	if err := handlers.BinaryControl.LoadStatusConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load binary status config, using defaults")
+	}
+	handlers.BinaryControl.OnStatusChange(handlers.BroadcastBinaryStatusChange)
+
+	// Shared HTTP client for node agents and exporters with per-host circuit breakers
+	if err := handlers.NodeClient.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load node polling config, using defaults")
+	}
+
+	// Nodes with an exporter_url are scraped from their node_exporter
+	if err := handlers.NodeExporter.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load node_exporter config, using defaults")
+	}
+	handlers.NodeExporter.SetClient(handlers.NodeClient)
+
+	// Every ssh and scp to a node waits for one of its max_sessions_per_node slots
+	if err := sshlimit.Default().LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load SSH limits config, using defaults")
+	}
+
+	// Commands and copies share pooled SSH connections per node, with host key checking
+	if err := node_control.SSH.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load SSH config, using defaults")
+	}
+
+	// Start the simulation watchdog
+	if err := handlers.Watchdog.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load watchdog config, using defaults")
+	}
+
+	if err := handlers.NodeSampler.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load node sampling config, using defaults")
+	}
+
+	if err := handlers.TableCheck.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load table check config, using defaults")
+	}
+
+	if err := handlers.ViewLagCheck.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load view lag config, using defaults")
+	}
+
+	if err := handlers.FleetStart.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load fleet start config, using defaults")
+	}
+
+	if err := handlers.BinaryBulk.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load binary bulk config, using defaults")
+	}
+
+	if err := handlers.VolumeEstimator.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load volume estimate config, using defaults")
+	}
+
+	if err := handlers.ConfDLint.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load conf.d lint config, using defaults")
+	}
+
+	if err := handlers.Adaptive.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load adaptive EPS config, using defaults")
+	}
+
+	if err := handlers.Storage.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load storage config, using defaults")
+	}
+
+	if err := handlers.ReportStorage.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load report storage config, keeping artifacts local")
+	}
+
+	if err := handlers.ConfigBackups.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load config backup settings, using defaults")
+	}
+
+	if err := handlers.Quotas.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load quota config, using defaults")
+	}
+
+	if err := handlers.RollingRestart.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load rolling restart config, using defaults")
+	}
+
+	if err := handlers.Troubleshooting.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load troubleshooting config, using defaults")
+	}
+
+	if err := handlers.LoadClickHouseResetConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load ClickHouse reset config, using defaults")
+	}
+	// Protection of the Kafka and ClickHouse this manager resets
+	if err := handlers.Environment.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load environment config, using defaults")
+	}
+
+	if err := handlers.SmokeTest.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load smoke test config, using defaults")
+	}
+
+	// Matrices of runs; a campaign interrupted by a restart comes back paused
+	if err := handlers.Campaigns.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load campaigns")
+	}
+
+	// Runs at set times; a run interrupted by a restart is recorded as failed
+	if err := handlers.Schedules.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load schedules")
+	}
+
+	if err := handlers.SchemaValidation.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load schema validation config, using defaults")
+	}
+
+	if err := handlers.Debug.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load debug config, profiling stays disabled")
+	}
+
+	if err := handlers.GenerationErrors.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load generation error tracking config, using defaults")
+	}
+
+	if err := handlers.Orphans.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load orphan scan config, using defaults")
+	}
+
+	if err := handlers.Idempotency.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load idempotency config, using defaults")
+	}
+
+	if err := handlers.Chaos.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load chaos config, chaos actions disabled")
+	}
+
+	// Load the saved ClickHouse query library
+	if err := clickhouse.SavedQueries.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load saved ClickHouse queries")
+	}
+
+	// With ha.enabled, instances sharing the data directory elect one leader that runs
+	// monitoring and retention; followers take over when the leader's lease expires
+	if err := handlers.HA.LoadConfig("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to load HA config, running as a single instance")
+	}
+	handlers.HA.Start(startLeaderDuties, func() {
+		// Background loops cannot be stopped, so exit and rejoin as a follower on restart
+		logger.Fatal().Str("instance", handlers.HA.InstanceID()).Msg("Lost leadership, exiting")
+	})
+
 	// Main config is loaded dynamically when needed
 
 	// Source configs are loaded dynamically when needed
 
 	// Check for CLI node management commands
 
-	logger.Info().Str("version", handlers.AppVersion).Msg("Starting vuDataSim Cluster Manager")
+	build := buildinfo.Get()
+	logger.Info().Str("version", build.Version).Str("commit", build.Commit).Str("buildDate", build.BuildDate).Msg("Starting vuDataSim Cluster Manager")
 	logger.Info().Str("static_dir", handlers.StaticDir).Msg("Serving static files")
 
 	// Create router
 	router := mux.NewRouter()
 
 	// Apply middleware
+	router.Use(requestIDMiddleware)
+	router.Use(recoveryMiddleware)
 	router.Use(loggingMiddleware)
 	router.Use(corsMiddleware)
 
@@ -90,32 +329,205 @@ func main() {
 	// WebSocket endpoint
 	router.HandleFunc("/ws", handleWebSocket)
 
-	// API endpoints
-	api := router.PathPrefix("/api").Subrouter()
+	// API endpoints. Routes are served under /api/v1; the unversioned /api
+	// prefix is kept as a deprecated alias so existing UI and scripts keep working.
+	// Bootstrap endpoints authenticate with the one-time token embedded in a generated
+	// script instead of an API key, so they are mounted ahead of authMiddleware
+	for _, prefix := range []string{"/api/" + APIVersion, "/api"} {
+		router.HandleFunc(prefix+"/nodes/bootstrap/files/{file}", handlers.HandleAPIBootstrapFile).Methods("GET")
+		router.HandleFunc(prefix+"/nodes/bootstrap/register", handlers.HandleAPIBootstrapRegister).Methods("POST")
+	}
+
+	v1 := router.PathPrefix("/api/" + APIVersion).Subrouter()
+	v1.Use(apiVersionMiddleware)
+	v1.Use(authMiddleware)
+	v1.Use(haMiddleware)
+	v1.Use(troubleshootingMiddleware)
+	v1.Use(idempotencyMiddleware)
+	registerAPIRoutes(v1)
+
+	legacy := router.PathPrefix("/api").Subrouter()
+	legacy.Use(apiVersionMiddleware)
+	legacy.Use(legacyAPIMiddleware)
+	legacy.Use(authMiddleware)
+	legacy.Use(haMiddleware)
+	legacy.Use(troubleshootingMiddleware)
+	legacy.Use(idempotencyMiddleware)
+	registerAPIRoutes(legacy)
+
+	// Initialize ClickHouse client
+	if err := clickhouse.InitClickHouse("src/configs/config.yaml"); err != nil {
+		logger.Warn().Err(err).Msg("Failed to initialize ClickHouse client - metrics will not be available")
+	} else {
+		logger.Info().Msg("ClickHouse client initialized successfully")
+	}
+
+	// Start background real metrics collection
+
+	// Set up graceful shutdown
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-c
+		log.Println("Shutting down server...")
+
+		if handlers.HA.IsLeader() {
+			if err := handlers.Availability.Save(); err != nil {
+				log.Printf("Failed to save node availability history: %v", err)
+			}
+		}
+		handlers.HA.Resign()
+		handlers.AppState.UpdateSimulation(func(sim *handlers.SimulationState) {
+			sim.Running = false
+		})
+
+		os.Exit(0)
+	}()
+
+	// Start server
+	logger.Info().Str("port", handlers.Port).Msg("Server starting")
+	logger.Info().Str("url", "http://"+handlers.Port).Msg("Open in browser")
+
+	srv := &http.Server{
+		Addr:         handlers.Port,
+		Handler:      router,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// startLeaderDuties starts the background work only one manager instance may do. With HA
+// enabled it runs on election, after reloading the state the previous leader persisted.
+func startLeaderDuties() {
+	if handlers.HA.Status().Enabled {
+		if err := handlers.FileDistribution.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload distribution history")
+		}
+		if err := clickhouse.SavedQueries.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload saved ClickHouse queries")
+		}
+		if err := handlers.Availability.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload node availability history")
+		}
+		if err := handlers.Digest.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload digest state")
+		}
+		if err := handlers.Maintenance.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload maintenance windows")
+		}
+		if err := handlers.Campaigns.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload campaigns")
+		}
+		if err := handlers.Schedules.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload schedules")
+		}
+		if err := handlers.ConfigBackups.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload config backup index")
+		}
+		if restored, err := handlers.O11yManager.RecoverConfDTransaction("data/confd_txn.json"); err != nil {
+			logger.Error().Err(err).Msg("Failed to recover interrupted conf.d transaction")
+		} else if len(restored) > 0 {
+			logger.Warn().Strs("files", restored).Msg("Rolled back interrupted conf.d transaction")
+		}
+		if err := handlers.O11yManager.LoadConfDSyncState("data/confd_sync.json"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload conf.d sync state")
+		}
+		if err := handlers.Auth.LoadConfig("src/configs/config.yaml"); err != nil {
+			logger.Warn().Err(err).Msg("Failed to reload API keys")
+		}
+		handlers.ResumeLeaderState()
+	}
+
+	if _, err := handlers.RunStore.ApplyRetention(); err != nil {
+		logger.Warn().Err(err).Msg("Failed to apply artifact retention")
+	}
+	handlers.RunStore.StartRetentionLoop(6*time.Hour, func(err error) {
+		logger.Warn().Err(err).Msg("Failed to apply artifact retention")
+	})
+
+	handlers.Watchdog.Start()
+	handlers.ViewLagCheck.Start()
+	handlers.Storage.Start()
+	handlers.NodeSampler.Start()
+	handlers.BinaryControl.StartStatusPoller()
+	handlers.StartExporterScraping()
+	handlers.Digest.Start()
+	handlers.Maintenance.Start()
+	handlers.Schedules.Start()
+	handlers.SchemaValidation.Start()
+	handlers.GenerationErrors.Start()
+	handlers.Orphans.ScanAtStartup()
+	handlers.GeneratorEPS.Start()
+	handlers.ConfigBackups.Start()
+	handlers.Availability.StartFlushLoop(time.Minute, func(err error) {
+		logger.Warn().Err(err).Msg("Failed to save node availability history")
+	})
+}
+
+// registerAPIRoutes registers every API endpoint on the given subrouter. It is
+// called once per mounted prefix (/api/v1 and the legacy /api alias).
+func registerAPIRoutes(api *mux.Router) {
 	api.HandleFunc("/dashboard", handlers.GetDashboardData).Methods("GET")
 	api.HandleFunc("/simulation/start", handlers.StartSimulation).Methods("POST")
 	api.HandleFunc("/simulation/stop", handlers.StopSimulation).Methods("POST")
-	api.HandleFunc("/config/sync", handlers.SyncConfiguration).Methods("POST")
+	api.HandleFunc("/simulation/eps", handlers.AdjustSimulationEPS).Methods("PATCH")
+	api.HandleFunc("/simulation/adaptive", handlers.HandleAPIGetAdaptive).Methods("GET")
+	api.HandleFunc("/simulation/adaptive", handlers.HandleAPIStartAdaptive).Methods("POST")
+	api.HandleFunc("/simulation/adaptive", handlers.HandleAPIStopAdaptive).Methods("DELETE")
+	api.HandleFunc("/capacity", handlers.HandleAPIGetCapacity).Methods("GET")
+	api.HandleFunc("/config/sync", requireRole(auth.RoleOperator, handlers.HandleAPISyncConfig)).Methods("POST")
 	api.HandleFunc("/logs", handlers.GetLogs).Methods("GET")
 	api.HandleFunc("/nodes/{nodeId}/metrics", handlers.UpdateNodeMetrics).Methods("PUT")
-	api.HandleFunc("/health", handlers.HealthCheck).Methods("GET`")
-	api.HandleFunc("/dashboard", handlers.GetDashboardData).Methods("GET")
+	api.HandleFunc("/nodes/{name}/exporter", handlers.HandleAPINodeExporter).Methods("GET")
+	api.HandleFunc("/nodes/{name}/availability", handlers.HandleAPIGetNodeAvailability).Methods("GET")
+	api.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	api.HandleFunc("/version", handlers.HandleAPIGetVersion).Methods("GET")
 	// Cluster metrics API endpoint
 	api.HandleFunc("/cluster/metrics", handlers.HandleAPIGetClusterMetrics).Methods("GET")
+	api.HandleFunc("/cluster/summary", handlers.HandleAPIGetClusterSummary).Methods("GET")
+	api.HandleFunc("/cluster/orphans", handlers.HandleAPIGetOrphans).Methods("GET")
+	api.HandleFunc("/cluster/orphans/cleanup", handlers.HandleAPICleanupOrphans).Methods("POST")
 	// Metrics with time range endpoint
 	api.HandleFunc("/metrics", handlers.GetMetrics).Methods("GET")
 
 	// Node management API endpoints
 	api.HandleFunc("/nodes", handlers.HandleAPINodes).Methods("GET")
+	api.HandleFunc("/nodes/agents", handlers.HandleAPIGetNodeAgents).Methods("GET")
+	api.HandleFunc("/nodes/reservations", handlers.HandleAPIGetNodeReservations).Methods("GET")
+	api.HandleFunc("/nodes/agents/upgrade", requireRole(auth.RoleOperator, handlers.HandleAPIStartAgentUpgrade)).Methods("POST")
+	api.HandleFunc("/nodes/agents/upgrade", handlers.HandleAPIGetAgentUpgrade).Methods("GET")
+	api.HandleFunc("/nodes/bootstrap-script", requireRole(auth.RoleOperator, handlers.HandleAPIGetBootstrapScript)).Methods("GET")
 	api.HandleFunc("/nodes/{name}", handlers.HandleAPINodeActions).Methods("POST", "PUT", "DELETE")
 	api.HandleFunc("/nodes/{name}/debug", handlers.HandleAPIDebugMetricsBinary).Methods("GET")
+	api.HandleFunc("/nodes/{name}/probe", handlers.HandleAPIProbeNode).Methods("GET")
+	api.HandleFunc("/nodes/{name}/inventory", handlers.HandleAPIGetNodeInventory).Methods("GET")
+	api.HandleFunc("/nodes/{name}/confd/diff", handlers.HandleAPIGetConfDDiff).Methods("GET")
+	api.HandleFunc("/nodes/{name}/top", handlers.HandleAPIGetNodeTop).Methods("GET")
+	api.HandleFunc("/nodes/{name}/pprof", requireRole(auth.RoleAdmin, handlers.HandleAPINodePprof)).Methods("POST")
+	api.HandleFunc("/events/history", handlers.HandleAPIGetEventHistory).Methods("GET")
+	api.HandleFunc("/config-backups", handlers.HandleAPIGetConfigBackups).Methods("GET")
+	api.HandleFunc("/config-backups", handlers.HandleAPICreateConfigBackup).Methods("POST")
+	api.HandleFunc("/config-backups/{name}", handlers.HandleAPIDownloadConfigBackup).Methods("GET")
 	api.HandleFunc("/cluster-settings", handlers.HandleAPIClusterSettings).Methods("GET", "PUT")
 
 	// Binary control API endpoints
 	api.HandleFunc("/binary/status", handlers.HandleAPIGetAllBinaryStatus).Methods("GET")
 	api.HandleFunc("/binary/status/{node}", handlers.HandleAPIGetBinaryStatus).Methods("GET")
+	api.HandleFunc("/binary/start", handlers.HandleAPIStartFleet).Methods("POST")
 	api.HandleFunc("/binary/start/{node}", handlers.HandleAPIStartBinary).Methods("POST")
 	api.HandleFunc("/binary/stop/{node}", handlers.HandleAPIStopBinary).Methods("POST")
+	api.HandleFunc("/binary/stop", handlers.HandleAPIStopFleet).Methods("POST")
+	api.HandleFunc("/binary/start-all", handlers.HandleAPIStartAllBinaries).Methods("POST")
+	api.HandleFunc("/binary/stop-all", handlers.HandleAPIStopAllBinaries).Methods("POST")
+	api.HandleFunc("/binary/rolling-restart", handlers.HandleAPIStartRollingRestart).Methods("POST")
+	api.HandleFunc("/binary/rolling-restart", handlers.HandleAPIGetRollingRestart).Methods("GET")
+	api.HandleFunc("/binary/generators", handlers.HandleAPIGetGenerators).Methods("GET")
 
 	// O11y Source Manager API endpoints
 	api.HandleFunc("/o11y/sources", handlers.HandleAPIGetO11ySources).Methods("GET")
@@ -124,10 +536,83 @@ func main() {
 	api.HandleFunc("/o11y/eps/split", handlers.HandleAPISplitEPS).Methods("POST")
 	api.HandleFunc("/o11y/eps/distribute", handlers.HandleAPIDistributeEPS).Methods("POST")
 	api.HandleFunc("/o11y/eps/current", handlers.HandleAPIGetCurrentEPS).Methods("GET")
-	api.HandleFunc("/o11y/sources/{source}/enable", handlers.HandleAPIEnableO11ySource).Methods("POST")
-	api.HandleFunc("/o11y/sources/{source}/disable", handlers.HandleAPIDisableO11ySource).Methods("POST")
+	api.HandleFunc("/o11y/eps/what-if", handlers.HandleAPIGetEPSWhatIf).Methods("GET")
+	api.HandleFunc("/o11y/eps/ramp", handlers.HandleAPIStartRamp).Methods("POST")
+	api.HandleFunc("/o11y/eps/ramp", handlers.HandleAPIStopRamp).Methods("DELETE")
+	api.HandleFunc("/o11y/eps/ramp/status", handlers.HandleAPIGetRampStatus).Methods("GET")
+	api.HandleFunc("/o11y/estimate", handlers.HandleAPIEstimateVolume).Methods("GET")
+	api.HandleFunc("/o11y/sources/{source}/enable", kafkaHandler.EnableSource).Methods("POST")
+	api.HandleFunc("/o11y/sources/{source}/disable", kafkaHandler.DisableSource).Methods("POST")
 	api.HandleFunc("/o11y/max-eps", handlers.HandleAPIGetMaxEPSConfig).Methods("GET")
+	api.HandleFunc("/o11y/max-eps/{source}", handlers.HandleAPIGetSourceMaxEPS).Methods("GET")
+	api.HandleFunc("/o11y/max-eps/{source}", handlers.HandleAPIUpdateSourceMaxEPS).Methods("PUT")
 	api.HandleFunc("/o11y/confd/distribute", handlers.HandleAPIDistributeConfD).Methods("POST")
+	api.HandleFunc("/o11y/confd/lint", handlers.HandleAPILintConfD).Methods("GET")
+	api.HandleFunc("/o11y/confd/verify", handlers.HandleAPIVerifyConfD).Methods("GET")
+	api.HandleFunc("/o11y/confd/conflicts", handlers.HandleAPIGetConfDConflicts).Methods("GET")
+	api.HandleFunc("/o11y/confd/conflicts/{id}", handlers.HandleAPIGetConfDConflict).Methods("GET")
+	api.HandleFunc("/o11y/confd/conflicts/{id}/resolve", handlers.HandleAPIResolveConfDConflict).Methods("POST")
+
+	// Manager self-monitoring
+	api.HandleFunc("/self/reliability", handlers.HandleAPISelfReliability).Methods("GET")
+	api.HandleFunc("/self/panics", handlers.HandleAPISelfPanics).Methods("GET")
+	api.HandleFunc("/self/node-polling", handlers.HandleAPISelfNodePolling).Methods("GET")
+	api.HandleFunc("/self/ssh", handlers.HandleAPISelfSSH).Methods("GET")
+	api.HandleFunc("/self/storage", handlers.HandleAPISelfStorage).Methods("GET")
+	api.HandleFunc("/self/goroutines", requireRole(auth.RoleAdmin, handlers.HandleAPISelfGoroutines)).Methods("GET")
+	api.HandleFunc("/debug/pprof/", requireRole(auth.RoleAdmin, handlers.HandleAPIPprof)).Methods("GET")
+	api.HandleFunc("/debug/pprof/{profile}", requireRole(auth.RoleAdmin, handlers.HandleAPIPprof)).Methods("GET", "POST")
+	api.HandleFunc("/logging/levels", handlers.HandleAPIGetLogLevels).Methods("GET")
+	api.HandleFunc("/logging/levels", handlers.HandleAPISetLogLevels).Methods("PUT")
+	api.HandleFunc("/troubleshooting", handlers.HandleAPIGetTroubleshooting).Methods("GET")
+	api.HandleFunc("/troubleshooting", requireRole(auth.RoleAdmin, handlers.HandleAPIStartTroubleshooting)).Methods("PUT")
+	api.HandleFunc("/troubleshooting", requireRole(auth.RoleAdmin, handlers.HandleAPIStopTroubleshooting)).Methods("DELETE")
+	api.HandleFunc("/support-bundle", requireRole(auth.RoleAdmin, handlers.HandleAPICreateSupportBundle)).Methods("POST")
+	api.HandleFunc("/ha/status", handlers.HandleAPIGetHAStatus).Methods("GET")
+
+	// Simulation watchdog
+	api.HandleFunc("/watchdog", handlers.HandleAPIGetWatchdog).Methods("GET")
+
+	// Chaos actions, scoped to the current run
+	api.HandleFunc("/chaos/actions", handlers.HandleAPIListChaos).Methods("GET")
+	api.HandleFunc("/chaos/actions", requireRole(auth.RoleAdmin, handlers.HandleAPIStartChaos)).Methods("POST")
+	api.HandleFunc("/chaos/actions/{id}", requireRole(auth.RoleAdmin, handlers.HandleAPIRevertChaos)).Methods("DELETE")
+
+	// Smoke test: one source end to end on one node
+	api.HandleFunc("/smoke-test", handlers.HandleAPIGetSmokeTest).Methods("GET")
+	api.HandleFunc("/smoke-test", handlers.HandleAPIStartSmokeTest).Methods("POST")
+
+	// Campaigns: matrices of runs, one after the other
+	api.HandleFunc("/campaigns", handlers.HandleAPIListCampaigns).Methods("GET")
+	api.HandleFunc("/campaigns", requireRole(auth.RoleOperator, handlers.HandleAPICreateCampaign)).Methods("POST")
+	api.HandleFunc("/campaigns/{id}", handlers.HandleAPIGetCampaign).Methods("GET")
+	api.HandleFunc("/campaigns/{id}/report", handlers.HandleAPIGetCampaignReport).Methods("GET")
+	api.HandleFunc("/campaigns/{id}/pause", requireRole(auth.RoleOperator, handlers.HandleAPIPauseCampaign)).Methods("POST")
+	api.HandleFunc("/campaigns/{id}/resume", requireRole(auth.RoleOperator, handlers.HandleAPIResumeCampaign)).Methods("POST")
+	api.HandleFunc("/campaigns/{id}/cancel", requireRole(auth.RoleOperator, handlers.HandleAPICancelCampaign)).Methods("POST")
+
+	// Schedules: runs started at set times, on a cron expression or once
+	api.HandleFunc("/schedules", handlers.HandleAPIListSchedules).Methods("GET")
+	api.HandleFunc("/schedules", requireRole(auth.RoleOperator, handlers.HandleAPICreateSchedule)).Methods("POST")
+	api.HandleFunc("/schedules/{id}", handlers.HandleAPIGetSchedule).Methods("GET")
+	api.HandleFunc("/schedules/{id}", requireRole(auth.RoleOperator, handlers.HandleAPIDeleteSchedule)).Methods("DELETE")
+	api.HandleFunc("/schedules/{id}/enable", requireRole(auth.RoleOperator, handlers.HandleAPIEnableSchedule)).Methods("POST")
+	api.HandleFunc("/schedules/{id}/disable", requireRole(auth.RoleOperator, handlers.HandleAPIDisableSchedule)).Methods("POST")
+
+	// Minted dashboard API keys
+	api.HandleFunc("/auth/keys", requireRole(auth.RoleAdmin, handlers.HandleAPIListAPIKeys)).Methods("GET")
+	api.HandleFunc("/auth/keys", requireRole(auth.RoleAdmin, handlers.HandleAPIMintAPIKey)).Methods("POST")
+	api.HandleFunc("/auth/keys/{id}", requireRole(auth.RoleAdmin, handlers.HandleAPIRevokeAPIKey)).Methods("DELETE")
+
+	// Distribution jobs
+	api.HandleFunc("/jobs", handlers.HandleAPIListJobs).Methods("GET")
+	api.HandleFunc("/jobs/{id}", handlers.HandleAPIGetJob).Methods("GET")
+
+	// File distribution routes
+	api.HandleFunc("/files/distribute", handlers.HandleAPIDistributeFiles).Methods("POST")
+	api.HandleFunc("/files/distributions", handlers.HandleAPIListDistributions).Methods("GET")
+	api.HandleFunc("/files/distributions/{id}", handlers.HandleAPIGetDistribution).Methods("GET")
+
 	// SSH status API endpoint
 	api.HandleFunc("/ssh/status", handlers.HandleAPIGetSSHStatus).Methods("GET")
 	// ClickHouse metrics API endpoints
@@ -135,19 +620,39 @@ func main() {
 	api.HandleFunc("/clickhouse/health", handlers.HandleAPIClickHouseHealth).Methods("GET")
 	api.HandleFunc("/clickhouse/kafka-topics", handlers.HandleAPIGetKafkaTopicMetrics).Methods("GET")
 	api.HandleFunc("/clickhouse/pod-metrics", handlers.HandleAPIGetPodMetrics).Methods("GET")
+	api.HandleFunc("/clickhouse/saved", handlers.HandleAPIListSavedQueries).Methods("GET")
+	api.HandleFunc("/clickhouse/saved/{name}", handlers.HandleAPIRunSavedQuery).Methods("GET")
+	api.HandleFunc("/clickhouse/saved/{name}", handlers.HandleAPIPutSavedQuery).Methods("PUT")
+	api.HandleFunc("/clickhouse/saved/{name}", handlers.HandleAPIDeleteSavedQuery).Methods("DELETE")
+
+	// Data-flow topology endpoint
+	api.HandleFunc("/topology", kafkaHandler.GetTopology).Methods("GET")
 
 	// Kubernetes API endpoints
 	api.HandleFunc("/kubernetes/pods", handlers.HandleAPIGetKubernetesPods).Methods("GET")
 
 	// Kafka and ClickHouse Reset API endpoints
 	api.HandleFunc("/kafka/topics", kafkaHandler.GetTopics).Methods("GET")
+	api.HandleFunc("/kafka/topics/reload", kafkaHandler.ReloadTopics).Methods("POST")
+	api.HandleFunc("/kafka/topics/{topic}/partitions", kafkaHandler.GetTopicPartitions).Methods("GET")
 	api.HandleFunc("/kafka/recreate", kafkaHandler.RecreateTopicsForO11ySources).Methods("POST")
 	api.HandleFunc("/kafka/status", kafkaHandler.GetTopicStatus).Methods("GET")
 	api.HandleFunc("/kafka/describe/{topic}", kafkaHandler.DescribeTopic).Methods("GET")
 	api.HandleFunc("/kafka/delete/{topic}", kafkaHandler.DeleteTopic).Methods("DELETE")
 	api.HandleFunc("/kafka/create", kafkaHandler.CreateTopic).Methods("POST")
+	api.HandleFunc("/kafka/produce-test/{topic}", kafkaHandler.ProduceTest).Methods("POST")
+	api.HandleFunc("/o11y/sources/{source}/output/kafka", kafkaHandler.GetSourceKafkaOutput).Methods("GET")
+	api.HandleFunc("/o11y/sources/{source}/output/kafka", kafkaHandler.UpdateSourceKafkaOutput).Methods("PUT")
+	api.HandleFunc("/o11y/sources/{source}/schema", handlers.HandleAPIGetSourceSchema).Methods("GET")
+	api.HandleFunc("/o11y/sources/{source}/schema", handlers.HandleAPIUpdateSourceSchema).Methods("PUT")
+	api.HandleFunc("/o11y/sources/{source}/schema", handlers.HandleAPIDeleteSourceSchema).Methods("DELETE")
+	api.HandleFunc("/o11y/schemas", handlers.HandleAPIGetSourceSchemas).Methods("GET")
+	api.HandleFunc("/o11y/schemas/validate", handlers.HandleAPIValidateSourceSchemas).Methods("POST")
+	api.HandleFunc("/o11y/schemas/validation", handlers.HandleAPIGetSchemaValidation).Methods("GET")
 	api.HandleFunc("/clickhouse/truncate", kafkaHandler.TruncateClickHouseTables).Methods("POST")
 	api.HandleFunc("/clickhouse/tables", kafkaHandler.GetClickHouseTableNames).Methods("GET")
+	api.HandleFunc("/clickhouse/tables/check", handlers.HandleAPICheckRunTables).Methods("GET")
+	api.HandleFunc("/clickhouse/views/lag", handlers.HandleAPIGetViewLag).Methods("GET")
 
 	// K6 Load Testing API endpoints
 	api.HandleFunc("/k6/config", handlers.HandleAPIGetK6Config).Methods("GET")
@@ -159,47 +664,44 @@ func main() {
 	api.HandleFunc("/k6/logs", handlers.HandleAPIGetK6Logs).Methods("GET")
 
 	// Proxy endpoint for node metrics API
-	api.HandleFunc("/proxy/metrics", handlers.HandleProxyMetrics).Methods("GET")
+	api.HandleFunc("/proxy/metrics", deprecated(handlers.HandleProxyMetrics, proxyMetricsSunset, "/process/metrics")).Methods("GET")
+
+	// Simulation quotas per user and team
+	api.HandleFunc("/quotas", handlers.HandleAPIGetQuotas).Methods("GET")
+
+	// Environment protection of destructive endpoints and its audit log
+	api.HandleFunc("/environment", handlers.HandleAPIGetEnvironment).Methods("GET")
+	api.HandleFunc("/environment/audit", requireRole(auth.RoleOperator, handlers.HandleAPIGetEnvironmentAudit)).Methods("GET")
+
+	// Run artifact endpoints
+	api.HandleFunc("/runs", handlers.HandleAPIListRuns).Methods("GET")
+	api.HandleFunc("/runs", requireRole(auth.RoleOperator, handlers.HandleAPICreateRun)).Methods("POST")
+	api.HandleFunc("/runs/{id}", handlers.HandleAPIGetRun).Methods("GET")
+	api.HandleFunc("/runs/{id}/artifacts", handlers.HandleAPIGetRunArtifacts).Methods("GET")
+	api.HandleFunc("/runs/{id}/artifacts.zip", handlers.HandleAPIDownloadRunArtifacts).Methods("GET")
+	api.HandleFunc("/runs/{id}/artifacts/links", handlers.HandleAPIGetRunArtifactLinks).Methods("GET")
+	api.HandleFunc("/runs/{id}/artifacts/upload", handlers.HandleAPIUploadRunArtifacts).Methods("POST")
+	api.HandleFunc("/runs/{id}/report", handlers.HandleAPIGetRunReport).Methods("GET")
+	api.HandleFunc("/runs/{id}/junit.xml", handlers.HandleAPIGetRunJUnit).Methods("GET")
+	api.HandleFunc("/runs/{id}/comparison", handlers.HandleAPIGetRunComparison).Methods("GET")
+	api.HandleFunc("/runs/{id}/node-metrics.csv", handlers.HandleAPIExportRunNodeMetrics).Methods("GET")
+	api.HandleFunc("/runs/{id}/node-metrics/aggregate", handlers.HandleAPIGetRunNodeMetricsAggregate).Methods("GET")
+	api.HandleFunc("/runs/{id}/network", handlers.HandleAPIGetRunNetwork).Methods("GET")
+	api.HandleFunc("/runs/{id}/generation-errors", handlers.HandleAPIGetRunGenerationErrors).Methods("GET")
+	api.HandleFunc("/runs/{id}/temporary-topics/teardown", requireRole(auth.RoleOperator, handlers.HandleAPITeardownRunTopics)).Methods("POST")
+	api.HandleFunc("/runs/{id}/baseline", handlers.HandleAPIPinBaseline).Methods("POST")
+	api.HandleFunc("/baselines", handlers.HandleAPIGetBaselines).Methods("GET")
+	api.HandleFunc("/baselines/{scenario}", handlers.HandleAPIUnpinBaseline).Methods("DELETE")
+
+	// Run digest, maintenance windows and notification channels
+	api.HandleFunc("/digest", handlers.HandleAPIGetDigest).Methods("GET")
+	api.HandleFunc("/digest/send", handlers.HandleAPISendDigest).Methods("POST")
+	api.HandleFunc("/maintenance", handlers.HandleAPIGetMaintenance).Methods("GET")
+	api.HandleFunc("/maintenance/windows", requireRole(auth.RoleOperator, handlers.HandleAPICreateMaintenanceWindow)).Methods("POST")
+	api.HandleFunc("/maintenance/windows/{id}", requireRole(auth.RoleOperator, handlers.HandleAPIEndMaintenanceWindow)).Methods("DELETE")
+	api.HandleFunc("/notifications", handlers.HandleAPIGetNotifications).Methods("GET")
+	api.HandleFunc("/notifications/test", requireRole(auth.RoleAdmin, handlers.HandleAPITestNotification)).Methods("POST")
 
 	// Process metrics endpoint - collects finalvudatasim metrics directly via SSH
 	api.HandleFunc("/process/metrics", handlers.HandleAPIGetProcessMetrics).Methods("GET")
-
-	// Initialize ClickHouse client
-	if err := clickhouse.InitClickHouse("src/configs/config.yaml"); err != nil {
-		logger.Warn().Err(err).Msg("Failed to initialize ClickHouse client - metrics will not be available")
-	} else {
-		logger.Info().Msg("ClickHouse client initialized successfully")
-	}
-
-	// Start background real metrics collection
-
-	// Set up graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-c
-		log.Println("Shutting down server...")
-
-		handlers.AppState.IsSimulationRunning = false
-		handlers.AppState.Mutex.Unlock()
-
-		os.Exit(0)
-	}()
-
-	// Start server
-	logger.Info().Str("port", handlers.Port).Msg("Server starting")
-	logger.Info().Str("url", "http://"+handlers.Port).Msg("Open in browser")
-
-	srv := &http.Server{
-		Addr:         handlers.Port,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server error: %v", err)
-	}
 }
@@ -1,12 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
 	"time"
+	"vuDataSim/src/auth"
 	"vuDataSim/src/handlers"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
 
+	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
@@ -15,16 +30,563 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %v", r.Method, r.URL.Path, time.Since(start))
+		log.Printf("%s %s %v [%s]", r.Method, r.URL.Path, time.Since(start), logger.RequestID(r.Context()))
 	})
 }
 
+// requestIDPattern limits client-supplied correlation IDs to something safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Middleware for correlation IDs. A valid X-Request-ID from the client is kept,
+// otherwise one is generated; it is echoed on the response and attached to the context.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logger.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(logger.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logger.WithRequestID(r.Context(), id)))
+	})
+}
+
+// Middleware for handler panics. The panic is logged with its stack and the request's
+// correlation ID, counted in /api/self/panics, and answered with a 500 that carries the
+// correlation ID as reference unless the handler had already started its response.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracked := &trackingResponseWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// Deliberate abort of the response, let net/http handle it
+				panic(recovered)
+			}
+
+			referenceID := logger.RequestID(r.Context())
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			selfstats.RecordPanic(selfstats.PanicRecord{
+				Time:        time.Now().UTC(),
+				ReferenceID: referenceID,
+				Method:      r.Method,
+				Route:       route,
+				Path:        r.URL.Path,
+				Error:       fmt.Sprint(recovered),
+			})
+			logger.Error().
+				Str("node", "System").
+				Str("module", "API").
+				Str("type", "error").
+				Str("request_id", referenceID).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("stack", string(debug.Stack())).
+				Msgf("Panic in %s %s: %v", r.Method, route, recovered)
+
+			if tracked.wroteHeader || tracked.hijacked {
+				return
+			}
+			handlers.SendJSONResponse(w, http.StatusInternalServerError, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Internal server error, reference %s", referenceID),
+				Data:    map[string]string{"referenceId": referenceID},
+			})
+		}()
+		next.ServeHTTP(tracked, r)
+	})
+}
+
+// trackingResponseWriter remembers whether a response was started, and passes
+// hijacking and flushing through for WebSocket and streaming handlers
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (t *trackingResponseWriter) WriteHeader(status int) {
+	t.wroteHeader = true
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *trackingResponseWriter) Write(data []byte) (int, error) {
+	t.wroteHeader = true
+	return t.ResponseWriter.Write(data)
+}
+
+func (t *trackingResponseWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		t.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+func (t *trackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := t.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	t.hijacked = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend write deadlines
+func (t *trackingResponseWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// API versioning
+const (
+	// APIVersion is the current (and only) supported API version
+	APIVersion = "v1"
+	// APIVersionHeader is sent on every API response and may be set by clients
+	// to request a specific version
+	APIVersionHeader = "X-API-Version"
+	// HALeaderHeader carries the leader's advertise_url on requests refused by a follower
+	HALeaderHeader = "X-HA-Leader"
+)
+
+var (
+	// legacyAPISunset is when the unversioned /api prefix stops being served
+	legacyAPISunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+	// proxyMetricsSunset is when /proxy/metrics is removed in favour of /process/metrics
+	proxyMetricsSunset = time.Date(2027, time.March, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// Middleware for API version negotiation. Clients may send X-API-Version or
+// Accept-Version; unsupported versions are rejected with 406.
+func apiVersionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested := r.Header.Get(APIVersionHeader)
+		if requested == "" {
+			requested = r.Header.Get("Accept-Version")
+		}
+
+		w.Header().Set(APIVersionHeader, APIVersion)
+
+		if requested != "" && !isSupportedAPIVersion(requested) {
+			handlers.SendJSONResponse(w, http.StatusNotAcceptable, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Unsupported API version %q, supported versions: %s", requested, APIVersion),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSupportedAPIVersion accepts both "v1" and "1"
+func isSupportedAPIVersion(version string) bool {
+	version = strings.ToLower(strings.TrimSpace(version))
+	return version == APIVersion || "v"+version == APIVersion
+}
+
+// Middleware for the unversioned /api prefix, marking every response as deprecated
+// and pointing clients at the /api/v1 equivalent
+func legacyAPIMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := "/api/" + APIVersion + strings.TrimPrefix(r.URL.Path, "/api")
+		setDeprecationHeaders(w, legacyAPISunset, successor)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deprecated wraps a handler whose endpoint is scheduled for removal. The
+// successor is the replacement path relative to the API prefix.
+func deprecated(next http.HandlerFunc, sunset time.Time, successor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setDeprecationHeaders(w, sunset, "/api/"+APIVersion+successor)
+		next(w, r)
+	}
+}
+
+// setDeprecationHeaders sets the Deprecation, Sunset (RFC 8594), Link and Warning headers
+func setDeprecationHeaders(w http.ResponseWriter, sunset time.Time, successor string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	if successor != "" {
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+	}
+	w.Header().Set("Warning", fmt.Sprintf("299 - \"Deprecated API: use %s, this endpoint will be removed after %s\"",
+		successor, sunset.UTC().Format("2006-01-02")))
+}
+
+// Middleware for API key authentication. The caller's identity is attached to the
+// request context; with auth enabled, reads need the viewer role and mutations the
+// operator role. Endpoints needing more are wrapped with requireRole.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := handlers.Auth.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="vuDataSim"`)
+			handlers.SendJSONResponse(w, http.StatusUnauthorized, handlers.APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		required := auth.RoleViewer
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+			required = auth.RoleOperator
+		}
+		if !auth.RoleAllows(identity.Role, required) {
+			handlers.SendJSONResponse(w, http.StatusForbidden, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Role %s may not %s %s", identity.Role, r.Method, r.URL.Path),
+			})
+			return
+		}
+		if identity.Scope == auth.ScopeDashboard && !dashboardRoute(r) {
+			handlers.SendJSONResponse(w, http.StatusForbidden, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("API key %s is limited to dashboard endpoints and may not %s %s", identity.Name, r.Method, r.URL.Path),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// dashboardRoutes are the endpoints a dashboard-scoped key may read: metrics, runs and
+// reports. Nothing here reaches nodes over SSH or changes state.
+var dashboardRoutes = map[string]bool{
+	"/dashboard":                   true,
+	"/health":                      true,
+	"/metrics":                     true,
+	"/cluster/metrics":             true,
+	"/cluster/summary":             true,
+	"/nodes/{name}/availability":   true,
+	"/nodes/reservations":          true,
+	"/o11y/eps/current":            true,
+	"/clickhouse/metrics":          true,
+	"/clickhouse/views/lag":        true,
+	"/runs/{id}/report":            true,
+	"/runs/{id}/junit.xml":         true,
+	"/runs/{id}/generation-errors": true,
+	"/runs/{id}/comparison":        true,
+	"/runs/{id}/node-metrics.csv":  true,
+	"/campaigns/{id}/report":       true,
+	"/baselines":                   true,
+	"/digest":                      true,
+	"/maintenance":                 true,
+	"/watchdog":                    true,
+	"/self/reliability":            true,
+}
+
+// dashboardRoute reports whether the matched route of r is open to dashboard keys
+func dashboardRoute(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	route, ok := apiRoute(r)
+	return ok && dashboardRoutes[route]
+}
+
+// apiRoute returns the path template of the matched route of r relative to the API
+// prefix, e.g. /runs/{id}/report
+func apiRoute(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	for _, prefix := range []string{"/api/" + APIVersion, "/api"} {
+		if trimmed := strings.TrimPrefix(template, prefix); trimmed != template {
+			return trimmed, true
+		}
+	}
+	return "", false
+}
+
+// Middleware for HA followers. Only the leader serves the API; a follower answers the
+// health and HA status endpoints and points every other request at the leader.
+func haMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.HA.IsLeader() || strings.HasSuffix(r.URL.Path, "/health") || strings.HasSuffix(r.URL.Path, "/ha/status") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		message := "This manager instance is a follower and no leader is known yet"
+		if leader := handlers.HA.Status().Leader; leader != nil {
+			message = fmt.Sprintf("This manager instance is a follower, send requests to the leader %s", leader.Holder)
+			if leader.URL != "" {
+				w.Header().Set(HALeaderHeader, leader.URL)
+				message += " at " + leader.URL
+			}
+		}
+		w.Header().Set("Retry-After", "5")
+		handlers.SendJSONResponse(w, http.StatusServiceUnavailable, handlers.APIResponse{
+			Success: false,
+			Message: message,
+		})
+	})
+}
+
+// IdempotencyKeyHeader lets clients retry a mutating request without applying it twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader marks a response replayed from the first attempt of a key
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// idempotencyKeyPattern limits keys to something safe to store and log
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware for Idempotency-Key. The first POST, PUT, PATCH or DELETE with a key is
+// run and its response stored; a repeat of the same key, caller, method and path within
+// idempotency.ttl_minutes gets the stored response back with Idempotent-Replayed: true.
+// A repeat while the first attempt is still running gets 409, one with a different body
+// 422. Responses with a 5xx status are not stored, so those requests can be retried.
+func idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		config := handlers.Idempotency.Config()
+		if !config.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !idempotencyKeyPattern.MatchString(key) {
+			handlers.SendJSONResponse(w, http.StatusBadRequest, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s must be 1 to 128 letters, digits, '.', '_', ':' or '-'", IdempotencyKeyHeader),
+			})
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			handlers.SendJSONResponse(w, http.StatusBadRequest, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to read request body: %v", err),
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.URL.RawQuery))
+		hash.Write([]byte{0})
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		caller := ""
+		if identity := auth.FromContext(r.Context()); identity != nil {
+			caller = identity.Name
+		}
+		// The legacy and versioned prefixes address the same endpoint
+		path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/"+APIVersion), "/api")
+		storeKey := strings.Join([]string{caller, r.Method, path, key}, "\x00")
+
+		stored, inFlight, mismatch := handlers.Idempotency.Begin(storeKey, fingerprint)
+		switch {
+		case mismatch:
+			handlers.SendJSONResponse(w, http.StatusUnprocessableEntity, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%s %s was already used with a different request body or query", IdempotencyKeyHeader, key),
+			})
+			return
+		case inFlight:
+			w.Header().Set("Retry-After", "1")
+			handlers.SendJSONResponse(w, http.StatusConflict, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("A request with %s %s is still being processed", IdempotencyKeyHeader, key),
+			})
+			return
+		case stored != nil:
+			for name, values := range stored.Header {
+				if name == logger.RequestIDHeader {
+					continue
+				}
+				w.Header()[name] = values
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, limit: config.MaxBodyKB * 1024}
+		defer func() {
+			// Runs during a panic too, so the key is released for a retry
+			if recovered := recover(); recovered != nil {
+				handlers.Idempotency.Abandon(storeKey)
+				panic(recovered)
+			}
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if recorder.streamed || recorder.overflow || status >= http.StatusInternalServerError {
+				handlers.Idempotency.Abandon(storeKey)
+				return
+			}
+			handlers.Idempotency.Finish(storeKey, handlers.IdempotentResponse{
+				Status: status,
+				Header: w.Header().Clone(),
+				Body:   recorder.body.Bytes(),
+			})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// recordingResponseWriter keeps a copy of the response for idempotent replay. A
+// response that is streamed, hijacked or larger than limit is passed through unrecorded.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+	streamed bool
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	if !rw.overflow {
+		if rw.body.Len()+len(data) > rw.limit {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(data)
+		}
+	}
+	return rw.ResponseWriter.Write(data)
+}
+
+func (rw *recordingResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.streamed = true
+		flusher.Flush()
+	}
+}
+
+func (rw *recordingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	rw.streamed = true
+	return hijacker.Hijack()
+}
+
+func (rw *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Middleware for troubleshooting mode. While a window opened with PUT
+// /api/troubleshooting is active, requests to its routes are logged with their request
+// and response bodies, sensitive fields redacted. Streamed and hijacked responses are
+// logged without a body.
+func troubleshootingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := apiRoute(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		matched, limit := handlers.Troubleshooting.Matches(route)
+		if !matched {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var requestBody []byte
+		requestTruncated := false
+		if r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+			if err != nil {
+				handlers.SendJSONResponse(w, http.StatusBadRequest, handlers.APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Failed to read request body: %v", err),
+				})
+				return
+			}
+			// Hand the handler the whole body, including what was not read for the log
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			requestBody = body
+			if len(body) > limit {
+				requestTruncated = true
+			}
+		}
+
+		start := time.Now()
+		recorder := &recordingResponseWriter{ResponseWriter: w, limit: limit}
+		next.ServeHTTP(recorder, r)
+		exchange := handlers.TroubleshootingExchange{
+			Route:               route,
+			RequestBody:         requestBody,
+			RequestTruncated:    requestTruncated,
+			Status:              recorder.status,
+			ResponseBody:        recorder.body.Bytes(),
+			ResponseTruncated:   recorder.overflow,
+			ResponseContentType: w.Header().Get("Content-Type"),
+			Duration:            time.Since(start),
+		}
+		if exchange.Status == 0 {
+			exchange.Status = http.StatusOK
+		}
+		if recorder.streamed {
+			exchange.ResponseBody = nil
+		}
+		handlers.Troubleshooting.LogExchange(r, exchange)
+	})
+}
+
+// readCloser reads from a replacement reader and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// requireRole restricts a handler to callers with at least the given role
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity := auth.FromContext(r.Context())
+		if identity == nil || !auth.RoleAllows(identity.Role, role) {
+			handlers.SendJSONResponse(w, http.StatusForbidden, handlers.APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("This endpoint requires the %s role", role),
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
 // Middleware for CORS
 func corsMiddleware(next http.Handler) http.Handler {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // Configure appropriately for production
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{APIVersionHeader, HALeaderHeader, logger.RequestIDHeader, IdempotentReplayedHeader, "Deprecation", "Sunset", "Link", "Warning", "WWW-Authenticate"},
 		AllowCredentials: true,
 	})
 
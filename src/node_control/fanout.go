@@ -0,0 +1,30 @@
+package node_control
+
+import "sync"
+
+// FanOut calls fn for every node in parallel, at most ssh.max_connections at a time, and
+// returns when all calls have returned. Cluster-wide operations use it instead of
+// visiting the nodes one after the other; the connection pool bounds what the calls
+// open, so the width only has to keep a large fleet from queueing on the pool.
+func FanOut(nodes []string, fn func(node string)) {
+	width := SSH.Config().MaxConnections
+	if width > len(nodes) {
+		width = len(nodes)
+	}
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < width; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range work {
+				fn(node)
+			}
+		}()
+	}
+	for _, node := range nodes {
+		work <- node
+	}
+	close(work)
+	wg.Wait()
+}
@@ -1,6 +1,13 @@
 package node_control
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultMetricsPort is the port node_metrics_api listens on when metrics_port is unset
+const DefaultMetricsPort = 8086
 
 type ClusterSettings struct {
 	BackupRetentionDays int    `yaml:"backup_retention_days"`
@@ -8,6 +15,13 @@ type ClusterSettings struct {
 	ConnectionTimeout   int    `yaml:"connection_timeout"`
 	MaxRetries          int    `yaml:"max_retries"`
 	SyncTimeout         int    `yaml:"sync_timeout"`
+	// Global budget for SSH/SCP distribution, shared by all concurrent jobs
+	MaxConcurrentTransfers int `yaml:"max_concurrent_transfers"`
+	TransferBandwidthKbps  int `yaml:"transfer_bandwidth_kbps"` // 0 = unlimited
+	// How StopBinary stops a simulator: "graceful" sends SIGTERM and waits up to
+	// GracefulShutdownTimeout seconds before SIGKILL, "force" sends SIGKILL right away
+	StopMode                string `yaml:"stop_mode,omitempty"`
+	GracefulShutdownTimeout int    `yaml:"graceful_shutdown_timeout,omitempty"`
 }
 
 type NodeConfig struct {
@@ -19,6 +33,54 @@ type NodeConfig struct {
 	MetricsPort int    `yaml:"metrics_port"`
 	Description string `yaml:"description"`
 	Enabled     bool   `yaml:"enabled"`
+	// ExporterURL points at an existing Prometheus node_exporter on the node
+	ExporterURL  string `yaml:"exporter_url,omitempty"`
+	ExporterMode string `yaml:"exporter_mode,omitempty"`
+	// Generators lists the load generators from config.yaml besides finalvudatasim
+	Generators []string `yaml:"generators,omitempty"`
+	// Reserved is held for a workload colocated on the host, e.g. a Kafka broker
+	Reserved *Reservation `yaml:"reserved,omitempty"`
+}
+
+// Reservation is the share of a node's CPU and memory kept for another workload on the
+// host; only the rest is allocatable to the simulator
+type Reservation struct {
+	CPUCores float64 `yaml:"cpu_cores,omitempty" json:"cpuCores,omitempty"`
+	MemoryGB float64 `yaml:"memory_gb,omitempty" json:"memoryGb,omitempty"`
+	Reason   string  `yaml:"reason,omitempty" json:"reason,omitempty"` // e.g. "Kafka broker"
+}
+
+// Allocatable returns the cores and memory in GB left to the simulator out of the
+// node's totals once its reservation is taken off, never below zero
+func (n NodeConfig) Allocatable(totalCores, totalMemoryGB float64) (float64, float64) {
+	if n.Reserved == nil {
+		return totalCores, totalMemoryGB
+	}
+	return math.Max(totalCores-n.Reserved.CPUCores, 0), math.Max(totalMemoryGB-n.Reserved.MemoryGB, 0)
+}
+
+// How exporter metrics combine with metrics pushed by the node
+const (
+	ExporterModeMerge   = "merge"   // exporter fills host metrics, pushed load metrics are kept
+	ExporterModeReplace = "replace" // exporter is the only source of host metrics
+)
+
+// ExporterReplaces reports whether the exporter is the node's only host metrics source
+func (n NodeConfig) ExporterReplaces() bool {
+	return n.ExporterURL != "" && n.ExporterMode == ExporterModeReplace
+}
+
+// AgentPort returns the node_metrics_api port for the node
+func (n NodeConfig) AgentPort() int {
+	if n.MetricsPort > 0 {
+		return n.MetricsPort
+	}
+	return DefaultMetricsPort
+}
+
+// AgentURL builds a URL for the given path on the node's node_metrics_api
+func (n NodeConfig) AgentURL(path string) string {
+	return fmt.Sprintf("http://%s:%d%s", n.Host, n.AgentPort(), path)
 }
 
 // NodesConfig represents the entire nodes configuration
@@ -76,5 +138,12 @@ type NodeMetrics struct {
 	TotalCPU    float64   `json:"totalCpu"`    // Total CPU cores available
 	TotalMemory float64   `json:"totalMemory"` // Total memory in GB available
 	LastUpdate  time.Time `json:"lastUpdate"`
+	AgeSeconds  *float64  `json:"ageSeconds,omitempty"` // nil if the node never reported
+	Stale       bool      `json:"stale"`
+	Source      string    `json:"source,omitempty"` // "exporter" when host metrics come from node_exporter
+	// GeneratorEPS is the EPS of the node's other load generators, polled from their eps_url
+	GeneratorEPS map[string]int `json:"generatorEps,omitempty"`
+	// The share of TotalCPU and TotalMemory left to the simulator on nodes with a reservation
+	AllocatableCPU    float64 `json:"allocatableCpu,omitempty"`
+	AllocatableMemory float64 `json:"allocatableMemory,omitempty"`
 }
-
@@ -3,6 +3,8 @@ package node_control
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
 	"vuDataSim/src/logger"
 
 	"gopkg.in/yaml.v3"
@@ -86,11 +88,14 @@ func NewNodeManager() *NodeManager {
 		logsDir:         "src/node_control/logs",
 		nodesConfig: NodesConfig{
 			ClusterSettings: ClusterSettings{
-				BackupRetentionDays: 30,
-				ConflictResolution:  "manual",
-				ConnectionTimeout:   10,
-				MaxRetries:          3,
-				SyncTimeout:         60,
+				BackupRetentionDays:     30,
+				ConflictResolution:      "manual",
+				ConnectionTimeout:       10,
+				MaxRetries:              3,
+				SyncTimeout:             60,
+				MaxConcurrentTransfers:  4,
+				StopMode:                "graceful",
+				GracefulShutdownTimeout: 10,
 			},
 			Nodes: make(map[string]NodeConfig),
 		},
@@ -117,6 +122,57 @@ func (nm *NodeManager) LoadNodesConfig() error {
 	return nil
 }
 
+// NodesReload lists how nodes.yaml on disk differed from the nodes in memory
+type NodesReload struct {
+	Added                  []string `json:"added,omitempty"`
+	Removed                []string `json:"removed,omitempty"`
+	Changed                []string `json:"changed,omitempty"`
+	ClusterSettingsChanged bool     `json:"clusterSettingsChanged,omitempty"`
+}
+
+// HasChanges reports whether the reload changed anything
+func (r *NodesReload) HasChanges() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Changed) > 0 || r.ClusterSettingsChanged
+}
+
+// ReloadNodesConfig re-reads nodes.yaml and replaces the nodes in memory, so nodes
+// removed from the file are dropped too. On error the current nodes are kept.
+func (nm *NodeManager) ReloadNodesConfig() (*NodesReload, error) {
+	data, err := os.ReadFile(nm.nodesConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nodes config file: %v", err)
+	}
+	fresh := NewNodeManager().nodesConfig
+	if err := yaml.Unmarshal(data, &fresh); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes config file: %v", err)
+	}
+	if fresh.Nodes == nil {
+		fresh.Nodes = make(map[string]NodeConfig)
+	}
+
+	result := &NodesReload{ClusterSettingsChanged: !reflect.DeepEqual(nm.nodesConfig.ClusterSettings, fresh.ClusterSettings)}
+	for name, node := range fresh.Nodes {
+		previous, ok := nm.nodesConfig.Nodes[name]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, name)
+		case !reflect.DeepEqual(previous, node):
+			result.Changed = append(result.Changed, name)
+		}
+	}
+	for name := range nm.nodesConfig.Nodes {
+		if _, ok := fresh.Nodes[name]; !ok {
+			result.Removed = append(result.Removed, name)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+
+	nm.nodesConfig = fresh
+	return result, nil
+}
+
 // SaveNodesConfig saves the nodes configuration to YAML file
 func (nm *NodeManager) SaveNodesConfig() error {
 	data, err := yaml.Marshal(nm.nodesConfig)
@@ -204,6 +260,32 @@ func (nm *NodeManager) AddNode(req AddNodeRequest) error {
 	return nil
 }
 
+// RegisterNode adds a node that already fetched its binaries and conf.d itself,
+// e.g. through the bootstrap script, so nothing is copied over SSH
+func (nm *NodeManager) RegisterNode(req AddNodeRequest) error {
+	if _, exists := nm.nodesConfig.Nodes[req.Name]; exists {
+		return fmt.Errorf("node %s already exists", req.Name)
+	}
+
+	nm.nodesConfig.Nodes[req.Name] = NodeConfig{
+		Host:        req.Host,
+		User:        req.User,
+		KeyPath:     req.KeyPath,
+		ConfDir:     req.ConfDir,
+		BinaryDir:   req.BinaryDir,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+	}
+
+	if err := nm.SaveNodesConfig(); err != nil {
+		delete(nm.nodesConfig.Nodes, req.Name)
+		return fmt.Errorf("failed to save nodes config: %v", err)
+	}
+
+	logger.LogSuccess(req.Name, "node_control", "Node registered successfully")
+	return nil
+}
+
 // RemoveNode removes a node from configuration and cleans up files
 func (nm *NodeManager) RemoveNode(name string) error {
 	_, exists := nm.nodesConfig.Nodes[name]
@@ -299,6 +381,30 @@ func (nm *NodeManager) DisableNode(name string) error {
 	return nil
 }
 
+// SetReservation records the CPU and memory reserved on a node for a colocated
+// workload; nil or an empty reservation removes it
+func (nm *NodeManager) SetReservation(name string, reservation *Reservation) error {
+	nodeConfig, exists := nm.nodesConfig.Nodes[name]
+	if !exists {
+		return fmt.Errorf(ErrNodeNotFound, name)
+	}
+	if reservation != nil {
+		if reservation.CPUCores < 0 || reservation.MemoryGB < 0 {
+			return fmt.Errorf("reserved cpu_cores and memory_gb must not be negative")
+		}
+		if reservation.CPUCores == 0 && reservation.MemoryGB == 0 {
+			reservation = nil
+		}
+	}
+
+	nodeConfig.Reserved = reservation
+	nm.nodesConfig.Nodes[name] = nodeConfig
+	if err := nm.SaveNodesConfig(); err != nil {
+		return fmt.Errorf(ErrSaveConfig, err)
+	}
+	return nil
+}
+
 // GetNodes returns all nodes
 func (nm *NodeManager) GetNodes() map[string]NodeConfig {
 	return nm.nodesConfig.Nodes
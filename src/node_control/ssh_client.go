@@ -0,0 +1,1009 @@
+package node_control
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/selfstats"
+	"vuDataSim/src/sshlimit"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/yaml.v3"
+)
+
+// Host key policies of the ssh section of config.yaml
+const (
+	HostKeyInsecure  = "insecure"   // accept any key, like StrictHostKeyChecking=no
+	HostKeyAcceptNew = "accept-new" // record the key of a node seen for the first time, reject a changed key
+	HostKeyStrict    = "strict"     // only accept keys already in the known hosts file
+)
+
+// Stages of an SSH operation, reported in SSHError.Op
+const (
+	SSHOpKey      = "key"      // reading the private key
+	SSHOpConnect  = "connect"  // TCP connection and handshake
+	SSHOpHostKey  = "host_key" // the node's host key was rejected
+	SSHOpAuth     = "auth"     // the node refused the key
+	SSHOpSession  = "session"  // opening or running the session
+	SSHOpCommand  = "command"  // the remote command exited non-zero
+	SSHOpTimeout  = "timeout"  // the remote command ran past command_timeout_seconds
+	SSHOpCopy     = "copy"     // reading the local files or writing the remote ones of a copy
+	SSHOpPool     = "pool"     // no connection of the pool became free in time
+	sshExitFailed = 255        // what the ssh binary exits with when the connection fails
+)
+
+// SSHConfig holds the ssh section of config.yaml
+type SSHConfig struct {
+	HostKeyChecking          string `yaml:"host_key_checking" json:"hostKeyChecking"`
+	KnownHostsFile           string `yaml:"known_hosts_file" json:"knownHostsFile"`
+	ConnectTimeoutSeconds    int    `yaml:"connect_timeout_seconds" json:"connectTimeoutSeconds"`
+	CommandTimeoutSeconds    int    `yaml:"command_timeout_seconds" json:"commandTimeoutSeconds"` // 0 lets commands run as long as they take
+	IdleTimeoutSeconds       int    `yaml:"idle_timeout_seconds" json:"idleTimeoutSeconds"`
+	KeepaliveSeconds         int    `yaml:"keepalive_seconds" json:"keepaliveSeconds"`
+	MaxSessionsPerConnection int    `yaml:"max_sessions_per_connection" json:"maxSessionsPerConnection"`
+	MaxConnections           int    `yaml:"max_connections" json:"maxConnections"`    // open at once across all nodes, also the width of cluster-wide fan-outs
+	PoolWaitSeconds          int    `yaml:"pool_wait_seconds" json:"poolWaitSeconds"` // how long a dial waits for a connection to close at max_connections
+}
+
+func defaultSSHConfig() SSHConfig {
+	return SSHConfig{
+		HostKeyChecking:          HostKeyAcceptNew,
+		KnownHostsFile:           "data/known_hosts",
+		ConnectTimeoutSeconds:    10,
+		CommandTimeoutSeconds:    600,
+		IdleTimeoutSeconds:       300,
+		KeepaliveSeconds:         30,
+		MaxSessionsPerConnection: 8,
+		MaxConnections:           32,
+		PoolWaitSeconds:          60,
+	}
+}
+
+// SSHTarget is the node an SSH operation runs against
+type SSHTarget struct {
+	Host    string // host name or address, with an optional :port
+	User    string
+	KeyPath string
+}
+
+// SSHTarget returns where SSH operations on the node connect to
+func (nc NodeConfig) SSHTarget() SSHTarget {
+	return SSHTarget{Host: nc.Host, User: nc.User, KeyPath: nc.KeyPath}
+}
+
+func (t SSHTarget) String() string {
+	return t.User + "@" + t.Host
+}
+
+// address is host:port, with port 22 unless the host names one
+func (t SSHTarget) address() string {
+	if _, _, err := net.SplitHostPort(t.Host); err == nil {
+		return t.Host
+	}
+	return net.JoinHostPort(t.Host, "22")
+}
+
+// poolKey identifies the connections an operation can share
+func (t SSHTarget) poolKey() string {
+	return t.User + "@" + t.address() + " " + t.KeyPath
+}
+
+// SSHError is a failed SSH operation: which node, at what stage, and the remote
+// command's exit status and stderr when it ran
+type SSHError struct {
+	Node       string `json:"node"`
+	Op         string `json:"op"`
+	ExitStatus int    `json:"exitStatus"` // of the remote command, -1 when it did not finish
+	Stderr     string `json:"stderr,omitempty"`
+	Err        error  `json:"-"`
+}
+
+func (e *SSHError) Error() string {
+	message := fmt.Sprintf("ssh %s: %s: %v", e.Node, e.Op, e.Err)
+	if e.Stderr != "" {
+		message += ": " + e.Stderr
+	}
+	return message
+}
+
+func (e *SSHError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode is what the ssh binary would have exited with: the remote command's exit
+// status, or 255 when the connection failed
+func (e *SSHError) ExitCode() int {
+	if e.ExitStatus >= 0 {
+		return e.ExitStatus
+	}
+	return sshExitFailed
+}
+
+// SSHResult is the output of a remote command
+type SSHResult struct {
+	Stdout string
+	Stderr string
+}
+
+// SSHHostStats are the pooled connections to one node and how often they were reused
+type SSHHostStats struct {
+	Node        string     `json:"node"`
+	Connections int        `json:"connections"`
+	Sessions    int        `json:"sessions"` // open now
+	Dials       int64      `json:"dials"`
+	Reused      int64      `json:"reused"` // sessions opened on an already open connection
+	Failures    int64      `json:"failures"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// SSHPoolStats are the connections open across all nodes against max_connections
+type SSHPoolStats struct {
+	MaxConnections int   `json:"maxConnections"`
+	Open           int   `json:"open"` // including dials in progress
+	Waiting        int   `json:"waiting"`
+	Waited         int64 `json:"waited"`   // dials that had to wait for a connection to close
+	TimedOut       int64 `json:"timedOut"` // of those, the ones that gave up after pool_wait_seconds
+	Evicted        int64 `json:"evicted"`  // idle connections closed early to make room for another node
+}
+
+type sshConn struct {
+	client   *ssh.Client
+	key      string
+	sessions int
+	lastUsed time.Time
+	retired  bool // closed once its last session ends
+}
+
+// sshDial is a connection being opened, which other operations on the node wait for
+// rather than dialing alongside
+type sshDial struct {
+	done chan struct{}
+	err  error
+}
+
+type cachedSigner struct {
+	signer  ssh.Signer
+	modTime time.Time
+}
+
+// SSHManager runs commands and copies files on the nodes over pooled SSH connections.
+// Operations on a node share one connection, up to max_sessions_per_connection open
+// sessions, and every session still waits for an ssh_limits slot first. At most
+// max_connections are open across all nodes: beyond that the least recently used idle
+// connection is closed, or the dial waits for one to close. Idle connections are kept
+// alive with keepalives and closed after idle_timeout_seconds.
+type SSHManager struct {
+	mutex     sync.Mutex
+	config    SSHConfig
+	conns     map[string][]*sshConn
+	dialing   map[string]*sshDial
+	signers   map[string]cachedSigner
+	stats     map[string]*SSHHostStats
+	pool      SSHPoolStats
+	freed     chan struct{} // closed and replaced whenever a connection closes
+	knownHost sync.Mutex    // serializes appends to the known hosts file
+	janitor   sync.Once
+}
+
+// NewSSHManager creates a connection manager with default settings
+func NewSSHManager() *SSHManager {
+	return &SSHManager{
+		config:  defaultSSHConfig(),
+		conns:   make(map[string][]*sshConn),
+		dialing: make(map[string]*sshDial),
+		signers: make(map[string]cachedSigner),
+		stats:   make(map[string]*SSHHostStats),
+		freed:   make(chan struct{}),
+	}
+}
+
+// SSH is the process-wide connection manager used for every ssh and copy to a node
+var SSH = NewSSHManager()
+
+// LoadConfig reads the ssh section from the application config file. When the settings
+// changed, pooled connections are replaced as their sessions end, so a new host key
+// policy applies to the next operation.
+func (m *SSHManager) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	config := m.Config()
+	wrapper := struct {
+		SSH *SSHConfig `yaml:"ssh"`
+	}{SSH: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	switch config.HostKeyChecking {
+	case HostKeyInsecure, HostKeyAcceptNew, HostKeyStrict:
+	default:
+		return fmt.Errorf("ssh.host_key_checking must be %s, %s or %s", HostKeyStrict, HostKeyAcceptNew, HostKeyInsecure)
+	}
+	if config.HostKeyChecking != HostKeyInsecure && config.KnownHostsFile == "" {
+		return fmt.Errorf("ssh.known_hosts_file is required with host_key_checking %s", config.HostKeyChecking)
+	}
+	if config.ConnectTimeoutSeconds <= 0 {
+		return fmt.Errorf("ssh.connect_timeout_seconds must be positive")
+	}
+	if config.MaxSessionsPerConnection <= 0 {
+		return fmt.Errorf("ssh.max_sessions_per_connection must be positive")
+	}
+	if config.MaxConnections <= 0 {
+		return fmt.Errorf("ssh.max_connections must be positive")
+	}
+	if config.PoolWaitSeconds <= 0 {
+		config.PoolWaitSeconds = defaultSSHConfig().PoolWaitSeconds
+	}
+	if config.CommandTimeoutSeconds < 0 {
+		config.CommandTimeoutSeconds = 0
+	}
+	if config.IdleTimeoutSeconds <= 0 {
+		config.IdleTimeoutSeconds = defaultSSHConfig().IdleTimeoutSeconds
+	}
+	if config.KeepaliveSeconds <= 0 {
+		config.KeepaliveSeconds = defaultSSHConfig().KeepaliveSeconds
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if config == m.config {
+		return nil
+	}
+	m.config = config
+	for key, conns := range m.conns {
+		for _, conn := range conns {
+			m.retireLocked(conn)
+		}
+		delete(m.conns, key)
+	}
+	return nil
+}
+
+// Config returns the ssh settings
+func (m *SSHManager) Config() SSHConfig {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.config
+}
+
+// Status returns the connection pool of every node that was connected to, by node
+func (m *SSHManager) Status() []SSHHostStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	status := make([]SSHHostStats, 0, len(m.stats))
+	for key, stats := range m.stats {
+		current := *stats
+		for _, conn := range m.conns[key] {
+			current.Connections++
+			current.Sessions += conn.sessions
+		}
+		status = append(status, current)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Node < status[j].Node })
+	return status
+}
+
+// PoolStatus returns the connections open across all nodes
+func (m *SSHManager) PoolStatus() SSHPoolStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := m.pool
+	stats.MaxConnections = m.config.MaxConnections
+	return stats
+}
+
+// Exec runs a command on the node and returns its stdout and stderr. A non-zero exit is
+// an *SSHError with the command's exit status and stderr.
+func (m *SSHManager) Exec(target SSHTarget, command string) (*SSHResult, error) {
+	var stdout, stderr bytes.Buffer
+	err := m.run(target, command, nil, &stdout, &stderr, m.commandTimeout())
+	selfstats.RecordSSH(err)
+	return &SSHResult{Stdout: stdout.String(), Stderr: stderr.String()}, err
+}
+
+// Run runs a command on the node, discarding its output
+func (m *SSHManager) Run(target SSHTarget, command string) error {
+	_, err := m.Exec(target, command)
+	return err
+}
+
+// Output runs a command on the node and returns its stdout
+func (m *SSHManager) Output(target SSHTarget, command string) (string, error) {
+	result, err := m.Exec(target, command)
+	return result.Stdout, err
+}
+
+// CombinedOutput runs a command on the node and returns its stdout and stderr interleaved
+func (m *SSHManager) CombinedOutput(target SSHTarget, command string) (string, error) {
+	var output syncBuffer
+	err := m.run(target, command, nil, &output, &output, m.commandTimeout())
+	selfstats.RecordSSH(err)
+	return output.String(), err
+}
+
+// CopyFile copies a local file to remotePath on the node over SFTP, limited to limitKbps
+// Kbit/s when non-zero. Like scp, a remotePath that is a directory receives the file
+// under its own name. The file is written beside the target and renamed over it, so a
+// running binary can be replaced.
+func (m *SSHManager) CopyFile(target SSHTarget, localPath, remotePath string, limitKbps int) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return &SSHError{Node: target.String(), Op: SSHOpCopy, ExitStatus: -1, Err: err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return &SSHError{Node: target.String(), Op: SSHOpCopy, ExitStatus: -1, Err: err}
+	}
+	if info.IsDir() {
+		return &SSHError{Node: target.String(), Op: SSHOpCopy, ExitStatus: -1, Err: fmt.Errorf("%s is a directory", localPath)}
+	}
+	logger.Debugf(logger.ModuleSSH, "Copying %s (%d bytes) to %s:%s", localPath, info.Size(), target, remotePath)
+
+	err = m.sftp(target, func(client *sftp.Client) error {
+		if remote, err := client.Stat(remotePath); err == nil && remote.IsDir() {
+			remotePath = path.Join(remotePath, filepath.Base(localPath))
+		}
+		return putFile(client, throttle(file, limitKbps), remotePath, info.Mode().Perm())
+	})
+	selfstats.Record(selfstats.CategorySSH, err)
+	return err
+}
+
+// CopyDir copies a local directory to remoteDir on the node over SFTP, limited to
+// limitKbps Kbit/s when non-zero. Like scp -r, an existing remoteDir receives the
+// directory under its own name, otherwise remoteDir is created with its contents.
+func (m *SSHManager) CopyDir(target SSHTarget, localDir, remoteDir string, limitKbps int) error {
+	info, err := os.Stat(localDir)
+	if err != nil {
+		return &SSHError{Node: target.String(), Op: SSHOpCopy, ExitStatus: -1, Err: err}
+	}
+	if !info.IsDir() {
+		return &SSHError{Node: target.String(), Op: SSHOpCopy, ExitStatus: -1, Err: fmt.Errorf("%s is not a directory", localDir)}
+	}
+	logger.Debugf(logger.ModuleSSH, "Copying directory %s to %s:%s", localDir, target, remoteDir)
+
+	err = m.sftp(target, func(client *sftp.Client) error {
+		if remote, err := client.Stat(remoteDir); err == nil && remote.IsDir() {
+			remoteDir = path.Join(remoteDir, filepath.Base(filepath.Clean(localDir)))
+		}
+		return filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(localDir, localPath)
+			if err != nil {
+				return err
+			}
+			remotePath := path.Join(remoteDir, filepath.ToSlash(name))
+			switch {
+			case info.IsDir():
+				if err := client.MkdirAll(remotePath); err != nil {
+					return fmt.Errorf("mkdir %s: %w", remotePath, err)
+				}
+				return client.Chmod(remotePath, info.Mode().Perm())
+			case info.Mode()&os.ModeSymlink != 0:
+				link, err := os.Readlink(localPath)
+				if err != nil {
+					return err
+				}
+				client.Remove(remotePath)
+				return client.Symlink(link, remotePath)
+			case info.Mode().IsRegular():
+				file, err := os.Open(localPath)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				return putFile(client, throttle(file, limitKbps), remotePath, info.Mode().Perm())
+			}
+			return nil
+		})
+	})
+	selfstats.Record(selfstats.CategorySSH, err)
+	return err
+}
+
+// putFile writes r to remotePath through a temporary file beside it, which is renamed
+// over remotePath once complete
+func putFile(client *sftp.Client, r io.Reader, remotePath string, perm os.FileMode) error {
+	tmp := fmt.Sprintf("%s.tmp.%d", remotePath, time.Now().UnixNano())
+	remote, err := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", tmp, err)
+	}
+	_, err = io.Copy(remote, r)
+	if closeErr := remote.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = client.PosixRename(tmp, remotePath)
+	}
+	if err != nil {
+		client.Remove(tmp)
+		return fmt.Errorf("write %s: %w", remotePath, err)
+	}
+	return nil
+}
+
+// sftp waits for an ssh_limits slot and runs fn with an SFTP client on a session of a
+// pooled connection, like run does for commands. Errors of fn are copy errors.
+func (m *SSHManager) sftp(target SSHTarget, fn func(client *sftp.Client) error) error {
+	release, err := sshlimit.Acquire(target.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	conn, session, err := m.session(target)
+	if err != nil {
+		return err
+	}
+	broken := false
+	defer func() { m.release(conn, broken) }()
+	defer session.Close()
+
+	fail := func(op string, err error) error {
+		return &SSHError{Node: target.String(), Op: op, ExitStatus: -1, Err: err}
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fail(SSHOpSession, err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fail(SSHOpSession, err)
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		broken = true
+		return fail(SSHOpSession, fmt.Errorf("sftp subsystem: %w", err))
+	}
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		broken = true
+		return fail(SSHOpSession, fmt.Errorf("sftp: %w", err))
+	}
+	defer client.Close()
+
+	if err := fn(client); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, sftp.ErrSSHFxConnectionLost) {
+			broken = true // the connection dropped during the copy
+			return fail(SSHOpSession, err)
+		}
+		return fail(SSHOpCopy, err)
+	}
+	return nil
+}
+
+func (m *SSHManager) commandTimeout() time.Duration {
+	return time.Duration(m.Config().CommandTimeoutSeconds) * time.Second
+}
+
+// run waits for an ssh_limits slot, opens a session on a pooled connection and runs the
+// command, killing it after timeout when non-zero
+func (m *SSHManager) run(target SSHTarget, command string, stdin io.Reader, stdout, stderr io.Writer, timeout time.Duration) error {
+	release, err := sshlimit.Acquire(target.Host)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	conn, session, err := m.session(target)
+	if err != nil {
+		return err
+	}
+	broken := false
+	defer func() { m.release(conn, broken) }()
+	defer session.Close()
+
+	captured, _ := stderr.(fmt.Stringer)
+	fail := func(op string, exitStatus int, err error) error {
+		sshErr := &SSHError{Node: target.String(), Op: op, ExitStatus: exitStatus, Err: err}
+		if captured != nil {
+			sshErr.Stderr = strings.TrimSpace(captured.String())
+		}
+		return sshErr
+	}
+
+	session.Stdin, session.Stdout, session.Stderr = stdin, stdout, stderr
+	if err := session.Start(command); err != nil {
+		broken = true
+		return fail(SSHOpSession, -1, err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-expired:
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		<-done
+		return fail(SSHOpTimeout, -1, fmt.Errorf("command did not finish within %s", timeout))
+	}
+
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr):
+		return fail(SSHOpCommand, exitErr.ExitStatus(), fmt.Errorf("exited with status %d", exitErr.ExitStatus()))
+	case errors.As(err, &missingErr):
+		broken = true // the connection dropped while the command ran
+		return fail(SSHOpSession, -1, err)
+	default:
+		return fail(SSHOpSession, -1, err)
+	}
+}
+
+// session opens a session to the node. A pooled connection that fails to open one is
+// retired and the session is retried once on a new connection.
+func (m *SSHManager) session(target SSHTarget) (*sshConn, *ssh.Session, error) {
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := m.connect(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		session, err := conn.client.NewSession()
+		if err == nil {
+			return conn, session, nil
+		}
+		m.release(conn, true)
+		if !reused || attempt > 0 {
+			m.recordFailure(target, err)
+			return nil, nil, &SSHError{Node: target.String(), Op: SSHOpSession, ExitStatus: -1, Err: err}
+		}
+		logger.Debugf(logger.ModuleSSH, "Pooled connection to %s failed to open a session, reconnecting: %v", target, err)
+	}
+}
+
+// connect returns a pooled connection with a free session, dialing one if there is none.
+// Only one dial per node runs at a time; operations arriving meanwhile share its outcome.
+func (m *SSHManager) connect(target SSHTarget) (*sshConn, bool, error) {
+	key := target.poolKey()
+	var waitUntil time.Time
+	for {
+		m.mutex.Lock()
+		config := m.config
+		for _, conn := range m.conns[key] {
+			if conn.sessions < config.MaxSessionsPerConnection {
+				conn.sessions++
+				conn.lastUsed = time.Now()
+				m.statsLocked(key, target).Reused++
+				m.mutex.Unlock()
+				return conn, true, nil
+			}
+		}
+		if pending, ok := m.dialing[key]; ok {
+			m.mutex.Unlock()
+			<-pending.done
+			if pending.err != nil {
+				return nil, false, pending.err
+			}
+			continue
+		}
+		if m.pool.Open >= config.MaxConnections && !m.evictIdleLocked() {
+			if waitUntil.IsZero() {
+				waitUntil = time.Now().Add(time.Duration(config.PoolWaitSeconds) * time.Second)
+				m.pool.Waited++
+			}
+			freed := m.freed
+			m.pool.Waiting++
+			m.mutex.Unlock()
+			timer := time.NewTimer(time.Until(waitUntil))
+			select {
+			case <-freed:
+				timer.Stop()
+				m.mutex.Lock()
+				m.pool.Waiting--
+				m.mutex.Unlock()
+				continue
+			case <-timer.C:
+			}
+			m.mutex.Lock()
+			m.pool.Waiting--
+			m.pool.TimedOut++
+			m.mutex.Unlock()
+			err := &SSHError{Node: target.String(), Op: SSHOpPool, ExitStatus: -1,
+				Err: fmt.Errorf("all %d connections stayed busy for %ds", config.MaxConnections, config.PoolWaitSeconds)}
+			m.recordFailure(target, err)
+			return nil, false, err
+		}
+		m.pool.Open++
+		pending := &sshDial{done: make(chan struct{})}
+		m.dialing[key] = pending
+		m.mutex.Unlock()
+
+		client, err := m.dial(target, config)
+
+		m.mutex.Lock()
+		delete(m.dialing, key)
+		pending.err = err
+		close(pending.done)
+		stats := m.statsLocked(key, target)
+		stats.Dials++
+		if err != nil {
+			m.pool.Open--
+			m.signalFreedLocked()
+			m.mutex.Unlock()
+			m.recordFailure(target, err)
+			return nil, false, err
+		}
+		conn := &sshConn{client: client, key: key, sessions: 1, lastUsed: time.Now()}
+		m.conns[key] = append(m.conns[key], conn)
+		m.mutex.Unlock()
+		m.janitor.Do(func() { go m.maintain() })
+		return conn, false, nil
+	}
+}
+
+// release ends a session on a connection, retiring the connection if it broke
+func (m *SSHManager) release(conn *sshConn, broken bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	conn.sessions--
+	conn.lastUsed = time.Now()
+	if broken {
+		m.retireLocked(conn)
+	}
+	if conn.retired && conn.sessions == 0 {
+		m.closeLocked(conn)
+	}
+}
+
+// retireLocked takes a connection out of the pool; it is closed once idle
+func (m *SSHManager) retireLocked(conn *sshConn) {
+	if conn.retired {
+		return
+	}
+	conn.retired = true
+	conns := m.conns[conn.key]
+	for i, pooled := range conns {
+		if pooled == conn {
+			m.conns[conn.key] = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(m.conns[conn.key]) == 0 {
+		delete(m.conns, conn.key)
+	}
+	if conn.sessions == 0 {
+		m.closeLocked(conn)
+	}
+}
+
+// closeLocked closes a retired connection without sessions and wakes the dials waiting
+// for room in the pool
+func (m *SSHManager) closeLocked(conn *sshConn) {
+	conn.client.Close()
+	m.pool.Open--
+	m.signalFreedLocked()
+}
+
+func (m *SSHManager) signalFreedLocked() {
+	close(m.freed)
+	m.freed = make(chan struct{})
+}
+
+// evictIdleLocked closes the least recently used connection without sessions, to make
+// room for a connection to another node, and reports whether there was one
+func (m *SSHManager) evictIdleLocked() bool {
+	var oldest *sshConn
+	for _, conns := range m.conns {
+		for _, conn := range conns {
+			if conn.sessions == 0 && (oldest == nil || conn.lastUsed.Before(oldest.lastUsed)) {
+				oldest = conn
+			}
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	m.pool.Evicted++
+	m.retireLocked(oldest)
+	return true
+}
+
+func (m *SSHManager) statsLocked(key string, target SSHTarget) *SSHHostStats {
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = &SSHHostStats{Node: target.String()}
+		m.stats[key] = stats
+	}
+	return stats
+}
+
+func (m *SSHManager) recordFailure(target SSHTarget, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := m.statsLocked(target.poolKey(), target)
+	now := time.Now()
+	stats.Failures++
+	stats.LastError = err.Error()
+	stats.LastErrorAt = &now
+}
+
+// maintain closes idle connections after idle_timeout_seconds and checks the others
+// with a keepalive every keepalive_seconds, so a dead connection is not reused
+func (m *SSHManager) maintain() {
+	for {
+		config := m.Config()
+		time.Sleep(time.Duration(config.KeepaliveSeconds) * time.Second)
+
+		idleTimeout := time.Duration(config.IdleTimeoutSeconds) * time.Second
+		var check []*sshConn
+		m.mutex.Lock()
+		for _, conns := range m.conns {
+			for _, conn := range conns {
+				switch {
+				case conn.sessions > 0:
+				case time.Since(conn.lastUsed) > idleTimeout:
+					m.retireLocked(conn)
+				default:
+					check = append(check, conn)
+				}
+			}
+		}
+		m.mutex.Unlock()
+
+		for _, conn := range check {
+			if err := keepalive(conn.client, time.Duration(config.ConnectTimeoutSeconds)*time.Second); err != nil {
+				logger.Debugf(logger.ModuleSSH, "Dropping pooled SSH connection to %s: %v", conn.client.RemoteAddr(), err)
+				m.mutex.Lock()
+				m.retireLocked(conn)
+				m.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// keepalive sends an OpenSSH keepalive request and waits up to timeout for the reply
+func keepalive(client *ssh.Client, timeout time.Duration) error {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+	select {
+	case err := <-replied:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no keepalive reply within %s", timeout)
+	}
+}
+
+// dial opens an authenticated connection to the node, verifying its host key
+func (m *SSHManager) dial(target SSHTarget, config SSHConfig) (*ssh.Client, error) {
+	fail := func(op string, err error) error {
+		return &SSHError{Node: target.String(), Op: op, ExitStatus: -1, Err: err}
+	}
+	signer, err := m.signer(target.KeyPath)
+	if err != nil {
+		return nil, fail(SSHOpKey, err)
+	}
+	hostKeyCallback, known, err := m.hostKeyCallback(config)
+	if err != nil {
+		return nil, fail(SSHOpHostKey, err)
+	}
+
+	address := target.address()
+	timeout := time.Duration(config.ConnectTimeoutSeconds) * time.Second
+	clientConfig := &ssh.ClientConfig{
+		User:              target.User,
+		Auth:              []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: knownHostKeyAlgorithms(known, address),
+		Timeout:           timeout,
+	}
+
+	netConn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, fail(SSHOpConnect, err)
+	}
+	// The handshake has the connect timeout too, so an unresponsive sshd does not hang
+	netConn.SetDeadline(time.Now().Add(timeout))
+	clientConn, channels, requests, err := ssh.NewClientConn(netConn, address, clientConfig)
+	if err != nil {
+		netConn.Close()
+		var keyErr *knownhosts.KeyError
+		var revokedErr *knownhosts.RevokedError
+		switch {
+		case errors.As(err, &keyErr) || errors.As(err, &revokedErr):
+			return nil, fail(SSHOpHostKey, err)
+		case strings.Contains(err.Error(), "unable to authenticate"):
+			return nil, fail(SSHOpAuth, err)
+		default:
+			return nil, fail(SSHOpConnect, err)
+		}
+	}
+	netConn.SetDeadline(time.Time{})
+	logger.Debugf(logger.ModuleSSH, "Opened SSH connection to %s", target)
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// signer returns the parsed private key, read again when the file changes
+func (m *SSHManager) signer(keyPath string) (ssh.Signer, error) {
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	cached, ok := m.signers[keyPath]
+	m.mutex.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.signer, nil
+	}
+
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var passphraseErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseErr) {
+		return nil, fmt.Errorf("%s is protected by a passphrase, which is not supported", keyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", keyPath, err)
+	}
+	m.mutex.Lock()
+	m.signers[keyPath] = cachedSigner{signer: signer, modTime: info.ModTime()}
+	m.mutex.Unlock()
+	return signer, nil
+}
+
+// hostKeyCallback verifies host keys against the known hosts file; with accept-new the
+// key of a node not in the file yet is appended to it. The plain lookup in the file is
+// returned as well, nil when keys are not checked.
+func (m *SSHManager) hostKeyCallback(config SSHConfig) (ssh.HostKeyCallback, ssh.HostKeyCallback, error) {
+	if config.HostKeyChecking == HostKeyInsecure {
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	}
+	path := config.KnownHostsFile
+	if config.HostKeyChecking == HostKeyAcceptNew {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, nil, err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return nil, nil, err
+		}
+		file.Close()
+	}
+	known, err := knownhosts.New(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts file %s: %v", path, err)
+	}
+	if config.HostKeyChecking == HostKeyStrict {
+		return known, known, nil
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err // known, revoked or changed
+		}
+		return m.addKnownHost(path, hostname, key)
+	}, known, nil
+}
+
+// addKnownHost appends a node's host key to the known hosts file
+func (m *SSHManager) addKnownHost(path, hostname string, key ssh.PublicKey) error {
+	m.knownHost.Lock()
+	defer m.knownHost.Unlock()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)); err != nil {
+		return err
+	}
+	logger.Info().Str("host", hostname).Str("fingerprint", ssh.FingerprintSHA256(key)).Msg("Recorded SSH host key of new node")
+	return nil
+}
+
+// knownHostKeyAlgorithms returns the algorithms of the node's keys in the known hosts
+// file. Offering only those keeps a node whose other key type is negotiated first from
+// failing as if its key had changed; nil leaves the default order for unknown nodes.
+func knownHostKeyAlgorithms(known ssh.HostKeyCallback, address string) []string {
+	if known == nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+	remote, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		remote = &net.TCPAddr{}
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(known(address, remote, probe), &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		switch known.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, known.Key.Type())
+		}
+	}
+	return algorithms
+}
+
+// throttle limits a reader to limitKbps Kbit/s, counted like scp -l and the job ETA; 0
+// does not limit
+func throttle(r io.Reader, limitKbps int) io.Reader {
+	if limitKbps <= 0 {
+		return r
+	}
+	return &throttledReader{reader: r, bytesPerSec: jobs.BytesPerSecond(limitKbps), start: time.Now()}
+}
+
+type throttledReader struct {
+	reader      io.Reader
+	bytesPerSec float64
+	start       time.Time
+	read        int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if chunk := int(t.bytesPerSec / 10); len(p) > chunk && chunk > 0 {
+		p = p[:chunk] // at most a tenth of a second of data per read, to keep the rate smooth
+	}
+	n, err := t.reader.Read(p)
+	t.read += int64(n)
+	due := t.start.Add(time.Duration(float64(t.read) / t.bytesPerSec * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// syncBuffer is a buffer that stdout and stderr of a session can write to at once
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
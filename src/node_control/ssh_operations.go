@@ -2,48 +2,38 @@ package node_control
 
 import (
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"vuDataSim/src/logger"
+	"vuDataSim/src/remotecmd"
 )
 
-const (
-	SSHOptionStrictHostKeyChecking = "StrictHostKeyChecking=no"
-	SSHOptionUserKnownHostsFile    = "UserKnownHostsFile=/dev/null"
-	SSHOptionConnectTimeout        = "ConnectTimeout=10"
-	SSHOptionLogLevel              = "LogLevel=ERROR"
-)
-
+// SSHExecWithOutput runs a command on the node and returns its trimmed stdout
 func (nm *NodeManager) SSHExecWithOutput(nodeConfig NodeConfig, command string) (string, error) {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", SSHOptionStrictHostKeyChecking,
-		"-o", SSHOptionUserKnownHostsFile,
-		fmt.Sprintf("%s@%s", nodeConfig.User, nodeConfig.Host),
-		command,
-	}
-
-	cmd := exec.Command("ssh", args...)
-	output, err := cmd.Output()
+	output, err := SSH.Output(nodeConfig.SSHTarget(), command)
 	if err != nil {
 		return "", fmt.Errorf("SSH command failed: %v", err)
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return strings.TrimSpace(output), nil
 }
 
+// Local artifacts deployed to every node
+const (
+	LocalMainBinary    = "src/migrate/finalvudatasim"
+	LocalMetricsBinary = "src/node_metrics_api/build/node_metrics_api"
+	LocalConfDir       = "src/migrate/conf.d"
+)
+
 func (nm *NodeManager) copyFilesToNode(nodeName string, nodeConfig NodeConfig) error {
-	localMainBinary := "src/migrate/finalvudatasim"
-	localMetricsBinary := "src/node_metrics_api/build/node_metrics_api"
-	localConfDir := "src/migrate/conf.d"
+	localMainBinary := LocalMainBinary
+	localMetricsBinary := LocalMetricsBinary
+	localConfDir := LocalConfDir
 
-	log.Printf("DEBUG: Deployment paths for node %s:", nodeName)
-	log.Printf("  Main binary path: %s", localMainBinary)
-	log.Printf("  Metrics binary path: %s", localMetricsBinary)
-	log.Printf("  Conf dir path: %s", localConfDir)
+	logger.Debugf(logger.ModuleSSH, "Deployment paths for node %s: main binary %s, metrics binary %s, conf dir %s",
+		nodeName, localMainBinary, localMetricsBinary, localConfDir)
 
 	// Check if local files exist
 	if _, err := os.Stat(localMainBinary); os.IsNotExist(err) {
@@ -59,7 +49,7 @@ func (nm *NodeManager) copyFilesToNode(nodeName string, nodeConfig NodeConfig) e
 	}
 
 	// Create remote directories
-	err := nm.sshExec(nodeConfig, fmt.Sprintf("mkdir -p %s %s", nodeConfig.BinaryDir, nodeConfig.ConfDir))
+	err := nm.sshExec(nodeConfig, remotecmd.MakeDirs(nodeConfig.BinaryDir, nodeConfig.ConfDir))
 	if err != nil {
 		return fmt.Errorf("failed to create remote directories: %v", err)
 	}
@@ -117,93 +107,37 @@ func (nm *NodeManager) cleanupNodeFiles(nodeName string) error {
 }
 
 func (nm *NodeManager) scpCopyDir(nodeConfig NodeConfig, localDir, remoteDir string) error {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", SSHOptionStrictHostKeyChecking,
-		"-o", SSHOptionUserKnownHostsFile,
-		"-r",
-		localDir,
-		fmt.Sprintf("%s@%s:%s", nodeConfig.User, nodeConfig.Host, remoteDir),
-	}
-
-	cmd := exec.Command("scp", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("SCP directory copy failed: %v", err)
+	if err := SSH.CopyDir(nodeConfig.SSHTarget(), localDir, remoteDir, 0); err != nil {
+		return fmt.Errorf("directory copy failed: %v", err)
 	}
 
 	return nil
 }
 
 func (nm *NodeManager) scpCopy(nodeConfig NodeConfig, localPath, remotePath string) error {
-	log.Printf("DEBUG: SCP copying %s to %s@%s:%s", localPath, nodeConfig.User, nodeConfig.Host, remotePath)
-
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", SSHOptionStrictHostKeyChecking,
-		"-o", SSHOptionUserKnownHostsFile,
-		"-o", SSHOptionConnectTimeout,
-		"-o", SSHOptionLogLevel,
-	}
+	logger.Debugf(logger.ModuleSSH, "Copying %s to %s@%s:%s", localPath, nodeConfig.User, nodeConfig.Host, remotePath)
 
-	// Add -r only if localPath is a directory
 	info, err := os.Stat(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to stat local path %s: %v", localPath, err)
 	}
 	if info.IsDir() {
-		args = append(args, "-r")
-		log.Printf("DEBUG: Copying directory with -r flag")
+		err = SSH.CopyDir(nodeConfig.SSHTarget(), localPath, remotePath, 0)
+	} else {
+		err = SSH.CopyFile(nodeConfig.SSHTarget(), localPath, remotePath, 0)
 	}
-
-	args = append(args, localPath, fmt.Sprintf("%s@%s:%s", nodeConfig.User, nodeConfig.Host, remotePath))
-
-	log.Printf("DEBUG: Executing SCP command: scp %v", args)
-
-	cmd := exec.Command("scp", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		log.Printf("ERROR: SCP command failed for %s: %v", localPath, err)
-		return fmt.Errorf("SCP copy failed: %v", err)
+	if err != nil {
+		log.Printf("ERROR: Copy failed for %s: %v", localPath, err)
+		return fmt.Errorf("copy failed: %v", err)
 	}
 
-	log.Printf("DEBUG: SCP copy successful for %s", localPath)
+	logger.Debugf(logger.ModuleSSH, "Copy successful for %s", localPath)
 	return nil
 }
 
 func (nm *NodeManager) sshExec(nodeConfig NodeConfig, command string) error {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		"-o", "LogLevel=ERROR",
-		fmt.Sprintf("%s@%s", nodeConfig.User, nodeConfig.Host),
-		command,
-	}
-
-	cmd := exec.Command("ssh", args...)
-
-	// Capture stderr for proper error reporting
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %v", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start SSH command: %v", err)
-	}
-
-	// Read stderr
-	stderrBytes, _ := io.ReadAll(stderr)
-
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("SSH command failed: %v, stderr: %s", err, string(stderrBytes))
+	if err := SSH.Run(nodeConfig.SSHTarget(), command); err != nil {
+		return fmt.Errorf("SSH command failed: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sample buffer defaults
+const (
+	DefaultBufferFile      = "metrics_buffer.ndjson"
+	DefaultBufferMaxMB     = 50
+	DefaultBufferInterval  = 5 * time.Second
+	DefaultBufferRetention = 24 * time.Hour
+	bufferHistoryLimit     = 20000 // samples per history request
+)
+
+// BufferStatus is the state of the sample buffer, part of /api/system/health
+type BufferStatus struct {
+	Path        string     `json:"path"`
+	SizeBytes   int64      `json:"size_bytes"`
+	MaxBytes    int64      `json:"max_bytes"`
+	Interval    string     `json:"interval"`
+	Retention   string     `json:"retention"`
+	Samples     int        `json:"samples"`
+	Oldest      *time.Time `json:"oldest,omitempty"`
+	Newest      *time.Time `json:"newest,omitempty"`
+	Written     uint64     `json:"written"`
+	Compactions uint64     `json:"compactions"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// SampleBuffer keeps the samples of the last -buffer-retention in a local NDJSON file,
+// bounded by -buffer-max-mb, so the manager can fetch what it missed while it or the
+// network was down and backfill its run charts with the original timestamps. The file
+// survives agent restarts.
+type SampleBuffer struct {
+	path      string
+	maxBytes  int64
+	interval  time.Duration
+	retention time.Duration
+
+	mutex       sync.Mutex
+	file        *os.File
+	size        int64
+	samples     int
+	oldest      time.Time
+	newest      time.Time
+	written     uint64
+	compactions uint64
+	lastError   string
+}
+
+// NewSampleBuffer opens the buffer file, keeping the samples already in it
+func NewSampleBuffer(path string, maxMB int, interval, retention time.Duration) (*SampleBuffer, error) {
+	if maxMB <= 0 {
+		return nil, fmt.Errorf("the buffer needs a size, got %d MB", maxMB)
+	}
+	b := &SampleBuffer{
+		path:      path,
+		maxBytes:  int64(maxMB) * 1024 * 1024,
+		interval:  interval,
+		retention: retention,
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// Drop what expired while the agent was down and count the rest
+	if err := b.compactLocked(time.Now()); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Add appends a sample, at most one per -buffer-interval
+func (b *SampleBuffer) Add(sample Sample) {
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.newest.IsZero() && sample.Timestamp.Sub(b.newest) < b.interval {
+		return
+	}
+	if b.size+int64(len(line)) > b.maxBytes || (b.retention > 0 && !b.oldest.IsZero() && sample.Timestamp.Sub(b.oldest) > b.retention+time.Hour) {
+		if err := b.compactLocked(sample.Timestamp); err != nil {
+			b.fail(err)
+			return
+		}
+	}
+	if b.file == nil {
+		file, err := os.OpenFile(b.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			b.fail(err)
+			return
+		}
+		b.file = file
+	}
+	if _, err := b.file.Write(line); err != nil {
+		b.fail(err)
+		return
+	}
+	b.size += int64(len(line))
+	b.samples++
+	b.written++
+	if b.oldest.IsZero() {
+		b.oldest = sample.Timestamp
+	}
+	b.newest = sample.Timestamp
+	b.lastError = ""
+}
+
+// fail records a write error, logging it once until the buffer recovers
+func (b *SampleBuffer) fail(err error) {
+	if b.lastError == "" {
+		log.Printf("Sample buffer %s: %v", b.path, err)
+	}
+	b.lastError = err.Error()
+}
+
+// compactLocked rewrites the file without the samples older than the retention and, if it
+// is still over half its size, without the oldest of the rest. Callers hold the lock.
+func (b *SampleBuffer) compactLocked(now time.Time) error {
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+
+	var lines [][]byte
+	var times []time.Time
+	err := b.scan(func(line []byte, sample Sample) bool {
+		if b.retention > 0 && now.Sub(sample.Timestamp) > b.retention {
+			return true
+		}
+		lines = append(lines, append([]byte(nil), line...))
+		times = append(times, sample.Timestamp)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, line := range lines {
+		size += int64(len(line)) + 1
+	}
+	first := 0
+	for ; size > b.maxBytes/2 && first < len(lines); first++ {
+		size -= int64(len(lines[first])) + 1
+	}
+	lines, times = lines[first:], times[first:]
+
+	temp, err := os.CreateTemp(filepath.Dir(b.path), "."+filepath.Base(b.path)+".compact-")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(temp)
+	for _, line := range lines {
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	err = writer.Flush()
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	b.size, b.samples = size, len(lines)
+	b.oldest, b.newest = time.Time{}, time.Time{}
+	if len(times) > 0 {
+		b.oldest, b.newest = times[0], times[len(times)-1]
+	}
+	if b.written > 0 {
+		b.compactions++
+	}
+	return nil
+}
+
+// scan calls fn with every sample in the file, oldest first, until it returns false.
+// Lines cut short by a crash are skipped.
+func (b *SampleBuffer) scan(fn func(line []byte, sample Sample) bool) error {
+	file, err := os.Open(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var sample Sample
+		if json.Unmarshal(scanner.Bytes(), &sample) != nil || sample.Timestamp.IsZero() {
+			continue
+		}
+		if !fn(scanner.Bytes(), sample) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// History returns the buffered samples taken after since and before until, at most one
+// per step, up to limit; truncated is set when more were left out
+func (b *SampleBuffer) History(since, until time.Time, step time.Duration, limit int) (samples []Sample, truncated bool, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	samples = []Sample{}
+	var last time.Time
+	err = b.scan(func(line []byte, sample Sample) bool {
+		if !sample.Timestamp.After(since) || (!until.IsZero() && !sample.Timestamp.Before(until)) {
+			return true
+		}
+		if step > 0 && !last.IsZero() && sample.Timestamp.Sub(last) < step {
+			return true
+		}
+		if len(samples) == limit {
+			truncated = true
+			return false
+		}
+		samples = append(samples, sample)
+		last = sample.Timestamp
+		return true
+	})
+	return samples, truncated, err
+}
+
+// Status returns the size and time range of the buffer
+func (b *SampleBuffer) Status() BufferStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := BufferStatus{
+		Path:        b.path,
+		SizeBytes:   b.size,
+		MaxBytes:    b.maxBytes,
+		Interval:    b.interval.String(),
+		Retention:   b.retention.String(),
+		Samples:     b.samples,
+		Written:     b.written,
+		Compactions: b.compactions,
+		LastError:   b.lastError,
+	}
+	if !b.oldest.IsZero() {
+		oldest, newest := b.oldest.UTC(), b.newest.UTC()
+		status.Oldest, status.Newest = &oldest, &newest
+	}
+	return status
+}
+
+// HTTP handler for /api/system/metrics/history
+// Query: since and until (RFC3339, both exclusive), step (a duration, at most one sample
+// per step) and limit. Samples are in the format of the output sinks, oldest first.
+func (b *SampleBuffer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	var since, until time.Time
+	for name, target := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+			*target = parsed
+		}
+	}
+	var step time.Duration
+	if value := query.Get("step"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, fmt.Sprintf("Invalid step %q", value), http.StatusBadRequest)
+			return
+		}
+		step = parsed
+	}
+	limit := bufferHistoryLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit %q", value), http.StatusBadRequest)
+			return
+		}
+		if parsed < limit {
+			limit = parsed
+		}
+	}
+
+	samples, truncated, err := b.History(since, until, step, limit)
+	if err != nil {
+		log.Printf("Error reading sample buffer: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	status := b.Status()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"samples":   samples,
+		"count":     len(samples),
+		"truncated": truncated,
+		"oldest":    status.Oldest,
+		"newest":    status.Newest,
+	})
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collectors of the agent. Each is sampled on its own interval, so fast-moving values
+// such as CPU are fresh every second while the disk is only read every 30 seconds.
+const (
+	CollectorCPU     = "cpu"     // system CPU usage and cores, load average and uptime
+	CollectorProcess = "process" // the finalvudatasim process
+	CollectorMemory  = "memory"
+	CollectorDisk    = "disk"
+	CollectorNetwork = "network"
+)
+
+// collectorOrder is the order collectors run in within a pass; process uses the CPU
+// cores read by cpu
+var collectorOrder = []string{CollectorCPU, CollectorProcess, CollectorMemory, CollectorDisk, CollectorNetwork}
+
+// systemCollectors fill the system section of the metrics
+var systemCollectors = []string{CollectorCPU, CollectorMemory, CollectorDisk, CollectorNetwork}
+
+// MinCollectorInterval is the shortest interval a collector can be given
+const MinCollectorInterval = time.Second
+
+// DefaultCollectorIntervals are the intervals used unless -intervals overrides them
+func DefaultCollectorIntervals() map[string]time.Duration {
+	return map[string]time.Duration{
+		CollectorCPU:     MetricsInterval,
+		CollectorProcess: 2 * time.Second,
+		CollectorMemory:  5 * time.Second,
+		CollectorDisk:    30 * time.Second,
+		CollectorNetwork: 5 * time.Second,
+	}
+}
+
+// CollectorState is when a collector last ran, part of /api/system/metrics
+type CollectorState struct {
+	IntervalSeconds float64   `json:"interval_seconds"`
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+	AgeSeconds      float64   `json:"age_seconds"` // -1 before the first run
+	Stale           bool      `json:"stale"`
+}
+
+// parseIntervals reads a -intervals value such as "disk=1m,memory=10s" over the defaults
+func parseIntervals(spec string) (map[string]time.Duration, error) {
+	intervals := DefaultCollectorIntervals()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("%q is not collector=duration", entry)
+		}
+		if _, known := intervals[name]; !known {
+			return nil, fmt.Errorf("unknown collector %q, expected one of %s", name, strings.Join(collectorOrder, ", "))
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("interval of %s: %v", name, err)
+		}
+		if interval < MinCollectorInterval {
+			return nil, fmt.Errorf("interval of %s must be at least %s", name, MinCollectorInterval)
+		}
+		intervals[name] = interval
+	}
+	return intervals, nil
+}
+
+// tick is how often the sampling loop wakes up: the shortest collector interval
+func (mc *MetricsCollector) tick() time.Duration {
+	tick := time.Duration(math.MaxInt64)
+	for _, interval := range mc.intervals {
+		if interval < tick {
+			tick = interval
+		}
+	}
+	return tick
+}
+
+// setIntervals replaces the collector intervals before the sampling loop starts
+func (mc *MetricsCollector) setIntervals(intervals map[string]time.Duration) {
+	mc.intervals = intervals
+	mc.self.interval = mc.tick()
+}
+
+// due reports whether a collector's interval has elapsed. Half a tick of slack keeps a
+// collector whose interval is a multiple of the tick from slipping a tick on jitter.
+func (mc *MetricsCollector) due(name string, now time.Time, tick time.Duration) bool {
+	updated, ok := mc.updated[name]
+	return !ok || now.Sub(updated) >= mc.intervals[name]-tick/2
+}
+
+// updateMetrics runs every collector that is due
+func (mc *MetricsCollector) updateMetrics(now time.Time) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	tick := mc.tick()
+	ran := false
+	for _, name := range collectorOrder {
+		if !mc.due(name, now, tick) {
+			continue
+		}
+		switch name {
+		case CollectorCPU:
+			mc.collectCPU()
+		case CollectorProcess:
+			mc.collectProcessSection(now)
+		case CollectorMemory:
+			mc.collectMemory()
+		case CollectorDisk:
+			mc.collectDisk()
+		case CollectorNetwork:
+			mc.collectNetwork()
+		}
+		mc.updated[name] = now
+		ran = ran || name != CollectorProcess
+	}
+	if ran {
+		mc.currentSysMetrics.Timestamp = now
+	}
+}
+
+// collectorStates returns when each collector last ran. A collector is stale when its
+// last run is older than its interval plus the stale-after age.
+func (mc *MetricsCollector) collectorStates(now time.Time) map[string]CollectorState {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	states := make(map[string]CollectorState, len(collectorOrder))
+	for _, name := range collectorOrder {
+		interval := mc.intervals[name]
+		state := CollectorState{IntervalSeconds: interval.Seconds(), AgeSeconds: -1, Stale: true}
+		if updated, ok := mc.updated[name]; ok {
+			age := now.Sub(updated)
+			state.UpdatedAt = updated
+			state.AgeSeconds = math.Round(age.Seconds()*10) / 10
+			state.Stale = age > interval+mc.staleAfter
+		}
+		states[name] = state
+	}
+	return states
+}
+
+// sectionFreshness returns the age of the oldest of the given collectors' samples and
+// whether any of them is stale
+func sectionFreshness(states map[string]CollectorState, names []string) (float64, bool) {
+	age, stale := 0.0, false
+	for _, name := range names {
+		state := states[name]
+		if state.AgeSeconds < 0 {
+			return -1, true
+		}
+		age = math.Max(age, state.AgeSeconds)
+		stale = stale || state.Stale
+	}
+	return age, stale
+}
+
+// collectorNames returns the collectors sorted by name, for stable output
+func collectorNames(states map[string]CollectorState) []string {
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectCPU reads the CPU cores, the CPU usage since the previous run, the load
+// average and the uptime
+func (mc *MetricsCollector) collectCPU() {
+	sysMetrics := &mc.currentSysMetrics
+
+	// CPU cores (from /proc/cpuinfo)
+	if cpuInfo, err := os.ReadFile("/proc/cpuinfo"); err != nil {
+		mc.self.recordError("/proc/cpuinfo", err)
+	} else {
+		cores := 0
+		for _, line := range strings.Split(string(cpuInfo), "\n") {
+			if strings.HasPrefix(line, "processor") {
+				cores++
+			}
+		}
+		sysMetrics.CPUCores = cores
+	}
+
+	// CPU usage since the previous run (from /proc/stat); the first run reports the
+	// average since boot
+	if cpuData, err := os.ReadFile("/proc/stat"); err != nil {
+		mc.self.recordError("/proc/stat", err)
+	} else {
+		line, _, _ := strings.Cut(string(cpuData), "\n")
+		fields := strings.Fields(line)
+		if len(fields) >= 8 {
+			var total, idle uint64
+			for i := 1; i < len(fields); i++ {
+				if val, err := strconv.ParseUint(fields[i], 10, 64); err == nil {
+					total += val
+					if i == 4 { // idle is the 5th field (index 4)
+						idle = val
+					}
+				}
+			}
+			if total > 0 {
+				if mc.lastCPUTotal > 0 && total > mc.lastCPUTotal && idle >= mc.lastCPUIdle {
+					sysMetrics.CPUUsage = float64((total-mc.lastCPUTotal)-(idle-mc.lastCPUIdle)) / float64(total-mc.lastCPUTotal) * 100
+				} else {
+					sysMetrics.CPUUsage = float64(total-idle) / float64(total) * 100
+				}
+				mc.lastCPUTotal, mc.lastCPUIdle = total, idle
+			}
+		}
+	}
+
+	// Load average (from /proc/loadavg)
+	if loadData, err := os.ReadFile("/proc/loadavg"); err != nil {
+		mc.self.recordError("/proc/loadavg", err)
+	} else {
+		fields := strings.Fields(string(loadData))
+		if len(fields) >= 3 {
+			if val, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				sysMetrics.LoadAvg1 = val
+			}
+			if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				sysMetrics.LoadAvg5 = val
+			}
+			if val, err := strconv.ParseFloat(fields[2], 64); err == nil {
+				sysMetrics.LoadAvg15 = val
+			}
+		}
+	}
+
+	// Uptime (from /proc/uptime)
+	if uptimeData, err := os.ReadFile("/proc/uptime"); err != nil {
+		mc.self.recordError("/proc/uptime", err)
+	} else {
+		fields := strings.Fields(string(uptimeData))
+		if len(fields) >= 1 {
+			if val, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				days := int(val / 86400)
+				hours := int((val - float64(days*86400)) / 3600)
+				minutes := int((val - float64(days*86400+hours*3600)) / 60)
+				sysMetrics.Uptime = fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+				sysMetrics.UptimeSecs = val
+			}
+		}
+	}
+}
+
+// collectProcessSection samples the simulator and records its exit when it is gone
+func (mc *MetricsCollector) collectProcessSection(now time.Time) {
+	cores := mc.currentSysMetrics.CPUCores
+	if cores == 0 {
+		cores = runtime.NumCPU()
+	}
+	metrics := FinalVuDataSimMetrics{}
+	mc.collectProcess(&metrics, readTotalTicks(), cores)
+	metrics.Timestamp = now
+
+	// Remember why the process went away, so a crash can be told from a manual stop
+	if exit := detectExit(mc.currentMetrics, metrics); exit != nil {
+		log.Printf("finalvudatasim (PID %d) is no longer running", exit.PID)
+		go mc.recordExit(*exit)
+	}
+	mc.currentMetrics = metrics
+}
+
+// collectMemory reads /proc/meminfo
+func (mc *MetricsCollector) collectMemory() {
+	memData, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		mc.self.recordError("/proc/meminfo", err)
+		return
+	}
+	sysMetrics := &mc.currentSysMetrics
+	for _, line := range strings.Split(string(memData), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			switch fields[0] {
+			case "MemTotal:":
+				if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
+					sysMetrics.MemTotal = val / 1024 // Convert KB to MB
+				}
+			case "MemFree:":
+				if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
+					sysMetrics.MemFree = val / 1024 // Convert KB to MB
+				}
+			}
+		}
+	}
+	sysMetrics.MemUsed = sysMetrics.MemTotal - sysMetrics.MemFree
+}
+
+// collectDisk reads the usage of the root filesystem
+func (mc *MetricsCollector) collectDisk() {
+	total, used, free, err := readDiskUsage("/")
+	if err != nil {
+		mc.self.recordError("statfs /", err)
+		return
+	}
+	mc.currentSysMetrics.DiskTotal, mc.currentSysMetrics.DiskUsed, mc.currentSysMetrics.DiskFree = total, used, free
+}
+
+// collectNetwork reads the network counters from /proc/net/dev
+func (mc *MetricsCollector) collectNetwork() {
+	netData, err := os.ReadFile("/proc/net/dev")
+	if err != nil {
+		mc.self.recordError("/proc/net/dev", err)
+		return
+	}
+	mc.currentSysMetrics.NetRxBytes, mc.currentSysMetrics.NetTxBytes = parseNetDev(string(netData))
+}
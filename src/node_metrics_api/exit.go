@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Exit reasons of the finalvudatasim process
+const (
+	ExitReasonOOMKilled = "oom_killed" // the kernel OOM killer ended it
+	ExitReasonSegfault  = "segfault"   // the kernel logged a segfault
+	ExitReasonExited    = "exited"     // no kernel record: a normal exit, a panic or a kill such as a manual stop
+	ExitReasonUnknown   = "unknown"    // neither dmesg nor the journal could be read
+)
+
+// exitLogTimeout bounds each dmesg or journalctl call
+const exitLogTimeout = 5 * time.Second
+
+// ProcessExit records the last time finalvudatasim disappeared between two samples
+type ProcessExit struct {
+	PID       int       `json:"pid"`
+	StartTime string    `json:"start_time,omitempty"`
+	LastSeen  time.Time `json:"last_seen"` // last sample that saw it running
+	ExitedAt  time.Time `json:"exited_at"` // first sample that did not
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"` // the matching kernel log line
+	Source    string    `json:"source,omitempty"` // dmesg or journal
+}
+
+// detectExit returns the exit of the process seen in previous when current no longer
+// shows it running under the same PID, or nil
+func detectExit(previous, current FinalVuDataSimMetrics) *ProcessExit {
+	if !previous.Running || previous.PID == 0 || (current.Running && current.PID == previous.PID) {
+		return nil
+	}
+	return &ProcessExit{
+		PID:       previous.PID,
+		StartTime: previous.StartTime,
+		LastSeen:  previous.Timestamp,
+		ExitedAt:  current.Timestamp,
+		Reason:    ExitReasonUnknown,
+	}
+}
+
+// classifyExit looks for the PID in the kernel log, first via dmesg and then via the
+// journal, which is readable on hosts that restrict dmesg to root
+func classifyExit(exit *ProcessExit) {
+	patterns := []struct {
+		reason string
+		re     *regexp.Regexp
+	}{
+		{ExitReasonOOMKilled, regexp.MustCompile(fmt.Sprintf(`(?i)(killed process %d\b|oom-kill.*\bpid=%d\b)`, exit.PID, exit.PID))},
+		{ExitReasonSegfault, regexp.MustCompile(fmt.Sprintf(`\[%d\]: segfault at`, exit.PID))},
+	}
+	since := exit.LastSeen.Add(-time.Minute).Format("2006-01-02 15:04:05")
+	sources := []struct {
+		name string
+		args []string
+	}{
+		{"dmesg", []string{"dmesg"}},
+		{"journal", []string{"journalctl", "-k", "--no-pager", "-q", "--since", since}},
+	}
+
+	for _, source := range sources {
+		ctx, cancel := context.WithTimeout(context.Background(), exitLogTimeout)
+		output, err := exec.CommandContext(ctx, source.args[0], source.args[1:]...).Output()
+		cancel()
+		if err != nil {
+			continue
+		}
+		exit.Reason = ExitReasonExited
+		exit.Source = source.name
+		for _, line := range strings.Split(string(output), "\n") {
+			for _, pattern := range patterns {
+				if pattern.re.MatchString(line) {
+					exit.Reason = pattern.reason
+					exit.Detail = strings.TrimSpace(line)
+					return
+				}
+			}
+		}
+	}
+}
+
+// recordExit classifies an exit and stores it as the last one, unless the process
+// exited again in the meantime
+func (mc *MetricsCollector) recordExit(exit ProcessExit) {
+	classifyExit(&exit)
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+	if mc.lastExit == nil || !mc.lastExit.ExitedAt.After(exit.ExitedAt) {
+		mc.lastExit = &exit
+	}
+}
+
+// GetLastExit returns the last recorded exit of the process, or nil (thread-safe)
+func (mc *MetricsCollector) GetLastExit() *ProcessExit {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	if mc.lastExit == nil {
+		return nil
+	}
+	exit := *mc.lastExit
+	return &exit
+}
@@ -4,3 +4,5 @@ go 1.21
 
 // This module provides a lightweight HTTP server for collecting system metrics
 // from Linux nodes using /proc filesystem
+
+require github.com/gorilla/websocket v1.5.0
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Inventory configuration
+const (
+	InventoryCommandTimeout = 5 * time.Second
+	InventoryCacheTTL       = 10 * time.Minute
+)
+
+// ToolVersion is the installed version of a tool relevant to load testing
+type ToolVersion struct {
+	Installed bool   `json:"installed"`
+	Version   string `json:"version,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NodeInventory is the response of /api/system/inventory
+type NodeInventory struct {
+	NodeID        string                 `json:"nodeId"`
+	Hostname      string                 `json:"hostname"`
+	OSName        string                 `json:"os_name"`
+	OSVersion     string                 `json:"os_version"`
+	OSPrettyName  string                 `json:"os_pretty_name"`
+	Kernel        string                 `json:"kernel"`
+	Arch          string                 `json:"arch"`
+	CPUModel      string                 `json:"cpu_model"`
+	CPUCores      int                    `json:"cpu_cores"`
+	CPUSockets    int                    `json:"cpu_sockets,omitempty"`
+	MemTotalMB    float64                `json:"mem_total_mb"`
+	Tools         map[string]ToolVersion `json:"tools"`
+	CollectedAt   time.Time              `json:"collected_at"`
+	CollectErrors []string               `json:"collect_errors,omitempty"`
+}
+
+// inventoryTool describes how to find a tool's version
+type inventoryTool struct {
+	name string
+	args []string
+}
+
+// Tools whose versions affect load test results. java reports to stderr, so output
+// from both streams is parsed.
+var inventoryTools = []inventoryTool{
+	{name: "java", args: []string{"-version"}},
+	{name: "docker", args: []string{"--version"}},
+	{name: "kubectl", args: []string{"version", "--client"}},
+	{name: "tc", args: []string{"-V"}},
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+([._+-][0-9A-Za-z.]+)?`)
+
+// InventoryCollector caches the node inventory, which only changes on upgrades
+type InventoryCollector struct {
+	mutex     sync.Mutex
+	nodeID    string
+	inventory *NodeInventory
+}
+
+// NewInventoryCollector creates an inventory collector for the node
+func NewInventoryCollector(nodeID string) *InventoryCollector {
+	return &InventoryCollector{nodeID: nodeID}
+}
+
+// Get returns the cached inventory, collecting it again when it is older than
+// InventoryCacheTTL or refresh is set
+func (ic *InventoryCollector) Get(refresh bool) *NodeInventory {
+	ic.mutex.Lock()
+	defer ic.mutex.Unlock()
+
+	if refresh || ic.inventory == nil || time.Since(ic.inventory.CollectedAt) > InventoryCacheTTL {
+		ic.inventory = ic.collect()
+	}
+	return ic.inventory
+}
+
+// collect reads OS, kernel, CPU and tool details from the node
+func (ic *InventoryCollector) collect() *NodeInventory {
+	inv := &NodeInventory{
+		NodeID:      ic.nodeID,
+		Arch:        runtime.GOARCH,
+		CPUCores:    runtime.NumCPU(),
+		Tools:       make(map[string]ToolVersion),
+		CollectedAt: time.Now().UTC(),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		inv.Hostname = hostname
+	}
+
+	if release, err := readKeyValueFile("/etc/os-release", "="); err != nil {
+		inv.CollectErrors = append(inv.CollectErrors, "os-release: "+err.Error())
+	} else {
+		inv.OSName = release["NAME"]
+		inv.OSVersion = release["VERSION_ID"]
+		inv.OSPrettyName = release["PRETTY_NAME"]
+	}
+
+	if kernel, err := os.ReadFile("/proc/sys/kernel/osrelease"); err != nil {
+		inv.CollectErrors = append(inv.CollectErrors, "kernel: "+err.Error())
+	} else {
+		inv.Kernel = strings.TrimSpace(string(kernel))
+	}
+
+	if err := readCPUInfo(inv); err != nil {
+		inv.CollectErrors = append(inv.CollectErrors, "cpuinfo: "+err.Error())
+	}
+
+	if memTotal, err := readMemTotalMB(); err != nil {
+		inv.CollectErrors = append(inv.CollectErrors, "meminfo: "+err.Error())
+	} else {
+		inv.MemTotalMB = memTotal
+	}
+
+	for _, tool := range inventoryTools {
+		inv.Tools[tool.name] = toolVersion(tool)
+	}
+	return inv
+}
+
+// readKeyValueFile parses "key<sep>value" lines such as /etc/os-release or /proc/meminfo
+func readKeyValueFile(path, sep string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), sep)
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return values, scanner.Err()
+}
+
+// readCPUInfo fills the CPU model and socket count from /proc/cpuinfo
+func readCPUInfo(inv *NodeInventory) error {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sockets := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "model name":
+			if inv.CPUModel == "" {
+				inv.CPUModel = value
+			}
+		case "physical id":
+			sockets[value] = true
+		}
+	}
+	inv.CPUSockets = len(sockets)
+	return scanner.Err()
+}
+
+// readMemTotalMB returns MemTotal from /proc/meminfo in MB
+func readMemTotalMB() (float64, error) {
+	values, err := readKeyValueFile("/proc/meminfo", ":")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(values["MemTotal"])
+	if len(fields) == 0 {
+		return 0, os.ErrNotExist
+	}
+	kb, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return kb / 1024, nil
+}
+
+// toolVersion runs the tool's version command and extracts the first version number
+func toolVersion(tool inventoryTool) ToolVersion {
+	path, err := exec.LookPath(tool.name)
+	if err != nil {
+		return ToolVersion{Installed: false}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), InventoryCommandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, tool.args...).CombinedOutput()
+
+	result := ToolVersion{Installed: true, Path: path}
+	if version := versionPattern.FindString(string(output)); version != "" {
+		result.Version = version
+	} else if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Error = "could not parse version output"
+	}
+	return result
+}
+
+// HTTP handler for /api/system/inventory[?refresh=true]
+func (ic *InventoryCollector) handleInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Content-Type", "application/json")
+
+	refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh"))
+	if err := json.NewEncoder(w).Encode(ic.Get(refresh)); err != nil {
+		log.Printf("Error encoding inventory JSON: %v", err)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,8 +16,9 @@ import (
 
 // Application configuration
 const (
-	DefaultPort     = "8086"
-	MetricsInterval = 1 * time.Second
+	DefaultPort       = "8086"
+	MetricsInterval   = 1 * time.Second
+	DefaultStaleAfter = 30 * time.Second
 )
 
 // FinalVuDataSimMetrics represents metrics for the finalvudatasim process
@@ -30,6 +30,12 @@ type FinalVuDataSimMetrics struct {
 	MemMB      float64   `json:"mem_mb,omitempty"`
 	Cmdline    string    `json:"cmdline,omitempty"`
 	Timestamp  time.Time `json:"timestamp,omitempty"`
+
+	// Left out when /proc/<pid>/fd or /proc/<pid>/io is not readable, i.e. the
+	// simulator runs as another user and the agent is not root
+	Threads int        `json:"threads,omitempty"`
+	OpenFDs int        `json:"open_fds,omitempty"`
+	IO      *ProcessIO `json:"io,omitempty"`
 }
 
 // SystemMetrics represents basic system metrics
@@ -46,6 +52,9 @@ type SystemMetrics struct {
 	LoadAvg5    float64   `json:"load_avg_5"`
 	LoadAvg15   float64   `json:"load_avg_15"`
 	Uptime      string    `json:"uptime"`
+	UptimeSecs  float64   `json:"uptime_seconds"`
+	NetRxBytes  uint64    `json:"net_rx_bytes"` // received on all non-loopback interfaces since boot
+	NetTxBytes  uint64    `json:"net_tx_bytes"` // sent on all non-loopback interfaces since boot
 	Timestamp   time.Time `json:"timestamp"`
 }
 
@@ -53,8 +62,23 @@ type SystemMetrics struct {
 type MetricsCollector struct {
 	currentMetrics    FinalVuDataSimMetrics
 	currentSysMetrics SystemMetrics
+	lastExit          *ProcessExit // last time finalvudatasim disappeared
 	mutex             sync.RWMutex
 	nodeID            string
+	staleAfter        time.Duration // samples older than this are served as stale
+	self              *AgentStats
+	sinks             *SinkSet // optional outputs besides HTTP
+	stream            *MetricsStream // pushes samples to /ws clients
+	pprof             *PprofServer   // on-demand profiling listener
+	buffer            *SampleBuffer  // samples kept for the manager to replay
+
+	intervals map[string]time.Duration // per collector
+	updated   map[string]time.Time     // last run of each collector
+
+	// Counters of the previous sample, to compute the CPU usage since then
+	lastProcessTicks cpuTicks
+	lastCPUTotal     uint64
+	lastCPUIdle      uint64
 }
 
 // NewMetricsCollector creates a new metrics collector
@@ -64,239 +88,59 @@ func NewMetricsCollector(nodeID string) *MetricsCollector {
 		hostname, _ := os.Hostname()
 		nodeID = hostname
 	}
-	return &MetricsCollector{nodeID: nodeID}
+	return &MetricsCollector{
+		nodeID:     nodeID,
+		staleAfter: DefaultStaleAfter,
+		self:       NewAgentStats(MetricsInterval),
+		intervals:  DefaultCollectorIntervals(),
+		updated:    make(map[string]time.Time),
+	}
 }
 
-// collectMetrics runs in background to collect system metrics
+// collectMetrics runs in background to collect system metrics, waking up at the
+// shortest collector interval and running the collectors that are due
 func (mc *MetricsCollector) collectMetrics() {
-	ticker := time.NewTicker(MetricsInterval)
+	ticker := time.NewTicker(mc.tick())
 	defer ticker.Stop()
 
 	for range ticker.C {
-		mc.updateMetrics()
-	}
-}
-
-// updateMetrics collects current system metrics
-func (mc *MetricsCollector) updateMetrics() {
-	mc.mutex.Lock()
-	defer mc.mutex.Unlock()
-
-	metrics := FinalVuDataSimMetrics{}
-	output, err := exec.Command("pgrep", "-f", "finalvudatasim").Output()
-	if err == nil && len(output) > 0 {
-		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-		// Find the actual finalvudatasim process (not wrapper processes)
-		// Since pgrep finds both processes, we need to check each one
-		// The actual binary process should be the one with the exact command "./finalvudatasim"
-		var actualPid string
-		for _, line := range lines {
-			pidStr := strings.TrimSpace(line)
-			if pidStr != "" {
-				// Check if this is the actual binary process
-				psCheck, _ := exec.Command("ps", "-p", pidStr, "-o", "cmd=").Output()
-				cmdLine := strings.TrimSpace(string(psCheck))
-				// Look for processes where the command is exactly "./finalvudatasim"
-				if cmdLine == "./finalvudatasim" {
-					actualPid = pidStr
-					break
-				}
-			}
-		}
-
-		// If we didn't find the exact match, try to find the process with highest CPU usage
-		// as a fallback (the actual working process)
-		if actualPid == "" {
-			var highestPid string
-			var highestCpu float64 = 0
-			for _, line := range lines {
-				pidStr := strings.TrimSpace(line)
-				if pidStr != "" {
-					psOut, _ := exec.Command("ps", "-p", pidStr, "-o", "pcpu=").Output()
-					psLines := strings.Split(strings.TrimSpace(string(psOut)), "\n")
-					if len(psLines) >= 2 {
-						dataLine := strings.TrimSpace(psLines[1])
-						if cpu, err := strconv.ParseFloat(dataLine, 64); err == nil && cpu > highestCpu {
-							highestCpu = cpu
-							highestPid = pidStr
-						}
-					}
-				}
-			}
-			if highestPid != "" {
-				actualPid = highestPid
-			}
-		}
-
-		if actualPid != "" {
-			pid, err := strconv.Atoi(actualPid)
-			if err == nil {
-				metrics.Running = true
-				metrics.PID = pid
-
-				// Get process start time
-				startTimeOut, _ := exec.Command("ps", "-p", actualPid, "-o", "lstart=").Output()
-				metrics.StartTime = strings.TrimSpace(string(startTimeOut))
-
-				// Get CPU and memory usage - use more detailed ps command
-				psOut, _ := exec.Command("ps", "-p", actualPid, "-o", "pcpu,rss,cmd").Output()
-				log.Printf("Raw ps output for PID %s: %q", actualPid, string(psOut))
-
-				psLines := strings.Split(strings.TrimSpace(string(psOut)), "\n")
-				log.Printf("ps lines: %v", psLines)
-
-				if len(psLines) >= 2 {
-					// Skip header line and get the actual data
-					dataLine := psLines[1]
-					log.Printf("Data line: %q", dataLine)
-					psFields := strings.Fields(dataLine)
-					log.Printf("Parsed fields: %v", psFields)
-
-					if len(psFields) >= 3 {
-						if cpu, err := strconv.ParseFloat(psFields[0], 64); err == nil {
-							metrics.CPUPercent = cpu
-							log.Printf("Parsed CPU: %f", cpu)
-						}
-						if memKB, err := strconv.ParseFloat(psFields[1], 64); err == nil {
-							metrics.MemMB = memKB / 1024.0
-							log.Printf("Parsed memory: %f KB -> %f MB", memKB, metrics.MemMB)
-						}
-						metrics.Cmdline = strings.Join(psFields[2:], " ")
-						log.Printf("Parsed cmdline: %s", metrics.Cmdline)
-					}
-				}
-			}
-		} else {
-			metrics.Running = false
-			metrics.PID = 0
-			metrics.StartTime = ""
-			metrics.CPUPercent = 0
-			metrics.MemMB = 0
-			metrics.Cmdline = ""
-		}
-	} else {
-		metrics.Running = false
-		metrics.PID = 0
-		metrics.StartTime = ""
-		metrics.CPUPercent = 0
-		metrics.MemMB = 0
-		metrics.Cmdline = ""
-	}
-	metrics.Timestamp = time.Now()
-
-	// Store process metrics
-	mc.currentMetrics = metrics
-
-	// Collect system metrics
-	sysMetrics := SystemMetrics{}
-
-	// CPU cores (from /proc/cpuinfo)
-	if cpuInfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
-		lines := strings.Split(string(cpuInfo), "\n")
-		coreCount := 0
-		for _, line := range lines {
-			if strings.HasPrefix(line, "processor") {
-				coreCount++
-			}
-		}
-		sysMetrics.CPUCores = coreCount
-	}
-
-	// CPU usage (from /proc/stat)
-	if cpuData, err := os.ReadFile("/proc/stat"); err == nil {
-		lines := strings.Split(string(cpuData), "\n")
-		if len(lines) > 0 {
-			fields := strings.Fields(lines[0])
-			if len(fields) >= 8 {
-				var total, idle uint64
-				for i := 1; i < len(fields); i++ {
-					if val, err := strconv.ParseUint(fields[i], 10, 64); err == nil {
-						total += val
-						if i == 4 { // idle is the 5th field (index 4)
-							idle = val
-						}
-					}
+		start := time.Now()
+		mc.updateMetrics(start)
+		mc.self.recordLoop(time.Since(start))
+		if mc.sinks != nil || mc.buffer != nil {
+			if sample := mc.currentSample(); !sample.Timestamp.IsZero() {
+				if mc.sinks != nil {
+					mc.sinks.Publish(sample)
 				}
-				if total > 0 {
-					sysMetrics.CPUUsage = float64(total-idle) / float64(total) * 100
+				if mc.buffer != nil {
+					mc.buffer.Add(sample)
 				}
 			}
 		}
 	}
+}
 
-	// Memory info (from /proc/meminfo)
-	if memData, err := os.ReadFile("/proc/meminfo"); err == nil {
-		lines := strings.Split(string(memData), "\n")
-		for _, line := range lines {
-			fields := strings.Fields(line)
-			if len(fields) >= 2 {
-				switch fields[0] {
-				case "MemTotal:":
-					if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
-						sysMetrics.MemTotal = val / 1024 // Convert KB to MB
-					}
-				case "MemFree:":
-					if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
-						sysMetrics.MemFree = val / 1024 // Convert KB to MB
-					}
-				}
-			}
+// parseNetDev sums the received and sent bytes of all interfaces except loopback in
+// the contents of /proc/net/dev
+func parseNetDev(data string) (rx, tx uint64) {
+	for _, line := range strings.Split(data, "\n") {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
 		}
-		sysMetrics.MemUsed = sysMetrics.MemTotal - sysMetrics.MemFree
-	}
-
-	// Disk usage (using df command for root filesystem)
-	if dfOut, err := exec.Command("df", "-BG", "/").Output(); err == nil {
-		lines := strings.Split(strings.TrimSpace(string(dfOut)), "\n")
-		if len(lines) >= 2 {
-			fields := strings.Fields(lines[1])
-			if len(fields) >= 4 {
-				if total, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "G"), 64); err == nil {
-					sysMetrics.DiskTotal = total
-				}
-				if used, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "G"), 64); err == nil {
-					sysMetrics.DiskUsed = used
-				}
-				if avail, err := strconv.ParseFloat(strings.TrimSuffix(fields[3], "G"), 64); err == nil {
-					sysMetrics.DiskFree = avail
-				}
-			}
+		// Receive bytes is the first field, transmit bytes the ninth
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
 		}
-	}
-
-	// Load average (from /proc/loadavg)
-	if loadData, err := os.ReadFile("/proc/loadavg"); err == nil {
-		fields := strings.Fields(string(loadData))
-		if len(fields) >= 3 {
-			if val, err := strconv.ParseFloat(fields[0], 64); err == nil {
-				sysMetrics.LoadAvg1 = val
-			}
-			if val, err := strconv.ParseFloat(fields[1], 64); err == nil {
-				sysMetrics.LoadAvg5 = val
-			}
-			if val, err := strconv.ParseFloat(fields[2], 64); err == nil {
-				sysMetrics.LoadAvg15 = val
-			}
+		if value, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			rx += value
 		}
-	}
-
-	// Uptime (from /proc/uptime)
-	if uptimeData, err := os.ReadFile("/proc/uptime"); err == nil {
-		fields := strings.Fields(string(uptimeData))
-		if len(fields) >= 1 {
-			if val, err := strconv.ParseFloat(fields[0], 64); err == nil {
-				days := int(val / 86400)
-				hours := int((val - float64(days*86400)) / 3600)
-				minutes := int((val - float64(days*86400+hours*3600)) / 60)
-				sysMetrics.Uptime = fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
-			}
+		if value, err := strconv.ParseUint(fields[8], 10, 64); err == nil {
+			tx += value
 		}
 	}
-
-	sysMetrics.Timestamp = time.Now()
-
-	// Store system metrics
-	mc.currentSysMetrics = sysMetrics
+	return rx, tx
 }
 
 // GetCurrentMetrics returns the current process metrics (thread-safe)
@@ -328,19 +172,37 @@ func (mc *MetricsCollector) handleMetrics(w http.ResponseWriter, r *http.Request
 
 	metrics := mc.GetCurrentMetrics()
 	sysMetrics := mc.GetCurrentSystemMetrics()
+	lastExit := mc.GetLastExit()
+
+	now := time.Now()
+	collectors := mc.collectorStates(now)
+	processAge, processStale := sectionFreshness(collectors, []string{CollectorProcess})
+	systemAge, systemStale := sectionFreshness(collectors, systemCollectors)
 
 	resp := map[string]interface{}{
-		"nodeId":      mc.nodeID,
-		"timestamp":   metrics.Timestamp,
+		"nodeId":              mc.nodeID,
+		"timestamp":           metrics.Timestamp,
+		"stale":               processStale || systemStale,
+		"stale_after_seconds": mc.staleAfter.Seconds(),
+		"collectors":          collectors,
 		"process": map[string]interface{}{
+			"age_seconds": processAge,
+			"stale":       processStale,
 			"running":     metrics.Running,
 			"pid":         metrics.PID,
 			"start_time":  metrics.StartTime,
 			"cpu_percent": metrics.CPUPercent,
 			"mem_mb":      metrics.MemMB,
 			"cmdline":     metrics.Cmdline,
+			"threads":     metrics.Threads,
+			"open_fds":    metrics.OpenFDs,
+			"io":          metrics.IO,
+			"last_exit":   lastExit,
 		},
 		"system": map[string]interface{}{
+			"timestamp":     sysMetrics.Timestamp,
+			"age_seconds":   systemAge,
+			"stale":         systemStale,
 			"cpu_usage":     sysMetrics.CPUUsage,
 			"cpu_cores":     sysMetrics.CPUCores,
 			"mem_total_mb":  sysMetrics.MemTotal,
@@ -353,6 +215,8 @@ func (mc *MetricsCollector) handleMetrics(w http.ResponseWriter, r *http.Request
 			"load_avg_5":    sysMetrics.LoadAvg5,
 			"load_avg_15":   sysMetrics.LoadAvg15,
 			"uptime":        sysMetrics.Uptime,
+			"net_rx_bytes":  sysMetrics.NetRxBytes,
+			"net_tx_bytes":  sysMetrics.NetTxBytes,
 		},
 	}
 
@@ -378,11 +242,28 @@ func (mc *MetricsCollector) handleHealth(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.Header().Set("Content-Type", "application/json")
 
+	self := mc.self.Snapshot()
 	health := map[string]interface{}{
 		"status":    "healthy",
 		"nodeId":    mc.nodeID,
 		"timestamp": time.Now(),
-		"uptime":    time.Since(mc.currentMetrics.Timestamp).String(),
+		"version":   self.Version,
+		"commit":    self.Commit,
+		"buildDate": self.BuildDate,
+		"uptime":    time.Since(self.StartedAt).Round(time.Second).String(),
+		"agent":     self,
+	}
+	if mc.sinks != nil {
+		health["sinks"] = mc.sinks.Status()
+	}
+	if mc.stream != nil {
+		health["stream"] = mc.stream.Status()
+	}
+	if mc.pprof != nil {
+		health["pprof"] = mc.pprof.Status()
+	}
+	if mc.buffer != nil {
+		health["buffer"] = mc.buffer.Status()
 	}
 
 	if err := json.NewEncoder(w).Encode(health); err != nil {
@@ -407,6 +288,14 @@ func getNodeIDFromEnv() string {
 	return hostname
 }
 
+// envOrDefault returns the environment variable value or the fallback when unset
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
 // findAvailablePort finds the first available port starting from the default port
 func findAvailablePort(startPort int) (int, error) {
 	for port := startPort; port < startPort+100; port++ { // Try up to 100 ports
@@ -424,8 +313,35 @@ func findAvailablePort(startPort int) (int, error) {
 func main() {
 	// Parse command line flags
 	portFlag := flag.String("port", "", "Port to listen on (optional, will find available if not specified)")
+	kafkaFlag := flag.String("kafka-brokers", os.Getenv("KAFKA_BROKERS"), "Comma separated Kafka brokers to probe (defaults to output.kafka hosts in conf.yml)")
+	clickhouseFlag := flag.String("clickhouse-addr", os.Getenv("CLICKHOUSE_ADDR"), "Comma separated ClickHouse host:port addresses to probe")
+	confFlag := flag.String("conf", envOrDefault("VUDATASIM_CONF", DefaultConfPath), "Path to the simulator conf.yml")
+	staleAfterFlag := flag.Duration("stale-after", DefaultStaleAfter, "Age after which served metrics are flagged stale")
+	pushIntervalFlag := flag.Duration("push-interval", DefaultPushInterval, "How often /ws pushes the latest sample to its clients")
+	intervalsFlag := flag.String("intervals", os.Getenv("METRICS_INTERVALS"), "Collector intervals overriding the defaults, e.g. disk=1m,memory=10s (collectors: cpu, process, memory, disk, network)")
+	outputFileFlag := flag.String("output-file", os.Getenv("METRICS_OUTPUT_FILE"), "Also append every sample to this local file")
+	outputFormatFlag := flag.String("output-format", "", "Format of -output-file: csv or ndjson (default csv for a .csv file, else ndjson)")
+	outputMaxMBFlag := flag.Int("output-max-mb", DefaultOutputMaxMB, "Rotate -output-file beyond this size in MB, 0 never rotates")
+	statsdFlag := flag.String("statsd-addr", os.Getenv("STATSD_ADDR"), "Also send every sample as gauges to this statsd host:port over UDP")
+	statsdPrefixFlag := flag.String("statsd-prefix", DefaultStatsdPrefix, "Prefix of the statsd gauge names, followed by the node ID")
+	otlpFlag := flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"), "Also push samples to this OTLP/HTTP metrics URL, e.g. http://collector:4318/v1/metrics")
+	otlpIntervalFlag := flag.Duration("otlp-interval", DefaultOTLPInterval, "How often samples are pushed to -otlp-endpoint")
+	pprofFlag := flag.Bool("pprof", false, "Open the profiling listener at start instead of on SIGUSR1")
+	pprofAddrFlag := flag.String("pprof-addr", envOrDefault("AGENT_PPROF_ADDR", DefaultPprofAddr), "Address of the profiling listener, opened on SIGUSR1 and closed on SIGUSR2")
+	pprofTokenFlag := flag.String("pprof-token", os.Getenv("AGENT_PPROF_TOKEN"), "Bearer token required by the profiling listener, mandatory unless -pprof-addr is loopback")
+	pprofTimeoutFlag := flag.Duration("pprof-timeout", DefaultPprofTimeout, "Close the profiling listener this long after it was opened, 0 keeps it open")
+	bufferFileFlag := flag.String("buffer-file", envOrDefault("METRICS_BUFFER_FILE", DefaultBufferFile), "Keep recent samples in this file for the manager to replay after an outage")
+	bufferMaxMBFlag := flag.Int("buffer-max-mb", DefaultBufferMaxMB, "Size bound of -buffer-file in MB, 0 disables the buffer")
+	bufferIntervalFlag := flag.Duration("buffer-interval", DefaultBufferInterval, "Keep at most one sample per interval in -buffer-file")
+	bufferRetentionFlag := flag.Duration("buffer-retention", DefaultBufferRetention, "Drop buffered samples older than this, 0 keeps them until the size bound")
+	versionFlag := flag.Bool("version", false, "Print the build as JSON and exit")
 	flag.Parse()
 
+	if *versionFlag {
+		json.NewEncoder(os.Stdout).Encode(agentBuild())
+		return
+	}
+
 	// Determine starting port
 	startPortStr := *portFlag
 	if startPortStr == "" {
@@ -451,6 +367,8 @@ func main() {
 	nodeID := getNodeIDFromEnv()
 
 	log.Printf("Starting Node Metrics API server...")
+	build := agentBuild()
+	log.Printf("Version: %s (commit %s, built %s)", build.Version, build.Commit, build.BuildDate)
 	log.Printf("Node ID: %s", nodeID)
 	log.Printf("Port: %s", portStr)
 
@@ -461,25 +379,116 @@ func main() {
 
 	// Create metrics collector
 	collector := NewMetricsCollector(nodeID)
+	if *staleAfterFlag > 0 {
+		collector.staleAfter = *staleAfterFlag
+	}
+	intervals, err := parseIntervals(*intervalsFlag)
+	if err != nil {
+		log.Fatalf("Invalid -intervals: %v", err)
+	}
+	collector.setIntervals(intervals)
+	for _, name := range collectorOrder {
+		log.Printf("Collector %s: every %s", name, intervals[name])
+	}
+
+	// Open the optional output sinks, so samples survive an unreachable manager
+	sinks, err := NewSinkSet(nodeID, SinkConfig{
+		OutputFile:   *outputFileFlag,
+		OutputFormat: *outputFormatFlag,
+		OutputMaxMB:  *outputMaxMBFlag,
+		StatsdAddr:   *statsdFlag,
+		StatsdPrefix: *statsdPrefixFlag,
+		OTLPEndpoint: *otlpFlag,
+		OTLPInterval: *otlpIntervalFlag,
+	}, collector.self)
+	if err != nil {
+		log.Fatalf("Failed to set up output sinks: %v", err)
+	}
+	if sinks != nil {
+		collector.sinks = sinks
+		sinks.Start()
+		for _, status := range sinks.Status() {
+			log.Printf("Writing samples to %s sink: %s", status.Name, status.Target)
+		}
+	}
+
+	// Buffer samples on disk, so the manager can backfill what it missed while it was down
+	if *bufferMaxMBFlag > 0 {
+		buffer, err := NewSampleBuffer(*bufferFileFlag, *bufferMaxMBFlag, *bufferIntervalFlag, *bufferRetentionFlag)
+		if err != nil {
+			log.Fatalf("Failed to open the sample buffer %s: %v", *bufferFileFlag, err)
+		}
+		collector.buffer = buffer
+		status := buffer.Status()
+		log.Printf("Buffering samples in %s: every %s, up to %d MB, %d samples kept", status.Path, status.Interval, *bufferMaxMBFlag, status.Samples)
+	}
 
 	// Start background metrics collection
 	go collector.collectMetrics()
 
-	// Set up HTTP routes
-	http.HandleFunc("/api/system/metrics", collector.handleMetrics)
-	http.HandleFunc("/api/system/health", collector.handleHealth)
+	// Stream samples to WebSocket clients
+	if *pushIntervalFlag < time.Second {
+		log.Fatalf("Invalid -push-interval %s: must be at least 1s", *pushIntervalFlag)
+	}
+	stream := NewMetricsStream(collector, *pushIntervalFlag)
+	collector.stream = stream
+	go stream.Run()
+
+	// Profiling stays off until asked for, over a listener of its own
+	pprofServer, err := NewPprofServer(*pprofAddrFlag, *pprofTokenFlag, *pprofTimeoutFlag)
+	if err != nil {
+		log.Fatalf("Invalid -pprof-addr: %v", err)
+	}
+	collector.pprof = pprofServer
+	go pprofServer.HandleSignals()
+	if *pprofFlag {
+		if err := pprofServer.Activate(); err != nil {
+			log.Fatalf("Failed to open the profiling listener: %v", err)
+		}
+	}
+
+	// Create downstream reachability prober
+	prober := NewProber(nodeID, ProbeConfig{
+		KafkaBrokers:   splitAddrList(*kafkaFlag),
+		ClickHouseAddr: splitAddrList(*clickhouseFlag),
+		ConfPath:       *confFlag,
+	})
+
+	// Create node inventory collector
+	inventory := NewInventoryCollector(nodeID)
+	go inventory.Get(false)
+
+	// Set up HTTP routes. They get a mux of their own: net/http/pprof registers on the
+	// default one, which must not be served on the public port.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/system/metrics", collector.handleMetrics)
+	mux.HandleFunc("/api/system/health", collector.handleHealth)
+	mux.HandleFunc("/api/system/probe", prober.handleProbe)
+	mux.HandleFunc("/api/system/inventory", inventory.handleInventory)
+	mux.HandleFunc("/api/system/top", handleTop(nodeID))
+	mux.HandleFunc("/api/system/metrics/history", func(w http.ResponseWriter, r *http.Request) {
+		if collector.buffer == nil {
+			http.Error(w, "Sample buffer disabled (-buffer-max-mb 0)", http.StatusNotFound)
+			return
+		}
+		collector.buffer.handleHistory(w, r)
+	})
+	mux.HandleFunc("/metrics", collector.handlePrometheus)
+	mux.HandleFunc("/ws", stream.handleWebSocket)
 
 	// Add health check for root path
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Add CORS headers to allow requests from main manager
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
-			"status":  "Node Metrics API is running",
-			"nodeId":  nodeID,
-			"version": "1.0.0",
+			"status":    "Node Metrics API is running",
+			"nodeId":    nodeID,
+			"version":   build.Version,
+			"commit":    build.Commit,
+			"buildDate": build.BuildDate,
 		})
 	})
 
@@ -487,9 +496,16 @@ func main() {
 	log.Printf("Server listening on port %s", portStr)
 	log.Printf("Metrics endpoint: http://0.0.0.0:%s/api/system/metrics", portStr)
 	log.Printf("Health endpoint: http://0.0.0.0:%s/api/system/health", portStr)
+	log.Printf("Probe endpoint: http://0.0.0.0:%s/api/system/probe?target=kafka|clickhouse", portStr)
+	log.Printf("Inventory endpoint: http://0.0.0.0:%s/api/system/inventory", portStr)
+	log.Printf("Top processes endpoint: http://0.0.0.0:%s/api/system/top?n=10", portStr)
+	log.Printf("Metrics history endpoint: http://0.0.0.0:%s/api/system/metrics/history?since=<RFC3339>", portStr)
+	log.Printf("Prometheus endpoint: http://0.0.0.0:%s/metrics", portStr)
+	log.Printf("Metrics stream: ws://0.0.0.0:%s/ws (every %s)", portStr, *pushIntervalFlag)
+	log.Printf("Profiling: kill -USR1 %d opens http://%s/debug/pprof/", os.Getpid(), *pprofAddrFlag)
 
 	// Explicitly bind to 0.0.0.0 to ensure IPv4 connectivity
-	if err := http.ListenAndServe("0.0.0.0:"+portStr, nil); err != nil {
+	if err := http.ListenAndServe("0.0.0.0:"+portStr, mux); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
\ No newline at end of file
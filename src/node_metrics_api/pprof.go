@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Profiling listener defaults
+const (
+	DefaultPprofAddr    = "127.0.0.1:6061"
+	DefaultPprofTimeout = 30 * time.Minute
+)
+
+// PprofStatus is the state of the profiling listener, part of /api/system/health
+type PprofStatus struct {
+	Active      bool       `json:"active"`
+	Addr        string     `json:"addr"`
+	Token       bool       `json:"token"` // requests need Authorization: Bearer <token>
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Activations uint64     `json:"activations"`
+}
+
+// PprofServer serves net/http/pprof on a listener of its own that is only open while
+// profiling is activated: with -pprof at start, or SIGUSR1 at runtime. SIGUSR2, or
+// -pprof-timeout after the last activation, closes it again, so a long-running agent
+// can be profiled without a rebuild or restart and exposes nothing the rest of the time.
+type PprofServer struct {
+	addr    string
+	token   string
+	timeout time.Duration
+	handler http.Handler
+
+	mutex       sync.Mutex
+	server      *http.Server
+	activatedAt time.Time
+	expiry      *time.Timer
+	activations uint64
+}
+
+// NewPprofServer creates the profiling listener. A token is required unless the address
+// is a loopback one, which only users logged in on the node can reach.
+func NewPprofServer(addr, token string, timeout time.Duration) (*PprofServer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s is reachable from other hosts, set -pprof-token", addr)
+	}
+
+	p := &PprofServer{addr: addr, token: token, timeout: timeout}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	p.handler = p.authorize(mux)
+	return p, nil
+}
+
+// authorize checks the bearer token, when one is set
+func (p *PprofServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.token != "" {
+			expected := "Bearer " + p.token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="node_metrics_api pprof"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Activate opens the listener if it is closed and restarts the timeout
+func (p *PprofServer) Activate() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.server == nil {
+		listener, err := net.Listen("tcp", p.addr)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: p.handler, ReadHeaderTimeout: 10 * time.Second}
+		p.server = server
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.Printf("Profiling listener on %s failed: %v", p.addr, err)
+			}
+		}()
+		log.Printf("Profiling enabled: http://%s/debug/pprof/", p.addr)
+	}
+	p.activatedAt = time.Now()
+	p.activations++
+	if p.expiry != nil {
+		p.expiry.Stop()
+		p.expiry = nil
+	}
+	if p.timeout > 0 {
+		p.expiry = time.AfterFunc(p.timeout, func() {
+			log.Printf("Profiling timed out after %s", p.timeout)
+			p.Deactivate()
+		})
+	}
+	return nil
+}
+
+// Deactivate closes the listener; profiles being written are cut off
+func (p *PprofServer) Deactivate() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.expiry != nil {
+		p.expiry.Stop()
+		p.expiry = nil
+	}
+	if p.server == nil {
+		return
+	}
+	p.server.Close()
+	p.server = nil
+	log.Printf("Profiling disabled, %s closed", p.addr)
+}
+
+// HandleSignals activates profiling on SIGUSR1 and deactivates it on SIGUSR2
+func (p *PprofServer) HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range signals {
+		if sig == syscall.SIGUSR2 {
+			p.Deactivate()
+			continue
+		}
+		if err := p.Activate(); err != nil {
+			log.Printf("Failed to enable profiling on %s: %v", p.addr, err)
+		}
+	}
+}
+
+// Status returns whether the listener is open and until when
+func (p *PprofServer) Status() PprofStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	status := PprofStatus{Active: p.server != nil, Addr: p.addr, Token: p.token != "", Activations: p.activations}
+	if status.Active {
+		activatedAt := p.activatedAt.UTC()
+		status.ActivatedAt = &activatedAt
+		if p.timeout > 0 {
+			expiresAt := activatedAt.Add(p.timeout)
+			status.ExpiresAt = &expiresAt
+		}
+	}
+	return status
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Probe configuration
+const (
+	DefaultProbeTimeout = 3 * time.Second
+	DefaultConfPath     = "../conf.d/conf.yml"
+)
+
+// ProbeConfig holds the downstream addresses the agent probes from the node's network
+type ProbeConfig struct {
+	KafkaBrokers   []string
+	KafkaTLS       bool
+	ClickHouseAddr []string
+	ConfPath       string
+}
+
+// ProbeCheck is the result of probing a single address
+type ProbeCheck struct {
+	Address   string  `json:"address"`
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latency_ms"`
+	TLS       bool    `json:"tls,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ProbeResult is the response of /api/system/probe
+type ProbeResult struct {
+	NodeID    string       `json:"nodeId"`
+	Target    string       `json:"target"`
+	Reachable bool         `json:"reachable"`
+	Checks    []ProbeCheck `json:"checks"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// Prober runs reachability checks against Kafka and ClickHouse
+type Prober struct {
+	config ProbeConfig
+	nodeID string
+}
+
+// NewProber creates a prober, falling back to the simulator's conf.yml for Kafka brokers
+func NewProber(nodeID string, config ProbeConfig) *Prober {
+	if len(config.KafkaBrokers) == 0 && config.ConfPath != "" {
+		brokers, useTLS, err := readKafkaOutputFromConf(config.ConfPath)
+		if err != nil {
+			log.Printf("Warning: could not read Kafka brokers from %s: %v", config.ConfPath, err)
+		} else {
+			config.KafkaBrokers = brokers
+			config.KafkaTLS = useTLS
+		}
+	}
+	return &Prober{config: config, nodeID: nodeID}
+}
+
+// Probe checks every configured address of the target ("kafka" or "clickhouse").
+// overrides narrow the check to some of the configured addresses; any other address is
+// refused so the endpoint cannot be used to dial arbitrary hosts from the node.
+func (p *Prober) Probe(target string, overrides []string, timeout time.Duration) (*ProbeResult, error) {
+	var addrs []string
+	useTLS := false
+
+	switch target {
+	case "kafka":
+		addrs = p.config.KafkaBrokers
+		useTLS = p.config.KafkaTLS
+	case "clickhouse":
+		addrs = p.config.ClickHouseAddr
+	default:
+		return nil, fmt.Errorf("unknown probe target %q (expected kafka or clickhouse)", target)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no %s addresses configured on this node", target)
+	}
+	if len(overrides) > 0 {
+		for _, addr := range overrides {
+			if !slices.Contains(addrs, addr) {
+				return nil, fmt.Errorf("%s is not a configured %s address (configured: %s)", addr, target, strings.Join(addrs, ", "))
+			}
+		}
+		addrs = overrides
+	}
+
+	result := &ProbeResult{
+		NodeID:    p.nodeID,
+		Target:    target,
+		Reachable: true,
+		Timestamp: time.Now().UTC(),
+	}
+	for _, addr := range addrs {
+		check := probeAddress(addr, useTLS, timeout)
+		if target == "clickhouse" && check.Reachable && isClickHouseHTTPPort(addr) {
+			checkClickHousePing(&check, timeout)
+		}
+		if !check.Reachable {
+			result.Reachable = false
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result, nil
+}
+
+// probeAddress dials the address and, for TLS listeners, completes a handshake
+func probeAddress(addr string, useTLS bool, timeout time.Duration) ProbeCheck {
+	check := ProbeCheck{Address: addr, TLS: useTLS}
+	start := time.Now()
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	defer conn.Close()
+
+	if useTLS {
+		// Brokers are configured with ssl_verification_mode: no_verify, so only
+		// the handshake itself is checked here
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			check.Error = fmt.Sprintf("TLS handshake failed: %v", err)
+			check.LatencyMs = msSince(start)
+			return check
+		}
+	}
+
+	check.Reachable = true
+	check.LatencyMs = msSince(start)
+	return check
+}
+
+// isClickHouseHTTPPort reports whether the address points at the ClickHouse HTTP interface
+func isClickHouseHTTPPort(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && (port == "8123" || port == "8443")
+}
+
+// checkClickHousePing hits /ping on the ClickHouse HTTP interface, over HTTPS on 8443
+func checkClickHousePing(check *ProbeCheck, timeout time.Duration) {
+	scheme := "http"
+	client := &http.Client{Timeout: timeout}
+	if _, port, _ := net.SplitHostPort(check.Address); port == "8443" {
+		// As for the Kafka brokers, only reachability is checked, not the certificate
+		scheme = "https"
+		check.TLS = true
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Get(scheme + "://" + check.Address + "/ping")
+	if err != nil {
+		check.Reachable = false
+		check.Error = fmt.Sprintf("ping failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check.Reachable = false
+		check.Error = fmt.Sprintf("ping returned HTTP %d", resp.StatusCode)
+	}
+}
+
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// readKafkaOutputFromConf extracts output.kafka hosts and ssl from the simulator's conf.yml.
+// The agent has no YAML dependency, so only the simple block layout used by conf.yml is understood.
+func readKafkaOutputFromConf(path string) ([]string, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	var hosts []string
+	useTLS := false
+	inKafka, inHosts := false, false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// A top-level key ends the current block
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inKafka = trimmed == "output.kafka:"
+			inHosts = false
+			continue
+		}
+		if !inKafka {
+			continue
+		}
+
+		switch {
+		case trimmed == "hosts:":
+			inHosts = true
+		case inHosts && strings.HasPrefix(trimmed, "- "):
+			hosts = append(hosts, strings.Trim(strings.TrimSpace(trimmed[2:]), `"'`))
+		default:
+			inHosts = false
+			if strings.HasPrefix(trimmed, "ssl:") {
+				useTLS = strings.TrimSpace(strings.TrimPrefix(trimmed, "ssl:")) == "true"
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(hosts) == 0 {
+		return nil, false, fmt.Errorf("no output.kafka hosts found")
+	}
+	return hosts, useTLS, nil
+}
+
+// splitAddrList splits a comma separated address list, dropping empty entries
+func splitAddrList(value string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// HTTP handler for /api/system/probe?target=kafka|clickhouse[&addr=host:port,...][&timeout=3s]
+func (p *Prober) handleProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Content-Type", "application/json")
+
+	target := r.URL.Query().Get("target")
+	timeout := DefaultProbeTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		parsed, err := time.ParseDuration(t)
+		if err != nil || parsed <= 0 || parsed > 30*time.Second {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "timeout must be a duration between 0 and 30s"})
+			return
+		}
+		timeout = parsed
+	}
+
+	result, err := p.Probe(target, splitAddrList(r.URL.Query().Get("addr")), timeout)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding probe JSON: %v", err)
+	}
+	log.Printf("Probe %s from node %s: reachable=%v", target, p.nodeID, result.Reachable)
+}
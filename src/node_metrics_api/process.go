@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SimulatorName is the process name of the simulator binary
+const SimulatorName = "finalvudatasim"
+
+// userHZ is the unit of the tick counts in /proc/<pid>/stat. The kernel exports it as
+// 100 on every architecture the nodes run, whatever CONFIG_HZ is.
+const userHZ = 100
+
+// ProcessIO is the I/O of a process since it started, from /proc/<pid>/io
+type ProcessIO struct {
+	ReadBytes     uint64 `json:"read_bytes"`  // fetched from storage
+	WriteBytes    uint64 `json:"write_bytes"` // sent to storage
+	ReadChars     uint64 `json:"read_chars"`  // passed to read(2) and the like, including sockets
+	WriteChars    uint64 `json:"write_chars"`
+	ReadSyscalls  uint64 `json:"read_syscalls"`
+	WriteSyscalls uint64 `json:"write_syscalls"`
+}
+
+// cpuTicks is a process's CPU time at a point of the aggregate /proc/stat counters, kept
+// between samples to turn the counters into a current usage
+type cpuTicks struct {
+	pid     int
+	process uint64
+	total   uint64
+}
+
+// findSimulator returns the PID and /proc/<pid>/stat of the finalvudatasim binary. Shells
+// and kill timers that only mention it on their command line are skipped; if several
+// copies run, the one that used the most CPU is taken.
+func findSimulator() (int, procSample, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, procSample{}, err
+	}
+	self := os.Getpid()
+	var found int
+	var best procSample
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue // the process exited meanwhile
+		}
+		sample, ok := parseProcStat(string(data))
+		if !ok || !isSimulator(pid, sample.name) {
+			continue
+		}
+		if found == 0 || sample.ticks > best.ticks {
+			found, best = pid, sample
+		}
+	}
+	return found, best, nil
+}
+
+// knownSimulator re-reads the simulator found by the previous sample, which spares the
+// scan of /proc while it keeps running
+func knownSimulator(pid int) (int, procSample, bool) {
+	if pid == 0 {
+		return 0, procSample{}, false
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, procSample{}, false
+	}
+	sample, ok := parseProcStat(string(data))
+	if !ok || !isSimulator(pid, sample.name) {
+		return 0, procSample{}, false // exited, or the PID was reused
+	}
+	return pid, sample, true
+}
+
+// isSimulator reports whether the process is the simulator binary itself: its name, or
+// the program of its command line when the name was changed
+func isSimulator(pid int, name string) bool {
+	if name == SimulatorName {
+		return true
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return false
+	}
+	program, _, _ := strings.Cut(string(data), "\x00")
+	return filepath.Base(program) == SimulatorName
+}
+
+// readBootTime returns the boot time from the btime line of /proc/stat
+func readBootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no btime in /proc/stat")
+}
+
+// countOpenFDs counts the entries of /proc/<pid>/fd, readable for our own user and root
+func countOpenFDs(pid int) (int, error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// readProcessIO parses /proc/<pid>/io, readable for our own user and root
+func readProcessIO(pid int) (*ProcessIO, error) {
+	values, err := readKeyValueFile(fmt.Sprintf("/proc/%d/io", pid), ":")
+	if err != nil {
+		return nil, err
+	}
+	counter := func(key string) uint64 {
+		value, _ := strconv.ParseUint(values[key], 10, 64)
+		return value
+	}
+	return &ProcessIO{
+		ReadBytes:     counter("read_bytes"),
+		WriteBytes:    counter("write_bytes"),
+		ReadChars:     counter("rchar"),
+		WriteChars:    counter("wchar"),
+		ReadSyscalls:  counter("syscr"),
+		WriteSyscalls: counter("syscw"),
+	}, nil
+}
+
+// collectProcess fills the simulator's metrics from /proc. CPU is the share of the
+// machine's ticks it used since the previous sample, 100 per fully used core; the first
+// sample of a PID has nothing to compare with and reports the average since it started.
+func (mc *MetricsCollector) collectProcess(metrics *FinalVuDataSimMetrics, totalTicks uint64, cores int) {
+	pid, sample, ok := knownSimulator(mc.currentMetrics.PID)
+	if !ok {
+		var err error
+		if pid, sample, err = findSimulator(); err != nil {
+			mc.self.recordError("/proc", err)
+			return
+		}
+	}
+	if pid == 0 {
+		mc.lastProcessTicks = cpuTicks{}
+		return
+	}
+
+	metrics.Running = true
+	metrics.PID = pid
+	metrics.Threads = sample.threads
+	metrics.MemMB = float64(sample.rssPages) * float64(os.Getpagesize()) / (1024 * 1024)
+	metrics.Cmdline = processCmdline(pid)
+
+	started := time.Time{}
+	if bootTime, err := readBootTime(); err != nil {
+		mc.self.recordError("/proc/stat", err)
+	} else {
+		started = bootTime.Add(time.Duration(sample.startTicks) * time.Second / userHZ)
+		metrics.StartTime = started.Local().Format(processStartLayout)
+	}
+
+	previous := mc.lastProcessTicks
+	switch {
+	case previous.pid == pid && totalTicks > previous.total && sample.ticks >= previous.process:
+		// /proc/stat counts ticks over all cores, so scale to 100 per core
+		metrics.CPUPercent = float64(sample.ticks-previous.process) / float64(totalTicks-previous.total) * 100 * float64(cores)
+	case !started.IsZero():
+		if lifetime := time.Since(started).Seconds(); lifetime > 0 {
+			metrics.CPUPercent = float64(sample.ticks) / userHZ / lifetime * 100
+		}
+	}
+	metrics.CPUPercent = round2(metrics.CPUPercent)
+	mc.lastProcessTicks = cpuTicks{pid: pid, process: sample.ticks, total: totalTicks}
+
+	if fds, err := countOpenFDs(pid); err != nil {
+		mc.self.recordError("/proc/<pid>/fd", err)
+	} else {
+		metrics.OpenFDs = fds
+	}
+	if io, err := readProcessIO(pid); err != nil {
+		mc.self.recordError("/proc/<pid>/io", err)
+	} else {
+		metrics.IO = io
+	}
+}
+
+// readDiskUsage returns the total, used and available size of the filesystem of path in
+// GB, counted like df: the blocks reserved for root are neither used nor free
+func readDiskUsage(path string) (total, used, free float64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, 0, err
+	}
+	gb := float64(stat.Bsize) / (1024 * 1024 * 1024)
+	total = round2(float64(stat.Blocks) * gb)
+	used = round2(float64(stat.Blocks-stat.Bfree) * gb)
+	free = round2(float64(stat.Bavail) * gb)
+	return total, used, free, nil
+}
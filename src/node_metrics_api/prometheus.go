@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrometheusContentType is the text exposition format served on /metrics
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Process states, the state label of vudatasim_process_state
+var processStates = []string{"running", "stopped"}
+
+// processStartLayout is how ps -o lstart= prints the start of a process
+const processStartLayout = "Mon Jan _2 15:04:05 2006"
+
+// promLabel is one name="value" pair of a series
+type promLabel struct {
+	name  string
+	value string
+}
+
+// promWriter renders metric families in the Prometheus text exposition format
+type promWriter struct {
+	buf    bytes.Buffer
+	nodeID string
+}
+
+// family starts a metric family with its HELP and TYPE lines
+func (p *promWriter) family(name, kind, help string) {
+	fmt.Fprintf(&p.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one series of the current family, labelled with the node ID first
+func (p *promWriter) sample(name string, value float64, labels ...promLabel) {
+	p.buf.WriteString(name)
+	p.buf.WriteString(`{node_id="`)
+	p.buf.WriteString(escapeLabelValue(p.nodeID))
+	p.buf.WriteByte('"')
+	for _, label := range labels {
+		fmt.Fprintf(&p.buf, `,%s="%s"`, label.name, escapeLabelValue(label.value))
+	}
+	p.buf.WriteString("} ")
+	p.buf.WriteString(formatPromValue(value))
+	p.buf.WriteByte('\n')
+}
+
+// gauge writes a family with a single series
+func (p *promWriter) gauge(name, help string, value float64, labels ...promLabel) {
+	p.family(name, "gauge", help)
+	p.sample(name, value, labels...)
+}
+
+// counter writes a counter family with a single series; name ends in _total
+func (p *promWriter) counter(name, help string, value float64, labels ...promLabel) {
+	p.family(name, "counter", help)
+	p.sample(name, value, labels...)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatPromValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case value == 0:
+		return "0" // not -0 from rounding a tiny negative age
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// mb converts the MB values of the collector to bytes, the Prometheus base unit
+func mb(value float64) float64 { return value * 1024 * 1024 }
+
+// gb converts the GB values of the collector to bytes
+func gb(value float64) float64 { return value * 1024 * 1024 * 1024 }
+
+// renderPrometheus renders the latest process and system metrics. Sections that were
+// never collected are left out rather than reported as zero.
+func (mc *MetricsCollector) renderPrometheus(now time.Time) []byte {
+	metrics := mc.GetCurrentMetrics()
+	sysMetrics := mc.GetCurrentSystemMetrics()
+	lastExit := mc.GetLastExit()
+	build := agentBuild()
+	p := &promWriter{nodeID: mc.nodeID}
+
+	p.gauge("vudatasim_agent_info", "Build of the node metrics agent, always 1", 1,
+		promLabel{"version", build.Version}, promLabel{"commit", build.Commit}, promLabel{"go_version", build.GoVersion})
+
+	collectors := mc.collectorStates(now)
+	processAge, processStale := sectionFreshness(collectors, []string{CollectorProcess})
+	systemAge, systemStale := sectionFreshness(collectors, systemCollectors)
+	p.family("vudatasim_sample_age_seconds", "gauge", "Age of the last collected sample, -1 before the first one")
+	p.sample("vudatasim_sample_age_seconds", processAge, promLabel{"section", "process"})
+	p.sample("vudatasim_sample_age_seconds", systemAge, promLabel{"section", "system"})
+	p.family("vudatasim_sample_stale", "gauge", "Whether the last sample is older than --stale-after (1) or not (0)")
+	p.sample("vudatasim_sample_stale", boolValue(processStale), promLabel{"section", "process"})
+	p.sample("vudatasim_sample_stale", boolValue(systemStale), promLabel{"section", "system"})
+	names := collectorNames(collectors)
+	p.family("vudatasim_collector_interval_seconds", "gauge", "How often each collector samples")
+	for _, name := range names {
+		p.sample("vudatasim_collector_interval_seconds", collectors[name].IntervalSeconds, promLabel{"collector", name})
+	}
+	p.family("vudatasim_collector_age_seconds", "gauge", "Time since each collector last sampled, -1 before the first time")
+	for _, name := range names {
+		p.sample("vudatasim_collector_age_seconds", collectors[name].AgeSeconds, promLabel{"collector", name})
+	}
+
+	if !metrics.Timestamp.IsZero() {
+		state := "stopped"
+		if metrics.Running {
+			state = "running"
+		}
+		p.family("vudatasim_process_state", "gauge", "State of the finalvudatasim process, 1 for the current state")
+		for _, s := range processStates {
+			p.sample("vudatasim_process_state", boolValue(s == state), promLabel{"state", s})
+		}
+		if metrics.Running {
+			p.gauge("vudatasim_process_pid", "PID of finalvudatasim", float64(metrics.PID), promLabel{"state", state})
+			p.gauge("vudatasim_process_cpu_percent", "CPU used by finalvudatasim, 100 per fully used core", metrics.CPUPercent, promLabel{"state", state})
+			p.gauge("vudatasim_process_resident_memory_bytes", "Resident memory of finalvudatasim", mb(metrics.MemMB), promLabel{"state", state})
+			if started, err := time.ParseInLocation(processStartLayout, metrics.StartTime, time.Local); err == nil {
+				p.gauge("vudatasim_process_start_time_seconds", "Start of finalvudatasim as a Unix timestamp", float64(started.Unix()), promLabel{"state", state})
+			}
+			p.gauge("vudatasim_process_threads", "Threads of finalvudatasim", float64(metrics.Threads), promLabel{"state", state})
+			if metrics.OpenFDs > 0 {
+				p.gauge("vudatasim_process_open_fds", "Open file descriptors of finalvudatasim", float64(metrics.OpenFDs), promLabel{"state", state})
+			}
+			if metrics.IO != nil {
+				p.counter("vudatasim_process_io_read_bytes_total", "Bytes finalvudatasim read from storage", float64(metrics.IO.ReadBytes), promLabel{"state", state})
+				p.counter("vudatasim_process_io_write_bytes_total", "Bytes finalvudatasim wrote to storage", float64(metrics.IO.WriteBytes), promLabel{"state", state})
+				p.counter("vudatasim_process_io_read_chars_total", "Bytes finalvudatasim passed to read calls, sockets included", float64(metrics.IO.ReadChars), promLabel{"state", state})
+				p.counter("vudatasim_process_io_write_chars_total", "Bytes finalvudatasim passed to write calls, sockets included", float64(metrics.IO.WriteChars), promLabel{"state", state})
+			}
+		}
+	}
+	if lastExit != nil {
+		p.gauge("vudatasim_process_last_exit_timestamp_seconds", "When finalvudatasim last exited, as a Unix timestamp, with the reason read from the kernel log",
+			float64(lastExit.ExitedAt.Unix()), promLabel{"reason", lastExit.Reason})
+	}
+
+	if !sysMetrics.Timestamp.IsZero() {
+		p.gauge("vudatasim_node_cpu_usage_percent", "CPU usage of the node", sysMetrics.CPUUsage)
+		p.gauge("vudatasim_node_cpu_cores", "CPU cores of the node", float64(sysMetrics.CPUCores))
+		p.gauge("vudatasim_node_memory_total_bytes", "Total memory of the node", mb(sysMetrics.MemTotal))
+		p.gauge("vudatasim_node_memory_used_bytes", "Used memory of the node", mb(sysMetrics.MemUsed))
+		p.gauge("vudatasim_node_memory_free_bytes", "Free memory of the node", mb(sysMetrics.MemFree))
+		p.gauge("vudatasim_node_disk_total_bytes", "Size of the root filesystem", gb(sysMetrics.DiskTotal))
+		p.gauge("vudatasim_node_disk_used_bytes", "Used space on the root filesystem", gb(sysMetrics.DiskUsed))
+		p.gauge("vudatasim_node_disk_free_bytes", "Free space on the root filesystem", gb(sysMetrics.DiskFree))
+		p.gauge("vudatasim_node_load1", "1 minute load average", sysMetrics.LoadAvg1)
+		p.gauge("vudatasim_node_load5", "5 minute load average", sysMetrics.LoadAvg5)
+		p.gauge("vudatasim_node_load15", "15 minute load average", sysMetrics.LoadAvg15)
+		p.gauge("vudatasim_node_uptime_seconds", "Time since the node booted", sysMetrics.UptimeSecs)
+		p.counter("vudatasim_node_network_receive_bytes_total", "Bytes received on all non-loopback interfaces since boot", float64(sysMetrics.NetRxBytes))
+		p.counter("vudatasim_node_network_transmit_bytes_total", "Bytes sent on all non-loopback interfaces since boot", float64(sysMetrics.NetTxBytes))
+	}
+	return p.buf.Bytes()
+}
+
+// HTTP handler for /metrics
+func (mc *MetricsCollector) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", PrometheusContentType)
+	if _, err := w.Write(mc.renderPrometheus(time.Now())); err != nil {
+		log.Printf("Error writing Prometheus metrics: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The agent build, set at build time with -ldflags "-X main.AgentVersion=<version>
+// -X main.AgentCommit=<sha> -X main.AgentBuildDate=<RFC3339>". Without them the commit
+// and date recorded by the Go toolchain are used when there are any.
+var (
+	AgentVersion   = "1.0.0"
+	AgentCommit    = ""
+	AgentBuildDate = ""
+)
+
+// AgentBuild identifies the agent binary, printed by -version and part of the health
+type AgentBuild struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// agentBuild returns the build of the running binary
+func agentBuild() AgentBuild {
+	build := AgentBuild{Version: AgentVersion, Commit: AgentCommit, BuildDate: AgentBuildDate, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && build.Commit == "":
+				build.Commit = setting.Value
+			case setting.Key == "vcs.time" && build.BuildDate == "":
+				build.BuildDate = setting.Value
+			}
+		}
+	}
+	return build
+}
+
+// MaxCollectionErrors is how many distinct recent collection errors the agent keeps
+const MaxCollectionErrors = 20
+
+// CollectionError is a failure of one metrics source, counted while it repeats
+type CollectionError struct {
+	Source  string    `json:"source"` // e.g. /proc/stat, statfs /, /proc/<pid>/io
+	Message string    `json:"message"`
+	Count   int       `json:"count"`
+	FirstAt time.Time `json:"first_at"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// SamplingLoopStats describes how long the collection loop takes per sample
+type SamplingLoopStats struct {
+	IntervalMs float64 `json:"interval_ms"`
+	Samples    uint64  `json:"samples"`
+	LastMs     float64 `json:"last_ms"`
+	AvgMs      float64 `json:"avg_ms"`
+	MaxMs      float64 `json:"max_ms"`
+	Overruns   uint64  `json:"overruns"` // samples that took longer than the interval
+	LastAt     string  `json:"last_at,omitempty"`
+}
+
+// AgentMemory is the agent's own memory use
+type AgentMemory struct {
+	RSSMB       float64 `json:"rss_mb"`
+	HeapAllocMB float64 `json:"heap_alloc_mb"`
+	SysMB       float64 `json:"sys_mb"` // obtained from the OS by the Go runtime
+	Goroutines  int     `json:"goroutines"`
+	GCCycles    uint32  `json:"gc_cycles"`
+}
+
+// AgentSelf is the agent section of /api/system/health
+type AgentSelf struct {
+	Version               string            `json:"version"`
+	Commit                string            `json:"commit,omitempty"`
+	BuildDate             string            `json:"build_date,omitempty"`
+	GoVersion             string            `json:"go_version"`
+	StartedAt             time.Time         `json:"started_at"`
+	UptimeSeconds         float64           `json:"uptime_seconds"`
+	SamplingLoop          SamplingLoopStats `json:"sampling_loop"`
+	Memory                AgentMemory       `json:"memory"`
+	CollectionErrorsTotal uint64            `json:"collection_errors_total"`
+	CollectionErrors      []CollectionError `json:"collection_errors"` // most recent last
+}
+
+// AgentStats tracks the agent's own health next to the metrics it collects
+type AgentStats struct {
+	mutex       sync.Mutex
+	startedAt   time.Time
+	interval    time.Duration
+	samples     uint64
+	lastLoop    time.Duration
+	totalLoop   time.Duration
+	maxLoop     time.Duration
+	overruns    uint64
+	lastLoopAt  time.Time
+	errorsTotal uint64
+	errors      []CollectionError
+}
+
+// NewAgentStats starts tracking an agent that samples every interval
+func NewAgentStats(interval time.Duration) *AgentStats {
+	return &AgentStats{startedAt: time.Now(), interval: interval}
+}
+
+// recordLoop records the duration of one collection pass
+func (s *AgentStats) recordLoop(duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samples++
+	s.lastLoop = duration
+	s.totalLoop += duration
+	s.lastLoopAt = time.Now()
+	if duration > s.maxLoop {
+		s.maxLoop = duration
+	}
+	if duration > s.interval {
+		s.overruns++
+	}
+}
+
+// recordError records a failed read of a metrics source. Repeats of the last error of
+// the same source are counted instead of listed again.
+func (s *AgentStats) recordError(source string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	s.errorsTotal++
+	message := err.Error()
+	for i := range s.errors {
+		if s.errors[i].Source == source && s.errors[i].Message == message {
+			entry := s.errors[i]
+			entry.Count++
+			entry.LastAt = now
+			// Move it to the end so the list stays ordered by last occurrence
+			s.errors = append(append(s.errors[:i], s.errors[i+1:]...), entry)
+			return
+		}
+	}
+	s.errors = append(s.errors, CollectionError{Source: source, Message: message, Count: 1, FirstAt: now, LastAt: now})
+	if len(s.errors) > MaxCollectionErrors {
+		s.errors = s.errors[len(s.errors)-MaxCollectionErrors:]
+	}
+}
+
+// Snapshot returns the agent's version, uptime, loop latency, memory and errors
+func (s *AgentStats) Snapshot() AgentSelf {
+	build := agentBuild()
+	s.mutex.Lock()
+	self := AgentSelf{
+		Version:       build.Version,
+		Commit:        build.Commit,
+		BuildDate:     build.BuildDate,
+		GoVersion:     build.GoVersion,
+		StartedAt:     s.startedAt.UTC(),
+		UptimeSeconds: round2(time.Since(s.startedAt).Seconds()),
+		SamplingLoop: SamplingLoopStats{
+			IntervalMs: durationMs(s.interval),
+			Samples:    s.samples,
+			LastMs:     durationMs(s.lastLoop),
+			MaxMs:      durationMs(s.maxLoop),
+			Overruns:   s.overruns,
+		},
+		CollectionErrorsTotal: s.errorsTotal,
+		CollectionErrors:      append([]CollectionError{}, s.errors...),
+	}
+	if s.samples > 0 {
+		self.SamplingLoop.AvgMs = durationMs(s.totalLoop / time.Duration(s.samples))
+		self.SamplingLoop.LastAt = s.lastLoopAt.UTC().Format(time.RFC3339)
+	}
+	s.mutex.Unlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	self.Memory = AgentMemory{
+		RSSMB:       selfRSSMB(),
+		HeapAllocMB: round2(float64(mem.HeapAlloc) / (1024 * 1024)),
+		SysMB:       round2(float64(mem.Sys) / (1024 * 1024)),
+		Goroutines:  runtime.NumGoroutine(),
+		GCCycles:    mem.NumGC,
+	}
+	return self
+}
+
+// selfRSSMB reads the agent's resident set size from /proc/self/statm
+func selfRSSMB() float64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, _ := strconv.ParseInt(fields[1], 10, 64)
+	return round2(float64(pages*int64(os.Getpagesize())) / (1024 * 1024))
+}
+
+func durationMs(d time.Duration) float64 {
+	return round2(float64(d) / float64(time.Millisecond))
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output sink defaults
+const (
+	DefaultOutputMaxMB   = 100
+	OutputKeepFiles      = 5 // rotated output files kept next to the current one
+	DefaultStatsdPrefix  = "vudatasim.node"
+	DefaultOTLPInterval  = 10 * time.Second
+	OTLPTimeout          = 5 * time.Second
+	OTLPMaxPending       = 3600 // samples kept for the next push while the endpoint is down
+	sinkQueueSize        = 256
+	statsdMaxPacketBytes = 1400
+)
+
+// SinkConfig selects where samples are written besides being served over HTTP
+type SinkConfig struct {
+	OutputFile   string        // CSV or NDJSON file the samples are appended to
+	OutputFormat string        // csv or ndjson; empty picks csv for a .csv file and ndjson otherwise
+	OutputMaxMB  int           // the file is rotated beyond this size, 0 never rotates
+	StatsdAddr   string        // statsd host:port the samples are sent to as gauges over UDP
+	StatsdPrefix string        // metric name prefix, the node ID is appended
+	OTLPEndpoint string        // OTLP/HTTP metrics URL, e.g. http://collector:4318/v1/metrics
+	OTLPInterval time.Duration // how often samples are pushed to the OTLP endpoint
+}
+
+// Sample is one collection pass as written to the sinks. Field names match
+// /api/system/metrics so files from several nodes can be merged with the served data.
+type Sample struct {
+	Timestamp         time.Time `json:"timestamp"`
+	NodeID            string    `json:"nodeId"`
+	ProcessRunning    bool      `json:"process_running"`
+	ProcessPID        int       `json:"process_pid"`
+	ProcessCPUPercent float64   `json:"process_cpu_percent"`
+	ProcessMemMB      float64   `json:"process_mem_mb"`
+	CPUUsage          float64   `json:"cpu_usage"`
+	CPUCores          int       `json:"cpu_cores"`
+	MemTotal          float64   `json:"mem_total_mb"`
+	MemUsed           float64   `json:"mem_used_mb"`
+	MemFree           float64   `json:"mem_free_mb"`
+	DiskTotal         float64   `json:"disk_total_gb"`
+	DiskUsed          float64   `json:"disk_used_gb"`
+	DiskFree          float64   `json:"disk_free_gb"`
+	LoadAvg1          float64   `json:"load_avg_1"`
+	LoadAvg5          float64   `json:"load_avg_5"`
+	LoadAvg15         float64   `json:"load_avg_15"`
+	NetRxBytes        uint64    `json:"net_rx_bytes"`
+	NetTxBytes        uint64    `json:"net_tx_bytes"`
+}
+
+// sampleColumns is the CSV header, in the order of Sample.record
+var sampleColumns = []string{
+	"timestamp", "nodeId", "process_running", "process_pid", "process_cpu_percent", "process_mem_mb",
+	"cpu_usage", "cpu_cores", "mem_total_mb", "mem_used_mb", "mem_free_mb",
+	"disk_total_gb", "disk_used_gb", "disk_free_gb", "load_avg_1", "load_avg_5", "load_avg_15",
+	"net_rx_bytes", "net_tx_bytes",
+}
+
+// record returns the sample as a CSV row
+func (s Sample) record() []string {
+	float := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		s.Timestamp.UTC().Format(time.RFC3339Nano), s.NodeID, strconv.FormatBool(s.ProcessRunning),
+		strconv.Itoa(s.ProcessPID), float(s.ProcessCPUPercent), float(s.ProcessMemMB),
+		float(s.CPUUsage), strconv.Itoa(s.CPUCores), float(s.MemTotal), float(s.MemUsed), float(s.MemFree),
+		float(s.DiskTotal), float(s.DiskUsed), float(s.DiskFree), float(s.LoadAvg1), float(s.LoadAvg5), float(s.LoadAvg15),
+		strconv.FormatUint(s.NetRxBytes, 10), strconv.FormatUint(s.NetTxBytes, 10),
+	}
+}
+
+// sampleGauge is one numeric value of a sample, as pushed to statsd and OTLP
+type sampleGauge struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// gauges returns the numeric values of the sample; process_running is 1 or 0
+func (s Sample) gauges() []sampleGauge {
+	running := 0.0
+	if s.ProcessRunning {
+		running = 1
+	}
+	return []sampleGauge{
+		{"process_running", "1", running},
+		{"process_cpu_percent", "%", s.ProcessCPUPercent},
+		{"process_mem_mb", "MBy", s.ProcessMemMB},
+		{"cpu_usage", "%", s.CPUUsage},
+		{"cpu_cores", "1", float64(s.CPUCores)},
+		{"mem_total_mb", "MBy", s.MemTotal},
+		{"mem_used_mb", "MBy", s.MemUsed},
+		{"mem_free_mb", "MBy", s.MemFree},
+		{"disk_total_gb", "GBy", s.DiskTotal},
+		{"disk_used_gb", "GBy", s.DiskUsed},
+		{"disk_free_gb", "GBy", s.DiskFree},
+		{"load_avg_1", "1", s.LoadAvg1},
+		{"load_avg_5", "1", s.LoadAvg5},
+		{"load_avg_15", "1", s.LoadAvg15},
+		{"net_rx_bytes", "By", float64(s.NetRxBytes)},
+		{"net_tx_bytes", "By", float64(s.NetTxBytes)},
+	}
+}
+
+// currentSample returns the latest collection pass as a sample
+func (mc *MetricsCollector) currentSample() Sample {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	process, system := mc.currentMetrics, mc.currentSysMetrics
+	return Sample{
+		Timestamp:         system.Timestamp,
+		NodeID:            mc.nodeID,
+		ProcessRunning:    process.Running,
+		ProcessPID:        process.PID,
+		ProcessCPUPercent: process.CPUPercent,
+		ProcessMemMB:      process.MemMB,
+		CPUUsage:          system.CPUUsage,
+		CPUCores:          system.CPUCores,
+		MemTotal:          system.MemTotal,
+		MemUsed:           system.MemUsed,
+		MemFree:           system.MemFree,
+		DiskTotal:         system.DiskTotal,
+		DiskUsed:          system.DiskUsed,
+		DiskFree:          system.DiskFree,
+		LoadAvg1:          system.LoadAvg1,
+		LoadAvg5:          system.LoadAvg5,
+		LoadAvg15:         system.LoadAvg15,
+		NetRxBytes:        system.NetRxBytes,
+		NetTxBytes:        system.NetTxBytes,
+	}
+}
+
+// Sink receives the collected samples
+type Sink interface {
+	Name() string
+	Target() string
+	Write(samples []Sample) error
+}
+
+// SinkStatus is the state of one sink, part of /api/system/health
+type SinkStatus struct {
+	Name        string `json:"name"`
+	Target      string `json:"target"`
+	Written     uint64 `json:"written"`
+	Dropped     uint64 `json:"dropped"` // queue full, or given up after failed pushes
+	Failures    uint64 `json:"failures"`
+	Pending     int    `json:"pending"` // waiting for the next push
+	LastWriteAt string `json:"last_write_at,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	LastErrorAt string `json:"last_error_at,omitempty"`
+}
+
+// sinkRunner feeds one sink from its own queue so a slow or unreachable sink never
+// holds up collection or the other sinks
+type sinkRunner struct {
+	sink       Sink
+	queue      chan Sample
+	flushEvery time.Duration // 0 writes every sample as it arrives
+	maxPending int           // samples kept after a failed write, 0 drops them
+	self       *AgentStats
+	mutex      sync.Mutex
+	status     SinkStatus
+	pending    []Sample
+}
+
+// SinkSet fans the collected samples out to the configured sinks
+type SinkSet struct {
+	runners []*sinkRunner
+}
+
+// NewSinkSet opens the sinks selected in config; it returns nil when none is
+func NewSinkSet(nodeID string, config SinkConfig, self *AgentStats) (*SinkSet, error) {
+	set := &SinkSet{}
+	add := func(sink Sink, flushEvery time.Duration, maxPending int) {
+		set.runners = append(set.runners, &sinkRunner{
+			sink:       sink,
+			queue:      make(chan Sample, sinkQueueSize),
+			flushEvery: flushEvery,
+			maxPending: maxPending,
+			self:       self,
+			status:     SinkStatus{Name: sink.Name(), Target: sink.Target()},
+		})
+	}
+	if config.OutputFile != "" {
+		sink, err := newFileSink(config.OutputFile, config.OutputFormat, config.OutputMaxMB)
+		if err != nil {
+			return nil, err
+		}
+		add(sink, 0, 0)
+	}
+	if config.StatsdAddr != "" {
+		sink, err := newStatsdSink(config.StatsdAddr, config.StatsdPrefix, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		add(sink, 0, 0)
+	}
+	if config.OTLPEndpoint != "" {
+		sink, err := newOTLPSink(config.OTLPEndpoint, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		interval := config.OTLPInterval
+		if interval <= 0 {
+			interval = DefaultOTLPInterval
+		}
+		add(sink, interval, OTLPMaxPending)
+	}
+	if len(set.runners) == 0 {
+		return nil, nil
+	}
+	return set, nil
+}
+
+// Start runs every sink in the background
+func (set *SinkSet) Start() {
+	for _, runner := range set.runners {
+		go runner.run()
+	}
+}
+
+// Publish queues a sample for every sink without blocking; a sink whose queue is full
+// drops it
+func (set *SinkSet) Publish(sample Sample) {
+	for _, runner := range set.runners {
+		select {
+		case runner.queue <- sample:
+		default:
+			runner.mutex.Lock()
+			runner.status.Dropped++
+			runner.mutex.Unlock()
+		}
+	}
+}
+
+// Status returns the state of every sink
+func (set *SinkSet) Status() []SinkStatus {
+	statuses := make([]SinkStatus, 0, len(set.runners))
+	for _, runner := range set.runners {
+		runner.mutex.Lock()
+		status := runner.status
+		status.Pending = len(runner.pending)
+		runner.mutex.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// run writes queued samples as they arrive, or batched every flushEvery
+func (r *sinkRunner) run() {
+	if r.flushEvery <= 0 {
+		for sample := range r.queue {
+			r.add(sample)
+			r.flush()
+		}
+		return
+	}
+	ticker := time.NewTicker(r.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case sample := <-r.queue:
+			r.add(sample)
+		case <-ticker.C:
+			r.flush()
+		}
+	}
+}
+
+func (r *sinkRunner) add(sample Sample) {
+	r.mutex.Lock()
+	r.pending = append(r.pending, sample)
+	r.mutex.Unlock()
+}
+
+// flush writes the pending samples. After a failure they are kept for the next flush,
+// up to maxPending with the oldest dropped first.
+func (r *sinkRunner) flush() {
+	r.mutex.Lock()
+	batch := r.pending
+	r.pending = nil
+	r.mutex.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	err := r.sink.Write(batch)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err == nil {
+		r.status.Written += uint64(len(batch))
+		r.status.LastWriteAt = time.Now().UTC().Format(time.RFC3339)
+		return
+	}
+	r.status.Failures++
+	r.status.LastError = err.Error()
+	r.status.LastErrorAt = time.Now().UTC().Format(time.RFC3339)
+	r.self.recordError("sink "+r.sink.Name(), err)
+	kept := append(batch, r.pending...)
+	if len(kept) > r.maxPending {
+		r.status.Dropped += uint64(len(kept) - r.maxPending)
+		kept = kept[len(kept)-r.maxPending:]
+	}
+	r.pending = kept
+}
+
+// fileSink appends samples to a local CSV or NDJSON file, rotating it by size
+type fileSink struct {
+	path     string
+	format   string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+func newFileSink(path, format string, maxMB int) (*fileSink, error) {
+	switch format {
+	case "":
+		format = "ndjson"
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			format = "csv"
+		}
+	case "csv", "ndjson":
+	default:
+		return nil, fmt.Errorf("unknown output format %q, use csv or ndjson", format)
+	}
+	sink := &fileSink{path: path, format: format, maxBytes: int64(maxMB) * 1024 * 1024}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *fileSink) Name() string   { return s.format }
+func (s *fileSink) Target() string { return s.path }
+
+// open opens the file for appending and writes the CSV header when it is empty
+func (s *fileSink) open() error {
+	if dir := filepath.Dir(s.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat output file: %v", err)
+	}
+	s.file, s.size = file, info.Size()
+	if s.format == "csv" && s.size == 0 {
+		return s.writeLines(func(w io.Writer) error {
+			writer := csv.NewWriter(w)
+			writer.Write(sampleColumns)
+			writer.Flush()
+			return writer.Error()
+		})
+	}
+	return nil
+}
+
+func (s *fileSink) Write(samples []Sample) error {
+	if s.file == nil {
+		// A previous rotation failed to reopen the file
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.maxBytes > 0 && s.size >= s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	return s.writeLines(func(w io.Writer) error {
+		if s.format == "csv" {
+			writer := csv.NewWriter(w)
+			for _, sample := range samples {
+				writer.Write(sample.record())
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+		encoder := json.NewEncoder(w)
+		for _, sample := range samples {
+			if err := encoder.Encode(sample); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeLines renders the lines in memory and appends them with one write, so a
+// sample is never split by a crash between two writes
+func (s *fileSink) writeLines(render func(io.Writer) error) error {
+	var buffer bytes.Buffer
+	if err := render(&buffer); err != nil {
+		return err
+	}
+	n, err := s.file.Write(buffer.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// rotate moves the file to <path>.1, shifting older ones up to OutputKeepFiles, and
+// starts a new one
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", s.path, OutputKeepFiles))
+	for i := OutputKeepFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate output file: %v", err)
+	}
+	return s.open()
+}
+
+// statsdSink sends each sample as statsd gauges over UDP
+type statsdSink struct {
+	addr   string
+	prefix string
+	conn   net.Conn
+}
+
+func newStatsdSink(addr, prefix, nodeID string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve statsd address %s: %v", addr, err)
+	}
+	if prefix == "" {
+		prefix = DefaultStatsdPrefix
+	}
+	// Dots separate statsd name segments, so keep the node ID as one segment
+	node := strings.NewReplacer(".", "_", ":", "_", "|", "_", " ", "_").Replace(nodeID)
+	return &statsdSink{addr: addr, prefix: strings.TrimSuffix(prefix, ".") + "." + node, conn: conn}, nil
+}
+
+func (s *statsdSink) Name() string   { return "statsd" }
+func (s *statsdSink) Target() string { return s.addr }
+
+// Write sends the gauges newline separated, as many per packet as fit
+func (s *statsdSink) Write(samples []Sample) error {
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, sample := range samples {
+		for _, gauge := range sample.gauges() {
+			line := fmt.Sprintf("%s.%s:%s|g", s.prefix, gauge.name, strconv.FormatFloat(gauge.value, 'f', -1, 64))
+			if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketBytes {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+	return send()
+}
+
+// otlpSink pushes samples as OTLP/HTTP JSON gauges, one data point per sample
+type otlpSink struct {
+	endpoint string
+	nodeID   string
+	client   *http.Client
+}
+
+func newOTLPSink(endpoint, nodeID string) (*otlpSink, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("OTLP endpoint %q must be an http(s) URL", endpoint)
+	}
+	return &otlpSink{endpoint: endpoint, nodeID: nodeID, client: &http.Client{Timeout: OTLPTimeout}}, nil
+}
+
+func (s *otlpSink) Name() string   { return "otlp" }
+func (s *otlpSink) Target() string { return s.endpoint }
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	TimeUnixNano string  `json:"timeUnixNano"`
+	AsDouble     float64 `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+func (s *otlpSink) Write(samples []Sample) error {
+	var metrics []*otlpMetric
+	byName := map[string]*otlpMetric{}
+	for _, sample := range samples {
+		point := otlpDataPoint{TimeUnixNano: strconv.FormatInt(sample.Timestamp.UnixNano(), 10)}
+		for _, gauge := range sample.gauges() {
+			metric, ok := byName[gauge.name]
+			if !ok {
+				metric = &otlpMetric{Name: DefaultStatsdPrefix + "." + gauge.name, Unit: gauge.unit}
+				byName[gauge.name] = metric
+				metrics = append(metrics, metric)
+			}
+			point.AsDouble = gauge.value
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+
+	payload := map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{
+					{Key: "service.name", Value: otlpValue{StringValue: "node_metrics_api"}},
+					{Key: "service.version", Value: otlpValue{StringValue: AgentVersion}},
+					{Key: "host.name", Value: otlpValue{StringValue: s.nodeID}},
+				},
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "node_metrics_api"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("OTLP endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
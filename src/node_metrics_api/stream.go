@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Metrics stream configuration
+const (
+	DefaultPushInterval = time.Second
+	MaxIdleBackoff      = 30 * time.Second // longest sleep of the push loop without clients
+	streamSendBuffer    = 4                // messages queued per client before they are dropped
+	streamWriteTimeout  = 5 * time.Second
+	streamPingInterval  = 30 * time.Second
+	streamPongTimeout   = 2 * streamPingInterval
+)
+
+// StreamMessage is what /ws pushes to its clients
+type StreamMessage struct {
+	Type       string                    `json:"type"` // always "metrics"
+	NodeID     string                    `json:"nodeId"`
+	Timestamp  time.Time                 `json:"timestamp"`
+	Stale      bool                      `json:"stale"`
+	Process    FinalVuDataSimMetrics     `json:"process"`
+	LastExit   *ProcessExit              `json:"last_exit"`
+	System     SystemMetrics             `json:"system"`
+	Collectors map[string]CollectorState `json:"collectors"`
+}
+
+// StreamStatus is the state of the metrics stream, part of /api/system/health
+type StreamStatus struct {
+	Clients        int     `json:"clients"`
+	PushIntervalMs float64 `json:"push_interval_ms"`
+	IdleBackoffMs  float64 `json:"idle_backoff_ms"` // current sleep while no client is connected
+	Pushed         uint64  `json:"pushed"`          // messages written to clients
+	Dropped        uint64  `json:"dropped"`         // skipped because a client was not reading
+}
+
+// streamClient is one /ws connection with its own writer, so a slow client cannot hold
+// up the others
+type streamClient struct {
+	conn *websocket.Conn
+	send chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *streamClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// MetricsStream pushes the latest sample to the WebSocket clients every push interval.
+// Without clients the push loop backs off, doubling its sleep up to MaxIdleBackoff, and
+// a new client wakes it at once.
+type MetricsStream struct {
+	collector *MetricsCollector
+	interval  time.Duration
+	upgrader  websocket.Upgrader
+	wake      chan struct{}
+
+	mutex   sync.Mutex
+	clients map[*streamClient]bool
+	idle    time.Duration
+	pushed  uint64
+	dropped uint64
+}
+
+// NewMetricsStream creates the stream of a collector
+func NewMetricsStream(collector *MetricsCollector, interval time.Duration) *MetricsStream {
+	return &MetricsStream{
+		collector: collector,
+		interval:  interval,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true // the manager and dashboards connect from other origins
+			},
+		},
+		wake:    make(chan struct{}, 1),
+		clients: make(map[*streamClient]bool),
+	}
+}
+
+// message encodes the latest sample
+func (s *MetricsStream) message(now time.Time) ([]byte, error) {
+	mc := s.collector
+	collectors := mc.collectorStates(now)
+	_, processStale := sectionFreshness(collectors, []string{CollectorProcess})
+	_, systemStale := sectionFreshness(collectors, systemCollectors)
+	return json.Marshal(StreamMessage{
+		Type:       "metrics",
+		NodeID:     mc.nodeID,
+		Timestamp:  now.UTC(),
+		Stale:      processStale || systemStale,
+		Process:    mc.GetCurrentMetrics(),
+		LastExit:   mc.GetLastExit(),
+		System:     mc.GetCurrentSystemMetrics(),
+		Collectors: collectors,
+	})
+}
+
+// Run is the push loop
+func (s *MetricsStream) Run() {
+	s.setIdle(s.interval)
+	for {
+		clients := s.clientList()
+		if len(clients) == 0 {
+			idle := s.idleBackoff()
+			select {
+			case <-s.wake:
+				// The new client got the latest sample on connecting
+				s.setIdle(s.interval)
+				time.Sleep(s.interval)
+			case <-time.After(idle):
+				if idle *= 2; idle > MaxIdleBackoff {
+					idle = MaxIdleBackoff
+				}
+				s.setIdle(idle)
+			}
+			continue
+		}
+		s.setIdle(s.interval)
+
+		data, err := s.message(time.Now())
+		if err != nil {
+			log.Printf("Error encoding stream message: %v", err)
+		} else {
+			for _, client := range clients {
+				s.enqueue(client, data)
+			}
+		}
+		time.Sleep(s.interval)
+	}
+}
+
+// enqueue hands a message to a client's writer, dropping it if the client is behind
+func (s *MetricsStream) enqueue(client *streamClient, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		s.mutex.Lock()
+		s.dropped++
+		s.mutex.Unlock()
+	}
+}
+
+func (s *MetricsStream) idleBackoff() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.idle
+}
+
+func (s *MetricsStream) setIdle(idle time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.idle = idle
+}
+
+func (s *MetricsStream) clientList() []*streamClient {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	clients := make([]*streamClient, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func (s *MetricsStream) addClient(client *streamClient) {
+	s.mutex.Lock()
+	s.clients[client] = true
+	s.mutex.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MetricsStream) removeClient(client *streamClient) {
+	s.mutex.Lock()
+	delete(s.clients, client)
+	s.mutex.Unlock()
+	client.close()
+}
+
+// Status returns the client count and push counters
+func (s *MetricsStream) Status() StreamStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status := StreamStatus{
+		Clients:        len(s.clients),
+		PushIntervalMs: durationMs(s.interval),
+		Pushed:         s.pushed,
+		Dropped:        s.dropped,
+	}
+	if len(s.clients) == 0 {
+		status.IdleBackoffMs = durationMs(s.idle)
+	}
+	return status
+}
+
+// writeLoop writes a client's messages and keeps the connection alive with pings
+func (s *MetricsStream) writeLoop(client *streamClient) {
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	defer s.removeClient(client)
+
+	for {
+		select {
+		case data := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.pushed++
+			s.mutex.Unlock()
+		case <-ping.C:
+			if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
+
+// HTTP handler for /ws
+func (s *MetricsStream) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	client := &streamClient{conn: conn, send: make(chan []byte, streamSendBuffer), done: make(chan struct{})}
+
+	// Send the latest sample right away instead of after the first push interval
+	if data, err := s.message(time.Now()); err == nil {
+		client.send <- data
+	}
+	s.addClient(client)
+	go s.writeLoop(client)
+	log.Printf("Metrics stream client connected from %s", r.RemoteAddr)
+
+	// Clients only send control frames; reading handles pongs and notices the close
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(streamPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongTimeout))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Metrics stream client %s: %v", r.RemoteAddr, err)
+			}
+			break
+		}
+	}
+	s.removeClient(client)
+	log.Printf("Metrics stream client disconnected from %s", r.RemoteAddr)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Top processes configuration
+const (
+	DefaultTopN        = 10
+	MaxTopN            = 100
+	DefaultTopInterval = 500 * time.Millisecond
+	MaxTopInterval     = 5 * time.Second
+)
+
+// TopProcess is a process as listed by /api/system/top
+type TopProcess struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	User       string  `json:"user"`
+	Name       string  `json:"name"`
+	Cmdline    string  `json:"cmdline"`
+	CPUPercent float64 `json:"cpu_percent"` // over the sampling interval, 100 per fully used core
+	RSSMB      float64 `json:"rss_mb"`
+	MemPercent float64 `json:"mem_percent"`
+	State      string  `json:"state"`
+}
+
+// TopResult is the response of /api/system/top
+type TopResult struct {
+	NodeID     string       `json:"nodeId"`
+	CPUCores   int          `json:"cpu_cores"`
+	IntervalMs int64        `json:"interval_ms"`
+	Processes  int          `json:"processes"` // processes seen in both samples
+	ByCPU      []TopProcess `json:"by_cpu"`
+	ByRSS      []TopProcess `json:"by_rss"`
+	Timestamp  time.Time    `json:"timestamp"`
+}
+
+// procSample is one read of /proc/<pid>/stat
+type procSample struct {
+	ppid       int
+	name       string
+	state      string
+	ticks      uint64 // utime + stime
+	rssPages   int64
+	threads    int
+	startTicks uint64 // since boot
+}
+
+// readProcSamples reads the CPU ticks and RSS of every process
+func readProcSamples() map[int]procSample {
+	samples := make(map[int]procSample)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return samples
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue // the process exited meanwhile
+		}
+		if sample, ok := parseProcStat(string(data)); ok {
+			samples[pid] = sample
+		}
+	}
+	return samples
+}
+
+// parseProcStat reads name, state, ppid, utime, stime, threads, starttime and rss from
+// /proc/<pid>/stat. The name is in parentheses and may itself contain spaces and
+// parentheses.
+func parseProcStat(stat string) (procSample, bool) {
+	open, close := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || close < open {
+		return procSample{}, false
+	}
+	fields := strings.Fields(stat[close+1:])
+	// fields[0] is field 3 (state) of proc(5)
+	if len(fields) < 22 {
+		return procSample{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	startTicks, _ := strconv.ParseUint(fields[19], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	return procSample{
+		ppid:       ppid,
+		name:       stat[open+1 : close],
+		state:      fields[0],
+		ticks:      utime + stime,
+		rssPages:   rss,
+		threads:    threads,
+		startTicks: startTicks,
+	}, true
+}
+
+// readTotalTicks returns the sum of the aggregate cpu line of /proc/stat
+func readTotalTicks() uint64 {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "cpu" {
+		return 0
+	}
+	var total uint64
+	for _, field := range fields[1:] {
+		if val, err := strconv.ParseUint(field, 10, 64); err == nil {
+			total += val
+		}
+	}
+	return total
+}
+
+// processUser returns the login name of the process's real UID
+func processUser(pid int, users map[string]string) string {
+	status, err := readKeyValueFile(fmt.Sprintf("/proc/%d/status", pid), ":")
+	if err != nil {
+		return ""
+	}
+	uids := strings.Fields(status["Uid"])
+	if len(uids) == 0 {
+		return ""
+	}
+	if name, ok := users[uids[0]]; ok {
+		return name
+	}
+	return uids[0]
+}
+
+// readUsers maps UIDs to login names from /etc/passwd
+func readUsers() map[string]string {
+	users := make(map[string]string)
+	data, err := os.ReadFile("/etc/passwd")
+	if err != nil {
+		return users
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) >= 3 {
+			users[fields[2]] = fields[0]
+		}
+	}
+	return users
+}
+
+// processCmdline returns the command line of a process, or "" for kernel threads
+func processCmdline(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// TopProcesses samples /proc twice, interval apart, and returns the n processes using
+// the most CPU over the interval and the n with the largest RSS
+func TopProcesses(nodeID string, n int, interval time.Duration) *TopResult {
+	before, beforeTotal := readProcSamples(), readTotalTicks()
+	time.Sleep(interval)
+	after, afterTotal := readProcSamples(), readTotalTicks()
+
+	cores := runtime.NumCPU()
+	pageMB := float64(os.Getpagesize()) / (1024 * 1024)
+	memTotalMB, _ := readMemTotalMB()
+	totalDelta := float64(afterTotal - beforeTotal)
+
+	processes := make([]TopProcess, 0, len(after))
+	for pid, sample := range after {
+		previous, ok := before[pid]
+		if !ok {
+			continue
+		}
+		process := TopProcess{
+			PID:   pid,
+			PPID:  sample.ppid,
+			Name:  sample.name,
+			State: sample.state,
+			RSSMB: round2(float64(sample.rssPages) * pageMB),
+		}
+		if totalDelta > 0 && sample.ticks >= previous.ticks {
+			// /proc/stat counts ticks over all cores, so scale to 100 per core
+			process.CPUPercent = round2(float64(sample.ticks-previous.ticks) / totalDelta * 100 * float64(cores))
+		}
+		if memTotalMB > 0 {
+			process.MemPercent = round2(process.RSSMB / memTotalMB * 100)
+		}
+		processes = append(processes, process)
+	}
+
+	result := &TopResult{
+		NodeID:     nodeID,
+		CPUCores:   cores,
+		IntervalMs: interval.Milliseconds(),
+		Processes:  len(processes),
+		Timestamp:  time.Now().UTC(),
+	}
+	result.ByCPU = topBy(processes, n, func(a, b TopProcess) bool { return a.CPUPercent > b.CPUPercent })
+	result.ByRSS = topBy(processes, n, func(a, b TopProcess) bool { return a.RSSMB > b.RSSMB })
+
+	// User and command line are only read for the processes listed
+	users := readUsers()
+	for _, list := range [][]TopProcess{result.ByCPU, result.ByRSS} {
+		for i := range list {
+			list[i].User = processUser(list[i].PID, users)
+			list[i].Cmdline = processCmdline(list[i].PID)
+		}
+	}
+	return result
+}
+
+// topBy returns a copy of the first n processes in the given order, ties broken by PID
+func topBy(processes []TopProcess, n int, less func(a, b TopProcess) bool) []TopProcess {
+	sorted := append([]TopProcess(nil), processes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if less(sorted[i], sorted[j]) {
+			return true
+		}
+		if less(sorted[j], sorted[i]) {
+			return false
+		}
+		return sorted[i].PID < sorted[j].PID
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// HTTP handler for /api/system/top[?n=10][&interval=500ms]
+func handleTop(nodeID string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+
+		n := DefaultTopN
+		if value := r.URL.Query().Get("n"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > MaxTopN {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("n must be between 1 and %d", MaxTopN)})
+				return
+			}
+			n = parsed
+		}
+		interval := DefaultTopInterval
+		if value := r.URL.Query().Get("interval"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 || parsed > MaxTopInterval {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "interval must be a duration between 0 and 5s"})
+				return
+			}
+			interval = parsed
+		}
+
+		if err := json.NewEncoder(w).Encode(TopProcesses(nodeID, n, interval)); err != nil {
+			log.Printf("Error encoding top processes JSON: %v", err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package nodeclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"vuDataSim/src/selfstats"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"    // requests pass
+	StateOpen     = "open"      // requests fail fast until the open period ends
+	StateHalfOpen = "half_open" // one trial request decides whether to close again
+)
+
+// ErrCircuitOpen is returned without contacting a host whose breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Config holds the node_polling section of config.yaml
+type Config struct {
+	TimeoutMs              int `yaml:"timeout_ms" json:"timeoutMs"` // used when the caller sets no deadline
+	MaxIdleConnsPerHost    int `yaml:"max_idle_conns_per_host" json:"maxIdleConnsPerHost"`
+	IdleConnTimeoutSeconds int `yaml:"idle_conn_timeout_seconds" json:"idleConnTimeoutSeconds"`
+	// FailureThreshold consecutive failures open a host's breaker for OpenSeconds
+	FailureThreshold int `yaml:"failure_threshold" json:"failureThreshold"`
+	OpenSeconds      int `yaml:"open_seconds" json:"openSeconds"`
+}
+
+// HostStatus is the breaker state and request counts of one host
+type HostStatus struct {
+	Host                string     `json:"host"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	Rejected            int64      `json:"rejected"` // failed fast while the breaker was open
+	SuccessRate         *float64   `json:"successRate,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorAt         *time.Time `json:"lastErrorAt,omitempty"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"` // end of the open period
+}
+
+type breaker struct {
+	status HostStatus
+	trial  bool // a half-open trial request is in flight
+}
+
+// Pool is the HTTP client shared by all requests to node agents. Connections are kept
+// alive per host and every host has a circuit breaker, so dead nodes are not hammered.
+type Pool struct {
+	mutex    sync.Mutex
+	config   Config
+	client   *http.Client
+	breakers map[string]*breaker
+}
+
+// NewPool creates a pool with default settings
+func NewPool() *Pool {
+	p := &Pool{breakers: make(map[string]*breaker)}
+	p.apply(Config{
+		TimeoutMs:              2000,
+		MaxIdleConnsPerHost:    4,
+		IdleConnTimeoutSeconds: 90,
+		FailureThreshold:       5,
+		OpenSeconds:            30,
+	})
+	return p
+}
+
+// LoadConfig reads the node_polling section from the application config file
+func (p *Pool) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := p.Config()
+	wrapper := struct {
+		Polling *Config `yaml:"node_polling"`
+	}{Polling: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if config.TimeoutMs <= 0 || config.MaxIdleConnsPerHost <= 0 || config.IdleConnTimeoutSeconds <= 0 ||
+		config.FailureThreshold <= 0 || config.OpenSeconds <= 0 {
+		return fmt.Errorf("node_polling values must be positive")
+	}
+	p.apply(config)
+	return nil
+}
+
+func (p *Pool) apply(config Config) {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: time.Duration(config.TimeoutMs) * time.Millisecond, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(config.IdleConnTimeoutSeconds) * time.Second,
+	}
+
+	p.mutex.Lock()
+	previous := p.client
+	p.config = config
+	p.client = &http.Client{Transport: transport}
+	p.mutex.Unlock()
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// Config returns the pool settings
+func (p *Pool) Config() Config {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.config
+}
+
+// Get requests rawURL through the pool. Without a deadline on ctx the configured
+// timeout applies. Transport errors and 5xx responses count against the host's breaker.
+func (p *Pool) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := parsed.Host
+
+	p.mutex.Lock()
+	client, config := p.client, p.config
+	b := p.breakerLocked(host)
+	now := time.Now()
+	if b.status.State == StateOpen && now.After(*b.status.RetryAt) {
+		b.status.State = StateHalfOpen
+	}
+	if b.status.State == StateOpen || (b.status.State == StateHalfOpen && b.trial) {
+		b.status.Rejected++
+		retryAt := *b.status.RetryAt
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("%w for %s, retrying after %s", ErrCircuitOpen, host, retryAt.Format(time.RFC3339))
+	}
+	if b.status.State == StateHalfOpen {
+		b.trial = true
+	}
+	p.mutex.Unlock()
+
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.TimeoutMs)*time.Millisecond)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		err = fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	p.record(host, err)
+	if resp == nil {
+		cancel()
+		return nil, err
+	}
+	// 5xx responses are handed to the caller, which reports them itself
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// record counts a request outcome and moves the host's breaker
+func (p *Pool) record(host string, err error) {
+	selfstats.Record(selfstats.CategoryNodePoll, err)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	b := p.breakerLocked(host)
+	b.trial = false
+	b.status.Requests++
+	if err == nil {
+		b.status.State = StateClosed
+		b.status.ConsecutiveFailures = 0
+		b.status.OpenedAt, b.status.RetryAt = nil, nil
+		return
+	}
+
+	now := time.Now().UTC()
+	b.status.Failures++
+	b.status.ConsecutiveFailures++
+	b.status.LastError = err.Error()
+	b.status.LastErrorAt = &now
+	if b.status.State == StateHalfOpen || b.status.ConsecutiveFailures >= p.config.FailureThreshold {
+		retryAt := now.Add(time.Duration(p.config.OpenSeconds) * time.Second)
+		b.status.State = StateOpen
+		b.status.OpenedAt = &now
+		b.status.RetryAt = &retryAt
+	}
+}
+
+// breakerLocked returns the breaker of a host; callers must hold the lock
+func (p *Pool) breakerLocked(host string) *breaker {
+	b, ok := p.breakers[host]
+	if !ok {
+		b = &breaker{status: HostStatus{Host: host, State: StateClosed}}
+		p.breakers[host] = b
+	}
+	return b
+}
+
+// Status returns the breaker state and request counts of every host, ordered by host
+func (p *Pool) Status() []HostStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	list := make([]HostStatus, 0, len(p.breakers))
+	for _, b := range p.breakers {
+		status := b.status
+		if status.State == StateOpen && time.Now().After(*status.RetryAt) {
+			status.State = StateHalfOpen
+		}
+		if status.Requests > 0 {
+			rate := float64(status.Requests-status.Failures) / float64(status.Requests)
+			status.SuccessRate = &rate
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Host < list[j].Host })
+	return list
+}
+
+// Reset closes the breaker of a host, e.g. after the node was repaired
+func (p *Pool) Reset(host string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b, ok := p.breakers[host]
+	if !ok {
+		return false
+	}
+	b.status.State = StateClosed
+	b.status.ConsecutiveFailures = 0
+	b.status.OpenedAt, b.status.RetryAt = nil, nil
+	b.trial = false
+	return true
+}
+
+// cancelBody releases the request's timeout once the caller closed the body
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
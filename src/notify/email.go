@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// EmailConfig sends messages through an SMTP server. The password is read from the
+// environment variable named by PasswordEnv so it stays out of config.yaml.
+type EmailConfig struct {
+	SMTPHost    string   `yaml:"smtp_host" json:"smtpHost,omitempty"`
+	SMTPPort    int      `yaml:"smtp_port" json:"smtpPort,omitempty"`
+	Username    string   `yaml:"username" json:"username,omitempty"`
+	PasswordEnv string   `yaml:"password_env" json:"passwordEnv,omitempty"`
+	From        string   `yaml:"from" json:"from,omitempty"`
+	To          []string `yaml:"to" json:"to,omitempty"`
+}
+
+type emailTransport struct {
+	config EmailConfig
+}
+
+func (t *emailTransport) Name() string { return ChannelEmail }
+
+// Send ignores ctx; net/smtp has no context support
+func (t *emailTransport) Send(ctx context.Context, message Message) error {
+	config := t.config
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, os.Getenv(config.PasswordEnv), config.SMTPHost)
+	}
+
+	subject := message.Subject
+	if severity := message.severity(); severity != SeverityInfo {
+		subject = fmt.Sprintf("[%s] %s", strings.ToUpper(severity), subject)
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", config.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(message.Text, "\n", "\r\n"))
+
+	address := fmt.Sprintf("%s:%d", config.SMTPHost, config.SMTPPort)
+	if err := smtp.SendMail(address, auth, config.From, config.To, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send email via %s: %v", address, err)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Channel names
+const (
+	ChannelSlack     = "slack"
+	ChannelEmail     = "email"
+	ChannelWebhook   = "webhook"
+	ChannelPagerDuty = "pagerduty"
+)
+
+// Message severities, from least to most urgent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+
+// Events that send notifications
+const (
+	EventDigest      = "digest"
+	EventWatchdog    = "watchdog"
+	EventStorage     = "storage"
+	EventViewLag     = "view_lag"
+	EventReservation = "reservation"
+	EventTest        = "test"
+)
+
+// Config holds the notifications section of config.yaml
+type Config struct {
+	Slack     SlackConfig     `yaml:"slack" json:"slack"`
+	Email     EmailConfig     `yaml:"email" json:"email"`
+	Webhook   WebhookConfig   `yaml:"webhook" json:"webhook"`
+	PagerDuty PagerDutyConfig `yaml:"pagerduty" json:"pagerduty"`
+	// Routes limit which messages reach a channel. A channel without routes receives
+	// every message; with routes, a message must match at least one of them.
+	Routes []Route `yaml:"routes" json:"routes,omitempty"`
+}
+
+// Route sends messages of at least MinSeverity to a channel, optionally only for some events
+type Route struct {
+	Channel     string   `yaml:"channel" json:"channel"`
+	MinSeverity string   `yaml:"min_severity" json:"minSeverity"`
+	Events      []string `yaml:"events" json:"events,omitempty"` // empty matches every event
+}
+
+func (r Route) matches(message Message) bool {
+	if severityRank[message.severity()] < severityRank[r.MinSeverity] {
+		return false
+	}
+	if len(r.Events) == 0 {
+		return true
+	}
+	for _, event := range r.Events {
+		if event == message.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// Message is a notification routed to the configured channels
+type Message struct {
+	Subject  string
+	Text     string // plain text; URLs are linked by Slack and mail clients
+	Severity string // info when empty
+	Event    string // what sent the message, e.g. digest or watchdog
+}
+
+func (m Message) severity() string {
+	if m.Severity == "" {
+		return SeverityInfo
+	}
+	return m.Severity
+}
+
+// Transport delivers messages over one channel
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, message Message) error
+}
+
+// Delivery is the outcome of sending a message to one channel
+type Delivery struct {
+	Channel string `json:"channel"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Notifier delivers messages to the configured transports according to the routes
+type Notifier struct {
+	mutex      sync.RWMutex
+	config     Config
+	transports []Transport
+	client     *http.Client
+}
+
+// NewNotifier creates a notifier without channels
+func NewNotifier() *Notifier {
+	return &Notifier{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// LoadConfig reads the notifications section from the application config file. An
+// invalid section is rejected and the current channels stay in place.
+func (n *Notifier) LoadConfig(configPath string) error {
+	_, err := n.load(configPath)
+	return err
+}
+
+func (n *Notifier) load(configPath string) (bool, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		Notifications Config `yaml:"notifications"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return false, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	config := wrapper.Notifications
+	transports, err := n.buildTransports(&config)
+	if err != nil {
+		return false, err
+	}
+
+	n.mutex.Lock()
+	changed := !reflect.DeepEqual(n.config, config)
+	n.config = config
+	n.transports = transports
+	n.mutex.Unlock()
+	return changed, nil
+}
+
+// buildTransports validates the config, fills in defaults and creates a transport per
+// configured channel
+func (n *Notifier) buildTransports(config *Config) ([]Transport, error) {
+	var transports []Transport
+	if config.Slack.WebhookURL != "" {
+		transports = append(transports, &slackTransport{config: config.Slack, client: n.client})
+	}
+	if config.Email.SMTPHost != "" {
+		if config.Email.SMTPPort == 0 {
+			config.Email.SMTPPort = 587
+		}
+		if config.Email.From == "" || len(config.Email.To) == 0 {
+			return nil, fmt.Errorf("notifications.email needs from and to")
+		}
+		transports = append(transports, &emailTransport{config: config.Email})
+	}
+	if config.Webhook.URL != "" {
+		transports = append(transports, &webhookTransport{config: config.Webhook, client: n.client})
+	}
+	if config.PagerDuty.RoutingKeyEnv != "" {
+		if config.PagerDuty.EventsURL == "" {
+			config.PagerDuty.EventsURL = defaultPagerDutyURL
+		}
+		transports = append(transports, &pagerDutyTransport{config: config.PagerDuty, client: n.client})
+	}
+
+	known := map[string]bool{ChannelSlack: true, ChannelEmail: true, ChannelWebhook: true, ChannelPagerDuty: true}
+	for i := range config.Routes {
+		route := &config.Routes[i]
+		if !known[route.Channel] {
+			return nil, fmt.Errorf("notifications.routes[%d]: unknown channel %q", i, route.Channel)
+		}
+		if route.MinSeverity == "" {
+			route.MinSeverity = SeverityInfo
+		}
+		if _, ok := severityRank[route.MinSeverity]; !ok {
+			return nil, fmt.Errorf("notifications.routes[%d]: min_severity must be info, warning or critical", i)
+		}
+	}
+	return transports, nil
+}
+
+// Watch polls the config file and reloads the notifications section whenever the file
+// changes. onReload is called for rejected edits and for changes to the section.
+func (n *Notifier) Watch(configPath string, interval time.Duration, onReload func(error)) {
+	go func() {
+		var lastModTime time.Time
+		var lastSize int64 = -1
+		if info, err := os.Stat(configPath); err == nil {
+			lastModTime, lastSize = info.ModTime(), info.Size()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			info, err := os.Stat(configPath)
+			if err != nil || (info.ModTime().Equal(lastModTime) && info.Size() == lastSize) {
+				continue
+			}
+			lastModTime, lastSize = info.ModTime(), info.Size()
+
+			changed, err := n.load(configPath)
+			if onReload != nil && (err != nil || changed) {
+				onReload(err)
+			}
+		}
+	}()
+}
+
+// Channels returns the names of the configured channels
+func (n *Notifier) Channels() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+
+	var channels []string
+	for _, transport := range n.transports {
+		channels = append(channels, transport.Name())
+	}
+	return channels
+}
+
+// Routes returns the routing rules
+func (n *Notifier) Routes() []Route {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	return append([]Route(nil), n.config.Routes...)
+}
+
+// Send delivers the message to every channel its routes allow. A failing channel does
+// not stop delivery to the others.
+func (n *Notifier) Send(ctx context.Context, message Message) []Delivery {
+	n.mutex.RLock()
+	transports := n.transports
+	routes := n.config.Routes
+	n.mutex.RUnlock()
+
+	var deliveries []Delivery
+	for _, transport := range transports {
+		if !routed(routes, transport.Name(), message) {
+			continue
+		}
+		deliveries = append(deliveries, result(transport.Name(), transport.Send(ctx, message)))
+	}
+	return deliveries
+}
+
+// routed reports whether the routes let a message through to a channel
+func routed(routes []Route, channel string, message Message) bool {
+	hasRoute := false
+	for _, route := range routes {
+		if route.Channel != channel {
+			continue
+		}
+		if route.matches(message) {
+			return true
+		}
+		hasRoute = true
+	}
+	return !hasRoute
+}
+
+func result(channel string, err error) Delivery {
+	if err != nil {
+		return Delivery{Channel: channel, Error: err.Error()}
+	}
+	return Delivery{Channel: channel, Success: true}
+}
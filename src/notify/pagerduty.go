@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig triggers PagerDuty incidents through the Events API v2. The routing
+// key of the service integration is read from the environment variable named by
+// RoutingKeyEnv; PagerDuty is disabled while RoutingKeyEnv is empty.
+type PagerDutyConfig struct {
+	RoutingKeyEnv string `yaml:"routing_key_env" json:"routingKeyEnv,omitempty"`
+	Source        string `yaml:"source" json:"source,omitempty"` // defaults to the host name
+	EventsURL     string `yaml:"events_url" json:"eventsUrl,omitempty"`
+}
+
+type pagerDutyTransport struct {
+	config PagerDutyConfig
+	client *http.Client
+}
+
+func (t *pagerDutyTransport) Name() string { return ChannelPagerDuty }
+
+func (t *pagerDutyTransport) Send(ctx context.Context, message Message) error {
+	routingKey := os.Getenv(t.config.RoutingKeyEnv)
+	if routingKey == "" {
+		return fmt.Errorf("PagerDuty routing key not set in %s", t.config.RoutingKeyEnv)
+	}
+	source := t.config.Source
+	if source == "" {
+		source, _ = os.Hostname()
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"payload": map[string]interface{}{
+			"summary":        message.Subject,
+			"source":         source,
+			"severity":       message.severity(), // info, warning and critical are PagerDuty severities too
+			"component":      "vuDataSim",
+			"class":          message.Event,
+			"custom_details": map[string]string{"text": message.Text},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.EventsURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid PagerDuty events URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send PagerDuty event: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("PagerDuty returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SlackConfig posts messages to a Slack incoming webhook
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url" json:"-"`
+	Channel    string `yaml:"channel" json:"channel,omitempty"` // overrides the webhook's default channel
+}
+
+type slackTransport struct {
+	config SlackConfig
+	client *http.Client
+}
+
+func (t *slackTransport) Name() string { return ChannelSlack }
+
+func (t *slackTransport) Send(ctx context.Context, message Message) error {
+	prefix := ""
+	switch message.severity() {
+	case SeverityWarning:
+		prefix = ":warning: "
+	case SeverityCritical:
+		prefix = ":rotating_light: "
+	}
+	payload := map[string]string{"text": fmt.Sprintf("%s*%s*\n%s", prefix, message.Subject, message.Text)}
+	if t.config.Channel != "" {
+		payload["channel"] = t.config.Channel
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid Slack webhook URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to Slack: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// WebhookConfig posts every message as JSON to a URL. The Authorization header, if
+// any, is read from the environment variable named by AuthHeaderEnv.
+type WebhookConfig struct {
+	URL           string `yaml:"url" json:"-"`
+	AuthHeaderEnv string `yaml:"auth_header_env" json:"authHeaderEnv,omitempty"`
+}
+
+type webhookTransport struct {
+	config WebhookConfig
+	client *http.Client
+}
+
+func (t *webhookTransport) Name() string { return ChannelWebhook }
+
+func (t *webhookTransport) Send(ctx context.Context, message Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"subject":  message.Subject,
+		"text":     message.Text,
+		"severity": message.severity(),
+		"event":    message.Event,
+		"time":     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.config.AuthHeaderEnv != "" {
+		req.Header.Set("Authorization", os.Getenv(t.config.AuthHeaderEnv))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
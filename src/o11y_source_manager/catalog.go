@@ -0,0 +1,103 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// catalogDir holds one <source>.yaml per source describing what it simulates. It lives
+// outside conf.d so the descriptions are not distributed to the nodes.
+const catalogDir = "src/configs/catalog"
+
+// EventSchema summarizes the events a source generates
+type EventSchema struct {
+	Summary string   `yaml:"summary" json:"summary"`
+	Fields  []string `yaml:"key_fields" json:"keyFields,omitempty"` // the fields worth knowing, not all of them
+}
+
+// SourceCatalog is the human description of a source from its catalog YAML
+type SourceCatalog struct {
+	DisplayName         string      `yaml:"display_name" json:"displayName"`
+	Description         string      `yaml:"description" json:"description"`
+	EventSchema         EventSchema `yaml:"event_schema" json:"eventSchema"`
+	TypicalMessageBytes int         `yaml:"typical_message_bytes" json:"typicalMessageBytes,omitempty"`
+	DefaultTopic        string      `yaml:"default_topic" json:"defaultTopic,omitempty"`
+}
+
+// SourceCatalogEntry is a source with its catalog description and current settings
+type SourceCatalogEntry struct {
+	Name string `json:"name"`
+	SourceCatalog
+	Cataloged  bool     `json:"cataloged"` // false when the source has no catalog YAML yet
+	MaxEPS     int      `json:"maxEps"`
+	Enabled    bool     `json:"enabled"`
+	SubModules []string `json:"subModules,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// LoadSourceCatalog reads the catalog YAML of a source; a source without one returns nil
+func (osm *O11ySourceManager) LoadSourceCatalog(sourceName string) (*SourceCatalog, error) {
+	if !osm.IsKnownSource(sourceName) {
+		return nil, fmt.Errorf("source not found: %s", sourceName)
+	}
+	data, err := os.ReadFile(filepath.Join(catalogDir, sourceName+".yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog of %s: %v", sourceName, err)
+	}
+
+	var catalog SourceCatalog
+	if err := yaml.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog of %s: %v", sourceName, err)
+	}
+	return &catalog, nil
+}
+
+// GetSourceCatalog describes every available source. Missing fields fall back to what
+// the source's configuration says: the source name as display name and the Kafka topic
+// of its conf.yml as default topic. A broken catalog file is reported on its entry.
+func (osm *O11ySourceManager) GetSourceCatalog() []SourceCatalogEntry {
+	sources := osm.GetAvailableSources()
+	entries := make([]SourceCatalogEntry, 0, len(sources))
+	for _, sourceName := range sources {
+		entry := SourceCatalogEntry{
+			Name:    sourceName,
+			MaxEPS:  osm.maxEPSConfig.MaxEPS[sourceName],
+			Enabled: osm.mainConfig.IncludeModuleDirs[sourceName].Enabled,
+		}
+		catalog, err := osm.LoadSourceCatalog(sourceName)
+		if err != nil {
+			entry.Error = err.Error()
+		} else if catalog != nil {
+			entry.SourceCatalog = *catalog
+			entry.Cataloged = true
+		}
+		if entry.DisplayName == "" {
+			entry.DisplayName = sourceName
+		}
+		if config, err := osm.loadSourceConfig(sourceName); err == nil {
+			entry.SubModules = config.IncludeSubModules
+		}
+		if entry.DefaultTopic == "" {
+			if output, err := osm.GetSourceKafkaOutput(sourceName); err == nil {
+				entry.DefaultTopic = output.Topic
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// TypicalMessageBytes returns the typical message size from a source's catalog, or 0
+func (osm *O11ySourceManager) TypicalMessageBytes(sourceName string) int {
+	catalog, err := osm.LoadSourceCatalog(sourceName)
+	if err != nil || catalog == nil {
+		return 0
+	}
+	return catalog.TypicalMessageBytes
+}
@@ -0,0 +1,168 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"vuDataSim/src/node_control"
+)
+
+// File states of a conf.d diff, from the manager's point of view
+const (
+	DiffSame        = "same"
+	DiffModified    = "modified"
+	DiffOnlyManager = "only_manager" // distributing conf.d would add it to the node
+	DiffOnlyNode    = "only_node"    // distributing conf.d would remove it from the node
+)
+
+// maxDiffFiles caps how many changed files are read from the node for a content diff
+const maxDiffFiles = 50
+
+// ConfDFileDiff is one conf.d file compared between the manager and a node
+type ConfDFileDiff struct {
+	Path            string `json:"path"` // relative to conf.d
+	Status          string `json:"status"`
+	ManagerChecksum string `json:"managerChecksum,omitempty"`
+	NodeChecksum    string `json:"nodeChecksum,omitempty"`
+	// ChangedOn tells which side changed the file since conf.d was last distributed to
+	// the node: manager, node or both; empty if the node has no recorded distribution
+	ChangedOn string `json:"changedOn,omitempty"`
+	Diff      string `json:"diff,omitempty"` // unified diff from the manager's copy to the node's
+}
+
+// ConfDDiff compares the manager's conf.d with the one deployed on a node
+type ConfDDiff struct {
+	Node         string          `json:"node"`
+	InSync       bool            `json:"inSync"`
+	Files        []ConfDFileDiff `json:"files"` // differing files, or all with includeSame
+	Same         int             `json:"same"`
+	Differing    int             `json:"differing"`
+	LastSyncedAt *time.Time      `json:"lastSyncedAt,omitempty"`
+	DiffsSkipped int             `json:"diffsSkipped,omitempty"` // differing files beyond the content diff cap
+	ComparedAt   time.Time       `json:"comparedAt"`
+}
+
+// ConfDDiff compares the manager's conf.d with the node's file by file using sha256
+// checksums, and with withContent reads the differing files from the node to add a
+// unified diff of each
+func (osm *O11ySourceManager) ConfDDiff(nodeName string, withContent, includeSame bool) (*ConfDDiff, error) {
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	nodeConfig, ok := nodeManager.GetNodes()[nodeName]
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", nodeName)
+	}
+
+	localManifest, err := localConfDManifest(localConfDDir)
+	if err != nil {
+		return nil, err
+	}
+	result, err := osm.compareConfD(nodeName, nodeConfig, localManifest, includeSame)
+	if err != nil {
+		return nil, err
+	}
+
+	if withContent {
+		read := 0
+		for i := range result.Files {
+			entry := &result.Files[i]
+			if entry.Status == DiffSame {
+				continue
+			}
+			if read == maxDiffFiles {
+				result.DiffsSkipped++
+				continue
+			}
+			read++
+			// Reuse the conflict diff, which reads the node's copy when it has one
+			change := ChangeModified
+			switch entry.Status {
+			case DiffOnlyManager:
+				change = ChangeDeleted
+			case DiffOnlyNode:
+				change = ChangeAdded
+			}
+			entry.Diff = osm.confDFileDiff(nodeConfig, FileConflict{
+				Path:            entry.Path,
+				Change:          change,
+				ManagerChecksum: entry.ManagerChecksum,
+			})
+		}
+	}
+	return result, nil
+}
+
+// compareConfD checksums the node's conf.d and compares it with the manager's manifest,
+// without reading any file contents
+func (osm *O11ySourceManager) compareConfD(nodeName string, nodeConfig node_control.NodeConfig, localManifest map[string]string, includeSame bool) (*ConfDDiff, error) {
+	remote, err := osm.remoteConfDManifest(nodeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conf.d checksums of node %s: %v", nodeName, err)
+	}
+
+	state := osm.confDSync
+	state.mutex.Lock()
+	var syncedFiles map[string]string
+	result := &ConfDDiff{Node: nodeName, Files: []ConfDFileDiff{}, ComparedAt: time.Now().UTC()}
+	if synced, ok := state.Nodes[nodeName]; ok {
+		syncedFiles = synced.Files
+		syncedAt := synced.SyncedAt
+		result.LastSyncedAt = &syncedAt
+	}
+	state.mutex.Unlock()
+
+	paths := make(map[string]bool)
+	for file := range localManifest {
+		paths[file] = true
+	}
+	for file := range remote {
+		paths[file] = true
+	}
+	for file := range paths {
+		managerChecksum, onManager := localManifest[file]
+		nodeChecksum, onNode := remote[file]
+		entry := ConfDFileDiff{Path: file, ManagerChecksum: managerChecksum, NodeChecksum: nodeChecksum}
+		switch {
+		case !onNode:
+			entry.Status = DiffOnlyManager
+		case !onManager:
+			entry.Status = DiffOnlyNode
+		case managerChecksum != nodeChecksum:
+			entry.Status = DiffModified
+		default:
+			entry.Status = DiffSame
+		}
+		if entry.Status == DiffSame {
+			result.Same++
+			if !includeSame {
+				continue
+			}
+		} else {
+			result.Differing++
+			if syncedFiles != nil {
+				entry.ChangedOn = changedOn(syncedFiles[file], managerChecksum, nodeChecksum)
+			}
+		}
+		result.Files = append(result.Files, entry)
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].Path < result.Files[j].Path })
+	result.InSync = result.Differing == 0
+	return result, nil
+}
+
+// changedOn names the side whose checksum moved away from the last distributed one; an
+// empty checksum means the file is missing on that side
+func changedOn(synced, manager, node string) string {
+	managerChanged, nodeChanged := manager != synced, node != synced
+	switch {
+	case managerChanged && nodeChanged:
+		return "both"
+	case nodeChanged:
+		return "node"
+	case managerChanged:
+		return "manager"
+	}
+	return ""
+}
@@ -0,0 +1,480 @@
+package o11y_source_manager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/selfstats"
+)
+
+// Conflict resolutions, set as cluster_settings.conflict_resolution in nodes.yaml
+const (
+	ConflictManual = "manual" // leave the node untouched until an operator resolves the conflict
+	ConflictOurs   = "ours"   // overwrite the node's edits with the manager's conf.d
+	ConflictTheirs = "theirs" // keep the node's edited files and distribute everything else
+)
+
+// Conflict statuses
+const (
+	ConflictStatusOpen     = "open"
+	ConflictStatusResolved = "resolved"
+)
+
+// Changes made on a node since conf.d was last distributed to it
+const (
+	ChangeModified = "modified"
+	ChangeAdded    = "added"
+	ChangeDeleted  = "deleted"
+)
+
+// JobTypeConfDResolve is the transfer scheduler job type of conflict resolutions
+const JobTypeConfDResolve = "confd_resolve"
+
+// maxDiffBytes caps the size of a file read from a node to build a diff
+const maxDiffBytes = 256 * 1024
+
+// FileConflict is a conf.d file that was changed on a node and differs from the manager's copy
+type FileConflict struct {
+	Path            string `json:"path"` // relative to conf.d
+	Change          string `json:"change"`
+	SyncedChecksum  string `json:"syncedChecksum,omitempty"`  // sha256 when last distributed
+	NodeChecksum    string `json:"nodeChecksum,omitempty"`    // sha256 on the node now
+	ManagerChecksum string `json:"managerChecksum,omitempty"` // sha256 of the manager's copy
+	Diff            string `json:"diff,omitempty"`            // unified diff from the manager's copy to the node's
+}
+
+// ConfDConflict records hand edits found on a node that block conf.d distribution
+// while conflict_resolution is manual
+type ConfDConflict struct {
+	ID         string         `json:"id"`
+	Node       string         `json:"node"`
+	Status     string         `json:"status"`
+	Files      []FileConflict `json:"files"`
+	DetectedAt time.Time      `json:"detectedAt"`
+	Resolution string         `json:"resolution,omitempty"`
+	ResolvedBy string         `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time     `json:"resolvedAt,omitempty"`
+}
+
+// confDNodeSync is the conf.d content a node had right after the last distribution
+type confDNodeSync struct {
+	Files    map[string]string `json:"files"` // path relative to conf.d -> sha256
+	SyncedAt time.Time         `json:"syncedAt"`
+}
+
+// confDSyncState tracks the last distributed conf.d of every node and the conflicts
+// found against it
+type confDSyncState struct {
+	mutex     sync.Mutex
+	file      string
+	Nodes     map[string]*confDNodeSync `json:"nodes"`
+	Conflicts map[string]*ConfDConflict `json:"conflicts"`
+}
+
+func newConfDSyncState() *confDSyncState {
+	return &confDSyncState{
+		file:      "data/confd_sync.json",
+		Nodes:     make(map[string]*confDNodeSync),
+		Conflicts: make(map[string]*ConfDConflict),
+	}
+}
+
+// LoadConfDSyncState reads the conf.d sync state from file. Nodes without a recorded
+// sync are not checked for hand edits until conf.d was distributed to them once.
+func (osm *O11ySourceManager) LoadConfDSyncState(file string) error {
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	state.file = file
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read conf.d sync state: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("failed to parse conf.d sync state: %v", err)
+	}
+	if state.Nodes == nil {
+		state.Nodes = make(map[string]*confDNodeSync)
+	}
+	if state.Conflicts == nil {
+		state.Conflicts = make(map[string]*ConfDConflict)
+	}
+	return nil
+}
+
+// saveLocked writes the sync state; callers must hold the lock
+func (s *confDSyncState) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		return fmt.Errorf("failed to create conf.d sync state directory: %v", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conf.d sync state: %v", err)
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write conf.d sync state: %v", err)
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// ConfDConflicts returns the recorded conflicts newest first, optionally only those
+// with the given status
+func (osm *O11ySourceManager) ConfDConflicts(status string) []ConfDConflict {
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	list := make([]ConfDConflict, 0, len(state.Conflicts))
+	for _, conflict := range state.Conflicts {
+		if status == "" || conflict.Status == status {
+			list = append(list, *conflict)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DetectedAt.After(list[j].DetectedAt) })
+	return list
+}
+
+// GetConfDConflict returns a single conflict
+func (osm *O11ySourceManager) GetConfDConflict(id string) (ConfDConflict, bool) {
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	conflict, ok := state.Conflicts[id]
+	if !ok {
+		return ConfDConflict{}, false
+	}
+	return *conflict, true
+}
+
+// ValidConflictResolution reports whether value is a known conflict resolution
+func ValidConflictResolution(value string) bool {
+	return value == ConflictManual || value == ConflictOurs || value == ConflictTheirs
+}
+
+// ResolveConfDConflict distributes conf.d to the node of an open conflict, either
+// overwriting its edits (ours) or keeping them (theirs)
+func (osm *O11ySourceManager) ResolveConfDConflict(id, resolution, resolvedBy string) (*ConfDNodeResult, error) {
+	if resolution != ConflictOurs && resolution != ConflictTheirs {
+		return nil, fmt.Errorf("resolution must be %s or %s", ConflictOurs, ConflictTheirs)
+	}
+	conflict, ok := osm.GetConfDConflict(id)
+	if !ok {
+		return nil, fmt.Errorf("conflict %s not found", id)
+	}
+	if conflict.Status != ConflictStatusOpen {
+		return nil, fmt.Errorf("conflict %s is already %s", id, conflict.Status)
+	}
+
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	osm.applyTransferBudget(nodeManager)
+	nodeConfig, ok := nodeManager.GetNodes()[conflict.Node]
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", conflict.Node)
+	}
+
+	tempTarFile, tarSize, err := packConfD(localConfDDir)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempTarFile)
+	localManifest, err := localConfDManifest(localConfDDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ConfDNodeResult
+	jobID := osm.transfers.Submit(JobTypeConfDResolve, []jobs.Task{{
+		Name:  conflict.Node,
+		Bytes: tarSize,
+		Run: func(limitKbps int) error {
+			result = osm.distributeConfDToNode(conflict.Node, nodeConfig, tempTarFile, limitKbps, localManifest, resolution)
+			if !result.Success {
+				err := fmt.Errorf("%s: %s", conflict.Node, result.Message)
+				selfstats.Record(selfstats.CategoryDistribution, err)
+				return err
+			}
+			selfstats.Record(selfstats.CategoryDistribution, nil)
+			return nil
+		},
+	}}, nil)
+	if _, err := osm.transfers.Wait(jobID); err != nil {
+		return nil, err
+	}
+
+	if result.Success {
+		osm.setConflictResolver(id, resolvedBy)
+	}
+	return &result, nil
+}
+
+// checkConfDConflicts compares the node's conf.d with the content it had after the last
+// distribution. A file changed on the node conflicts unless it now equals the manager's copy.
+func (osm *O11ySourceManager) checkConfDConflicts(nodeName string, nodeConfig node_control.NodeConfig, localManifest map[string]string) ([]FileConflict, error) {
+	state := osm.confDSync
+	state.mutex.Lock()
+	synced, ok := state.Nodes[nodeName]
+	state.mutex.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	remote, err := osm.remoteConfDManifest(nodeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []FileConflict
+	for file, checksum := range remote {
+		syncedChecksum, known := synced.Files[file]
+		if (known && checksum == syncedChecksum) || checksum == localManifest[file] {
+			continue
+		}
+		change := ChangeModified
+		if !known {
+			change = ChangeAdded
+		}
+		conflicts = append(conflicts, FileConflict{
+			Path:            file,
+			Change:          change,
+			SyncedChecksum:  syncedChecksum,
+			NodeChecksum:    checksum,
+			ManagerChecksum: localManifest[file],
+		})
+	}
+	for file, syncedChecksum := range synced.Files {
+		if _, exists := remote[file]; exists {
+			continue
+		}
+		// A file the manager dropped as well is not a conflict
+		if managerChecksum, managed := localManifest[file]; managed {
+			conflicts = append(conflicts, FileConflict{
+				Path:            file,
+				Change:          ChangeDeleted,
+				SyncedChecksum:  syncedChecksum,
+				ManagerChecksum: managerChecksum,
+			})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts, nil
+}
+
+// recordConfDConflict stores an open conflict for the node with a diff of every file,
+// replacing an older open conflict of the same node
+func (osm *O11ySourceManager) recordConfDConflict(nodeName string, nodeConfig node_control.NodeConfig, files []FileConflict) *ConfDConflict {
+	for i := range files {
+		files[i].Diff = osm.confDFileDiff(nodeConfig, files[i])
+	}
+
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for id, existing := range state.Conflicts {
+		if existing.Node == nodeName && existing.Status == ConflictStatusOpen {
+			delete(state.Conflicts, id)
+		}
+	}
+	conflict := &ConfDConflict{
+		ID:         newConflictID(),
+		Node:       nodeName,
+		Status:     ConflictStatusOpen,
+		Files:      files,
+		DetectedAt: time.Now().UTC(),
+	}
+	state.Conflicts[conflict.ID] = conflict
+	if err := state.saveLocked(); err != nil {
+		log.Printf("Warning: Failed to save conf.d sync state: %v", err)
+	}
+	copied := *conflict
+	return &copied
+}
+
+// recordConfDSync remembers the node's conf.d right after a distribution and closes
+// the node's open conflicts, which the distribution settled with the given resolution
+func (osm *O11ySourceManager) recordConfDSync(nodeName string, nodeConfig node_control.NodeConfig, resolution string) {
+	remote, err := osm.remoteConfDManifest(nodeConfig)
+	if err != nil {
+		log.Printf("Warning: Failed to record conf.d checksums of node %s: %v", nodeName, err)
+		return
+	}
+
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	now := time.Now().UTC()
+	state.Nodes[nodeName] = &confDNodeSync{Files: remote, SyncedAt: now}
+	for _, conflict := range state.Conflicts {
+		if conflict.Node == nodeName && conflict.Status == ConflictStatusOpen {
+			conflict.Status = ConflictStatusResolved
+			conflict.Resolution = resolution
+			conflict.ResolvedBy = "conf.d distribution"
+			conflict.ResolvedAt = &now
+		}
+	}
+	if err := state.saveLocked(); err != nil {
+		log.Printf("Warning: Failed to save conf.d sync state: %v", err)
+	}
+}
+
+// setConflictResolver records who resolved a conflict
+func (osm *O11ySourceManager) setConflictResolver(id, resolvedBy string) {
+	state := osm.confDSync
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if conflict, ok := state.Conflicts[id]; ok {
+		conflict.ResolvedBy = resolvedBy
+		if err := state.saveLocked(); err != nil {
+			log.Printf("Warning: Failed to save conf.d sync state: %v", err)
+		}
+	}
+}
+
+// remoteConfDManifest returns the sha256 of every file in the node's conf.d
+func (osm *O11ySourceManager) remoteConfDManifest(nodeConfig node_control.NodeConfig) (map[string]string, error) {
+	targetConfDir := path.Join(nodeConfig.ConfDir, "conf.d")
+	command := fmt.Sprintf("if [ -d %[1]s ]; then cd %[1]s && find . -type f -exec sha256sum {} +; fi", remotecmd.Quote(targetConfDir))
+	output, err := osm.sshOutput(nodeConfig, command)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		checksum, file, found := strings.Cut(line, "  ")
+		if !found {
+			continue
+		}
+		manifest[strings.TrimPrefix(file, "./")] = checksum
+	}
+	return manifest, nil
+}
+
+// localConfDManifest returns the sha256 of every file in the manager's conf.d
+func localConfDManifest(dir string) (map[string]string, error) {
+	manifest := make(map[string]string)
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		manifest[filepath.ToSlash(rel)] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum %s: %v", dir, err)
+	}
+	return manifest, nil
+}
+
+// confDFileDiff builds a unified diff from the manager's copy of a file to the node's
+func (osm *O11ySourceManager) confDFileDiff(nodeConfig node_control.NodeConfig, conflict FileConflict) string {
+	managerFile := os.DevNull
+	if conflict.ManagerChecksum != "" {
+		managerFile = filepath.Join(localConfDDir, filepath.FromSlash(conflict.Path))
+	}
+
+	nodeFile := os.DevNull
+	if conflict.Change != ChangeDeleted {
+		remoteFile := path.Join(nodeConfig.ConfDir, "conf.d", conflict.Path)
+		content, err := osm.sshOutput(nodeConfig, fmt.Sprintf("head -c %d %s", maxDiffBytes, remotecmd.Quote(remoteFile)))
+		if err != nil {
+			return fmt.Sprintf("failed to read %s from node: %v", conflict.Path, err)
+		}
+		tempFile, err := os.CreateTemp("", "confd_node_*")
+		if err != nil {
+			return fmt.Sprintf("failed to create temporary file: %v", err)
+		}
+		defer os.Remove(tempFile.Name())
+		tempFile.WriteString(content + "\n")
+		tempFile.Close()
+		nodeFile = tempFile.Name()
+	}
+
+	// diff exits with 1 when the files differ
+	output, _ := exec.Command("diff", "-u",
+		"--label", "manager/"+conflict.Path, "--label", "node/"+conflict.Path,
+		managerFile, nodeFile).CombinedOutput()
+	return string(output)
+}
+
+// keepNodeFilesCommands returns the commands that save the node's conflicting files
+// before conf.d is replaced and restore them afterwards (conflict_resolution theirs)
+func keepNodeFilesCommands(nodeName, targetConfDir string, conflicts []FileConflict) (string, string) {
+	keepDir := path.Join("/tmp", nodeName+"_confd_keep")
+	var kept, deleted []string
+	for _, conflict := range conflicts {
+		if conflict.Change == ChangeDeleted {
+			deleted = append(deleted, remotecmd.Quote(conflict.Path))
+		} else {
+			kept = append(kept, remotecmd.Quote(conflict.Path))
+		}
+	}
+
+	save := fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s", remotecmd.Quote(keepDir))
+	restore := fmt.Sprintf("cd %s", remotecmd.Quote(targetConfDir))
+	if len(kept) > 0 {
+		save += fmt.Sprintf(" && cd %s && cp -p --parents %s %s", remotecmd.Quote(targetConfDir), strings.Join(kept, " "), remotecmd.Quote(keepDir))
+		restore += fmt.Sprintf(" && cp -a %s/. .", remotecmd.Quote(keepDir))
+	}
+	if len(deleted) > 0 {
+		restore += " && rm -f " + strings.Join(deleted, " ")
+	}
+	restore += fmt.Sprintf(" && rm -rf %s", remotecmd.Quote(keepDir))
+	return save, restore
+}
+
+// sshOutput runs a command on the remote node and returns its stdout
+func (osm *O11ySourceManager) sshOutput(nodeConfig node_control.NodeConfig, command string) (string, error) {
+	output, err := node_control.SSH.Output(nodeConfig.SSHTarget(), command)
+	if err != nil {
+		return "", fmt.Errorf("SSH command failed: %v", err)
+	}
+	return strings.TrimRight(output, "\n"), nil
+}
+
+func newConflictID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return fmt.Sprintf("conflict-%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+}
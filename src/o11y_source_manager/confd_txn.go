@@ -0,0 +1,306 @@
+package o11y_source_manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"vuDataSim/src/logger"
+
+	"gopkg.in/yaml.v3"
+)
+
+// confDTxnJournal records the files a conf.d transaction is replacing, so that a
+// manager that dies halfway through the renames restores them on the next start
+const confDTxnJournal = "data/confd_txn.json"
+
+// confDTxnMutex serializes transactions, so two never interleave their renames
+var confDTxnMutex sync.Mutex
+
+// Actions of a ConfDFileChange
+const (
+	ConfDFileModified = "modified"
+	ConfDFileCreated  = "created"
+)
+
+// ConfDFileChange is a conf.d file a transaction replaced
+type ConfDFileChange struct {
+	Path   string `json:"path"` // relative to conf.d
+	Action string `json:"action"`
+}
+
+// confDTxnFile is the state of one file before the transaction, as journaled
+type confDTxnFile struct {
+	Path     string      `json:"path"`
+	Existed  bool        `json:"existed"`
+	Mode     os.FileMode `json:"mode"`
+	Original []byte      `json:"original,omitempty"`
+}
+
+// confDTxnRecord is the journal of a transaction being applied
+type confDTxnRecord struct {
+	Dir       string         `json:"dir"`
+	StartedAt time.Time      `json:"startedAt"`
+	Files     []confDTxnFile `json:"files"`
+}
+
+// ConfDTransaction stages changes to several conf.d files and applies them all or none.
+// Reads through the transaction see the staged content, so later steps build on earlier
+// ones. Commit validates every staged file, writes each to a temporary file next to it
+// and renames them all into place; if a rename fails the files already replaced are
+// restored from the snapshot taken before the first one.
+type ConfDTransaction struct {
+	dir     string
+	journal string
+	staged  map[string][]byte
+	order   []string
+}
+
+// newConfDTransaction starts a transaction on the manager's conf.d
+func newConfDTransaction() *ConfDTransaction {
+	return &ConfDTransaction{dir: localConfDDir, journal: confDTxnJournal, staged: make(map[string][]byte)}
+}
+
+// Read returns the staged content of a file, or what is on disk
+func (t *ConfDTransaction) Read(relPath string) ([]byte, error) {
+	if data, ok := t.staged[filepath.Clean(relPath)]; ok {
+		return data, nil
+	}
+	return os.ReadFile(filepath.Join(t.dir, relPath))
+}
+
+// Stage records the new content of a file; nothing is written before Commit
+func (t *ConfDTransaction) Stage(relPath string, data []byte) {
+	relPath = filepath.Clean(relPath)
+	if _, ok := t.staged[relPath]; !ok {
+		t.order = append(t.order, relPath)
+	}
+	t.staged[relPath] = data
+}
+
+// validate parses every staged file, so a transaction never applies a file the
+// simulator cannot load
+func (t *ConfDTransaction) validate() error {
+	var problems []string
+	for _, relPath := range t.order {
+		var document map[string]interface{}
+		if err := yaml.Unmarshal(t.staged[relPath], &document); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", relPath, err))
+			continue
+		}
+		if len(document) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: empty document", relPath))
+			continue
+		}
+		if filepath.Base(relPath) != "conf.yml" || filepath.Dir(relPath) == "." {
+			continue
+		}
+		// A source's conf.yml must still produce events
+		var source SourceConfig
+		if err := yaml.Unmarshal(t.staged[relPath], &source); err == nil && source.UniqueKey.NumUniqKey < 1 {
+			problems = append(problems, fmt.Sprintf("%s: uniquekey.NumUniqKey must be at least 1", relPath))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid conf.d changes, nothing was written: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Commit applies the staged files all or nothing and returns those whose content changed
+func (t *ConfDTransaction) Commit() ([]ConfDFileChange, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	confDTxnMutex.Lock()
+	defer confDTxnMutex.Unlock()
+
+	// Snapshot what is replaced, skipping files staged with their current content
+	record := confDTxnRecord{Dir: t.dir, StartedAt: time.Now().UTC()}
+	for _, relPath := range t.order {
+		file := confDTxnFile{Path: relPath, Mode: 0644}
+		path := filepath.Join(t.dir, relPath)
+		if info, err := os.Stat(path); err == nil {
+			original, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to snapshot %s: %v", relPath, err)
+			}
+			if bytes.Equal(original, t.staged[relPath]) {
+				continue
+			}
+			file.Existed, file.Mode, file.Original = true, info.Mode().Perm(), original
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to snapshot %s: %v", relPath, err)
+		}
+		record.Files = append(record.Files, file)
+	}
+	if len(record.Files) == 0 {
+		return []ConfDFileChange{}, nil
+	}
+
+	// Write every file next to its target first; a failure here leaves conf.d untouched
+	temps := make([]string, 0, len(record.Files))
+	removeTemps := func() {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}
+	for _, file := range record.Files {
+		path := filepath.Join(t.dir, file.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			removeTemps()
+			return nil, fmt.Errorf("failed to create directory of %s: %v", file.Path, err)
+		}
+		temp, err := writeSynced(filepath.Dir(path), "."+filepath.Base(path)+".txn-", t.staged[file.Path], file.Mode)
+		if err != nil {
+			removeTemps()
+			return nil, fmt.Errorf("failed to stage %s: %v", file.Path, err)
+		}
+		temps = append(temps, temp)
+	}
+
+	if err := writeTxnJournal(t.journal, &record); err != nil {
+		removeTemps()
+		return nil, fmt.Errorf("failed to write conf.d transaction journal: %v", err)
+	}
+
+	changes := make([]ConfDFileChange, 0, len(record.Files))
+	for i, file := range record.Files {
+		if err := os.Rename(temps[i], filepath.Join(t.dir, file.Path)); err != nil {
+			for _, temp := range temps[i:] {
+				os.Remove(temp)
+			}
+			rollbackErr := restoreConfDFiles(t.dir, record.Files[:i])
+			if rollbackErr == nil {
+				os.Remove(t.journal)
+				return nil, fmt.Errorf("failed to apply %s, rolled back %d applied files: %v", file.Path, i, err)
+			}
+			// The journal stays, so the next start retries the rollback
+			return nil, fmt.Errorf("failed to apply %s: %v; rollback failed: %v", file.Path, err, rollbackErr)
+		}
+		action := ConfDFileModified
+		if !file.Existed {
+			action = ConfDFileCreated
+		}
+		changes = append(changes, ConfDFileChange{Path: file.Path, Action: action})
+	}
+	if err := os.Remove(t.journal); err != nil {
+		logger.Warn().Err(err).Str("journal", t.journal).Msg("Failed to remove conf.d transaction journal")
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	logger.Info().Int("files", len(changes)).Msg("Applied conf.d transaction")
+	return changes, nil
+}
+
+// restoreConfDFiles puts back the snapshot of the files, deleting those that were created
+func restoreConfDFiles(dir string, files []confDTxnFile) error {
+	var failures []string
+	for _, file := range files {
+		path := filepath.Join(dir, file.Path)
+		if !file.Existed {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				failures = append(failures, fmt.Sprintf("%s: %v", file.Path, err))
+			}
+			continue
+		}
+		temp, err := writeSynced(filepath.Dir(path), "."+filepath.Base(path)+".txn-", file.Original, file.Mode)
+		if err == nil {
+			if err = os.Rename(temp, path); err != nil {
+				os.Remove(temp)
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", file.Path, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// writeSynced writes data to a new temporary file in dir and flushes it to disk
+func writeSynced(dir, pattern string, data []byte, mode os.FileMode) (string, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// writeTxnJournal saves the snapshot before the first rename
+func writeTxnJournal(journal string, record *confDTxnRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(journal), 0755); err != nil {
+		return err
+	}
+	temp, err := writeSynced(filepath.Dir(journal), filepath.Base(journal)+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, journal)
+}
+
+// RecoverConfDTransaction rolls back a conf.d transaction the manager did not finish, as
+// recorded in its journal, and returns the files it restored. Without a journal it does
+// nothing.
+func (osm *O11ySourceManager) RecoverConfDTransaction(journal string) ([]string, error) {
+	data, err := os.ReadFile(journal)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conf.d transaction journal: %v", err)
+	}
+	var record confDTxnRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse conf.d transaction journal %s: %v", journal, err)
+	}
+
+	confDTxnMutex.Lock()
+	defer confDTxnMutex.Unlock()
+	if err := restoreConfDFiles(record.Dir, record.Files); err != nil {
+		return nil, fmt.Errorf("failed to roll back the conf.d transaction of %s: %v", record.StartedAt.Format(time.RFC3339), err)
+	}
+	// Temporary files of the interrupted transaction
+	for _, file := range record.Files {
+		temps, _ := filepath.Glob(filepath.Join(record.Dir, filepath.Dir(file.Path), "."+filepath.Base(file.Path)+".txn-*"))
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}
+	if err := os.Remove(journal); err != nil {
+		return nil, fmt.Errorf("failed to remove conf.d transaction journal: %v", err)
+	}
+
+	restored := make([]string, 0, len(record.Files))
+	for _, file := range record.Files {
+		restored = append(restored, file.Path)
+	}
+	return restored, nil
+}
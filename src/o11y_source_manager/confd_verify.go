@@ -0,0 +1,130 @@
+package o11y_source_manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxVerifyParallel bounds how many nodes are checksummed over SSH at once
+const maxVerifyParallel = 10
+
+// ConfDNodeDrift is how one node's conf.d compares with the manager's manifest
+type ConfDNodeDrift struct {
+	Node         string          `json:"node"`
+	InSync       bool            `json:"inSync"`
+	Same         int             `json:"same"`
+	Differing    int             `json:"differing"`
+	Files        []ConfDFileDiff `json:"files"` // differing files
+	LastSyncedAt *time.Time      `json:"lastSyncedAt,omitempty"`
+	Error        string          `json:"error,omitempty"` // the node's checksums could not be read
+}
+
+// ConfDFileDrift is a conf.d file that differs on at least one node
+type ConfDFileDrift struct {
+	Path  string   `json:"path"`
+	Nodes []string `json:"nodes"`
+}
+
+// ConfDVerifyReport compares the manager's conf.d with every enabled node's
+type ConfDVerifyReport struct {
+	// ManifestChecksum is the sha256 of the sorted manifest, equal for identical trees
+	ManifestChecksum string            `json:"manifestChecksum"`
+	Manifest         map[string]string `json:"manifest"` // sha256 of every manager file, relative to conf.d
+	Nodes            []ConfDNodeDrift  `json:"nodes"`    // in node name order
+	DriftedFiles     []ConfDFileDrift  `json:"driftedFiles"`
+	InSync           int               `json:"inSync"`
+	Drifted          int               `json:"drifted"`
+	Unreachable      int               `json:"unreachable"`
+	VerifiedAt       time.Time         `json:"verifiedAt"`
+}
+
+// VerifyConfD checksums the manager's conf.d once and compares it with the conf.d of
+// every enabled node over SSH, several nodes at a time
+func (osm *O11ySourceManager) VerifyConfD() (*ConfDVerifyReport, error) {
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	localManifest, err := localConfDManifest(localConfDDir)
+	if err != nil {
+		return nil, err
+	}
+
+	enabledNodes := nodeManager.GetEnabledNodes()
+	names := make([]string, 0, len(enabledNodes))
+	for name := range enabledNodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &ConfDVerifyReport{
+		ManifestChecksum: manifestChecksum(localManifest),
+		Manifest:         localManifest,
+		Nodes:            make([]ConfDNodeDrift, len(names)),
+		DriftedFiles:     []ConfDFileDrift{},
+		VerifiedAt:       time.Now().UTC(),
+	}
+	slots := make(chan struct{}, maxVerifyParallel)
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			drift := ConfDNodeDrift{Node: name, Files: []ConfDFileDiff{}}
+			diff, err := osm.compareConfD(name, enabledNodes[name], localManifest, false)
+			if err != nil {
+				drift.Error = err.Error()
+			} else {
+				drift.InSync = diff.InSync
+				drift.Same = diff.Same
+				drift.Differing = diff.Differing
+				drift.Files = diff.Files
+				drift.LastSyncedAt = diff.LastSyncedAt
+			}
+			report.Nodes[i] = drift
+		}(i, name)
+	}
+	wg.Wait()
+
+	driftedOn := make(map[string][]string)
+	for _, drift := range report.Nodes {
+		switch {
+		case drift.Error != "":
+			report.Unreachable++
+		case drift.InSync:
+			report.InSync++
+		default:
+			report.Drifted++
+		}
+		for _, file := range drift.Files {
+			driftedOn[file.Path] = append(driftedOn[file.Path], drift.Node)
+		}
+	}
+	for file, nodes := range driftedOn {
+		report.DriftedFiles = append(report.DriftedFiles, ConfDFileDrift{Path: file, Nodes: nodes})
+	}
+	sort.Slice(report.DriftedFiles, func(i, j int) bool { return report.DriftedFiles[i].Path < report.DriftedFiles[j].Path })
+	return report, nil
+}
+
+// manifestChecksum hashes the manifest in path order, as "checksum  path" lines like
+// sha256sum prints them
+func manifestChecksum(manifest map[string]string) string {
+	files := make([]string, 0, len(manifest))
+	for file := range manifest {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	hash := sha256.New()
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s  %s\n", manifest[file], file)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
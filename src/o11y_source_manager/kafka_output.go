@@ -0,0 +1,157 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"vuDataSim/src/yamledit"
+
+	"gopkg.in/yaml.v3"
+)
+
+const kafkaOutputKey = "output.kafka"
+
+var kafkaTopicPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// KafkaOutput is the output.kafka section of a source's conf.yml
+type KafkaOutput struct {
+	Source  string   `json:"source"`
+	Defined bool     `json:"defined"` // false if the source inherits everything from the main conf.yml
+	Enabled bool     `json:"enabled"`
+	Topic   string   `json:"topic"`
+	Hosts   []string `json:"hosts,omitempty"`
+	// InheritedHosts are the brokers of the main conf.yml, used when Hosts is empty
+	InheritedHosts []string `json:"inheritedHosts,omitempty"`
+}
+
+// KafkaOutputUpdate holds the fields to change; nil fields are left untouched.
+// An empty Hosts list removes the override so the main conf.yml brokers apply again.
+type KafkaOutputUpdate struct {
+	Enabled *bool     `json:"enabled"`
+	Topic   *string   `json:"topic"`
+	Hosts   *[]string `json:"hosts"`
+}
+
+type kafkaOutputSection struct {
+	Kafka *struct {
+		Enabled *bool    `yaml:"enabled"`
+		Topic   string   `yaml:"topic"`
+		Hosts   []string `yaml:"hosts"`
+	} `yaml:"output.kafka"`
+}
+
+// sourceConfigPath returns the conf.yml path of an existing source directory
+func (osm *O11ySourceManager) sourceConfigPath(sourceName string) (string, error) {
+	if sourceName == "" || strings.ContainsAny(sourceName, `/\`) || strings.HasPrefix(sourceName, ".") {
+		return "", fmt.Errorf("invalid source name %q", sourceName)
+	}
+	configPath := filepath.Join("src/migrate/conf.d", sourceName, "conf.yml")
+	if _, err := os.Stat(configPath); err != nil {
+		return "", fmt.Errorf("source %s not found", sourceName)
+	}
+	return configPath, nil
+}
+
+// GetSourceKafkaOutput reads the output.kafka section of a source
+func (osm *O11ySourceManager) GetSourceKafkaOutput(sourceName string) (*KafkaOutput, error) {
+	configPath, err := osm.sourceConfigPath(sourceName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var section kafkaOutputSection
+	if err := yaml.Unmarshal(data, &section); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+
+	output := &KafkaOutput{Source: sourceName}
+	if section.Kafka != nil {
+		output.Defined = true
+		output.Enabled = section.Kafka.Enabled == nil || *section.Kafka.Enabled
+		output.Topic = section.Kafka.Topic
+		output.Hosts = section.Kafka.Hosts
+	}
+
+	if mainData, err := os.ReadFile("src/migrate/conf.d/conf.yml"); err == nil {
+		var mainSection kafkaOutputSection
+		if yaml.Unmarshal(mainData, &mainSection) == nil && mainSection.Kafka != nil {
+			output.InheritedHosts = mainSection.Kafka.Hosts
+			if !output.Defined {
+				output.Enabled = mainSection.Kafka.Enabled == nil || *mainSection.Kafka.Enabled
+			}
+		}
+	}
+	return output, nil
+}
+
+// ValidateKafkaOutputUpdate checks topic naming and broker addresses
+func ValidateKafkaOutputUpdate(update KafkaOutputUpdate) error {
+	if update.Enabled == nil && update.Topic == nil && update.Hosts == nil {
+		return fmt.Errorf("nothing to update: set enabled, topic or hosts")
+	}
+	if update.Topic != nil && !kafkaTopicPattern.MatchString(*update.Topic) {
+		return fmt.Errorf("invalid topic %q: use 1-249 characters of [a-zA-Z0-9._-]", *update.Topic)
+	}
+	if update.Hosts != nil {
+		for _, host := range *update.Hosts {
+			h, port, err := net.SplitHostPort(host)
+			if err != nil || h == "" {
+				return fmt.Errorf("invalid broker %q: expected host:port", host)
+			}
+			if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+				return fmt.Errorf("invalid broker %q: port must be between 1 and 65535", host)
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateSourceKafkaOutput changes only the given keys of the output.kafka block of a
+// source's conf.yml, keeping the rest of the file (comments, sub-module lists) untouched
+func (osm *O11ySourceManager) UpdateSourceKafkaOutput(sourceName string, update KafkaOutputUpdate) (*KafkaOutput, error) {
+	if err := ValidateKafkaOutputUpdate(update); err != nil {
+		return nil, err
+	}
+	configPath, err := osm.sourceConfigPath(sourceName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	document, err := yamledit.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+	if update.Enabled != nil {
+		err = document.Set(*update.Enabled, kafkaOutputKey, "enabled")
+	}
+	if err == nil && update.Topic != nil {
+		err = document.Set(*update.Topic, kafkaOutputKey, "topic")
+	}
+	if err == nil && update.Hosts != nil {
+		if len(*update.Hosts) == 0 {
+			_, err = document.Delete(kafkaOutputKey, "hosts")
+		} else {
+			err = document.Set(*update.Hosts, kafkaOutputKey, "hosts")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s block: %v", kafkaOutputKey, err)
+	}
+
+	if err := os.WriteFile(configPath, document.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write config file: %v", err)
+	}
+	return osm.GetSourceKafkaOutput(sourceName)
+}
@@ -0,0 +1,175 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lint warning kinds
+const (
+	LintUnusedSubmodule   = "unused_submodule"     // a submodule .yml no Include_sub_modules list references
+	LintMissingFile       = "missing_file"         // a referenced submodule or module dir that does not exist
+	LintDuplicateKeyName  = "duplicate_unique_key" // submodules of a source share a uniquekey name
+	LintInvalidYAML       = "invalid_yaml"
+	LintMissingSourceConf = "missing_source_conf" // a module dir without conf.yml
+)
+
+// LintWarning is one problem found in conf.d
+type LintWarning struct {
+	Kind    string   `json:"kind"`
+	Source  string   `json:"source,omitempty"`
+	Files   []string `json:"files"` // relative to conf.d
+	Message string   `json:"message"`
+}
+
+// LintReport lists the problems found in conf.d
+type LintReport struct {
+	Passed    bool          `json:"passed"`
+	Sources   int           `json:"sources"`
+	Warnings  []LintWarning `json:"warnings"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Summary is a one-line description of the report for messages and logs
+func (r *LintReport) Summary() string {
+	if r.Passed {
+		return fmt.Sprintf("No problems found in the conf.d of %d sources", r.Sources)
+	}
+	counts := make(map[string]int)
+	for _, warning := range r.Warnings {
+		counts[warning.Kind]++
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind, count := range counts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+	}
+	sort.Strings(kinds)
+	return fmt.Sprintf("%d conf.d warnings: %s", len(r.Warnings), strings.Join(kinds, ", "))
+}
+
+// LintConfD scans the local conf.d for submodule files that no source includes,
+// references to files that do not exist and uniquekey names shared by submodules
+func (osm *O11ySourceManager) LintConfD() (*LintReport, error) {
+	entries, err := os.ReadDir(localConfDDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conf.d: %v", err)
+	}
+	report := &LintReport{Warnings: []LintWarning{}}
+
+	var main struct {
+		IncludeModuleDirs map[string]ModuleDirConfig `yaml:"include_module_dirs"`
+	}
+	if data, err := os.ReadFile(filepath.Join(localConfDDir, "conf.yml")); err != nil {
+		report.add(LintMissingFile, "", fmt.Sprintf("conf.yml cannot be read: %v", err), "conf.yml")
+	} else if err := yaml.Unmarshal(data, &main); err != nil {
+		report.add(LintInvalidYAML, "", fmt.Sprintf("conf.yml: %v", err), "conf.yml")
+	}
+	dirs := make([]string, 0, len(main.IncludeModuleDirs))
+	for name := range main.IncludeModuleDirs {
+		dirs = append(dirs, name)
+	}
+	sort.Strings(dirs)
+	for _, name := range dirs {
+		if info, err := os.Stat(filepath.Join(localConfDDir, name)); err != nil || !info.IsDir() {
+			report.add(LintMissingFile, name, fmt.Sprintf("include_module_dirs lists %s, but conf.d has no such directory", name), "conf.yml")
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			report.Sources++
+			report.lintSource(entry.Name())
+		}
+	}
+	report.Passed = len(report.Warnings) == 0
+	report.CheckedAt = time.Now().UTC()
+	return report, nil
+}
+
+// lintSource checks the submodules of one module dir
+func (r *LintReport) lintSource(source string) {
+	dir := filepath.Join(localConfDDir, source)
+	confFile := filepath.Join(source, "conf.yml")
+	data, err := os.ReadFile(filepath.Join(dir, "conf.yml"))
+	if err != nil {
+		r.add(LintMissingSourceConf, source, fmt.Sprintf("%s has no readable conf.yml", source), source)
+		return
+	}
+	var config SourceConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		r.add(LintInvalidYAML, source, fmt.Sprintf("%s: %v", confFile, err), confFile)
+		return
+	}
+
+	// Glob returns the files sorted, so warnings come out in a stable order
+	files, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	var subModules []string
+	available := make(map[string]bool)
+	for _, file := range files {
+		if name := strings.TrimSuffix(filepath.Base(file), ".yml"); name != "conf" {
+			subModules = append(subModules, name)
+			available[name] = true
+		}
+	}
+
+	// Include_sub_modules: ['*'] includes every submodule
+	included := make(map[string]bool)
+	for _, name := range config.IncludeSubModules {
+		name = strings.TrimSpace(strings.Trim(name, "[]"))
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			for sub := range available {
+				included[sub] = true
+			}
+			continue
+		}
+		if !available[name] {
+			r.add(LintMissingFile, source, fmt.Sprintf("%s includes submodule %s, but %s.yml does not exist", confFile, name, name), confFile)
+			continue
+		}
+		included[name] = true
+	}
+
+	var keys []string
+	keyOwners := make(map[string][]string)
+	for _, name := range subModules {
+		file := filepath.Join(source, name+".yml")
+		if !included[name] {
+			r.add(LintUnusedSubmodule, source, fmt.Sprintf("%s is not in the Include_sub_modules list of %s", file, confFile), file)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(localConfDDir, file))
+		if err != nil {
+			r.add(LintMissingFile, source, fmt.Sprintf("%s cannot be read: %v", file, err), file)
+			continue
+		}
+		var subModule SubModuleConfig
+		if err := yaml.Unmarshal(data, &subModule); err != nil {
+			r.add(LintInvalidYAML, source, fmt.Sprintf("%s: %v", file, err), file)
+			continue
+		}
+		if key := subModule.UniqueKey.Name; key != "" {
+			if keyOwners[key] == nil {
+				keys = append(keys, key)
+			}
+			keyOwners[key] = append(keyOwners[key], file)
+		}
+	}
+	for _, key := range keys {
+		if owners := keyOwners[key]; len(owners) > 1 {
+			r.add(LintDuplicateKeyName, source, fmt.Sprintf("uniquekey %q is used by %d submodules of %s", key, len(owners), source), owners...)
+		}
+	}
+}
+
+func (r *LintReport) add(kind, source, message string, files ...string) {
+	r.Warnings = append(r.Warnings, LintWarning{Kind: kind, Source: source, Files: files, Message: message})
+}
@@ -0,0 +1,160 @@
+package o11y_source_manager
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshots of max_eps.yaml taken before each API edit; the oldest are pruned
+const (
+	maxEPSSnapshotDir   = "data/config_snapshots"
+	maxEPSSnapshotsKept = 50
+)
+
+// MaxEPSUpdate describes a change to the max EPS of one source
+type MaxEPSUpdate struct {
+	Source   string `json:"source"`
+	MaxEPS   int    `json:"maxEps"`
+	Previous *int   `json:"previous,omitempty"` // nil if the source had no limit before
+	Snapshot string `json:"snapshot"`           // copy of max_eps.yaml before the change
+}
+
+// IsKnownSource reports whether a source is listed in max_eps.yaml or has a conf.d directory
+func (osm *O11ySourceManager) IsKnownSource(sourceName string) bool {
+	if sourceName == "" || strings.ContainsAny(sourceName, `/\`) || strings.Contains(sourceName, "..") {
+		return false
+	}
+	if _, exists := osm.maxEPSConfig.MaxEPS[sourceName]; exists {
+		return true
+	}
+	info, err := os.Stat(filepath.Join("src/migrate/conf.d", sourceName))
+	return err == nil && info.IsDir()
+}
+
+// SetMaxEPS changes the max EPS of a source in max_eps.yaml. The previous file is
+// snapshotted first, and comments and commented-out sources are preserved.
+func (osm *O11ySourceManager) SetMaxEPS(sourceName string, maxEPS int) (*MaxEPSUpdate, error) {
+	if maxEPS <= 0 {
+		return nil, fmt.Errorf("max EPS must be a positive integer, got %d", maxEPS)
+	}
+	if !osm.IsKnownSource(sourceName) {
+		return nil, fmt.Errorf("source not found: %s", sourceName)
+	}
+
+	configPath := filepath.Join(osm.configsDir, "max_eps.yaml")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read max EPS config file: %v", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse max EPS config file: %v", err)
+	}
+	if err := setMaxEPSNode(&document, sourceName, maxEPS); err != nil {
+		return nil, err
+	}
+	var updated bytes.Buffer
+	encoder := yaml.NewEncoder(&updated)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, fmt.Errorf("failed to marshal max EPS config: %v", err)
+	}
+	encoder.Close()
+
+	snapshot, err := osm.snapshotMaxEPSConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, updated.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write max EPS config file: %v", err)
+	}
+	if err := os.Rename(tmp, configPath); err != nil {
+		return nil, fmt.Errorf("failed to replace max EPS config file: %v", err)
+	}
+
+	update := &MaxEPSUpdate{Source: sourceName, MaxEPS: maxEPS, Snapshot: snapshot}
+	// Swap in a new map so readers iterating the old one are not disturbed
+	next := make(map[string]int, len(osm.maxEPSConfig.MaxEPS)+1)
+	for name, value := range osm.maxEPSConfig.MaxEPS {
+		next[name] = value
+	}
+	if previous, exists := next[sourceName]; exists {
+		update.Previous = &previous
+	}
+	next[sourceName] = maxEPS
+	osm.maxEPSConfig.MaxEPS = next
+
+	log.Printf("Updated max EPS of %s to %d (snapshot %s)", sourceName, maxEPS, snapshot)
+	return update, nil
+}
+
+// setMaxEPSNode sets max_eps_config.<source> in a parsed max_eps.yaml document
+func setMaxEPSNode(document *yaml.Node, sourceName string, maxEPS int) error {
+	if document.Kind != yaml.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("max EPS config file is not a YAML mapping")
+	}
+	root := document.Content[0]
+
+	var section *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "max_eps_config" {
+			section = root.Content[i+1]
+			break
+		}
+	}
+	if section == nil {
+		section = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "max_eps_config"}, section)
+	}
+	if section.Kind != yaml.MappingNode {
+		// An empty "max_eps_config:" parses as null
+		section.Kind, section.Tag, section.Value = yaml.MappingNode, "!!map", ""
+	}
+
+	value := fmt.Sprintf("%d", maxEPS)
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		if section.Content[i].Value == sourceName {
+			section.Content[i+1].Kind = yaml.ScalarNode
+			section.Content[i+1].Tag = "!!int"
+			section.Content[i+1].Value = value
+			return nil
+		}
+	}
+	section.Content = append(section.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: sourceName},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value})
+	return nil
+}
+
+// snapshotMaxEPSConfig stores a timestamped copy of max_eps.yaml and prunes old copies
+func (osm *O11ySourceManager) snapshotMaxEPSConfig(data []byte) (string, error) {
+	dir := maxEPSSnapshotDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("max_eps-%s.yaml", time.Now().UTC().Format("20060102T150405.000Z")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to snapshot max EPS config: %v", err)
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(dir, "max_eps-*.yaml"))
+	if err == nil && len(snapshots) > maxEPSSnapshotsKept {
+		sort.Strings(snapshots)
+		for _, old := range snapshots[:len(snapshots)-maxEPSSnapshotsKept] {
+			os.Remove(old)
+		}
+	}
+	return path, nil
+}
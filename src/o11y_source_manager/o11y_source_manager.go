@@ -1,17 +1,23 @@
 package o11y_source_manager
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
+	"vuDataSim/src/jobs"
+	"vuDataSim/src/logger"
 	"vuDataSim/src/node_control"
+	"vuDataSim/src/remotecmd"
+	"vuDataSim/src/selfstats"
+	"vuDataSim/src/yamledit"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,8 +27,19 @@ type O11ySourceManager struct {
 	configsDir   string
 	maxEPSConfig MaxEPSConfig
 	mainConfig   MainConfig
+	transfers    *jobs.Scheduler
+	confDSync    *confDSyncState
 }
 
+// localConfDDir is the manager's copy of conf.d that is distributed to the nodes
+const localConfDDir = "src/migrate/conf.d"
+
+// Job types submitted to the transfer scheduler
+const (
+	JobTypeConfDDistribution = "confd_distribution"
+	JobTypeConfDPush         = "confd_push"
+)
+
 // MaxEPSConfig represents the maximum EPS configuration for each o11y source
 type MaxEPSConfig struct {
 	MaxEPS map[string]int `yaml:"max_eps_config"`
@@ -37,6 +54,7 @@ type MainConfig struct {
 type SourceConfig struct {
 	Enabled           bool      `yaml:"enabled"`
 	UniqueKey         UniqueKey `yaml:"uniquekey"`
+	Period            string    `yaml:"period"` // how often each key emits an event, e.g. 1s
 	IncludeSubModules []string  `yaml:"Include_sub_modules"`
 }
 
@@ -99,6 +117,8 @@ func NewO11ySourceManager() *O11ySourceManager {
 		configsDir:   "src/configs",
 		maxEPSConfig: MaxEPSConfig{MaxEPS: make(map[string]int)},
 		mainConfig:   MainConfig{},
+		transfers:    jobs.NewScheduler(),
+		confDSync:    newConfDSyncState(),
 	}
 }
 
@@ -244,10 +264,13 @@ func (osm *O11ySourceManager) LoadMainConfig() error {
 		return fmt.Errorf("failed to read main config file: %v", err)
 	}
 
-	err = yaml.Unmarshal(data, &osm.mainConfig)
+	// Decoded into a fresh value, so sources removed from the file are dropped too
+	var mainConfig MainConfig
+	err = yaml.Unmarshal(data, &mainConfig)
 	if err != nil {
 		return fmt.Errorf("failed to parse main config file: %v", err)
 	}
+	osm.mainConfig = mainConfig
 
 	log.Println("Loaded main configuration")
 	return nil
@@ -325,7 +348,7 @@ func (osm *O11ySourceManager) DistributeEPS(request EPSDistributionRequest) (*EP
 	}
 
 	// Apply the distribution
-	err = osm.applyEPSDistribution(sourceEPSMap)
+	changes, err := osm.applyEPSDistribution(sourceEPSMap)
 	if err != nil {
 		return &EPSDistributionResponse{
 			Success: false,
@@ -342,6 +365,7 @@ func (osm *O11ySourceManager) DistributeEPS(request EPSDistributionRequest) (*EP
 		"sourceBreakdown": osm.getSourceEPSBreakdown(),
 		"newTotalEps":     osm.calculateCurrentEPS(),
 		"updatedConfigs":  osm.getUpdatedNumUniqKeyValues(request.SelectedSources),
+		"changedFiles":    changes,
 	}
 
 	return &EPSDistributionResponse{
@@ -353,8 +377,31 @@ func (osm *O11ySourceManager) DistributeEPS(request EPSDistributionRequest) (*EP
 
 // calculateProportionalDistribution calculates EPS distribution based on max EPS values
 func (osm *O11ySourceManager) calculateProportionalDistribution(selectedSources []string, totalEPS int) (map[string]int, error) {
+	sourceEPSMap, sourceMaxEPS, err := osm.splitProportionally(selectedSources, totalEPS)
+	if err != nil {
+		return nil, err
+	}
+
+	var exceededSources []string
+	for sourceName, assignedEPS := range sourceEPSMap {
+		maxEPS := sourceMaxEPS[sourceName]
+		if assignedEPS > maxEPS {
+			exceededSources = append(exceededSources, fmt.Sprintf("%s (assigned: %d, max: %d)", sourceName, assignedEPS, maxEPS))
+		}
+	}
+
+	if len(exceededSources) > 0 {
+		return nil, fmt.Errorf("distributed EPS exceeds maximum limits for sources: %s", strings.Join(exceededSources, "; "))
+	}
+
+	return sourceEPSMap, nil
+}
+
+// splitProportionally splits totalEPS across the sources in proportion to their max EPS
+// and returns the split with the max EPS of each source
+func (osm *O11ySourceManager) splitProportionally(selectedSources []string, totalEPS int) (map[string]int, map[string]int, error) {
 	if len(selectedSources) == 0 {
-		return nil, fmt.Errorf("no sources selected")
+		return nil, nil, fmt.Errorf("no sources selected")
 	}
 
 	// Calculate total max EPS for selected sources
@@ -364,14 +411,14 @@ func (osm *O11ySourceManager) calculateProportionalDistribution(selectedSources
 	for _, sourceName := range selectedSources {
 		maxEPS, exists := osm.maxEPSConfig.MaxEPS[sourceName]
 		if !exists {
-			return nil, fmt.Errorf("max EPS not configured for source: %s", sourceName)
+			return nil, nil, fmt.Errorf("max EPS not configured for source: %s", sourceName)
 		}
 		sourceMaxEPS[sourceName] = maxEPS
 		totalMaxEPS += maxEPS
 	}
 
 	if totalMaxEPS == 0 {
-		return nil, fmt.Errorf("total max EPS is 0 for selected sources")
+		return nil, nil, fmt.Errorf("total max EPS is 0 for selected sources")
 	}
 
 	// Distribute EPS proportionally
@@ -391,49 +438,66 @@ func (osm *O11ySourceManager) calculateProportionalDistribution(selectedSources
 		}
 	}
 
-	var exceededSources []string
-	for sourceName, assignedEPS := range sourceEPSMap {
-		maxEPS := sourceMaxEPS[sourceName]
-		if assignedEPS > maxEPS {
-			exceededSources = append(exceededSources, fmt.Sprintf("%s (assigned: %d, max: %d)", sourceName, assignedEPS, maxEPS))
-		}
-	}
+	return sourceEPSMap, sourceMaxEPS, nil
+}
 
-	if len(exceededSources) > 0 {
-		return nil, fmt.Errorf("distributed EPS exceeds maximum limits for sources: %s", strings.Join(exceededSources, "; "))
+// applyEPSDistribution applies the calculated EPS distribution to source configurations.
+// The source conf.yml files and the main conf.yml are written in one transaction, so a
+// failure leaves all of them as they were.
+func (osm *O11ySourceManager) applyEPSDistribution(sourceEPSMap map[string]int) ([]ConfDFileChange, error) {
+	// Keep the loaded main config to restore it if the transaction fails
+	previous := osm.copyModuleDirs()
+	txn := newConfDTransaction()
+	if err := osm.stageEPSDistribution(txn, sourceEPSMap); err != nil {
+		osm.mainConfig.IncludeModuleDirs = previous
+		return nil, err
+	}
+	changes, err := txn.Commit()
+	if err != nil {
+		osm.mainConfig.IncludeModuleDirs = previous
+		return nil, err
 	}
+	return changes, nil
+}
 
-	return sourceEPSMap, nil
+// copyModuleDirs copies the loaded include_module_dirs, to restore after a failed transaction
+func (osm *O11ySourceManager) copyModuleDirs() map[string]ModuleDirConfig {
+	copied := make(map[string]ModuleDirConfig, len(osm.mainConfig.IncludeModuleDirs))
+	for sourceName, config := range osm.mainConfig.IncludeModuleDirs {
+		copied[sourceName] = config
+	}
+	return copied
 }
 
-// applyEPSDistribution applies the calculated EPS distribution to source configurations
-// applyEPSDistribution applies the calculated EPS distribution to source configurations
-func (osm *O11ySourceManager) applyEPSDistribution(sourceEPSMap map[string]int) error {
-	log.Printf("DEBUG: Starting applyEPSDistribution with %d sources", len(sourceEPSMap))
-	log.Printf("DEBUG: Current IncludeModuleDirs before processing has %d entries", len(osm.mainConfig.IncludeModuleDirs))
+// stageEPSDistribution stages the source conf.yml files of the distribution and the main
+// conf.yml enabling exactly its sources. It changes the loaded main config, which the
+// caller restores if the transaction is not committed.
+func (osm *O11ySourceManager) stageEPSDistribution(txn *ConfDTransaction, sourceEPSMap map[string]int) error {
+	logger.Debugf(logger.ModuleO11y, "Staging EPS distribution with %d sources", len(sourceEPSMap))
+	logger.Debugf(logger.ModuleO11y, "Current IncludeModuleDirs before processing has %d entries", len(osm.mainConfig.IncludeModuleDirs))
 
 	// Ensure the map is initialized
 	if osm.mainConfig.IncludeModuleDirs == nil {
-		log.Println("DEBUG: IncludeModuleDirs is nil, initializing...")
+		logger.Debugf(logger.ModuleO11y, "IncludeModuleDirs is nil, initializing...")
 		osm.mainConfig.IncludeModuleDirs = make(map[string]ModuleDirConfig)
 	}
 
 	// Get all available sources from max EPS config to ensure we have all sources in the map
 	for sourceName := range osm.maxEPSConfig.MaxEPS {
 		if _, exists := osm.mainConfig.IncludeModuleDirs[sourceName]; !exists {
-			log.Printf("DEBUG: Adding missing source %s to IncludeModuleDirs", sourceName)
+			logger.Debugf(logger.ModuleO11y, "Adding missing source %s to IncludeModuleDirs", sourceName)
 			osm.mainConfig.IncludeModuleDirs[sourceName] = ModuleDirConfig{Enabled: false}
 		}
 	}
 
-	log.Printf("DEBUG: After ensuring all sources exist, IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
+	logger.Debugf(logger.ModuleO11y, "After ensuring all sources exist, IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
 
 	// First, disable ALL sources in main config
 	for sourceName := range osm.mainConfig.IncludeModuleDirs {
 		config := osm.mainConfig.IncludeModuleDirs[sourceName]
 		config.Enabled = false
 		osm.mainConfig.IncludeModuleDirs[sourceName] = config
-		log.Printf("DEBUG: Disabled source: %s", sourceName)
+		logger.Debugf(logger.ModuleO11y, "Disabled source: %s", sourceName)
 	}
 
 	// Then, enable ONLY the selected sources
@@ -446,13 +510,10 @@ func (osm *O11ySourceManager) applyEPSDistribution(sourceEPSMap map[string]int)
 
 		// Calculate required main unique keys
 		assignedEPS := sourceEPSMap[sourceName]
-		requiredMainKeys := assignedEPS / totalSubKeys
-		if requiredMainKeys <= 0 {
-			requiredMainKeys = 1
-		}
+		requiredMainKeys := mainKeysForEPS(assignedEPS, totalSubKeys)
 
 		// Update the source configuration
-		err := osm.updateSourceConfig(sourceName, requiredMainKeys)
+		err := osm.updateSourceConfig(txn, sourceName, requiredMainKeys)
 		if err != nil {
 			return fmt.Errorf("failed to update config for source %s: %v", sourceName, err)
 		}
@@ -461,17 +522,27 @@ func (osm *O11ySourceManager) applyEPSDistribution(sourceEPSMap map[string]int)
 		config := osm.mainConfig.IncludeModuleDirs[sourceName]
 		config.Enabled = true
 		osm.mainConfig.IncludeModuleDirs[sourceName] = config
-		log.Printf("DEBUG: Enabled source: %s", sourceName)
+		logger.Debugf(logger.ModuleO11y, "Enabled source: %s", sourceName)
 
 		log.Printf("Updated %s: EPS=%d, MainKeys=%d, SubKeys=%d, Enabled=true",
 			sourceName, assignedEPS, requiredMainKeys, totalSubKeys)
 	}
 
-	log.Printf("DEBUG: After enabling selected sources, IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
-	log.Printf("DEBUG: About to call saveMainConfig...")
+	logger.Debugf(logger.ModuleO11y, "After enabling selected sources, IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
+	logger.Debugf(logger.ModuleO11y, "About to call stageMainConfig...")
 
-	// Save the updated main configuration
-	return osm.saveMainConfig()
+	// Save the updated main configuration together with the source configurations
+	return osm.stageMainConfig(txn)
+}
+
+// mainKeysForEPS is the NumUniqKey of a source that produces assignedEPS with the given
+// total of submodule keys, at least 1
+func mainKeysForEPS(assignedEPS, totalSubKeys int) int {
+	requiredMainKeys := assignedEPS / totalSubKeys
+	if requiredMainKeys <= 0 {
+		requiredMainKeys = 1
+	}
+	return requiredMainKeys
 }
 
 // calculateTotalSubModuleKeys calculates total submodule unique keys for a source
@@ -540,99 +611,66 @@ func (osm *O11ySourceManager) calculateTotalSubModuleKeys(sourceName string) int
 	return totalKeys
 }
 
-// updateSourceConfig updates the NumUniqKey field in a source's conf.yml file
-func (osm *O11ySourceManager) updateSourceConfig(sourceName string, numUniqKey int) error {
-	configPath := filepath.Join("src/migrate/conf.d", sourceName, "conf.yml")
+// updateSourceConfig stages the NumUniqKey field of a source's conf.yml file, leaving the
+// rest of the file as written
+func (osm *O11ySourceManager) updateSourceConfig(txn *ConfDTransaction, sourceName string, numUniqKey int) error {
+	configPath := filepath.Join(sourceName, "conf.yml")
 
-	// Read file as text to preserve formatting
-	data, err := os.ReadFile(configPath)
+	data, err := txn.Read(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %v", err)
 	}
-
-	text := string(data)
-
-	// Simple string replacement - find and replace NumUniqKey value
-	if strings.Contains(text, "NumUniqKey:") {
-		lines := strings.Split(text, "\n")
-		for i, line := range lines {
-			if strings.Contains(line, "NumUniqKey:") && strings.Contains(line, "uniquekey:") == false {
-				// This is the NumUniqKey line, replace just the number
-				parts := strings.Split(line, ":")
-				if len(parts) >= 2 {
-					lines[i] = parts[0] + ": " + fmt.Sprintf("%d", numUniqKey)
-				}
-			}
-		}
-		text = strings.Join(lines, "\n")
-	}
-
-	err = os.WriteFile(configPath, []byte(text), 0644)
+	document, err := yamledit.Parse(data)
 	if err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+		return fmt.Errorf("failed to parse %s: %v", configPath, err)
+	}
+	if err := document.Set(numUniqKey, "uniquekey", "NumUniqKey"); err != nil {
+		return fmt.Errorf("failed to set NumUniqKey in %s: %v", configPath, err)
 	}
 
+	txn.Stage(configPath, document.Bytes())
 	return nil
 }
 
-// saveMainConfig saves the main configuration to its YAML file.
-// NOTE: This approach is more robust but will remove comments and reformat the file.
+// saveMainConfig saves the main configuration to its YAML file
 func (osm *O11ySourceManager) saveMainConfig() error {
-	configPath := "src/migrate/conf.d/conf.yml"
-	log.Printf("DEBUG: Attempting to save main config to %s", configPath)
-	log.Printf("DEBUG: Current IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
+	txn := newConfDTransaction()
+	if err := osm.stageMainConfig(txn); err != nil {
+		return err
+	}
+	_, err := txn.Commit()
+	return err
+}
 
-	// --- Create a temporary structure to match the file's layout ---
-	// This ensures the output YAML has the correct top-level keys.
-	fullConfig := make(map[string]interface{})
+// stageMainConfig stages the enabled flags of include_module_dirs in the main conf.yml,
+// keeping its comments, ordering and other sections as written
+func (osm *O11ySourceManager) stageMainConfig(txn *ConfDTransaction) error {
+	configPath := "conf.yml"
+	logger.Debugf(logger.ModuleO11y, "Attempting to stage main config %s", configPath)
+	logger.Debugf(logger.ModuleO11y, "Current IncludeModuleDirs has %d entries", len(osm.mainConfig.IncludeModuleDirs))
 
-	// Read the original file to get all top-level keys (like logging, output.kafka, etc.)
-	data, err := os.ReadFile(configPath)
+	data, err := txn.Read(configPath)
 	if err != nil {
-		log.Printf("DEBUG: Failed to read original config file to preserve keys: %v", err)
 		return fmt.Errorf("failed to read main config file: %v", err)
 	}
-
-	// Unmarshal into a generic map to preserve all other sections
-	err = yaml.Unmarshal(data, &fullConfig)
+	document, err := yamledit.Parse(data)
 	if err != nil {
-		log.Printf("DEBUG: Failed to unmarshal original config: %v", err)
-		return fmt.Errorf("failed to unmarshal original main config: %v", err)
-	}
-
-	// --- Convert IncludeModuleDirs to the format expected by YAML marshaling ---
-	// The issue is that the struct values need to be converted to map[string]interface{}
-	moduleDirsMap := make(map[string]interface{})
-	for sourceName, config := range osm.mainConfig.IncludeModuleDirs {
-		moduleDirsMap[sourceName] = map[string]interface{}{
-			"enabled": config.Enabled,
-		}
+		return fmt.Errorf("failed to parse main config: %v", err)
 	}
 
-	log.Printf("DEBUG: Converted %d sources to map format", len(moduleDirsMap))
-
-	// --- Overwrite the 'include_module_dirs' section with our updated data ---
-	fullConfig["include_module_dirs"] = moduleDirsMap
-
-	// --- Marshal the updated configuration map to YAML ---
-	var buf bytes.Buffer
-	encoder := yaml.NewEncoder(&buf)
-	encoder.SetIndent(2) // Keep the indentation clean
-	err = encoder.Encode(fullConfig)
-	if err != nil {
-		log.Printf("DEBUG: Failed to marshal updated config map: %v", err)
-		return fmt.Errorf("failed to marshal updated main config: %v", err)
+	sourceNames := make([]string, 0, len(osm.mainConfig.IncludeModuleDirs))
+	for sourceName := range osm.mainConfig.IncludeModuleDirs {
+		sourceNames = append(sourceNames, sourceName)
 	}
-
-	// --- Write the new YAML content to the file ---
-	log.Println("DEBUG: YAML marshalled successfully. Writing back to file...")
-	err = os.WriteFile(configPath, buf.Bytes(), 0644)
-	if err != nil {
-		log.Printf("DEBUG: FAILED to write updated main config file: %v", err)
-		return fmt.Errorf("failed to write updated main config file: %v", err)
+	sort.Strings(sourceNames)
+	for _, sourceName := range sourceNames {
+		enabled := osm.mainConfig.IncludeModuleDirs[sourceName].Enabled
+		if err := document.Set(enabled, "include_module_dirs", sourceName, "enabled"); err != nil {
+			return fmt.Errorf("failed to set %s enabled in main config: %v", sourceName, err)
+		}
 	}
 
-	log.Println("DEBUG: Successfully saved main config file.")
+	txn.Stage(configPath, document.Bytes())
 	return nil
 }
 
@@ -839,6 +877,115 @@ func (osm *O11ySourceManager) DisableSource(sourceName string) error {
 	return osm.saveMainConfig()
 }
 
+// ApplySourceEPS sets the per-node EPS of individual enabled sources, leaving all other
+// sources untouched. It is used for live adjustments while a run is active. The sources'
+// conf.yml files are written in one transaction; it returns those that changed.
+func (osm *O11ySourceManager) ApplySourceEPS(perNodeEPS map[string]int) ([]ConfDFileChange, error) {
+	for sourceName, eps := range perNodeEPS {
+		if err := osm.checkSourceEPS(sourceName); err != nil {
+			return nil, err
+		}
+		if eps <= 0 {
+			return nil, fmt.Errorf("EPS for source %s must be greater than 0", sourceName)
+		}
+		if maxEPS := osm.maxEPSConfig.MaxEPS[sourceName]; eps > maxEPS {
+			return nil, fmt.Errorf("EPS %d exceeds maximum %d for source %s", eps, maxEPS, sourceName)
+		}
+	}
+
+	txn := newConfDTransaction()
+	if err := osm.stageSourceEPS(txn, perNodeEPS); err != nil {
+		return nil, err
+	}
+	return txn.Commit()
+}
+
+// AdjustEPS changes the EPS of a running simulation: a non-zero totalEPS is split across
+// the enabled nodes and distributed over the enabled sources like DistributeEPS, then
+// sourceEPS sets the cluster-wide EPS of individual sources on top. Everything is
+// validated before anything is staged, and the distribution and the overrides are
+// written in one transaction, so conf.d gets all of it or none.
+func (osm *O11ySourceManager) AdjustEPS(totalEPS int, sourceEPS map[string]int) ([]ConfDFileChange, error) {
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	numNodes := len(nodeManager.GetEnabledNodes())
+	if numNodes == 0 {
+		return nil, fmt.Errorf("no enabled nodes")
+	}
+
+	perNodeEPS := make(map[string]int, len(sourceEPS))
+	for sourceName, eps := range sourceEPS {
+		if err := osm.checkSourceEPS(sourceName); err != nil {
+			return nil, err
+		}
+		if eps < numNodes {
+			return nil, fmt.Errorf("EPS %d for source %s is below the %d enabled nodes; each node needs at least 1 EPS", eps, sourceName, numNodes)
+		}
+		perNodeEPS[sourceName] = eps / numNodes
+		if maxEPS := osm.maxEPSConfig.MaxEPS[sourceName]; perNodeEPS[sourceName] > maxEPS {
+			return nil, fmt.Errorf("EPS %d for source %s exceeds its maximum of %d per node (%d across %d nodes)",
+				eps, sourceName, maxEPS, maxEPS*numNodes, numNodes)
+		}
+	}
+	var distribution map[string]int
+	if totalEPS > 0 {
+		var err error
+		if distribution, err = osm.calculateProportionalDistribution(osm.GetEnabledSources(), totalEPS/numNodes); err != nil {
+			return nil, err
+		}
+	}
+
+	previous := osm.copyModuleDirs()
+	txn := newConfDTransaction()
+	err := func() error {
+		if distribution != nil {
+			if err := osm.stageEPSDistribution(txn, distribution); err != nil {
+				return err
+			}
+		}
+		return osm.stageSourceEPS(txn, perNodeEPS)
+	}()
+	if err != nil {
+		osm.mainConfig.IncludeModuleDirs = previous
+		return nil, err
+	}
+	changes, err := txn.Commit()
+	if err != nil {
+		osm.mainConfig.IncludeModuleDirs = previous
+		return nil, err
+	}
+	return changes, nil
+}
+
+// checkSourceEPS fails unless the source has a max EPS and is enabled
+func (osm *O11ySourceManager) checkSourceEPS(sourceName string) error {
+	if _, exists := osm.maxEPSConfig.MaxEPS[sourceName]; !exists {
+		return fmt.Errorf("source not found: %s", sourceName)
+	}
+	if !osm.mainConfig.IncludeModuleDirs[sourceName].Enabled {
+		return fmt.Errorf("source %s is not enabled", sourceName)
+	}
+	return nil
+}
+
+// stageSourceEPS stages the NumUniqKey of each source for its per-node EPS
+func (osm *O11ySourceManager) stageSourceEPS(txn *ConfDTransaction, perNodeEPS map[string]int) error {
+	for sourceName, eps := range perNodeEPS {
+		totalSubKeys := osm.calculateTotalSubModuleKeys(sourceName)
+		if totalSubKeys == 0 {
+			totalSubKeys = 1
+		}
+		requiredMainKeys := mainKeysForEPS(eps, totalSubKeys)
+		if err := osm.updateSourceConfig(txn, sourceName, requiredMainKeys); err != nil {
+			return fmt.Errorf("failed to update config for source %s: %v", sourceName, err)
+		}
+		log.Printf("Staged %s: EPS=%d, MainKeys=%d, SubKeys=%d", sourceName, eps, requiredMainKeys, totalSubKeys)
+	}
+	return nil
+}
+
 // GetMaxEPSConfig returns the maximum EPS configuration
 func (osm *O11ySourceManager) GetMaxEPSConfig() map[string]int {
 	return osm.maxEPSConfig.MaxEPS
@@ -874,9 +1021,10 @@ func (osm *O11ySourceManager) getUpdatedNumUniqKeyValues(selectedSources []strin
 
 // ConfDNodeResult represents the result of conf.d distribution to a single node
 type ConfDNodeResult struct {
-	NodeName string `json:"nodeName"`
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
+	NodeName   string `json:"nodeName"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+	ConflictID string `json:"conflictId,omitempty"` // set when hand edits on the node blocked the distribution
 }
 
 // ConfDDistributionResponse represents the response after conf.d distribution
@@ -887,25 +1035,67 @@ type ConfDDistributionResponse struct {
 	Distribution map[string]ConfDNodeResult `json:"distribution"`
 }
 
-// DistributeConfD distributes the conf.d directory to all enabled nodes
-// DistributeConfD distributes the conf.d directory to all enabled nodes
-// DistributeConfD distributes the conf.d directory to all enabled nodes
+// confDResults collects per-node results of a distribution job, written from scheduler goroutines
+type confDResults struct {
+	mutex  sync.Mutex
+	byNode map[string]ConfDNodeResult
+}
+
+func (r *confDResults) set(result ConfDNodeResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.byNode[result.NodeName] = result
+}
+
+func (r *confDResults) snapshot() map[string]ConfDNodeResult {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	copied := make(map[string]ConfDNodeResult, len(r.byNode))
+	for name, result := range r.byNode {
+		copied[name] = result
+	}
+	return copied
+}
+
+// SetTransferScheduler shares a transfer scheduler, so distribution jobs from every
+// caller draw from the same global budget
+func (osm *O11ySourceManager) SetTransferScheduler(scheduler *jobs.Scheduler) {
+	osm.transfers = scheduler
+}
+
+// applyTransferBudget refreshes the scheduler budget from the cluster settings
+func (osm *O11ySourceManager) applyTransferBudget(nodeManager *node_control.NodeManager) {
+	settings := nodeManager.GetClusterSettings()
+	osm.transfers.SetBudget(settings.MaxConcurrentTransfers, settings.TransferBandwidthKbps)
+}
+
+// DistributeConfD distributes the conf.d directory to all enabled nodes and waits for the job to finish
 func (osm *O11ySourceManager) DistributeConfD() (*ConfDDistributionResponse, error) {
-	log.Println("Starting conf.d distribution to all enabled nodes...")
+	return osm.distributeConfD(nil)
+}
 
-	// Load node manager to access node configurations
-	nodeManager := osm.getNodeManager()
-	if nodeManager == nil {
+// DistributeConfDToNodes distributes the conf.d directory to the given enabled nodes only
+// and waits for the job to finish. Hand edits are handled as in DistributeConfD.
+func (osm *O11ySourceManager) DistributeConfDToNodes(nodeNames []string) (*ConfDDistributionResponse, error) {
+	only := make(map[string]bool, len(nodeNames))
+	for _, name := range nodeNames {
+		only[name] = true
+	}
+	return osm.distributeConfD(only)
+}
+
+// distributeConfD distributes conf.d to the enabled nodes in only, or to all enabled
+// nodes if only is nil, and waits for the job to finish
+func (osm *O11ySourceManager) distributeConfD(only map[string]bool) (*ConfDDistributionResponse, error) {
+	jobID, results, totalNodes, err := osm.startConfDDistribution(only)
+	if err != nil {
 		return &ConfDDistributionResponse{
 			Success: false,
-			Message: "Node manager not available",
-		}, fmt.Errorf("node manager not available")
+			Message: err.Error(),
+		}, err
 	}
 
-	// Get enabled nodes
-	enabledNodes := nodeManager.GetEnabledNodes()
-	if len(enabledNodes) == 0 {
-		log.Println("No enabled nodes found to distribute conf.d to")
+	if totalNodes == 0 {
 		return &ConfDDistributionResponse{
 			Success: true,
 			Message: "No enabled nodes found to distribute conf.d to",
@@ -913,90 +1103,297 @@ func (osm *O11ySourceManager) DistributeConfD() (*ConfDDistributionResponse, err
 				"distributedNodes": 0,
 				"totalNodes":       0,
 				"successRate":      "0/0",
+				"jobId":            jobID,
 			},
 			Distribution: make(map[string]ConfDNodeResult),
 		}, nil
 	}
 
+	if _, err := osm.transfers.Wait(jobID); err != nil {
+		return &ConfDDistributionResponse{
+			Success: false,
+			Message: err.Error(),
+		}, err
+	}
+
+	distributionResults := results.snapshot()
+	successCount, conflictCount := 0, 0
+	for _, result := range distributionResults {
+		if result.Success {
+			successCount++
+		}
+		if result.ConflictID != "" {
+			conflictCount++
+		}
+	}
+
+	successRate := fmt.Sprintf("%d/%d", successCount, totalNodes)
+	message := fmt.Sprintf("Conf.d distribution completed: %s nodes successful", successRate)
+	if conflictCount > 0 {
+		message = fmt.Sprintf("%s, %d nodes skipped because of local edits (see /api/o11y/confd/conflicts)", message, conflictCount)
+	}
+
+	response := &ConfDDistributionResponse{
+		Success: successCount == totalNodes,
+		Message: message,
+		Data: map[string]interface{}{
+			"distributedNodes": successCount,
+			"totalNodes":       totalNodes,
+			"successRate":      successRate,
+			"conflicts":        conflictCount,
+			"jobId":            jobID,
+		},
+		Distribution: distributionResults,
+	}
+
+	log.Printf("✓ Conf.d distribution completed successfully to %d/%d nodes", successCount, totalNodes)
+	return response, nil
+}
+
+// StartConfDDistribution queues conf.d distribution to all enabled nodes and returns the
+// job ID immediately; progress is reported by the transfer scheduler
+func (osm *O11ySourceManager) StartConfDDistribution() (string, error) {
+	jobID, _, _, err := osm.startConfDDistribution(nil)
+	return jobID, err
+}
+
+// startConfDDistribution packs conf.d and submits one transfer task per enabled node in
+// only, or per enabled node if only is nil
+func (osm *O11ySourceManager) startConfDDistribution(only map[string]bool) (string, *confDResults, int, error) {
+	log.Println("Starting conf.d distribution to all enabled nodes...")
+
+	// Load node manager to access node configurations
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return "", nil, 0, fmt.Errorf("node manager not available")
+	}
+	osm.applyTransferBudget(nodeManager)
+
+	results := &confDResults{byNode: make(map[string]ConfDNodeResult)}
+
+	// Get enabled nodes
+	enabledNodes := nodeManager.GetEnabledNodes()
+	if only != nil {
+		for nodeName := range enabledNodes {
+			if !only[nodeName] {
+				delete(enabledNodes, nodeName)
+			}
+		}
+	}
+	if len(enabledNodes) == 0 {
+		log.Println("No enabled nodes found to distribute conf.d to")
+		return osm.transfers.Submit(JobTypeConfDDistribution, nil, nil), results, 0, nil
+	}
+
 	log.Printf("Found %d enabled nodes to distribute conf.d to", len(enabledNodes))
 
-	// Create temporary tar file from local conf.d directory
-	tempTarFile := "/tmp/confd_backup.tar.gz"
-	localConfDir := "src/migrate/conf.d"
+	tempTarFile, tarSize, err := packConfD(localConfDDir)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	localManifest, err := localConfDManifest(localConfDDir)
+	if err != nil {
+		os.Remove(tempTarFile)
+		return "", nil, 0, err
+	}
+	resolution := nodeManager.GetClusterSettings().ConflictResolution
+
+	tasks := make([]jobs.Task, 0, len(enabledNodes))
+	for nodeName, nodeConfig := range enabledNodes {
+		nodeName, nodeConfig := nodeName, nodeConfig
+		tasks = append(tasks, jobs.Task{
+			Name:  nodeName,
+			Bytes: tarSize,
+			Run: func(limitKbps int) error {
+				log.Printf("Distributing conf.d to node: %s (host: %s, conf_dir: %s, limit: %d Kbit/s)", nodeName, nodeConfig.Host, nodeConfig.ConfDir, limitKbps)
+
+				result := osm.distributeConfDToNode(nodeName, nodeConfig, tempTarFile, limitKbps, localManifest, resolution)
+				results.set(result)
+				if !result.Success {
+					log.Printf("✗ Failed to distribute conf.d to node: %s - %s", nodeName, result.Message)
+					err := fmt.Errorf("%s: %s", nodeName, result.Message)
+					selfstats.Record(selfstats.CategoryDistribution, err)
+					return err
+				}
+				selfstats.Record(selfstats.CategoryDistribution, nil)
+				log.Printf("✓ Successfully distributed conf.d to node: %s", nodeName)
+				return nil
+			},
+		})
+	}
 
+	jobID := osm.transfers.Submit(JobTypeConfDDistribution, tasks, func(jobs.JobStatus) {
+		// Clean up temporary tar file
+		if err := os.Remove(tempTarFile); err != nil {
+			log.Printf("Warning: Failed to remove temporary tar file %s: %v", tempTarFile, err)
+		}
+	})
+	return jobID, results, len(enabledNodes), nil
+}
+
+// packConfD archives the conf.d directory itself into a temporary tar.gz. Each job gets
+// its own archive, so concurrent distributions don't overwrite each other.
+func packConfD(localConfDir string) (string, int64, error) {
 	// Check if local conf.d directory exists
 	if _, err := os.Stat(localConfDir); os.IsNotExist(err) {
-		return &ConfDDistributionResponse{
-			Success: false,
-			Message: fmt.Sprintf("Local conf.d directory not found: %s", localConfDir),
-		}, fmt.Errorf("local conf.d directory not found: %s", localConfDir)
+		return "", 0, fmt.Errorf("local conf.d directory not found: %s", localConfDir)
 	}
 
+	tempFile, err := os.CreateTemp("", "confd_backup_*.tar.gz")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temporary tar file: %v", err)
+	}
+	tempTarFile := tempFile.Name()
+	tempFile.Close()
+
 	// Create tar command - include the conf.d directory itself
 	tarCmd := exec.Command("tar", "-czf", tempTarFile, "-C", filepath.Dir(localConfDir), filepath.Base(localConfDir))
 	log.Printf("Creating temporary tar file: tar -czf %s -C %s %s", tempTarFile, filepath.Dir(localConfDir), filepath.Base(localConfDir))
 
 	if err := tarCmd.Run(); err != nil {
-		return &ConfDDistributionResponse{
-			Success: false,
-			Message: fmt.Sprintf("Failed to create tar file: %v", err),
-		}, fmt.Errorf("failed to create tar file: %v", err)
+		os.Remove(tempTarFile)
+		return "", 0, fmt.Errorf("failed to create tar file: %v", err)
 	}
 
-	defer func() {
-		// Clean up temporary tar file
-		if err := os.Remove(tempTarFile); err != nil {
-			log.Printf("Warning: Failed to remove temporary tar file %s: %v", tempTarFile, err)
-		}
-	}()
+	var tarSize int64
+	if info, err := os.Stat(tempTarFile); err == nil {
+		tarSize = info.Size()
+	}
+	return tempTarFile, tarSize, nil
+}
 
-	// Distribute to each enabled node
-	distributionResults := make(map[string]ConfDNodeResult)
-	successCount := 0
+// PushConfDFiles copies individual files (relative to conf.d) to every enabled node,
+// so small changes can be rolled out without replacing the whole directory
+func (osm *O11ySourceManager) PushConfDFiles(relPaths []string) (map[string]ConfDNodeResult, error) {
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	return osm.pushConfDFiles(nodeManager, nodeManager.GetEnabledNodes(), relPaths)
+}
 
-	for nodeName, nodeConfig := range enabledNodes {
-		log.Printf("Distributing conf.d to node: %s (host: %s, conf_dir: %s)", nodeName, nodeConfig.Host, nodeConfig.ConfDir)
+// PushConfDFilesToNode copies individual files (relative to conf.d) to one enabled node
+// only, leaving the other nodes on their current files
+func (osm *O11ySourceManager) PushConfDFilesToNode(nodeName string, relPaths []string) (ConfDNodeResult, error) {
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return ConfDNodeResult{}, fmt.Errorf("node manager not available")
+	}
+	nodeConfig, ok := nodeManager.GetEnabledNodes()[nodeName]
+	if !ok {
+		return ConfDNodeResult{}, fmt.Errorf("node %s not found or not enabled", nodeName)
+	}
+	results, err := osm.pushConfDFiles(nodeManager, map[string]node_control.NodeConfig{nodeName: nodeConfig}, relPaths)
+	if err != nil {
+		return ConfDNodeResult{}, err
+	}
+	return results[nodeName], nil
+}
 
-		result := osm.distributeConfDToNode(nodeName, nodeConfig, tempTarFile)
-		distributionResults[nodeName] = result
+// pushConfDFiles copies the files to the given nodes through the transfer scheduler
+func (osm *O11ySourceManager) pushConfDFiles(nodeManager *node_control.NodeManager, nodes map[string]node_control.NodeConfig, relPaths []string) (map[string]ConfDNodeResult, error) {
+	osm.applyTransferBudget(nodeManager)
 
-		if result.Success {
-			successCount++
-			log.Printf("✓ Successfully distributed conf.d to node: %s", nodeName)
-		} else {
-			log.Printf("✗ Failed to distribute conf.d to node: %s - %s", nodeName, result.Message)
+	localConfDir := localConfDDir
+	var totalBytes int64
+	for _, relPath := range relPaths {
+		if info, err := os.Stat(filepath.Join(localConfDir, relPath)); err == nil {
+			totalBytes += info.Size()
 		}
 	}
 
-	successRate := fmt.Sprintf("%d/%d", successCount, len(enabledNodes))
-	message := fmt.Sprintf("Conf.d distribution completed: %s nodes successful", successRate)
-
-	response := &ConfDDistributionResponse{
-		Success: successCount == len(enabledNodes),
-		Message: message,
-		Data: map[string]interface{}{
-			"distributedNodes": successCount,
-			"totalNodes":       len(enabledNodes),
-			"successRate":      successRate,
-		},
-		Distribution: distributionResults,
+	results := &confDResults{byNode: make(map[string]ConfDNodeResult)}
+	var tasks []jobs.Task
+	for nodeName, nodeConfig := range nodes {
+		nodeName, nodeConfig := nodeName, nodeConfig
+		tasks = append(tasks, jobs.Task{
+			Name:  nodeName,
+			Bytes: totalBytes,
+			Run: func(limitKbps int) error {
+				result := ConfDNodeResult{NodeName: nodeName, Success: true}
+				for _, relPath := range relPaths {
+					remotePath := remotecmd.Join(nodeConfig.ConfDir, "conf.d", relPath)
+					if err := osm.sshExec(nodeConfig, remotecmd.MakeDirs(path.Dir(remotePath))); err != nil {
+						result.Success = false
+						result.Message = fmt.Sprintf("Failed to create directory for %s: %v", relPath, err)
+						break
+					}
+					if err := osm.scpCopy(nodeConfig, filepath.Join(localConfDir, relPath), remotePath, limitKbps); err != nil {
+						result.Success = false
+						result.Message = fmt.Sprintf("Failed to copy %s: %v", relPath, err)
+						break
+					}
+				}
+				if result.Success {
+					result.Message = fmt.Sprintf("Pushed %d files", len(relPaths))
+				}
+				results.set(result)
+				if !result.Success {
+					err := fmt.Errorf("%s: %s", nodeName, result.Message)
+					selfstats.Record(selfstats.CategoryDistribution, err)
+					return err
+				}
+				selfstats.Record(selfstats.CategoryDistribution, nil)
+				return nil
+			},
+		})
 	}
 
-	log.Printf("✓ Conf.d distribution completed successfully to %d/%d nodes", successCount, len(enabledNodes))
-	return response, nil
+	jobID := osm.transfers.Submit(JobTypeConfDPush, tasks, nil)
+	if _, err := osm.transfers.Wait(jobID); err != nil {
+		return nil, err
+	}
+	return results.snapshot(), nil
 }
 
-// distributeConfDToNode distributes conf.d to a single node
-func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig node_control.NodeConfig, tempTarFile string) ConfDNodeResult {
+// distributeConfDToNode distributes conf.d to a single node. Files edited on the node
+// since the last distribution are handled according to resolution (manual, ours, theirs).
+func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig node_control.NodeConfig, tempTarFile string, limitKbps int, localManifest map[string]string, resolution string) ConfDNodeResult {
 	log.Printf("Starting conf.d replacement for node %s", nodeConfig.Host)
 
 	// nodeConfig.ConfDir is the parent directory where conf.d should be placed (e.g., /path/to/)
 	// We need to create /path/to/conf.d
-	targetConfDir := filepath.Join(nodeConfig.ConfDir, "conf.d")
+	targetConfDir := remotecmd.Join(nodeConfig.ConfDir, "conf.d")
+
+	conflicts, err := osm.checkConfDConflicts(nodeName, nodeConfig, localManifest)
+	if err != nil {
+		return ConfDNodeResult{
+			NodeName: nodeName,
+			Success:  false,
+			Message:  fmt.Sprintf("Failed to check conf.d for local edits: %v", err),
+		}
+	}
+	var restoreCmd string
+	if len(conflicts) > 0 {
+		switch resolution {
+		case ConflictOurs:
+			log.Printf("Overwriting %d locally edited conf.d files on node %s (conflict_resolution: ours)", len(conflicts), nodeName)
+		case ConflictTheirs:
+			log.Printf("Keeping %d locally edited conf.d files on node %s (conflict_resolution: theirs)", len(conflicts), nodeName)
+			var saveCmd string
+			saveCmd, restoreCmd = keepNodeFilesCommands(nodeName, targetConfDir, conflicts)
+			if err := osm.sshExec(nodeConfig, saveCmd); err != nil {
+				return ConfDNodeResult{
+					NodeName: nodeName,
+					Success:  false,
+					Message:  fmt.Sprintf("Failed to save locally edited files: %v", err),
+				}
+			}
+		default:
+			conflict := osm.recordConfDConflict(nodeName, nodeConfig, conflicts)
+			log.Printf("✗ conf.d on node %s has %d locally edited files, distribution skipped until conflict %s is resolved", nodeName, len(conflicts), conflict.ID)
+			return ConfDNodeResult{
+				NodeName:   nodeName,
+				Success:    false,
+				Message:    fmt.Sprintf("conf.d on the node has %d locally edited files; resolve conflict %s before it is overwritten", len(conflicts), conflict.ID),
+				ConflictID: conflict.ID,
+			}
+		}
+	}
 
 	// Remove existing conf.d directory on remote node
 	log.Printf("Removing existing conf.d directory on remote node: rm -rf %s", targetConfDir)
-	err := osm.sshExec(nodeConfig, fmt.Sprintf("rm -rf %s", targetConfDir))
+	err = osm.sshExec(nodeConfig, remotecmd.RemoveAll(targetConfDir))
 	if err != nil {
 		return ConfDNodeResult{
 			NodeName: nodeName,
@@ -1007,7 +1404,7 @@ func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig
 
 	// Ensure parent directory exists
 	log.Printf("Creating parent directory if needed: mkdir -p %s", nodeConfig.ConfDir)
-	err = osm.sshExec(nodeConfig, fmt.Sprintf("mkdir -p %s", nodeConfig.ConfDir))
+	err = osm.sshExec(nodeConfig, remotecmd.MakeDirs(nodeConfig.ConfDir))
 	if err != nil {
 		return ConfDNodeResult{
 			NodeName: nodeName,
@@ -1017,9 +1414,9 @@ func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig
 	}
 
 	// Copy tar file to a temporary location
-	remoteTarPath := filepath.Join("/tmp", "confd_backup_"+nodeName+".tar.gz")
+	remoteTarPath := remotecmd.Join("/tmp", nodeName+"_"+filepath.Base(tempTarFile))
 	log.Printf("Copying tar file to remote node: scp %s to %s", tempTarFile, remoteTarPath)
-	err = osm.scpCopy(nodeConfig, tempTarFile, remoteTarPath)
+	err = osm.scpCopy(nodeConfig, tempTarFile, remoteTarPath, limitKbps)
 	if err != nil {
 		return ConfDNodeResult{
 			NodeName: nodeName,
@@ -1030,12 +1427,7 @@ func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig
 
 	// Extract tar file to the target directory
 	// The tar contains "conf.d/" so it will create conf.d in nodeConfig.ConfDir
-	extractAndCleanupCmd := fmt.Sprintf(
-		"cd %s && tar -xzf %s && rm %s",
-		nodeConfig.ConfDir,
-		remoteTarPath,
-		remoteTarPath,
-	)
+	extractAndCleanupCmd := remotecmd.ExtractTar(nodeConfig.ConfDir, remoteTarPath)
 
 	log.Printf("Extracting tar file on remote node: %s", extractAndCleanupCmd)
 	err = osm.sshExec(nodeConfig, extractAndCleanupCmd)
@@ -1048,12 +1440,12 @@ func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig
 	}
 
 	// Verify the conf.d directory exists in the target location
-	verifyCmd := fmt.Sprintf("test -d %s", targetConfDir)
+	verifyCmd := remotecmd.TestDir(targetConfDir)
 	log.Printf("Verifying conf.d directory exists at: %s", targetConfDir)
 	err = osm.sshExec(nodeConfig, verifyCmd)
 	if err != nil {
 		// Additional debug: list the parent directory to see what was created
-		listCmd := fmt.Sprintf("ls -la %s", nodeConfig.ConfDir)
+		listCmd := remotecmd.ListDir(nodeConfig.ConfDir)
 		osm.sshExec(nodeConfig, listCmd)
 
 		return ConfDNodeResult{
@@ -1063,55 +1455,47 @@ func (osm *O11ySourceManager) distributeConfDToNode(nodeName string, nodeConfig
 		}
 	}
 
+	message := fmt.Sprintf("Conf.d distributed successfully to %s", targetConfDir)
+	if restoreCmd != "" {
+		if err := osm.sshExec(nodeConfig, restoreCmd); err != nil {
+			return ConfDNodeResult{
+				NodeName: nodeName,
+				Success:  false,
+				Message:  fmt.Sprintf("Failed to restore locally edited files: %v", err),
+			}
+		}
+		message = fmt.Sprintf("%s, kept %d locally edited files", message, len(conflicts))
+	} else if len(conflicts) > 0 {
+		message = fmt.Sprintf("%s, overwrote %d locally edited files", message, len(conflicts))
+	}
+	// Without conflicts the node matches the manager again, as after resolving with ours
+	settled := ConflictOurs
+	if restoreCmd != "" {
+		settled = ConflictTheirs
+	}
+	osm.recordConfDSync(nodeName, nodeConfig, settled)
+
 	log.Printf("✓ Conf.d replacement completed for node %s at %s", nodeConfig.Host, targetConfDir)
 	return ConfDNodeResult{
 		NodeName: nodeName,
 		Success:  true,
-		Message:  fmt.Sprintf("Conf.d distributed successfully to %s", targetConfDir),
+		Message:  message,
 	}
 }
 
 // sshExec executes a command on the remote node via SSH
 func (osm *O11ySourceManager) sshExec(nodeConfig node_control.NodeConfig, command string) error {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		fmt.Sprintf("%s@%s", nodeConfig.User, nodeConfig.Host),
-		command,
-	}
-
-	cmd := exec.Command("ssh", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err != nil {
+	if err := node_control.SSH.Run(nodeConfig.SSHTarget(), command); err != nil {
 		return fmt.Errorf("SSH command failed: %v", err)
 	}
 
 	return nil
 }
 
-// scpCopy copies a file to the remote node
-func (osm *O11ySourceManager) scpCopy(nodeConfig node_control.NodeConfig, localPath, remotePath string) error {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		localPath,
-		fmt.Sprintf("%s@%s:%s", nodeConfig.User, nodeConfig.Host, remotePath),
-	}
-
-	cmd := exec.Command("scp", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("SCP copy failed: %v", err)
+// scpCopy copies a file to the remote node, limited to limitKbps Kbit/s when non-zero
+func (osm *O11ySourceManager) scpCopy(nodeConfig node_control.NodeConfig, localPath, remotePath string, limitKbps int) error {
+	if err := node_control.SSH.CopyFile(nodeConfig.SSHTarget(), localPath, remotePath, limitKbps); err != nil {
+		return fmt.Errorf("copy failed: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,137 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ramp profile types
+const (
+	RampStep   = "step"   // climbs from start to end by stepSize every stepEvery
+	RampLinear = "linear" // moves evenly from start to end over duration, updated every stepEvery
+	RampSpike  = "spike"  // holds start for stepEvery, jumps to end for duration and drops back
+)
+
+// Ramp limits
+const (
+	rampMinInterval = 10 * time.Second // every step redistributes conf.d and restarts the simulators
+	rampMaxPoints   = 500
+	rampMaxEPS      = 100000
+)
+
+// RampProfile describes how the total EPS of a run changes over time, e.g.
+// {"type": "step", "start": 1000, "end": 50000, "stepEvery": "5m"}
+type RampProfile struct {
+	Type      string `json:"type"`
+	Start     int    `json:"start"` // cluster-wide EPS
+	End       int    `json:"end"`   // may be below start to ramp down
+	StepEvery string `json:"stepEvery"`
+	StepSize  int    `json:"stepSize,omitempty"` // step: EPS added per step, default a tenth of the range
+	Duration  string `json:"duration,omitempty"` // linear: time from start to end; spike: time at end
+	Repeat    int    `json:"repeat,omitempty"`   // spike: number of spikes, default 1
+}
+
+// RampPoint is the total EPS a ramp sets at an offset from its start
+type RampPoint struct {
+	Offset time.Duration `json:"offset"`
+	EPS    int           `json:"eps"`
+}
+
+// Plan validates the profile and returns the points it sets, by offset. The last point
+// is the EPS the run keeps when the ramp ends.
+func (p RampProfile) Plan() ([]RampPoint, error) {
+	for name, eps := range map[string]int{"start": p.Start, "end": p.End} {
+		if eps < 1 || eps > rampMaxEPS {
+			return nil, fmt.Errorf("%s must be between 1 and %d EPS, got %d", name, rampMaxEPS, eps)
+		}
+	}
+	stepEvery, err := parseRampDuration("stepEvery", p.StepEvery)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []RampPoint
+	switch p.Type {
+	case RampStep:
+		size := p.StepSize
+		if size == 0 {
+			size = max(abs(p.End-p.Start)/10, 1)
+		}
+		if size < 0 {
+			return nil, fmt.Errorf("stepSize must be positive, the direction follows start and end")
+		}
+		eps := p.Start
+		for offset := time.Duration(0); ; offset += stepEvery {
+			points = append(points, RampPoint{Offset: offset, EPS: eps})
+			if eps == p.End || len(points) > rampMaxPoints {
+				break
+			}
+			if p.End > p.Start {
+				eps = min(eps+size, p.End)
+			} else {
+				eps = max(eps-size, p.End)
+			}
+		}
+	case RampLinear:
+		duration, err := parseRampDuration("duration", p.Duration)
+		if err != nil {
+			return nil, err
+		}
+		if duration < stepEvery {
+			return nil, fmt.Errorf("duration %s is shorter than stepEvery %s", duration, stepEvery)
+		}
+		for offset := time.Duration(0); offset < duration && len(points) <= rampMaxPoints; offset += stepEvery {
+			eps := p.Start + int(float64(p.End-p.Start)*float64(offset)/float64(duration))
+			points = append(points, RampPoint{Offset: offset, EPS: eps})
+		}
+		points = append(points, RampPoint{Offset: duration, EPS: p.End})
+	case RampSpike:
+		duration, err := parseRampDuration("duration", p.Duration)
+		if err != nil {
+			return nil, err
+		}
+		repeat := p.Repeat
+		if repeat == 0 {
+			repeat = 1
+		}
+		if repeat < 0 {
+			return nil, fmt.Errorf("repeat must be positive")
+		}
+		cycle := stepEvery + duration
+		for i := 0; i < repeat && len(points) <= rampMaxPoints; i++ {
+			offset := time.Duration(i) * cycle
+			points = append(points,
+				RampPoint{Offset: offset, EPS: p.Start},
+				RampPoint{Offset: offset + stepEvery, EPS: p.End})
+		}
+		points = append(points, RampPoint{Offset: time.Duration(repeat) * cycle, EPS: p.Start})
+	default:
+		return nil, fmt.Errorf("type must be %s, %s or %s", RampStep, RampLinear, RampSpike)
+	}
+	if len(points) > rampMaxPoints {
+		return nil, fmt.Errorf("the profile has more than %d steps, use a longer stepEvery", rampMaxPoints)
+	}
+	return points, nil
+}
+
+// parseRampDuration reads a duration such as "5m" of at least rampMinInterval
+func parseRampDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	if duration < rampMinInterval {
+		return 0, fmt.Errorf("%s must be at least %s, every step restarts the simulators", name, rampMinInterval)
+	}
+	return duration, nil
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,361 @@
+package o11y_source_manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// schemaDir holds one <source>.json message schema per source. Like the catalog it lives
+// outside conf.d so the schemas are not distributed to the nodes.
+const schemaDir = "src/configs/schemas"
+
+// maxSchemaErrors caps the violations reported for one message
+const maxSchemaErrors = 10
+
+// SchemaTypes is the JSON Schema "type" keyword, a single type or a list of them
+type SchemaTypes []string
+
+// UnmarshalJSON accepts "string" as well as ["string", "null"]
+func (t *SchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// MarshalJSON writes a single type as a string
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// MessageSchema is the subset of JSON Schema the simulator output is checked against:
+// type, required, properties, additionalProperties, items, enum, minimum, maximum,
+// minLength, maxLength, pattern and the date-time format. Other keywords are ignored.
+type MessageSchema struct {
+	Schema               string                    `json:"$schema,omitempty"`
+	Title                string                    `json:"title,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Type                 SchemaTypes               `json:"type,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Properties           map[string]*MessageSchema `json:"properties,omitempty"`
+	AdditionalProperties *bool                     `json:"additionalProperties,omitempty"`
+	Items                *MessageSchema            `json:"items,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// SourceSchemaInfo tells whether a source has a message schema
+type SourceSchemaInfo struct {
+	Source    string     `json:"source"`
+	HasSchema bool       `json:"hasSchema"`
+	Title     string     `json:"title,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ParseMessageSchema reads a schema document and compiles its patterns
+func ParseMessageSchema(data []byte) (*MessageSchema, error) {
+	var schema MessageSchema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// compile checks the types and compiles the patterns of a schema and its children
+func (s *MessageSchema) compile(path string) error {
+	for _, typ := range s.Type {
+		switch typ {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return fmt.Errorf("%s: unknown type %q", path, typ)
+		}
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", path, err)
+		}
+		s.pattern = pattern
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: empty property schema", path, name)
+		}
+		if err := property.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile(path + "[]")
+	}
+	return nil
+}
+
+// Validate checks one message and returns its violations, at most maxSchemaErrors, as
+// "<path>: <problem>". Problems leave out the offending value so they can be counted.
+func (s *MessageSchema) Validate(message []byte) []string {
+	var value interface{}
+	if err := json.Unmarshal(message, &value); err != nil {
+		return []string{fmt.Sprintf("not valid JSON: %v", err)}
+	}
+	var violations []string
+	s.validate("$", value, &violations)
+	return violations
+}
+
+func (s *MessageSchema) validate(path string, value interface{}, violations *[]string) {
+	report := func(format string, args ...interface{}) {
+		if len(*violations) < maxSchemaErrors {
+			*violations = append(*violations, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	if len(s.Type) > 0 && !matchesType(value, s.Type) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), jsonType(value))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		report("not one of the allowed values")
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := typed[name]; !ok {
+				report("missing required field %q", name)
+			}
+		}
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(path+"."+name, typed[name], violations)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				report("unexpected field %q", name)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range typed {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && typed < *s.Minimum {
+			report("below the minimum of %v", *s.Minimum)
+		}
+		if s.Maximum != nil && typed > *s.Maximum {
+			report("above the maximum of %v", *s.Maximum)
+		}
+	case string:
+		length := len([]rune(typed))
+		if s.MinLength != nil && length < *s.MinLength {
+			report("shorter than %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			report("longer than %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			report("does not match %s", s.Pattern)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, typed); err != nil {
+				report("not an RFC3339 date-time")
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func matchesType(value interface{}, types SchemaTypes) bool {
+	actual := jsonType(value)
+	for _, typ := range types {
+		if typ == actual || (typ == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) && jsonType(allowed) == jsonType(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// InferMessageSchema builds a schema from a sample message: every field of the sample is
+// required with the type it has there, and fields the sample lacks are allowed. Numbers
+// are inferred as number, since a whole value in the sample may be fractional elsewhere.
+func InferMessageSchema(sample []byte) (*MessageSchema, error) {
+	var value interface{}
+	if err := json.Unmarshal(sample, &value); err != nil {
+		return nil, fmt.Errorf("sample is not valid JSON: %v", err)
+	}
+	schema := inferSchema(value)
+	schema.Schema = "https://json-schema.org/draft/2020-12/schema"
+	return schema, nil
+}
+
+func inferSchema(value interface{}) *MessageSchema {
+	switch typed := value.(type) {
+	case nil:
+		return &MessageSchema{} // any type
+	case map[string]interface{}:
+		schema := &MessageSchema{Type: SchemaTypes{"object"}, Properties: make(map[string]*MessageSchema, len(typed))}
+		for name, field := range typed {
+			schema.Required = append(schema.Required, name)
+			schema.Properties[name] = inferSchema(field)
+		}
+		sort.Strings(schema.Required)
+		return schema
+	case []interface{}:
+		schema := &MessageSchema{Type: SchemaTypes{"array"}}
+		if len(typed) > 0 {
+			schema.Items = inferSchema(typed[0])
+		}
+		return schema
+	case float64:
+		return &MessageSchema{Type: SchemaTypes{"number"}}
+	default:
+		return &MessageSchema{Type: SchemaTypes{jsonType(value)}}
+	}
+}
+
+func schemaPath(sourceName string) string {
+	return filepath.Join(schemaDir, sourceName+".json")
+}
+
+// LoadSourceSchema reads the message schema of a source; a source without one returns nil
+func (osm *O11ySourceManager) LoadSourceSchema(sourceName string) (*MessageSchema, error) {
+	if !osm.IsKnownSource(sourceName) {
+		return nil, fmt.Errorf("source not found: %s", sourceName)
+	}
+	data, err := os.ReadFile(schemaPath(sourceName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema of %s: %v", sourceName, err)
+	}
+	schema, err := ParseMessageSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema of %s: %v", sourceName, err)
+	}
+	return schema, nil
+}
+
+// SaveSourceSchema replaces the message schema of a source
+func (osm *O11ySourceManager) SaveSourceSchema(sourceName string, schema *MessageSchema) error {
+	if !osm.IsKnownSource(sourceName) {
+		return fmt.Errorf("source not found: %s", sourceName)
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %v", err)
+	}
+	if err := os.MkdirAll(schemaDir, 0755); err != nil {
+		return fmt.Errorf("failed to create schema directory: %v", err)
+	}
+	path := schemaPath(sourceName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write schema of %s: %v", sourceName, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace schema of %s: %v", sourceName, err)
+	}
+	return nil
+}
+
+// DeleteSourceSchema removes the message schema of a source; it reports whether one existed
+func (osm *O11ySourceManager) DeleteSourceSchema(sourceName string) (bool, error) {
+	if !osm.IsKnownSource(sourceName) {
+		return false, fmt.Errorf("source not found: %s", sourceName)
+	}
+	err := os.Remove(schemaPath(sourceName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete schema of %s: %v", sourceName, err)
+	}
+	return true, nil
+}
+
+// ListSourceSchemas tells for every available source whether it has a message schema.
+// A schema that does not parse is reported on its entry.
+func (osm *O11ySourceManager) ListSourceSchemas() []SourceSchemaInfo {
+	sources := osm.GetAvailableSources()
+	infos := make([]SourceSchemaInfo, 0, len(sources))
+	for _, sourceName := range sources {
+		info := SourceSchemaInfo{Source: sourceName}
+		schema, err := osm.LoadSourceSchema(sourceName)
+		switch {
+		case err != nil:
+			info.Error = err.Error()
+		case schema != nil:
+			info.HasSchema = true
+			info.Title = schema.Title
+		}
+		if stat, err := os.Stat(schemaPath(sourceName)); err == nil {
+			updatedAt := stat.ModTime().UTC()
+			info.UpdatedAt = &updatedAt
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,184 @@
+package o11y_source_manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Strategies for splitting the EPS of a node across the selected sources
+const (
+	StrategyProportional = "proportional" // in proportion to max EPS, as DistributeEPS does
+)
+
+// WhatIfSubModule is the EPS one submodule of a source would produce on a node
+type WhatIfSubModule struct {
+	Name       string  `json:"name"`
+	NumUniqKey int     `json:"numUniqKey"` // the submodule's own keys, 1 if it has none
+	EPS        float64 `json:"eps"`
+}
+
+// WhatIfSource is what a distribution would write for one source and what it produces
+type WhatIfSource struct {
+	Source        string            `json:"source"`
+	AssignedEPS   int               `json:"assignedEps"` // per node, from the split
+	MaxEPS        int               `json:"maxEps"`
+	ExceedsMax    bool              `json:"exceedsMax"` // DistributeEPS refuses the split
+	NumUniqKey    int               `json:"numUniqKey"` // written to the source's conf.yml
+	TotalSubKeys  int               `json:"totalSubKeys"`
+	Period        string            `json:"period"`
+	PeriodSeconds float64           `json:"periodSeconds"`
+	NodeEPS       float64           `json:"nodeEps"` // produced per node by NumUniqKey and the submodule keys
+	FleetEPS      float64           `json:"fleetEps"`
+	SubModules    []WhatIfSubModule `json:"subModules"`
+}
+
+// EPSWhatIf is the outcome a distribution of TotalEPS would have, computed without
+// writing anything
+type EPSWhatIf struct {
+	TotalEPS        int            `json:"totalEps"`
+	Strategy        string         `json:"strategy"`
+	NumEnabledNodes int            `json:"numEnabledNodes"`
+	SplitEPS        int            `json:"splitEps"` // per node
+	Sources         []WhatIfSource `json:"sources"`
+	NodeEPS         float64        `json:"nodeEps"`
+	FleetEPS        float64        `json:"fleetEps"`
+	Feasible        bool           `json:"feasible"` // false when DistributeEPS would refuse it
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+// WhatIfEPS computes the NumUniqKey and the per-submodule EPS that DistributeEPS would
+// produce for totalEPS across the sources, using their current submodule keys and period.
+// Nothing is written, so it can be called for every step of a slider.
+func (osm *O11ySourceManager) WhatIfEPS(selectedSources []string, totalEPS int, strategy string) (*EPSWhatIf, error) {
+	if strategy == "" {
+		strategy = StrategyProportional
+	}
+	if strategy != StrategyProportional {
+		return nil, fmt.Errorf("unknown strategy %q, supported: %s", strategy, StrategyProportional)
+	}
+	if totalEPS <= 0 {
+		return nil, fmt.Errorf("total EPS must be greater than 0")
+	}
+	if len(selectedSources) == 0 {
+		return nil, fmt.Errorf("at least one source must be selected")
+	}
+
+	nodeManager := osm.getNodeManager()
+	if nodeManager == nil {
+		return nil, fmt.Errorf("node manager not available")
+	}
+	numEnabledNodes := len(nodeManager.GetEnabledNodes())
+	if numEnabledNodes == 0 {
+		return nil, fmt.Errorf("no enabled nodes found")
+	}
+
+	splitEPS := totalEPS / numEnabledNodes
+	sourceEPSMap, sourceMaxEPS, err := osm.splitProportionally(selectedSources, splitEPS)
+	if err != nil {
+		return nil, err
+	}
+
+	whatIf := &EPSWhatIf{
+		TotalEPS:        totalEPS,
+		Strategy:        strategy,
+		NumEnabledNodes: numEnabledNodes,
+		SplitEPS:        splitEPS,
+		Sources:         []WhatIfSource{},
+		Feasible:        true,
+	}
+	for _, sourceName := range selectedSources {
+		sourceConfig, err := osm.loadSourceConfig(sourceName)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %v", sourceName, err)
+		}
+		subModules := osm.subModuleKeys(sourceName, sourceConfig)
+		totalSubKeys := 0
+		for _, subModule := range subModules {
+			totalSubKeys += subModule.NumUniqKey
+		}
+		if totalSubKeys == 0 {
+			totalSubKeys = 1
+		}
+
+		period, periodSeconds, err := parsePeriod(sourceConfig.Period)
+		if err != nil {
+			whatIf.Warnings = append(whatIf.Warnings, fmt.Sprintf("%s: %v, assuming 1s", sourceName, err))
+		}
+
+		source := WhatIfSource{
+			Source:        sourceName,
+			AssignedEPS:   sourceEPSMap[sourceName],
+			MaxEPS:        sourceMaxEPS[sourceName],
+			NumUniqKey:    mainKeysForEPS(sourceEPSMap[sourceName], totalSubKeys),
+			TotalSubKeys:  totalSubKeys,
+			Period:        period,
+			PeriodSeconds: periodSeconds,
+			SubModules:    subModules,
+		}
+		source.ExceedsMax = source.AssignedEPS > source.MaxEPS
+		for i := range source.SubModules {
+			source.SubModules[i].EPS = float64(source.NumUniqKey*source.SubModules[i].NumUniqKey) / periodSeconds
+			source.NodeEPS += source.SubModules[i].EPS
+		}
+		if len(source.SubModules) == 0 {
+			source.NodeEPS = float64(source.NumUniqKey) / periodSeconds
+		}
+		source.FleetEPS = source.NodeEPS * float64(numEnabledNodes)
+
+		if source.ExceedsMax {
+			whatIf.Feasible = false
+			whatIf.Warnings = append(whatIf.Warnings, fmt.Sprintf("%s: %d EPS per node exceeds its max EPS %d", sourceName, source.AssignedEPS, source.MaxEPS))
+		}
+		if source.AssignedEPS < totalSubKeys {
+			whatIf.Warnings = append(whatIf.Warnings, fmt.Sprintf("%s: %d EPS per node is below its %d submodule keys, NumUniqKey is raised to 1", sourceName, source.AssignedEPS, totalSubKeys))
+		}
+		whatIf.NodeEPS += source.NodeEPS
+		whatIf.FleetEPS += source.FleetEPS
+		whatIf.Sources = append(whatIf.Sources, source)
+	}
+	return whatIf, nil
+}
+
+// subModuleKeys returns the keys of each included submodule of a source, counting a
+// submodule without a readable uniquekey as 1 like calculateTotalSubModuleKeys
+func (osm *O11ySourceManager) subModuleKeys(sourceName string, sourceConfig *SourceConfig) []WhatIfSubModule {
+	subModules := []WhatIfSubModule{}
+	for _, subModuleName := range sourceConfig.IncludeSubModules {
+		subModuleName = strings.TrimSpace(strings.Trim(subModuleName, "[]"))
+		if subModuleName == "" {
+			continue
+		}
+		keys := 1
+		data, err := os.ReadFile(filepath.Join(localConfDDir, sourceName, subModuleName+".yml"))
+		if err == nil {
+			var subModuleConfig SubModuleConfig
+			if yaml.Unmarshal(data, &subModuleConfig) == nil && subModuleConfig.UniqueKey.NumUniqKey > 0 {
+				keys = subModuleConfig.UniqueKey.NumUniqKey
+			}
+		}
+		subModules = append(subModules, WhatIfSubModule{Name: subModuleName, NumUniqKey: keys})
+	}
+	return subModules
+}
+
+// parsePeriod reads the period of a source's conf.yml, a duration like 1s or 500ms or a
+// number of seconds. An empty or invalid period is 1s.
+func parsePeriod(value string) (string, float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "1s", 1, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return value, duration.Seconds(), nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return value, seconds, nil
+	}
+	return "1s", 1, fmt.Errorf("invalid period %q", value)
+}
@@ -0,0 +1,427 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxPresignExpiry is the longest validity S3 accepts for a presigned URL
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// S3Config locates a bucket on AWS S3 or an S3-compatible server such as MinIO or Ceph
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint" json:"endpoint"` // e.g. https://s3.ap-south-1.amazonaws.com
+	Region    string `yaml:"region" json:"region"`
+	Bucket    string `yaml:"bucket" json:"bucket"`
+	PathStyle bool   `yaml:"path_style" json:"pathStyle"` // endpoint/bucket/key instead of bucket.endpoint/key
+	// The credentials are read from the environment variables named here so they stay
+	// out of config.yaml
+	AccessKeyIDEnv     string `yaml:"access_key_id_env" json:"accessKeyIdEnv,omitempty"`
+	SecretAccessKeyEnv string `yaml:"secret_access_key_env" json:"secretAccessKeyEnv,omitempty"`
+	SessionTokenEnv    string `yaml:"session_token_env" json:"sessionTokenEnv,omitempty"`
+}
+
+// S3Client uploads objects, presigns downloads and manages lifecycle rules of a bucket
+// using AWS Signature Version 4
+type S3Client struct {
+	config       S3Config
+	endpoint     *url.URL
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	httpClient   *http.Client
+	now          func() time.Time
+}
+
+// NewS3Client validates the config and reads the credentials from the environment
+func NewS3Client(config S3Config) (*S3Client, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	accessKeyEnv := envOr(config.AccessKeyIDEnv, "AWS_ACCESS_KEY_ID")
+	secretKeyEnv := envOr(config.SecretAccessKeyEnv, "AWS_SECRET_ACCESS_KEY")
+	client := &S3Client{
+		config:     config,
+		endpoint:   endpoint,
+		accessKey:  os.Getenv(accessKeyEnv),
+		secretKey:  os.Getenv(secretKeyEnv),
+		httpClient: &http.Client{Timeout: 5 * time.Minute},
+		now:        time.Now,
+	}
+	if config.SessionTokenEnv != "" {
+		client.sessionToken = os.Getenv(config.SessionTokenEnv)
+	}
+	if client.accessKey == "" || client.secretKey == "" {
+		return nil, fmt.Errorf("s3 credentials missing, set %s and %s", accessKeyEnv, secretKeyEnv)
+	}
+	return client, nil
+}
+
+func envOr(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+// Bucket returns the name of the client's bucket
+func (c *S3Client) Bucket() string {
+	return c.config.Bucket
+}
+
+// PutFile uploads a local file as key
+func (c *S3Client) PutFile(ctx context.Context, key, path, contentType string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return c.put(ctx, key, file, info.Size(), contentType)
+}
+
+// PutBytes uploads data as key
+func (c *S3Client) PutBytes(ctx context.Context, key string, data []byte, contentType string) error {
+	return c.put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// put hashes body for the signature, then rewinds and sends it
+func (c *S3Client) put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key, nil), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, hex.EncodeToString(hash.Sum(nil)))
+	_, err = c.do(req)
+	return err
+}
+
+// PresignGet returns a URL that downloads key without credentials until it expires
+func (c *S3Client) PresignGet(key string, expiry time.Duration) (string, time.Time, error) {
+	if expiry <= 0 || expiry > MaxPresignExpiry {
+		return "", time.Time{}, fmt.Errorf("presign expiry must be between 1s and %s", MaxPresignExpiry)
+	}
+	now := c.now().UTC()
+	u, err := url.Parse(c.objectURL(key, nil))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", c.accessKey+"/"+c.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if c.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		canonicalURI(u),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", c.signature(now, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), now.Add(expiry), nil
+}
+
+// LifecycleRule expires the objects under a prefix after a number of days
+type LifecycleRule struct {
+	ID             string
+	Prefix         string
+	ExpirationDays int
+}
+
+// storedLifecycle is a bucket's lifecycle configuration as read; each rule is kept as raw
+// XML so rules the manager does not own are written back unchanged
+type storedLifecycle struct {
+	Rules []struct {
+		ID    string `xml:"ID"`
+		Inner string `xml:",innerxml"`
+	} `xml:"Rule"`
+}
+
+type lifecycleConfiguration struct {
+	XMLName xml.Name      `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LifecycleConfiguration"`
+	Rules   []interface{} `xml:"Rule"`
+}
+
+type rawLifecycleRule struct {
+	XMLName xml.Name `xml:"Rule"`
+	Inner   string   `xml:",innerxml"`
+}
+
+type managedLifecycleRule struct {
+	XMLName    xml.Name `xml:"Rule"`
+	ID         string   `xml:"ID"`
+	Prefix     string   `xml:"Filter>Prefix"`
+	Status     string   `xml:"Status"`
+	Expiration int      `xml:"Expiration>Days"`
+}
+
+// SetLifecycleRules replaces the bucket's lifecycle rules whose ID starts with idPrefix
+// by rules, leaving every other rule of the bucket as it was
+func (c *S3Client) SetLifecycleRules(ctx context.Context, idPrefix string, rules []LifecycleRule) error {
+	query := url.Values{"lifecycle": {""}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL("", query), nil)
+	if err != nil {
+		return err
+	}
+	c.sign(req, sha256Hex(nil))
+	var current storedLifecycle
+	body, err := c.do(req)
+	if err != nil {
+		// A bucket without lifecycle configuration answers 404 NoSuchLifecycleConfiguration
+		if !strings.Contains(err.Error(), "NoSuchLifecycleConfiguration") {
+			return fmt.Errorf("failed to read lifecycle configuration: %v", err)
+		}
+	} else if err := xml.Unmarshal(body, &current); err != nil {
+		return fmt.Errorf("failed to parse lifecycle configuration: %v", err)
+	}
+
+	next := lifecycleConfiguration{}
+	for _, rule := range current.Rules {
+		if !strings.HasPrefix(rule.ID, idPrefix) {
+			next.Rules = append(next.Rules, rawLifecycleRule{Inner: rule.Inner})
+		}
+	}
+	for _, rule := range rules {
+		next.Rules = append(next.Rules, managedLifecycleRule{
+			ID:         rule.ID,
+			Prefix:     rule.Prefix,
+			Status:     "Enabled",
+			Expiration: rule.ExpirationDays,
+		})
+	}
+
+	if len(next.Rules) == 0 {
+		if len(current.Rules) == 0 {
+			return nil
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.objectURL("", query), nil)
+		if err != nil {
+			return err
+		}
+		c.sign(req, sha256Hex(nil))
+		_, err = c.do(req)
+		return err
+	}
+
+	payload, err := xml.Marshal(next)
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL("", query), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(payload)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	req.Header.Set("Content-Type", "application/xml")
+	c.sign(req, sha256Hex(payload))
+	if _, err := c.do(req); err != nil {
+		return fmt.Errorf("failed to write lifecycle configuration: %v", err)
+	}
+	return nil
+}
+
+// objectURL addresses key in the bucket, or the bucket itself for an empty key
+func (c *S3Client) objectURL(key string, query url.Values) string {
+	u := *c.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if c.config.PathStyle {
+		path += "/" + c.config.Bucket
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+	}
+	u.Path = path + "/" + key
+	u.RawPath = ""
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return u.String()
+}
+
+func (c *S3Client) do(req *http.Request) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var s3Error struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.Unmarshal(body, &s3Error) == nil && s3Error.Code != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, s3Error.Code, s3Error.Message)
+		}
+		return nil, fmt.Errorf("%s %s: HTTP %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// sign adds the SigV4 Authorization header, signing host, the x-amz-* headers and the
+// content headers set on req
+func (c *S3Client) sign(req *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, c.accessKey, c.scope(now), signedHeaders, c.signature(now, canonical)))
+}
+
+func (c *S3Client) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + c.config.Region + "/s3/aws4_request"
+}
+
+func (c *S3Client) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		t.Format(amzDateFormat),
+		c.scope(t),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalURI encodes every path segment the way SigV4 expects for S3
+func canonicalURI(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts the parameters and encodes them with %20 for spaces
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+// Package remotecmd builds the shell commands run on worker nodes over SSH. Every
+// path and pattern that comes from configuration is quoted here, so node binary_dir
+// and conf_dir values with spaces or shell metacharacters stay a single word.
+// The builders only return strings and never run anything.
+package remotecmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Binaries and files deployed to a node's binary_dir
+const (
+	SimulatorBinary = "finalvudatasim"
+	MetricsBinary   = "node_metrics_api"
+	MetricsLogFile  = "metrics_api.log"
+)
+
+// Quote single-quotes a value for use as one word in a remote shell command
+func Quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// QuoteAll quotes every value and joins them with spaces
+func QuoteAll(values ...string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = Quote(value)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Join joins remote path elements with forward slashes, whatever the local OS
+func Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// MakeDirs creates the directories and their parents
+func MakeDirs(dirs ...string) string {
+	return "mkdir -p " + QuoteAll(dirs...)
+}
+
+// RemoveAll removes a file or directory tree
+func RemoveAll(target string) string {
+	return "rm -rf " + Quote(target)
+}
+
+// TestDir succeeds if dir is a directory
+func TestDir(dir string) string {
+	return "test -d " + Quote(dir)
+}
+
+// ListDir lists a directory in long format
+func ListDir(dir string) string {
+	return "ls -la " + Quote(dir)
+}
+
+// ExtractTar unpacks a gzipped tar into dir and removes the archive
+func ExtractTar(dir, archive string) string {
+	return fmt.Sprintf("cd %s && tar -xzf %s && rm %s", Quote(dir), Quote(archive), Quote(archive))
+}
+
+// FindProcesses prints the PIDs of processes whose command line matches pattern, one
+// per line. pgrep exits 1 when nothing matches.
+func FindProcesses(pattern string) string {
+	return "pgrep -f " + Quote(pattern)
+}
+
+// FindSimulator prints the PIDs of the running simulator, as started by StartSimulator
+func FindSimulator() string {
+	return FindProcesses("./" + SimulatorBinary)
+}
+
+// FindMetricsAgent prints the PIDs of the running node_metrics_api
+func FindMetricsAgent() string {
+	return FindProcesses(MetricsBinary)
+}
+
+// ListSimulatorProcesses prints PID and command line of every simulator process, or a
+// note if there is none
+func ListSimulatorProcesses() string {
+	return fmt.Sprintf("pgrep -af %s || echo 'no %s process'", SimulatorBinary, SimulatorBinary)
+}
+
+// StartSimulator launches the simulator in the background from binaryDir. Its output
+// goes to logFile, relative to binaryDir, or is discarded when logFile is empty.
+func StartSimulator(binaryDir, logFile string) string {
+	output := "/dev/null"
+	if logFile != "" {
+		output = Quote(logFile)
+	}
+	return fmt.Sprintf("cd %s && nohup ./%s > %s 2>&1 &", Quote(binaryDir), SimulatorBinary, output)
+}
+
+// ScheduleTerm sends SIGTERM to pid after the delay, detached from the SSH session
+func ScheduleTerm(pid, afterSeconds int) string {
+	return fmt.Sprintf("(sleep %d; kill %d) >/dev/null 2>&1 &", afterSeconds, pid)
+}
+
+// ScheduleCommand runs command after the delay, detached from the SSH session
+func ScheduleCommand(command string, afterSeconds int) string {
+	return fmt.Sprintf("(sleep %d; %s) >/dev/null 2>&1 &", afterSeconds, command)
+}
+
+// Signal sends a signal (TERM, KILL, ...) to pid
+func Signal(signal string, pid int) string {
+	return fmt.Sprintf("kill -%s %d", signal, pid)
+}
+
+// SignalProcesses sends a signal to every process whose command line matches pattern.
+// pkill exits 1 when nothing matches.
+func SignalProcesses(signal, pattern string) string {
+	return fmt.Sprintf("pkill -%s -f %s", signal, Quote(pattern))
+}
+
+// Alive succeeds while pid exists
+func Alive(pid int) string {
+	return fmt.Sprintf("kill -0 %d 2>/dev/null", pid)
+}
+
+// GracefulStop sends SIGTERM to pid and polls once a second for up to timeoutSeconds.
+// It exits 0 once the PID is gone, termFailedCode if the signal could not be sent and
+// timedOutCode if the process is still running at the end.
+func GracefulStop(pid, timeoutSeconds, termFailedCode, timedOutCode int) string {
+	return fmt.Sprintf("kill -TERM %d || exit %d; i=0; while [ $i -lt %d ]; do kill -0 %d 2>/dev/null || exit 0; sleep 1; i=$((i+1)); done; kill -0 %d 2>/dev/null || exit 0; exit %d",
+		pid, termFailedCode, timeoutSeconds, pid, pid, timedOutCode)
+}
+
+// WaitExit polls once a second for up to seconds and fails if pid is still running
+func WaitExit(pid, seconds int) string {
+	return fmt.Sprintf("i=0; while [ $i -lt %d ]; do kill -0 %d 2>/dev/null || exit 0; sleep 1; i=$((i+1)); done; exit 1", seconds, pid)
+}
+
+// TestExecutable prints message if file exists and is executable, and fails otherwise
+func TestExecutable(file, message string) string {
+	return fmt.Sprintf("test -x %s && echo %s", Quote(file), Quote(message))
+}
+
+// CheckExecutable prints "executable" or "not executable" for file
+func CheckExecutable(file string) string {
+	return fmt.Sprintf("test -x %s && echo 'executable' || echo 'not executable'", Quote(file))
+}
+
+// ListFile lists a file in long format
+func ListFile(file string) string {
+	return fmt.Sprintf("ls -la %s", Quote(file))
+}
+
+// DescribeFile lists a file in long format, printing the error if it is missing
+func DescribeFile(file string) string {
+	return fmt.Sprintf("ls -l %s 2>&1", Quote(file))
+}
+
+// StartMetricsAgent runs node_metrics_api from binaryDir with the conf.yml of confDir,
+// logging to metrics_api.log in binaryDir. A non-empty clickhouseAddr is the host:port
+// the agent's reachability probe may check.
+func StartMetricsAgent(binaryDir, confDir string, port int, clickhouseAddr string) string {
+	flags := fmt.Sprintf("--port %d --conf %s", port, Quote(Join(confDir, "conf.d", "conf.yml")))
+	if clickhouseAddr != "" {
+		flags += " --clickhouse-addr " + Quote(clickhouseAddr)
+	}
+	return fmt.Sprintf("cd %s && ./%s %s > %s 2>&1", Quote(binaryDir), MetricsBinary, flags, MetricsLogFile)
+}
+
+// TryMetricsAgent runs node_metrics_api in the foreground for at most 10 seconds to
+// capture why it does not start
+func TryMetricsAgent(binaryDir string, port int) string {
+	return fmt.Sprintf("cd %s && timeout 10s ./%s --port %d 2>&1 || echo 'Manual start failed or timed out'",
+		Quote(binaryDir), MetricsBinary, port)
+}
+
+// ReadMetricsLog prints metrics_api.log of binaryDir, or fallback if it cannot be read.
+// An empty fallback makes a missing log fail the command.
+func ReadMetricsLog(binaryDir, fallback string) string {
+	if fallback == "" {
+		return fmt.Sprintf("cd %s && cat %s", Quote(binaryDir), MetricsLogFile)
+	}
+	return fmt.Sprintf("cd %s && cat %s 2>/dev/null || echo %s", Quote(binaryDir), MetricsLogFile, Quote(fallback))
+}
+
+// CountLogMatches prints how many lines of logFile, relative to dir, match the extended
+// regular expression pattern
+func CountLogMatches(dir, pattern, logFile string) string {
+	return fmt.Sprintf("cd %s && grep -cE %s %s 2>/dev/null || true", Quote(dir), Quote(pattern), Quote(logFile))
+}
+
+// TailFile prints the last lines of a file
+func TailFile(file string, lines int) string {
+	return fmt.Sprintf("tail -n %d %s 2>&1", lines, Quote(file))
+}
+
+// readFromEOF ends the output of ReadFileFrom, so the caller can tell the file's last
+// bytes from whitespace trimmed off the SSH output
+const readFromEOF = "--eof--"
+
+// ReadFileFrom prints "<size> <offset>" on the first line, then up to maxBytes of file
+// starting at offset and a final line with an end marker, see SplitFileFrom. The offset
+// restarts at 0 when the file is shorter, e.g. after a restart truncated it. A missing
+// file prints "missing".
+func ReadFileFrom(file string, offset, maxBytes int64) string {
+	return fmt.Sprintf(`f=%s; size=$(stat -c %%s "$f" 2>/dev/null) || { echo missing; exit 0; }; off=%d; [ "$size" -lt "$off" ] && off=0; echo "$size $off"; tail -c +$((off+1)) "$f" | head -c %d; echo; echo %s`,
+		Quote(file), offset, maxBytes, Quote(readFromEOF))
+}
+
+// SplitFileFrom parses the output of ReadFileFrom into the file size, the offset the
+// content starts at and the content. missing is true when the file does not exist.
+func SplitFileFrom(output string) (size, offset int64, content string, missing bool, err error) {
+	header, rest, _ := strings.Cut(output, "\n")
+	if strings.TrimSpace(header) == "missing" {
+		return 0, 0, "", true, nil
+	}
+	if _, err := fmt.Sscanf(header, "%d %d", &size, &offset); err != nil {
+		return 0, 0, "", false, fmt.Errorf("unexpected output %q", header)
+	}
+	content, found := strings.CutSuffix(rest, readFromEOF)
+	if !found {
+		return 0, 0, "", false, fmt.Errorf("output of the file read was cut off")
+	}
+	// Drop the newline added before the end marker
+	return size, offset, strings.TrimSuffix(content, "\n"), false, nil
+}
@@ -0,0 +1,167 @@
+package remotecmd
+
+import (
+	"os/exec"
+	"testing"
+)
+
+// awkward are values a binary_dir or conf_dir could hold that break unquoted commands
+var awkward = []struct {
+	name  string
+	value string
+	quote string
+}{
+	{"plain", "/opt/vudatasim", `'/opt/vudatasim'`},
+	{"empty", "", `''`},
+	{"space", "/opt/vu data sim", `'/opt/vu data sim'`},
+	{"single quote", "/opt/o'brien", `'/opt/o'\''brien'`},
+	{"double quote", `/opt/"sim"`, `'/opt/"sim"'`},
+	{"dollar", "/opt/$HOME/${USER}", `'/opt/$HOME/${USER}'`},
+	{"backtick", "/opt/`id`", "'/opt/`id`'"},
+	{"command substitution", "/opt/$(reboot)", `'/opt/$(reboot)'`},
+	{"newline", "/opt/a\nrm -rf /", "'/opt/a\nrm -rf /'"},
+	{"separators", "/opt/a; b && c | d", `'/opt/a; b && c | d'`},
+	{"glob", "/opt/*", `'/opt/*'`},
+	{"only quotes", "''", `''\'''\'''`},
+}
+
+func TestQuote(t *testing.T) {
+	for _, tc := range awkward {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Quote(tc.value); got != tc.quote {
+				t.Errorf("Quote(%q) = %s, want %s", tc.value, got, tc.quote)
+			}
+		})
+	}
+}
+
+// TestQuoteShellRoundTrip checks that a POSIX shell reads every quoted value back as
+// exactly one, unchanged word
+func TestQuoteShellRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the quoted values through")
+	}
+	for _, tc := range awkward {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := exec.Command(sh, "-c", "set -- "+Quote(tc.value)+`; printf '%s|' "$#" "$1"`).Output()
+			if err != nil {
+				t.Fatalf("sh: %v", err)
+			}
+			if want := "1|" + tc.value + "|"; string(out) != want {
+				t.Errorf("shell read %q back as %q, want %q", tc.value, out, want)
+			}
+		})
+	}
+}
+
+func TestQuoteAll(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{nil, ""},
+		{[]string{"a"}, `'a'`},
+		{[]string{"/opt/a b", "it's", "$x"}, `'/opt/a b' 'it'\''s' '$x'`},
+	}
+	for _, tc := range tests {
+		if got := QuoteAll(tc.values...); got != tc.want {
+			t.Errorf("QuoteAll(%q) = %s, want %s", tc.values, got, tc.want)
+		}
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	const dir = "/opt/vu sim/it's"
+	const conf = "/etc/$conf"
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"Join", Join("/opt/vu sim", "conf.d", "conf.yml"), "/opt/vu sim/conf.d/conf.yml"},
+		{"MakeDirs", MakeDirs(dir, conf), `mkdir -p '/opt/vu sim/it'\''s' '/etc/$conf'`},
+		{"RemoveAll", RemoveAll("/tmp/a`b`"), "rm -rf '/tmp/a`b`'"},
+		{"TestDir", TestDir(dir), `test -d '/opt/vu sim/it'\''s'`},
+		{"ListDir", ListDir(conf), `ls -la '/etc/$conf'`},
+		{"ExtractTar", ExtractTar(dir, "conf d.tar.gz"),
+			`cd '/opt/vu sim/it'\''s' && tar -xzf 'conf d.tar.gz' && rm 'conf d.tar.gz'`},
+		{"FindProcesses", FindProcesses("./sim $1"), `pgrep -f './sim $1'`},
+		{"FindSimulator", FindSimulator(), `pgrep -f './finalvudatasim'`},
+		{"FindMetricsAgent", FindMetricsAgent(), `pgrep -f 'node_metrics_api'`},
+		{"ListSimulatorProcesses", ListSimulatorProcesses(),
+			`pgrep -af finalvudatasim || echo 'no finalvudatasim process'`},
+		{"StartSimulator", StartSimulator(dir, "sim log.txt"),
+			`cd '/opt/vu sim/it'\''s' && nohup ./finalvudatasim > 'sim log.txt' 2>&1 &`},
+		{"StartSimulator without log", StartSimulator(dir, ""),
+			`cd '/opt/vu sim/it'\''s' && nohup ./finalvudatasim > /dev/null 2>&1 &`},
+		{"ScheduleTerm", ScheduleTerm(42, 1800), `(sleep 1800; kill 42) >/dev/null 2>&1 &`},
+		{"ScheduleCommand", ScheduleCommand(RemoveAll(dir), 5),
+			`(sleep 5; rm -rf '/opt/vu sim/it'\''s') >/dev/null 2>&1 &`},
+		{"Signal", Signal("TERM", 42), `kill -TERM 42`},
+		{"SignalProcesses", SignalProcesses("KILL", "a'b"), `pkill -KILL -f 'a'\''b'`},
+		{"Alive", Alive(42), `kill -0 42 2>/dev/null`},
+		{"GracefulStop", GracefulStop(42, 10, 3, 4),
+			`kill -TERM 42 || exit 3; i=0; while [ $i -lt 10 ]; do kill -0 42 2>/dev/null || exit 0; sleep 1; i=$((i+1)); done; kill -0 42 2>/dev/null || exit 0; exit 4`},
+		{"WaitExit", WaitExit(42, 5),
+			`i=0; while [ $i -lt 5 ]; do kill -0 42 2>/dev/null || exit 0; sleep 1; i=$((i+1)); done; exit 1`},
+		{"TestExecutable", TestExecutable(dir+"/bin", "it's there"),
+			`test -x '/opt/vu sim/it'\''s/bin' && echo 'it'\''s there'`},
+		{"CheckExecutable", CheckExecutable(conf),
+			`test -x '/etc/$conf' && echo 'executable' || echo 'not executable'`},
+		{"ListFile", ListFile("a\nb"), "ls -la 'a\nb'"},
+		{"DescribeFile", DescribeFile(`"x"`), `ls -l '"x"' 2>&1`},
+		{"StartMetricsAgent", StartMetricsAgent(dir, conf, 8086, ""),
+			`cd '/opt/vu sim/it'\''s' && ./node_metrics_api --port 8086 --conf '/etc/$conf/conf.d/conf.yml' > metrics_api.log 2>&1`},
+		{"StartMetricsAgent with ClickHouse", StartMetricsAgent(dir, conf, 8086, "ch.local:8123"),
+			`cd '/opt/vu sim/it'\''s' && ./node_metrics_api --port 8086 --conf '/etc/$conf/conf.d/conf.yml' --clickhouse-addr 'ch.local:8123' > metrics_api.log 2>&1`},
+		{"TryMetricsAgent", TryMetricsAgent(dir, 8086),
+			`cd '/opt/vu sim/it'\''s' && timeout 10s ./node_metrics_api --port 8086 2>&1 || echo 'Manual start failed or timed out'`},
+		{"ReadMetricsLog", ReadMetricsLog(dir, ""), `cd '/opt/vu sim/it'\''s' && cat metrics_api.log`},
+		{"ReadMetricsLog with fallback", ReadMetricsLog(dir, "No log file found"),
+			`cd '/opt/vu sim/it'\''s' && cat metrics_api.log 2>/dev/null || echo 'No log file found'`},
+		{"CountLogMatches", CountLogMatches(dir, "error|panic$", "sim log.txt"),
+			`cd '/opt/vu sim/it'\''s' && grep -cE 'error|panic$' 'sim log.txt' 2>/dev/null || true`},
+		{"TailFile", TailFile(conf, 100), `tail -n 100 '/etc/$conf' 2>&1`},
+		{"ReadFileFrom", ReadFileFrom(dir, 10, 4096),
+			`f='/opt/vu sim/it'\''s'; size=$(stat -c %s "$f" 2>/dev/null) || { echo missing; exit 0; }; off=10; [ "$size" -lt "$off" ] && off=0; echo "$size $off"; tail -c +$((off+1)) "$f" | head -c 4096; echo; echo '--eof--'`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("got\n\t%s\nwant\n\t%s", tc.got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitFileFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		size    int64
+		offset  int64
+		content string
+		missing bool
+		wantErr bool
+	}{
+		{"content", "120 100\nline one\nline two\n\n--eof--", 120, 100, "line one\nline two\n", false, false},
+		{"trailing spaces kept", "5 0\nab  \n--eof--", 5, 0, "ab  ", false, false},
+		{"empty", "0 0\n\n--eof--", 0, 0, "", false, false},
+		{"missing", "missing\n", 0, 0, "", true, false},
+		{"cut off", "120 100\nline one", 0, 0, "", false, true},
+		{"garbage", "stat: not found\n--eof--", 0, 0, "", false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			size, offset, content, missing, err := SplitFileFrom(tc.output)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if size != tc.size || offset != tc.offset || content != tc.content || missing != tc.missing {
+				t.Errorf("got (%d, %d, %q, %v), want (%d, %d, %q, %v)",
+					size, offset, content, missing, tc.size, tc.offset, tc.content, tc.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package runs
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Artifact kinds, each stored in its own subdirectory of the run's artifact directory
+const (
+	KindConfigs = "configs"
+	KindK6      = "k6"
+	KindLogs    = "logs"
+	KindReports = "reports"
+	KindMetrics = "metrics"
+)
+
+// Artifact describes a single file collected for a run
+type Artifact struct {
+	Path       string    `json:"path"`
+	Kind       string    `json:"kind"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// DataDir returns the directory holding the run records and their artifacts
+func (rm *RunManager) DataDir() string {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	return rm.config.DataDir
+}
+
+// ArtifactsDir returns the artifact directory of a run
+func (rm *RunManager) ArtifactsDir(id string) string {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	return filepath.Join(rm.config.DataDir, id, "artifacts")
+}
+
+// WriteArtifact stores data as kind/name in the run's artifact directory
+func (rm *RunManager) WriteArtifact(id, kind, name string, data []byte) error {
+	if !ValidRunID(id) {
+		return fmt.Errorf("invalid run id %q", id)
+	}
+	dest := filepath.Join(rm.ArtifactsDir(id), kind, filepath.Clean("/"+name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	return os.WriteFile(dest, data, 0644)
+}
+
+// AppendArtifact appends data to kind/name in the run's artifact directory, creating it if needed
+func (rm *RunManager) AppendArtifact(id, kind, name string, data []byte) error {
+	if !ValidRunID(id) {
+		return fmt.Errorf("invalid run id %q", id)
+	}
+	dest := filepath.Join(rm.ArtifactsDir(id), kind, filepath.Clean("/"+name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	file, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// OpenArtifact opens kind/name of the run's artifact directory for reading
+func (rm *RunManager) OpenArtifact(id, kind, name string) (*os.File, error) {
+	if !ValidRunID(id) {
+		return nil, fmt.Errorf("invalid run id %q", id)
+	}
+	return os.Open(filepath.Join(rm.ArtifactsDir(id), kind, filepath.Clean("/"+name)))
+}
+
+// CopyArtifact copies a local file or directory tree into kind/ of the run's artifact directory
+func (rm *RunManager) CopyArtifact(id, kind, srcPath string) error {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		return rm.WriteArtifact(id, kind, filepath.Base(srcPath), data)
+	}
+
+	base := filepath.Base(srcPath)
+	return filepath.WalkDir(srcPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return rm.WriteArtifact(id, kind, filepath.Join(base, rel), data)
+	})
+}
+
+// ListArtifacts returns every artifact collected for a run
+func (rm *RunManager) ListArtifacts(id string) ([]Artifact, error) {
+	if _, ok := rm.GetRun(id); !ok {
+		return nil, fmt.Errorf("run %s not found", id)
+	}
+
+	root := rm.ArtifactsDir(id)
+	artifacts := make([]Artifact, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		artifacts = append(artifacts, Artifact{
+			Path:       rel,
+			Kind:       strings.SplitN(rel, "/", 2)[0],
+			Size:       info.Size(),
+			ModifiedAt: info.ModTime().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return artifacts, nil
+}
+
+// WriteZip streams all artifacts of a run as a zip archive rooted at the run ID
+func (rm *RunManager) WriteZip(id string, w io.Writer) error {
+	artifacts, err := rm.ListArtifacts(id)
+	if err != nil {
+		return err
+	}
+
+	root := rm.ArtifactsDir(id)
+	zw := zip.NewWriter(w)
+	for _, artifact := range artifacts {
+		header := &zip.FileHeader{
+			Name:     id + "/" + artifact.Path,
+			Method:   zip.Deflate,
+			Modified: artifact.ModifiedAt,
+		}
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(filepath.Join(root, filepath.FromSlash(artifact.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ApplyRetention removes artifact directories of finished runs older than the retention
+// period, and of the oldest runs beyond the configured maximum. Run records are kept.
+func (rm *RunManager) ApplyRetention() ([]string, error) {
+	rm.mutex.RLock()
+	config := rm.config
+	list := rm.sortedRuns()
+	rm.mutex.RUnlock()
+
+	cutoff := time.Now().Add(-time.Duration(config.ArtifactRetentionDays) * 24 * time.Hour)
+	removed := make([]string, 0)
+	kept := 0
+
+	for _, run := range list {
+		dir := filepath.Join(config.DataDir, run.ID, "artifacts")
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if run.Status == StatusRunning {
+			kept++
+			continue
+		}
+
+		expired := run.EndedAt != nil && run.EndedAt.Before(cutoff)
+		if !expired && kept < config.MaxRunsWithArtifacts {
+			kept++
+			continue
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("failed to remove artifacts of run %s: %v", run.ID, err)
+		}
+		removed = append(removed, run.ID)
+	}
+	return removed, nil
+}
+
+// RemoveArtifacts deletes the local artifact directory of a finished run
+func (rm *RunManager) RemoveArtifacts(id string) error {
+	run, ok := rm.GetRun(id)
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	if run.Status == StatusRunning {
+		return fmt.Errorf("run %s is still running", id)
+	}
+	return os.RemoveAll(rm.ArtifactsDir(id))
+}
+
+// ArtifactUsage is the disk space taken by the artifacts of all runs
+type ArtifactUsage struct {
+	Bytes int64 `json:"bytes"`
+	Runs  int   `json:"runs"` // runs that still have artifacts
+}
+
+// ApplyQuota removes artifact directories of finished runs, oldest first, until the
+// artifacts of all runs take at most maxBytes. Running runs are never touched. It
+// returns the removed run IDs and the usage afterwards.
+func (rm *RunManager) ApplyQuota(maxBytes int64) ([]string, ArtifactUsage, error) {
+	rm.mutex.RLock()
+	config := rm.config
+	list := rm.sortedRuns()
+	rm.mutex.RUnlock()
+
+	usage := ArtifactUsage{}
+	sizes := make(map[string]int64, len(list))
+	for _, run := range list {
+		size, err := dirSize(filepath.Join(config.DataDir, run.ID, "artifacts"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, usage, fmt.Errorf("failed to measure artifacts of run %s: %v", run.ID, err)
+		}
+		sizes[run.ID] = size
+		usage.Bytes += size
+		usage.Runs++
+	}
+
+	removed := make([]string, 0)
+	for i := len(list) - 1; i >= 0 && usage.Bytes > maxBytes; i-- {
+		run := list[i]
+		size, ok := sizes[run.ID]
+		if !ok || run.Status == StatusRunning {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(config.DataDir, run.ID, "artifacts")); err != nil {
+			return removed, usage, fmt.Errorf("failed to remove artifacts of run %s: %v", run.ID, err)
+		}
+		usage.Bytes -= size
+		usage.Runs--
+		removed = append(removed, run.ID)
+	}
+	return removed, usage, nil
+}
+
+// dirSize adds up the sizes of the regular files below dir
+func dirSize(dir string) (int64, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, err
+	}
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// StartRetentionLoop applies the retention policy periodically
+func (rm *RunManager) StartRetentionLoop(interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := rm.ApplyRetention(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
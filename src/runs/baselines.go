@@ -0,0 +1,360 @@
+package runs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Summary metrics recorded for every finished run and compared against baselines
+const (
+	MetricIngestEPS         = "ingest_eps"
+	MetricTargetAttainment  = "target_attainment_pct"
+	MetricProducerSendRate  = "producer_send_rate"
+	MetricProducerErrorRate = "producer_error_rate"
+	MetricAvgCPUUsage       = "avg_cpu_usage"
+	MetricAvgMemoryUsage    = "avg_memory_usage"
+	MetricMaxPodMemoryPct   = "max_pod_memory_pct"
+	// Attainment of the run's targetKafka (msg/s) and targetClickHouse (rows/s)
+	MetricKafkaAttainment      = "kafka_target_attainment_pct"
+	MetricClickHouseRowsPerSec = "clickhouse_rows_per_sec"
+	MetricClickHouseAttainment = "clickhouse_target_attainment_pct"
+	// Capacity discovered by the adaptive EPS controller
+	MetricCapacityEPS = "capacity_eps"
+)
+
+// metricHigherIsBetter tells for every summary metric which direction is a regression
+var metricHigherIsBetter = map[string]bool{
+	MetricIngestEPS:         true,
+	MetricTargetAttainment:  true,
+	MetricProducerSendRate:  true,
+	MetricProducerErrorRate: false,
+	MetricAvgCPUUsage:       false,
+	MetricAvgMemoryUsage:    false,
+	MetricMaxPodMemoryPct:   false,
+
+	MetricKafkaAttainment:      true,
+	MetricClickHouseRowsPerSec: true,
+	MetricClickHouseAttainment: true,
+	MetricCapacityEPS:          true,
+}
+
+// DefaultRegressionTolerances are the allowed changes in percent before a metric regresses
+func DefaultRegressionTolerances() map[string]float64 {
+	return map[string]float64{
+		MetricIngestEPS:         10,
+		MetricTargetAttainment:  10,
+		MetricProducerSendRate:  10,
+		MetricProducerErrorRate: 20,
+		MetricAvgCPUUsage:       15,
+		MetricAvgMemoryUsage:    15,
+		MetricMaxPodMemoryPct:   15,
+
+		MetricKafkaAttainment:      10,
+		MetricClickHouseRowsPerSec: 10,
+		MetricClickHouseAttainment: 10,
+		MetricCapacityEPS:          10,
+	}
+}
+
+// Regression verdicts
+const (
+	VerdictPass   = "pass"
+	VerdictFail   = "fail"
+	VerdictNoData = "no_data" // no metric could be compared
+)
+
+// Baseline pins a run as the reference for all later runs of its scenario
+type Baseline struct {
+	Scenario   string             `json:"scenario"`
+	RunID      string             `json:"runId"`
+	PinnedAt   time.Time          `json:"pinnedAt"`
+	PinnedBy   string             `json:"pinnedBy,omitempty"`
+	Tolerances map[string]float64 `json:"tolerances,omitempty"` // overrides of the configured tolerances
+}
+
+// MetricComparison is the result of comparing one summary metric
+type MetricComparison struct {
+	Metric       string   `json:"metric"`
+	Baseline     float64  `json:"baseline"`
+	Current      float64  `json:"current"`
+	ChangePct    *float64 `json:"changePct,omitempty"` // nil when the baseline value is 0
+	TolerancePct float64  `json:"tolerancePct"`
+	HigherBetter bool     `json:"higherIsBetter"`
+	Regressed    bool     `json:"regressed"`
+}
+
+// Comparison is the regression verdict of a run against its scenario baseline
+type Comparison struct {
+	Scenario      string             `json:"scenario"`
+	BaselineRunID string             `json:"baselineRunId"`
+	Verdict       string             `json:"verdict"`
+	Regressions   []string           `json:"regressions,omitempty"`
+	Metrics       []MetricComparison `json:"metrics"`
+	ComparedAt    time.Time          `json:"comparedAt"`
+}
+
+// Compare checks the summary of a run against a baseline run. A metric regresses when
+// it moved in the wrong direction by more than its tolerance.
+func Compare(baseline, current *Run, tolerances map[string]float64) *Comparison {
+	comparison := &Comparison{
+		Scenario:      current.ScenarioName(),
+		BaselineRunID: baseline.ID,
+		Verdict:       VerdictNoData,
+		Metrics:       []MetricComparison{},
+		ComparedAt:    time.Now().UTC(),
+	}
+
+	names := make([]string, 0, len(current.Summary))
+	for name := range current.Summary {
+		if _, ok := baseline.Summary[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		higherBetter, known := metricHigherIsBetter[name]
+		if !known {
+			continue
+		}
+		result := MetricComparison{
+			Metric:       name,
+			Baseline:     baseline.Summary[name],
+			Current:      current.Summary[name],
+			TolerancePct: tolerances[name],
+			HigherBetter: higherBetter,
+		}
+		if result.Baseline != 0 {
+			change := (result.Current - result.Baseline) / result.Baseline * 100
+			result.ChangePct = &change
+			if higherBetter {
+				result.Regressed = change < -result.TolerancePct
+			} else {
+				result.Regressed = change > result.TolerancePct
+			}
+		} else if !higherBetter && result.Current > 0 {
+			// e.g. producer errors appearing where the baseline had none
+			result.Regressed = true
+		}
+		if result.Regressed {
+			comparison.Regressions = append(comparison.Regressions, name)
+		}
+		comparison.Metrics = append(comparison.Metrics, result)
+	}
+
+	if len(comparison.Metrics) > 0 {
+		comparison.Verdict = VerdictPass
+		if len(comparison.Regressions) > 0 {
+			comparison.Verdict = VerdictFail
+		}
+	}
+	return comparison
+}
+
+// ScenarioName returns the scenario a run belongs to; runs without one are grouped by profile
+func (r *Run) ScenarioName() string {
+	if r.Scenario != "" {
+		return r.Scenario
+	}
+	return r.Profile
+}
+
+// RegressionTolerances returns the configured tolerances merged with a baseline's overrides
+func (rm *RunManager) RegressionTolerances(baseline *Baseline) map[string]float64 {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	tolerances := DefaultRegressionTolerances()
+	for name, value := range rm.config.RegressionTolerances {
+		tolerances[name] = value
+	}
+	if baseline != nil {
+		for name, value := range baseline.Tolerances {
+			tolerances[name] = value
+		}
+	}
+	return tolerances
+}
+
+// SetSummary stores the summary metrics of a run
+func (rm *RunManager) SetSummary(id string, summary map[string]float64) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Summary = summary
+	return rm.save()
+}
+
+// SetComparison stores the regression verdict of a run
+func (rm *RunManager) SetComparison(id string, comparison *Comparison) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Comparison = comparison
+	return rm.save()
+}
+
+// SetWorkspace stores the workspace a run belongs to
+func (rm *RunManager) SetWorkspace(id, workspace string) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Workspace = workspace
+	return rm.save()
+}
+
+// SetRemoteCopy stores the outcome of uploading a run's artifacts
+func (rm *RunManager) SetRemoteCopy(id string, remote *RemoteCopy) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Remote = remote
+	return rm.save()
+}
+
+// PinBaseline makes a finished run the baseline of its scenario
+func (rm *RunManager) PinBaseline(runID, pinnedBy string, tolerances map[string]float64) (*Baseline, error) {
+	for name, value := range tolerances {
+		if _, known := metricHigherIsBetter[name]; !known {
+			return nil, fmt.Errorf("unknown metric %s", name)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("tolerance of %s must not be negative", name)
+		}
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[runID]
+	if !ok {
+		return nil, fmt.Errorf("run %s not found", runID)
+	}
+	if run.Status == StatusRunning {
+		return nil, fmt.Errorf("run %s is still running", runID)
+	}
+	if len(run.Summary) == 0 {
+		return nil, fmt.Errorf("run %s has no summary metrics to compare against", runID)
+	}
+
+	baselines, err := rm.readBaselines()
+	if err != nil {
+		return nil, err
+	}
+	baseline := &Baseline{
+		Scenario:   run.ScenarioName(),
+		RunID:      run.ID,
+		PinnedAt:   time.Now().UTC(),
+		PinnedBy:   pinnedBy,
+		Tolerances: tolerances,
+	}
+	baselines[baseline.Scenario] = baseline
+	if err := rm.writeBaselines(baselines); err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
+
+// UnpinBaseline removes the baseline of a scenario
+func (rm *RunManager) UnpinBaseline(scenario string) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	baselines, err := rm.readBaselines()
+	if err != nil {
+		return err
+	}
+	if _, ok := baselines[scenario]; !ok {
+		return fmt.Errorf("no baseline pinned for scenario %s", scenario)
+	}
+	delete(baselines, scenario)
+	return rm.writeBaselines(baselines)
+}
+
+// Baselines returns all pinned baselines ordered by scenario
+func (rm *RunManager) Baselines() ([]*Baseline, error) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	baselines, err := rm.readBaselines()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Baseline, 0, len(baselines))
+	for _, baseline := range baselines {
+		list = append(list, baseline)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Scenario < list[j].Scenario })
+	return list, nil
+}
+
+// GetBaseline returns the baseline pinned for a scenario, if any
+func (rm *RunManager) GetBaseline(scenario string) (*Baseline, bool) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	baselines, err := rm.readBaselines()
+	if err != nil {
+		return nil, false
+	}
+	baseline, ok := baselines[scenario]
+	return baseline, ok
+}
+
+func (rm *RunManager) baselinesPath() string {
+	return filepath.Join(rm.config.DataDir, "baselines.json")
+}
+
+// readBaselines reads the baselines file; callers must hold the lock. Baselines are
+// read from disk each time so every HA instance sees the same pins.
+func (rm *RunManager) readBaselines() (map[string]*Baseline, error) {
+	baselines := make(map[string]*Baseline)
+	data, err := os.ReadFile(rm.baselinesPath())
+	if os.IsNotExist(err) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baselines file: %v", err)
+	}
+	if err := json.Unmarshal(data, &baselines); err != nil {
+		return nil, fmt.Errorf("failed to parse baselines file: %v", err)
+	}
+	return baselines, nil
+}
+
+// writeBaselines writes the baselines file; callers must hold the lock
+func (rm *RunManager) writeBaselines(baselines map[string]*Baseline) error {
+	if err := os.MkdirAll(rm.config.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create runs directory: %v", err)
+	}
+	data, err := json.MarshalIndent(baselines, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal baselines: %v", err)
+	}
+
+	tmp := rm.baselinesPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write baselines file: %v", err)
+	}
+	return os.Rename(tmp, rm.baselinesPath())
+}
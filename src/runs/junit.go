@@ -0,0 +1,164 @@
+package runs
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// JUnitTestSuites is the root of a JUnit XML report as read by Jenkins and GitLab
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite groups the checks of one run
+type JUnitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []JUnitProperty `xml:"properties>property,omitempty"`
+	Cases      []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitProperty is a name/value pair describing the run
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// JUnitTestCase is one pass/fail check; a case without failure or skipped passed
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// JUnitFailure explains why a check failed
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitSkipped explains why a check could not be made
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// JUnit renders the pass/fail checks of a finished run as a JUnit report: whether the
+// run completed, and one case per metric compared against the scenario baseline with
+// its regression tolerance as the threshold. Without a comparison the regression case
+// is skipped.
+func (r *Run) JUnit() *JUnitTestSuites {
+	end := time.Now().UTC()
+	if r.EndedAt != nil {
+		end = *r.EndedAt
+	}
+	duration := junitSeconds(end.Sub(r.StartedAt))
+	suite := JUnitTestSuite{
+		Name:      "vuDataSim." + r.ScenarioName(),
+		Time:      duration,
+		Timestamp: r.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+		Properties: []JUnitProperty{
+			{Name: "runId", Value: r.ID},
+			{Name: "profile", Value: r.Profile},
+			{Name: "scenario", Value: r.ScenarioName()},
+			{Name: "targetEps", Value: strconv.Itoa(r.TargetEPS)},
+		},
+	}
+
+	status := JUnitTestCase{Name: "completed", ClassName: "run", Time: duration, SystemOut: "status: " + r.Status}
+	if r.Status != StatusCompleted {
+		status.Failure = &JUnitFailure{
+			Message: fmt.Sprintf("Run ended with status %s", r.Status),
+			Type:    "status",
+			Text:    fmt.Sprintf("Run %s ended with status %s instead of %s", r.ID, r.Status, StatusCompleted),
+		}
+	}
+	suite.Cases = append(suite.Cases, status)
+
+	switch {
+	case r.Comparison == nil:
+		suite.Cases = append(suite.Cases, JUnitTestCase{
+			Name:      "baseline",
+			ClassName: "regression",
+			Time:      "0",
+			Skipped:   &JUnitSkipped{Message: fmt.Sprintf("No baseline pinned for scenario %s", r.ScenarioName())},
+		})
+	case len(r.Comparison.Metrics) == 0:
+		suite.Cases = append(suite.Cases, JUnitTestCase{
+			Name:      "baseline",
+			ClassName: "regression",
+			Time:      "0",
+			Skipped:   &JUnitSkipped{Message: fmt.Sprintf("No metric could be compared with baseline run %s", r.Comparison.BaselineRunID)},
+		})
+	default:
+		suite.Properties = append(suite.Properties, JUnitProperty{Name: "baselineRunId", Value: r.Comparison.BaselineRunID})
+		for _, metric := range r.Comparison.Metrics {
+			suite.Cases = append(suite.Cases, metric.junitCase(r.Comparison.BaselineRunID))
+		}
+	}
+
+	for _, testCase := range suite.Cases {
+		suite.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+		if testCase.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return &JUnitTestSuites{
+		Name:     "vuDataSim run " + r.ID,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     duration,
+		Suites:   []JUnitTestSuite{suite},
+	}
+}
+
+// junitCase renders a metric comparison as a test case that fails when the metric regressed
+func (m MetricComparison) junitCase(baselineRunID string) JUnitTestCase {
+	direction := "at most"
+	if m.HigherBetter {
+		direction = "at least"
+	}
+	bound := -m.TolerancePct
+	if !m.HigherBetter {
+		bound = m.TolerancePct
+	}
+	change := "n/a"
+	if m.ChangePct != nil {
+		change = fmt.Sprintf("%+.2f%%", *m.ChangePct)
+	}
+	detail := fmt.Sprintf("baseline %g (run %s), current %g, change %s, threshold %s %+g%%",
+		m.Baseline, baselineRunID, m.Current, change, direction, bound)
+
+	testCase := JUnitTestCase{Name: m.Metric, ClassName: "regression", Time: "0", SystemOut: detail}
+	if m.Regressed {
+		testCase.Failure = &JUnitFailure{
+			Message: fmt.Sprintf("%s regressed: %s", m.Metric, change),
+			Type:    "regression",
+			Text:    detail,
+		}
+	}
+	return testCase
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,515 @@
+package runs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Run statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	// StatusAutoStopped marks runs stopped by the simulation watchdog
+	StatusAutoStopped = "auto_stopped"
+)
+
+// Config holds the runs section of config.yaml
+type Config struct {
+	DataDir               string `yaml:"data_dir"`
+	ArtifactRetentionDays int    `yaml:"artifact_retention_days"`
+	MaxRunsWithArtifacts  int    `yaml:"max_runs_with_artifacts"`
+	// RegressionTolerances overrides DefaultRegressionTolerances per metric, in percent
+	RegressionTolerances map[string]float64 `yaml:"regression_tolerances"`
+}
+
+// Run is a single simulation run
+type Run struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name,omitempty"` // given by POST /api/runs
+	Status           string          `json:"status"`
+	Profile          string          `json:"profile"`
+	Scenario         string          `json:"scenario,omitempty"`
+	TargetEPS        int             `json:"targetEps"`
+	TargetKafka      int             `json:"targetKafka"`
+	TargetClickHouse int             `json:"targetClickHouse"`
+	DurationMinutes  int             `json:"durationMinutes,omitempty"`
+	StartedAt        time.Time       `json:"startedAt"`
+	EndedAt          *time.Time      `json:"endedAt,omitempty"`
+	Timeline         []TimelineEvent `json:"timeline,omitempty"`
+	// Summary holds the metrics recorded when the run finished, see Compare
+	Summary    map[string]float64 `json:"summary,omitempty"`
+	Comparison *Comparison        `json:"comparison,omitempty"`
+	// Workspace selects where the run's artifacts are uploaded, see RemoteCopy
+	Workspace string      `json:"workspace,omitempty"`
+	Remote    *RemoteCopy `json:"remote,omitempty"`
+	// Owner is who started the run, whose quota it counts against
+	Owner *RunOwner `json:"owner,omitempty"`
+	// TemporaryTopics are the Kafka topics created for the run in place of the sources' own
+	TemporaryTopics []TemporaryTopic `json:"temporaryTopics,omitempty"`
+	// Configuration is what the run started with
+	Configuration *Configuration `json:"configuration,omitempty"`
+}
+
+// Configuration is the EPS distribution, nodes and k6 settings a run started with
+type Configuration struct {
+	SourceEPS  map[string]int  `json:"sourceEps"`  // EPS per node of every enabled source, from conf.d
+	NodeEPS    int             `json:"nodeEps"`    // sum of SourceEPS
+	ClusterEPS int             `json:"clusterEps"` // NodeEPS on every enabled node
+	Nodes      []string        `json:"nodes"`      // enabled nodes
+	K6         json.RawMessage `json:"k6,omitempty"`
+	CapturedAt time.Time       `json:"capturedAt"`
+}
+
+// ListFilter selects runs for List; zero fields match every run
+type ListFilter struct {
+	Status   string
+	Profile  string
+	Scenario string
+	Since    time.Time // started at or after
+	Until    time.Time // started before
+	Limit    int
+}
+
+// TemporaryTopic is a Kafka topic a run's source wrote to instead of its own topic
+type TemporaryTopic struct {
+	Source   string `json:"source"`
+	Original string `json:"original"` // the topic in the source's conf.yml before the run
+	Topic    string `json:"topic"`
+	Restored bool   `json:"restored"` // conf.yml points at Original again and was pushed
+	Deleted  bool   `json:"deleted"`
+	Error    string `json:"error,omitempty"` // why the last teardown did not finish
+}
+
+// RunOwner is the caller that started a run
+type RunOwner struct {
+	Name string `json:"name"` // API key name
+	User string `json:"user,omitempty"`
+	Team string `json:"team,omitempty"`
+}
+
+// RemoteCopy records the upload of a run's artifacts to object storage
+type RemoteCopy struct {
+	Backend    string     `json:"backend"`
+	Bucket     string     `json:"bucket"`
+	Prefix     string     `json:"prefix"` // object key prefix of the run, ending in /
+	Objects    []string   `json:"objects"`
+	Bytes      int64      `json:"bytes"`
+	UploadedAt *time.Time `json:"uploadedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// TimelineEvent is a notable change recorded during a run
+type TimelineEvent struct {
+	Time    time.Time              `json:"time"`
+	Type    string                 `json:"type"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// RunManager keeps the run history and per-run artifact directories
+type RunManager struct {
+	config Config
+	runs   map[string]*Run
+	mutex  sync.RWMutex
+	// onTimeline is called with every timeline event as it is recorded
+	onTimeline func(runID string, event TimelineEvent)
+}
+
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// NewRunManager creates a run manager with default settings
+func NewRunManager() *RunManager {
+	return &RunManager{
+		config: Config{
+			DataDir:               "data/runs",
+			ArtifactRetentionDays: 30,
+			MaxRunsWithArtifacts:  50,
+		},
+		runs: make(map[string]*Run),
+	}
+}
+
+// LoadConfig reads the runs section from the application config file
+func (rm *RunManager) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var wrapper struct {
+		Runs Config `yaml:"runs"`
+	}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if wrapper.Runs.DataDir != "" {
+		rm.config.DataDir = wrapper.Runs.DataDir
+	}
+	if wrapper.Runs.ArtifactRetentionDays > 0 {
+		rm.config.ArtifactRetentionDays = wrapper.Runs.ArtifactRetentionDays
+	}
+	if wrapper.Runs.MaxRunsWithArtifacts > 0 {
+		rm.config.MaxRunsWithArtifacts = wrapper.Runs.MaxRunsWithArtifacts
+	}
+	for name, value := range wrapper.Runs.RegressionTolerances {
+		if _, known := metricHigherIsBetter[name]; !known {
+			return fmt.Errorf("unknown metric %s in runs.regression_tolerances", name)
+		}
+		if value < 0 {
+			return fmt.Errorf("tolerance of %s must not be negative", name)
+		}
+	}
+	rm.config.RegressionTolerances = wrapper.Runs.RegressionTolerances
+	return nil
+}
+
+// Load reads the persisted run history
+func (rm *RunManager) Load() error {
+	_, err := rm.load(false)
+	return err
+}
+
+// Resume re-reads the run history written by another manager instance that has gone
+// away and adopts its still running run, returned as the newest running run (or nil)
+func (rm *RunManager) Resume() (*Run, error) {
+	return rm.load(true)
+}
+
+func (rm *RunManager) load(resume bool) (*Run, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	data, err := os.ReadFile(rm.indexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runs file: %v", err)
+	}
+
+	var list []*Run
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse runs file: %v", err)
+	}
+
+	var active *Run
+	if resume {
+		for _, run := range list {
+			if run.Status == StatusRunning && (active == nil || run.StartedAt.After(active.StartedAt)) {
+				active = run
+			}
+		}
+	}
+
+	rm.runs = make(map[string]*Run, len(list))
+	for _, run := range list {
+		// A run still marked running was interrupted by a manager restart
+		if run.Status == StatusRunning && run != active {
+			run.Status = StatusFailed
+		}
+		rm.runs[run.ID] = run
+	}
+	if active == nil {
+		return nil, nil
+	}
+	return active.clone(), nil
+}
+
+// save writes the run history; callers must hold the lock
+func (rm *RunManager) save() error {
+	if err := os.MkdirAll(rm.config.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create runs directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(rm.sortedRuns(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal runs: %v", err)
+	}
+
+	tmp := rm.indexPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write runs file: %v", err)
+	}
+	return os.Rename(tmp, rm.indexPath())
+}
+
+func (rm *RunManager) indexPath() string {
+	return filepath.Join(rm.config.DataDir, "runs.json")
+}
+
+// sortedRuns returns runs newest first; callers must hold the lock
+func (rm *RunManager) sortedRuns() []*Run {
+	list := make([]*Run, 0, len(rm.runs))
+	for _, run := range rm.runs {
+		list = append(list, run)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+	return list
+}
+
+// StartRun records a new running run. Runs of the same scenario are compared against
+// its pinned baseline; an empty scenario falls back to the profile.
+func (rm *RunManager) StartRun(profile, scenario string, targetEPS, targetKafka, targetClickHouse, durationMinutes int) (*Run, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	now := time.Now().UTC()
+	run := &Run{
+		ID:               newRunID(now),
+		Status:           StatusRunning,
+		Profile:          profile,
+		Scenario:         scenario,
+		TargetEPS:        targetEPS,
+		TargetKafka:      targetKafka,
+		TargetClickHouse: targetClickHouse,
+		DurationMinutes:  durationMinutes,
+		StartedAt:        now,
+	}
+	rm.runs[run.ID] = run
+	rm.appendTimelineLocked(run, TimelineEvent{
+		Time:    now,
+		Type:    "run_started",
+		Message: fmt.Sprintf("Run started with profile %s, target EPS %d", profile, targetEPS),
+	})
+
+	if err := rm.save(); err != nil {
+		return run, err
+	}
+	return run.clone(), nil
+}
+
+// FinishRun marks a run as ended with the given status
+func (rm *RunManager) FinishRun(id, status string) (*Run, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("run %s not found", id)
+	}
+	now := time.Now().UTC()
+	run.Status = status
+	run.EndedAt = &now
+	rm.appendTimelineLocked(run, TimelineEvent{
+		Time:    now,
+		Type:    "run_finished",
+		Message: fmt.Sprintf("Run finished with status %s", status),
+	})
+
+	if err := rm.save(); err != nil {
+		return run, err
+	}
+	return run.clone(), nil
+}
+
+// AddTimelineEvent appends an event to a run's timeline
+func (rm *RunManager) AddTimelineEvent(id, eventType, message string, data map[string]interface{}) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	rm.appendTimelineLocked(run, TimelineEvent{
+		Time:    time.Now().UTC(),
+		Type:    eventType,
+		Message: message,
+		Data:    data,
+	})
+	return rm.save()
+}
+
+// OnTimelineEvent registers a function called with every timeline event recorded from
+// now on, e.g. to keep a history across runs. It runs with the run store locked and
+// must not call back into it.
+func (rm *RunManager) OnTimelineEvent(fn func(runID string, event TimelineEvent)) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.onTimeline = fn
+}
+
+func (rm *RunManager) appendTimelineLocked(run *Run, event TimelineEvent) {
+	run.Timeline = append(run.Timeline, event)
+	if rm.onTimeline != nil {
+		rm.onTimeline(run.ID, event)
+	}
+}
+
+// SetOwner records who started a run
+func (rm *RunManager) SetOwner(id string, owner RunOwner) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Owner = &owner
+	return rm.save()
+}
+
+// SetTemporaryTopics stores the temporary Kafka topics of a run and their teardown state
+func (rm *RunManager) SetTemporaryTopics(id string, topics []TemporaryTopic) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.TemporaryTopics = append([]TemporaryTopic(nil), topics...)
+	return rm.save()
+}
+
+// SetConfiguration stores the name of a run and the configuration it started with
+func (rm *RunManager) SetConfiguration(id, name string, configuration Configuration) error {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return fmt.Errorf("run %s not found", id)
+	}
+	run.Name = name
+	run.Configuration = &configuration
+	return rm.save()
+}
+
+// List returns copies of the runs matching filter without their timelines, newest
+// first, and how many matched before the limit
+func (rm *RunManager) List(filter ListFilter) ([]*Run, int) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	list := []*Run{}
+	total := 0
+	for _, run := range rm.sortedRuns() {
+		switch {
+		case filter.Status != "" && run.Status != filter.Status,
+			filter.Profile != "" && run.Profile != filter.Profile,
+			filter.Scenario != "" && run.ScenarioName() != filter.Scenario,
+			!filter.Since.IsZero() && run.StartedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !run.StartedAt.Before(filter.Until):
+			continue
+		}
+		total++
+		if filter.Limit > 0 && len(list) == filter.Limit {
+			continue
+		}
+		copied := run.clone()
+		copied.Timeline = nil
+		list = append(list, copied)
+	}
+	return list, total
+}
+
+// RunningRuns returns copies of the runs that have not finished, newest first
+func (rm *RunManager) RunningRuns() []*Run {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	var running []*Run
+	for _, run := range rm.sortedRuns() {
+		if run.Status == StatusRunning {
+			running = append(running, run.clone())
+		}
+	}
+	return running
+}
+
+// GetRun returns a copy of the run with the given ID
+func (rm *RunManager) GetRun(id string) (*Run, bool) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	run, ok := rm.runs[id]
+	if !ok {
+		return nil, false
+	}
+	return run.clone(), true
+}
+
+// FinishedBetween returns copies of the runs that ended in [from, to), oldest first
+func (rm *RunManager) FinishedBetween(from, to time.Time) []*Run {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	var list []*Run
+	for _, run := range rm.runs {
+		if run.EndedAt != nil && !run.EndedAt.Before(from) && run.EndedAt.Before(to) {
+			list = append(list, run.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].EndedAt.Before(*list[j].EndedAt)
+	})
+	return list
+}
+
+// LatestFinished returns a copy of the run that ended last, or nil
+func (rm *RunManager) LatestFinished() *Run {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	var latest *Run
+	for _, run := range rm.runs {
+		if run.EndedAt != nil && (latest == nil || run.EndedAt.After(*latest.EndedAt)) {
+			latest = run
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return latest.clone()
+}
+
+// clone returns a copy that is safe to hand out while the run keeps changing
+func (r *Run) clone() *Run {
+	copied := *r
+	copied.Timeline = append([]TimelineEvent(nil), r.Timeline...)
+	copied.TemporaryTopics = append([]TemporaryTopic(nil), r.TemporaryTopics...)
+	if r.Configuration != nil {
+		configuration := *r.Configuration
+		configuration.Nodes = append([]string{}, r.Configuration.Nodes...)
+		configuration.SourceEPS = make(map[string]int, len(r.Configuration.SourceEPS))
+		for source, eps := range r.Configuration.SourceEPS {
+			configuration.SourceEPS[source] = eps
+		}
+		copied.Configuration = &configuration
+	}
+	if r.Summary != nil {
+		copied.Summary = make(map[string]float64, len(r.Summary))
+		for name, value := range r.Summary {
+			copied.Summary[name] = value
+		}
+	}
+	return &copied
+}
+
+// ValidRunID reports whether the ID is safe to use as a path component
+func ValidRunID(id string) bool {
+	return runIDPattern.MatchString(id)
+}
+
+func newRunID(t time.Time) string {
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return fmt.Sprintf("run-%s-%s", t.Format("20060102-150405"), hex.EncodeToString(suffix))
+}
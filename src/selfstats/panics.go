@@ -0,0 +1,62 @@
+package selfstats
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRecentPanics is how many recovered panics are kept for inspection
+const maxRecentPanics = 20
+
+// PanicRecord describes one handler panic recovered by the API middleware
+type PanicRecord struct {
+	Time        time.Time `json:"time"`
+	ReferenceID string    `json:"referenceId"` // the request's correlation ID
+	Method      string    `json:"method"`
+	Route       string    `json:"route"`
+	Path        string    `json:"path"`
+	Error       string    `json:"error"`
+}
+
+// PanicReport is the response of /api/self/panics
+type PanicReport struct {
+	Total   int64            `json:"total"`
+	ByRoute map[string]int64 `json:"byRoute"`
+	Recent  []PanicRecord    `json:"recent"` // newest first
+}
+
+var panics = struct {
+	mutex   sync.Mutex
+	total   int64
+	byRoute map[string]int64
+	recent  []PanicRecord
+}{byRoute: make(map[string]int64)}
+
+// RecordPanic counts a recovered panic and keeps it in the recent list
+func RecordPanic(record PanicRecord) {
+	panics.mutex.Lock()
+	defer panics.mutex.Unlock()
+
+	panics.total++
+	panics.byRoute[record.Method+" "+record.Route]++
+	panics.recent = append([]PanicRecord{record}, panics.recent...)
+	if len(panics.recent) > maxRecentPanics {
+		panics.recent = panics.recent[:maxRecentPanics]
+	}
+}
+
+// Panics returns the panic counters since the manager started
+func Panics() PanicReport {
+	panics.mutex.Lock()
+	defer panics.mutex.Unlock()
+
+	report := PanicReport{
+		Total:   panics.total,
+		ByRoute: make(map[string]int64, len(panics.byRoute)),
+		Recent:  append([]PanicRecord{}, panics.recent...),
+	}
+	for route, count := range panics.byRoute {
+		report.ByRoute[route] = count
+	}
+	return report
+}
@@ -0,0 +1,266 @@
+package selfstats
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation categories tracked for the manager's own error budget
+const (
+	CategorySSH          = "ssh"
+	CategoryDistribution = "distribution"
+	CategoryClickHouse   = "clickhouse"
+	CategoryKafkaAdmin   = "kafka_admin"
+	CategoryNodePoll     = "node_poll" // HTTP requests to node agents
+)
+
+// Budget statuses, derived from the 1h window
+const (
+	StatusOK        = "ok"
+	StatusDegraded  = "degraded"  // more than half of the error budget consumed
+	StatusExhausted = "exhausted" // failure rate above what the objective allows
+	StatusNoData    = "no_data"
+)
+
+// sshTransportExitCode is what ssh returns for its own failures (auth, connect);
+// any other exit code comes from the remote command
+const sshTransportExitCode = 255
+
+const bucketCount = 24 * 60 // one bucket per minute for 24h
+
+var windows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// defaultObjectives are the target success ratios per category
+var defaultObjectives = map[string]float64{
+	CategorySSH:          0.99,
+	CategoryDistribution: 0.99,
+	CategoryClickHouse:   0.995,
+	CategoryKafkaAdmin:   0.95,
+	CategoryNodePoll:     0.95,
+}
+
+// WindowStats holds the outcome counts of one rolling window
+type WindowStats struct {
+	Total          int      `json:"total"`
+	Failures       int      `json:"failures"`
+	SuccessRate    *float64 `json:"successRate,omitempty"`
+	BudgetConsumed float64  `json:"budgetConsumed"` // 1.0 means the whole error budget is used up
+}
+
+// CategoryReport is the reliability of one operation category
+type CategoryReport struct {
+	Objective     float64                `json:"objective"`
+	Status        string                 `json:"status"`
+	Windows       map[string]WindowStats `json:"windows"`
+	LastError     string                 `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time             `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time             `json:"lastSuccessAt,omitempty"`
+}
+
+// Report is the response of /api/self/reliability
+type Report struct {
+	GeneratedAt time.Time                 `json:"generatedAt"`
+	Status      string                    `json:"status"` // worst category status
+	Categories  map[string]CategoryReport `json:"categories"`
+}
+
+type bucket struct {
+	minute   int64
+	success  int
+	failures int
+}
+
+type category struct {
+	buckets       [bucketCount]bucket
+	lastError     string
+	lastErrorAt   time.Time
+	lastSuccessAt time.Time
+}
+
+// Tracker keeps per-minute success/failure counts of the manager's operations
+type Tracker struct {
+	mutex      sync.Mutex
+	categories map[string]*category
+	objectives map[string]float64
+}
+
+// NewTracker creates a tracker with the default objectives
+func NewTracker() *Tracker {
+	objectives := make(map[string]float64, len(defaultObjectives))
+	for name, objective := range defaultObjectives {
+		objectives[name] = objective
+	}
+	return &Tracker{
+		categories: make(map[string]*category),
+		objectives: objectives,
+	}
+}
+
+var defaultTracker = NewTracker()
+
+// Default returns the process-wide tracker
+func Default() *Tracker {
+	return defaultTracker
+}
+
+// Record counts one operation outcome on the process-wide tracker
+func Record(categoryName string, err error) {
+	defaultTracker.Record(categoryName, err)
+}
+
+// RecordSSH counts an SSH operation. A non-zero exit of the remote command still
+// means the SSH transport worked, so only exit code 255 and connection errors fail.
+func RecordSSH(err error) {
+	var exitErr interface{ ExitCode() int }
+	if err != nil && errors.As(err, &exitErr) && exitErr.ExitCode() != sshTransportExitCode {
+		err = nil
+	}
+	defaultTracker.Record(CategorySSH, err)
+}
+
+// Record counts one operation outcome
+func (t *Tracker) Record(categoryName string, err error) {
+	now := time.Now()
+	minute := now.Unix() / 60
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	c, ok := t.categories[categoryName]
+	if !ok {
+		c = &category{}
+		t.categories[categoryName] = c
+	}
+	b := &c.buckets[minute%bucketCount]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	if err != nil {
+		b.failures++
+		c.lastError = err.Error()
+		c.lastErrorAt = now.UTC()
+	} else {
+		b.success++
+		c.lastSuccessAt = now.UTC()
+	}
+}
+
+// SetObjective changes the target success ratio of a category
+func (t *Tracker) SetObjective(categoryName string, objective float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.objectives[categoryName] = objective
+}
+
+// Report summarizes every known category over the rolling windows
+func (t *Tracker) Report() Report {
+	now := time.Now()
+	currentMinute := now.Unix() / 60
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	report := Report{
+		GeneratedAt: now.UTC(),
+		Status:      StatusNoData,
+		Categories:  make(map[string]CategoryReport),
+	}
+
+	names := make([]string, 0, len(t.objectives)+len(t.categories))
+	for name := range t.objectives {
+		names = append(names, name)
+	}
+	for name := range t.categories {
+		if _, ok := t.objectives[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		objective, ok := t.objectives[name]
+		if !ok {
+			objective = 0.99
+		}
+		categoryReport := CategoryReport{
+			Objective: objective,
+			Status:    StatusNoData,
+			Windows:   make(map[string]WindowStats),
+		}
+
+		c := t.categories[name]
+		for _, window := range windows {
+			stats := WindowStats{}
+			if c != nil {
+				oldest := currentMinute - int64(window.duration/time.Minute) + 1
+				for _, b := range c.buckets {
+					if b.minute >= oldest && b.minute <= currentMinute {
+						stats.Total += b.success + b.failures
+						stats.Failures += b.failures
+					}
+				}
+			}
+			if stats.Total > 0 {
+				rate := float64(stats.Total-stats.Failures) / float64(stats.Total)
+				stats.SuccessRate = &rate
+				if objective < 1 {
+					stats.BudgetConsumed = (1 - rate) / (1 - objective)
+				} else if stats.Failures > 0 {
+					stats.BudgetConsumed = 1
+				}
+			}
+			categoryReport.Windows[window.name] = stats
+		}
+
+		if hourly := categoryReport.Windows["1h"]; hourly.Total > 0 {
+			switch {
+			case hourly.BudgetConsumed >= 1:
+				categoryReport.Status = StatusExhausted
+			case hourly.BudgetConsumed >= 0.5:
+				categoryReport.Status = StatusDegraded
+			default:
+				categoryReport.Status = StatusOK
+			}
+		}
+
+		if c != nil {
+			categoryReport.LastError = c.lastError
+			if !c.lastErrorAt.IsZero() {
+				lastErrorAt := c.lastErrorAt
+				categoryReport.LastErrorAt = &lastErrorAt
+			}
+			if !c.lastSuccessAt.IsZero() {
+				lastSuccessAt := c.lastSuccessAt
+				categoryReport.LastSuccessAt = &lastSuccessAt
+			}
+		}
+
+		report.Categories[name] = categoryReport
+		if statusRank(categoryReport.Status) > statusRank(report.Status) {
+			report.Status = categoryReport.Status
+		}
+	}
+	return report
+}
+
+func statusRank(status string) int {
+	switch status {
+	case StatusOK:
+		return 1
+	case StatusDegraded:
+		return 2
+	case StatusExhausted:
+		return 3
+	default:
+		return 0
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
+	"vuDataSim/src/handlers"
 	"vuDataSim/src/logger"
 	"vuDataSim/src/node_control"
 )
@@ -164,18 +164,13 @@ func getNodeTotalMemory(nodeConfig node_control.NodeConfig) (float64, error) {
 
 // pollNodeMetrics performs HTTP GET request to node's metrics endpoint
 func pollNodeMetrics(nodeConfig node_control.NodeConfig) (*node_control.HTTPMetricsResponse, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-	}
-
 	// Build metrics URL
-	metricsURL := fmt.Sprintf("http://%s:%d/api/system/metrics", nodeConfig.Host, nodeConfig.MetricsPort)
+	metricsURL := nodeConfig.AgentURL("/api/system/metrics")
 
 	logger.LogWithNode(nodeConfig.Host, "HTTP", fmt.Sprintf("Making GET request to %s", metricsURL), "info")
 
-	// Make HTTP request
-	resp, err := client.Get(metricsURL)
+	// Make HTTP request through the shared pool, which fails fast for dead nodes
+	resp, err := handlers.NodeClient.Get(context.Background(), metricsURL)
 	if err != nil {
 		logger.LogError(nodeConfig.Host, "HTTP", fmt.Sprintf("Request failed: %v", err))
 		return nil, fmt.Errorf("HTTP request failed: %v", err)
@@ -277,48 +272,20 @@ func getLocalSystemCPU() (float64, error) {
 
 // Execute SSH command and return output
 func sshExec(nodeConfig node_control.NodeConfig, command string) (string, error) {
-	args := []string{
-		"-i", nodeConfig.KeyPath,
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "ConnectTimeout=10",
-		"-o", "LogLevel=ERROR", // Reduce SSH warnings
-		fmt.Sprintf("%s@%s", nodeConfig.User, nodeConfig.Host),
-		command,
-	}
-
-	cmd := exec.Command("ssh", args...)
-
-	// Get stdout and stderr separately
-	stdout, err := cmd.StdoutPipe()
-	stderr, err := cmd.StderrPipe()
+	result, err := node_control.SSH.Exec(nodeConfig.SSHTarget(), command)
 	if err != nil {
-		return "", fmt.Errorf("failed to create pipes: %v", err)
-	}
-
-	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start SSH command: %v", err)
-	}
-
-	// Read stdout
-	stdoutBytes, _ := io.ReadAll(stdout)
-
-	// Read stderr (to capture warnings)
-	stderrBytes, _ := io.ReadAll(stderr)
-
-	if err := cmd.Wait(); err != nil {
-		return "", fmt.Errorf("SSH command failed: %v, stderr: %s", err, string(stderrBytes))
+		return "", fmt.Errorf("SSH command failed: %v", err)
 	}
 
 	// Clean the output by removing SSH warnings and connection messages
-	output := string(stdoutBytes)
+	output := result.Stdout
 	log.Printf("Raw stdout: %q", output) // Debug log
 	output = cleanSSHOutput(output)
 	log.Printf("Cleaned stdout: %q", output) // Debug log
 
 	// If output is still empty or contains warnings, try stderr
 	if strings.TrimSpace(output) == "" || strings.TrimSpace(output) == "0" {
-		output = string(stderrBytes)
+		output = result.Stderr
 		log.Printf("Raw stderr: %q", output) // Debug log
 		output = cleanSSHOutput(output)
 		log.Printf("Cleaned stderr: %q", output) // Debug log
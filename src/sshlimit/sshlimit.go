@@ -0,0 +1,214 @@
+// Package sshlimit caps the ssh and scp sessions the manager opens to one node at a
+// time. Callers over the cap wait in a FIFO queue for a slot, so dashboards and
+// background monitors together stay below the node's sshd MaxSessions.
+package sshlimit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrQueueTimeout is returned when no session slot became free in time
+var ErrQueueTimeout = errors.New("timed out waiting for an SSH session slot")
+
+// Config holds the ssh_limits section of config.yaml
+type Config struct {
+	MaxSessionsPerNode  int `yaml:"max_sessions_per_node" json:"maxSessionsPerNode"`
+	QueueTimeoutSeconds int `yaml:"queue_timeout_seconds" json:"queueTimeoutSeconds"` // 0 waits as long as it takes
+}
+
+// HostStats are the sessions and queue wait times of one node
+type HostStats struct {
+	Host       string     `json:"host"`
+	Active     int        `json:"active"`
+	Queued     int        `json:"queued"`
+	PeakQueued int        `json:"peakQueued"`
+	Sessions   int64      `json:"sessions"` // slots granted
+	Waited     int64      `json:"waited"`   // sessions that had to queue
+	TimedOut   int64      `json:"timedOut"`
+	AvgWaitMs  float64    `json:"avgWaitMs"` // over the sessions that had to queue
+	MaxWaitMs  float64    `json:"maxWaitMs"`
+	LastWaitMs float64    `json:"lastWaitMs"`
+	LastWaitAt *time.Time `json:"lastWaitAt,omitempty"`
+}
+
+type host struct {
+	stats       HostStats
+	totalWaitMs float64
+	waiters     []chan struct{} // closed when the slot is handed over, oldest first
+}
+
+// Limiter hands out session slots per node host
+type Limiter struct {
+	mutex  sync.Mutex
+	config Config
+	hosts  map[string]*host
+}
+
+// New creates a limiter with default settings
+func New() *Limiter {
+	return &Limiter{
+		config: Config{MaxSessionsPerNode: 4, QueueTimeoutSeconds: 120},
+		hosts:  make(map[string]*host),
+	}
+}
+
+var defaultLimiter = New()
+
+// Default returns the process-wide limiter
+func Default() *Limiter {
+	return defaultLimiter
+}
+
+// Acquire waits for a session slot to the host on the process-wide limiter
+func Acquire(hostName string) (func(), error) {
+	return defaultLimiter.Acquire(hostName)
+}
+
+// LoadConfig reads the ssh_limits section from the application config file
+func (l *Limiter) LoadConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config := l.Config()
+	wrapper := struct {
+		Limits *Config `yaml:"ssh_limits"`
+	}{Limits: &config}
+	if err := yaml.Unmarshal(data, &wrapper); err != nil {
+		return fmt.Errorf("failed to parse config file: %v", err)
+	}
+	if config.MaxSessionsPerNode <= 0 {
+		return fmt.Errorf("ssh_limits.max_sessions_per_node must be positive")
+	}
+	if config.QueueTimeoutSeconds < 0 {
+		config.QueueTimeoutSeconds = 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.config = config
+	for _, h := range l.hosts {
+		l.admitLocked(h) // a raised cap lets queued sessions through now
+	}
+	return nil
+}
+
+// Config returns the limiter settings
+func (l *Limiter) Config() Config {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.config
+}
+
+// Acquire returns once a session slot to the host is free, or ErrQueueTimeout after
+// queue_timeout_seconds. The returned release must be called when the ssh or scp
+// command has exited.
+func (l *Limiter) Acquire(hostName string) (func(), error) {
+	start := time.Now()
+	l.mutex.Lock()
+	h := l.hostLocked(hostName)
+	if h.stats.Active < l.config.MaxSessionsPerNode && len(h.waiters) == 0 {
+		h.stats.Active++
+		h.stats.Sessions++
+		l.mutex.Unlock()
+		return l.releaser(h), nil
+	}
+	ready := make(chan struct{})
+	h.waiters = append(h.waiters, ready)
+	h.stats.Queued = len(h.waiters)
+	h.stats.PeakQueued = max(h.stats.PeakQueued, h.stats.Queued)
+	active, timeout := h.stats.Active, time.Duration(l.config.QueueTimeoutSeconds)*time.Second
+	l.mutex.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-ready:
+	case <-expired:
+		l.mutex.Lock()
+		select {
+		case <-ready:
+			// The slot was handed over as the timer fired
+		default:
+			for i, waiter := range h.waiters {
+				if waiter == ready {
+					h.waiters = append(h.waiters[:i], h.waiters[i+1:]...)
+					break
+				}
+			}
+			h.stats.Queued = len(h.waiters)
+			h.stats.TimedOut++
+			l.mutex.Unlock()
+			return nil, fmt.Errorf("%w to %s after %s, %d sessions were open", ErrQueueTimeout, hostName, timeout, active)
+		}
+		l.mutex.Unlock()
+	}
+
+	waitMs := float64(time.Since(start).Microseconds()) / 1000
+	now := time.Now().UTC()
+	l.mutex.Lock()
+	h.stats.Waited++
+	h.totalWaitMs += waitMs
+	h.stats.AvgWaitMs = h.totalWaitMs / float64(h.stats.Waited)
+	h.stats.MaxWaitMs = max(h.stats.MaxWaitMs, waitMs)
+	h.stats.LastWaitMs, h.stats.LastWaitAt = waitMs, &now
+	l.mutex.Unlock()
+	return l.releaser(h), nil
+}
+
+// releaser frees the slot once, handing it to the oldest waiter if there is one
+func (l *Limiter) releaser(h *host) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			h.stats.Active--
+			l.admitLocked(h)
+		})
+	}
+}
+
+// admitLocked hands free slots to the oldest waiters
+func (l *Limiter) admitLocked(h *host) {
+	for h.stats.Active < l.config.MaxSessionsPerNode && len(h.waiters) > 0 {
+		close(h.waiters[0])
+		h.waiters = h.waiters[1:]
+		h.stats.Active++
+		h.stats.Sessions++
+	}
+	h.stats.Queued = len(h.waiters)
+}
+
+func (l *Limiter) hostLocked(hostName string) *host {
+	h, ok := l.hosts[hostName]
+	if !ok {
+		h = &host{stats: HostStats{Host: hostName}}
+		l.hosts[hostName] = h
+	}
+	return h
+}
+
+// Status returns the sessions and queue wait times of every host, sorted by host
+func (l *Limiter) Status() []HostStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	statuses := make([]HostStats, 0, len(l.hosts))
+	for _, h := range l.hosts {
+		statuses = append(statuses, h.stats)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
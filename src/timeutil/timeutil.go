@@ -0,0 +1,63 @@
+package timeutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueryParam is the query parameter used to render timestamps in a caller's time zone
+const QueryParam = "tz"
+
+// Now returns the current time in UTC; all API timestamps are UTC
+func Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Format renders t as RFC3339 in UTC
+func Format(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// FormatIn renders t as RFC3339 in the given location (UTC if nil)
+func FormatIn(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// ParseLocation parses an IANA time zone name such as "Asia/Kolkata";
+// an empty value means UTC
+func ParseLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "UTC") {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: use an IANA name such as Asia/Kolkata", name)
+	}
+	return loc, nil
+}
+
+// ServerZone describes the manager host's local time zone
+type ServerZone struct {
+	Name          string `json:"name"`
+	OffsetSeconds int    `json:"offsetSeconds"`
+	Offset        string `json:"offset"`
+}
+
+// LocalZone returns the server's local time zone at the current instant
+func LocalZone() ServerZone {
+	now := time.Now()
+	name, offset := now.Zone()
+	if location := time.Local.String(); location != "Local" && location != "" {
+		name = location
+	}
+	return ServerZone{
+		Name:          name,
+		OffsetSeconds: offset,
+		Offset:        now.Format("-07:00"),
+	}
+}
@@ -25,14 +25,12 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	// Register client
-	handlers.AppState.Mutex.Lock()
-	handlers.AppState.Clients[conn] = true
-	handlers.AppState.Mutex.Unlock()
+	// Register client; its messages go through its writer from now on
+	handlers.AppState.AddClient(conn)
 
 	// Send initial state
-	initialState, _ := json.Marshal(handlers.AppState)
-	conn.WriteMessage(websocket.TextMessage, initialState)
+	initialState, _ := json.Marshal(handlers.AppState.Snapshot())
+	handlers.AppState.SendToClient(conn, initialState)
 
 	// Listen for client messages
 	for {
@@ -49,7 +47,5 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Unregister client
-	handlers.AppState.Mutex.Lock()
-	delete(handlers.AppState.Clients, conn)
-	handlers.AppState.Mutex.Unlock()
+	handlers.AppState.RemoveClient(conn)
 }
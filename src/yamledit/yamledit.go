@@ -0,0 +1,422 @@
+// Package yamledit changes individual keys of a YAML document while keeping the rest of
+// the file as it was written: comments, key order, anchors, quoting, indentation and
+// blank lines.
+//
+// Every edit is made on the parsed yaml.Node tree and, where possible, as a text edit of
+// the original bytes: a scalar value is replaced where it stands, and a new or changed
+// block is rendered and spliced in at its lines. The text edit is only kept if it parses
+// to the same content as the edited tree; otherwise the whole tree is encoded again, which
+// still keeps comments, anchors and key order but not blank lines or custom indentation.
+package yamledit
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a YAML mapping document being edited
+type Document struct {
+	data []byte
+	root yaml.Node
+}
+
+// Parse reads a YAML document whose top level is a mapping; an empty document is taken
+// as an empty mapping
+func Parse(data []byte) (*Document, error) {
+	d := &Document{}
+	if err := d.load(data); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Document) load(data []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("failed to parse YAML: %v", err)
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("the YAML document is not a mapping")
+	}
+	d.data, d.root = data, root
+	return nil
+}
+
+// Bytes returns the edited document
+func (d *Document) Bytes() []byte {
+	return d.data
+}
+
+// Lookup returns the node at a path of mapping keys, e.g. "uniquekey", "NumUniqKey".
+// Keys are matched whole, so "output.kafka" is one key.
+func (d *Document) Lookup(path ...string) (*yaml.Node, bool) {
+	node := d.root.Content[0]
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil, false
+		}
+		i := findKey(node, key)
+		if i < 0 {
+			return nil, false
+		}
+		node = node.Content[i+1]
+	}
+	return node, true
+}
+
+// Set sets the value at a path of mapping keys, adding the key and any missing mappings
+// on the way. The value is a *yaml.Node or anything yaml can encode. A new scalar replacing
+// a quoted string keeps its quotes, and the comments of the replaced value are kept.
+func (d *Document) Set(value interface{}, path ...string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("no key given")
+	}
+	node, ok := value.(*yaml.Node)
+	if !ok {
+		node = &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode value of %s: %v", strings.Join(path, "."), err)
+		}
+	}
+
+	lines := d.lines()
+	mapping := d.root.Content[0]
+	inFlow := false
+	for depth, key := range path {
+		inFlow = inFlow || mapping.Style&yaml.FlowStyle != 0
+		i := findKey(mapping, key)
+		if i < 0 {
+			newKey, entry := keyNode(key), nest(node, path[depth+1:])
+			lines = insertEntry(lines, mapping, inFlow, newKey, entry)
+			mapping.Content = append(mapping.Content, newKey, entry)
+			return d.commit(lines)
+		}
+
+		current := mapping.Content[i+1]
+		if depth < len(path)-1 {
+			switch {
+			case current.Kind == yaml.AliasNode:
+				return fmt.Errorf("%s is an alias; edit its anchor instead", strings.Join(path[:depth+1], "."))
+			case current.Kind == yaml.ScalarNode && current.Tag == "!!null":
+				// An empty "key:" becomes the mapping the rest of the path goes into
+				mapping.Content[i+1] = nest(node, path[depth+1:])
+				mapping.Content[i+1].LineComment = current.LineComment
+				return d.commit(replaceEntry(lines, mapping, inFlow, i, current))
+			case current.Kind != yaml.MappingNode:
+				return fmt.Errorf("%s is not a mapping", strings.Join(path[:depth+1], "."))
+			}
+			mapping = current
+			continue
+		}
+
+		if current.Kind == yaml.ScalarNode && node.Kind == yaml.ScalarNode {
+			if node.Style == 0 && node.Tag == "!!str" {
+				node.Style = current.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+			}
+			previous := *current
+			current.Tag, current.Value, current.Style = node.Tag, node.Value, node.Style
+			if spliced := spliceScalar(lines, &previous, current, inFlow); spliced != nil {
+				return d.commit(spliced)
+			}
+			return d.commit(replaceEntry(lines, mapping, inFlow, i, &previous))
+		}
+
+		if node.LineComment == "" {
+			node.LineComment = current.LineComment
+		}
+		mapping.Content[i+1] = node
+		return d.commit(replaceEntry(lines, mapping, inFlow, i, current))
+	}
+	return nil
+}
+
+// Delete removes the key at a path and its value, reporting whether it was there
+func (d *Document) Delete(path ...string) (bool, error) {
+	if len(path) == 0 {
+		return false, fmt.Errorf("no key given")
+	}
+	parent, ok := d.Lookup(path[:len(path)-1]...)
+	if !ok || parent.Kind != yaml.MappingNode {
+		return false, nil
+	}
+	i := findKey(parent, path[len(path)-1])
+	if i < 0 {
+		return false, nil
+	}
+
+	var lines []string
+	if parent.Style&yaml.FlowStyle == 0 && !inFlowPath(&d.root, path) {
+		lines = d.lines()
+		start, end := parent.Content[i].Line-1, entryEnd(lines, parent, i)
+		if parent.Content[i].HeadComment != "" {
+			for start > 0 && isCommentLine(lines[start-1]) && indentOf(lines[start-1]) == indentOf(lines[start]) {
+				start--
+			}
+		}
+		lines = append(lines[:start:start], lines[end+1:]...)
+	}
+	parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+	return true, d.commit(lines)
+}
+
+// commit keeps the edited lines if they parse to the edited tree, and otherwise encodes
+// the tree again
+func (d *Document) commit(lines []string) error {
+	if lines != nil {
+		candidate := []byte(strings.Join(lines, "\n"))
+		var parsed yaml.Node
+		if yaml.Unmarshal(candidate, &parsed) == nil && sameContent(&parsed, &d.root) {
+			return d.load(candidate)
+		}
+	}
+
+	clearMergeTags(&d.root)
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&d.root); err != nil {
+		return fmt.Errorf("failed to encode YAML: %v", err)
+	}
+	encoder.Close()
+	return d.load(buf.Bytes())
+}
+
+func (d *Document) lines() []string {
+	return strings.Split(string(d.data), "\n")
+}
+
+// sameContent reports whether two documents hold the same data, ignoring comments and
+// formatting
+func sameContent(a, b *yaml.Node) bool {
+	var left, right interface{}
+	if a.Decode(&left) != nil || b.Decode(&right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// spliceScalar replaces a single-line plain or quoted scalar where it stands, or returns
+// nil if it cannot be located
+func spliceScalar(lines []string, previous, updated *yaml.Node, inFlow bool) []string {
+	if lines == nil || previous.Line == 0 || previous.Anchor != "" {
+		return nil
+	}
+	text, err := yaml.Marshal(&yaml.Node{Kind: yaml.ScalarNode, Tag: updated.Tag, Value: updated.Value, Style: updated.Style})
+	if err != nil {
+		return nil
+	}
+	replacement := strings.TrimSuffix(string(text), "\n")
+	if strings.Contains(replacement, "\n") {
+		return nil
+	}
+
+	line := []rune(lines[previous.Line-1])
+	start := previous.Column - 1
+	if start < 0 || start >= len(line) {
+		return nil
+	}
+	end := scalarEnd(line, start, previous, inFlow)
+	if end < 0 {
+		return nil
+	}
+	lines[previous.Line-1] = string(line[:start]) + replacement + string(line[end:])
+	return lines
+}
+
+// scalarEnd returns the index just past a scalar starting at start, or -1
+func scalarEnd(line []rune, start int, scalar *yaml.Node, inFlow bool) int {
+	switch scalar.Style {
+	case yaml.DoubleQuotedStyle:
+		for j := start + 1; j < len(line); j++ {
+			switch line[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for j := start + 1; j < len(line); j++ {
+			if line[j] != '\'' {
+				continue
+			}
+			if j+1 < len(line) && line[j+1] == '\'' {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	case 0:
+		end := start
+		for ; end < len(line); end++ {
+			if line[end] == '#' && end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+				break
+			}
+			if inFlow && strings.ContainsRune(",]}", line[end]) {
+				break
+			}
+		}
+		for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+			end--
+		}
+		// A plain scalar continued on the next lines does not match its value
+		if string(line[start:end]) == scalar.Value {
+			return end
+		}
+	}
+	return -1
+}
+
+// insertEntry adds a rendered key and value after the last entry of a block mapping, or
+// returns nil if the mapping has no lines to place it after
+func insertEntry(lines []string, mapping *yaml.Node, inFlow bool, key, value *yaml.Node) []string {
+	if lines == nil || inFlow || mapping.Style&yaml.FlowStyle != 0 || len(mapping.Content) == 0 || mapping.Line == 0 {
+		return nil
+	}
+	rendered := renderEntry(key, value, mapping.Column-1)
+	if rendered == nil {
+		return nil
+	}
+	after := entryEnd(lines, mapping, len(mapping.Content)-2) + 1
+	updated := append(append(append([]string{}, lines[:after]...), rendered...), lines[after:]...)
+	return updated
+}
+
+// replaceEntry renders the entry at i again over its lines, or returns nil for entries
+// of flow mappings; previous is the value the lines hold
+func replaceEntry(lines []string, mapping *yaml.Node, inFlow bool, i int, previous *yaml.Node) []string {
+	if lines == nil || inFlow || mapping.Style&yaml.FlowStyle != 0 || mapping.Content[i].Line == 0 {
+		return nil
+	}
+	rendered := renderEntry(mapping.Content[i], mapping.Content[i+1], mapping.Column-1)
+	if rendered == nil {
+		return nil
+	}
+	// A sequence written with its items at the key's indentation stays that way
+	if current := mapping.Content[i+1]; current.Kind == yaml.SequenceNode && current.Style&yaml.FlowStyle == 0 &&
+		previous.Kind == yaml.SequenceNode && len(previous.Content) > 0 && previous.Content[0].Line > 0 &&
+		indentOf(lines[previous.Content[0].Line-1]) == mapping.Column-1 {
+		for n := 1; n < len(rendered); n++ {
+			rendered[n] = strings.TrimPrefix(rendered[n], "  ")
+		}
+	}
+
+	// The extent is measured with the previous value, which the lines still hold
+	current := mapping.Content[i+1]
+	mapping.Content[i+1] = previous
+	start, end := mapping.Content[i].Line-1, entryEnd(lines, mapping, i)
+	mapping.Content[i+1] = current
+	return append(append(append([]string{}, lines[:start]...), rendered...), lines[end+1:]...)
+}
+
+// renderEntry encodes a key and value as block YAML indented by indent spaces. The key's
+// head comment stays on the lines above and the value's foot comment on the lines below,
+// so neither is rendered.
+func renderEntry(key, value *yaml.Node, indent int) []string {
+	k, v := *key, *value
+	k.HeadComment, k.FootComment, v.FootComment = "", "", ""
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{&k, &v}}); err != nil {
+		return nil
+	}
+	encoder.Close()
+
+	rendered := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	prefix := strings.Repeat(" ", indent)
+	for i, line := range rendered {
+		if line != "" {
+			rendered[i] = prefix + line
+		}
+	}
+	return rendered
+}
+
+// entryEnd returns the index of the last line of the mapping entry at i: the key's line
+// and the more indented lines after it, or the "- " items of a sequence value at the
+// key's indentation. Blank and comment lines after the entry are not part of it.
+func entryEnd(lines []string, mapping *yaml.Node, i int) int {
+	indent := mapping.Column - 1
+	sequence := mapping.Content[i+1].Kind == yaml.SequenceNode
+	last := mapping.Content[i].Line - 1
+	for n := last + 1; n < len(lines); n++ {
+		trimmed := strings.TrimSpace(lines[n])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			break
+		}
+		lineIndent := indentOf(lines[n])
+		if lineIndent > indent || (lineIndent == indent && sequence && (trimmed == "-" || strings.HasPrefix(trimmed, "- "))) {
+			last = n
+			continue
+		}
+		break
+	}
+	return last
+}
+
+// inFlowPath reports whether any mapping holding the key at path is a flow mapping
+func inFlowPath(root *yaml.Node, path []string) bool {
+	node := root.Content[0]
+	for _, key := range path {
+		if node.Style&yaml.FlowStyle != 0 {
+			return true
+		}
+		i := findKey(node, key)
+		if i < 0 {
+			return false
+		}
+		node = node.Content[i+1]
+	}
+	return false
+}
+
+// nest wraps a value in mappings of the keys, outermost first
+func nest(value *yaml.Node, keys []string) *yaml.Node {
+	for j := len(keys) - 1; j >= 0; j-- {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{keyNode(keys[j]), value}}
+	}
+	return value
+}
+
+// clearMergeTags drops the resolved tag of "<<" keys, which the encoder would otherwise
+// write out as "!!merge <<"
+func clearMergeTags(node *yaml.Node) {
+	if node.Tag == "!!merge" {
+		node.Tag = ""
+	}
+	for _, child := range node.Content {
+		clearMergeTags(child)
+	}
+}
+
+func findKey(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func keyNode(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isCommentLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
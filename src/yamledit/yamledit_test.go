@@ -0,0 +1,279 @@
+package yamledit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mainConf is a main conf.yml as operators keep it: commented, with blank lines, an
+// anchor and quoted values
+const mainConf = `# vuDataSim main configuration
+data_generation_time:
+  type: real-time
+
+# Sources included in the run
+include_module_dirs:
+  Apache:
+    enabled: false   # web tier
+  MongoDB:
+    enabled: true
+  # Mssql is kept off until the licence is sorted
+  Mssql:
+    enabled: false
+
+logging: &logging
+  console: false
+  directory: "/home/vunet/vuDataSim/logs/"
+  level: error
+audit_logging: *logging
+output.kafka:
+  enabled: true
+  hosts:
+    - 164.52.213.181:9094 # primary
+  partition.round_robin:
+    reachable_only: false
+  ssl: true
+`
+
+// sourceConf is a source conf.yml with commented-out keys and a flow sequence
+const sourceConf = `enabled: true
+uniquekey:
+  name: "host"
+  DataType: IPv4
+  ValueType: "RandomFixed"
+  Value: "10.10.10.1"
+  NumUniqKey: 28767
+period: 1s
+#LogsPerSec: 600
+
+# Include following yml files from this directory
+#Include_sub_modules: [status, logs]
+Include_sub_modules: [status]
+`
+
+func TestSetKeepsTheRestOfTheFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		edit  func(d *Document) error
+		want  string
+	}{
+		{
+			name:  "source NumUniqKey",
+			input: sourceConf,
+			edit:  func(d *Document) error { return d.Set(1500, "uniquekey", "NumUniqKey") },
+			want:  strings.Replace(sourceConf, "NumUniqKey: 28767", "NumUniqKey: 1500", 1),
+		},
+		{
+			name:  "main conf enabled flag with trailing comment",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set(true, "include_module_dirs", "Apache", "enabled") },
+			want:  strings.Replace(mainConf, "enabled: false   # web tier", "enabled: true   # web tier", 1),
+		},
+		{
+			name:  "main conf every enabled flag",
+			input: mainConf,
+			edit: func(d *Document) error {
+				for _, source := range []string{"Apache", "MongoDB", "Mssql"} {
+					if err := d.Set(source != "MongoDB", "include_module_dirs", source, "enabled"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: strings.NewReplacer(
+				"enabled: false   # web tier", "enabled: true   # web tier",
+				"  MongoDB:\n    enabled: true", "  MongoDB:\n    enabled: false",
+				"  Mssql:\n    enabled: false", "  Mssql:\n    enabled: true",
+			).Replace(mainConf),
+		},
+		{
+			name:  "unchanged value",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set(false, "include_module_dirs", "Mssql", "enabled") },
+			want:  mainConf,
+		},
+		{
+			name:  "new source is appended to its mapping",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set(true, "include_module_dirs", "Nginx", "enabled") },
+			want: strings.Replace(mainConf, "  Mssql:\n    enabled: false\n",
+				"  Mssql:\n    enabled: false\n  Nginx:\n    enabled: true\n", 1),
+		},
+		{
+			name:  "value inside an anchored mapping",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set("info", "logging", "level") },
+			want:  strings.Replace(mainConf, "  level: error", "  level: info", 1),
+		},
+		{
+			name:  "quoted string keeps its quotes",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set("/var/log/vudatasim/", "logging", "directory") },
+			want:  strings.Replace(mainConf, `"/home/vunet/vuDataSim/logs/"`, `"/var/log/vudatasim/"`, 1),
+		},
+		{
+			name:  "dotted key",
+			input: mainConf,
+			edit:  func(d *Document) error { return d.Set("vudatasim-logs", "output.kafka", "topic") },
+			want:  strings.Replace(mainConf, "  ssl: true\n", "  ssl: true\n  topic: vudatasim-logs\n", 1),
+		},
+		{
+			name:  "kafka hosts",
+			input: mainConf,
+			edit: func(d *Document) error {
+				return d.Set([]string{"10.0.0.1:9094", "10.0.0.2:9094"}, "output.kafka", "hosts")
+			},
+			want: strings.Replace(mainConf, "    - 164.52.213.181:9094 # primary\n",
+				"    - 10.0.0.1:9094\n    - 10.0.0.2:9094\n", 1),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			document, err := Parse([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if err := tc.edit(document); err != nil {
+				t.Fatalf("edit: %v", err)
+			}
+			if got := string(document.Bytes()); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	document, err := Parse([]byte(mainConf))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	deleted, err := document.Delete("output.kafka", "hosts")
+	if err != nil || !deleted {
+		t.Fatalf("Delete = %v, %v; want true, nil", deleted, err)
+	}
+	want := strings.Replace(mainConf, "  hosts:\n    - 164.52.213.181:9094 # primary\n", "", 1)
+	if got := string(document.Bytes()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	deleted, err = document.Delete("output.kafka", "hosts")
+	if err != nil || deleted {
+		t.Errorf("second Delete = %v, %v; want false, nil", deleted, err)
+	}
+	if got := string(document.Bytes()); got != want {
+		t.Errorf("deleting a missing key changed the document")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	document, err := Parse([]byte(mainConf))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	node, ok := document.Lookup("output.kafka", "partition.round_robin", "reachable_only")
+	if !ok || node.Value != "false" {
+		t.Errorf("Lookup of a nested dotted key = %v, %v", node, ok)
+	}
+	// An alias is returned as such, and sees edits made through its anchor
+	if err := document.Set("info", "logging", "level"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	alias, ok := document.Lookup("audit_logging")
+	if !ok || alias.Kind != yaml.AliasNode || alias.Alias == nil {
+		t.Fatalf("Lookup of an alias = %v, %v", alias, ok)
+	}
+	if level := alias.Alias.Content[5]; level.Value != "info" {
+		t.Errorf("the alias reads level %s after the anchored mapping changed", level.Value)
+	}
+	if _, ok := document.Lookup("include_module_dirs", "Nginx"); ok {
+		t.Errorf("Lookup found a missing key")
+	}
+}
+
+func TestSetEmptyDocument(t *testing.T) {
+	document, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := document.Set(100, "uniquekey", "NumUniqKey"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, want := string(document.Bytes()), "uniquekey:\n  NumUniqKey: 100\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSetThroughScalarFails(t *testing.T) {
+	document, err := Parse([]byte(sourceConf))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := document.Set(1, "period", "seconds"); err == nil {
+		t.Errorf("setting a key below a scalar succeeded")
+	}
+	if got := string(document.Bytes()); got != sourceConf {
+		t.Errorf("a failed Set changed the document:\n%s", got)
+	}
+}
+
+// TestShippedConfD edits the conf.d files shipped with the repository the way the
+// source manager does and checks that only the edited line changes
+func TestShippedConfD(t *testing.T) {
+	confD := filepath.Join("..", "migrate", "conf.d")
+	sources, err := filepath.Glob(filepath.Join(confD, "*", "conf.yml"))
+	if err != nil || len(sources) == 0 {
+		t.Skipf("no shipped conf.d found in %s", confD)
+	}
+	for _, file := range append(sources, filepath.Join(confD, "conf.yml")) {
+		t.Run(file, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			document, err := Parse(data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			path := []string{"uniquekey", "NumUniqKey"}
+			if _, ok := document.Lookup("include_module_dirs"); ok {
+				path = []string{"include_module_dirs", "Apache", "enabled"}
+			}
+			previous, ok := document.Lookup(path...)
+			if !ok {
+				t.Skipf("%s has no %s", file, strings.Join(path, "."))
+			}
+			var value interface{} = 4242
+			if previous.Tag == "!!bool" {
+				value = previous.Value != "true"
+			}
+			if err := document.Set(value, path...); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			before := strings.Split(string(data), "\n")
+			after := strings.Split(string(document.Bytes()), "\n")
+			if len(before) != len(after) {
+				t.Fatalf("line count changed from %d to %d", len(before), len(after))
+			}
+			changed := 0
+			for i := range before {
+				if before[i] != after[i] {
+					changed++
+					if !strings.Contains(after[i], fmt.Sprint(value)) {
+						t.Errorf("line %d changed to %q, not to the new value", i+1, after[i])
+					}
+				}
+			}
+			if changed != 1 {
+				t.Errorf("%d lines changed, want 1", changed)
+			}
+		})
+	}
+}
@@ -183,7 +183,7 @@ class BinaryControl {
                 <td class="p-3 font-medium">${status.nodeName}</td>
                 <td class="p-3">${statusBadge}</td>
                 <td class="p-3">${status.pid || '-'}</td>
-                <td class="p-3">${status.lastChecked || '-'}</td>
+                <td class="p-3">${status.lastChecked ? new Date(status.lastChecked).toLocaleString() : '-'}</td>
             `;
 
             tbody.appendChild(row);
@@ -252,7 +252,7 @@ class BinaryControl {
         this.manager.elements.binaryCurrentStatus.textContent = status.status;
         this.manager.elements.binaryCurrentPid.textContent = status.pid || '-';
         this.manager.elements.binaryCurrentStartTime.textContent = status.startTime || '-';
-        this.manager.elements.binaryCurrentLastChecked.textContent = status.lastChecked || '-';
+        this.manager.elements.binaryCurrentLastChecked.textContent = status.lastChecked ? new Date(status.lastChecked).toLocaleString() : '-';
         this.manager.elements.binaryCurrentProcessInfo.textContent = status.processInfo || '-';
 
         // Update button states based on status
@@ -202,7 +202,8 @@ class DashboardManager {
 
             displayableNodes.forEach(node => {
                 const realMetrics = this.clusterMetrics[node.nodeId || node.name];
-                if (realMetrics) {
+                // Stale samples are left out of the fleet average
+                if (realMetrics && !realMetrics.stale) {
                     totalRealCpu += realMetrics.cpu_cores;
                     totalRealMemory += realMetrics.total_memory_gb;
                     totalUsedMemory += realMetrics.used_memory_gb;
@@ -218,16 +219,19 @@ class DashboardManager {
                 const availableCpu = avgRealCpu * 0.1; // Show 10% usage as example
 
                 this.manager.elements.cpuMemoryValue.textContent = `${availableCpu.toFixed(1)}/${avgRealCpu.toFixed(1)} cores / ${avgUsedMemory.toFixed(1)}/${avgRealMemory.toFixed(1)} GB`;
-            } else {
-                // Fallback to old calculation
-                const totalAvgCpu = displayableNodes.reduce((sum, node) => sum + node.totalCpu, 0) / displayableNodes.length;
-                const totalAvgMemory = displayableNodes.reduce((sum, node) => sum + node.totalMemory, 0) / displayableNodes.length;
-                const avgCpuUsage = displayableNodes.reduce((sum, node) => sum + node.cpu, 0) / displayableNodes.length;
-                const avgMemoryUsage = displayableNodes.reduce((sum, node) => sum + node.memory, 0) / displayableNodes.length;
+            } else if (displayableNodes.some(node => !node.stale)) {
+                // Fallback to old calculation over nodes with fresh metrics
+                const freshNodes = displayableNodes.filter(node => !node.stale);
+                const totalAvgCpu = freshNodes.reduce((sum, node) => sum + node.totalCpu, 0) / freshNodes.length;
+                const totalAvgMemory = freshNodes.reduce((sum, node) => sum + node.totalMemory, 0) / freshNodes.length;
+                const avgCpuUsage = freshNodes.reduce((sum, node) => sum + node.cpu, 0) / freshNodes.length;
+                const avgMemoryUsage = freshNodes.reduce((sum, node) => sum + node.memory, 0) / freshNodes.length;
                 const availableCpu = totalAvgCpu - (totalAvgCpu * avgCpuUsage / 100);
                 const usedMemory = totalAvgMemory * (avgMemoryUsage / 100);
 
                 this.manager.elements.cpuMemoryValue.textContent = `${availableCpu.toFixed(1)}/${totalAvgCpu.toFixed(1)} cores / ${usedMemory.toFixed(1)}/${totalAvgMemory.toFixed(1)} GB`;
+            } else {
+                this.manager.elements.cpuMemoryValue.textContent = 'No fresh metrics';
             }
 
         }
@@ -351,6 +355,27 @@ class DashboardManager {
         });
     }
 
+    async refreshMaintenanceBadge() {
+        const badge = document.getElementById('maintenance-badge');
+        if (!badge) return;
+        try {
+            const response = await this.manager.callAPI('/api/maintenance');
+            const active = (response.success && response.data && response.data.active) || [];
+            if (active.length === 0) {
+                badge.classList.add('hidden');
+                return;
+            }
+            // Alerts and scheduled runs are suppressed until the last active window ends
+            const end = new Date(Math.max(...active.map(window => new Date(window.end).getTime())));
+            const reasons = active.map(window => window.reason).filter(reason => reason);
+            document.getElementById('maintenance-badge-text').textContent =
+                `Maintenance until ${end.toLocaleString()}${reasons.length > 0 ? ` - ${reasons.join(', ')}` : ''}`;
+            badge.classList.remove('hidden');
+        } catch (error) {
+            console.error('Error fetching maintenance windows:', error);
+        }
+    }
+
     async fetchFinalVuDataSimMetrics() {
         try {
             // Use proxy endpoint instead of direct call to avoid CORS
@@ -20,7 +20,7 @@ class LogsManager {
             const response = await this.manager.callAPI('/api/logs?limit=50');
             if (response.success && response.data && response.data.logs) {
                 this.logEntries = response.data.logs.map(log => ({
-                    time: log.timestamp,
+                    time: new Date(log.timestamp).toLocaleString(),
                     node: log.node,
                     module: log.module,
                     message: log.message,
@@ -303,8 +303,9 @@ class VuDataSimManager {
             // Note: updateDashboardDisplay() is now called hourly for SSH status
         }, 3000);
 
-        // Cluster metrics updates - Update every 30 seconds
+        // Cluster metrics and maintenance badge updates - Update every 30 seconds
         setInterval(async () => {
+            this.dashboard.refreshMaintenanceBadge();
             try {
                 const metricsResponse = await this.callAPI('/api/cluster/metrics');
                 console.log('=== CLUSTER METRICS API RESPONSE ===');
@@ -350,6 +351,7 @@ class VuDataSimManager {
         this.nodeManagement.refreshNodesTable();
         this.logsManager.loadLogs(); // Load real logs instead of static ones
         this.logsManager.displayLogs(this.logEntries);
+        this.dashboard.refreshMaintenanceBadge();
 
         // Set up WebSocket connection for real-time updates
         this.setupWebSocket();